@@ -0,0 +1,240 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// the TLS alert sent when the client didn't offer any application protocol we support
+const alertNoApplicationProtocol = 120
+
+// the maximum number of sessions that are queued for every application protocol
+const alpnAcceptQueueLen = 5
+
+var errListenerClosed = errors.New("server closed")
+
+type alpnMux struct {
+	ln Listener
+
+	listeners map[string]*alpnListener // not modified after construction
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error // set when closed is closed
+
+	logger utils.Logger
+}
+
+var _ ListenerMux = &alpnMux{}
+
+// ListenAddrMux creates a QUIC server listening on a given address,
+// dispatching sessions based on the negotiated application protocol.
+// If Config.AcceptEarlySessions is set, sessions are dispatched once the handshake completes.
+// The tls.Config must not be nil and must contain at least one entry in NextProtos, the quic.Config may be nil.
+func ListenAddrMux(addr string, tlsConf *tls.Config, config *Config) (ListenerMux, error) {
+	if err := validateNextProtos(tlsConf); err != nil {
+		return nil, err
+	}
+	ln, err := ListenAddr(addr, tlsConf, config)
+	if err != nil {
+		return nil, err
+	}
+	return newALPNMux(ln, tlsConf.NextProtos), nil
+}
+
+// ListenMux listens for QUIC connections on a given net.PacketConn,
+// dispatching sessions based on the negotiated application protocol.
+// If Config.AcceptEarlySessions is set, sessions are dispatched once the handshake completes.
+// The tls.Config must not be nil and must contain at least one entry in NextProtos, the quic.Config may be nil.
+func ListenMux(conn net.PacketConn, tlsConf *tls.Config, config *Config) (ListenerMux, error) {
+	if err := validateNextProtos(tlsConf); err != nil {
+		return nil, err
+	}
+	ln, err := Listen(conn, tlsConf, config)
+	if err != nil {
+		return nil, err
+	}
+	return newALPNMux(ln, tlsConf.NextProtos), nil
+}
+
+func validateNextProtos(tlsConf *tls.Config) error {
+	if tlsConf == nil || len(tlsConf.NextProtos) == 0 {
+		return errors.New("quic: tls.Config.NextProtos must not be empty")
+	}
+	return nil
+}
+
+func newALPNMux(ln Listener, protos []string) *alpnMux {
+	m := &alpnMux{
+		ln:        ln,
+		listeners: make(map[string]*alpnListener, len(protos)),
+		closed:    make(chan struct{}),
+		logger:    utils.DefaultLogger.WithPrefix("server"),
+	}
+	for _, proto := range protos {
+		m.listeners[proto] = &alpnListener{
+			mux:          m,
+			proto:        proto,
+			sessionQueue: make(chan Session, alpnAcceptQueueLen),
+			closed:       make(chan struct{}),
+		}
+	}
+	go m.run()
+	return m
+}
+
+func (m *alpnMux) run() {
+	for {
+		sess, err := m.ln.Accept(context.Background())
+		if err != nil {
+			m.closeWithError(err)
+			return
+		}
+		select {
+		case <-sess.HandshakeComplete().Done():
+			m.dispatch(sess)
+		default:
+			// When using AcceptEarlySessions, the application protocol is only known once the handshake completes.
+			go func() {
+				<-sess.HandshakeComplete().Done()
+				m.dispatch(sess)
+			}()
+		}
+	}
+}
+
+func (m *alpnMux) dispatch(sess Session) {
+	if sess.Context().Err() != nil {
+		// the handshake failed, or the session was closed in the meantime
+		return
+	}
+	proto := sess.ConnectionState().NegotiatedProtocol
+	l, ok := m.listeners[proto]
+	if !ok {
+		m.logger.Debugf("Closing session with unknown application protocol %q", proto)
+		closeWithTransportError(sess, qerr.CryptoErrorCode(alertNoApplicationProtocol), fmt.Sprintf("no application protocol for %q", proto))
+		return
+	}
+	l.queue(sess)
+}
+
+// closeWithTransportError closes a session with a transport error.
+// In contrast to Session.CloseWithError, it doesn't block.
+func closeWithTransportError(sess Session, code qerr.ErrorCode, msg string) {
+	sess.(quicSession).closeLocal(qerr.Error(code, msg))
+}
+
+func (m *alpnMux) Listener(proto string) (Listener, error) {
+	l, ok := m.listeners[proto]
+	if !ok {
+		return nil, fmt.Errorf("quic: application protocol %q is not contained in tls.Config.NextProtos", proto)
+	}
+	return l, nil
+}
+
+func (m *alpnMux) Addr() net.Addr {
+	return m.ln.Addr()
+}
+
+func (m *alpnMux) Close() error {
+	m.closeWithError(errListenerClosed)
+	return m.ln.Close()
+}
+
+func (m *alpnMux) closeWithError(e error) {
+	m.closeOnce.Do(func() {
+		m.err = e
+		close(m.closed)
+		for _, l := range m.listeners {
+			l.closeQueuedSessions()
+		}
+	})
+}
+
+// An alpnListener is the Listener for a single application protocol.
+type alpnListener struct {
+	mux   *alpnMux
+	proto string
+
+	mutex        sync.Mutex // makes sure that no sessions are queued after closeQueuedSessions
+	sessionQueue chan Session
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ Listener = &alpnListener{}
+
+func (l *alpnListener) queue(sess Session) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	select {
+	case <-l.closed:
+		closeWithTransportError(sess, qerr.ConnectionRefused, "listener closed")
+		return
+	case <-l.mux.closed:
+		closeWithTransportError(sess, qerr.ConnectionRefused, "listener closed")
+		return
+	default:
+	}
+	select {
+	case l.sessionQueue <- sess:
+	default:
+		// Don't block the other application protocols if this listener isn't accepting sessions fast enough.
+		l.mux.logger.Debugf("Accept queue for application protocol %q full. Refusing session.", l.proto)
+		closeWithTransportError(sess, qerr.ConnectionRefused, "accept queue full")
+	}
+}
+
+func (l *alpnListener) Accept(ctx context.Context) (Session, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case sess := <-l.sessionQueue:
+		return sess, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	case <-l.mux.closed:
+		return nil, l.mux.err
+	}
+}
+
+func (l *alpnListener) Addr() net.Addr {
+	return l.mux.Addr()
+}
+
+// Close stops accepting sessions for this application protocol.
+// Sessions that were queued, but not yet accepted, are closed,
+// as are sessions that negotiate this application protocol from now on.
+// It doesn't close the underlying Listener.
+func (l *alpnListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.closeQueuedSessions()
+	})
+	return nil
+}
+
+// closeQueuedSessions closes all sessions that completed the handshake, but were not accepted.
+// It must be called after closing the listener (or the mux).
+func (l *alpnListener) closeQueuedSessions() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for {
+		select {
+		case sess := <-l.sessionQueue:
+			closeWithTransportError(sess, qerr.ConnectionRefused, "listener closed")
+		default:
+			return
+		}
+	}
+}
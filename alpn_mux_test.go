@@ -0,0 +1,278 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+)
+
+type mockListener struct {
+	sessions  chan Session
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ Listener = &mockListener{}
+
+func newMockListener() *mockListener {
+	return &mockListener{
+		sessions: make(chan Session, 10),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (l *mockListener) Accept(context.Context) (Session, error) {
+	select {
+	case sess := <-l.sessions:
+		return sess, nil
+	case <-l.closed:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *mockListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *mockListener) Addr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1234}
+}
+
+var _ = Describe("ALPN mux", func() {
+	var (
+		ln  *mockListener
+		mux *alpnMux
+	)
+
+	// newEarlySession creates a session for which the handshake is still running
+	newEarlySession := func(proto string) (sess *MockQuicSession, completeHandshake, closeSession context.CancelFunc) {
+		sess = NewMockQuicSession(mockCtrl)
+		sess.EXPECT().ConnectionState().Return(handshake.ConnectionState{NegotiatedProtocol: proto}).AnyTimes()
+		handshakeCtx, handshakeCancel := context.WithCancel(context.Background())
+		sessCtx, sessCancel := context.WithCancel(context.Background())
+		sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+		sess.EXPECT().Context().Return(sessCtx).AnyTimes()
+		return sess, handshakeCancel, func() {
+			sessCancel()
+			handshakeCancel()
+		}
+	}
+
+	newSession := func(proto string) *MockQuicSession {
+		sess, completeHandshake, _ := newEarlySession(proto)
+		completeHandshake()
+		return sess
+	}
+
+	BeforeEach(func() {
+		ln = newMockListener()
+		mux = newALPNMux(ln, []string{"proto1", "proto2"})
+	})
+
+	AfterEach(func() {
+		Expect(mux.Close()).To(Succeed())
+	})
+
+	It("errors when NextProtos is empty", func() {
+		_, err := ListenMux(nil, &tls.Config{}, nil)
+		Expect(err).To(MatchError("quic: tls.Config.NextProtos must not be empty"))
+		_, err = ListenAddrMux("localhost:0", nil, nil)
+		Expect(err).To(MatchError("quic: tls.Config.NextProtos must not be empty"))
+	})
+
+	It("returns the address of the underlying listener", func() {
+		Expect(mux.Addr()).To(Equal(ln.Addr()))
+		l, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(l.Addr()).To(Equal(ln.Addr()))
+	})
+
+	It("errors when getting the listener for an unknown application protocol", func() {
+		_, err := mux.Listener("foobar")
+		Expect(err).To(MatchError("quic: application protocol \"foobar\" is not contained in tls.Config.NextProtos"))
+	})
+
+	It("dispatches sessions based on the application protocol", func() {
+		l1, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		l2, err := mux.Listener("proto2")
+		Expect(err).ToNot(HaveOccurred())
+		sess1 := newSession("proto1")
+		sess2 := newSession("proto2")
+		ln.sessions <- sess2
+		ln.sessions <- sess1
+		sess, err := l1.Accept(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess).To(Equal(sess1))
+		sess, err = l2.Accept(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess).To(Equal(sess2))
+	})
+
+	It("doesn't block other application protocols when a listener isn't accepting", func() {
+		for i := 0; i < alpnAcceptQueueLen; i++ {
+			ln.sessions <- newSession("proto1")
+		}
+		refused := newSession("proto1")
+		done := make(chan struct{})
+		refused.EXPECT().closeLocal(qerr.Error(qerr.ConnectionRefused, "accept queue full")).Do(func(error) { close(done) })
+		ln.sessions <- refused
+		sess := newSession("proto2")
+		ln.sessions <- sess
+		l2, err := mux.Listener("proto2")
+		Expect(err).ToNot(HaveOccurred())
+		s, err := l2.Accept(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(Equal(sess))
+		Eventually(done).Should(BeClosed())
+		// accept all queued sessions for proto1
+		l1, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < alpnAcceptQueueLen; i++ {
+			s, err := l1.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).ToNot(BeIdenticalTo(refused))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = l1.Accept(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	Context("using AcceptEarlySessions", func() {
+		It("dispatches sessions once the handshake completes", func() {
+			l, err := mux.Listener("proto1")
+			Expect(err).ToNot(HaveOccurred())
+			sess, completeHandshake, _ := newEarlySession("proto1")
+			ln.sessions <- sess
+			sessChan := make(chan Session)
+			go func() {
+				defer GinkgoRecover()
+				s, err := l.Accept(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				sessChan <- s
+			}()
+			Consistently(sessChan).ShouldNot(Receive())
+			completeHandshake()
+			var s Session
+			Eventually(sessChan).Should(Receive(&s))
+			Expect(s).To(BeIdenticalTo(sess))
+		})
+
+		It("doesn't block sessions that already completed the handshake", func() {
+			l, err := mux.Listener("proto1")
+			Expect(err).ToNot(HaveOccurred())
+			early, _, closeEarly := newEarlySession("proto1")
+			defer closeEarly()
+			ln.sessions <- early
+			sess := newSession("proto1")
+			ln.sessions <- sess
+			s, err := l.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(BeIdenticalTo(sess))
+		})
+
+		It("doesn't dispatch sessions if the handshake fails", func() {
+			l, err := mux.Listener("proto1")
+			Expect(err).ToNot(HaveOccurred())
+			sess, _, closeSession := newEarlySession("proto1")
+			ln.sessions <- sess
+			closeSession()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err = l.Accept(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	It("closes sessions with an unknown application protocol", func() {
+		sess := newSession("foobar")
+		done := make(chan struct{})
+		sess.EXPECT().closeLocal(gomock.Any()).Do(func(e error) {
+			defer GinkgoRecover()
+			Expect(e).To(MatchError(qerr.Error(qerr.CryptoErrorCode(120), `no application protocol for "foobar"`)))
+			close(done)
+		})
+		ln.sessions <- sess
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("closes sessions for a closed listener", func() {
+		l, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(l.Close()).To(Succeed())
+		_, err = l.Accept(context.Background())
+		Expect(err).To(MatchError("server closed"))
+		sess := newSession("proto1")
+		done := make(chan struct{})
+		sess.EXPECT().closeLocal(qerr.Error(qerr.ConnectionRefused, "listener closed")).Do(func(error) { close(done) })
+		ln.sessions <- sess
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("closes queued sessions when a listener is closed", func() {
+		l, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		var closed sync.WaitGroup
+		closed.Add(2)
+		for i := 0; i < 2; i++ {
+			sess := newSession("proto1")
+			sess.EXPECT().closeLocal(qerr.Error(qerr.ConnectionRefused, "listener closed")).Do(func(error) { closed.Done() })
+			ln.sessions <- sess
+		}
+		Eventually(func() int { return len(mux.listeners["proto1"].sessionQueue) }).Should(Equal(2))
+		Expect(l.Close()).To(Succeed())
+		closed.Wait()
+		_, err = l.Accept(context.Background())
+		Expect(err).To(MatchError("server closed"))
+	})
+
+	It("closes queued sessions when the mux is closed", func() {
+		var closed sync.WaitGroup
+		closed.Add(2)
+		for _, proto := range []string{"proto1", "proto2"} {
+			sess := newSession(proto)
+			sess.EXPECT().closeLocal(qerr.Error(qerr.ConnectionRefused, "listener closed")).Do(func(error) { closed.Done() })
+			ln.sessions <- sess
+		}
+		Eventually(func() int {
+			return len(mux.listeners["proto1"].sessionQueue) + len(mux.listeners["proto2"].sessionQueue)
+		}).Should(Equal(2))
+		Expect(mux.Close()).To(Succeed())
+		closed.Wait()
+	})
+
+	It("returns when the context is canceled", func() {
+		l, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = l.Accept(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("returns the error of the underlying listener", func() {
+		l, err := mux.Listener("proto1")
+		Expect(err).ToNot(HaveOccurred())
+		errChan := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			_, err := l.Accept(context.Background())
+			errChan <- err
+		}()
+		Consistently(errChan).ShouldNot(Receive())
+		Expect(ln.Close()).To(Succeed())
+		Eventually(errChan).Should(Receive(MatchError("listener closed")))
+	})
+})
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
@@ -10,7 +11,6 @@ import (
 
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -19,11 +19,21 @@ type client struct {
 	mutex sync.Mutex
 
 	conn connection
+
+	// packetConnMutex protects createdPacketConn and the packet handlers,
+	// which are changed when the session migrates to a new packet conn.
+	// It can't be c.mutex, since the session calls into the client while c.mutex is held.
+	packetConnMutex sync.Mutex
 	// If the client is created with DialAddr, we create a packet conn.
 	// If it is started with Dial, we take a packet conn as a parameter.
 	createdPacketConn bool
 
+	// the packet conn that the session is currently using
+	packetConn     net.PacketConn
 	packetHandlers packetHandlerManager
+	// the packet conn (and its packet handlers) the session is migrating to
+	migrationPacketConn     net.PacketConn
+	migrationPacketHandlers packetHandlerManager
 
 	token []byte
 
@@ -70,21 +80,35 @@ func DialAddr(
 
 // DialAddrContext establishes a new QUIC connection to a server using the provided context.
 // The hostname for SNI is taken from the given address.
+// If the hostname resolves to multiple IP addresses, connection attempts are raced
+// as described in RFC 8305 (Happy Eyeballs), and the first session to complete the handshake is returned.
 func DialAddrContext(
 	ctx context.Context,
 	addr string,
 	tlsConf *tls.Config,
 	config *Config,
 ) (Session, error) {
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	udpAddrs, err := resolveUDPAddrs(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
-	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
-	if err != nil {
-		return nil, err
+	if len(udpAddrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", addr)
+	}
+	if tlsConf == nil {
+		tlsConf = &tls.Config{}
 	}
-	return dialContext(ctx, udpConn, udpAddr, addr, tlsConf, config, true)
+	// Set the SNI before starting connection attempts, since they use copies of the tls.Config.
+	if tlsConf.ServerName == "" {
+		tlsConf.ServerName, _, err = net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(udpAddrs) == 1 {
+		return dialUDPAddr(ctx, udpAddrs[0], addr, tlsConf, config)
+	}
+	return dialHappyEyeballs(ctx, sortAddrsForHappyEyeballs(udpAddrs), addr, tlsConf, config)
 }
 
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
@@ -122,12 +146,10 @@ func dialContext(
 	createdPacketConn bool,
 ) (Session, error) {
 	config = populateClientConfig(config, createdPacketConn)
-	packetHandlers, err := getMultiplexer().AddConn(pconn, config.ConnectionIDLength)
-	if err != nil {
-		return nil, err
-	}
+	packetHandlers := getMultiplexer().AddConn(pconn)
 	c, err := newClient(pconn, remoteAddr, config, tlsConf, host, createdPacketConn)
 	if err != nil {
+		getMultiplexer().RemoveConn(pconn)
 		return nil, err
 	}
 	c.packetHandlers = packetHandlers
@@ -163,10 +185,17 @@ func newClient(
 				return nil, fmt.Errorf("%s is not a valid QUIC version", v)
 			}
 		}
+		if err := handshake.ValidateAdditionalTransportParameters(config.AdditionalTransportParameters, config.Versions); err != nil {
+			return nil, err
+		}
+		if psk := config.ExternalPSK; psk != nil && (len(psk.Identity) == 0 || len(psk.Key) == 0) {
+			return nil, errors.New("the external PSK config requires an identity and a key")
+		}
 	}
 	c := &client{
 		conn:              &conn{pconn: pconn, currentAddr: remoteAddr},
 		createdPacketConn: createdPacketConn,
+		packetConn:        pconn,
 		tlsConf:           tlsConf,
 		config:            config,
 		version:           config.Versions[0],
@@ -204,6 +233,10 @@ func populateClientConfig(config *Config, createdPacketConn bool) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindow
 	}
+	streamSendBufferSize := config.StreamSendBufferSize
+	if streamSendBufferSize == 0 {
+		streamSendBufferSize = protocol.DefaultStreamSendBufferSize
+	}
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -228,9 +261,14 @@ func populateClientConfig(config *Config, createdPacketConn bool) *Config {
 		ConnectionIDLength:                    connIDLen,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		StreamSendBufferSize:                  streamSendBufferSize,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
 		KeepAlive:                             config.KeepAlive,
+		AdditionalTransportParameters:         config.AdditionalTransportParameters,
+		EnableReliableStreamReset:             config.EnableReliableStreamReset,
+		OnBlocked:                             config.OnBlocked,
+		ExternalPSK:                           config.ExternalPSK,
 	}
 }
 
@@ -252,6 +290,7 @@ func (c *client) dial(ctx context.Context) error {
 	c.logger.Infof("Starting new connection to %s (%s -> %s), source connection ID %s, destination connection ID %s, version %s", c.tlsConf.ServerName, c.conn.LocalAddr(), c.conn.RemoteAddr(), c.srcConnID, c.destConnID, c.version)
 
 	if err := c.createNewTLSSession(c.version); err != nil {
+		c.releasePacketConn()
 		return err
 	}
 	err := c.establishSecureConnection(ctx)
@@ -272,15 +311,17 @@ func (c *client) establishSecureConnection(ctx context.Context) error {
 
 	go func() {
 		err := c.session.run() // returns as soon as the session is closed
-		if err != errCloseSessionForRetry && err != errCloseSessionForNewVersion && c.createdPacketConn {
-			c.conn.Close()
+		if err != errCloseSessionForRetry && err != errCloseSessionForNewVersion {
+			if c.releasePacketConn() {
+				c.conn.Close()
+			}
 		}
 		errorChan <- err
 	}()
 
 	select {
 	case <-ctx.Done():
-		// The session will send a PeerGoingAway error to the server.
+		// The session will send a CONNECTION_CLOSE with NO_ERROR to the server.
 		c.session.Close()
 		return ctx.Err()
 	case err := <-errorChan:
@@ -350,7 +391,7 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 	c.logger.Infof("Received a Version Negotiation Packet. Supported Versions: %s", hdr.SupportedVersions)
 	newVersion, ok := protocol.ChooseSupportedVersion(c.config.Versions, hdr.SupportedVersions)
 	if !ok {
-		return qerr.InvalidVersion
+		return &VersionNegotiationError{Ours: c.config.Versions, Theirs: hdr.SupportedVersions}
 	}
 	c.receivedVersionNegotiationPacket = true
 	c.negotiatedVersions = hdr.SupportedVersions
@@ -370,7 +411,18 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 func (c *client) handleRetryPacket(hdr *wire.Header) {
 	c.logger.Debugf("<- Received Retry")
 	hdr.Log(c.logger)
-	if !hdr.OrigDestConnectionID.Equal(c.destConnID) {
+	if c.version == protocol.Version1 {
+		// In QUIC version 1, the Retry is authenticated by the integrity tag.
+		if len(hdr.Raw) < wire.RetryIntegrityTagLen {
+			c.logger.Debugf("Ignoring Retry, since it is too short.")
+			return
+		}
+		tagOffset := len(hdr.Raw) - wire.RetryIntegrityTagLen
+		if !bytes.Equal(handshake.GetRetryIntegrityTag(hdr.Raw[:tagOffset], c.destConnID), hdr.Raw[tagOffset:]) {
+			c.logger.Debugf("Ignoring spoofed Retry. Integrity Check failed.")
+			return
+		}
+	} else if !hdr.OrigDestConnectionID.Equal(c.destConnID) {
 		c.logger.Debugf("Ignoring spoofed Retry. Original Destination Connection ID: %s, expected: %s", hdr.OrigDestConnectionID, c.destConnID)
 		return
 	}
@@ -400,20 +452,33 @@ func (c *client) createNewTLSSession(version protocol.VersionNumber) error {
 		MaxBidiStreams:                 uint64(c.config.MaxIncomingStreams),
 		MaxUniStreams:                  uint64(c.config.MaxIncomingUniStreams),
 		DisableMigration:               true,
+		AdditionalParameters:           c.config.AdditionalTransportParameters,
+		ResetStreamAt:                  c.config.EnableReliableStreamReset,
 	}
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	origDestConnID := c.origDestConnID
+	if version == protocol.Version1 {
+		params.InitialSourceConnectionID = c.srcConnID
+		// In QUIC version 1, the server always sends the original_destination_connection_id.
+		if origDestConnID == nil {
+			origDestConnID = c.destConnID
+		}
+	}
 	runner := &runner{
 		onHandshakeCompleteImpl: func(_ Session) { close(c.handshakeChan) },
-		retireConnectionIDImpl:  c.packetHandlers.Retire,
-		removeConnectionIDImpl:  c.packetHandlers.Remove,
+		addConnectionIDImpl:     func(id protocol.ConnectionID, _ quicSession) { c.getPacketHandlers().Add(id, c) },
+		retireConnectionIDImpl:  func(id protocol.ConnectionID) { c.getPacketHandlers().Retire(id) },
+		removeConnectionIDImpl:  func(id protocol.ConnectionID) { c.getPacketHandlers().Remove(id) },
+		addPacketConnImpl:       c.addPacketConn,
+		removePacketConnImpl:    c.removePacketConn,
 	}
 	sess, err := newClientSession(
 		c.conn,
 		runner,
 		c.token,
-		c.origDestConnID,
+		origDestConnID,
 		c.destConnID,
 		c.srcConnID,
 		c.config,
@@ -431,13 +496,73 @@ func (c *client) createNewTLSSession(version protocol.VersionNumber) error {
 	return nil
 }
 
+func (c *client) getPacketHandlers() packetHandlerManager {
+	c.packetConnMutex.Lock()
+	defer c.packetConnMutex.Unlock()
+	return c.packetHandlers
+}
+
+// releasePacketConn removes the packet conn that the session is using from the multiplexer.
+// It must be called once the session is closed.
+// It returns if the packet conn was created by DialAddr, and therefore needs to be closed.
+func (c *client) releasePacketConn() bool {
+	c.packetConnMutex.Lock()
+	pconn := c.packetConn
+	createdPacketConn := c.createdPacketConn
+	c.packetConnMutex.Unlock()
+	getMultiplexer().RemoveConn(pconn)
+	return createdPacketConn
+}
+
+// addPacketConn starts receiving packets on the packet conn that the session is migrating to.
+func (c *client) addPacketConn(pconn net.PacketConn) error {
+	packetHandlers := getMultiplexer().AddConn(pconn)
+	c.packetConnMutex.Lock()
+	c.migrationPacketConn = pconn
+	c.migrationPacketHandlers = packetHandlers
+	c.packetConnMutex.Unlock()
+	packetHandlers.Add(c.srcConnID, c)
+	return nil
+}
+
+// removePacketConn stops receiving packets on a packet conn.
+// If the migration failed, it is called with the packet conn that the session tried to migrate to.
+// If the migration succeeded, it is called with the old packet conn.
+// The old packet conn is closed if it was created by DialAddr.
+func (c *client) removePacketConn(pconn net.PacketConn) {
+	c.packetConnMutex.Lock()
+	var closePacketConn bool
+	if pconn == c.migrationPacketConn {
+		c.migrationPacketHandlers.Remove(c.srcConnID)
+	} else {
+		c.packetHandlers.Remove(c.srcConnID)
+		c.packetConn = c.migrationPacketConn
+		c.packetHandlers = c.migrationPacketHandlers
+		closePacketConn = c.createdPacketConn
+		// the new packet conn was passed to Session.Migrate, so it's not ours to close
+		c.createdPacketConn = false
+	}
+	c.migrationPacketConn = nil
+	c.migrationPacketHandlers = nil
+	c.packetConnMutex.Unlock()
+
+	getMultiplexer().RemoveConn(pconn)
+	if closePacketConn {
+		pconn.Close()
+	}
+}
+
 func (c *client) Close() error {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	if c.session == nil {
+	sess := c.session
+	c.mutex.Unlock()
+	if sess == nil {
 		return nil
 	}
-	return c.session.Close()
+	// Closing the session blocks until the session has stopped running.
+	// Don't hold the mutex, since the session might need to wait for
+	// packets to be passed to the client when removing a packet conn.
+	return sess.Close()
 }
 
 func (c *client) destroy(e error) {
@@ -13,7 +13,6 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 
@@ -107,21 +106,35 @@ var _ = Describe("Client", func() {
 	Context("Dialing", func() {
 		var origGenerateConnectionID func(int) (protocol.ConnectionID, error)
 		var origGenerateConnectionIDForInitial func() (protocol.ConnectionID, error)
+		var origResolveUDPAddrs func(context.Context, string) ([]*net.UDPAddr, error)
+		var releasedConns chan net.PacketConn
 
 		BeforeEach(func() {
 			origGenerateConnectionID = generateConnectionID
 			origGenerateConnectionIDForInitial = generateConnectionIDForInitial
+			origResolveUDPAddrs = resolveUDPAddrs
+			// localhost might resolve to both 127.0.0.1 and ::1
+			resolveUDPAddrs = func(_ context.Context, addr string) ([]*net.UDPAddr, error) {
+				udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+				if err != nil {
+					return nil, err
+				}
+				return []*net.UDPAddr{udpAddr}, nil
+			}
 			generateConnectionID = func(int) (protocol.ConnectionID, error) {
 				return connID, nil
 			}
 			generateConnectionIDForInitial = func() (protocol.ConnectionID, error) {
 				return connID, nil
 			}
+			releasedConns = make(chan net.PacketConn, 10)
+			mockMultiplexer.EXPECT().RemoveConn(gomock.Any()).Do(func(c net.PacketConn) { releasedConns <- c }).AnyTimes()
 		})
 
 		AfterEach(func() {
 			generateConnectionID = origGenerateConnectionID
 			generateConnectionIDForInitial = origGenerateConnectionIDForInitial
+			resolveUDPAddrs = origResolveUDPAddrs
 		})
 
 		It("resolves the address", func() {
@@ -131,7 +144,7 @@ var _ = Describe("Client", func() {
 
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(gomock.Any()).Return(manager)
 
 			remoteAddrChan := make(chan string, 1)
 			newClientSession = func(
@@ -161,7 +174,7 @@ var _ = Describe("Client", func() {
 		It("uses the tls.Config.ServerName as the hostname, if present", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(gomock.Any()).Return(manager)
 
 			hostnameChan := make(chan string, 1)
 			newClientSession = func(
@@ -191,7 +204,7 @@ var _ = Describe("Client", func() {
 		It("returns after the handshake is complete", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
 			run := make(chan struct{})
 			newClientSession = func(
@@ -223,12 +236,13 @@ var _ = Describe("Client", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(s).ToNot(BeNil())
 			Eventually(run).Should(BeClosed())
+			Eventually(releasedConns).Should(Receive(Equal(packetConn)))
 		})
 
 		It("returns an error that occurs while waiting for the connection to become secure", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
 			testErr := errors.New("early handshake error")
 			newClientSession = func(
@@ -261,12 +275,16 @@ var _ = Describe("Client", func() {
 		})
 
 		It("closes the session when the context is canceled", func() {
+			// use a new multiplexer, so we can wait for the call to RemoveConn
+			mockMultiplexer = NewMockMultiplexer(mockCtrl)
+			connMuxer = mockMultiplexer
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
+			removed := make(chan struct{})
+			mockMultiplexer.EXPECT().RemoveConn(packetConn).Do(func(net.PacketConn) { close(removed) })
 
 			sessionRunning := make(chan struct{})
-			defer close(sessionRunning)
 			sess := NewMockQuicSession(mockCtrl)
 			sess.EXPECT().run().Do(func() {
 				<-sessionRunning
@@ -303,16 +321,22 @@ var _ = Describe("Client", func() {
 				close(dialed)
 			}()
 			Consistently(dialed).ShouldNot(BeClosed())
-			sess.EXPECT().Close()
+			sess.EXPECT().Close().Do(func() { close(sessionRunning) })
 			cancel()
 			Eventually(dialed).Should(BeClosed())
+			Eventually(removed).Should(BeClosed())
 		})
 
 		It("removes closed sessions from the multiplexer", func() {
+			// use a new multiplexer, so we can check the call to RemoveConn
+			mockMultiplexer = NewMockMultiplexer(mockCtrl)
+			connMuxer = mockMultiplexer
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(connID, gomock.Any())
 			manager.EXPECT().Retire(connID)
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
+			removed := make(chan struct{})
+			mockMultiplexer.EXPECT().RemoveConn(packetConn).Do(func(net.PacketConn) { close(removed) })
 
 			var runner sessionRunner
 			sess := NewMockQuicSession(mockCtrl)
@@ -346,6 +370,7 @@ var _ = Describe("Client", func() {
 				&Config{},
 			)
 			Expect(err).ToNot(HaveOccurred())
+			Eventually(removed).Should(BeClosed())
 		})
 
 		It("closes the connection when it was created by DialAddr", func() {
@@ -354,7 +379,7 @@ var _ = Describe("Client", func() {
 			}
 
 			manager := NewMockPacketHandlerManager(mockCtrl)
-			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(gomock.Any()).Return(manager)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
 
 			var conn connection
@@ -409,11 +434,16 @@ var _ = Describe("Client", func() {
 		Context("quic.Config", func() {
 			It("setups with the right values", func() {
 				config := &Config{
-					HandshakeTimeout:      1337 * time.Minute,
-					IdleTimeout:           42 * time.Hour,
-					MaxIncomingStreams:    1234,
-					MaxIncomingUniStreams: 4321,
-					ConnectionIDLength:    13,
+					HandshakeTimeout:              1337 * time.Minute,
+					IdleTimeout:                   42 * time.Hour,
+					MaxIncomingStreams:            1234,
+					MaxIncomingUniStreams:         4321,
+					ConnectionIDLength:            13,
+					StreamSendBufferSize:          1 << 10,
+					AdditionalTransportParameters: []TransportParameter{{ID: 0x1337, Value: []byte("foobar")}},
+					EnableReliableStreamReset:     true,
+					OnBlocked:                     func(Session, BlockedEvent) {},
+					ExternalPSK:                   &PSKConfig{Identity: []byte("device"), Key: []byte("key")},
 				}
 				c := populateClientConfig(config, false)
 				Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -421,17 +451,40 @@ var _ = Describe("Client", func() {
 				Expect(c.MaxIncomingStreams).To(Equal(1234))
 				Expect(c.MaxIncomingUniStreams).To(Equal(4321))
 				Expect(c.ConnectionIDLength).To(Equal(13))
+				Expect(c.StreamSendBufferSize).To(BeEquivalentTo(1 << 10))
+				Expect(c.AdditionalTransportParameters).To(Equal([]TransportParameter{{ID: 0x1337, Value: []byte("foobar")}}))
+				Expect(c.EnableReliableStreamReset).To(BeTrue())
+				Expect(c.OnBlocked).ToNot(BeNil())
+				Expect(c.ExternalPSK).To(Equal(&PSKConfig{Identity: []byte("device"), Key: []byte("key")}))
 			})
 
 			It("errors when the Config contains an invalid version", func() {
 				manager := NewMockPacketHandlerManager(mockCtrl)
-				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+				mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
 				version := protocol.VersionNumber(0x1234)
 				_, err := Dial(packetConn, nil, "localhost:1234", &tls.Config{}, &Config{Versions: []protocol.VersionNumber{version}})
 				Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 			})
 
+			It("errors when the Config contains additional transport parameters that collide with standard parameters", func() {
+				manager := NewMockPacketHandlerManager(mockCtrl)
+				mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
+
+				config := &Config{AdditionalTransportParameters: []TransportParameter{{ID: 0x1}}}
+				_, err := Dial(packetConn, nil, "localhost:1234", &tls.Config{}, config)
+				Expect(err).To(MatchError("transport parameter 0x1 collides with a standard transport parameter"))
+			})
+
+			It("errors when the external PSK config doesn't contain a key", func() {
+				manager := NewMockPacketHandlerManager(mockCtrl)
+				mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
+
+				config := &Config{ExternalPSK: &PSKConfig{Identity: []byte("device")}}
+				_, err := Dial(packetConn, nil, "localhost:1234", &tls.Config{}, config)
+				Expect(err).To(MatchError("the external PSK config requires an identity and a key"))
+			})
+
 			It("disables bidirectional streams", func() {
 				config := &Config{
 					MaxIncomingStreams:    -1,
@@ -463,19 +516,25 @@ var _ = Describe("Client", func() {
 				Expect(c.Versions).To(Equal(protocol.SupportedVersions))
 				Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 				Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+				Expect(c.StreamSendBufferSize).To(BeEquivalentTo(protocol.DefaultStreamSendBufferSize))
 			})
 		})
 
 		It("creates new TLS sessions with the right parameters", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(connID, gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
-			config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
+			config := &Config{
+				Versions:                      []protocol.VersionNumber{protocol.VersionTLS},
+				AdditionalTransportParameters: []TransportParameter{{ID: 0x1337, Value: []byte("foobar")}},
+				EnableReliableStreamReset:     true,
+			}
 			c := make(chan struct{})
 			var cconn connection
 			var version protocol.VersionNumber
 			var conf *Config
+			var transportParams *handshake.TransportParameters
 			newClientSession = func(
 				connP connection,
 				_ sessionRunner,
@@ -493,6 +552,7 @@ var _ = Describe("Client", func() {
 				cconn = connP
 				version = versionP
 				conf = configP
+				transportParams = params
 				close(c)
 				// TODO: check connection IDs?
 				sess := NewMockQuicSession(mockCtrl)
@@ -505,6 +565,8 @@ var _ = Describe("Client", func() {
 			Expect(cconn.(*conn).pconn).To(Equal(packetConn))
 			Expect(version).To(Equal(config.Versions[0]))
 			Expect(conf.Versions).To(Equal(config.Versions))
+			Expect(transportParams.AdditionalParameters).To(Equal(config.AdditionalTransportParameters))
+			Expect(transportParams.ResetStreamAt).To(BeTrue())
 		})
 
 		It("creates a new session when the server performs a retry", func() {
@@ -521,7 +583,7 @@ var _ = Describe("Client", func() {
 				})
 			})
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
 			config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
 			cl.config = config
@@ -583,7 +645,7 @@ var _ = Describe("Client", func() {
 				})
 			}).AnyTimes()
 			manager.EXPECT().Add(gomock.Any(), gomock.Any()).AnyTimes()
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
 			config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
 			cl.config = config
@@ -627,6 +689,46 @@ var _ = Describe("Client", func() {
 			Expect(sessions).To(BeEmpty())
 		})
 
+		Context("handling Retry packets, in QUIC version 1", func() {
+			getRetry := func(origDestConnID protocol.ConnectionID) *wire.Header {
+				hdr := &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeRetry,
+					Token:            []byte("foobar"),
+					SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+					DestConnectionID: connID,
+					Version:          protocol.Version1,
+				}
+				b := &bytes.Buffer{}
+				Expect(hdr.Write(b, protocol.PerspectiveServer, protocol.Version1)).To(Succeed())
+				b.Write(handshake.GetRetryIntegrityTag(b.Bytes(), origDestConnID))
+				hdr.Raw = b.Bytes()
+				return hdr
+			}
+
+			BeforeEach(func() {
+				cl.version = protocol.Version1
+				cl.destConnID = protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			})
+
+			It("accepts a Retry with a valid integrity tag", func() {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().destroy(errCloseSessionForRetry)
+				cl.session = sess
+				cl.handleRetryPacket(getRetry(cl.destConnID))
+				Expect(cl.origDestConnID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+				Expect(cl.destConnID).To(Equal(protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}))
+				Expect(cl.token).To(Equal([]byte("foobar")))
+			})
+
+			It("ignores a Retry with an invalid integrity tag", func() {
+				cl.session = NewMockQuicSession(mockCtrl) // don't EXPECT any calls
+				cl.handleRetryPacket(getRetry(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}))
+				Expect(cl.destConnID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+				Expect(cl.token).To(BeEmpty())
+			})
+		})
+
 		Context("version negotiation", func() {
 			var origSupportedVersions []protocol.VersionNumber
 
@@ -642,7 +744,7 @@ var _ = Describe("Client", func() {
 			It("returns an error that occurs during version negotiation", func() {
 				manager := NewMockPacketHandlerManager(mockCtrl)
 				manager.EXPECT().Add(connID, gomock.Any())
-				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any()).Return(manager, nil)
+				mockMultiplexer.EXPECT().AddConn(packetConn).Return(manager)
 
 				testErr := errors.New("early handshake error")
 				newClientSession = func(
@@ -692,15 +794,20 @@ var _ = Describe("Client", func() {
 
 			It("errors if no matching version is found", func() {
 				sess := NewMockQuicSession(mockCtrl)
-				sess.EXPECT().destroy(qerr.InvalidVersion)
+				sess.EXPECT().destroy(&VersionNegotiationError{
+					Ours:   protocol.SupportedVersions,
+					Theirs: []protocol.VersionNumber{0x42},
+				})
 				cl.session = sess
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				cl.handlePacket(composeVersionNegotiationPacket(connID, []protocol.VersionNumber{1}))
+				cl.handlePacket(composeVersionNegotiationPacket(connID, []protocol.VersionNumber{0x42}))
 			})
 
 			It("errors if the version is supported by quic-go, but disabled by the quic.Config", func() {
 				sess := NewMockQuicSession(mockCtrl)
-				sess.EXPECT().destroy(qerr.InvalidVersion)
+				sess.EXPECT().destroy(gomock.Any()).Do(func(err error) {
+					Expect(err).To(BeAssignableToTypeOf(&VersionNegotiationError{}))
+				})
 				cl.session = sess
 				v := protocol.VersionNumber(1234)
 				Expect(v).ToNot(Equal(cl.version))
@@ -751,4 +858,52 @@ var _ = Describe("Client", func() {
 		})
 		Expect(err).To(MatchError(fmt.Sprintf("received a packet with an unexpected connection ID (0x0807060504030201, expected %s)", connID)))
 	})
+
+	Context("migrating", func() {
+		var (
+			oldManager, newManager *MockPacketHandlerManager
+			newPacketConn          *mockPacketConn
+		)
+
+		BeforeEach(func() {
+			cl.config = &Config{ConnectionIDLength: 4}
+			oldManager = NewMockPacketHandlerManager(mockCtrl)
+			newManager = NewMockPacketHandlerManager(mockCtrl)
+			cl.packetConn = packetConn
+			cl.packetHandlers = oldManager
+			newPacketConn = newMockPacketConn()
+			mockMultiplexer.EXPECT().AddConn(newPacketConn).Return(newManager)
+			newManager.EXPECT().Add(connID, cl)
+			Expect(cl.addPacketConn(newPacketConn)).To(Succeed())
+		})
+
+		It("releases the old packet conn after migrating", func() {
+			oldManager.EXPECT().Remove(connID)
+			mockMultiplexer.EXPECT().RemoveConn(packetConn)
+			cl.removePacketConn(packetConn)
+			Expect(cl.getPacketHandlers()).To(Equal(newManager))
+			Expect(cl.packetConn).To(Equal(newPacketConn))
+			Expect(packetConn.closed).To(BeFalse())
+		})
+
+		It("closes the old packet conn, if it was created by DialAddr", func() {
+			cl.createdPacketConn = true
+			oldManager.EXPECT().Remove(connID)
+			mockMultiplexer.EXPECT().RemoveConn(packetConn)
+			cl.removePacketConn(packetConn)
+			Expect(packetConn.closed).To(BeTrue())
+			Expect(cl.createdPacketConn).To(BeFalse())
+		})
+
+		It("releases the new packet conn if the migration fails", func() {
+			cl.createdPacketConn = true
+			newManager.EXPECT().Remove(connID)
+			mockMultiplexer.EXPECT().RemoveConn(newPacketConn)
+			cl.removePacketConn(newPacketConn)
+			Expect(cl.getPacketHandlers()).To(Equal(oldManager))
+			Expect(cl.packetConn).To(Equal(packetConn))
+			Expect(newPacketConn.closed).To(BeFalse())
+			Expect(packetConn.closed).To(BeFalse())
+		})
+	})
 })
@@ -7,11 +7,17 @@ import (
 
 type connection interface {
 	Write([]byte) error
+	// WriteTo writes to a remote address other than the current one.
+	// It is used to probe new paths.
+	WriteTo([]byte, net.Addr) error
 	Read([]byte) (int, net.Addr, error)
 	Close() error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	SetCurrentRemoteAddr(net.Addr)
+	// SetPacketConn replaces the underlying packet conn.
+	// It returns the packet conn that was used before.
+	SetPacketConn(net.PacketConn) net.PacketConn
 }
 
 type conn struct {
@@ -24,12 +30,21 @@ type conn struct {
 var _ connection = &conn{}
 
 func (c *conn) Write(p []byte) error {
-	_, err := c.pconn.WriteTo(p, c.currentAddr)
+	c.mutex.RLock()
+	pconn := c.pconn
+	addr := c.currentAddr
+	c.mutex.RUnlock()
+	_, err := pconn.WriteTo(p, addr)
+	return err
+}
+
+func (c *conn) WriteTo(p []byte, addr net.Addr) error {
+	_, err := c.getPacketConn().WriteTo(p, addr)
 	return err
 }
 
 func (c *conn) Read(p []byte) (int, net.Addr, error) {
-	return c.pconn.ReadFrom(p)
+	return c.getPacketConn().ReadFrom(p)
 }
 
 func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
@@ -38,8 +53,22 @@ func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
 	c.mutex.Unlock()
 }
 
+func (c *conn) SetPacketConn(pconn net.PacketConn) net.PacketConn {
+	c.mutex.Lock()
+	old := c.pconn
+	c.pconn = pconn
+	c.mutex.Unlock()
+	return old
+}
+
+func (c *conn) getPacketConn() net.PacketConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.pconn
+}
+
 func (c *conn) LocalAddr() net.Addr {
-	return c.pconn.LocalAddr()
+	return c.getPacketConn().LocalAddr()
 }
 
 func (c *conn) RemoteAddr() net.Addr {
@@ -50,5 +79,5 @@ func (c *conn) RemoteAddr() net.Addr {
 }
 
 func (c *conn) Close() error {
-	return c.pconn.Close()
+	return c.getPacketConn().Close()
 }
@@ -0,0 +1,19 @@
+package quic
+
+import "github.com/lucas-clemente/quic-go/internal/protocol"
+
+// The randomConnectionIDGenerator generates random connection IDs of a fixed length.
+// It is used by the server if no Config.ConnectionIDGenerator is set.
+type randomConnectionIDGenerator struct {
+	connIDLen int
+}
+
+var _ ConnectionIDGenerator = &randomConnectionIDGenerator{}
+
+func (g *randomConnectionIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	return protocol.GenerateConnectionID(g.connIDLen)
+}
+
+func (g *randomConnectionIDGenerator) ConnectionIDLen() int {
+	return g.connIDLen
+}
@@ -0,0 +1,19 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Random Connection ID Generator", func() {
+	It("generates random connection IDs of the configured length", func() {
+		g := &randomConnectionIDGenerator{connIDLen: 7}
+		Expect(g.ConnectionIDLen()).To(Equal(7))
+		c1, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1).To(HaveLen(7))
+		c2, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c2).ToNot(Equal(c1))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"net"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -18,11 +19,22 @@ type mockPacketConn struct {
 	dataWritten   bytes.Buffer
 	dataWrittenTo net.Addr
 	closed        bool
+
+	deadlineMutex sync.Mutex
+	// closed when the read deadline is in the past
+	deadlinePassed chan struct{}
 }
 
+type mockTimeoutError struct{}
+
+func (mockTimeoutError) Error() string   { return "i/o timeout" }
+func (mockTimeoutError) Temporary() bool { return true }
+func (mockTimeoutError) Timeout() bool   { return true }
+
 func newMockPacketConn() *mockPacketConn {
 	return &mockPacketConn{
-		dataToRead: make(chan []byte, 1000),
+		dataToRead:     make(chan []byte, 1000),
+		deadlinePassed: make(chan struct{}),
 	}
 }
 
@@ -30,12 +42,19 @@ func (c *mockPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	if c.readErr != nil {
 		return 0, nil, c.readErr
 	}
-	data, ok := <-c.dataToRead
-	if !ok {
-		return 0, nil, errors.New("connection closed")
+	c.deadlineMutex.Lock()
+	deadlinePassed := c.deadlinePassed
+	c.deadlineMutex.Unlock()
+	select {
+	case data, ok := <-c.dataToRead:
+		if !ok {
+			return 0, nil, errors.New("connection closed")
+		}
+		n := copy(b, data)
+		return n, c.dataReadFrom, nil
+	case <-deadlinePassed:
+		return 0, nil, mockTimeoutError{}
 	}
-	n := copy(b, data)
-	return n, c.dataReadFrom, nil
 }
 func (c *mockPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
 	c.dataWrittenTo = addr
@@ -48,9 +67,23 @@ func (c *mockPacketConn) Close() error {
 	c.closed = true
 	return nil
 }
-func (c *mockPacketConn) LocalAddr() net.Addr                { return c.addr }
-func (c *mockPacketConn) SetDeadline(t time.Time) error      { panic("not implemented") }
-func (c *mockPacketConn) SetReadDeadline(t time.Time) error  { panic("not implemented") }
+func (c *mockPacketConn) LocalAddr() net.Addr           { return c.addr }
+func (c *mockPacketConn) SetDeadline(t time.Time) error { panic("not implemented") }
+func (c *mockPacketConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMutex.Lock()
+	defer c.deadlineMutex.Unlock()
+	select {
+	case <-c.deadlinePassed:
+		if t.IsZero() || t.After(time.Now()) {
+			c.deadlinePassed = make(chan struct{})
+		}
+	default:
+		if !t.IsZero() && !t.After(time.Now()) {
+			close(c.deadlinePassed)
+		}
+	}
+	return nil
+}
 func (c *mockPacketConn) SetWriteDeadline(t time.Time) error { panic("not implemented") }
 
 var _ net.PacketConn = &mockPacketConn{}
@@ -78,6 +111,14 @@ var _ = Describe("Connection", func() {
 		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
 	})
 
+	It("writes to a different address", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(192, 168, 100, 201), Port: 1338}
+		Expect(c.WriteTo([]byte("foobar"), addr)).To(Succeed())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.201:1338"))
+		Expect(c.RemoteAddr().String()).To(Equal("192.168.100.200:1337"))
+	})
+
 	It("reads", func() {
 		packetConn.dataToRead <- []byte("foo")
 		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
@@ -111,6 +152,16 @@ var _ = Describe("Connection", func() {
 		Expect(c.RemoteAddr().String()).To(Equal(addr.String()))
 	})
 
+	It("replaces the packet conn", func() {
+		newPacketConn := newMockPacketConn()
+		newPacketConn.addr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 4321}
+		Expect(c.SetPacketConn(newPacketConn)).To(Equal(packetConn))
+		Expect(c.LocalAddr()).To(Equal(newPacketConn.addr))
+		Expect(c.Write([]byte("foobar"))).To(Succeed())
+		Expect(packetConn.dataWritten.Len()).To(BeZero())
+		Expect(newPacketConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+	})
+
 	It("closes", func() {
 		err := c.Close()
 		Expect(err).ToNot(HaveOccurred())
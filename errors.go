@@ -0,0 +1,159 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+)
+
+// A TransportErrorCode is an error code defined by the QUIC transport.
+type TransportErrorCode = qerr.ErrorCode
+
+// The transport error codes defined by QUIC.
+const (
+	NoError                   TransportErrorCode = qerr.NoError
+	InternalError             TransportErrorCode = qerr.InternalError
+	ConnectionRefused         TransportErrorCode = qerr.ConnectionRefused
+	FlowControlError          TransportErrorCode = qerr.FlowControlError
+	StreamLimitError          TransportErrorCode = qerr.StreamLimitError
+	StreamStateError          TransportErrorCode = qerr.StreamStateError
+	FinalSizeError            TransportErrorCode = qerr.FinalSizeError
+	FrameEncodingError        TransportErrorCode = qerr.FrameEncodingError
+	TransportParameterError   TransportErrorCode = qerr.TransportParameterError
+	ConnectionIDLimitError    TransportErrorCode = qerr.ConnectionIDLimitError
+	ProtocolViolation         TransportErrorCode = qerr.ProtocolViolation
+	InvalidToken              TransportErrorCode = qerr.InvalidToken
+	ApplicationErrorErrorCode TransportErrorCode = qerr.ApplicationError
+	CryptoBufferExceeded      TransportErrorCode = qerr.CryptoBufferExceeded
+	KeyUpdateError            TransportErrorCode = qerr.KeyUpdateError
+	AEADLimitReached          TransportErrorCode = qerr.AEADLimitReached
+	NoViablePathError         TransportErrorCode = qerr.NoViablePathError
+)
+
+// A TransportError is returned when the connection was closed with a transport error code,
+// either by us or by the peer.
+type TransportError struct {
+	// Remote is true if the peer closed the connection.
+	Remote bool
+	// FrameType is the type of the frame that triggered the error.
+	// It is only set for errors received from the peer, and might be 0 if the peer didn't know the frame type.
+	FrameType    uint64
+	ErrorCode    TransportErrorCode
+	ErrorMessage string
+}
+
+var _ error = &TransportError{}
+
+func (e *TransportError) Error() string {
+	str := e.ErrorCode.String()
+	if e.Remote {
+		str += " (remote)"
+	}
+	if len(e.ErrorMessage) == 0 {
+		return str
+	}
+	return fmt.Sprintf("%s: %s", str, e.ErrorMessage)
+}
+
+// An ApplicationError is returned when the connection was closed by the application,
+// using Session.Close or Session.CloseWithError, either on our side or by the peer.
+type ApplicationError struct {
+	// Remote is true if the peer closed the connection.
+	Remote       bool
+	ErrorCode    ErrorCode
+	ErrorMessage string
+}
+
+var _ error = &ApplicationError{}
+
+func (e *ApplicationError) Error() string {
+	str := fmt.Sprintf("Application error %#x", uint64(e.ErrorCode))
+	if e.Remote {
+		str += " (remote)"
+	}
+	if len(e.ErrorMessage) == 0 {
+		return str
+	}
+	return fmt.Sprintf("%s: %s", str, e.ErrorMessage)
+}
+
+// An IdleTimeoutError is returned when the connection was closed because there was no network activity.
+type IdleTimeoutError struct{}
+
+var _ error = &IdleTimeoutError{}
+
+func (e *IdleTimeoutError) Error() string { return "timeout: no recent network activity" }
+
+// Timeout is true. It implements the net.Error interface.
+func (e *IdleTimeoutError) Timeout() bool { return true }
+
+// Temporary is false. It implements the net.Error interface.
+func (e *IdleTimeoutError) Temporary() bool { return false }
+
+// A HandshakeTimeoutError is returned when the handshake didn't complete within the handshake timeout.
+type HandshakeTimeoutError struct{}
+
+var _ error = &HandshakeTimeoutError{}
+
+func (e *HandshakeTimeoutError) Error() string { return "timeout: handshake did not complete in time" }
+
+// Timeout is true. It implements the net.Error interface.
+func (e *HandshakeTimeoutError) Timeout() bool { return true }
+
+// Temporary is false. It implements the net.Error interface.
+func (e *HandshakeTimeoutError) Temporary() bool { return false }
+
+// A StatelessResetError is returned when the peer sent a stateless reset.
+type StatelessResetError struct {
+	Token [16]byte
+}
+
+var _ error = &StatelessResetError{}
+
+func (e *StatelessResetError) Error() string {
+	return fmt.Sprintf("received a stateless reset with token %x", e.Token)
+}
+
+// A VersionNegotiationError is returned by Dial when there's no QUIC version that both endpoints support.
+type VersionNegotiationError struct {
+	// Ours are the versions we offered.
+	Ours []VersionNumber
+	// Theirs are the versions the server supports.
+	Theirs []VersionNumber
+}
+
+var _ error = &VersionNegotiationError{}
+
+func (e *VersionNegotiationError) Error() string {
+	return fmt.Sprintf("no compatible QUIC version found (we support %s, server offered %s)", e.Ours, e.Theirs)
+}
+
+// toPublicError converts an error that caused us to close the session into the error reported to the application.
+func toPublicError(err error) error {
+	switch e := err.(type) {
+	case nil:
+		return &ApplicationError{}
+	case *TransportError, *ApplicationError, *IdleTimeoutError, *HandshakeTimeoutError:
+		return e
+	case *qerr.QuicError:
+		if e.Timeout() {
+			return &IdleTimeoutError{}
+		}
+		return &TransportError{ErrorCode: e.ErrorCode, ErrorMessage: e.ErrorMessage}
+	case qerr.ErrorCode:
+		return &TransportError{ErrorCode: e}
+	default:
+		return &TransportError{ErrorCode: qerr.InternalError, ErrorMessage: e.Error()}
+	}
+}
+
+// isNormalClose says if the session was closed without an error
+func isNormalClose(err error) bool {
+	switch e := err.(type) {
+	case *ApplicationError:
+		return e.ErrorCode == 0
+	case *TransportError:
+		return e.ErrorCode == qerr.NoError
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package quic
+
+import (
+	"errors"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	Context("error messages", func() {
+		It("has a string representation for transport errors", func() {
+			Expect((&TransportError{ErrorCode: FlowControlError}).Error()).To(Equal("FLOW_CONTROL_ERROR"))
+			Expect((&TransportError{
+				Remote:       true,
+				ErrorCode:    FlowControlError,
+				ErrorMessage: "foobar",
+			}).Error()).To(Equal("FLOW_CONTROL_ERROR (remote): foobar"))
+		})
+
+		It("has a string representation for application errors", func() {
+			Expect((&ApplicationError{ErrorCode: 0x42}).Error()).To(Equal("Application error 0x42"))
+			Expect((&ApplicationError{
+				Remote:       true,
+				ErrorCode:    0x42,
+				ErrorMessage: "foobar",
+			}).Error()).To(Equal("Application error 0x42 (remote): foobar"))
+		})
+
+		It("has a string representation for stateless resets", func() {
+			token := [16]byte{0xde, 0xad, 0xbe, 0xef}
+			Expect((&StatelessResetError{Token: token}).Error()).To(ContainSubstring("deadbeef"))
+		})
+
+		It("has a string representation for version negotiation errors", func() {
+			err := &VersionNegotiationError{
+				Ours:   []VersionNumber{0x1},
+				Theirs: []VersionNumber{0x42},
+			}
+			Expect(err.Error()).To(ContainSubstring("no compatible QUIC version found"))
+		})
+	})
+
+	It("says that timeout errors are timeouts", func() {
+		for _, err := range []net.Error{&IdleTimeoutError{}, &HandshakeTimeoutError{}} {
+			Expect(err.Timeout()).To(BeTrue())
+			Expect(err.Temporary()).To(BeFalse())
+		}
+	})
+
+	Context("converting to public errors", func() {
+		It("converts nil to an application error with code 0", func() {
+			Expect(toPublicError(nil)).To(Equal(&ApplicationError{}))
+		})
+
+		It("passes through public errors", func() {
+			for _, err := range []error{
+				&TransportError{ErrorCode: FlowControlError},
+				&ApplicationError{ErrorCode: 0x1337},
+				&IdleTimeoutError{},
+				&HandshakeTimeoutError{},
+			} {
+				Expect(toPublicError(err)).To(BeIdenticalTo(err))
+			}
+		})
+
+		It("converts QuicErrors", func() {
+			Expect(toPublicError(qerr.Error(qerr.StreamStateError, "foobar"))).To(Equal(&TransportError{
+				ErrorCode:    StreamStateError,
+				ErrorMessage: "foobar",
+			}))
+			Expect(toPublicError(qerr.TimeoutError("foobar"))).To(Equal(&IdleTimeoutError{}))
+		})
+
+		It("converts error codes", func() {
+			Expect(toPublicError(qerr.ProtocolViolation)).To(Equal(&TransportError{ErrorCode: ProtocolViolation}))
+		})
+
+		It("converts other errors to internal errors", func() {
+			Expect(toPublicError(errors.New("foobar"))).To(Equal(&TransportError{
+				ErrorCode:    InternalError,
+				ErrorMessage: "foobar",
+			}))
+		})
+	})
+
+	It("recognizes normal closes", func() {
+		Expect(isNormalClose(&ApplicationError{})).To(BeTrue())
+		Expect(isNormalClose(&ApplicationError{Remote: true})).To(BeTrue())
+		Expect(isNormalClose(&TransportError{ErrorCode: NoError})).To(BeTrue())
+		Expect(isNormalClose(&ApplicationError{ErrorCode: 1})).To(BeFalse())
+		Expect(isNormalClose(&TransportError{ErrorCode: InternalError})).To(BeFalse())
+		Expect(isNormalClose(&IdleTimeoutError{})).To(BeFalse())
+	})
+})
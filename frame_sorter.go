@@ -12,15 +12,20 @@ type frameSorter struct {
 	readPos     protocol.ByteCount
 	finalOffset protocol.ByteCount
 	gaps        *utils.ByteIntervalList
+
+	// data at and beyond truncateOffset is discarded, see Truncate
+	truncateOffset protocol.ByteCount
+	unordered      bool // set once PopAny is called
 }
 
 var errDuplicateStreamData = errors.New("Duplicate Stream Data")
 
 func newFrameSorter() *frameSorter {
 	s := frameSorter{
-		gaps:        utils.NewByteIntervalList(),
-		queue:       make(map[protocol.ByteCount][]byte),
-		finalOffset: protocol.MaxByteCount,
+		gaps:           utils.NewByteIntervalList(),
+		queue:          make(map[protocol.ByteCount][]byte),
+		finalOffset:    protocol.MaxByteCount,
+		truncateOffset: protocol.MaxByteCount,
 	}
 	s.gaps.PushFront(utils.ByteInterval{Start: 0, End: protocol.MaxByteCount})
 	return &s
@@ -35,6 +40,15 @@ func (s *frameSorter) Push(data []byte, offset protocol.ByteCount, fin bool) err
 }
 
 func (s *frameSorter) push(data []byte, offset protocol.ByteCount, fin bool) error {
+	var wasCut bool
+	if offset+protocol.ByteCount(len(data)) > s.truncateOffset {
+		if offset >= s.truncateOffset {
+			return errDuplicateStreamData
+		}
+		data = data[:s.truncateOffset-offset]
+		fin = false
+		wasCut = true
+	}
 	if fin {
 		s.finalOffset = offset + protocol.ByteCount(len(data))
 	}
@@ -42,7 +56,6 @@ func (s *frameSorter) push(data []byte, offset protocol.ByteCount, fin bool) err
 		return nil
 	}
 
-	var wasCut bool
 	if oldData, ok := s.queue[offset]; ok {
 		if len(data) <= len(oldData) {
 			return errDuplicateStreamData
@@ -79,6 +92,24 @@ func (s *frameSorter) push(data []byte, offset protocol.ByteCount, fin bool) err
 		wasCut = true
 	}
 
+	// Once data was popped out of order, a frame spanning multiple gaps can't replace the queued frames in between,
+	// since (some of) that data might already have been returned.
+	// Only insert the parts of the frame that fill the gaps.
+	if s.unordered && end > gap.Value.End {
+		nextGap := gap.Next()
+		if nextGap == nil {
+			return errors.New("StreamFrameSorter BUG: no next gap found")
+		}
+		gapEnd := gap.Value.End
+		if err := s.pushCopy(data[:gapEnd-start], start); err != nil {
+			return err
+		}
+		if end <= nextGap.Value.Start {
+			return nil
+		}
+		return s.pushCopy(data[nextGap.Value.Start-start:], nextGap.Value.Start)
+	}
+
 	// find the highest gaps whose Start lies before the end of the frame
 	endGap := gap
 	for end >= endGap.Value.End {
@@ -147,6 +178,16 @@ func (s *frameSorter) push(data []byte, offset protocol.ByteCount, fin bool) err
 	return nil
 }
 
+// pushCopy pushes a copy of data, ignoring duplicate data.
+func (s *frameSorter) pushCopy(data []byte, offset protocol.ByteCount) error {
+	newData := make([]byte, len(data))
+	copy(newData, data)
+	if err := s.push(newData, offset, false); err != nil && err != errDuplicateStreamData {
+		return err
+	}
+	return nil
+}
+
 func (s *frameSorter) Pop() ([]byte /* data */, bool /* fin */) {
 	data, ok := s.queue[s.readPos]
 	if !ok {
@@ -157,6 +198,53 @@ func (s *frameSorter) Pop() ([]byte /* data */, bool /* fin */) {
 	return data, s.readPos >= s.finalOffset
 }
 
+// PopAny pops the queued data with the lowest offset, no matter if there's a gap before it.
+// fin is true when all data up to the final offset has been popped.
+// Once PopAny has been called, Pop must not be used any more.
+func (s *frameSorter) PopAny() (protocol.ByteCount /* offset */, []byte /* data */, bool /* fin */) {
+	s.unordered = true
+	if len(s.queue) == 0 {
+		return 0, nil, s.receivedAllData()
+	}
+	offset := protocol.MaxByteCount
+	for o := range s.queue {
+		if o < offset {
+			offset = o
+		}
+	}
+	data := s.queue[offset]
+	delete(s.queue, offset)
+	if offset == s.readPos {
+		s.readPos += protocol.ByteCount(len(data))
+	}
+	return offset, data, len(s.queue) == 0 && s.receivedAllData()
+}
+
+// receivedAllData says if all data up to the final offset has been received.
+func (s *frameSorter) receivedAllData() bool {
+	gap := s.gaps.Front()
+	return gap == nil || gap.Value.Start >= s.finalOffset
+}
+
+// Truncate discards all data at and beyond offset, and makes offset the end of the stream.
+// It is used when a stream is reset, but the data up to offset has to be delivered reliably.
+func (s *frameSorter) Truncate(offset protocol.ByteCount) {
+	if offset >= s.truncateOffset {
+		return
+	}
+	s.truncateOffset = offset
+	if offset < s.finalOffset {
+		s.finalOffset = offset
+	}
+	for o, data := range s.queue {
+		if o >= offset {
+			delete(s.queue, o)
+		} else if o+protocol.ByteCount(len(data)) > offset {
+			s.queue[o] = data[:offset-o]
+		}
+	}
+}
+
 // HasMoreData says if there is any more data queued at *any* offset.
 func (s *frameSorter) HasMoreData() bool {
 	return len(s.queue) > 0
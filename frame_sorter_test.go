@@ -441,4 +441,95 @@ var _ = Describe("STREAM frame sorter", func() {
 			})
 		})
 	})
+
+	Context("popping out of order", func() {
+		It("pops data with the lowest offset", func() {
+			Expect(s.Push([]byte("bar"), 6, false)).To(Succeed())
+			Expect(s.Push([]byte("foo"), 3, false)).To(Succeed())
+			offset, data, fin := s.PopAny()
+			Expect(offset).To(Equal(protocol.ByteCount(3)))
+			Expect(data).To(Equal([]byte("foo")))
+			Expect(fin).To(BeFalse())
+			offset, data, fin = s.PopAny()
+			Expect(offset).To(Equal(protocol.ByteCount(6)))
+			Expect(data).To(Equal([]byte("bar")))
+			Expect(fin).To(BeFalse())
+			_, data, _ = s.PopAny()
+			Expect(data).To(BeNil())
+		})
+
+		It("says when all data up to the final offset was popped", func() {
+			Expect(s.Push([]byte("bar"), 3, true)).To(Succeed())
+			_, _, fin := s.PopAny()
+			Expect(fin).To(BeFalse())
+			Expect(s.Push([]byte("foo"), 0, false)).To(Succeed())
+			offset, data, fin := s.PopAny()
+			Expect(offset).To(BeZero())
+			Expect(data).To(Equal([]byte("foo")))
+			Expect(fin).To(BeTrue())
+		})
+
+		It("only inserts the parts of a frame that fill gaps", func() {
+			Expect(s.Push([]byte("cd"), 2, false)).To(Succeed())
+			Expect(s.Push([]byte("gh"), 6, false)).To(Succeed())
+			_, data, _ := s.PopAny()
+			Expect(data).To(Equal([]byte("cd")))
+			Expect(s.Push([]byte("abcdefghij"), 0, false)).To(Succeed())
+			checkGaps([]utils.ByteInterval{{Start: 10, End: protocol.MaxByteCount}})
+			var popped []string
+			for {
+				_, data, _ := s.PopAny()
+				if data == nil {
+					break
+				}
+				popped = append(popped, string(data))
+			}
+			Expect(popped).To(Equal([]string{"ab", "ef", "gh", "ij"}))
+		})
+	})
+
+	Context("truncating", func() {
+		It("discards data beyond the offset", func() {
+			Expect(s.Push([]byte("foobar"), 0, false)).To(Succeed())
+			Expect(s.Push([]byte("baz"), 10, false)).To(Succeed())
+			s.Truncate(4)
+			data, fin := s.Pop()
+			Expect(data).To(Equal([]byte("foob")))
+			Expect(fin).To(BeTrue())
+			Expect(s.HasMoreData()).To(BeFalse())
+		})
+
+		It("cuts data received after truncating", func() {
+			s.Truncate(4)
+			Expect(s.Push([]byte("foobar"), 0, true)).To(Succeed())
+			Expect(s.Push([]byte("baz"), 10, false)).To(Succeed())
+			data, fin := s.Pop()
+			Expect(data).To(Equal([]byte("foob")))
+			Expect(fin).To(BeTrue())
+			Expect(s.HasMoreData()).To(BeFalse())
+		})
+
+		It("doesn't increase the offset", func() {
+			s.Truncate(4)
+			s.Truncate(6)
+			Expect(s.Push([]byte("foobar"), 0, false)).To(Succeed())
+			data, fin := s.Pop()
+			Expect(data).To(Equal([]byte("foob")))
+			Expect(fin).To(BeTrue())
+		})
+
+		It("says when all data was popped out of order", func() {
+			Expect(s.Push([]byte("bar"), 3, false)).To(Succeed())
+			s.Truncate(5)
+			offset, data, fin := s.PopAny()
+			Expect(offset).To(Equal(protocol.ByteCount(3)))
+			Expect(data).To(Equal([]byte("ba")))
+			Expect(fin).To(BeFalse())
+			Expect(s.Push([]byte("foo"), 0, false)).To(Succeed())
+			offset, data, fin = s.PopAny()
+			Expect(offset).To(BeZero())
+			Expect(data).To(Equal([]byte("foo")))
+			Expect(fin).To(BeTrue())
+		})
+	})
 })
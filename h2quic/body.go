@@ -0,0 +1,158 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// The body of a request or a response.
+// It returns the payload of the DATA frames received on the stream.
+type body struct {
+	str quic.ReceiveStream
+	// Called for PUSH_PROMISE frames. It has to read the encoded field section from the stream.
+	// If nil, PUSH_PROMISE frames are not allowed on the stream.
+	onPushPromise func(*pushPromiseFrame) error
+
+	bytesRemainingInFrame uint64
+}
+
+func newBody(str quic.ReceiveStream) *body {
+	return &body{str: str}
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	for b.bytesRemainingInFrame == 0 {
+		frame, err := parseNextFrame(b.str)
+		if err != nil {
+			return 0, err
+		}
+		switch f := frame.(type) {
+		case *dataFrame:
+			b.bytesRemainingInFrame = f.Length
+		case *headersFrame:
+			// TODO: add support for trailers
+			if _, err := io.CopyN(ioutil.Discard, b.str, int64(f.Length)); err != nil {
+				return 0, err
+			}
+		case *pushPromiseFrame:
+			if b.onPushPromise == nil {
+				b.str.CancelRead(quic.ErrorCode(errorFrameUnexpected))
+				return 0, errors.New("unexpected frame on request stream")
+			}
+			if err := b.onPushPromise(f); err != nil {
+				return 0, err
+			}
+		default:
+			b.str.CancelRead(quic.ErrorCode(errorFrameUnexpected))
+			return 0, errors.New("unexpected frame on request stream")
+		}
+	}
+	if uint64(len(p)) > b.bytesRemainingInFrame {
+		p = p[:b.bytesRemainingInFrame]
+	}
+	n, err := b.str.Read(p)
+	b.bytesRemainingInFrame -= uint64(n)
+	if err == io.EOF && b.bytesRemainingInFrame > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+type requestBody struct {
+	*body
+	stream      quic.Stream
+	requestRead bool
+}
+
+// make sure the requestBody can be used as a http.Request.Body
+var _ io.ReadCloser = &requestBody{}
+
+func newRequestBody(str quic.Stream) *requestBody {
+	return &requestBody{body: newBody(str), stream: str}
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	b.requestRead = true
+	n, err := b.body.Read(p)
+	if serr, ok := err.(quic.StreamError); ok && serr.Canceled() {
+		// The client reset the request stream.
+		// Abort the response. This cancels the context of the request.
+		b.stream.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+	}
+	return n, err
+}
+
+func (b *requestBody) Close() error {
+	// stream's Close() closes the write side, not the read side
+	return nil
+}
+
+type responseBody struct {
+	*body
+	ctx context.Context // the context of the request
+
+	doneOnce sync.Once
+	done     chan struct{} // closed when the body was read completely, or when it was closed
+}
+
+// make sure the responseBody can be used as a http.Response.Body
+var _ io.ReadCloser = &responseBody{}
+
+func newResponseBody(ctx context.Context, str quic.ReceiveStream, onPushPromise func(*pushPromiseFrame) error) *responseBody {
+	b := newBody(str)
+	b.onPushPromise = onPushPromise
+	return &responseBody{
+		body: b,
+		ctx:  ctx,
+		done: make(chan struct{}),
+	}
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err != nil {
+		b.setDone()
+		if err != io.EOF {
+			// If the request was canceled, the stream was reset, and reading returns the (local) stream error.
+			if ctxErr := b.ctx.Err(); ctxErr != nil {
+				return n, ctxErr
+			}
+			err = streamError(b.str.StreamID(), err)
+		}
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.setDone()
+	// If the whole body was read, this is a no-op.
+	b.str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+	return nil
+}
+
+func (b *responseBody) setDone() {
+	b.doneOnce.Do(func() { close(b.done) })
+}
+
+// A dataFrameWriter writes the data passed to Write in DATA frames.
+type dataFrameWriter struct {
+	w io.Writer
+}
+
+func (w *dataFrameWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	buf := &bytes.Buffer{}
+	(&dataFrame{Length: uint64(len(p))}).Write(buf)
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
@@ -0,0 +1,188 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Body", func() {
+	var (
+		str *mockStream
+		rb  *requestBody
+	)
+
+	writeDataFrame := func(data []byte) {
+		(&dataFrame{Length: uint64(len(data))}).Write(&str.dataToRead)
+		str.dataToRead.Write(data)
+	}
+
+	BeforeEach(func() {
+		str = newMockStream(0)
+		close(str.unblockRead)
+		rb = newRequestBody(str)
+	})
+
+	It("reads DATA frames in a single run", func() {
+		writeDataFrame([]byte("foobar"))
+		b := make([]byte, 6)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(6))
+		Expect(b).To(Equal([]byte("foobar")))
+	})
+
+	It("reads DATA frames in multiple runs", func() {
+		writeDataFrame([]byte("foobar"))
+		b := make([]byte, 3)
+		n, err := rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(b).To(Equal([]byte("foo")))
+		n, err = rb.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(b).To(Equal([]byte("bar")))
+	})
+
+	It("reads multiple DATA frames", func() {
+		writeDataFrame([]byte("foo"))
+		writeDataFrame([]byte("bar"))
+		data, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("skips empty DATA frames and unknown frames", func() {
+		writeDataFrame(nil)
+		utils.WriteVarInt(&str.dataToRead, 0x21) // a reserved frame type
+		utils.WriteVarInt(&str.dataToRead, 3)
+		str.dataToRead.Write([]byte("baz"))
+		writeDataFrame([]byte("foobar"))
+		data, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("skips trailers", func() {
+		writeDataFrame([]byte("foobar"))
+		Expect(writeHeadersFrame(&str.dataToRead, qpack.NewEncoder(nil, 0), 0, []qpack.HeaderField{{Name: "foo", Value: "bar"}})).To(Succeed())
+		data, err := ioutil.ReadAll(rb)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("errors if the stream ends in the middle of a DATA frame", func() {
+		(&dataFrame{Length: 10}).Write(&str.dataToRead)
+		str.dataToRead.Write([]byte("foobar"))
+		_, err := ioutil.ReadAll(rb)
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	It("errors on unexpected frames", func() {
+		(&settingsFrame{}).Write(&str.dataToRead)
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError("unexpected frame on request stream"))
+		Expect(str.reset).To(BeTrue())
+		Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+	})
+
+	It("errors on PUSH_PROMISE frames in request bodies", func() {
+		(&pushPromiseFrame{PushID: 1}).Write(&str.dataToRead)
+		_, err := rb.Read(make([]byte, 10))
+		Expect(err).To(MatchError("unexpected frame on request stream"))
+		Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+	})
+
+	It("saves if the stream was read from", func() {
+		writeDataFrame([]byte("foobar"))
+		Expect(rb.requestRead).To(BeFalse())
+		rb.Read(make([]byte, 1))
+		Expect(rb.requestRead).To(BeTrue())
+	})
+
+	It("doesn't close the stream when closing the request body", func() {
+		Expect(str.closed).To(BeFalse())
+		err := rb.Close()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.closed).To(BeFalse())
+		Expect(str.reset).To(BeFalse())
+	})
+
+	It("stops reading the stream when closing the response body", func() {
+		err := newResponseBody(context.Background(), str, nil).Close()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.reset).To(BeTrue())
+		Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+	})
+
+	It("aborts the response when the client resets the request stream", func() {
+		writeDataFrame([]byte("foo"))
+		str.readErr = &mockStreamError{code: quic.ErrorCode(errorRequestCanceled)}
+		_, err := ioutil.ReadAll(rb)
+		Expect(err).To(MatchError(str.readErr))
+		Expect(str.isCanceledWrite()).To(BeTrue())
+		Expect(str.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+		Expect(str.Context().Done()).To(BeClosed())
+	})
+
+	Context("response bodies", func() {
+		It("returns a StreamResetError when the server resets the stream", func() {
+			str.id = 4
+			writeDataFrame([]byte("foo"))
+			str.readErr = &mockStreamError{code: quic.ErrorCode(errorInternalError)}
+			body := newResponseBody(context.Background(), str, nil)
+			data, err := ioutil.ReadAll(body)
+			Expect(data).To(Equal([]byte("foo")))
+			Expect(err).To(Equal(&StreamResetError{StreamID: 4, ErrorCode: quic.ErrorCode(errorInternalError)}))
+			Expect(body.done).To(BeClosed())
+		})
+
+		It("returns the context error if the request was canceled", func() {
+			str.readErr = errors.New("read canceled")
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := ioutil.ReadAll(newResponseBody(ctx, str, nil))
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("is done when the body was read completely", func() {
+			writeDataFrame([]byte("foobar"))
+			body := newResponseBody(context.Background(), str, nil)
+			Expect(ioutil.ReadAll(body)).To(Equal([]byte("foobar")))
+			Expect(body.done).To(BeClosed())
+		})
+
+		It("is done when the body is closed", func() {
+			body := newResponseBody(context.Background(), str, nil)
+			Expect(body.done).ToNot(BeClosed())
+			Expect(body.Close()).To(Succeed())
+			Expect(body.done).To(BeClosed())
+			Expect(body.Close()).To(Succeed())
+		})
+	})
+
+	It("writes DATA frames", func() {
+		buf := &bytes.Buffer{}
+		w := &dataFrameWriter{w: buf}
+		n, err := w.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		n, err = w.Write(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeZero())
+		n, err = w.Write([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		Expect(buf.Bytes()).To(Equal([]byte{0x0, 0x3, 'f', 'o', 'o', 0x0, 0x3, 'b', 'a', 'r'}))
+	})
+})
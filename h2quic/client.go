@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -10,26 +11,29 @@ import (
 	"strings"
 	"sync"
 
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
 	"golang.org/x/net/idna"
 
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
 )
 
+// the maximum size of the response headers, the same default value as used by net/http.Transport
+const maxResponseHeaderBytes = 10 << 20
+
+var errGoAway = errors.New("h2quic: the server sent a GOAWAY frame")
+
 type roundTripperOpts struct {
 	DisableCompression bool
+	AcceptPush         func(promised, associated *http.Request) bool
+	HandlePush         func(*http.Response)
 }
 
 var dialAddr = quic.DialAddr
 
-// client is a HTTP2 client doing QUIC requests
+// client is a HTTP/3 client doing requests over a single QUIC connection
 type client struct {
-	mutex sync.RWMutex
-
 	tlsConf *tls.Config
 	config  *quic.Config
 	opts    *roundTripperOpts
@@ -40,12 +44,22 @@ type client struct {
 	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
 	session       quic.Session
-	headerStream  quic.Stream
-	headerErr     *qerr.QuicError
-	headerErrored chan struct{} // this channel is closed if an error occurs on the header stream
 	requestWriter *requestWriter
-
-	responses map[protocol.StreamID]chan *http.Response
+	// We don't use the dynamic table, so QPACK never writes anything to the encoder and decoder streams.
+	decoder *qpack.Decoder
+
+	controlStreamMutex sync.Mutex
+	controlStream      quic.SendStream
+
+	mutex     sync.Mutex
+	goingAway bool
+	maxPushID uint64           // the push ID sent in the last MAX_PUSH_ID frame
+	pushes    map[uint64]*push // pushes that are not finished yet, by push ID
+	pushCache map[string]*push // accepted pushes, by method and URL. Only used if opts.HandlePush is nil.
+	// All pushes with a lower push ID are finished.
+	lowestPushID uint64
+	// finished pushes with a push ID of at least lowestPushID, and if their push stream was received
+	finishedPushes map[uint64]bool
 
 	logger utils.Logger
 }
@@ -66,15 +80,25 @@ func newClient(
 	if quicConfig != nil {
 		config = quicConfig
 	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	tlsConfig.NextProtos = []string{NextProtoH3}
+	logger := utils.DefaultLogger.WithPrefix("client")
 	return &client{
-		hostname:      authorityAddr("https", hostname),
-		responses:     make(map[protocol.StreamID]chan *http.Response),
-		tlsConf:       tlsConfig,
-		config:        config,
-		opts:          opts,
-		headerErrored: make(chan struct{}),
-		dialer:        dialer,
-		logger:        utils.DefaultLogger.WithPrefix("client"),
+		hostname:       authorityAddr("https", hostname),
+		tlsConf:        tlsConfig,
+		config:         config,
+		opts:           opts,
+		dialer:         dialer,
+		requestWriter:  newRequestWriter(qpack.NewEncoder(nil, 0), logger),
+		decoder:        qpack.NewDecoder(0, 0, nil),
+		pushes:         make(map[uint64]*push),
+		pushCache:      make(map[string]*push),
+		finishedPushes: make(map[uint64]bool),
+		logger:         logger,
 	}
 }
 
@@ -90,67 +114,68 @@ func (c *client) dial() error {
 		return err
 	}
 
-	// once the version has been negotiated, open the header stream
-	c.headerStream, err = c.session.OpenStreamSync()
+	c.controlStream, err = openControlStream(c.session)
 	if err != nil {
+		c.closeWithError(errorClosedCriticalStream, err)
 		return err
 	}
-	c.requestWriter = newRequestWriter(c.headerStream, c.logger)
-	go c.handleHeaderStream()
+	var handlePushStream func(uint64, quic.ReceiveStream)
+	if c.pushEnabled() {
+		if err := c.enablePush(); err != nil {
+			c.closeWithError(errorClosedCriticalStream, err)
+			return err
+		}
+		handlePushStream = c.handlePushStream
+		if c.opts.HandlePush == nil {
+			go func() {
+				<-c.session.Context().Done()
+				c.discardCachedPushes()
+			}()
+		}
+	}
+	go handleUnidirectionalStreams(c.session, true, c.handleControlFrame, handlePushStream, c.logger)
 	return nil
 }
 
-func (c *client) handleHeaderStream() {
-	decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
-	h2framer := http2.NewFramer(nil, c.headerStream)
-
-	var err error
-	for err == nil {
-		err = c.readResponse(h2framer, decoder)
-	}
-	if quicErr, ok := err.(*qerr.QuicError); !ok || quicErr.ErrorCode != qerr.PeerGoingAway {
-		c.logger.Debugf("Error handling header stream: %s", err)
+func (c *client) handleControlFrame(f frame) error {
+	switch f := f.(type) {
+	case *goAwayFrame:
+		return c.handleGoAway(f)
+	case *cancelPushFrame:
+		if !c.pushEnabled() {
+			err := errors.New("received a CANCEL_PUSH frame without sending MAX_PUSH_ID")
+			c.closeWithError(errorIDError, err)
+			return err
+		}
+		return c.handleCancelPush(f)
+	case *maxPushIDFrame:
+		return errors.New("received a MAX_PUSH_ID frame")
 	}
-	c.headerErr = qerr.Error(qerr.InvalidHeadersStreamData, err.Error())
-	// stop all running request
-	close(c.headerErrored)
+	return nil
 }
 
-func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) error {
-	frame, err := h2framer.ReadFrame()
-	if err != nil {
-		return err
-	}
-	hframe, ok := frame.(*http2.HeadersFrame)
-	if !ok {
-		return errors.New("not a headers frame")
-	}
-	mhframe := &http2.MetaHeadersFrame{HeadersFrame: hframe}
-	mhframe.Fields, err = decoder.DecodeFull(hframe.HeaderBlockFragment())
-	if err != nil {
-		return fmt.Errorf("cannot read header fields: %s", err.Error())
-	}
-
-	c.mutex.RLock()
-	responseChan, ok := c.responses[protocol.StreamID(hframe.StreamID)]
-	c.mutex.RUnlock()
-	if !ok {
-		return fmt.Errorf("response channel for stream %d not found", hframe.StreamID)
+func (c *client) handleGoAway(goAway *goAwayFrame) error {
+	if goAway.StreamID.Type() != protocol.StreamTypeBidi || goAway.StreamID.InitiatedBy() != protocol.PerspectiveClient {
+		return fmt.Errorf("GOAWAY frame contains an invalid stream ID: %d", goAway.StreamID)
 	}
-
-	rsp, err := responseFromHeaders(mhframe)
-	if err != nil {
-		return err
-	}
-	responseChan <- rsp
+	c.logger.Debugf("Received a GOAWAY frame for stream %d", goAway.StreamID)
+	c.mutex.Lock()
+	c.goingAway = true
+	c.mutex.Unlock()
 	return nil
 }
 
+func (c *client) isGoingAway() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.goingAway
+}
+
 // Roundtrip executes a request and returns a response
 func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	// TODO: add port to address, if it doesn't have one
 	if req.URL.Scheme != "https" {
-		return nil, errors.New("quic http2: unsupported scheme")
+		return nil, errors.New("quic http3: unsupported scheme")
 	}
 	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
 		return nil, fmt.Errorf("h2quic Client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
@@ -163,38 +188,49 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if c.handshakeErr != nil {
 		return nil, c.handshakeErr
 	}
+	if rsp, ok := c.getPushedResponse(req); ok {
+		return rsp, nil
+	}
+	if c.isGoingAway() {
+		return nil, errGoAway
+	}
 
-	hasBody := (req.Body != nil)
-
-	responseChan := make(chan *http.Response)
-	dataStream, err := c.session.OpenStreamSync()
+	str, err := c.session.OpenStreamSync(req.Context())
 	if err != nil {
-		_ = c.closeWithError(err)
 		return nil, err
 	}
-	c.mutex.Lock()
-	c.responses[dataStream.StreamID()] = responseChan
-	c.mutex.Unlock()
 
 	var requestedGzip bool
 	if !c.opts.DisableCompression && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != "HEAD" {
 		requestedGzip = true
 	}
-	// TODO: add support for trailers
-	endStream := !hasBody
-	err = c.requestWriter.WriteRequest(req, dataStream.StreamID(), endStream, requestedGzip)
-	if err != nil {
-		_ = c.closeWithError(err)
+	if err := c.requestWriter.WriteRequest(str, req, requestedGzip); err != nil {
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
 		return nil, err
 	}
 
+	hasBody := req.Body != nil
 	resc := make(chan error, 1)
 	if hasBody {
 		go func() {
-			resc <- c.writeRequestBody(dataStream, req.Body)
+			resc <- c.writeRequestBody(str, req.Body)
 		}()
+	} else {
+		str.Close()
 	}
 
+	type responseOrError struct {
+		rsp *http.Response
+		err error
+	}
+	onPushPromise := c.pushPromiseHandler(str, req)
+	rspc := make(chan responseOrError, 1)
+	go func() {
+		rsp, err := c.readResponse(req.Context(), str, onPushPromise)
+		rspc <- responseOrError{rsp: rsp, err: err}
+	}()
+
 	var res *http.Response
 
 	var receivedResponse bool
@@ -207,28 +243,21 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	ctx := req.Context()
 	for !(bodySent && receivedResponse) {
 		select {
-		case res = <-responseChan:
+		case r := <-rspc:
+			if r.err != nil {
+				return nil, streamError(str.StreamID(), r.err)
+			}
+			res = r.rsp
 			receivedResponse = true
-			c.mutex.Lock()
-			delete(c.responses, dataStream.StreamID())
-			c.mutex.Unlock()
 		case err := <-resc:
 			bodySent = true
 			if err != nil {
 				return nil, err
 			}
 		case <-ctx.Done():
-			// error code 6 signals that stream was canceled
-			dataStream.CancelRead(6)
-			dataStream.CancelWrite(6)
-			c.mutex.Lock()
-			delete(c.responses, dataStream.StreamID())
-			c.mutex.Unlock()
+			str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
 			return nil, ctx.Err()
-		case <-c.headerErrored:
-			// an error occurred on the header stream
-			_ = c.closeWithError(c.headerErr)
-			return nil, c.headerErr
 		}
 	}
 
@@ -241,7 +270,23 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if streamEnded || isHead {
 		res.Body = noBody
 	} else {
-		res.Body = dataStream
+		body := newResponseBody(ctx, str, onPushPromise)
+		if ctx.Done() != nil {
+			// Reset the stream if the request is canceled while the response body is being read.
+			go func() {
+				select {
+				case <-ctx.Done():
+					select {
+					case <-body.done: // the body was read completely (or closed) before the request was canceled
+					default:
+						str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+						str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+					}
+				case <-body.done:
+				}
+			}()
+		}
+		res.Body = body
 		if requestedGzip && res.Header.Get("Content-Encoding") == "gzip" {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
@@ -255,28 +300,78 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	return res, nil
 }
 
-func (c *client) writeRequestBody(dataStream quic.Stream, body io.ReadCloser) (err error) {
+// readResponse reads the response header.
+// PUSH_PROMISE frames preceding the HEADERS frame are passed to onPushPromise.
+// If onPushPromise is nil, PUSH_PROMISE frames are not allowed.
+func (c *client) readResponse(ctx context.Context, str quic.ReceiveStream, onPushPromise func(*pushPromiseFrame) error) (*http.Response, error) {
+	frame, err := parseNextFrame(str)
+	if err != nil {
+		return nil, err
+	}
+	for onPushPromise != nil {
+		pp, ok := frame.(*pushPromiseFrame)
+		if !ok {
+			break
+		}
+		if err := onPushPromise(pp); err != nil {
+			return nil, err
+		}
+		if frame, err = parseNextFrame(str); err != nil {
+			return nil, err
+		}
+	}
+	hf, ok := frame.(*headersFrame)
+	if !ok {
+		err := errors.New("expected first frame to be a HEADERS frame")
+		c.closeWithError(errorFrameUnexpected, err)
+		return nil, err
+	}
+	if hf.Length > maxResponseHeaderBytes {
+		str.CancelRead(quic.ErrorCode(errorFrameError))
+		return nil, fmt.Errorf("HEADERS frame too large: %d bytes (max: %d)", hf.Length, maxResponseHeaderBytes)
+	}
+	headerBlock := make([]byte, hf.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		return nil, err
+	}
+	fields, err := c.decoder.DecodeFieldSection(ctx, uint64(str.StreamID()), headerBlock)
+	if err != nil {
+		c.closeWithError(errorQPACKDecompressionFailed, err)
+		return nil, fmt.Errorf("cannot read header fields: %s", err.Error())
+	}
+	rsp, err := responseFromHeaders(fields)
+	if err != nil {
+		str.CancelRead(quic.ErrorCode(errorMessageError))
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func (c *client) writeRequestBody(str quic.Stream, body io.ReadCloser) (err error) {
 	defer func() {
 		cerr := body.Close()
 		if err == nil {
-			// TODO: what to do with dataStream here? Maybe reset it?
 			err = cerr
 		}
 	}()
 
-	_, err = io.Copy(dataStream, body)
-	if err != nil {
-		// TODO: what to do with dataStream here? Maybe reset it?
-		return err
+	if _, err = io.Copy(&dataFrameWriter{w: str}, body); err != nil {
+		if serr, ok := err.(quic.StreamError); ok && serr.Canceled() && errorCode(serr.ErrorCode()) == errorNoError {
+			// The server sent a STOP_SENDING frame with H3_NO_ERROR.
+			// It doesn't need the rest of the request body, but we still receive the response.
+			return nil
+		}
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		return streamError(str.StreamID(), err)
 	}
-	return dataStream.Close()
+	return str.Close()
 }
 
-func (c *client) closeWithError(e error) error {
+func (c *client) closeWithError(code errorCode, e error) error {
 	if c.session == nil {
 		return nil
 	}
-	return c.session.CloseWithError(quic.ErrorCode(qerr.InternalError), e)
+	return c.session.CloseWithError(quic.ErrorCode(code), e)
 }
 
 // Close closes the client
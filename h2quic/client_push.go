@@ -0,0 +1,470 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// the number of pushes the server is allowed to promise, in addition to the pushes that were already completed
+const maxConcurrentPushes = 100
+
+// the maximum number of pushed responses kept for subsequent requests.
+// Cached pushes count towards maxConcurrentPushes until they are used or evicted.
+const maxCachedPushes = maxConcurrentPushes / 2
+
+var errPushCanceled = errors.New("h2quic: push canceled")
+
+// A push is a response pushed by the server.
+// The PUSH_PROMISE frame and the push stream may arrive in any order.
+type push struct {
+	id       uint64
+	request  *http.Request      // the promised request, nil until the PUSH_PROMISE frame is received
+	str      quic.ReceiveStream // the push stream, nil until it is received
+	accepted bool
+
+	done chan struct{} // closed once the response was received, or the push was canceled
+	rsp  *http.Response
+	err  error
+
+	released bool // set once the server was allowed to promise another push in its place
+}
+
+func (p *push) isDone() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *client) pushEnabled() bool {
+	return c.opts.AcceptPush != nil
+}
+
+// enablePush sends the initial MAX_PUSH_ID frame.
+func (c *client) enablePush() error {
+	c.mutex.Lock()
+	c.maxPushID = maxConcurrentPushes - 1
+	c.mutex.Unlock()
+	return c.writeControlFrame(&maxPushIDFrame{PushID: maxConcurrentPushes - 1})
+}
+
+func (c *client) writeControlFrame(f interface{ Write(*bytes.Buffer) }) error {
+	buf := &bytes.Buffer{}
+	f.Write(buf)
+	c.controlStreamMutex.Lock()
+	defer c.controlStreamMutex.Unlock()
+	_, err := c.controlStream.Write(buf.Bytes())
+	return err
+}
+
+// getPush returns the push with the given push ID, creating it if necessary.
+// It returns nil if the push is already finished.
+// It must be called with the mutex held.
+func (c *client) getPush(pushID uint64) (*push, error) {
+	if pushID > c.maxPushID {
+		err := fmt.Errorf("push ID %d exceeds the maximum push ID (%d)", pushID, c.maxPushID)
+		c.closeWithError(errorIDError, err)
+		return nil, err
+	}
+	if c.isPushFinished(pushID) {
+		return nil, nil
+	}
+	p, ok := c.pushes[pushID]
+	if !ok {
+		p = &push{id: pushID, done: make(chan struct{})}
+		c.pushes[pushID] = p
+	}
+	return p, nil
+}
+
+// isPushFinished says if the push with the given push ID is finished.
+// It must be called with the mutex held.
+func (c *client) isPushFinished(pushID uint64) bool {
+	if pushID < c.lowestPushID {
+		return true
+	}
+	_, ok := c.finishedPushes[pushID]
+	return ok
+}
+
+// maybeFinishPush deletes a push once it was resolved, and the server was allowed to promise another push in its place.
+// Push IDs of finished pushes can't be reused.
+// It must be called with the mutex held.
+func (c *client) maybeFinishPush(p *push) {
+	if !p.isDone() || !p.released {
+		return
+	}
+	delete(c.pushes, p.id)
+	c.finishedPushes[p.id] = p.str != nil
+	for {
+		if _, ok := c.finishedPushes[c.lowestPushID]; !ok {
+			break
+		}
+		delete(c.finishedPushes, c.lowestPushID)
+		c.lowestPushID++
+	}
+}
+
+// pushPromiseHandler returns the callback for PUSH_PROMISE frames received on a request stream.
+// It returns nil if push is disabled.
+func (c *client) pushPromiseHandler(str quic.Stream, req *http.Request) func(*pushPromiseFrame) error {
+	if !c.pushEnabled() {
+		return nil
+	}
+	return func(f *pushPromiseFrame) error {
+		return c.handlePushPromise(str, req, f)
+	}
+}
+
+func (c *client) handlePushPromise(str quic.Stream, associated *http.Request, f *pushPromiseFrame) error {
+	if f.Length > maxResponseHeaderBytes {
+		str.CancelRead(quic.ErrorCode(errorFrameError))
+		return fmt.Errorf("PUSH_PROMISE frame too large: %d bytes (max: %d)", f.Length, maxResponseHeaderBytes)
+	}
+	headerBlock := make([]byte, f.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		return err
+	}
+	fields, err := c.decoder.DecodeFieldSection(str.Context(), uint64(str.StreamID()), headerBlock)
+	if err != nil {
+		c.closeWithError(errorQPACKDecompressionFailed, err)
+		return fmt.Errorf("cannot read header fields: %s", err.Error())
+	}
+	req, err := requestFromHeaders(fields)
+	if err != nil {
+		str.CancelRead(quic.ErrorCode(errorMessageError))
+		return err
+	}
+	req.URL.Scheme = "https"
+	req.URL.Host = req.Host
+
+	c.mutex.Lock()
+	p, err := c.getPush(f.PushID)
+	if err != nil {
+		c.mutex.Unlock()
+		return err
+	}
+	if p == nil {
+		// The same push can be promised on multiple request streams.
+		c.mutex.Unlock()
+		c.logger.Debugf("Ignoring PUSH_PROMISE for push %d, which is already finished", f.PushID)
+		return nil
+	}
+	if p.request != nil {
+		// The same push can be promised on multiple request streams.
+		c.mutex.Unlock()
+		if p.request.Method != req.Method || p.request.URL.String() != req.URL.String() {
+			err := fmt.Errorf("push %d promised with different requests", f.PushID)
+			c.closeWithError(errorGeneralProtocolError, err)
+			return err
+		}
+		return nil
+	}
+	p.request = req
+	canceled := p.isDone() // the server already sent a CANCEL_PUSH frame
+	c.mutex.Unlock()
+	if canceled {
+		return nil
+	}
+
+	// Only accept pushes for requests that are safe and cacheable, and for which the server is authoritative.
+	accept := (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		req.ContentLength == 0 &&
+		authorityAddr("https", req.Host) == c.hostname &&
+		c.opts.AcceptPush(req, associated)
+	if !accept {
+		c.logger.Debugf("Canceling push %d for %s", f.PushID, req.URL)
+		err := c.writeControlFrame(&cancelPushFrame{PushID: f.PushID})
+		c.resolvePush(p, nil, errPushCanceled)
+		return err
+	}
+
+	c.mutex.Lock()
+	if p.isDone() { // canceled by the server while we were deciding
+		c.mutex.Unlock()
+		return nil
+	}
+	p.accepted = true
+	var evicted *push
+	if c.opts.HandlePush == nil {
+		evicted = c.addToPushCache(p)
+	}
+	receive := p.str != nil
+	c.mutex.Unlock()
+	if evicted != nil {
+		c.logger.Debugf("Evicting push %d for %s from the push cache", evicted.id, evicted.request.URL)
+		c.discardPush(evicted)
+	}
+	if receive {
+		go c.receivePush(p)
+	}
+	return nil
+}
+
+// addToPushCache adds an accepted push to the push cache.
+// If the cache already contains a push for the same request, or if the cache is full,
+// it removes a push from the cache and returns it.
+// It must be called with the mutex held.
+func (c *client) addToPushCache(p *push) *push {
+	key := pushCacheKey(p.request)
+	evicted, ok := c.pushCache[key]
+	if !ok && len(c.pushCache) >= maxCachedPushes {
+		// evict the push that was promised first
+		for k, cached := range c.pushCache {
+			if evicted == nil || cached.id < evicted.id {
+				evicted = cached
+				key = k
+			}
+		}
+		delete(c.pushCache, key)
+	}
+	c.pushCache[pushCacheKey(p.request)] = p
+	return evicted
+}
+
+// discardPush discards an accepted push that was removed from the push cache, but won't be used.
+// If it is still being received, it is canceled.
+func (c *client) discardPush(p *push) {
+	c.mutex.Lock()
+	done := p.isDone()
+	str := p.str
+	c.mutex.Unlock()
+
+	if !done {
+		if err := c.writeControlFrame(&cancelPushFrame{PushID: p.id}); err != nil {
+			c.logger.Debugf("Sending CANCEL_PUSH failed: %s", err)
+		}
+		if str != nil {
+			str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		}
+		c.resolvePush(p, nil, errPushCanceled)
+	}
+	// The response might have been received in the meantime.
+	if p.rsp != nil {
+		p.rsp.Body.Close()
+	}
+	c.releasePush(p)
+}
+
+// discardCachedPushes discards all pushes in the push cache.
+// It is called when the session is closed.
+func (c *client) discardCachedPushes() {
+	c.mutex.Lock()
+	pushes := make([]*push, 0, len(c.pushCache))
+	for key, p := range c.pushCache {
+		pushes = append(pushes, p)
+		delete(c.pushCache, key)
+	}
+	c.mutex.Unlock()
+
+	for _, p := range pushes {
+		c.discardPush(p)
+	}
+}
+
+func (c *client) handlePushStream(pushID uint64, str quic.ReceiveStream) {
+	c.mutex.Lock()
+	p, err := c.getPush(pushID)
+	if err != nil {
+		c.mutex.Unlock()
+		return
+	}
+	if p == nil {
+		// The push stream of a canceled push might arrive after the push was finished.
+		// For push IDs below the low-water mark, we don't know if the push stream was already received.
+		receivedStream, ok := c.finishedPushes[pushID]
+		if receivedStream {
+			c.mutex.Unlock()
+			c.closeWithError(errorIDError, fmt.Errorf("received a second push stream for push %d", pushID))
+			return
+		}
+		if ok {
+			c.finishedPushes[pushID] = true
+		}
+		c.mutex.Unlock()
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		return
+	}
+	if p.str != nil {
+		c.mutex.Unlock()
+		c.closeWithError(errorIDError, fmt.Errorf("received a second push stream for push %d", pushID))
+		return
+	}
+	p.str = str
+	canceled := p.isDone()
+	receive := p.accepted
+	c.mutex.Unlock()
+
+	if canceled {
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		return
+	}
+	if receive {
+		c.receivePush(p)
+	}
+}
+
+// receivePush reads the pushed response.
+// It is called once both the PUSH_PROMISE frame and the push stream have been received.
+func (c *client) receivePush(p *push) {
+	rsp, err := c.readResponse(context.Background(), p.str, nil)
+	if err != nil {
+		p.str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		c.resolvePush(p, nil, err)
+		return
+	}
+	isHead := p.request.Method == http.MethodHead
+	rsp = setLength(rsp, isHead, false)
+	if isHead {
+		rsp.Body = noBody
+	} else {
+		rsp.Body = newResponseBody(context.Background(), p.str, nil)
+	}
+	rsp.Request = p.request
+	c.resolvePush(p, rsp, nil)
+	if c.opts.HandlePush != nil {
+		c.opts.HandlePush(rsp)
+	}
+}
+
+// resolvePush is called once the pushed response was received, or the push was canceled.
+// Unless the pushed response is kept in the push cache, the server is allowed to promise another push.
+func (c *client) resolvePush(p *push, rsp *http.Response, err error) {
+	c.mutex.Lock()
+	if p.isDone() {
+		c.mutex.Unlock()
+		return
+	}
+	p.rsp = rsp
+	p.err = err
+	close(p.done)
+	c.maybeFinishPush(p)
+	var cached bool
+	if p.request != nil {
+		key := pushCacheKey(p.request)
+		if c.pushCache[key] == p {
+			if err != nil {
+				delete(c.pushCache, key)
+			} else {
+				cached = true
+			}
+		}
+	}
+	c.mutex.Unlock()
+
+	// Cached pushes are released once they are used or evicted.
+	if !cached {
+		c.releasePush(p)
+	}
+}
+
+// releasePush allows the server to promise another push in place of this one.
+func (c *client) releasePush(p *push) {
+	c.mutex.Lock()
+	if p.released {
+		c.mutex.Unlock()
+		return
+	}
+	p.released = true
+	c.maybeFinishPush(p)
+	c.maxPushID++
+	maxPushID := c.maxPushID
+	c.mutex.Unlock()
+
+	if err := c.writeControlFrame(&maxPushIDFrame{PushID: maxPushID}); err != nil {
+		c.logger.Debugf("Sending MAX_PUSH_ID failed: %s", err)
+	}
+}
+
+func (c *client) handleCancelPush(f *cancelPushFrame) error {
+	c.mutex.Lock()
+	p, err := c.getPush(f.PushID)
+	if err != nil {
+		c.mutex.Unlock()
+		return nil // the session was already closed
+	}
+	if p == nil {
+		c.mutex.Unlock()
+		return nil
+	}
+	str := p.str
+	c.mutex.Unlock()
+
+	c.logger.Debugf("Server canceled push %d", f.PushID)
+	if str != nil {
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+	}
+	c.resolvePush(p, nil, errPushCanceled)
+	return nil
+}
+
+// getPushedResponse returns the pushed response for a request, if the server pushed one.
+// If the pushed response hasn't been received yet, it waits for it.
+func (c *client) getPushedResponse(req *http.Request) (*http.Response, bool) {
+	if !c.pushEnabled() || c.opts.HandlePush != nil {
+		return nil, false
+	}
+	key := pushCacheKey(req)
+	c.mutex.Lock()
+	p, ok := c.pushCache[key]
+	if ok {
+		delete(c.pushCache, key)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	c.releasePush(p)
+
+	select {
+	case <-p.done:
+	case <-req.Context().Done():
+		c.discardPush(p)
+		return nil, false
+	}
+	if p.err != nil {
+		return nil, false
+	}
+	if !pushMatchesRequest(p.request, p.rsp, req) {
+		c.logger.Debugf("Not using push %d for %s, since the request header fields differ", p.id, req.URL)
+		p.rsp.Body.Close()
+		return nil, false
+	}
+	rsp := p.rsp
+	rsp.Request = req
+	return rsp, true
+}
+
+func pushCacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// pushMatchesRequest says if a pushed response can be used for a request.
+// The header fields listed in the Vary header field of the response have to be the same
+// for the promised and for the actual request.
+func pushMatchesRequest(promised *http.Request, rsp *http.Response, req *http.Request) bool {
+	for _, vary := range rsp.Header["Vary"] {
+		for _, name := range strings.Split(vary, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return false
+			}
+			if strings.Join(promised.Header[name], ",") != strings.Join(req.Header[name], ",") {
+				return false
+			}
+		}
+	}
+	return true
+}
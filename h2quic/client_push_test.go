@@ -0,0 +1,498 @@
+package h2quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client push", func() {
+	var (
+		client       *client
+		session      *mockSession
+		req          *http.Request
+		opts         *roundTripperOpts
+		origDialAddr = dialAddr
+	)
+
+	BeforeEach(func() {
+		origDialAddr = dialAddr
+		session = newMockSession()
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+			return session, nil
+		}
+		opts = &roundTripperOpts{
+			AcceptPush: func(_, _ *http.Request) bool { return true },
+		}
+		client = newClient("quic.clemente.io:1337", nil, opts, nil, nil)
+		var err error
+		req, err = http.NewRequest("GET", "https://quic.clemente.io:1337/index.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		dialAddr = origDialAddr
+		session.Close()
+	})
+
+	// encodeResponse encodes a response in the same way the server does
+	encodeResponse := func(status int, body []byte) []byte {
+		str := newMockStream(0)
+		rw := newResponseWriter(str, qpack.NewEncoder(nil, 0), utils.DefaultLogger)
+		rw.WriteHeader(status)
+		if body != nil {
+			rw.Write(body)
+		}
+		return str.dataWritten.Bytes()
+	}
+
+	encodePushPromise := func(pushID uint64, method, authority, path string, headers ...qpack.HeaderField) []byte {
+		headerBlock, err := qpack.NewEncoder(nil, 0).EncodeFieldSection(0, append([]qpack.HeaderField{
+			{Name: ":method", Value: method},
+			{Name: ":scheme", Value: "https"},
+			{Name: ":authority", Value: authority},
+			{Name: ":path", Value: path},
+		}, headers...))
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		buf := &bytes.Buffer{}
+		(&pushPromiseFrame{PushID: pushID, Length: uint64(len(headerBlock))}).Write(buf)
+		buf.Write(headerBlock)
+		return buf.Bytes()
+	}
+
+	newStream := func(data ...[]byte) *mockStream {
+		str := newMockStream(0)
+		for _, d := range data {
+			str.dataToRead.Write(d)
+		}
+		close(str.unblockRead)
+		return str
+	}
+
+	newPushStream := func(pushID uint64, data []byte) *mockStream {
+		b := &bytes.Buffer{}
+		utils.WriteVarInt(b, streamTypePushStream)
+		utils.WriteVarInt(b, pushID)
+		return newStream(b.Bytes(), data)
+	}
+
+	// getControlFrames parses the frames sent on the control stream
+	getControlFrames := func() []frame {
+		r := bytes.NewReader(session.getOpenedUniStreams()[0].dataWritten.Bytes())
+		streamType, err := utils.ReadVarInt(r)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, streamType).To(BeEquivalentTo(streamTypeControlStream))
+		var frames []frame
+		for r.Len() > 0 {
+			f, err := parseNextFrame(r)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			frames = append(frames, f)
+		}
+		return frames
+	}
+
+	It("sends a MAX_PUSH_ID frame", func() {
+		session.streamsToOpen = []quic.Stream{newStream(encodeResponse(200, nil))}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getControlFrames()).To(Equal([]frame{
+			&settingsFrame{Settings: map[uint64]uint64{}},
+			&maxPushIDFrame{PushID: maxConcurrentPushes - 1},
+		}))
+	})
+
+	It("delivers pushed responses to the HandlePush callback", func() {
+		var associated, promised *http.Request
+		opts.AcceptPush = func(p, a *http.Request) bool {
+			promised = p
+			associated = a
+			return true
+		}
+		pushedRsps := make(chan *http.Response, 1)
+		opts.HandlePush = func(rsp *http.Response) { pushedRsps <- rsp }
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, []byte("index")),
+		)}
+		rsp, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("index")))
+		Expect(associated).To(Equal(req))
+		Expect(promised.URL.String()).To(Equal("https://quic.clemente.io:1337/style.css"))
+
+		session.uniStreamsToAccept <- newPushStream(0, encodeResponse(200, []byte("body{}")))
+		var pushedRsp *http.Response
+		Eventually(pushedRsps).Should(Receive(&pushedRsp))
+		Expect(pushedRsp.StatusCode).To(Equal(200))
+		Expect(pushedRsp.Request).To(Equal(promised))
+		Expect(ioutil.ReadAll(pushedRsp.Body)).To(Equal([]byte("body{}")))
+		// the push is completed, so the server is allowed to promise another push
+		Expect(getControlFrames()).To(ContainElement(&maxPushIDFrame{PushID: maxConcurrentPushes}))
+	})
+
+	It("handles push streams that arrive before the PUSH_PROMISE frame", func() {
+		pushedRsps := make(chan *http.Response, 1)
+		opts.HandlePush = func(rsp *http.Response) { pushedRsps <- rsp }
+		// dial, so that the client starts accepting push streams
+		session.streamsToOpen = []quic.Stream{newStream(encodeResponse(200, nil))}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		pushStr := newPushStream(3, encodeResponse(200, []byte("body{}")))
+		session.uniStreamsToAccept <- pushStr
+		Consistently(pushedRsps).ShouldNot(Receive())
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(3, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err = client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		var pushedRsp *http.Response
+		Eventually(pushedRsps).Should(Receive(&pushedRsp))
+		Expect(pushedRsp.Request.URL.Path).To(Equal("/style.css"))
+		Expect(ioutil.ReadAll(pushedRsp.Body)).To(Equal([]byte("body{}")))
+	})
+
+	It("handles PUSH_PROMISE frames in the response body", func() {
+		pushedRsps := make(chan *http.Response, 1)
+		opts.HandlePush = func(rsp *http.Response) { pushedRsps <- rsp }
+		data := &bytes.Buffer{}
+		(&dataFrame{Length: 5}).Write(data)
+		data.Write([]byte(".html"))
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodeResponse(200, []byte("index")),
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			data.Bytes(),
+		)}
+		rsp, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("index.html")))
+		session.uniStreamsToAccept <- newPushStream(0, encodeResponse(200, []byte("body{}")))
+		Eventually(pushedRsps).Should(Receive())
+	})
+
+	It("uses pushed responses for subsequent requests", func() {
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, []byte("index")),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		session.uniStreamsToAccept <- newPushStream(0, encodeResponse(200, []byte("body{}")))
+
+		pushedReq, err := http.NewRequest("GET", "https://quic.clemente.io:1337/style.css", nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := client.RoundTrip(pushedReq)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.Request).To(Equal(pushedReq))
+		Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("body{}")))
+
+		// the pushed response can only be used once
+		session.streamsToOpen = []quic.Stream{newStream(encodeResponse(200, []byte("from the network")))}
+		rsp, err = client.RoundTrip(pushedReq)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("from the network")))
+	})
+
+	It("deletes pushes once they are finished, and doesn't reuse their push IDs", func() {
+		var promised int
+		opts.AcceptPush = func(_, _ *http.Request) bool {
+			promised++
+			return true
+		}
+		pushedRsps := make(chan *http.Response, 2)
+		opts.HandlePush = func(rsp *http.Response) { pushedRsps <- rsp }
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		session.uniStreamsToAccept <- newPushStream(0, encodeResponse(200, []byte("body{}")))
+		Eventually(pushedRsps).Should(Receive())
+		Eventually(func() int {
+			client.mutex.Lock()
+			defer client.mutex.Unlock()
+			return len(client.pushes)
+		}).Should(BeZero())
+		client.mutex.Lock()
+		Expect(client.lowestPushID).To(BeEquivalentTo(1))
+		Expect(client.finishedPushes).To(BeEmpty())
+		client.mutex.Unlock()
+
+		// the push ID is reused
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/script.js"),
+			encodeResponse(200, nil),
+		)}
+		_, err = client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(promised).To(Equal(1))
+		pushStr := newPushStream(0, encodeResponse(200, []byte("alert()")))
+		session.uniStreamsToAccept <- pushStr
+		Eventually(func() quic.ErrorCode {
+			pushStr.mutex.Lock()
+			defer pushStr.mutex.Unlock()
+			return pushStr.resetErrorCode
+		}).Should(Equal(quic.ErrorCode(errorRequestCanceled)))
+		Consistently(pushedRsps).ShouldNot(Receive())
+		client.mutex.Lock()
+		Expect(client.pushes).To(BeEmpty())
+		client.mutex.Unlock()
+	})
+
+	It("closes the session when receiving a second push stream for a finished push", func() {
+		pushedRsps := make(chan *http.Response, 1)
+		opts.HandlePush = func(rsp *http.Response) { pushedRsps <- rsp }
+		// push 0 is promised, but not received, so the push ID of push 1 is above the low-water mark
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodePushPromise(1, "GET", "quic.clemente.io:1337", "/script.js"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		session.uniStreamsToAccept <- newPushStream(1, encodeResponse(200, []byte("alert()")))
+		Eventually(pushedRsps).Should(Receive())
+		Eventually(func() map[uint64]bool {
+			client.mutex.Lock()
+			defer client.mutex.Unlock()
+			return client.finishedPushes
+		}).Should(HaveKeyWithValue(uint64(1), true))
+
+		session.uniStreamsToAccept <- newPushStream(1, encodeResponse(200, []byte("alert()")))
+		Eventually(session.isClosed).Should(BeTrue())
+		code, _ := session.getCloseError()
+		Expect(code).To(Equal(quic.ErrorCode(errorIDError)))
+	})
+
+	Context("matching pushed requests", func() {
+		encodeResponseWithVary := func(vary string, body []byte) []byte {
+			str := newMockStream(0)
+			rw := newResponseWriter(str, qpack.NewEncoder(nil, 0), utils.DefaultLogger)
+			rw.Header().Set("Vary", vary)
+			rw.WriteHeader(200)
+			rw.Write(body)
+			return str.dataWritten.Bytes()
+		}
+
+		push := func(vary string) {
+			session.streamsToOpen = []quic.Stream{newStream(
+				encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css", qpack.HeaderField{Name: "accept-encoding", Value: "gzip"}),
+				encodeResponse(200, nil),
+			)}
+			_, err := client.RoundTrip(req)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			session.uniStreamsToAccept <- newPushStream(0, encodeResponseWithVary(vary, []byte("body{}")))
+		}
+
+		newPushedRequest := func(acceptEncoding string) *http.Request {
+			pushedReq, err := http.NewRequest("GET", "https://quic.clemente.io:1337/style.css", nil)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			pushedReq.Header.Set("Accept-Encoding", acceptEncoding)
+			return pushedReq
+		}
+
+		It("uses pushed responses if the header fields listed in the Vary header field match", func() {
+			push("Accept-Language, accept-encoding")
+			rsp, err := client.RoundTrip(newPushedRequest("gzip"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("body{}")))
+		})
+
+		It("doesn't use pushed responses if a header field listed in the Vary header field differs", func() {
+			push("Accept-Encoding")
+			session.streamsToOpen = []quic.Stream{newStream(encodeResponse(200, []byte("from the network")))}
+			rsp, err := client.RoundTrip(newPushedRequest("br"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("from the network")))
+		})
+
+		It("doesn't use pushed responses that vary on all header fields", func() {
+			push("*")
+			session.streamsToOpen = []quic.Stream{newStream(encodeResponse(200, []byte("from the network")))}
+			rsp, err := client.RoundTrip(newPushedRequest("gzip"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("from the network")))
+		})
+	})
+
+	Context("caching pushes", func() {
+		getMaxPushID := func() uint64 {
+			var maxPushID uint64
+			for _, f := range getControlFrames() {
+				if f, ok := f.(*maxPushIDFrame); ok {
+					maxPushID = f.PushID
+				}
+			}
+			return maxPushID
+		}
+
+		It("only allows the server to promise another push once the cached push was used", func() {
+			session.streamsToOpen = []quic.Stream{newStream(
+				encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+				encodeResponse(200, nil),
+			)}
+			_, err := client.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			session.uniStreamsToAccept <- newPushStream(0, encodeResponse(200, []byte("body{}")))
+			Eventually(func() bool {
+				client.mutex.Lock()
+				defer client.mutex.Unlock()
+				return client.pushes[0].isDone()
+			}).Should(BeTrue())
+			Expect(getMaxPushID()).To(BeEquivalentTo(maxConcurrentPushes - 1))
+
+			pushedReq, err := http.NewRequest("GET", "https://quic.clemente.io:1337/style.css", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.RoundTrip(pushedReq)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getMaxPushID()).To(BeEquivalentTo(maxConcurrentPushes))
+		})
+
+		It("evicts the oldest push when the cache is full", func() {
+			var data [][]byte
+			for i := 0; i <= maxCachedPushes; i++ {
+				data = append(data, encodePushPromise(uint64(i), "GET", "quic.clemente.io:1337", fmt.Sprintf("/%d.css", i)))
+			}
+			session.streamsToOpen = []quic.Stream{newStream(append(data, encodeResponse(200, nil))...)}
+			_, err := client.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.pushCache).To(HaveLen(maxCachedPushes))
+			Expect(client.pushCache).ToNot(HaveKey("GET https://quic.clemente.io:1337/0.css"))
+			Expect(getControlFrames()).To(ContainElement(&cancelPushFrame{PushID: 0}))
+			Expect(getMaxPushID()).To(BeEquivalentTo(maxConcurrentPushes))
+		})
+
+		It("closes the bodies of cached pushes when the session is closed", func() {
+			session.streamsToOpen = []quic.Stream{newStream(
+				encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+				encodeResponse(200, nil),
+			)}
+			_, err := client.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			pushStr := newPushStream(0, encodeResponse(200, []byte("body{}")))
+			session.uniStreamsToAccept <- pushStr
+			Eventually(func() bool {
+				client.mutex.Lock()
+				defer client.mutex.Unlock()
+				return client.pushes[0].isDone()
+			}).Should(BeTrue())
+			Expect(client.Close()).To(Succeed())
+			Eventually(func() quic.ErrorCode {
+				pushStr.mutex.Lock()
+				defer pushStr.mutex.Unlock()
+				return pushStr.resetErrorCode
+			}).Should(Equal(quic.ErrorCode(errorRequestCanceled)))
+			Eventually(func() int {
+				client.mutex.Lock()
+				defer client.mutex.Unlock()
+				return len(client.pushCache)
+			}).Should(BeZero())
+		})
+	})
+
+	It("cancels pushes that are rejected by the AcceptPush callback", func() {
+		opts.AcceptPush = func(_, _ *http.Request) bool { return false }
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getControlFrames()).To(Equal([]frame{
+			&settingsFrame{Settings: map[uint64]uint64{}},
+			&maxPushIDFrame{PushID: maxConcurrentPushes - 1},
+			&cancelPushFrame{PushID: 0},
+			&maxPushIDFrame{PushID: maxConcurrentPushes},
+		}))
+
+		pushStr := newPushStream(0, nil)
+		session.uniStreamsToAccept <- pushStr
+		Eventually(func() quic.ErrorCode {
+			pushStr.mutex.Lock()
+			defer pushStr.mutex.Unlock()
+			return pushStr.resetErrorCode
+		}).Should(Equal(quic.ErrorCode(errorRequestCanceled)))
+	})
+
+	It("cancels pushes for other authorities", func() {
+		var called bool
+		opts.AcceptPush = func(_, _ *http.Request) bool {
+			called = true
+			return true
+		}
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "evil.com", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(called).To(BeFalse())
+		Expect(getControlFrames()).To(ContainElement(&cancelPushFrame{PushID: 0}))
+	})
+
+	It("cancels pushes for unsafe methods", func() {
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "POST", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getControlFrames()).To(ContainElement(&cancelPushFrame{PushID: 0}))
+	})
+
+	It("doesn't use pushes that were canceled by the server", func() {
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.handleControlFrame(&cancelPushFrame{PushID: 0})).To(Succeed())
+
+		pushedReq, err := http.NewRequest("GET", "https://quic.clemente.io:1337/style.css", nil)
+		Expect(err).ToNot(HaveOccurred())
+		session.streamsToOpen = []quic.Stream{newStream(encodeResponse(200, []byte("from the network")))}
+		rsp, err := client.RoundTrip(pushedReq)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("from the network")))
+	})
+
+	It("closes the session if the push ID exceeds the MAX_PUSH_ID", func() {
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(maxConcurrentPushes, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).To(MatchError("push ID 100 exceeds the maximum push ID (99)"))
+		Expect(session.isClosed()).To(BeTrue())
+		code, _ := session.getCloseError()
+		Expect(code).To(Equal(quic.ErrorCode(errorIDError)))
+	})
+
+	It("closes the session if a push is promised with different requests", func() {
+		session.streamsToOpen = []quic.Stream{newStream(
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/style.css"),
+			encodePushPromise(0, "GET", "quic.clemente.io:1337", "/script.js"),
+			encodeResponse(200, nil),
+		)}
+		_, err := client.RoundTrip(req)
+		Expect(err).To(MatchError("push 0 promised with different requests"))
+		code, _ := session.getCloseError()
+		Expect(code).To(Equal(quic.ErrorCode(errorGeneralProtocolError)))
+	})
+
+	It("errors when receiving a MAX_PUSH_ID frame", func() {
+		Expect(client.handleControlFrame(&maxPushIDFrame{PushID: 10})).To(MatchError("received a MAX_PUSH_ID frame"))
+	})
+})
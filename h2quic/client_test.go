@@ -7,17 +7,13 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
-
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
-	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
-
-	"time"
+	"github.com/lucas-clemente/quic-go/qpack"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -27,21 +23,25 @@ var _ = Describe("Client", func() {
 	var (
 		client       *client
 		session      *mockSession
-		headerStream *mockStream
 		req          *http.Request
 		origDialAddr = dialAddr
 	)
 
-	injectResponse := func(id protocol.StreamID, rsp *http.Response) {
-		EventuallyWithOffset(0, func() bool {
-			client.mutex.Lock()
-			defer client.mutex.Unlock()
-			_, ok := client.responses[id]
-			return ok
-		}).Should(BeTrue())
-		rspChan := client.responses[5]
-		ExpectWithOffset(0, rspChan).ToNot(BeClosed())
-		rspChan <- rsp
+	// encodeResponse encodes a response in the same way the server does
+	encodeResponse := func(status int, hdr http.Header, body []byte) *mockStream {
+		buf := newMockStream(0)
+		rw := newResponseWriter(buf, qpack.NewEncoder(nil, 0), utils.DefaultLogger)
+		for k, v := range hdr {
+			rw.Header()[k] = v
+		}
+		rw.WriteHeader(status)
+		if body != nil {
+			rw.Write(body)
+		}
+		str := newMockStream(0)
+		str.dataToRead.Write(buf.dataWritten.Bytes())
+		close(str.unblockRead)
+		return str
 	}
 
 	BeforeEach(func() {
@@ -50,25 +50,30 @@ var _ = Describe("Client", func() {
 		client = newClient(hostname, nil, &roundTripperOpts{}, nil, nil)
 		Expect(client.hostname).To(Equal(hostname))
 		session = newMockSession()
-		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
-		client.session = session
-
-		headerStream = newMockStream(3)
-		client.headerStream = headerStream
-		client.requestWriter = newRequestWriter(headerStream, utils.DefaultLogger)
+		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+			return session, nil
+		}
 		var err error
-		req, err = http.NewRequest("GET", "https://localhost:1337", nil)
+		req, err = http.NewRequest("GET", "https://quic.clemente.io:1337/file1.html", nil)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
 	AfterEach(func() {
 		dialAddr = origDialAddr
+		session.Close()
 	})
 
 	It("saves the TLS config", func() {
-		tlsConf := &tls.Config{InsecureSkipVerify: true}
+		tlsConf := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"foo"}}
 		client = newClient("", tlsConf, &roundTripperOpts{}, nil, nil)
-		Expect(client.tlsConf).To(Equal(tlsConf))
+		Expect(client.tlsConf.InsecureSkipVerify).To(BeTrue())
+		Expect(client.tlsConf.NextProtos).To(Equal([]string{NextProtoH3}))
+		Expect(tlsConf.NextProtos).To(Equal([]string{"foo"}))
+	})
+
+	It("uses the h3 ALPN if no TLS config is given", func() {
+		client = newClient("", nil, &roundTripperOpts{}, nil, nil)
+		Expect(client.tlsConf.NextProtos).To(Equal([]string{NextProtoH3}))
 	})
 
 	It("saves the QUIC config", func() {
@@ -88,30 +93,17 @@ var _ = Describe("Client", func() {
 		Expect(client.hostname).To(Equal("quic.clemente.io:443"))
 	})
 
-	It("dials", func() {
-		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
-		session.streamsToOpen = []quic.Stream{newMockStream(3), newMockStream(5)}
-		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
-			return session, nil
-		}
-		close(headerStream.unblockRead)
-		done := make(chan struct{})
-		go func() {
-			defer GinkgoRecover()
-			_, err := client.RoundTrip(req)
-			Expect(err).ToNot(HaveOccurred())
-			close(done)
-			// fmt.Println("done")
-		}()
-		Eventually(func() quic.Session { return client.session }).Should(Equal(session))
-		// make the go routine return
-		injectResponse(5, &http.Response{})
-		Eventually(done).Should(BeClosed())
+	It("dials and opens the control stream", func() {
+		session.streamsToOpen = []quic.Stream{encodeResponse(200, nil, nil)}
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.session).To(Equal(session))
+		Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+		Expect(session.getOpenedUniStreams()[0].dataWritten.Bytes()).To(Equal([]byte{streamTypeControlStream, 0x4, 0x0}))
 	})
 
 	It("errors when dialing fails", func() {
 		testErr := errors.New("handshake error")
-		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
 		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return nil, testErr
 		}
@@ -122,37 +114,28 @@ var _ = Describe("Client", func() {
 	It("uses the custom dialer, if provided", func() {
 		var tlsCfg *tls.Config
 		var qCfg *quic.Config
-		session.streamsToOpen = []quic.Stream{newMockStream(3), newMockStream(5)}
+		session.streamsToOpen = []quic.Stream{encodeResponse(200, nil, nil)}
 		dialer := func(_, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
 			tlsCfg = tlsCfgP
 			qCfg = cfg
 			return session, nil
 		}
-		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, dialer)
-		done := make(chan struct{})
-		go func() {
-			defer GinkgoRecover()
-			_, err := client.RoundTrip(req)
-			Expect(err).ToNot(HaveOccurred())
-			close(done)
-		}()
-		Eventually(func() quic.Session { return client.session }).Should(Equal(session))
+		client = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{}, nil, dialer)
+		_, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.session).To(Equal(session))
 		Expect(qCfg).To(Equal(client.config))
 		Expect(tlsCfg).To(Equal(client.tlsConf))
-		// make the go routine return
-		injectResponse(5, &http.Response{})
-		Eventually(done).Should(BeClosed())
 	})
 
-	It("errors if it can't open a stream", func() {
+	It("closes the session if it can't open the control stream", func() {
 		testErr := errors.New("you shall not pass")
-		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
 		session.streamOpenErr = testErr
-		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
-			return session, nil
-		}
 		_, err := client.RoundTrip(req)
 		Expect(err).To(MatchError(testErr))
+		Expect(session.isClosed()).To(BeTrue())
+		code, _ := session.getCloseError()
+		Expect(code).To(Equal(quic.ErrorCode(errorClosedCriticalStream)))
 	})
 
 	It("returns a request when dial fails", func() {
@@ -160,182 +143,293 @@ var _ = Describe("Client", func() {
 		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return nil, testErr
 		}
-		request, err := http.NewRequest("https", "https://quic.clemente.io:1337/file1.dat", nil)
-		Expect(err).ToNot(HaveOccurred())
 
 		done := make(chan struct{})
 		go func() {
-			_, err := client.RoundTrip(request)
+			defer GinkgoRecover()
+			_, err := client.RoundTrip(req)
 			Expect(err).To(MatchError(testErr))
 			close(done)
 		}()
-		_, err = client.RoundTrip(request)
+		_, err := client.RoundTrip(req)
 		Expect(err).To(MatchError(testErr))
 		Eventually(done).Should(BeClosed())
 	})
 
+	Context("handling GOAWAY frames", func() {
+		BeforeEach(func() {
+			client.session = session
+			client.dialOnce.Do(func() {}) // fake a handshake
+		})
+
+		It("refuses new requests after receiving a GOAWAY frame", func() {
+			Expect(client.handleControlFrame(&goAwayFrame{StreamID: 8})).To(Succeed())
+			_, err := client.RoundTrip(req)
+			Expect(err).To(MatchError(errGoAway))
+		})
+
+		It("rejects GOAWAY frames with an invalid stream ID", func() {
+			Expect(client.handleControlFrame(&goAwayFrame{StreamID: 3})).To(MatchError("GOAWAY frame contains an invalid stream ID: 3"))
+			Expect(client.isGoingAway()).To(BeFalse())
+		})
+
+		It("handles GOAWAY frames received on the control stream", func() {
+			str := newMockStream(3)
+			utils.WriteVarInt(&str.dataToRead, streamTypeControlStream)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			(&goAwayFrame{StreamID: 4}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, client.handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(client.isGoingAway).Should(BeTrue())
+			Expect(session.isClosed()).To(BeFalse())
+		})
+	})
+
 	Context("Doing requests", func() {
-		var request *http.Request
-		var dataStream *mockStream
-
-		getRequest := func(data []byte) *http2.MetaHeadersFrame {
-			r := bytes.NewReader(data)
-			decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
-			h2framer := http2.NewFramer(nil, r)
-			frame, err := h2framer.ReadFrame()
+		It("does a request", func() {
+			str := encodeResponse(418, http.Header{"Foo": {"bar"}}, []byte("foobar"))
+			session.streamsToOpen = []quic.Stream{str}
+			rsp, err := client.RoundTrip(req)
 			Expect(err).ToNot(HaveOccurred())
-			mhframe := &http2.MetaHeadersFrame{HeadersFrame: frame.(*http2.HeadersFrame)}
-			mhframe.Fields, err = decoder.DecodeFull(mhframe.HeadersFrame.HeaderBlockFragment())
+			Expect(rsp.StatusCode).To(Equal(418))
+			Expect(rsp.Proto).To(Equal("HTTP/3.0"))
+			Expect(rsp.Header.Get("Foo")).To(Equal("bar"))
+			Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
+			Expect(rsp.Request).To(Equal(req))
+			data, err := ioutil.ReadAll(rsp.Body)
 			Expect(err).ToNot(HaveOccurred())
-			return mhframe
-		}
-
-		getHeaderFields := func(f *http2.MetaHeadersFrame) map[string]string {
-			fields := make(map[string]string)
-			for _, hf := range f.Fields {
-				fields[hf.Name] = hf.Value
-			}
-			return fields
-		}
+			Expect(data).To(Equal([]byte("foobar")))
+			// check the request
+			headers := decodeHeader(&str.dataWritten)
+			Expect(headers).To(HaveKeyWithValue(":method", []string{"GET"}))
+			Expect(headers).To(HaveKeyWithValue(":authority", []string{"quic.clemente.io:1337"}))
+			Expect(headers).To(HaveKeyWithValue(":path", []string{"/file1.html"}))
+			Expect(str.dataWritten.Len()).To(BeZero())
+			Expect(str.closed).To(BeTrue())
+		})
 
-		BeforeEach(func() {
-			var err error
-			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
-				return session, nil
-			}
-			dataStream = newMockStream(5)
-			session.streamsToOpen = []quic.Stream{headerStream, dataStream}
-			request, err = http.NewRequest("https", "https://quic.clemente.io:1337/file1.dat", nil)
+		It("stops reading the response when the body is closed", func() {
+			str := encodeResponse(200, nil, []byte("foobar"))
+			session.streamsToOpen = []quic.Stream{str}
+			rsp, err := client.RoundTrip(req)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Body.Close()).To(Succeed())
+			Expect(str.reset).To(BeTrue())
+			Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
 		})
 
-		It("does a request", func() {
-			teapot := &http.Response{
-				Status:     "418 I'm a teapot",
-				StatusCode: 418,
-			}
-			done := make(chan struct{})
-			go func() {
-				defer GinkgoRecover()
-				rsp, err := client.RoundTrip(request)
-				Expect(err).ToNot(HaveOccurred())
-				Expect(rsp).To(Equal(teapot))
-				Expect(rsp.Body).To(Equal(dataStream))
-				Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
-				Expect(rsp.Request).To(Equal(request))
-				close(done)
-			}()
+		It("errors if the first frame is not a HEADERS frame", func() {
+			str := newMockStream(0)
+			(&dataFrame{Length: 6}).Write(&str.dataToRead)
+			str.dataToRead.Write([]byte("foobar"))
+			session.streamsToOpen = []quic.Stream{str}
+			_, err := client.RoundTrip(req)
+			Expect(err).To(MatchError("expected first frame to be a HEADERS frame"))
+			code, _ := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+		})
 
-			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
-			injectResponse(5, teapot)
-			Expect(client.headerErrored).ToNot(BeClosed())
-			Eventually(done).Should(BeClosed())
+		It("errors if the HEADERS frame is too large", func() {
+			str := newMockStream(0)
+			(&headersFrame{Length: maxResponseHeaderBytes + 1}).Write(&str.dataToRead)
+			session.streamsToOpen = []quic.Stream{str}
+			_, err := client.RoundTrip(req)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("HEADERS frame too large"))
+			Expect(str.reset).To(BeTrue())
+			Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorFrameError)))
 		})
 
-		It("errors if a request without a body is canceled", func() {
-			done := make(chan struct{})
-			ctx, cancel := context.WithCancel(context.Background())
-			go func() {
-				defer GinkgoRecover()
-				request = request.WithContext(ctx)
-				rsp, err := client.RoundTrip(request)
-				Expect(err).To(MatchError(context.Canceled))
-				Expect(rsp).To(BeNil())
-				close(done)
-			}()
+		It("closes the session if it can't decode the header fields", func() {
+			str := newMockStream(0)
+			(&headersFrame{Length: 3}).Write(&str.dataToRead)
+			str.dataToRead.Write([]byte{0x0, 0x0, 0x80})
+			session.streamsToOpen = []quic.Stream{str}
+			_, err := client.RoundTrip(req)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot read header fields"))
+			code, _ := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorQPACKDecompressionFailed)))
+		})
 
-			cancel()
-			Eventually(done).Should(BeClosed())
-			Expect(dataStream.reset).To(BeTrue())
-			Expect(dataStream.canceledWrite).To(BeTrue())
-			Expect(client.headerErrored).ToNot(BeClosed())
+		It("errors if the response is malformed", func() {
+			str := newMockStream(0)
+			Expect(writeHeadersFrame(&str.dataToRead, qpack.NewEncoder(nil, 0), 0, []qpack.HeaderField{{Name: ":path", Value: "/"}})).To(Succeed())
+			session.streamsToOpen = []quic.Stream{str}
+			_, err := client.RoundTrip(req)
+			Expect(err).To(MatchError(`invalid response pseudo header ":path"`))
+			Expect(str.reset).To(BeTrue())
+			Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorMessageError)))
+			Expect(session.isClosed()).To(BeFalse())
+		})
+
+		It("errors if it can't open a stream", func() {
+			client.session = session
+			client.dialOnce.Do(func() {}) // fake a handshake
+			testErr := errors.New("you shall not pass")
+			session.streamOpenErr = testErr
+			_, err := client.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
 		})
 
-		It("errors if a request with a body is canceled after the body is sent", func() {
+		It("blocks if no stream is available", func() {
+			client.session = session
+			client.dialOnce.Do(func() {}) // fake a handshake
+			session.streamsToOpen = []quic.Stream{encodeResponse(200, nil, nil)}
+			session.blockOpenStreamSync = true
 			done := make(chan struct{})
-			ctx, cancel := context.WithCancel(context.Background())
 			go func() {
 				defer GinkgoRecover()
-				request = request.WithContext(ctx)
-				request.Body = &mockBody{}
-				rsp, err := client.RoundTrip(request)
-				Expect(err).To(MatchError(context.Canceled))
-				Expect(rsp).To(BeNil())
+				_, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
 				close(done)
 			}()
 
-			time.Sleep(10 * time.Millisecond)
-			cancel()
+			Consistently(done).ShouldNot(BeClosed())
+			// make the go routine return
+			client.Close()
 			Eventually(done).Should(BeClosed())
-			Expect(dataStream.reset).To(BeTrue())
-			Expect(dataStream.canceledWrite).To(BeTrue())
-			Expect(client.headerErrored).ToNot(BeClosed())
 		})
 
-		It("errors if a request with a body is canceled before the body is sent", func() {
-			done := make(chan struct{})
-			ctx, cancel := context.WithCancel(context.Background())
-			go func() {
-				defer GinkgoRecover()
-				request = request.WithContext(ctx)
-				request.Body = &mockBody{}
+		Context("canceling requests", func() {
+			var str *mockStream
+
+			BeforeEach(func() {
+				str = newMockStream(0)
+				session.streamsToOpen = []quic.Stream{str}
+			})
+
+			It("errors if a request without a body is canceled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(req.WithContext(ctx))
+					Expect(err).To(MatchError(context.Canceled))
+					Expect(rsp).To(BeNil())
+					close(done)
+				}()
+
 				cancel()
+				Eventually(done).Should(BeClosed())
+				Expect(str.reset).To(BeTrue())
+				Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+				Expect(str.canceledWrite).To(BeTrue())
+				Expect(str.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+				Expect(session.isClosed()).To(BeFalse())
+			})
+
+			It("errors if a request with a body is canceled after the body is sent", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					request := req.WithContext(ctx)
+					request.Body = &mockBody{}
+					rsp, err := client.RoundTrip(request)
+					Expect(err).To(MatchError(context.Canceled))
+					Expect(rsp).To(BeNil())
+					close(done)
+				}()
+
 				time.Sleep(10 * time.Millisecond)
+				cancel()
+				Eventually(done).Should(BeClosed())
+				Expect(str.reset).To(BeTrue())
+				Expect(str.canceledWrite).To(BeTrue())
+			})
+
+			It("errors if a request with a body is canceled before the body is sent", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				request := req.WithContext(ctx)
+				request.Body = &mockBody{}
+				cancel()
 				rsp, err := client.RoundTrip(request)
 				Expect(err).To(MatchError(context.Canceled))
 				Expect(rsp).To(BeNil())
-				close(done)
-			}()
-
-			Eventually(done).Should(BeClosed())
-			Expect(dataStream.reset).To(BeTrue())
-			Expect(dataStream.canceledWrite).To(BeTrue())
-			Expect(client.headerErrored).ToNot(BeClosed())
-		})
+				Expect(str.reset).To(BeTrue())
+				Expect(str.canceledWrite).To(BeTrue())
+			})
 
-		It("closes the quic client when encountering an error on the header stream", func() {
-			headerStream.dataToRead.Write(bytes.Repeat([]byte{0}, 100))
-			done := make(chan struct{})
-			go func() {
-				defer GinkgoRecover()
-				rsp, err := client.RoundTrip(request)
-				Expect(err).To(MatchError(client.headerErr))
-				Expect(rsp).To(BeNil())
-				close(done)
-			}()
+			It("resets the stream if the request is canceled while reading the response body", func() {
+				Expect(writeHeadersFrame(&str.dataToRead, qpack.NewEncoder(nil, 0), 0, []qpack.HeaderField{{Name: ":status", Value: "200"}})).To(Succeed())
+				ctx, cancel := context.WithCancel(context.Background())
+				rsp, err := client.RoundTrip(req.WithContext(ctx))
+				Expect(err).ToNot(HaveOccurred())
+				Consistently(str.isCanceledRead).Should(BeFalse())
+				cancel()
+				Eventually(str.isCanceledRead).Should(BeTrue())
+				Eventually(str.isCanceledWrite).Should(BeTrue())
+				Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+				Expect(str.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+				str.readErr = errors.New("read canceled")
+				close(str.unblockRead)
+				_, err = ioutil.ReadAll(rsp.Body)
+				Expect(err).To(MatchError(context.Canceled))
+			})
 
-			Eventually(done).Should(BeClosed())
-			Expect(client.headerErr.ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
-			Expect(client.session.(*mockSession).closedWithError).To(MatchError(client.headerErr))
+			It("doesn't reset the stream if the request is canceled after the response body was read", func() {
+				str = encodeResponse(200, nil, []byte("foobar"))
+				session.streamsToOpen = []quic.Stream{str}
+				ctx, cancel := context.WithCancel(context.Background())
+				rsp, err := client.RoundTrip(req.WithContext(ctx))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ioutil.ReadAll(rsp.Body)).To(Equal([]byte("foobar")))
+				cancel()
+				Consistently(str.isCanceledRead).Should(BeFalse())
+			})
 		})
 
-		It("returns subsequent request if there was an error on the header stream before", func() {
-			session.streamsToOpen = []quic.Stream{headerStream, dataStream, newMockStream(7)}
-			headerStream.dataToRead.Write(bytes.Repeat([]byte{0}, 100))
-			_, err := client.RoundTrip(request)
-			Expect(err).To(BeAssignableToTypeOf(&qerr.QuicError{}))
-			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
-			// now that the first request failed due to an error on the header stream, try another request
-			_, nextErr := client.RoundTrip(request)
-			Expect(nextErr).To(MatchError(err))
-		})
+		Context("stream resets", func() {
+			It("returns a RequestRejectedError if the server rejects the request", func() {
+				str := newMockStream(4)
+				str.readErr = &mockStreamError{code: quic.ErrorCode(errorRequestRejected)}
+				close(str.unblockRead)
+				session.streamsToOpen = []quic.Stream{str}
+				_, err := client.RoundTrip(req)
+				Expect(err).To(Equal(&RequestRejectedError{StreamID: 4}))
+				Expect(err).To(MatchError("h2quic: server rejected the request on stream 4"))
+			})
 
-		It("blocks if no stream is available", func() {
-			session.streamsToOpen = []quic.Stream{headerStream, dataStream}
-			session.blockOpenStreamSync = true
-			done := make(chan struct{})
-			go func() {
-				defer GinkgoRecover()
-				_, err := client.RoundTrip(request)
+			It("returns a StreamResetError if the server resets the stream before sending the response", func() {
+				str := newMockStream(4)
+				str.readErr = &mockStreamError{code: quic.ErrorCode(errorInternalError)}
+				close(str.unblockRead)
+				session.streamsToOpen = []quic.Stream{str}
+				_, err := client.RoundTrip(req)
+				Expect(err).To(Equal(&StreamResetError{StreamID: 4, ErrorCode: quic.ErrorCode(errorInternalError)}))
+				Expect(err).To(MatchError("h2quic: server reset stream 4: H3_INTERNAL_ERROR"))
+			})
+
+			It("returns a StreamResetError if the server resets the stream while sending the response body", func() {
+				str := newMockStream(4)
+				Expect(writeHeadersFrame(&str.dataToRead, qpack.NewEncoder(nil, 0), 0, []qpack.HeaderField{{Name: ":status", Value: "200"}})).To(Succeed())
+				(&dataFrame{Length: 6}).Write(&str.dataToRead)
+				str.dataToRead.Write([]byte("foo"))
+				str.readErr = &mockStreamError{code: quic.ErrorCode(errorRequestCanceled)}
+				close(str.unblockRead)
+				session.streamsToOpen = []quic.Stream{str}
+				rsp, err := client.RoundTrip(req)
 				Expect(err).ToNot(HaveOccurred())
-				close(done)
-			}()
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(data).To(Equal([]byte("foo")))
+				Expect(err).To(Equal(&StreamResetError{StreamID: 4, ErrorCode: quic.ErrorCode(errorRequestCanceled)}))
+			})
 
-			Consistently(done).ShouldNot(BeClosed())
-			// make the go routine return
-			client.Close()
-			injectResponse(5, &http.Response{})
-			Eventually(done).Should(BeClosed())
+			It("stops sending the request body when the server sends a STOP_SENDING with H3_NO_ERROR", func() {
+				str := newMockStream(4)
+				str.writeErr = &mockStreamError{code: quic.ErrorCode(errorNoError)}
+				Expect(client.writeRequestBody(str, ioutil.NopCloser(bytes.NewReader([]byte("foobar"))))).To(Succeed())
+				Expect(str.isCanceledWrite()).To(BeFalse())
+			})
+
+			It("returns a RequestRejectedError if the server rejects the request while the body is sent", func() {
+				str := newMockStream(4)
+				str.writeErr = &mockStreamError{code: quic.ErrorCode(errorRequestRejected)}
+				err := client.writeRequestBody(str, ioutil.NopCloser(bytes.NewReader([]byte("foobar"))))
+				Expect(err).To(Equal(&RequestRejectedError{StreamID: 4}))
+				Expect(str.isCanceledWrite()).To(BeTrue())
+			})
 		})
 
 		Context("validating the address", func() {
@@ -350,130 +444,65 @@ var _ = Describe("Client", func() {
 				req, err := http.NewRequest("https", "http://quic.clemente.io:1337/foobar.html", nil)
 				Expect(err).ToNot(HaveOccurred())
 				_, err = client.RoundTrip(req)
-				Expect(err).To(MatchError("quic http2: unsupported scheme"))
+				Expect(err).To(MatchError("quic http3: unsupported scheme"))
 			})
 
 			It("adds the port for request URLs without one", func() {
 				client = newClient("quic.clemente.io", nil, &roundTripperOpts{}, nil, nil)
 				req, err := http.NewRequest("https", "https://quic.clemente.io/foobar.html", nil)
 				Expect(err).ToNot(HaveOccurred())
-
-				done := make(chan struct{})
-				// the client.RoundTrip will block, because the encryption level is still set to Unencrypted
-				go func() {
-					defer GinkgoRecover()
-					_, err := client.RoundTrip(req)
-					Expect(err).ToNot(HaveOccurred())
-					close(done)
-				}()
-
-				Consistently(done).ShouldNot(BeClosed())
-				// make the go routine return
-				injectResponse(5, &http.Response{})
-				Eventually(done).Should(BeClosed())
+				session.streamsToOpen = []quic.Stream{encodeResponse(200, nil, nil)}
+				_, err = client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
 			})
 		})
 
-		It("sets the EndStream header for requests without a body", func() {
-			done := make(chan struct{})
-			go func() {
-				defer GinkgoRecover()
-				client.RoundTrip(request)
-				close(done)
-			}()
-			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeNil())
-			mhf := getRequest(headerStream.dataWritten.Bytes())
-			Expect(mhf.HeadersFrame.StreamEnded()).To(BeTrue())
-			// make the go routine return
-			injectResponse(5, &http.Response{})
-			Eventually(done).Should(BeClosed())
-		})
-
-		It("sets the EndStream header to false for requests with a body", func() {
-			request.Body = &mockBody{}
-			done := make(chan struct{})
-			go func() {
-				defer GinkgoRecover()
-				client.RoundTrip(request)
-				close(done)
-			}()
-			Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeNil())
-			mhf := getRequest(headerStream.dataWritten.Bytes())
-			Expect(mhf.HeadersFrame.StreamEnded()).To(BeFalse())
-			// make the go routine return
-			injectResponse(5, &http.Response{})
-			Eventually(done).Should(BeClosed())
-		})
-
 		Context("requests containing a Body", func() {
 			var requestBody []byte
-			var response *http.Response
+			var str *mockStream
 
 			BeforeEach(func() {
 				requestBody = []byte("request body")
 				body := &mockBody{}
 				body.SetData(requestBody)
-				request.Body = body
-				response = &http.Response{
-					StatusCode: 200,
-					Header:     http.Header{"Content-Length": []string{"1000"}},
-				}
-				// fake a handshake
-				client.dialOnce.Do(func() {})
-				session.streamsToOpen = []quic.Stream{dataStream}
+				req.Body = body
+				str = encodeResponse(200, http.Header{"Content-Length": {"1000"}}, nil)
+				session.streamsToOpen = []quic.Stream{str}
 			})
 
 			It("sends a request", func() {
-				rspChan := make(chan *http.Response)
-				go func() {
-					defer GinkgoRecover()
-					rsp, err := client.RoundTrip(request)
-					Expect(err).ToNot(HaveOccurred())
-					rspChan <- rsp
-				}()
-				injectResponse(5, response)
-				Eventually(rspChan).Should(Receive(Equal(response)))
-				Expect(dataStream.dataWritten.Bytes()).To(Equal(requestBody))
-				Expect(dataStream.closed).To(BeTrue())
-				Expect(request.Body.(*mockBody).closed).To(BeTrue())
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(rsp.ContentLength).To(BeEquivalentTo(1000))
+				decodeHeader(&str.dataWritten)
+				Expect(getData(&str.dataWritten)).To(Equal(requestBody))
+				Expect(str.closed).To(BeTrue())
+				Expect(req.Body.(*mockBody).closed).To(BeTrue())
 			})
 
 			It("returns the error that occurred when reading the body", func() {
 				testErr := errors.New("testErr")
-				request.Body.(*mockBody).readErr = testErr
-
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					rsp, err := client.RoundTrip(request)
-					Expect(err).To(MatchError(testErr))
-					Expect(rsp).To(BeNil())
-					close(done)
-				}()
-				Eventually(done).Should(BeClosed())
-				Expect(request.Body.(*mockBody).closed).To(BeTrue())
+				req.Body.(*mockBody).readErr = testErr
+				rsp, err := client.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				Expect(rsp).To(BeNil())
+				Expect(req.Body.(*mockBody).closed).To(BeTrue())
+				Expect(str.canceledWrite).To(BeTrue())
 			})
 
 			It("returns the error that occurred when closing the body", func() {
 				testErr := errors.New("testErr")
-				request.Body.(*mockBody).closeErr = testErr
-
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					rsp, err := client.RoundTrip(request)
-					Expect(err).To(MatchError(testErr))
-					Expect(rsp).To(BeNil())
-					close(done)
-				}()
-				Eventually(done).Should(BeClosed())
-				Expect(request.Body.(*mockBody).closed).To(BeTrue())
+				req.Body.(*mockBody).closeErr = testErr
+				rsp, err := client.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+				Expect(rsp).To(BeNil())
+				Expect(req.Body.(*mockBody).closed).To(BeTrue())
 			})
 		})
 
 		Context("gzip compression", func() {
 			var gzippedData []byte // a gzipped foobar
-			var response *http.Response
 
 			BeforeEach(func() {
 				var b bytes.Buffer
@@ -481,158 +510,55 @@ var _ = Describe("Client", func() {
 				w.Write([]byte("foobar"))
 				w.Close()
 				gzippedData = b.Bytes()
-				response = &http.Response{
-					StatusCode: 200,
-					Header:     http.Header{"Content-Length": []string{"1000"}},
-				}
 			})
 
 			It("adds the gzip header to requests", func() {
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					rsp, err := client.RoundTrip(request)
-					Expect(err).ToNot(HaveOccurred())
-					Expect(rsp).ToNot(BeNil())
-					Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
-					Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
-					Expect(rsp.Header.Get("Content-Length")).To(BeEmpty())
-					data := make([]byte, 6)
-					_, err = io.ReadFull(rsp.Body, data)
-					Expect(err).ToNot(HaveOccurred())
-					Expect(data).To(Equal([]byte("foobar")))
-					close(done)
-				}()
-
-				dataStream.dataToRead.Write(gzippedData)
-				response.Header.Add("Content-Encoding", "gzip")
-				injectResponse(5, response)
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
-				Expect(headers).To(HaveKeyWithValue("accept-encoding", "gzip"))
-				close(dataStream.unblockRead)
-				Eventually(done).Should(BeClosed())
+				str := encodeResponse(200, http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {"1000"}}, gzippedData)
+				session.streamsToOpen = []quic.Stream{str}
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
+				Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
+				Expect(rsp.Header.Get("Content-Length")).To(BeEmpty())
+				data := make([]byte, 6)
+				_, err = io.ReadFull(rsp.Body, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				Expect(decodeHeader(&str.dataWritten)).To(HaveKeyWithValue("accept-encoding", []string{"gzip"}))
 			})
 
 			It("doesn't add gzip if the header disable it", func() {
 				client.opts.DisableCompression = true
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					_, err := client.RoundTrip(request)
-					Expect(err).ToNot(HaveOccurred())
-					close(done)
-				}()
-
-				Eventually(func() []byte { return headerStream.dataWritten.Bytes() }).ShouldNot(BeEmpty())
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
-				Expect(headers).ToNot(HaveKey("accept-encoding"))
-				// make the go routine return
-				injectResponse(5, &http.Response{})
-				Eventually(done).Should(BeClosed())
+				str := encodeResponse(200, nil, nil)
+				session.streamsToOpen = []quic.Stream{str}
+				_, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(decodeHeader(&str.dataWritten)).ToNot(HaveKey("accept-encoding"))
 			})
 
 			It("only decompresses the response if the response contains the right content-encoding header", func() {
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					rsp, err := client.RoundTrip(request)
-					Expect(err).ToNot(HaveOccurred())
-					Expect(rsp).ToNot(BeNil())
-					data := make([]byte, 11)
-					rsp.Body.Read(data)
-					Expect(rsp.ContentLength).ToNot(BeEquivalentTo(-1))
-					Expect(data).To(Equal([]byte("not gzipped")))
-					close(done)
-				}()
-
-				dataStream.dataToRead.Write([]byte("not gzipped"))
-				injectResponse(5, response)
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
-				Expect(headers).To(HaveKeyWithValue("accept-encoding", "gzip"))
-				Eventually(done).Should(BeClosed())
+				str := encodeResponse(200, http.Header{"Content-Length": {"11"}}, []byte("not gzipped"))
+				session.streamsToOpen = []quic.Stream{str}
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.ContentLength).To(BeEquivalentTo(11))
+				Expect(data).To(Equal([]byte("not gzipped")))
+				Expect(decodeHeader(&str.dataWritten)).To(HaveKeyWithValue("accept-encoding", []string{"gzip"}))
 			})
 
 			It("doesn't add the gzip header for requests that have the accept-enconding set", func() {
-				request.Header.Add("accept-encoding", "gzip")
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					rsp, err := client.RoundTrip(request)
-					Expect(err).ToNot(HaveOccurred())
-					data := make([]byte, 12)
-					_, err = rsp.Body.Read(data)
-					Expect(err).ToNot(HaveOccurred())
-					Expect(rsp.ContentLength).ToNot(BeEquivalentTo(-1))
-					Expect(data).To(Equal([]byte("gzipped data")))
-					close(done)
-				}()
-
-				dataStream.dataToRead.Write([]byte("gzipped data"))
-				injectResponse(5, response)
-				headers := getHeaderFields(getRequest(headerStream.dataWritten.Bytes()))
-				Expect(headers).To(HaveKeyWithValue("accept-encoding", "gzip"))
-				Eventually(done).Should(BeClosed())
-			})
-		})
-
-		Context("handling the header stream", func() {
-			var h2framer *http2.Framer
-
-			BeforeEach(func() {
-				h2framer = http2.NewFramer(&headerStream.dataToRead, nil)
-				client.responses[23] = make(chan *http.Response)
-			})
-
-			It("reads header values from a response", func() {
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				data := []byte{0x48, 0x03, 0x33, 0x30, 0x32, 0x58, 0x07, 0x70, 0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x61, 0x1d, 0x4d, 0x6f, 0x6e, 0x2c, 0x20, 0x32, 0x31, 0x20, 0x4f, 0x63, 0x74, 0x20, 0x32, 0x30, 0x31, 0x33, 0x20, 0x32, 0x30, 0x3a, 0x31, 0x33, 0x3a, 0x32, 0x31, 0x20, 0x47, 0x4d, 0x54, 0x6e, 0x17, 0x68, 0x74, 0x74, 0x70, 0x73, 0x3a, 0x2f, 0x2f, 0x77, 0x77, 0x77, 0x2e, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x63, 0x6f, 0x6d}
-				headerStream.dataToRead.Write([]byte{0x0, 0x0, byte(len(data)), 0x1, 0x5, 0x0, 0x0, 0x0, 23})
-				headerStream.dataToRead.Write(data)
-				go client.handleHeaderStream()
-				var rsp *http.Response
-				Eventually(client.responses[23]).Should(Receive(&rsp))
-				Expect(rsp).ToNot(BeNil())
-				Expect(rsp.Proto).To(Equal("HTTP/2.0"))
-				Expect(rsp.ProtoMajor).To(BeEquivalentTo(2))
-				Expect(rsp.StatusCode).To(BeEquivalentTo(302))
-				Expect(rsp.Status).To(Equal("302 Found"))
-				Expect(rsp.Header).To(HaveKeyWithValue("Location", []string{"https://www.example.com"}))
-				Expect(rsp.Header).To(HaveKeyWithValue("Cache-Control", []string{"private"}))
-			})
-
-			It("errors if the H2 frame is not a HeadersFrame", func() {
-				h2framer.WritePing(true, [8]byte{0, 0, 0, 0, 0, 0, 0, 0})
-				client.handleHeaderStream()
-				Eventually(client.headerErrored).Should(BeClosed())
-				Expect(client.headerErr).To(MatchError(qerr.Error(qerr.InvalidHeadersStreamData, "not a headers frame")))
-			})
-
-			It("errors if it can't read the HPACK encoded header fields", func() {
-				h2framer.WriteHeaders(http2.HeadersFrameParam{
-					StreamID:      23,
-					EndHeaders:    true,
-					BlockFragment: []byte("invalid HPACK data"),
-				})
-				client.handleHeaderStream()
-				Eventually(client.headerErrored).Should(BeClosed())
-				Expect(client.headerErr.ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
-				Expect(client.headerErr.ErrorMessage).To(ContainSubstring("cannot read header fields"))
-			})
-
-			It("errors if the stream cannot be found", func() {
-				var headers bytes.Buffer
-				enc := hpack.NewEncoder(&headers)
-				enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
-				err := h2framer.WriteHeaders(http2.HeadersFrameParam{
-					StreamID:      1337,
-					EndHeaders:    true,
-					BlockFragment: headers.Bytes(),
-				})
+				req.Header.Add("accept-encoding", "gzip")
+				str := encodeResponse(200, http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {"12"}}, []byte("gzipped data"))
+				session.streamsToOpen = []quic.Stream{str}
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(rsp.Body)
 				Expect(err).ToNot(HaveOccurred())
-				client.handleHeaderStream()
-				Eventually(client.headerErrored).Should(BeClosed())
-				Expect(client.headerErr.ErrorCode).To(Equal(qerr.InvalidHeadersStreamData))
-				Expect(client.headerErr.ErrorMessage).To(ContainSubstring("response channel for stream 1337 not found"))
+				Expect(rsp.ContentLength).To(BeEquivalentTo(12))
+				Expect(data).To(Equal([]byte("gzipped data")))
+				Expect(decodeHeader(&str.dataWritten)).To(HaveKeyWithValue("accept-encoding", []string{"gzip"}))
 			})
 		})
 	})
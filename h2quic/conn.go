@@ -0,0 +1,162 @@
+package h2quic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// NextProtoH3 is the ALPN protocol negotiated for HTTP/3.
+const NextProtoH3 = "h3"
+
+// unidirectional stream types, see RFC 9114, section 6.2, and RFC 9204, section 4.2
+const (
+	streamTypeControlStream      = 0x00
+	streamTypePushStream         = 0x01
+	streamTypeQPACKEncoderStream = 0x02
+	streamTypeQPACKDecoderStream = 0x03
+)
+
+// openControlStream opens the control stream and sends the SETTINGS frame.
+// We don't send any settings, so the peer uses the default values:
+// no dynamic QPACK table, and no limit for the size of header fields.
+// The control stream is returned, such that other frames can be sent on it later.
+func openControlStream(sess quic.Session) (quic.SendStream, error) {
+	str, err := sess.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	utils.WriteVarInt(buf, streamTypeControlStream)
+	(&settingsFrame{}).Write(buf)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// handleUnidirectionalStreams accepts the unidirectional streams opened by the peer.
+// Frames received on the control stream (other than the SETTINGS frame) are passed to handleControlFrame.
+// Any error on the control stream closes the session.
+// Push streams are passed to handlePushStream, after reading the push ID.
+// If handlePushStream is nil, receiving a push stream closes the session.
+func handleUnidirectionalStreams(
+	sess quic.Session,
+	isClient bool,
+	handleControlFrame func(frame) error,
+	handlePushStream func(pushID uint64, str quic.ReceiveStream),
+	logger utils.Logger,
+) {
+	var mutex sync.Mutex
+	var receivedControlStream bool
+
+	for {
+		str, err := sess.AcceptUniStream(context.Background())
+		if err != nil {
+			logger.Debugf("accepting unidirectional stream failed: %s", err)
+			return
+		}
+
+		go func(str quic.ReceiveStream) {
+			br := &byteReaderImpl{str}
+			streamType, err := utils.ReadVarInt(br)
+			if err != nil {
+				logger.Debugf("reading stream type on stream %d failed: %s", str.StreamID(), err)
+				return
+			}
+			switch streamType {
+			case streamTypeControlStream:
+				mutex.Lock()
+				duplicate := receivedControlStream
+				receivedControlStream = true
+				mutex.Unlock()
+				if duplicate {
+					sess.CloseWithError(quic.ErrorCode(errorStreamCreationError), errors.New("duplicate control stream"))
+					return
+				}
+				handleControlStream(sess, br, handleControlFrame)
+			case streamTypePushStream:
+				switch {
+				case !isClient:
+					sess.CloseWithError(quic.ErrorCode(errorStreamCreationError), errors.New("the client opened a push stream"))
+				case handlePushStream == nil:
+					// push is disabled, so we never sent a MAX_PUSH_ID frame
+					sess.CloseWithError(quic.ErrorCode(errorIDError), errors.New("received a push stream without sending MAX_PUSH_ID"))
+				default:
+					pushID, err := utils.ReadVarInt(br)
+					if err != nil {
+						logger.Debugf("reading the push ID on stream %d failed: %s", str.StreamID(), err)
+						return
+					}
+					handlePushStream(pushID, str)
+				}
+			case streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream:
+				// Since we don't use the dynamic table, there's nothing interesting on these streams.
+				io.Copy(ioutil.Discard, str)
+			default:
+				str.CancelRead(quic.ErrorCode(errorStreamCreationError))
+			}
+		}(str)
+	}
+}
+
+func handleControlStream(sess quic.Session, r io.Reader, handleControlFrame func(frame) error) {
+	f, err := parseNextFrame(r)
+	if err != nil {
+		closeWithControlStreamError(sess, err)
+		return
+	}
+	settings, ok := f.(*settingsFrame)
+	if !ok {
+		sess.CloseWithError(quic.ErrorCode(errorMissingSettings), errors.New("expected a SETTINGS frame"))
+		return
+	}
+	for id := range settings.Settings {
+		// setting identifiers reserved for HTTP/2 settings
+		if id == 0x2 || id == 0x3 || id == 0x4 || id == 0x5 {
+			sess.CloseWithError(quic.ErrorCode(errorSettingsError), fmt.Errorf("received HTTP/2 setting %#x", id))
+			return
+		}
+	}
+	for {
+		f, err := parseNextFrame(r)
+		if err != nil {
+			closeWithControlStreamError(sess, err)
+			return
+		}
+		switch f.(type) {
+		case *settingsFrame, *dataFrame, *headersFrame, *pushPromiseFrame:
+			sess.CloseWithError(quic.ErrorCode(errorFrameUnexpected), fmt.Errorf("unexpected frame on the control stream: %T", f))
+			return
+		}
+		if handleControlFrame == nil {
+			continue
+		}
+		if err := handleControlFrame(f); err != nil {
+			sess.CloseWithError(quic.ErrorCode(errorFrameUnexpected), err)
+			return
+		}
+	}
+}
+
+func closeWithControlStreamError(sess quic.Session, err error) {
+	if sess.Context().Err() != nil { // the session is already closed
+		return
+	}
+	if err == io.EOF {
+		sess.CloseWithError(quic.ErrorCode(errorClosedCriticalStream), errors.New("control stream closed"))
+		return
+	}
+	if _, ok := err.(quic.StreamError); ok {
+		sess.CloseWithError(quic.ErrorCode(errorClosedCriticalStream), err)
+		return
+	}
+	sess.CloseWithError(quic.ErrorCode(errorFrameError), err)
+}
@@ -0,0 +1,221 @@
+package h2quic
+
+import (
+	"errors"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection", func() {
+	var session *mockSession
+
+	BeforeEach(func() {
+		session = newMockSession()
+	})
+
+	AfterEach(func() {
+		session.Close()
+	})
+
+	It("opens the control stream", func() {
+		_, err := openControlStream(session)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+		Expect(session.getOpenedUniStreams()[0].dataWritten.Bytes()).To(Equal([]byte{streamTypeControlStream, 0x4, 0x0}))
+	})
+
+	It("errors when opening the control stream fails", func() {
+		testErr := errors.New("test error")
+		session.streamOpenErr = testErr
+		_, err := openControlStream(session)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	Context("handling unidirectional streams", func() {
+		var (
+			mutex          sync.Mutex
+			receivedFrames []frame
+		)
+
+		handleControlFrame := func(f frame) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			receivedFrames = append(receivedFrames, f)
+			return nil
+		}
+
+		getReceivedFrames := func() []frame {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return receivedFrames
+		}
+
+		newControlStream := func(id protocol.StreamID) *mockStream {
+			str := newMockStream(id)
+			utils.WriteVarInt(&str.dataToRead, streamTypeControlStream)
+			return str
+		}
+
+		getCloseErrorCode := func() quic.ErrorCode {
+			code, _ := session.getCloseError()
+			return code
+		}
+
+		BeforeEach(func() {
+			receivedFrames = nil
+		})
+
+		It("passes frames received on the control stream to the callback", func() {
+			str := newControlStream(3)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			(&goAwayFrame{StreamID: 4}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(getReceivedFrames).Should(Equal([]frame{&goAwayFrame{StreamID: 4}}))
+			Expect(session.isClosed()).To(BeFalse())
+		})
+
+		It("closes the session if the control stream doesn't start with a SETTINGS frame", func() {
+			str := newControlStream(3)
+			(&goAwayFrame{StreamID: 4}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorMissingSettings)))
+			Expect(getReceivedFrames()).To(BeEmpty())
+		})
+
+		It("closes the session when receiving a second SETTINGS frame", func() {
+			str := newControlStream(3)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+		})
+
+		It("closes the session when receiving a DATA frame on the control stream", func() {
+			str := newControlStream(3)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			(&dataFrame{}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+		})
+
+		It("closes the session when receiving a PUSH_PROMISE frame on the control stream", func() {
+			str := newControlStream(3)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			(&pushPromiseFrame{PushID: 1}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+		})
+
+		It("closes the session when receiving HTTP/2 settings", func() {
+			str := newControlStream(3)
+			(&settingsFrame{Settings: map[uint64]uint64{0x4: 100}}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorSettingsError)))
+		})
+
+		It("closes the session if the callback returns an error", func() {
+			str := newControlStream(3)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			(&goAwayFrame{StreamID: 4}).Write(&str.dataToRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, func(frame) error { return errors.New("invalid frame") }, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			code, err := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+			Expect(err).To(MatchError("invalid frame"))
+		})
+
+		It("closes the session if the control stream is closed", func() {
+			str := newControlStream(3)
+			(&settingsFrame{}).Write(&str.dataToRead)
+			close(str.unblockRead)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorClosedCriticalStream)))
+		})
+
+		It("closes the session if the peer opens a second control stream", func() {
+			str1 := newControlStream(3)
+			(&settingsFrame{}).Write(&str1.dataToRead)
+			str2 := newControlStream(7)
+			session.uniStreamsToAccept <- str1
+			session.uniStreamsToAccept <- str2
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorStreamCreationError)))
+		})
+
+		It("closes the session if the server opens a push stream, but push is disabled", func() {
+			str := newMockStream(3)
+			utils.WriteVarInt(&str.dataToRead, streamTypePushStream)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorIDError)))
+		})
+
+		It("passes push streams to the callback", func() {
+			str := newMockStream(3)
+			utils.WriteVarInt(&str.dataToRead, streamTypePushStream)
+			utils.WriteVarInt(&str.dataToRead, 1337)
+			str.dataToRead.Write([]byte("foobar"))
+			session.uniStreamsToAccept <- str
+			type pushStream struct {
+				pushID uint64
+				str    quic.ReceiveStream
+			}
+			pushStreams := make(chan pushStream, 1)
+			handlePushStream := func(pushID uint64, str quic.ReceiveStream) {
+				pushStreams <- pushStream{pushID: pushID, str: str}
+			}
+			go handleUnidirectionalStreams(session, true, handleControlFrame, handlePushStream, utils.DefaultLogger)
+			var ps pushStream
+			Eventually(pushStreams).Should(Receive(&ps))
+			Expect(ps.pushID).To(BeEquivalentTo(1337))
+			Expect(ps.str).To(Equal(str))
+			Expect(str.dataToRead.Bytes()).To(Equal([]byte("foobar")))
+			Expect(session.isClosed()).To(BeFalse())
+		})
+
+		It("closes the session if the client opens a push stream", func() {
+			str := newMockStream(2)
+			utils.WriteVarInt(&str.dataToRead, streamTypePushStream)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, false, nil, nil, utils.DefaultLogger)
+			Eventually(session.isClosed).Should(BeTrue())
+			Expect(getCloseErrorCode()).To(Equal(quic.ErrorCode(errorStreamCreationError)))
+		})
+
+		It("stops reading streams of unknown type", func() {
+			str := newMockStream(3)
+			utils.WriteVarInt(&str.dataToRead, 0x21)
+			session.uniStreamsToAccept <- str
+			go handleUnidirectionalStreams(session, true, handleControlFrame, nil, utils.DefaultLogger)
+			Eventually(func() bool {
+				str.mutex.Lock()
+				defer str.mutex.Unlock()
+				return str.reset
+			}).Should(BeTrue())
+			Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorStreamCreationError)))
+			Expect(session.isClosed()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,42 @@
+package h2quic
+
+import (
+	"fmt"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A RequestRejectedError is returned by RoundTrip if the server rejected the request stream (H3_REQUEST_REJECTED),
+// for example because it is shutting down.
+// The server didn't process the request, so it is safe to retry it.
+type RequestRejectedError struct {
+	StreamID quic.StreamID
+}
+
+func (e *RequestRejectedError) Error() string {
+	return fmt.Sprintf("h2quic: server rejected the request on stream %d", e.StreamID)
+}
+
+// A StreamResetError is returned by RoundTrip and by the response body if the server reset the request stream.
+type StreamResetError struct {
+	StreamID  quic.StreamID
+	ErrorCode quic.ErrorCode
+}
+
+func (e *StreamResetError) Error() string {
+	return fmt.Sprintf("h2quic: server reset stream %d: %s", e.StreamID, errorCode(e.ErrorCode))
+}
+
+// streamError converts a stream error caused by the peer resetting the stream
+// to a *RequestRejectedError or a *StreamResetError.
+// All other errors are returned unchanged.
+func streamError(id quic.StreamID, err error) error {
+	serr, ok := err.(quic.StreamError)
+	if !ok || !serr.Canceled() {
+		return err
+	}
+	if errorCode(serr.ErrorCode()) == errorRequestRejected {
+		return &RequestRejectedError{StreamID: id}
+	}
+	return &StreamResetError{StreamID: id, ErrorCode: serr.ErrorCode()}
+}
@@ -0,0 +1,277 @@
+package h2quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
+)
+
+// HTTP/3 frame types, see RFC 9114, section 7.2
+const (
+	frameTypeData        = 0x0
+	frameTypeHeaders     = 0x1
+	frameTypeCancelPush  = 0x3
+	frameTypeSettings    = 0x4
+	frameTypePushPromise = 0x5
+	frameTypeGoAway      = 0x7
+	frameTypeMaxPushID   = 0xd
+)
+
+// the maximum size of a SETTINGS frame we accept
+const maxSettingsFrameSize = 8 * 1024
+
+type byteReader interface {
+	io.ByteReader
+	io.Reader
+}
+
+type byteReaderImpl struct{ io.Reader }
+
+func (br *byteReaderImpl) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(br.Reader, b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+type frame interface{}
+
+// parseNextFrame parses the next HTTP/3 frame.
+// For DATA, HEADERS and PUSH_PROMISE frames, only the frame header (and the push ID) is consumed,
+// the payload has to be read by the caller.
+// Frames of unknown types are skipped.
+func parseNextFrame(r io.Reader) (frame, error) {
+	br, ok := r.(byteReader)
+	if !ok {
+		br = &byteReaderImpl{r}
+	}
+	for {
+		t, err := utils.ReadVarInt(br)
+		if err != nil {
+			return nil, err
+		}
+		l, err := utils.ReadVarInt(br)
+		if err != nil {
+			return nil, err
+		}
+
+		switch t {
+		case frameTypeData:
+			return &dataFrame{Length: l}, nil
+		case frameTypeHeaders:
+			return &headersFrame{Length: l}, nil
+		case frameTypeCancelPush:
+			return parseCancelPushFrame(br, l)
+		case frameTypeSettings:
+			return parseSettingsFrame(br, l)
+		case frameTypePushPromise:
+			return parsePushPromiseFrame(br, l)
+		case frameTypeGoAway:
+			return parseGoAwayFrame(br, l)
+		case frameTypeMaxPushID:
+			return parseMaxPushIDFrame(br, l)
+		case 0x2, 0x6, 0x8, 0x9: // frame types reserved for HTTP/2 frames
+			return nil, fmt.Errorf("received reserved HTTP/2 frame type %#x", t)
+		}
+		// skip over unknown frames
+		if _, err := io.CopyN(ioutil.Discard, br, int64(l)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type dataFrame struct {
+	Length uint64
+}
+
+func (f *dataFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeData)
+	utils.WriteVarInt(b, f.Length)
+}
+
+type headersFrame struct {
+	Length uint64
+}
+
+func (f *headersFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeHeaders)
+	utils.WriteVarInt(b, f.Length)
+}
+
+// A settingsFrame is a SETTINGS frame.
+// The map contains the setting identifiers and their values.
+type settingsFrame struct {
+	Settings map[uint64]uint64
+}
+
+func parseSettingsFrame(r io.Reader, l uint64) (*settingsFrame, error) {
+	if l > maxSettingsFrameSize {
+		return nil, fmt.Errorf("unexpected size for SETTINGS frame: %d", l)
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	frame := &settingsFrame{Settings: make(map[uint64]uint64)}
+	b := bytes.NewReader(buf)
+	for b.Len() > 0 {
+		id, err := utils.ReadVarInt(b)
+		if err != nil { // should not happen. We allocated the whole frame already.
+			return nil, err
+		}
+		val, err := utils.ReadVarInt(b)
+		if err != nil { // should not happen. We allocated the whole frame already.
+			return nil, err
+		}
+		if _, ok := frame.Settings[id]; ok {
+			return nil, fmt.Errorf("duplicate setting: %d", id)
+		}
+		frame.Settings[id] = val
+	}
+	return frame, nil
+}
+
+func (f *settingsFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeSettings)
+	var l protocol.ByteCount
+	for id, val := range f.Settings {
+		l += utils.VarIntLen(id) + utils.VarIntLen(val)
+	}
+	utils.WriteVarInt(b, uint64(l))
+	for id, val := range f.Settings {
+		utils.WriteVarInt(b, id)
+		utils.WriteVarInt(b, val)
+	}
+}
+
+// A goAwayFrame is a GOAWAY frame.
+// When sent by the server, it contains the first request stream ID that won't be processed.
+type goAwayFrame struct {
+	StreamID protocol.StreamID
+}
+
+func parseGoAwayFrame(r byteReader, l uint64) (*goAwayFrame, error) {
+	id, err := parseVarIntFrame(r, l, "GOAWAY")
+	if err != nil {
+		return nil, err
+	}
+	return &goAwayFrame{StreamID: protocol.StreamID(id)}, nil
+}
+
+func (f *goAwayFrame) Write(b *bytes.Buffer) {
+	writeVarIntFrame(b, frameTypeGoAway, uint64(f.StreamID))
+}
+
+// A pushPromiseFrame is a PUSH_PROMISE frame.
+// Length is the length of the encoded field section that follows the push ID.
+type pushPromiseFrame struct {
+	PushID uint64
+	Length uint64
+}
+
+func parsePushPromiseFrame(r byteReader, l uint64) (*pushPromiseFrame, error) {
+	cr := &countingByteReader{byteReader: r}
+	id, err := utils.ReadVarInt(cr)
+	if err != nil {
+		return nil, err
+	}
+	if cr.read > l {
+		return nil, errors.New("PUSH_PROMISE frame: inconsistent length")
+	}
+	return &pushPromiseFrame{PushID: id, Length: l - cr.read}, nil
+}
+
+func (f *pushPromiseFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypePushPromise)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(f.PushID))+f.Length)
+	utils.WriteVarInt(b, f.PushID)
+}
+
+// A cancelPushFrame is a CANCEL_PUSH frame.
+type cancelPushFrame struct {
+	PushID uint64
+}
+
+func parseCancelPushFrame(r byteReader, l uint64) (*cancelPushFrame, error) {
+	id, err := parseVarIntFrame(r, l, "CANCEL_PUSH")
+	if err != nil {
+		return nil, err
+	}
+	return &cancelPushFrame{PushID: id}, nil
+}
+
+func (f *cancelPushFrame) Write(b *bytes.Buffer) {
+	writeVarIntFrame(b, frameTypeCancelPush, f.PushID)
+}
+
+// A maxPushIDFrame is a MAX_PUSH_ID frame.
+type maxPushIDFrame struct {
+	PushID uint64
+}
+
+func parseMaxPushIDFrame(r byteReader, l uint64) (*maxPushIDFrame, error) {
+	id, err := parseVarIntFrame(r, l, "MAX_PUSH_ID")
+	if err != nil {
+		return nil, err
+	}
+	return &maxPushIDFrame{PushID: id}, nil
+}
+
+func (f *maxPushIDFrame) Write(b *bytes.Buffer) {
+	writeVarIntFrame(b, frameTypeMaxPushID, f.PushID)
+}
+
+// parseVarIntFrame parses the payload of a frame that consists of a single variable-length integer.
+func parseVarIntFrame(r byteReader, l uint64, name string) (uint64, error) {
+	cr := &countingByteReader{byteReader: r}
+	val, err := utils.ReadVarInt(cr)
+	if err != nil {
+		return 0, err
+	}
+	if cr.read != l {
+		return 0, fmt.Errorf("%s frame: inconsistent length", name)
+	}
+	return val, nil
+}
+
+func writeVarIntFrame(b *bytes.Buffer, frameType, val uint64) {
+	utils.WriteVarInt(b, frameType)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(val)))
+	utils.WriteVarInt(b, val)
+}
+
+type countingByteReader struct {
+	byteReader
+	read uint64
+}
+
+func (r *countingByteReader) ReadByte() (byte, error) {
+	b, err := r.byteReader.ReadByte()
+	if err == nil {
+		r.read++
+	}
+	return b, err
+}
+
+// writeHeadersFrame encodes the header fields and writes them in a single HEADERS frame.
+func writeHeadersFrame(w io.Writer, encoder *qpack.Encoder, streamID protocol.StreamID, fields []qpack.HeaderField) error {
+	headerBlock, err := encoder.EncodeFieldSection(uint64(streamID), fields)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(len(headerBlock))}).Write(buf)
+	buf.Write(headerBlock)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,260 @@
+package h2quic
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frames", func() {
+	appendVarInt := func(b []byte, i uint64) []byte {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, i)
+		return append(b, buf.Bytes()...)
+	}
+
+	It("skips unknown frame types", func() {
+		data := appendVarInt(nil, 0xdeadbeef) // type byte
+		data = appendVarInt(data, 0x42)
+		data = append(data, make([]byte, 0x42)...)
+		buf := bytes.NewBuffer(data)
+		(&dataFrame{Length: 0x1234}).Write(buf)
+		frame, err := parseNextFrame(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(&dataFrame{Length: 0x1234}))
+	})
+
+	It("errors on reserved HTTP/2 frame types", func() {
+		data := appendVarInt(nil, 0x6) // PING
+		data = appendVarInt(data, 0)
+		_, err := parseNextFrame(bytes.NewReader(data))
+		Expect(err).To(MatchError("received reserved HTTP/2 frame type 0x6"))
+	})
+
+	It("returns io.EOF at the end of the stream", func() {
+		_, err := parseNextFrame(bytes.NewReader(nil))
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	Context("DATA frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 0) // type byte
+			data = appendVarInt(data, 0x1337)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&dataFrame{Length: 0x1337}))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&dataFrame{Length: 0xdeadbeef}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&dataFrame{Length: 0xdeadbeef}))
+		})
+	})
+
+	Context("HEADERS frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 1) // type byte
+			data = appendVarInt(data, 0x1337)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&headersFrame{Length: 0x1337}))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&headersFrame{Length: 0xdeadbeef}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&headersFrame{Length: 0xdeadbeef}))
+		})
+
+		It("writes the header fields", func() {
+			buf := &bytes.Buffer{}
+			Expect(writeHeadersFrame(buf, qpack.NewEncoder(nil, 0), 0, []qpack.HeaderField{{Name: ":status", Value: "200"}})).To(Succeed())
+			Expect(decodeHeader(buf)).To(Equal(map[string][]string{":status": {"200"}}))
+			Expect(buf.Len()).To(BeZero())
+		})
+	})
+
+	Context("SETTINGS frames", func() {
+		It("parses", func() {
+			settings := appendVarInt(nil, 13)
+			settings = appendVarInt(settings, 37)
+			settings = appendVarInt(settings, 0xdead)
+			settings = appendVarInt(settings, 0xbeef)
+			data := appendVarInt(nil, 4) // type byte
+			data = appendVarInt(data, uint64(len(settings)))
+			data = append(data, settings...)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&settingsFrame{Settings: map[uint64]uint64{13: 37, 0xdead: 0xbeef}}))
+		})
+
+		It("rejects duplicate settings", func() {
+			settings := appendVarInt(nil, 13)
+			settings = appendVarInt(settings, 37)
+			settings = appendVarInt(settings, 13)
+			settings = appendVarInt(settings, 38)
+			data := appendVarInt(nil, 4) // type byte
+			data = appendVarInt(data, uint64(len(settings)))
+			data = append(data, settings...)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("duplicate setting: 13"))
+		})
+
+		It("rejects SETTINGS frames that are too large", func() {
+			data := appendVarInt(nil, 4) // type byte
+			data = appendVarInt(data, maxSettingsFrameSize+1)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("unexpected size for SETTINGS frame: 8193"))
+		})
+
+		It("errors on EOF", func() {
+			settings := appendVarInt(nil, 13)
+			settings = appendVarInt(settings, 37)
+			data := appendVarInt(nil, 4) // type byte
+			data = appendVarInt(data, uint64(len(settings)))
+			data = append(data, settings...)
+			for i := range data {
+				_, err := parseNextFrame(bytes.NewReader(data[:i]))
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
+		It("writes", func() {
+			sf := &settingsFrame{Settings: map[uint64]uint64{1: 2, 99: 999, 13: 37}}
+			buf := &bytes.Buffer{}
+			sf.Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(sf))
+		})
+
+		It("writes empty SETTINGS frames", func() {
+			buf := &bytes.Buffer{}
+			(&settingsFrame{}).Write(buf)
+			Expect(buf.Bytes()).To(Equal([]byte{0x4, 0x0}))
+		})
+	})
+
+	Context("GOAWAY frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 7) // type byte
+			data = appendVarInt(data, uint64(utils.VarIntLen(100)))
+			data = appendVarInt(data, 100)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&goAwayFrame{StreamID: 100}))
+		})
+
+		It("errors if the length doesn't match", func() {
+			data := appendVarInt(nil, 7) // type byte
+			data = appendVarInt(data, 3)
+			data = appendVarInt(data, 100)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("GOAWAY frame: inconsistent length"))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&goAwayFrame{StreamID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&goAwayFrame{StreamID: 0x1337}))
+		})
+	})
+
+	Context("PUSH_PROMISE frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 5) // type byte
+			data = appendVarInt(data, uint64(utils.VarIntLen(1337))+6)
+			data = appendVarInt(data, 1337)
+			data = append(data, []byte("foobar")...)
+			r := bytes.NewReader(data)
+			frame, err := parseNextFrame(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&pushPromiseFrame{PushID: 1337, Length: 6}))
+			Expect(r.Len()).To(Equal(6))
+		})
+
+		It("errors if the length doesn't match", func() {
+			data := appendVarInt(nil, 5) // type byte
+			data = appendVarInt(data, 1)
+			data = appendVarInt(data, 1337)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("PUSH_PROMISE frame: inconsistent length"))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&pushPromiseFrame{PushID: 1337, Length: 6}).Write(buf)
+			buf.Write([]byte("foobar"))
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&pushPromiseFrame{PushID: 1337, Length: 6}))
+			Expect(buf.Bytes()).To(Equal([]byte("foobar")))
+		})
+	})
+
+	Context("CANCEL_PUSH frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 3) // type byte
+			data = appendVarInt(data, uint64(utils.VarIntLen(42)))
+			data = appendVarInt(data, 42)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&cancelPushFrame{PushID: 42}))
+		})
+
+		It("errors if the length doesn't match", func() {
+			data := appendVarInt(nil, 3) // type byte
+			data = appendVarInt(data, 2)
+			data = appendVarInt(data, 42)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("CANCEL_PUSH frame: inconsistent length"))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&cancelPushFrame{PushID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&cancelPushFrame{PushID: 0x1337}))
+		})
+	})
+
+	Context("MAX_PUSH_ID frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 0xd) // type byte
+			data = appendVarInt(data, uint64(utils.VarIntLen(1000)))
+			data = appendVarInt(data, 1000)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&maxPushIDFrame{PushID: 1000}))
+		})
+
+		It("errors if the length doesn't match", func() {
+			data := appendVarInt(nil, 0xd) // type byte
+			data = appendVarInt(data, 1)
+			data = appendVarInt(data, 1000)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("MAX_PUSH_ID frame: inconsistent length"))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&maxPushIDFrame{PushID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&maxPushIDFrame{PushID: 0x1337}))
+		})
+	})
+})
@@ -0,0 +1,17 @@
+package h2quic
+
+// A requestError is an error that occurred while handling a request.
+// Depending on the error, either the request stream is reset, or the connection is closed.
+type requestError struct {
+	err       error
+	streamErr errorCode
+	connErr   errorCode
+}
+
+func newStreamError(code errorCode, err error) requestError {
+	return requestError{err: err, streamErr: code}
+}
+
+func newConnError(code errorCode, err error) requestError {
+	return requestError{err: err, connErr: code}
+}
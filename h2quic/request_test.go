@@ -4,7 +4,7 @@ import (
 	"net/http"
 	"net/url"
 
-	"golang.org/x/net/http2/hpack"
+	"github.com/lucas-clemente/quic-go/qpack"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -12,7 +12,7 @@ import (
 
 var _ = Describe("Request", func() {
 	It("populates request", func() {
-		headers := []hpack.HeaderField{
+		headers := []qpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
 			{Name: ":authority", Value: "quic.clemente.io"},
 			{Name: ":method", Value: "GET"},
@@ -22,8 +22,8 @@ var _ = Describe("Request", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(req.Method).To(Equal("GET"))
 		Expect(req.URL.Path).To(Equal("/foo"))
-		Expect(req.Proto).To(Equal("HTTP/2.0"))
-		Expect(req.ProtoMajor).To(Equal(2))
+		Expect(req.Proto).To(Equal("HTTP/3.0"))
+		Expect(req.ProtoMajor).To(Equal(3))
 		Expect(req.ProtoMinor).To(Equal(0))
 		Expect(req.ContentLength).To(Equal(int64(42)))
 		Expect(req.Header).To(BeEmpty())
@@ -34,7 +34,7 @@ var _ = Describe("Request", func() {
 	})
 
 	It("concatenates the cookie headers", func() {
-		headers := []hpack.HeaderField{
+		headers := []qpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
 			{Name: ":authority", Value: "quic.clemente.io"},
 			{Name: ":method", Value: "GET"},
@@ -49,7 +49,7 @@ var _ = Describe("Request", func() {
 	})
 
 	It("handles other headers", func() {
-		headers := []hpack.HeaderField{
+		headers := []qpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
 			{Name: ":authority", Value: "quic.clemente.io"},
 			{Name: ":method", Value: "GET"},
@@ -66,7 +66,7 @@ var _ = Describe("Request", func() {
 	})
 
 	It("errors with missing path", func() {
-		headers := []hpack.HeaderField{
+		headers := []qpack.HeaderField{
 			{Name: ":authority", Value: "quic.clemente.io"},
 			{Name: ":method", Value: "GET"},
 		}
@@ -75,7 +75,7 @@ var _ = Describe("Request", func() {
 	})
 
 	It("errors with missing method", func() {
-		headers := []hpack.HeaderField{
+		headers := []qpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
 			{Name: ":authority", Value: "quic.clemente.io"},
 		}
@@ -84,7 +84,7 @@ var _ = Describe("Request", func() {
 	})
 
 	It("errors with missing authority", func() {
-		headers := []hpack.HeaderField{
+		headers := []qpack.HeaderField{
 			{Name: ":path", Value: "/foo"},
 			{Name: ":method", Value: "GET"},
 		}
@@ -1,65 +1,47 @@
 package h2quic
 
 import (
-	"bytes"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 
 	"golang.org/x/net/http/httpguts"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
 
 	quic "github.com/lucas-clemente/quic-go"
-	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
 )
 
 type requestWriter struct {
-	mutex        sync.Mutex
-	headerStream quic.Stream
-
-	henc *hpack.Encoder
-	hbuf bytes.Buffer // HPACK encoder writes into this
-
-	logger utils.Logger
+	encoder *qpack.Encoder
+	logger  utils.Logger
 }
 
 const defaultUserAgent = "quic-go"
 
-func newRequestWriter(headerStream quic.Stream, logger utils.Logger) *requestWriter {
-	rw := &requestWriter{
-		headerStream: headerStream,
-		logger:       logger,
-	}
-	rw.henc = hpack.NewEncoder(&rw.hbuf)
-	return rw
+func newRequestWriter(encoder *qpack.Encoder, logger utils.Logger) *requestWriter {
+	return &requestWriter{encoder: encoder, logger: logger}
 }
 
-func (w *requestWriter) WriteRequest(req *http.Request, dataStreamID protocol.StreamID, endStream, requestGzip bool) error {
+// WriteRequest writes the HEADERS frame of the request to the request stream.
+// The request body is sent by the caller.
+func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, requestGzip bool) error {
 	// TODO: add support for trailers
-	// TODO: add support for gzip compression
-	// TODO: write continuation frames, if the header frame is too long
-
-	w.mutex.Lock()
-	defer w.mutex.Unlock()
-
-	w.encodeHeaders(req, requestGzip, "", actualContentLength(req))
-	h2framer := http2.NewFramer(w.headerStream, nil)
-	return h2framer.WriteHeaders(http2.HeadersFrameParam{
-		StreamID:      uint32(dataStreamID),
-		EndHeaders:    true,
-		EndStream:     endStream,
-		BlockFragment: w.hbuf.Bytes(),
-		Priority:      http2.PriorityParam{Weight: 0xff},
-	})
+	fields, err := w.encodeHeaders(req, requestGzip, "", actualContentLength(req))
+	if err != nil {
+		return err
+	}
+	return writeHeadersFrame(str, w.encoder, str.StreamID(), fields)
 }
 
 // the rest of this files is copied from http2.Transport
-func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) ([]byte, error) {
-	w.hbuf.Reset()
+func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) ([]qpack.HeaderField, error) {
+	var fields []qpack.HeaderField
+	writeHeader := func(name, value string) {
+		w.logger.Debugf("http3: Transport encoding header %q = %q", name, value)
+		fields = append(fields, qpack.HeaderField{Name: name, Value: value})
+	}
 
 	host := req.Host
 	if host == "" {
@@ -86,8 +68,7 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	}
 
 	// Check for any invalid headers and return an error before we
-	// potentially pollute our hpack state. (We want to be able to
-	// continue to reuse the hpack encoder for future requests)
+	// encode any of them.
 	for k, vv := range req.Header {
 		if !httpguts.ValidHeaderFieldName(k) {
 			return nil, fmt.Errorf("invalid HTTP header name %q", k)
@@ -104,14 +85,14 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	// target URI (the path-absolute production and optionally a '?' character
 	// followed by the query production (see Sections 3.3 and 3.4 of
 	// [RFC3986]).
-	w.writeHeader(":authority", host)
-	w.writeHeader(":method", req.Method)
+	writeHeader(":authority", host)
+	writeHeader(":method", req.Method)
 	if req.Method != "CONNECT" {
-		w.writeHeader(":path", path)
-		w.writeHeader(":scheme", req.URL.Scheme)
+		writeHeader(":path", path)
+		writeHeader(":scheme", req.URL.Scheme)
 	}
 	if trailers != "" {
-		w.writeHeader("trailer", trailers)
+		writeHeader("trailer", trailers)
 	}
 
 	var didUA bool
@@ -143,24 +124,19 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 			}
 		}
 		for _, v := range vv {
-			w.writeHeader(lowKey, v)
+			writeHeader(lowKey, v)
 		}
 	}
 	if shouldSendReqContentLength(req.Method, contentLength) {
-		w.writeHeader("content-length", strconv.FormatInt(contentLength, 10))
+		writeHeader("content-length", strconv.FormatInt(contentLength, 10))
 	}
 	if addGzipHeader {
-		w.writeHeader("accept-encoding", "gzip")
+		writeHeader("accept-encoding", "gzip")
 	}
 	if !didUA {
-		w.writeHeader("user-agent", defaultUserAgent)
+		writeHeader("user-agent", defaultUserAgent)
 	}
-	return w.hbuf.Bytes(), nil
-}
-
-func (w *requestWriter) writeHeader(name, value string) {
-	w.logger.Debugf("http2: Transport encoding header %q = %q", name, value)
-	w.henc.WriteField(hpack.HeaderField{Name: name, Value: value})
+	return fields, nil
 }
 
 // shouldSendReqContentLength reports whether the http2.Transport should send
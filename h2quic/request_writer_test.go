@@ -1,83 +1,47 @@
 package h2quic
 
 import (
-	"bytes"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
-
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Request", func() {
 	var (
-		rw           *requestWriter
-		headerStream *mockStream
-		decoder      *hpack.Decoder
+		rw  *requestWriter
+		str *mockStream
 	)
 
 	BeforeEach(func() {
-		headerStream = &mockStream{}
-		rw = newRequestWriter(headerStream, utils.DefaultLogger)
-		decoder = hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
+		str = &mockStream{}
+		rw = newRequestWriter(qpack.NewEncoder(nil, 0), utils.DefaultLogger)
 	})
 
-	decode := func(p []byte) (*http2.HeadersFrame, map[string] /* HeaderField.Name */ string /* HeaderField.Value */) {
-		framer := http2.NewFramer(nil, bytes.NewReader(p))
-		frame, err := framer.ReadFrame()
-		Expect(err).ToNot(HaveOccurred())
-		headerFrame := frame.(*http2.HeadersFrame)
-		fields, err := decoder.DecodeFull(headerFrame.HeaderBlockFragment())
-		Expect(err).ToNot(HaveOccurred())
-		values := make(map[string]string)
-		for _, headerField := range fields {
-			values[headerField.Name] = headerField.Value
-		}
-		return headerFrame, values
-	}
-
 	It("writes a GET request", func() {
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
 		Expect(err).ToNot(HaveOccurred())
-		rw.WriteRequest(req, 1337, true, false)
-		headerFrame, headerFields := decode(headerStream.dataWritten.Bytes())
-		Expect(headerFrame.StreamID).To(Equal(uint32(1337)))
-		Expect(headerFrame.HasPriority()).To(BeTrue())
-		Expect(headerFields).To(HaveKeyWithValue(":authority", "quic.clemente.io"))
-		Expect(headerFields).To(HaveKeyWithValue(":method", "GET"))
-		Expect(headerFields).To(HaveKeyWithValue(":path", "/index.html?foo=bar"))
-		Expect(headerFields).To(HaveKeyWithValue(":scheme", "https"))
+		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		headerFields := decodeHeader(&str.dataWritten)
+		Expect(headerFields).To(HaveKeyWithValue(":authority", []string{"quic.clemente.io"}))
+		Expect(headerFields).To(HaveKeyWithValue(":method", []string{"GET"}))
+		Expect(headerFields).To(HaveKeyWithValue(":path", []string{"/index.html?foo=bar"}))
+		Expect(headerFields).To(HaveKeyWithValue(":scheme", []string{"https"}))
 		Expect(headerFields).ToNot(HaveKey("accept-encoding"))
-	})
-
-	It("sets the EndStream header", func() {
-		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
-		Expect(err).ToNot(HaveOccurred())
-		rw.WriteRequest(req, 1337, true, false)
-		headerFrame, _ := decode(headerStream.dataWritten.Bytes())
-		Expect(headerFrame.StreamEnded()).To(BeTrue())
-	})
-
-	It("doesn't set the EndStream header, if requested", func() {
-		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
-		Expect(err).ToNot(HaveOccurred())
-		rw.WriteRequest(req, 1337, false, false)
-		headerFrame, _ := decode(headerStream.dataWritten.Bytes())
-		Expect(headerFrame.StreamEnded()).To(BeFalse())
+		Expect(str.dataWritten.Len()).To(BeZero())
 	})
 
 	It("requests gzip compression, if requested", func() {
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
 		Expect(err).ToNot(HaveOccurred())
-		rw.WriteRequest(req, 1337, true, true)
-		_, headerFields := decode(headerStream.dataWritten.Bytes())
-		Expect(headerFields).To(HaveKeyWithValue("accept-encoding", "gzip"))
+		Expect(rw.WriteRequest(str, req, true)).To(Succeed())
+		headerFields := decodeHeader(&str.dataWritten)
+		Expect(headerFields).To(HaveKeyWithValue("accept-encoding", []string{"gzip"}))
 	})
 
 	It("writes a POST request", func() {
@@ -85,11 +49,11 @@ var _ = Describe("Request", func() {
 		form.Add("foo", "bar")
 		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", strings.NewReader(form.Encode()))
 		Expect(err).ToNot(HaveOccurred())
-		rw.WriteRequest(req, 5, true, false)
-		_, headerFields := decode(headerStream.dataWritten.Bytes())
-		Expect(headerFields).To(HaveKeyWithValue(":method", "POST"))
+		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		headerFields := decodeHeader(&str.dataWritten)
+		Expect(headerFields).To(HaveKeyWithValue(":method", []string{"POST"}))
 		Expect(headerFields).To(HaveKey("content-length"))
-		contentLength, err := strconv.Atoi(headerFields["content-length"])
+		contentLength, err := strconv.Atoi(headerFields["content-length"][0])
 		Expect(err).ToNot(HaveOccurred())
 		Expect(contentLength).To(BeNumerically(">", 0))
 	})
@@ -107,12 +71,20 @@ var _ = Describe("Request", func() {
 		}
 		req.AddCookie(cookie1)
 		req.AddCookie(cookie2)
-		rw.WriteRequest(req, 11, true, false)
-		_, headerFields := decode(headerStream.dataWritten.Bytes())
+		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		headerFields := decodeHeader(&str.dataWritten)
 		// TODO(lclemente): Remove Or() once we drop support for Go 1.8.
 		Expect(headerFields).To(Or(
-			HaveKeyWithValue("cookie", "Cookie #1=Value #1; Cookie #2=Value #2"),
-			HaveKeyWithValue("cookie", `Cookie #1="Value #1"; Cookie #2="Value #2"`),
+			HaveKeyWithValue("cookie", []string{"Cookie #1=Value #1; Cookie #2=Value #2"}),
+			HaveKeyWithValue("cookie", []string{`Cookie #1="Value #1"; Cookie #2="Value #2"`}),
 		))
 	})
+
+	It("rejects invalid header values", func() {
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add("foo", "bar\r\n")
+		Expect(rw.WriteRequest(str, req, false)).To(MatchError(`invalid HTTP header value "bar\r\n" for header "Foo"`))
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
 })
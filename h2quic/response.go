@@ -3,27 +3,34 @@ package h2quic
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/textproto"
 	"strconv"
 	"strings"
 
-	"golang.org/x/net/http2"
+	"github.com/lucas-clemente/quic-go/qpack"
 )
 
 // copied from net/http2/transport.go
 
-var errResponseHeaderListSize = errors.New("http2: response header list larger than advertised limit")
 var noBody = ioutil.NopCloser(bytes.NewReader(nil))
 
 // from the handleResponse function
-func responseFromHeaders(f *http2.MetaHeadersFrame) (*http.Response, error) {
-	if f.Truncated {
-		return nil, errResponseHeaderListSize
+func responseFromHeaders(headers []qpack.HeaderField) (*http.Response, error) {
+	var status string
+	var regularFields []qpack.HeaderField
+	for _, hf := range headers {
+		if !hf.IsPseudo() {
+			regularFields = append(regularFields, hf)
+			continue
+		}
+		if hf.Name != ":status" {
+			return nil, fmt.Errorf("invalid response pseudo header %q", hf.Name)
+		}
+		status = hf.Value
 	}
-
-	status := f.PseudoValue("status")
 	if status == "" {
 		return nil, errors.New("missing status pseudo header")
 	}
@@ -36,13 +43,13 @@ func responseFromHeaders(f *http2.MetaHeadersFrame) (*http.Response, error) {
 
 	header := make(http.Header)
 	res := &http.Response{
-		Proto:      "HTTP/2.0",
-		ProtoMajor: 2,
+		Proto:      "HTTP/3.0",
+		ProtoMajor: 3,
 		Header:     header,
 		StatusCode: statusCode,
 		Status:     status + " " + http.StatusText(statusCode),
 	}
-	for _, hf := range f.RegularFields() {
+	for _, hf := range regularFields {
 		key := http.CanonicalHeaderKey(hf.Name)
 		if key == "Trailer" {
 			t := res.Trailer
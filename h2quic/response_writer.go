@@ -1,47 +1,42 @@
 package h2quic
 
 import (
-	"bytes"
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 
 	quic "github.com/lucas-clemente/quic-go"
-	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
+	"github.com/lucas-clemente/quic-go/qpack"
 )
 
 type responseWriter struct {
-	dataStreamID protocol.StreamID
-	dataStream   quic.Stream
-
-	headerStream      quic.Stream
-	headerStreamMutex *sync.Mutex
+	stream     quic.SendStream
+	dataWriter *dataFrameWriter
+	encoder    *qpack.Encoder
+	// push implements http.Pusher. If nil, push is not supported.
+	push func(target string, opts *http.PushOptions) error
+	// ctx is canceled when the request is aborted. It is used for CloseNotify.
+	ctx context.Context
 
 	header        http.Header
 	status        int // status code passed to WriteHeader
 	headerWritten bool
 
+	closeNotifyChan chan bool
+
 	logger utils.Logger
 }
 
-func newResponseWriter(
-	headerStream quic.Stream,
-	headerStreamMutex *sync.Mutex,
-	dataStream quic.Stream,
-	dataStreamID protocol.StreamID,
-	logger utils.Logger,
-) *responseWriter {
+func newResponseWriter(stream quic.SendStream, encoder *qpack.Encoder, logger utils.Logger) *responseWriter {
 	return &responseWriter{
-		header:            http.Header{},
-		headerStream:      headerStream,
-		headerStreamMutex: headerStreamMutex,
-		dataStream:        dataStream,
-		dataStreamID:      dataStreamID,
-		logger:            logger,
+		header:     http.Header{},
+		stream:     stream,
+		dataWriter: &dataFrameWriter{w: stream},
+		encoder:    encoder,
+		ctx:        stream.Context(),
+		logger:     logger,
 	}
 }
 
@@ -56,27 +51,16 @@ func (w *responseWriter) WriteHeader(status int) {
 	w.headerWritten = true
 	w.status = status
 
-	var headers bytes.Buffer
-	enc := hpack.NewEncoder(&headers)
-	enc.WriteField(hpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
-
+	fields := []qpack.HeaderField{{Name: ":status", Value: strconv.Itoa(status)}}
 	for k, v := range w.header {
 		for index := range v {
-			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
+			fields = append(fields, qpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
 		}
 	}
 
 	w.logger.Infof("Responding with %d", status)
-	w.headerStreamMutex.Lock()
-	defer w.headerStreamMutex.Unlock()
-	h2framer := http2.NewFramer(w.headerStream, nil)
-	err := h2framer.WriteHeaders(http2.HeadersFrameParam{
-		StreamID:      uint32(w.dataStreamID),
-		EndHeaders:    true,
-		BlockFragment: headers.Bytes(),
-	})
-	if err != nil {
-		w.logger.Errorf("could not write h2 header: %s", err.Error())
+	if err := writeHeadersFrame(w.stream, w.encoder, w.stream.StreamID(), fields); err != nil {
+		w.logger.Errorf("could not write HEADERS frame: %s", err.Error())
 	}
 }
 
@@ -87,16 +71,38 @@ func (w *responseWriter) Write(p []byte) (int, error) {
 	if !bodyAllowedForStatus(w.status) {
 		return 0, http.ErrBodyNotAllowed
 	}
-	return w.dataStream.Write(p)
+	return w.dataWriter.Write(p)
 }
 
 func (w *responseWriter) Flush() {}
 
-// This is a NOP. Use http.Request.Context
-func (w *responseWriter) CloseNotify() <-chan bool { return make(<-chan bool) }
+// Push implements http.Pusher.
+// It returns http.ErrNotSupported if the client disabled push, and for pushed responses.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.push == nil {
+		return http.ErrNotSupported
+	}
+	return w.push(target, opts)
+}
+
+// CloseNotify returns a channel that receives a value when the client resets the stream, or when the connection is closed.
+// Use http.Request.Context instead.
+func (w *responseWriter) CloseNotify() <-chan bool {
+	if w.closeNotifyChan == nil {
+		c := make(chan bool, 1)
+		ctx := w.ctx
+		go func() {
+			<-ctx.Done()
+			c <- true
+		}()
+		w.closeNotifyChan = c
+	}
+	return w.closeNotifyChan
+}
 
-// test that we implement http.Flusher
+// test that we implement http.Flusher and http.Pusher
 var _ http.Flusher = &responseWriter{}
+var _ http.Pusher = &responseWriter{}
 
 // copied from http2/http2.go
 // bodyAllowedForStatus reports whether a given response status code
@@ -3,33 +3,39 @@ package h2quic
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
-
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 type mockStream struct {
-	id            protocol.StreamID
-	dataToRead    bytes.Buffer
-	dataWritten   bytes.Buffer
-	reset         bool
-	canceledWrite bool
-	closed        bool
-	remoteClosed  bool
-
-	unblockRead chan struct{}
-	ctx         context.Context
-	ctxCancel   context.CancelFunc
+	mutex sync.Mutex
+
+	id                protocol.StreamID
+	dataToRead        bytes.Buffer
+	dataWritten       bytes.Buffer
+	reset             bool
+	resetErrorCode    quic.ErrorCode
+	canceledWrite     bool
+	canceledErrorCode quic.ErrorCode
+	closed            bool
+	readErr           error // returned by Read once unblockRead is closed. Defaults to io.EOF.
+	writeErr          error // returned by Write
+
+	unblockRead   chan struct{}
+	ctx           context.Context
+	ctxCancel     context.CancelFunc
+	readCtx       context.Context
+	readCtxCancel context.CancelFunc
 }
 
 var _ quic.Stream = &mockStream{}
@@ -40,64 +46,138 @@ func newMockStream(id protocol.StreamID) *mockStream {
 		unblockRead: make(chan struct{}),
 	}
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.readCtx, s.readCtxCancel = context.WithCancel(context.Background())
 	return s
 }
 
-func (s *mockStream) Close() error                          { s.closed = true; s.ctxCancel(); return nil }
-func (s *mockStream) CancelRead(quic.ErrorCode) error       { s.reset = true; return nil }
-func (s *mockStream) CancelWrite(quic.ErrorCode) error      { s.canceledWrite = true; return nil }
-func (s *mockStream) CloseRemote(offset protocol.ByteCount) { s.remoteClosed = true; s.ctxCancel() }
-func (s mockStream) StreamID() protocol.StreamID            { return s.id }
-func (s *mockStream) Context() context.Context              { return s.ctx }
-func (s *mockStream) SetDeadline(time.Time) error           { panic("not implemented") }
-func (s *mockStream) SetReadDeadline(time.Time) error       { panic("not implemented") }
-func (s *mockStream) SetWriteDeadline(time.Time) error      { panic("not implemented") }
+func (s *mockStream) Close() error { s.closed = true; s.ctxCancel(); return nil }
+func (s *mockStream) CancelRead(code quic.ErrorCode) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.reset = true
+	s.resetErrorCode = code
+	if s.readCtxCancel != nil {
+		s.readCtxCancel()
+	}
+	return nil
+}
+func (s *mockStream) CancelWrite(code quic.ErrorCode) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.canceledWrite = true
+	s.canceledErrorCode = code
+	s.ctxCancel()
+	return nil
+}
+func (s *mockStream) isCanceledRead() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.reset
+}
+func (s *mockStream) isCanceledWrite() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.canceledWrite
+}
+func (s *mockStream) CancelWriteAt(quic.ErrorCode, uint64) error { s.canceledWrite = true; return nil }
+func (s *mockStream) StreamID() protocol.StreamID                { return s.id }
+func (s *mockStream) Context() context.Context                   { return s.ctx }
+func (s *mockStream) ReadContext() context.Context               { return s.readCtx }
+func (s *mockStream) SetDeadline(time.Time) error                { panic("not implemented") }
+func (s *mockStream) SetReadDeadline(time.Time) error            { panic("not implemented") }
+func (s *mockStream) SetWriteDeadline(time.Time) error           { panic("not implemented") }
 
 func (s *mockStream) Read(p []byte) (int, error) {
 	n, _ := s.dataToRead.Read(p)
 	if n == 0 { // block if there's no data
 		<-s.unblockRead
+		if s.readErr != nil {
+			return 0, s.readErr
+		}
 		return 0, io.EOF
 	}
 	return n, nil // never return an EOF
 }
-func (s *mockStream) Write(p []byte) (int, error) { return s.dataWritten.Write(p) }
+func (s *mockStream) ReadChunk() (uint64, []byte, error) { panic("not implemented") }
+func (s *mockStream) Write(p []byte) (int, error)        { return s.write(p) }
+func (s *mockStream) TryWrite(p []byte) (int, error)     { return s.write(p) }
+
+func (s *mockStream) write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.writeErr != nil {
+		return 0, s.writeErr
+	}
+	return s.dataWritten.Write(p)
+}
+
+func (s *mockStream) getDataWritten() []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]byte{}, s.dataWritten.Bytes()...)
+}
+
+// mockStreamError is the error returned by a stream that was reset by the peer
+type mockStreamError struct {
+	code quic.ErrorCode
+}
+
+var _ quic.StreamError = &mockStreamError{}
+
+func (e *mockStreamError) Error() string {
+	return fmt.Sprintf("stream reset with error code %d", e.code)
+}
+func (e *mockStreamError) Canceled() bool            { return true }
+func (e *mockStreamError) ErrorCode() quic.ErrorCode { return e.code }
+
+// decodeHeader reads a HEADERS frame and decodes the header fields
+func decodeHeader(r io.Reader) map[string][]string {
+	fields := make(map[string][]string)
+	frame, err := parseNextFrame(r)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&headersFrame{}))
+	headerBlock := make([]byte, frame.(*headersFrame).Length)
+	_, err = io.ReadFull(r, headerBlock)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	hfs, err := qpack.NewDecoder(0, 0, nil).DecodeFieldSection(context.Background(), 0, headerBlock)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	for _, p := range hfs {
+		fields[p.Name] = append(fields[p.Name], p.Value)
+	}
+	return fields
+}
+
+// getData reads all DATA frames, and returns their payload
+func getData(r io.Reader) []byte {
+	var data []byte
+	for {
+		frame, err := parseNextFrame(r)
+		if err == io.EOF {
+			return data
+		}
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&dataFrame{}))
+		payload := make([]byte, frame.(*dataFrame).Length)
+		_, err = io.ReadFull(r, payload)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		data = append(data, payload...)
+	}
+}
 
 var _ = Describe("Response Writer", func() {
 	var (
-		w            *responseWriter
-		headerStream *mockStream
-		dataStream   *mockStream
+		w   *responseWriter
+		str *mockStream
 	)
 
 	BeforeEach(func() {
-		headerStream = &mockStream{}
-		dataStream = &mockStream{}
-		w = newResponseWriter(headerStream, &sync.Mutex{}, dataStream, 5, utils.DefaultLogger)
+		str = newMockStream(0)
+		w = newResponseWriter(str, qpack.NewEncoder(nil, 0), utils.DefaultLogger)
 	})
 
-	decodeHeaderFields := func() map[string][]string {
-		fields := make(map[string][]string)
-		decoder := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {})
-		h2framer := http2.NewFramer(nil, bytes.NewReader(headerStream.dataWritten.Bytes()))
-
-		frame, err := h2framer.ReadFrame()
-		Expect(err).ToNot(HaveOccurred())
-		Expect(frame).To(BeAssignableToTypeOf(&http2.HeadersFrame{}))
-		hframe := frame.(*http2.HeadersFrame)
-		mhframe := &http2.MetaHeadersFrame{HeadersFrame: hframe}
-		Expect(mhframe.StreamID).To(BeEquivalentTo(5))
-		mhframe.Fields, err = decoder.DecodeFull(hframe.HeaderBlockFragment())
-		Expect(err).ToNot(HaveOccurred())
-		for _, p := range mhframe.Fields {
-			fields[p.Name] = append(fields[p.Name], p.Value)
-		}
-		return fields
-	}
-
 	It("writes status", func() {
 		w.WriteHeader(http.StatusTeapot)
-		fields := decodeHeaderFields()
+		fields := decodeHeader(&str.dataWritten)
 		Expect(fields).To(HaveLen(1))
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
 	})
@@ -105,7 +185,7 @@ var _ = Describe("Response Writer", func() {
 	It("writes headers", func() {
 		w.Header().Add("content-length", "42")
 		w.WriteHeader(http.StatusTeapot)
-		fields := decodeHeaderFields()
+		fields := decodeHeader(&str.dataWritten)
 		Expect(fields).To(HaveKeyWithValue("content-length", []string{"42"}))
 	})
 
@@ -115,7 +195,7 @@ var _ = Describe("Response Writer", func() {
 		w.Header().Add("set-cookie", cookie1)
 		w.Header().Add("set-cookie", cookie2)
 		w.WriteHeader(http.StatusTeapot)
-		fields := decodeHeaderFields()
+		fields := decodeHeader(&str.dataWritten)
 		Expect(fields).To(HaveKey("set-cookie"))
 		cookies := fields["set-cookie"]
 		Expect(cookies).To(ContainElement(cookie1))
@@ -126,11 +206,11 @@ var _ = Describe("Response Writer", func() {
 		n, err := w.Write([]byte("foobar"))
 		Expect(n).To(Equal(6))
 		Expect(err).ToNot(HaveOccurred())
-		// Should have written 200 on the header stream
-		fields := decodeHeaderFields()
+		// Should have written 200 in a HEADERS frame
+		fields := decodeHeader(&str.dataWritten)
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
-		// And foobar on the data stream
-		Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		// And foobar in a DATA frame
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("foobar")))
 	})
 
 	It("writes data after WriteHeader is called", func() {
@@ -138,19 +218,20 @@ var _ = Describe("Response Writer", func() {
 		n, err := w.Write([]byte("foobar"))
 		Expect(n).To(Equal(6))
 		Expect(err).ToNot(HaveOccurred())
-		// Should have written 418 on the header stream
-		fields := decodeHeaderFields()
+		// Should have written 418 in a HEADERS frame
+		fields := decodeHeader(&str.dataWritten)
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
-		// And foobar on the data stream
-		Expect(dataStream.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		// And foobar in a DATA frame
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("foobar")))
 	})
 
 	It("does not WriteHeader() twice", func() {
 		w.WriteHeader(200)
 		w.WriteHeader(500)
-		fields := decodeHeaderFields()
+		fields := decodeHeader(&str.dataWritten)
 		Expect(fields).To(HaveLen(1))
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(str.dataWritten.Len()).To(BeZero())
 	})
 
 	It("doesn't allow writes if the status code doesn't allow a body", func() {
@@ -158,6 +239,15 @@ var _ = Describe("Response Writer", func() {
 		n, err := w.Write([]byte("foobar"))
 		Expect(n).To(BeZero())
 		Expect(err).To(MatchError(http.ErrBodyNotAllowed))
-		Expect(dataStream.dataWritten.Bytes()).To(HaveLen(0))
+		decodeHeader(&str.dataWritten)
+		Expect(str.dataWritten.Len()).To(BeZero())
+	})
+
+	It("notifies when the stream is reset", func() {
+		c := w.CloseNotify()
+		Expect(w.CloseNotify()).To(Equal(c))
+		Consistently(c).ShouldNot(Receive())
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		Eventually(c).Should(Receive(BeTrue()))
 	})
 })
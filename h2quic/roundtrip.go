@@ -46,6 +46,23 @@ type RoundTripper struct {
 	// If Dial is nil, quic.DialAddr will be used.
 	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
+	// AcceptPush enables server push, and decides which pushes are accepted.
+	// It is called for every push promised by the server, with the promised request
+	// and the request that the push is associated with.
+	// If it returns false, the push is canceled.
+	// Pushes for requests that are not safe and cacheable (i.e. not GET or HEAD),
+	// and for other hosts than the one the connection is used for, are always canceled.
+	// If AcceptPush is nil, server push is disabled.
+	AcceptPush func(promised, associated *http.Request) bool
+
+	// HandlePush is called with every accepted pushed response, once its header has been received.
+	// The response's Request is the promised request. HandlePush must close the response body.
+	// If HandlePush is nil, pushed responses are cached, and RoundTrip uses them
+	// for the first request with the promised method and URL made on the same connection.
+	// A pushed response is not used if the request differs from the promised request
+	// in a header field listed in the Vary header field of the response.
+	HandlePush func(*http.Response)
+
 	clients map[string]roundTripCloser
 }
 
@@ -104,6 +121,17 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	if err != nil {
 		return nil, err
 	}
+	rsp, err := cl.RoundTrip(req)
+	if err != errGoAway {
+		return rsp, err
+	}
+	// The server is shutting down the connection, but requests that are already in flight will still complete.
+	// Do this request on a new connection.
+	r.removeClient(hostname, cl)
+	cl, err = r.getClient(hostname, opt.OnlyCachedConn)
+	if err != nil {
+		return nil, err
+	}
 	return cl.RoundTrip(req)
 }
 
@@ -128,7 +156,11 @@ func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTr
 		client = newClient(
 			hostname,
 			r.TLSClientConfig,
-			&roundTripperOpts{DisableCompression: r.DisableCompression},
+			&roundTripperOpts{
+				DisableCompression: r.DisableCompression,
+				AcceptPush:         r.AcceptPush,
+				HandlePush:         r.HandlePush,
+			},
 			r.QuicConfig,
 			r.Dial,
 		)
@@ -137,6 +169,14 @@ func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTr
 	return client, nil
 }
 
+func (r *RoundTripper) removeClient(hostname string, client http.RoundTripper) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.clients[hostname] == client {
+		delete(r.clients, hostname)
+	}
+}
+
 // Close closes the QUIC connections that this RoundTripper has used
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
@@ -14,10 +14,14 @@ import (
 )
 
 type mockClient struct {
-	closed bool
+	roundTripErr error
+	closed       bool
 }
 
 func (m *mockClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	if m.roundTripErr != nil {
+		return nil, m.roundTripErr
+	}
 	return &http.Response{Request: req}, nil
 }
 func (m *mockClient) Close() error {
@@ -75,7 +79,9 @@ var _ = Describe("RoundTripper", func() {
 			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
 				// return an error when trying to open a stream
 				// we don't want to test all the dial logic here, just that dialing happens at all
-				return &mockSession{streamOpenErr: streamOpenErr}, nil
+				sess := newMockSession()
+				sess.streamOpenErr = streamOpenErr
+				return sess, nil
 			}
 		})
 
@@ -127,6 +133,17 @@ var _ = Describe("RoundTripper", func() {
 			Expect(rt.clients).To(HaveLen(1))
 		})
 
+		It("retries the request on a new client if the server sent a GOAWAY", func() {
+			cl := &mockClient{roundTripErr: errGoAway}
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": cl}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(streamOpenErr))
+			Expect(rt.clients).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).ToNot(Equal(cl))
+		})
+
 		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
 			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
 			Expect(err).ToNot(HaveOccurred())
@@ -1,41 +1,32 @@
 package h2quic
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
+	"github.com/lucas-clemente/quic-go/qpack"
 )
 
-type streamCreator interface {
-	quic.Session
-	GetOrOpenStream(protocol.StreamID) (quic.Stream, error)
-}
-
-type remoteCloser interface {
-	CloseRemote(protocol.ByteCount)
-}
-
 // allows mocking of quic.Listen and quic.ListenAddr
 var (
 	quicListen     = quic.Listen
 	quicListenAddr = quic.ListenAddr
 )
 
-// Server is a HTTP2 server listening for QUIC connections.
+// Server is a HTTP/3 server listening for QUIC connections.
 type Server struct {
 	*http.Server
 
@@ -52,12 +43,15 @@ type Server struct {
 	listener      quic.Listener
 	closed        bool
 
-	supportedVersionsAsString string
+	connsMutex   sync.Mutex
+	conns        map[*serverConn]struct{}
+	shuttingDown bool           // set by CloseGracefully
+	handlers     sync.WaitGroup // counts the running handlers, including handlers for pushed responses
 
 	logger utils.Logger // will be set by Server.serveImpl()
 }
 
-// ListenAndServe listens on the UDP address s.Addr and calls s.Handler to handle HTTP/2 requests on incoming connections.
+// ListenAndServe listens on the UDP address s.Addr and calls s.Handler to handle HTTP/3 requests on incoming connections.
 func (s *Server) ListenAndServe() error {
 	if s.Server == nil {
 		return errors.New("use of h2quic.Server without http.Server")
@@ -65,7 +59,7 @@ func (s *Server) ListenAndServe() error {
 	return s.serveImpl(s.TLSConfig, nil)
 }
 
-// ListenAndServeTLS listens on the UDP address s.Addr and calls s.Handler to handle HTTP/2 requests on incoming connections.
+// ListenAndServeTLS listens on the UDP address s.Addr and calls s.Handler to handle HTTP/3 requests on incoming connections.
 func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
 	var err error
 	certs := make([]tls.Certificate, 1)
@@ -101,6 +95,13 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 		return errors.New("ListenAndServe may only be called once")
 	}
 
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	} else {
+		tlsConfig = tlsConfig.Clone()
+	}
+	tlsConfig.NextProtos = []string{NextProtoH3}
+
 	var ln quic.Listener
 	var err error
 	if conn == nil {
@@ -116,143 +117,239 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 	s.listenerMutex.Unlock()
 
 	for {
-		sess, err := ln.Accept()
+		sess, err := ln.Accept(context.Background())
 		if err != nil {
 			return err
 		}
-		go s.handleHeaderStream(sess.(streamCreator))
+		go s.handleConn(sess)
+	}
+}
+
+// A serverConn is a connection accepted by the server.
+type serverConn struct {
+	quic.Session
+
+	// We don't use the dynamic table, so QPACK never writes anything to the encoder and decoder streams.
+	decoder *qpack.Decoder
+	encoder *qpack.Encoder
+	pushes  *pushManager
+
+	mutex         sync.Mutex
+	controlStream quic.SendStream
+	goingAway     bool
+	nextStreamID  protocol.StreamID // the lowest request stream ID that wasn't accepted yet
+}
+
+func newServerConn(sess quic.Session) *serverConn {
+	return &serverConn{
+		Session: sess,
+		decoder: qpack.NewDecoder(0, 0, nil),
+		encoder: qpack.NewEncoder(nil, 0),
+		pushes:  newPushManager(sess),
+	}
+}
+
+// acceptRequest is called for every request stream accepted.
+// It returns false if the request stream is not processed, because we already sent a GOAWAY frame.
+func (c *serverConn) acceptRequest(id protocol.StreamID, handlers *sync.WaitGroup) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.goingAway {
+		return false
+	}
+	c.nextStreamID = id + 4
+	handlers.Add(1)
+	return true
+}
+
+// goAway sends a GOAWAY frame, containing the lowest request stream ID that wasn't accepted yet.
+// All request streams accepted after that are rejected.
+func (c *serverConn) goAway() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.goingAway {
+		return nil
 	}
+	c.goingAway = true
+	buf := &bytes.Buffer{}
+	(&goAwayFrame{StreamID: c.nextStreamID}).Write(buf)
+	_, err := c.controlStream.Write(buf.Bytes())
+	return err
 }
 
-func (s *Server) handleHeaderStream(session streamCreator) {
-	stream, err := session.AcceptStream()
+// addConn registers a connection.
+// It returns false if the server is shutting down.
+func (s *Server) addConn(conn *serverConn) bool {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[*serverConn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	return !s.shuttingDown
+}
+
+func (s *Server) removeConn(conn *serverConn) {
+	s.connsMutex.Lock()
+	delete(s.conns, conn)
+	s.connsMutex.Unlock()
+}
+
+func (s *Server) getConns() []*serverConn {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func (s *Server) handleConn(sess quic.Session) {
+	controlStr, err := openControlStream(sess)
 	if err != nil {
-		session.CloseWithError(quic.ErrorCode(qerr.InvalidHeadersStreamData), err)
+		s.logger.Debugf("Opening the control stream failed: %s", err)
+		sess.CloseWithError(quic.ErrorCode(errorClosedCriticalStream), err)
 		return
 	}
+	conn := newServerConn(sess)
+	conn.controlStream = controlStr
+	if !s.addConn(conn) {
+		// The server is shutting down. Don't process any requests on this connection.
+		if err := conn.goAway(); err != nil {
+			s.logger.Debugf("Sending GOAWAY failed: %s", err)
+		}
+	}
+	defer s.removeConn(conn)
+	go handleUnidirectionalStreams(sess, false, conn.pushes.handleControlFrame, nil, s.logger)
 
-	hpackDecoder := hpack.NewDecoder(4096, nil)
-	h2framer := http2.NewFramer(nil, stream)
-
-	var headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
+	// Process all requests immediately.
+	// It's the client's responsibility to decide which requests are eligible for 0-RTT.
 	for {
-		if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer); err != nil {
-			// QuicErrors must originate from stream.Read() returning an error.
-			// In this case, the session has already logged the error, so we don't
-			// need to log it again.
-			errorCode := qerr.InternalError
-			if qerr, ok := err.(*qerr.QuicError); ok {
-				errorCode = qerr.ErrorCode
-				s.logger.Errorf("error handling h2 request: %s", err.Error())
-			}
-			session.CloseWithError(quic.ErrorCode(errorCode), err)
+		str, err := sess.AcceptStream(context.Background())
+		if err != nil {
+			s.logger.Debugf("Accepting stream failed: %s", err)
 			return
 		}
+		if !conn.acceptRequest(str.StreamID(), &s.handlers) {
+			s.logger.Debugf("Rejecting request on stream %d, since we already sent a GOAWAY", str.StreamID())
+			str.CancelRead(quic.ErrorCode(errorRequestRejected))
+			str.CancelWrite(quic.ErrorCode(errorRequestRejected))
+			continue
+		}
+		go func() {
+			defer s.handlers.Done()
+			rerr := s.handleRequest(conn, str)
+			if rerr.err != nil || rerr.streamErr != 0 || rerr.connErr != 0 {
+				s.logger.Debugf("Handling request failed: %s", rerr.err)
+				if rerr.streamErr != 0 {
+					str.CancelRead(quic.ErrorCode(rerr.streamErr))
+					str.CancelWrite(quic.ErrorCode(rerr.streamErr))
+				}
+				if rerr.connErr != 0 {
+					sess.CloseWithError(quic.ErrorCode(rerr.connErr), rerr.err)
+				}
+				return
+			}
+			str.Close()
+		}()
 	}
 }
 
-func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
-	h2frame, err := h2framer.ReadFrame()
+func (s *Server) maxHeaderBytes() uint64 {
+	if s.Server.MaxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	return uint64(s.Server.MaxHeaderBytes)
+}
+
+func (s *Server) handleRequest(conn *serverConn, str quic.Stream) requestError {
+	frame, err := parseNextFrame(str)
 	if err != nil {
-		return qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")
+		return newStreamError(errorRequestIncomplete, err)
 	}
-	var h2headersFrame *http2.HeadersFrame
-	switch f := h2frame.(type) {
-	case *http2.PriorityFrame:
-		// ignore PRIORITY frames
-		s.logger.Debugf("Ignoring H2 PRIORITY frame: %#v", f)
-		return nil
-	case *http2.HeadersFrame:
-		h2headersFrame = f
-	default:
-		return qerr.Error(qerr.InvalidHeadersStreamData, "expected a header frame")
+	hf, ok := frame.(*headersFrame)
+	if !ok {
+		return newConnError(errorFrameUnexpected, errors.New("expected first frame to be a HEADERS frame"))
 	}
-
-	if !h2headersFrame.HeadersEnded() {
-		return errors.New("http2 header continuation not implemented")
+	if hf.Length > s.maxHeaderBytes() {
+		return newStreamError(errorFrameError, fmt.Errorf("HEADERS frame too large: %d bytes (max: %d)", hf.Length, s.maxHeaderBytes()))
+	}
+	headerBlock := make([]byte, hf.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		return newStreamError(errorRequestIncomplete, err)
 	}
-	headers, err := hpackDecoder.DecodeFull(h2headersFrame.HeaderBlockFragment())
+	hfs, err := conn.decoder.DecodeFieldSection(str.Context(), uint64(str.StreamID()), headerBlock)
 	if err != nil {
-		s.logger.Errorf("invalid http2 headers encoding: %s", err.Error())
-		return err
+		return newConnError(errorQPACKDecompressionFailed, err)
 	}
-
-	req, err := requestFromHeaders(headers)
+	req, err := requestFromHeaders(hfs)
 	if err != nil {
-		return err
+		return newStreamError(errorMessageError, err)
 	}
 
 	if s.logger.Debug() {
-		s.logger.Infof("%s %s%s, on data stream %d", req.Method, req.Host, req.RequestURI, h2headersFrame.StreamID)
+		s.logger.Infof("%s %s%s, on stream %d", req.Method, req.Host, req.RequestURI, str.StreamID())
 	} else {
 		s.logger.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
 	}
 
-	dataStream, err := session.GetOrOpenStream(protocol.StreamID(h2headersFrame.StreamID))
-	if err != nil {
-		return err
-	}
-	// this can happen if the client immediately closes the data stream after sending the request and the runtime processes the reset before the request
-	if dataStream == nil {
-		return nil
-	}
-
-	// handleRequest should be as non-blocking as possible to minimize
-	// head-of-line blocking. Potentially blocking code is run in a separate
-	// goroutine, enabling handleRequest to return before the code is executed.
+	// The client can abort the request by resetting either direction of the stream:
+	// A RESET_STREAM only cancels the read side, a STOP_SENDING only cancels the write side.
+	ctx, cancel := context.WithCancel(str.Context())
+	defer cancel()
 	go func() {
-		streamEnded := h2headersFrame.StreamEnded()
-		if streamEnded {
-			dataStream.(remoteCloser).CloseRemote(0)
-			streamEnded = true
-			_, _ = dataStream.Read([]byte{0}) // read the eof
+		select {
+		case <-str.ReadContext().Done():
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+	req = req.WithContext(ctx)
+	req.Body = newRequestBody(str)
+	req.RemoteAddr = conn.RemoteAddr().String()
 
-		req = req.WithContext(dataStream.Context())
-		reqBody := newRequestBody(dataStream)
-		req.Body = reqBody
-
-		req.RemoteAddr = session.RemoteAddr().String()
+	responseWriter := newResponseWriter(str, conn.encoder, s.logger)
+	responseWriter.ctx = ctx
+	responseWriter.push = func(target string, opts *http.PushOptions) error {
+		return s.push(conn, str, req, target, opts)
+	}
+	s.runHandler(responseWriter, req)
+	// If the EOF was read by the handler, CancelRead() is a no-op.
+	str.CancelRead(quic.ErrorCode(errorNoError))
 
-		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID), s.logger)
+	if s.CloseAfterFirstRequest {
+		time.Sleep(100 * time.Millisecond)
+		conn.Close()
+	}
+	return requestError{}
+}
 
-		handler := s.Handler
-		if handler == nil {
-			handler = http.DefaultServeMux
-		}
-		panicked := false
-		func() {
-			defer func() {
-				if p := recover(); p != nil {
-					// Copied from net/http/server.go
-					const size = 64 << 10
-					buf := make([]byte, size)
-					buf = buf[:runtime.Stack(buf, false)]
-					s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
-					panicked = true
-				}
-			}()
-			handler.ServeHTTP(responseWriter, req)
-		}()
-		if panicked {
-			responseWriter.WriteHeader(500)
-		} else {
-			responseWriter.WriteHeader(200)
-		}
-		if responseWriter.dataStream != nil {
-			if !streamEnded && !reqBody.requestRead {
-				// in gQUIC, the error code doesn't matter, so just use 0 here
-				responseWriter.dataStream.CancelRead(0)
+// runHandler runs the handler, and writes the response header if the handler didn't.
+func (s *Server) runHandler(responseWriter *responseWriter, req *http.Request) {
+	handler := s.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	panicked := false
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				// Copied from net/http/server.go
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
+				panicked = true
 			}
-			responseWriter.dataStream.Close()
-		}
-		if s.CloseAfterFirstRequest {
-			time.Sleep(100 * time.Millisecond)
-			session.Close()
-		}
+		}()
+		handler.ServeHTTP(responseWriter, req)
 	}()
-
-	return nil
+	if panicked {
+		responseWriter.WriteHeader(500)
+	} else {
+		responseWriter.WriteHeader(200)
+	}
 }
 
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
@@ -270,15 +367,41 @@ func (s *Server) Close() error {
 }
 
 // CloseGracefully shuts down the server gracefully. The server sends a GOAWAY frame first, then waits for either timeout to trigger, or for all running requests to complete.
+// Requests that the client sends after receiving the GOAWAY frame are rejected.
 // CloseGracefully in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) CloseGracefully(timeout time.Duration) error {
-	// TODO: implement
-	return nil
+	s.connsMutex.Lock()
+	s.shuttingDown = true
+	s.connsMutex.Unlock()
+
+	for _, conn := range s.getConns() {
+		if err := conn.goAway(); err != nil {
+			s.logger.Debugf("Sending GOAWAY failed: %s", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+
+	for _, conn := range s.getConns() {
+		conn.CloseWithError(quic.ErrorCode(errorNoError), nil)
+	}
+	return s.Close()
 }
 
-// SetQuicHeaders can be used to set the proper headers that announce that this server supports QUIC.
+// SetQuicHeaders can be used to set the proper headers that announce that this server supports HTTP/3.
 // The values that are set depend on the port information from s.Server.Addr, and currently look like this (if Addr has port 443):
-//  Alt-Svc: quic=":443"; ma=2592000; v="33,32,31,30"
+//
+//	Alt-Svc: h3=":443"; ma=2592000
 func (s *Server) SetQuicHeaders(hdr http.Header) error {
 	port := atomic.LoadUint32(&s.port)
 
@@ -296,21 +419,13 @@ func (s *Server) SetQuicHeaders(hdr http.Header) error {
 		atomic.StoreUint32(&s.port, port)
 	}
 
-	if s.supportedVersionsAsString == "" {
-		var versions []string
-		for _, v := range protocol.SupportedVersions {
-			versions = append(versions, v.ToAltSvc())
-		}
-		s.supportedVersionsAsString = strings.Join(versions, ",")
-	}
-
-	hdr.Add("Alt-Svc", fmt.Sprintf(`quic=":%d"; ma=2592000; v="%s"`, port, s.supportedVersionsAsString))
+	hdr.Add("Alt-Svc", fmt.Sprintf(`%s=":%d"; ma=2592000`, NextProtoH3, port))
 
 	return nil
 }
 
 // ListenAndServeQUIC listens on the UDP network address addr and calls the
-// handler for HTTP/2 requests on incoming connections. http.DefaultServeMux is
+// handler for HTTP/3 requests on incoming connections. http.DefaultServeMux is
 // used when handler is nil.
 func ListenAndServeQUIC(addr, certFile, keyFile string, handler http.Handler) error {
 	server := &Server{
@@ -382,8 +497,8 @@ func ListenAndServe(addr, certFile, keyFile string, handler http.Handler) error
 		handler.ServeHTTP(w, r)
 	})
 
-	hErr := make(chan error)
-	qErr := make(chan error)
+	hErr := make(chan error, 1)
+	qErr := make(chan error, 1)
 	go func() {
 		hErr <- httpServer.Serve(tlsConn)
 	}()
@@ -396,7 +511,8 @@ func ListenAndServe(addr, certFile, keyFile string, handler http.Handler) error
 		quicServer.Close()
 		return err
 	case err := <-qErr:
-		// Cannot close the HTTP server or wait for requests to complete properly :/
+		// Stop accepting new TLS connections, and wait for running requests to complete.
+		httpServer.Shutdown(context.Background())
 		return err
 	}
 }
@@ -0,0 +1,198 @@
+package h2quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
+)
+
+var errPushLimitReached = errors.New("h2quic: push would exceed the client's MAX_PUSH_ID")
+
+// The pushManager allocates push IDs, and keeps track of the push streams of a connection.
+type pushManager struct {
+	sess quic.Session
+
+	mutex      sync.Mutex
+	enabled    bool   // set when the first MAX_PUSH_ID frame is received
+	maxPushID  uint64 // the push ID received in the last MAX_PUSH_ID frame
+	nextPushID uint64
+	streams    map[uint64]quic.SendStream // the open push streams
+}
+
+func newPushManager(sess quic.Session) *pushManager {
+	return &pushManager{
+		sess:    sess,
+		streams: make(map[uint64]quic.SendStream),
+	}
+}
+
+// handleControlFrame handles the MAX_PUSH_ID and CANCEL_PUSH frames received on the control stream.
+func (m *pushManager) handleControlFrame(f frame) error {
+	switch f := f.(type) {
+	case *maxPushIDFrame:
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if m.enabled && f.PushID < m.maxPushID {
+			m.sess.CloseWithError(quic.ErrorCode(errorIDError), fmt.Errorf("MAX_PUSH_ID reduced from %d to %d", m.maxPushID, f.PushID))
+			return nil
+		}
+		m.enabled = true
+		m.maxPushID = f.PushID
+	case *cancelPushFrame:
+		m.mutex.Lock()
+		if f.PushID >= m.nextPushID {
+			m.mutex.Unlock()
+			m.sess.CloseWithError(quic.ErrorCode(errorIDError), fmt.Errorf("received CANCEL_PUSH for push %d, which was not promised", f.PushID))
+			return nil
+		}
+		str, ok := m.streams[f.PushID]
+		delete(m.streams, f.PushID)
+		m.mutex.Unlock()
+		if ok {
+			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		}
+	}
+	return nil
+}
+
+// openPushStream allocates a push ID and opens the push stream.
+func (m *pushManager) openPushStream() (uint64, quic.SendStream, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.enabled {
+		return 0, nil, http.ErrNotSupported
+	}
+	if m.nextPushID > m.maxPushID {
+		return 0, nil, errPushLimitReached
+	}
+	str, err := m.sess.OpenUniStream()
+	if err != nil {
+		return 0, nil, err
+	}
+	pushID := m.nextPushID
+	m.nextPushID++
+	buf := &bytes.Buffer{}
+	utils.WriteVarInt(buf, streamTypePushStream)
+	utils.WriteVarInt(buf, pushID)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return 0, nil, err
+	}
+	m.streams[pushID] = str
+	return pushID, str, nil
+}
+
+// closePushStream is called when the push handler returns.
+func (m *pushManager) closePushStream(pushID uint64) {
+	m.mutex.Lock()
+	str, ok := m.streams[pushID]
+	delete(m.streams, pushID)
+	m.mutex.Unlock()
+	if ok {
+		str.Close()
+	}
+}
+
+// cancelPushStream resets a push stream.
+func (m *pushManager) cancelPushStream(pushID uint64) {
+	m.mutex.Lock()
+	str, ok := m.streams[pushID]
+	delete(m.streams, pushID)
+	m.mutex.Unlock()
+	if ok {
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+	}
+}
+
+// push implements http.Pusher for a request received on str.
+// It sends a PUSH_PROMISE frame on the request stream, and runs the handler for the promised request on a push stream.
+func (s *Server) push(conn *serverConn, str quic.Stream, req *http.Request, target string, opts *http.PushOptions) error {
+	if opts == nil {
+		opts = &http.PushOptions{}
+	}
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	// only safe and cacheable methods can be pushed
+	if method != http.MethodGet && method != http.MethodHead {
+		return fmt.Errorf("h2quic: method %q must be GET or HEAD", method)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return fmt.Errorf("h2quic: target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = "https"
+		u.Host = req.Host
+	} else if u.Scheme != "https" {
+		return fmt.Errorf("h2quic: cannot push URL with scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("h2quic: URL must have a host")
+	}
+	fields := []qpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: u.Host},
+		{Name: ":path", Value: u.RequestURI()},
+	}
+	for k, vv := range opts.Header {
+		if strings.HasPrefix(k, ":") {
+			return fmt.Errorf("h2quic: promised request headers cannot include pseudo header %q", k)
+		}
+		// These headers are meaningful only if the request has a body,
+		// and the Host header is sent as the :authority pseudo header.
+		switch strings.ToLower(k) {
+		case "content-length", "content-encoding", "trailer", "te", "expect", "host":
+			return fmt.Errorf("h2quic: promised request headers cannot include %q", k)
+		}
+		for _, v := range vv {
+			fields = append(fields, qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	pushReq, err := requestFromHeaders(fields)
+	if err != nil {
+		return err
+	}
+
+	pushID, pushStr, err := conn.pushes.openPushStream()
+	if err != nil {
+		return err
+	}
+	headerBlock, err := conn.encoder.EncodeFieldSection(uint64(str.StreamID()), fields)
+	if err != nil {
+		conn.pushes.cancelPushStream(pushID)
+		return err
+	}
+	buf := &bytes.Buffer{}
+	(&pushPromiseFrame{PushID: pushID, Length: uint64(len(headerBlock))}).Write(buf)
+	buf.Write(headerBlock)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		conn.pushes.cancelPushStream(pushID)
+		return err
+	}
+
+	s.logger.Infof("Pushing %s %s%s (push %d)", pushReq.Method, pushReq.Host, pushReq.RequestURI, pushID)
+	pushReq = pushReq.WithContext(pushStr.Context())
+	pushReq.Body = http.NoBody
+	pushReq.RemoteAddr = req.RemoteAddr
+	s.handlers.Add(1)
+	go func() {
+		defer s.handlers.Done()
+		// Pushed responses can't trigger further pushes.
+		s.runHandler(newResponseWriter(pushStr, conn.encoder, s.logger), pushReq)
+		conn.pushes.closePushStream(pushID)
+	}()
+	return nil
+}
@@ -0,0 +1,242 @@
+package h2quic
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server push", func() {
+	var (
+		s       *Server
+		session *mockSession
+		conn    *serverConn
+	)
+
+	BeforeEach(func() {
+		s = &Server{
+			Server: &http.Server{},
+			logger: utils.DefaultLogger,
+		}
+		session = newMockSession()
+		conn = newServerConn(session)
+	})
+
+	AfterEach(func() {
+		session.Close()
+	})
+
+	enablePush := func(maxPushID uint64) {
+		ExpectWithOffset(1, conn.pushes.handleControlFrame(&maxPushIDFrame{PushID: maxPushID})).To(Succeed())
+	}
+
+	// getRequestStream returns a stream that contains a GET request
+	getRequestStream := func(url string) *mockStream {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		buf := newMockStream(0)
+		ExpectWithOffset(1, newRequestWriter(qpack.NewEncoder(nil, 0), utils.DefaultLogger).WriteRequest(buf, req, false)).To(Succeed())
+		str := newMockStream(0)
+		str.dataToRead.Write(buf.dataWritten.Bytes())
+		close(str.unblockRead)
+		return str
+	}
+
+	// decodePushPromise reads a PUSH_PROMISE frame and decodes the header fields
+	decodePushPromise := func(r io.Reader) (uint64, map[string]string) {
+		frame, err := parseNextFrame(r)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, frame).To(BeAssignableToTypeOf(&pushPromiseFrame{}))
+		f := frame.(*pushPromiseFrame)
+		headerBlock := make([]byte, f.Length)
+		_, err = io.ReadFull(r, headerBlock)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		hfs, err := qpack.NewDecoder(0, 0, nil).DecodeFieldSection(context.Background(), 0, headerBlock)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		fields := make(map[string]string)
+		for _, hf := range hfs {
+			fields[hf.Name] = hf.Value
+		}
+		return f.PushID, fields
+	}
+
+	It("pushes a response", func() {
+		enablePush(10)
+		pushedReqChan := make(chan *http.Request, 1)
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/":
+				err := w.(http.Pusher).Push("/style.css", &http.PushOptions{Header: http.Header{"Accept": {"text/css"}}})
+				Expect(err).ToNot(HaveOccurred())
+				w.Write([]byte("index"))
+			case "/style.css":
+				pushedReqChan <- r
+				w.Write([]byte("body{}"))
+			}
+		})
+		str := getRequestStream("https://www.example.com/")
+		Expect(s.handleRequest(conn, str).err).ToNot(HaveOccurred())
+		pushID, fields := decodePushPromise(&str.dataWritten)
+		Expect(pushID).To(BeZero())
+		Expect(fields).To(Equal(map[string]string{
+			":method":    "GET",
+			":scheme":    "https",
+			":authority": "www.example.com",
+			":path":      "/style.css",
+			"accept":     "text/css",
+		}))
+		Expect(decodeHeader(&str.dataWritten)).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(getData(&str.dataWritten)).To(Equal([]byte("index")))
+
+		var pushedReq *http.Request
+		Eventually(pushedReqChan).Should(Receive(&pushedReq))
+		Expect(pushedReq.Method).To(Equal(http.MethodGet))
+		Expect(pushedReq.Host).To(Equal("www.example.com"))
+		Expect(pushedReq.Header.Get("Accept")).To(Equal("text/css"))
+		Expect(pushedReq.RemoteAddr).To(Equal("127.0.0.1:42"))
+		Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+		pushStr := session.getOpenedUniStreams()[0]
+		Eventually(pushStr.Context().Done()).Should(BeClosed())
+		streamType, err := utils.ReadVarInt(&pushStr.dataWritten)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(streamType).To(BeEquivalentTo(streamTypePushStream))
+		id, err := utils.ReadVarInt(&pushStr.dataWritten)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id).To(BeZero())
+		Expect(decodeHeader(&pushStr.dataWritten)).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(getData(&pushStr.dataWritten)).To(Equal([]byte("body{}")))
+	})
+
+	It("uses consecutive push IDs", func() {
+		enablePush(10)
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				Expect(w.(http.Pusher).Push("https://www.example.com/foo", nil)).To(Succeed())
+				Expect(w.(http.Pusher).Push("/bar", &http.PushOptions{Method: http.MethodHead})).To(Succeed())
+			}
+		})
+		str := getRequestStream("https://www.example.com/")
+		Expect(s.handleRequest(conn, str).err).ToNot(HaveOccurred())
+		pushID, fields := decodePushPromise(&str.dataWritten)
+		Expect(pushID).To(BeZero())
+		Expect(fields).To(HaveKeyWithValue(":path", "/foo"))
+		pushID, fields = decodePushPromise(&str.dataWritten)
+		Expect(pushID).To(BeEquivalentTo(1))
+		Expect(fields).To(HaveKeyWithValue(":path", "/bar"))
+		Expect(fields).To(HaveKeyWithValue(":method", "HEAD"))
+	})
+
+	It("doesn't allow pushing from a pushed response", func() {
+		enablePush(10)
+		errChan := make(chan error, 1)
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/":
+				Expect(w.(http.Pusher).Push("/foo", nil)).To(Succeed())
+			case "/foo":
+				errChan <- w.(http.Pusher).Push("/bar", nil)
+			}
+		})
+		Expect(s.handleRequest(conn, getRequestStream("https://www.example.com/")).err).ToNot(HaveOccurred())
+		Eventually(errChan).Should(Receive(Equal(http.ErrNotSupported)))
+	})
+
+	It("returns http.ErrNotSupported if the client didn't enable push", func() {
+		var err error
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err = w.(http.Pusher).Push("/foo", nil)
+		})
+		Expect(s.handleRequest(conn, getRequestStream("https://www.example.com/")).err).ToNot(HaveOccurred())
+		Expect(err).To(Equal(http.ErrNotSupported))
+		Expect(session.getOpenedUniStreams()).To(BeEmpty())
+	})
+
+	It("doesn't push more than allowed by MAX_PUSH_ID", func() {
+		enablePush(0)
+		var err1, err2 error
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/" {
+				err1 = w.(http.Pusher).Push("/foo", nil)
+				err2 = w.(http.Pusher).Push("/bar", nil)
+			}
+		})
+		Expect(s.handleRequest(conn, getRequestStream("https://www.example.com/")).err).ToNot(HaveOccurred())
+		Expect(err1).ToNot(HaveOccurred())
+		Expect(err2).To(MatchError(errPushLimitReached))
+		Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+	})
+
+	It("rejects invalid pushes", func() {
+		enablePush(10)
+		var errs []error
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pusher := w.(http.Pusher)
+			errs = append(errs,
+				pusher.Push("/foo", &http.PushOptions{Method: http.MethodPost}),
+				pusher.Push("foo", nil),
+				pusher.Push("http://www.example.com/foo", nil),
+				pusher.Push("/foo", &http.PushOptions{Header: http.Header{":path": {"/bar"}}}),
+				pusher.Push("/foo", &http.PushOptions{Header: http.Header{"Content-Length": {"42"}}}),
+			)
+		})
+		Expect(s.handleRequest(conn, getRequestStream("https://www.example.com/")).err).ToNot(HaveOccurred())
+		Expect(errs).To(HaveLen(5))
+		Expect(errs[0]).To(MatchError(`h2quic: method "POST" must be GET or HEAD`))
+		Expect(errs[1]).To(MatchError(`h2quic: target must be an absolute URL or an absolute path: "foo"`))
+		Expect(errs[2]).To(MatchError(`h2quic: cannot push URL with scheme "http"`))
+		Expect(errs[3]).To(MatchError(`h2quic: promised request headers cannot include pseudo header ":path"`))
+		Expect(errs[4]).To(MatchError(`h2quic: promised request headers cannot include "Content-Length"`))
+		Expect(session.getOpenedUniStreams()).To(BeEmpty())
+	})
+
+	Context("control frames", func() {
+		It("resets the push stream when the client cancels the push", func() {
+			enablePush(10)
+			unblock := make(chan struct{})
+			defer close(unblock)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/":
+					Expect(w.(http.Pusher).Push("/foo", nil)).To(Succeed())
+				case "/foo":
+					<-unblock
+				}
+			})
+			Expect(s.handleRequest(conn, getRequestStream("https://www.example.com/")).err).ToNot(HaveOccurred())
+			Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+			pushStr := session.getOpenedUniStreams()[0]
+			Expect(conn.pushes.handleControlFrame(&cancelPushFrame{PushID: 0})).To(Succeed())
+			Expect(pushStr.isCanceledWrite()).To(BeTrue())
+			Expect(pushStr.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
+			Expect(session.isClosed()).To(BeFalse())
+		})
+
+		It("closes the session when receiving a CANCEL_PUSH frame for a push that wasn't promised", func() {
+			enablePush(10)
+			Expect(conn.pushes.handleControlFrame(&cancelPushFrame{PushID: 0})).To(Succeed())
+			Expect(session.isClosed()).To(BeTrue())
+			code, err := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorIDError)))
+			Expect(err).To(MatchError("received CANCEL_PUSH for push 0, which was not promised"))
+		})
+
+		It("closes the session when the MAX_PUSH_ID is reduced", func() {
+			enablePush(10)
+			enablePush(10)
+			Expect(session.isClosed()).To(BeFalse())
+			enablePush(9)
+			Expect(session.isClosed()).To(BeTrue())
+			code, err := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorIDError)))
+			Expect(err).To(MatchError("MAX_PUSH_ID reduced from 10 to 9"))
+		})
+	})
+
+})
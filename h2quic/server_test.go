@@ -5,33 +5,33 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/hpack"
-
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/qpack"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 type mockSession struct {
+	mutex sync.Mutex
+
 	closed              bool
 	closedWithError     error
-	dataStream          quic.Stream
-	streamToAccept      quic.Stream
+	closeErrorCode      quic.ErrorCode
+	streamsToAccept     chan quic.Stream
+	uniStreamsToAccept  chan quic.ReceiveStream
 	streamsToOpen       []quic.Stream
+	openedUniStreams    []*mockStream
 	blockOpenStreamSync bool
 	blockOpenStreamChan chan struct{} // close this chan (or call Close) to make OpenStreamSync return
 	streamOpenErr       error
@@ -40,13 +40,35 @@ type mockSession struct {
 }
 
 func newMockSession() *mockSession {
-	return &mockSession{blockOpenStreamChan: make(chan struct{})}
+	s := &mockSession{
+		blockOpenStreamChan: make(chan struct{}),
+		streamsToAccept:     make(chan quic.Stream, 10),
+		uniStreamsToAccept:  make(chan quic.ReceiveStream, 10),
+	}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	return s
 }
 
-func (s *mockSession) GetOrOpenStream(id protocol.StreamID) (quic.Stream, error) {
-	return s.dataStream, nil
+func (s *mockSession) AcceptStream(ctx context.Context) (quic.Stream, error) {
+	select {
+	case str := <-s.streamsToAccept:
+		return str, nil
+	case <-s.ctx.Done():
+		return nil, errors.New("session closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+func (s *mockSession) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
+	select {
+	case str := <-s.uniStreamsToAccept:
+		return str, nil
+	case <-s.ctx.Done():
+		return nil, errors.New("session closed")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
-func (s *mockSession) AcceptStream() (quic.Stream, error) { return s.streamToAccept, nil }
 func (s *mockSession) OpenStream() (quic.Stream, error) {
 	if s.streamOpenErr != nil {
 		return nil, s.streamOpenErr
@@ -55,13 +77,37 @@ func (s *mockSession) OpenStream() (quic.Stream, error) {
 	s.streamsToOpen = s.streamsToOpen[1:]
 	return str, nil
 }
-func (s *mockSession) OpenStreamSync() (quic.Stream, error) {
+func (s *mockSession) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
 	if s.blockOpenStreamSync {
-		<-s.blockOpenStreamChan
+		select {
+		case <-s.blockOpenStreamChan:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 	return s.OpenStream()
 }
+func (s *mockSession) OpenUniStream() (quic.SendStream, error) {
+	if s.streamOpenErr != nil {
+		return nil, s.streamOpenErr
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	str := newMockStream(protocol.StreamID(4*len(s.openedUniStreams) + 2))
+	s.openedUniStreams = append(s.openedUniStreams, str)
+	return str, nil
+}
+func (s *mockSession) OpenUniStreamSync(context.Context) (quic.SendStream, error) {
+	return s.OpenUniStream()
+}
+func (s *mockSession) getOpenedUniStreams() []*mockStream {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.openedUniStreams
+}
 func (s *mockSession) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	s.ctxCancel()
 	if !s.closed {
 		close(s.blockOpenStreamChan)
@@ -69,10 +115,25 @@ func (s *mockSession) Close() error {
 	s.closed = true
 	return nil
 }
-func (s *mockSession) CloseWithError(_ quic.ErrorCode, e error) error {
-	s.closedWithError = e
+func (s *mockSession) CloseWithError(code quic.ErrorCode, e error) error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closeErrorCode = code
+		s.closedWithError = e
+	}
+	s.mutex.Unlock()
 	return s.Close()
 }
+func (s *mockSession) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+func (s *mockSession) getCloseError() (quic.ErrorCode, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closeErrorCode, s.closedWithError
+}
 func (s *mockSession) LocalAddr() net.Addr {
 	panic("not implemented")
 }
@@ -82,17 +143,20 @@ func (s *mockSession) RemoteAddr() net.Addr {
 func (s *mockSession) Context() context.Context {
 	return s.ctx
 }
-func (s *mockSession) ConnectionState() quic.ConnectionState        { panic("not implemented") }
-func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error) { panic("not implemented") }
-func (s *mockSession) OpenUniStream() (quic.SendStream, error)      { panic("not implemented") }
-func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error)  { panic("not implemented") }
+func (s *mockSession) HandshakeComplete() context.Context            { panic("not implemented") }
+func (s *mockSession) ConnectionState() quic.ConnectionState         { panic("not implemented") }
+func (s *mockSession) SetMaxIncomingStreams(int)                     { panic("not implemented") }
+func (s *mockSession) SetMaxIncomingUniStreams(int)                  { panic("not implemented") }
+func (s *mockSession) IncomingStreamCredit() quic.StreamCredit       { panic("not implemented") }
+func (s *mockSession) IncomingUniStreamCredit() quic.StreamCredit    { panic("not implemented") }
+func (s *mockSession) Migrate(context.Context, net.PacketConn) error { panic("not implemented") }
 
 var _ = Describe("H2 server", func() {
 	var (
 		s                  *Server
 		session            *mockSession
-		dataStream         *mockStream
 		origQuicListenAddr = quicListenAddr
+		origQuicListen     = quicListen
 	)
 
 	BeforeEach(func() {
@@ -102,29 +166,40 @@ var _ = Describe("H2 server", func() {
 			},
 			logger: utils.DefaultLogger,
 		}
-		dataStream = newMockStream(0)
-		close(dataStream.unblockRead)
 		session = newMockSession()
-		session.dataStream = dataStream
-		session.ctx, session.ctxCancel = context.WithCancel(context.Background())
 		origQuicListenAddr = quicListenAddr
+		origQuicListen = quicListen
 	})
 
 	AfterEach(func() {
 		quicListenAddr = origQuicListenAddr
+		quicListen = origQuicListen
 	})
 
+	// encodeRequest encodes a request in the same way the client does
+	encodeRequest := func(req *http.Request) *mockStream {
+		str := newMockStream(0)
+		rw := newRequestWriter(qpack.NewEncoder(nil, 0), utils.DefaultLogger)
+		ExpectWithOffset(1, rw.WriteRequest(str, req, false)).To(Succeed())
+		if req.Body != nil {
+			_, err := io.Copy(&dataFrameWriter{w: str}, req.Body)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		}
+		reqStr := newMockStream(0)
+		reqStr.dataToRead.Write(str.dataWritten.Bytes())
+		close(reqStr.unblockRead)
+		return reqStr
+	}
+
 	Context("handling requests", func() {
-		var (
-			h2framer     *http2.Framer
-			hpackDecoder *hpack.Decoder
-			headerStream *mockStream
-		)
+		var exampleGetRequest, examplePostRequest *http.Request
 
 		BeforeEach(func() {
-			headerStream = &mockStream{}
-			hpackDecoder = hpack.NewDecoder(4096, nil)
-			h2framer = http2.NewFramer(nil, headerStream)
+			var err error
+			exampleGetRequest, err = http.NewRequest("GET", "https://www.example.com", nil)
+			Expect(err).ToNot(HaveOccurred())
+			examplePostRequest, err = http.NewRequest("POST", "https://www.example.com", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("handles a sample GET request", func() {
@@ -132,266 +207,269 @@ var _ = Describe("H2 server", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				defer GinkgoRecover()
 				Expect(r.Host).To(Equal("www.example.com"))
+				Expect(r.Method).To(Equal("GET"))
 				Expect(r.RemoteAddr).To(Equal("127.0.0.1:42"))
+				Expect(r.Proto).To(Equal("HTTP/3.0"))
 				handlerCalled = true
 			})
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-			Expect(dataStream.remoteClosed).To(BeTrue())
-			Expect(dataStream.reset).To(BeFalse())
+			str := encodeRequest(exampleGetRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			Expect(handlerCalled).To(BeTrue())
+			Expect(str.canceledWrite).To(BeFalse())
 		})
 
 		It("returns 200 with an empty handler", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() []byte {
-				return headerStream.dataWritten.Bytes()
-			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x88})) // 0x88 is 200
+			str := encodeRequest(exampleGetRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			hfs := decodeHeader(&str.dataWritten)
+			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(str.dataWritten.Len()).To(BeZero())
 		})
 
-		It("correctly handles a panicking handler", func() {
+		It("sends the response body in DATA frames", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				panic("foobar")
+				w.Header().Set("foo", "bar")
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("foobar"))
 			})
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() []byte {
-				return headerStream.dataWritten.Bytes()
-			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x8e})) // 0x82 is 500
+			str := encodeRequest(exampleGetRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			hfs := decodeHeader(&str.dataWritten)
+			Expect(hfs).To(HaveKeyWithValue(":status", []string{"418"}))
+			Expect(hfs).To(HaveKeyWithValue("foo", []string{"bar"}))
+			Expect(getData(&str.dataWritten)).To(Equal([]byte("foobar")))
 		})
 
-		It("resets the dataStream when client sends a body in GET request", func() {
-			var handlerCalled bool
+		It("correctly handles a panicking handler", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				Expect(r.Host).To(Equal("www.example.com"))
-				handlerCalled = true
-			})
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+				panic("foobar")
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
-			Expect(dataStream.remoteClosed).To(BeFalse())
+			str := encodeRequest(exampleGetRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			hfs := decodeHeader(&str.dataWritten)
+			Expect(hfs).To(HaveKeyWithValue(":status", []string{"500"}))
 		})
 
-		It("resets the dataStream when the body of POST request is not read", func() {
-			var handlerCalled bool
+		It("reads the request body", func() {
+			var body []byte
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				Expect(r.Host).To(Equal("www.example.com"))
+				defer GinkgoRecover()
 				Expect(r.Method).To(Equal("POST"))
-				handlerCalled = true
+				Expect(r.ContentLength).To(BeEquivalentTo(6))
+				var err error
+				body, err = ioutil.ReadAll(r.Body)
+				Expect(err).ToNot(HaveOccurred())
 			})
-			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
-			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
-			Expect(handlerCalled).To(BeTrue())
+			str := encodeRequest(examplePostRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			Expect(body).To(Equal([]byte("foobar")))
+			Expect(str.reset).To(BeTrue()) // CancelRead is a no-op if the EOF was read
 		})
 
-		It("handles a request for which the client immediately resets the data stream", func() {
-			session.dataStream = nil
-			var handlerCalled bool
-			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				handlerCalled = true
-			})
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
+		It("stops reading the request body if the handler didn't read it", func() {
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			str := encodeRequest(examplePostRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			Expect(str.reset).To(BeTrue())
+			Expect(str.resetErrorCode).To(Equal(quic.ErrorCode(errorNoError)))
 		})
 
-		It("resets the dataStream when the body of POST request is not read, and the request handler replaces the request.Body", func() {
+		It("cancels the request context when the stream is closed", func() {
 			var handlerCalled bool
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				r.Body = struct {
-					io.Reader
-					io.Closer
-				}{}
+				defer GinkgoRecover()
+				Expect(r.Context().Err()).To(MatchError(context.Canceled))
 				handlerCalled = true
 			})
-			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
-			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
+			str := encodeRequest(exampleGetRequest)
+			str.Close()
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
 			Expect(handlerCalled).To(BeTrue())
 		})
 
-		It("closes the dataStream if the body of POST request was read", func() {
-			var handlerCalled bool
+		It("cancels the request context when the client resets the stream", func() {
+			handlerCalled := make(chan struct{})
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				Expect(r.Host).To(Equal("www.example.com"))
-				Expect(r.Method).To(Equal("POST"))
-				handlerCalled = true
-				// read the request body
-				b := make([]byte, 1000)
-				n, _ := r.Body.Read(b)
-				Expect(n).ToNot(BeZero())
+				defer GinkgoRecover()
+				defer close(handlerCalled)
+				Expect(r.Context().Err()).ToNot(HaveOccurred())
+				closeNotify := w.(http.CloseNotifier).CloseNotify()
+				_, err := ioutil.ReadAll(r.Body)
+				Expect(err).To(BeAssignableToTypeOf(&mockStreamError{}))
+				Expect(r.Context().Done()).To(BeClosed())
+				Eventually(closeNotify).Should(Receive(BeTrue()))
 			})
-			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			dataStream.dataToRead.Write([]byte("foo=bar"))
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-			Expect(dataStream.reset).To(BeFalse())
+			str := encodeRequest(examplePostRequest)
+			str.readErr = &mockStreamError{code: quic.ErrorCode(errorRequestCanceled)}
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			Expect(handlerCalled).To(BeClosed())
+			Expect(str.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestCanceled)))
 		})
 
-		It("ignores PRIORITY frames", func() {
+		It("cancels the request context when the client resets the stream without stopping the response", func() {
+			str := encodeRequest(examplePostRequest)
 			handlerCalled := make(chan struct{})
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				close(handlerCalled)
+				defer GinkgoRecover()
+				defer close(handlerCalled)
+				closeNotify := w.(http.CloseNotifier).CloseNotify()
+				Expect(r.Context().Err()).ToNot(HaveOccurred())
+				// the client sends a RESET_STREAM, but no STOP_SENDING
+				str.readCtxCancel()
+				Eventually(r.Context().Done()).Should(BeClosed())
+				Eventually(closeNotify).Should(Receive(BeTrue()))
+				Expect(str.Context().Err()).ToNot(HaveOccurred())
 			})
-			buf := &bytes.Buffer{}
-			framer := http2.NewFramer(buf, nil)
-			err := framer.WritePriority(10, http2.PriorityParam{Weight: 42})
-			Expect(err).ToNot(HaveOccurred())
-			Expect(buf.Bytes()).ToNot(BeEmpty())
-			headerStream.dataToRead.Write(buf.Bytes())
-			err = s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).ToNot(HaveOccurred())
-			Consistently(handlerCalled).ShouldNot(BeClosed())
-			Expect(dataStream.reset).To(BeFalse())
-			Expect(dataStream.closed).To(BeFalse())
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).ToNot(HaveOccurred())
+			Expect(handlerCalled).To(BeClosed())
 		})
 
-		It("errors when non-header frames are received", func() {
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x06, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
-				'f', 'o', 'o', 'b', 'a', 'r',
-			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).To(MatchError("InvalidHeadersStreamData: expected a header frame"))
+		It("errors when the first frame is not a HEADERS frame", func() {
+			str := newMockStream(0)
+			(&dataFrame{Length: 6}).Write(&str.dataToRead)
+			str.dataToRead.Write([]byte("foobar"))
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).To(MatchError("expected first frame to be a HEADERS frame"))
+			Expect(rerr.connErr).To(Equal(errorFrameUnexpected))
 		})
 
-		It("Cancels the request context when the datstream is closed", func() {
-			var handlerCalled bool
+		It("errors when the HEADERS frame is too large", func() {
+			s.Server.MaxHeaderBytes = 10
+			str := encodeRequest(exampleGetRequest)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).To(HaveOccurred())
+			Expect(rerr.err.Error()).To(ContainSubstring("HEADERS frame too large"))
+			Expect(rerr.streamErr).To(Equal(errorFrameError))
+		})
+
+		It("errors when the header fields can't be decoded", func() {
+			str := newMockStream(0)
+			(&headersFrame{Length: 3}).Write(&str.dataToRead)
+			str.dataToRead.Write([]byte{0x0, 0x0, 0x80})
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).To(HaveOccurred())
+			Expect(rerr.connErr).To(Equal(errorQPACKDecompressionFailed))
+		})
+
+		It("errors when the request is malformed", func() {
+			str := newMockStream(0)
+			Expect(writeHeadersFrame(&str.dataToRead, qpack.NewEncoder(nil, 0), 0, []qpack.HeaderField{{Name: ":method", Value: "GET"}})).To(Succeed())
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).To(MatchError(":path, :authority and :method must not be empty"))
+			Expect(rerr.streamErr).To(Equal(errorMessageError))
+		})
+
+		It("errors when the stream ends before the request was received", func() {
+			str := newMockStream(0)
+			(&headersFrame{Length: 100}).Write(&str.dataToRead)
+			close(str.unblockRead)
+			rerr := s.handleRequest(newServerConn(session), str)
+			Expect(rerr.err).To(HaveOccurred())
+			Expect(rerr.streamErr).To(Equal(errorRequestIncomplete))
+		})
+	})
+
+	Context("handling connections", func() {
+		AfterEach(func() {
+			session.Close()
+		})
+
+		It("opens the control stream and sends a SETTINGS frame", func() {
+			session.Close() // makes handleConn return after opening the control stream
+			s.handleConn(session)
+			Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+			str := session.getOpenedUniStreams()[0]
+			Expect(str.dataWritten.Bytes()).To(Equal([]byte{streamTypeControlStream, 0x4, 0x0}))
+		})
+
+		It("handles requests", func() {
+			handlerCalled := make(chan struct{})
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				defer GinkgoRecover()
-				err := r.Context().Err()
-				Expect(err).To(HaveOccurred())
-				Expect(err.Error()).To(Equal("context canceled"))
-				handlerCalled = true
-			})
-			headerStream.dataToRead.Write([]byte{
-				0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
-				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+				Expect(r.Host).To(Equal("www.example.com"))
+				close(handlerCalled)
 			})
-			dataStream.Close()
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
-			Expect(err).NotTo(HaveOccurred())
-			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-			Expect(dataStream.remoteClosed).To(BeTrue())
-			Expect(dataStream.reset).To(BeFalse())
+			req, err := http.NewRequest("GET", "https://www.example.com", nil)
+			Expect(err).ToNot(HaveOccurred())
+			str := encodeRequest(req)
+			session.streamsToAccept <- str
+			go s.handleConn(session)
+			Eventually(handlerCalled).Should(BeClosed())
+			Eventually(str.Context().Done()).Should(BeClosed()) // closing the stream cancels the context
 		})
-	})
 
-	It("handles the header stream", func() {
-		var handlerCalled bool
-		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			Expect(r.Host).To(Equal("www.example.com"))
-			handlerCalled = true
-		})
-		headerStream := &mockStream{id: 3}
-		headerStream.dataToRead.Write([]byte{
-			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
-			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-		})
-		session.streamToAccept = headerStream
-		go s.handleHeaderStream(session)
-		Eventually(func() bool { return handlerCalled }).Should(BeTrue())
-	})
+		It("resets the stream when handling a request fails", func() {
+			str := newMockStream(0)
+			(&headersFrame{Length: 100}).Write(&str.dataToRead)
+			close(str.unblockRead)
+			session.streamsToAccept <- str
+			go s.handleConn(session)
+			Eventually(str.isCanceledWrite).Should(BeTrue())
+			Expect(str.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestIncomplete)))
+			Expect(str.closed).To(BeFalse())
+			Expect(session.isClosed()).To(BeFalse())
+		})
 
-	It("closes the connection if it encounters an error on the header stream", func() {
-		var handlerCalled bool
-		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			handlerCalled = true
-		})
-		headerStream := &mockStream{id: 3}
-		headerStream.dataToRead.Write(bytes.Repeat([]byte{0}, 100))
-		session.streamToAccept = headerStream
-		go s.handleHeaderStream(session)
-		Consistently(func() bool { return handlerCalled }).Should(BeFalse())
-		Eventually(func() bool { return session.closed }).Should(BeTrue())
-		Expect(session.closedWithError).To(MatchError(qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")))
-	})
+		It("closes the connection on connection errors", func() {
+			str := newMockStream(0)
+			(&dataFrame{Length: 6}).Write(&str.dataToRead)
+			str.dataToRead.Write([]byte("foobar"))
+			session.streamsToAccept <- str
+			go s.handleConn(session)
+			Eventually(session.isClosed).Should(BeTrue())
+			code, err := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorFrameUnexpected)))
+			Expect(err).To(MatchError("expected first frame to be a HEADERS frame"))
+		})
 
-	It("supports closing after first request", func() {
-		s.CloseAfterFirstRequest = true
-		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-		headerStream := &mockStream{id: 3}
-		headerStream.dataToRead.Write([]byte{
-			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
-			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-		})
-		session.streamToAccept = headerStream
-		Expect(session.closed).To(BeFalse())
-		go s.handleHeaderStream(session)
-		Eventually(func() bool { return session.closed }).Should(BeTrue())
-	})
+		It("closes the connection if the client opens a push stream", func() {
+			str := newMockStream(2)
+			str.dataToRead.Write([]byte{streamTypePushStream})
+			session.uniStreamsToAccept <- str
+			go s.handleConn(session)
+			Eventually(session.isClosed).Should(BeTrue())
+			code, _ := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorStreamCreationError)))
+		})
+
+		It("supports closing after first request", func() {
+			s.CloseAfterFirstRequest = true
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			req, err := http.NewRequest("GET", "https://www.example.com", nil)
+			Expect(err).ToNot(HaveOccurred())
+			session.streamsToAccept <- encodeRequest(req)
+			Expect(session.isClosed()).To(BeFalse())
+			go s.handleConn(session)
+			Eventually(session.isClosed).Should(BeTrue())
+		})
 
-	It("uses the default handler as fallback", func() {
-		var handlerCalled bool
-		http.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			Expect(r.Host).To(Equal("www.example.com"))
-			handlerCalled = true
-		}))
-		headerStream := &mockStream{id: 3}
-		headerStream.dataToRead.Write([]byte{
-			0x0, 0x0, 0x11, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5,
-			// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
-			0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
-		})
-		session.streamToAccept = headerStream
-		go s.handleHeaderStream(session)
-		Eventually(func() bool { return handlerCalled }).Should(BeTrue())
+		It("uses the default handler as fallback", func() {
+			handlerCalled := make(chan struct{})
+			http.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Host).To(Equal("www.example.com"))
+				close(handlerCalled)
+			}))
+			req, err := http.NewRequest("GET", "https://www.example.com", nil)
+			Expect(err).ToNot(HaveOccurred())
+			session.streamsToAccept <- encodeRequest(req)
+			go s.handleConn(session)
+			Eventually(handlerCalled).Should(BeClosed())
+		})
 	})
 
 	Context("setting http headers", func() {
-		var expected http.Header
-
-		getExpectedHeader := func(versions []protocol.VersionNumber) http.Header {
-			var versionsAsString []string
-			for _, v := range versions {
-				versionsAsString = append(versionsAsString, v.ToAltSvc())
-			}
-			return http.Header{
-				"Alt-Svc": {fmt.Sprintf(`quic=":443"; ma=2592000; v="%s"`, strings.Join(versionsAsString, ","))},
-			}
-		}
-
-		BeforeEach(func() {
-			Expect(getExpectedHeader([]protocol.VersionNumber{99, 90, 9})).To(Equal(http.Header{"Alt-Svc": {`quic=":443"; ma=2592000; v="99,90,9"`}}))
-			expected = getExpectedHeader(protocol.SupportedVersions)
-		})
+		expected := http.Header{"Alt-Svc": {`h3=":443"; ma=2592000`}}
 
 		It("sets proper headers with numeric port", func() {
 			s.Server.Addr = ":443"
@@ -519,9 +597,129 @@ var _ = Describe("H2 server", func() {
 		}, 0.5)
 	})
 
-	It("closes gracefully", func() {
-		err := s.CloseGracefully(0)
-		Expect(err).NotTo(HaveOccurred())
+	Context("closing gracefully", func() {
+		var getRequest *http.Request
+
+		BeforeEach(func() {
+			var err error
+			getRequest, err = http.NewRequest("GET", "https://www.example.com", nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			session.Close()
+		})
+
+		// getGoAwayFrames parses the GOAWAY frames sent on a control stream
+		getGoAwayFrames := func(str *mockStream) []frame {
+			r := bytes.NewReader(str.getDataWritten())
+			_, err := utils.ReadVarInt(r) // stream type
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			var frames []frame
+			for r.Len() > 0 {
+				f, err := parseNextFrame(r)
+				ExpectWithOffset(1, err).ToNot(HaveOccurred())
+				if _, ok := f.(*goAwayFrame); ok {
+					frames = append(frames, f)
+				}
+			}
+			return frames
+		}
+
+		It("closes gracefully", func() {
+			err := s.CloseGracefully(0)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("sends a GOAWAY frame and waits for running requests", func() {
+			handlerCalled := make(chan struct{})
+			unblock := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(handlerCalled)
+				<-unblock
+			})
+			str := encodeRequest(getRequest)
+			session.streamsToAccept <- str
+			go s.handleConn(session)
+			Eventually(handlerCalled).Should(BeClosed())
+			Expect(session.getOpenedUniStreams()).To(HaveLen(1))
+			controlStr := session.getOpenedUniStreams()[0]
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(s.CloseGracefully(time.Hour)).To(Succeed())
+				close(done)
+			}()
+			Eventually(func() []frame { return getGoAwayFrames(controlStr) }).Should(Equal([]frame{&goAwayFrame{StreamID: 4}}))
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(session.isClosed()).To(BeFalse())
+
+			// requests sent after the GOAWAY frame are rejected
+			str2 := encodeRequest(getRequest)
+			str2.id = 4
+			session.streamsToAccept <- str2
+			Eventually(str2.isCanceledWrite).Should(BeTrue())
+			Expect(str2.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestRejected)))
+
+			close(unblock)
+			Eventually(done).Should(BeClosed())
+			Expect(str.Context().Done()).To(BeClosed()) // the response was completed
+			Expect(session.isClosed()).To(BeTrue())
+			code, _ := session.getCloseError()
+			Expect(code).To(Equal(quic.ErrorCode(errorNoError)))
+		})
+
+		It("closes the sessions when the timeout expires", func() {
+			handlerCalled := make(chan struct{})
+			unblock := make(chan struct{})
+			defer close(unblock)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(handlerCalled)
+				<-unblock
+			})
+			session.streamsToAccept <- encodeRequest(getRequest)
+			go s.handleConn(session)
+			Eventually(handlerCalled).Should(BeClosed())
+
+			start := time.Now()
+			Expect(s.CloseGracefully(50 * time.Millisecond)).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+			Expect(session.isClosed()).To(BeTrue())
+		})
+
+		It("doesn't accept requests on new sessions", func() {
+			handlerCalled := make(chan struct{})
+			unblock := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(handlerCalled)
+				<-unblock
+			})
+			session.streamsToAccept <- encodeRequest(getRequest)
+			go s.handleConn(session)
+			Eventually(handlerCalled).Should(BeClosed())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(s.CloseGracefully(time.Hour)).To(Succeed())
+				close(done)
+			}()
+			Eventually(func() []frame { return getGoAwayFrames(session.getOpenedUniStreams()[0]) }).ShouldNot(BeEmpty())
+
+			session2 := newMockSession()
+			defer session2.Close()
+			str := encodeRequest(getRequest)
+			session2.streamsToAccept <- str
+			go s.handleConn(session2)
+			Eventually(session2.getOpenedUniStreams).Should(HaveLen(1))
+			Eventually(func() []frame { return getGoAwayFrames(session2.getOpenedUniStreams()[0]) }).Should(Equal([]frame{&goAwayFrame{StreamID: 0}}))
+			Eventually(str.isCanceledWrite).Should(BeTrue())
+			Expect(str.canceledErrorCode).To(Equal(quic.ErrorCode(errorRequestRejected)))
+
+			close(unblock)
+			Eventually(done).Should(BeClosed())
+			Expect(session2.isClosed()).To(BeTrue())
+		})
 	})
 
 	It("errors when listening fails", func() {
@@ -533,4 +731,21 @@ var _ = Describe("H2 server", func() {
 		err := ListenAndServeQUIC("", fullpem, privkey, nil)
 		Expect(err).To(MatchError(testErr))
 	})
+
+	It("shuts down the TLS server when the QUIC server fails", func() {
+		testErr := errors.New("listen error")
+		quicListen = func(net.PacketConn, *tls.Config, *quic.Config) (quic.Listener, error) {
+			return nil, testErr
+		}
+		// find a free port
+		ln, err := net.Listen("tcp", "localhost:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr := ln.Addr().String()
+		Expect(ln.Close()).To(Succeed())
+		fullpem, privkey := testdata.GetCertificatePaths()
+		err = ListenAndServe(addr, fullpem, privkey, nil)
+		Expect(err).To(MatchError(testErr))
+		_, err = net.Dial("tcp", addr)
+		Expect(err).To(HaveOccurred())
+	})
 })
@@ -0,0 +1,172 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// happyEyeballsDelay is the time we wait for a connection attempt to complete the handshake,
+// before starting the next attempt.
+// This is the value recommended by section 5 of RFC 8305.
+const happyEyeballsDelay = 250 * time.Millisecond
+
+var (
+	// make it possible to mock name resolution and dialing in the tests
+	resolveUDPAddrs = resolveUDPAddrsImpl
+	dialUDPAddr     = dialUDPAddrImpl
+)
+
+// resolveUDPAddrsImpl resolves all IPv4 and IPv6 addresses of a host:port address.
+func resolveUDPAddrsImpl(ctx context.Context, addr string) ([]*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.DefaultResolver.LookupPort(ctx, "udp", portStr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]*net.UDPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone})
+	}
+	return addrs, nil
+}
+
+// dialUDPAddrImpl establishes a QUIC connection to a single address.
+// It creates a packet conn of the address family of the remote address.
+func dialUDPAddrImpl(
+	ctx context.Context,
+	remoteAddr *net.UDPAddr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (Session, error) {
+	network := "udp4"
+	localAddr := &net.UDPAddr{IP: net.IPv4zero}
+	if remoteAddr.IP.To4() == nil {
+		network = "udp6"
+		localAddr = &net.UDPAddr{IP: net.IPv6unspecified}
+	}
+	udpConn, err := net.ListenUDP(network, localAddr)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := dialContext(ctx, udpConn, remoteAddr, host, tlsConf, config, true)
+	if err != nil {
+		// The packet conn is not closed if dialing fails before the session is run.
+		udpConn.Close()
+		return nil, err
+	}
+	return sess, nil
+}
+
+// sortAddrsForHappyEyeballs orders the addresses such that address families alternate,
+// starting with the family of the first address, as described in section 4 of RFC 8305.
+func sortAddrsForHappyEyeballs(addrs []*net.UDPAddr) []*net.UDPAddr {
+	if len(addrs) == 0 {
+		return addrs
+	}
+	var primary, secondary []*net.UDPAddr
+	firstIsV4 := addrs[0].IP.To4() != nil
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == firstIsV4 {
+			primary = append(primary, addr)
+		} else {
+			secondary = append(secondary, addr)
+		}
+	}
+	sorted := make([]*net.UDPAddr, 0, len(addrs))
+	for len(primary) > 0 || len(secondary) > 0 {
+		if len(primary) > 0 {
+			sorted = append(sorted, primary[0])
+			primary = primary[1:]
+		}
+		if len(secondary) > 0 {
+			sorted = append(sorted, secondary[0])
+			secondary = secondary[1:]
+		}
+	}
+	return sorted
+}
+
+type dialResult struct {
+	sess Session
+	err  error
+}
+
+// dialHappyEyeballs races handshakes to the addresses, starting a new attempt every happyEyeballsDelay,
+// or as soon as the previous attempt failed.
+// The first session to complete the handshake is returned, all other attempts are cancelled.
+// If all attempts fail, the error of the first attempt is returned.
+func dialHappyEyeballs(
+	ctx context.Context,
+	addrs []*net.UDPAddr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (Session, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(addrs))
+	var started, failed int
+	startNext := func() <-chan time.Time {
+		addr := addrs[started]
+		started++
+		go func() {
+			sess, err := dialUDPAddr(ctx, addr, host, tlsConf.Clone(), config)
+			results <- dialResult{sess: sess, err: err}
+		}()
+		if started == len(addrs) {
+			return nil
+		}
+		return time.After(happyEyeballsDelay)
+	}
+
+	var firstErr error
+	nextAttempt := startNext()
+	for {
+		select {
+		case <-nextAttempt:
+			nextAttempt = startNext()
+		case res := <-results:
+			if res.err == nil {
+				cancel()
+				// Close the sessions of attempts that completed the handshake at the same time.
+				go closeDialResults(results, started-failed-1)
+				return res.sess, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			failed++
+			if failed == len(addrs) {
+				return nil, firstErr
+			}
+			// If all running attempts failed, start the next one right away.
+			if failed == started {
+				nextAttempt = startNext()
+			}
+		case <-ctx.Done():
+			go closeDialResults(results, started-failed)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// closeDialResults waits for the outstanding connection attempts,
+// and closes all sessions that were established anyway.
+func closeDialResults(results <-chan dialResult, num int) {
+	for i := 0; i < num; i++ {
+		if res := <-results; res.err == nil {
+			res.sess.Close()
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Happy Eyeballs", func() {
+	var (
+		origDialUDPAddr     func(context.Context, *net.UDPAddr, string, *tls.Config, *Config) (Session, error)
+		origResolveUDPAddrs func(context.Context, string) ([]*net.UDPAddr, error)
+	)
+
+	ipv4 := func(last byte) *net.UDPAddr { return &net.UDPAddr{IP: net.IPv4(192, 0, 2, last), Port: 443} }
+	ipv6 := func(last byte) *net.UDPAddr {
+		return &net.UDPAddr{IP: net.IP{0x20, 0x01, 0xd, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, last}, Port: 443}
+	}
+
+	BeforeEach(func() {
+		origDialUDPAddr = dialUDPAddr
+		origResolveUDPAddrs = resolveUDPAddrs
+	})
+
+	AfterEach(func() {
+		dialUDPAddr = origDialUDPAddr
+		resolveUDPAddrs = origResolveUDPAddrs
+	})
+
+	Context("sorting addresses", func() {
+		It("alternates address families, starting with the family of the first address", func() {
+			addrs := []*net.UDPAddr{ipv6(1), ipv6(2), ipv6(3), ipv4(1), ipv4(2)}
+			Expect(sortAddrsForHappyEyeballs(addrs)).To(Equal([]*net.UDPAddr{ipv6(1), ipv4(1), ipv6(2), ipv4(2), ipv6(3)}))
+			addrs = []*net.UDPAddr{ipv4(1), ipv6(1), ipv6(2)}
+			Expect(sortAddrsForHappyEyeballs(addrs)).To(Equal([]*net.UDPAddr{ipv4(1), ipv6(1), ipv6(2)}))
+		})
+
+		It("handles a single address family", func() {
+			addrs := []*net.UDPAddr{ipv4(1), ipv4(2)}
+			Expect(sortAddrsForHappyEyeballs(addrs)).To(Equal(addrs))
+		})
+	})
+
+	Context("dialing", func() {
+		type attempt struct {
+			ctx    context.Context
+			addr   *net.UDPAddr
+			result chan dialResult
+		}
+		var attempts chan *attempt
+
+		BeforeEach(func() {
+			attempts = make(chan *attempt, 10)
+			dialUDPAddr = func(ctx context.Context, addr *net.UDPAddr, _ string, _ *tls.Config, _ *Config) (Session, error) {
+				a := &attempt{ctx: ctx, addr: addr, result: make(chan dialResult, 1)}
+				attempts <- a
+				res := <-a.result
+				return res.sess, res.err
+			}
+		})
+
+		It("dials a single address directly", func() {
+			resolveUDPAddrs = func(context.Context, string) ([]*net.UDPAddr, error) {
+				return []*net.UDPAddr{ipv6(1)}, nil
+			}
+			sess := NewMockQuicSession(mockCtrl)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				s, err := DialAddr("example.com:443", nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				close(done)
+			}()
+			var a *attempt
+			Eventually(attempts).Should(Receive(&a))
+			Expect(a.addr).To(Equal(ipv6(1)))
+			a.result <- dialResult{sess: sess}
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("sets the SNI before dialing", func() {
+			resolveUDPAddrs = func(context.Context, string) ([]*net.UDPAddr, error) {
+				return []*net.UDPAddr{ipv6(1), ipv4(1)}, nil
+			}
+			serverNames := make(chan string, 2)
+			dialUDPAddr = func(_ context.Context, _ *net.UDPAddr, _ string, tlsConf *tls.Config, _ *Config) (Session, error) {
+				serverNames <- tlsConf.ServerName
+				return nil, errors.New("dial error")
+			}
+			_, err := DialAddr("example.com:443", nil, nil)
+			Expect(err).To(MatchError("dial error"))
+			Expect(serverNames).To(Receive(Equal("example.com")))
+			Expect(serverNames).To(Receive(Equal("example.com")))
+		})
+
+		It("errors if the name can't be resolved", func() {
+			testErr := errors.New("resolution failed")
+			resolveUDPAddrs = func(context.Context, string) ([]*net.UDPAddr, error) { return nil, testErr }
+			_, err := DialAddr("example.com:443", nil, nil)
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("staggers the connection attempts, and cancels the losers", func() {
+			sess := NewMockQuicSession(mockCtrl)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				s, err := dialHappyEyeballs(context.Background(), []*net.UDPAddr{ipv6(1), ipv4(1), ipv6(2)}, "example.com:443", &tls.Config{}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				close(done)
+			}()
+			var first, second *attempt
+			Eventually(attempts).Should(Receive(&first))
+			start := time.Now()
+			Expect(first.addr).To(Equal(ipv6(1)))
+			Eventually(attempts, 2*happyEyeballsDelay).Should(Receive(&second))
+			Expect(time.Since(start)).To(BeNumerically(">", happyEyeballsDelay*3/4))
+			Expect(second.addr).To(Equal(ipv4(1)))
+			// the second attempt completes the handshake first
+			second.result <- dialResult{sess: sess}
+			Eventually(done).Should(BeClosed())
+			Eventually(first.ctx.Done()).Should(BeClosed())
+			first.result <- dialResult{err: first.ctx.Err()}
+			// the third attempt is never started
+			Consistently(attempts, 2*happyEyeballsDelay).ShouldNot(Receive())
+		})
+
+		It("starts the next attempt right away when an attempt fails", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := dialHappyEyeballs(context.Background(), []*net.UDPAddr{ipv6(1), ipv4(1)}, "example.com:443", &tls.Config{}, nil)
+				Expect(err).To(MatchError("first error"))
+				close(done)
+			}()
+			var first, second *attempt
+			Eventually(attempts).Should(Receive(&first))
+			first.result <- dialResult{err: errors.New("first error")}
+			Eventually(attempts, happyEyeballsDelay/2).Should(Receive(&second))
+			second.result <- dialResult{err: errors.New("second error")}
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("closes sessions that complete the handshake after the winner", func() {
+			winner := NewMockQuicSession(mockCtrl)
+			loser := NewMockQuicSession(mockCtrl)
+			closed := make(chan struct{})
+			loser.EXPECT().Close().Do(func() { close(closed) })
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				s, err := dialHappyEyeballs(context.Background(), []*net.UDPAddr{ipv6(1), ipv4(1)}, "example.com:443", &tls.Config{}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(winner))
+				close(done)
+			}()
+			var first, second *attempt
+			Eventually(attempts).Should(Receive(&first))
+			Eventually(attempts, 2*happyEyeballsDelay).Should(Receive(&second))
+			first.result <- dialResult{sess: winner}
+			Eventually(done).Should(BeClosed())
+			second.result <- dialResult{sess: loser}
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("returns when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := dialHappyEyeballs(ctx, []*net.UDPAddr{ipv6(1), ipv4(1)}, "example.com:443", &tls.Config{}, nil)
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+			var first *attempt
+			Eventually(attempts).Should(Receive(&first))
+			cancel()
+			Eventually(done).Should(BeClosed())
+			Eventually(first.ctx.Done()).Should(BeClosed())
+			first.result <- dialResult{err: first.ctx.Err()}
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
@@ -16,6 +17,19 @@ type StreamID = protocol.StreamID
 // A VersionNumber is a QUIC version number.
 type VersionNumber = protocol.VersionNumber
 
+// A ConnectionID is a QUIC connection ID.
+type ConnectionID = protocol.ConnectionID
+
+// A ConnectionIDGenerator generates the connection IDs issued by a server.
+// It can be used to encode routing information for a load balancer into the connection IDs.
+type ConnectionIDGenerator interface {
+	// GenerateConnectionID generates a new connection ID.
+	// It must return a connection ID of length ConnectionIDLen.
+	GenerateConnectionID() (ConnectionID, error)
+	// ConnectionIDLen returns the length of the connection IDs.
+	ConnectionIDLen() int
+}
+
 // A Cookie can be used to verify the ownership of the client address.
 type Cookie struct {
 	RemoteAddr string
@@ -25,9 +39,25 @@ type Cookie struct {
 // ConnectionState records basic details about the QUIC connection.
 type ConnectionState = handshake.ConnectionState
 
+// A TransportParameter is a transport parameter that is not defined by the QUIC specification.
+type TransportParameter = handshake.TransportParameter
+
+// PeerTransportParameters are the transport parameters sent by the peer.
+type PeerTransportParameters = handshake.PeerTransportParameters
+
+// A PSKConfig configures an external pre-shared key for the TLS 1.3 handshake.
+type PSKConfig = handshake.PSKConfig
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
+// A MemoryBudget limits the flow control credit that sessions sharing it can grant to their peers.
+// Since a peer can never send more data than it was granted, this limits the memory used for receive buffers.
+type MemoryBudget = flowcontrol.MemoryBudget
+
+// MemoryBudgetStats are statistics about the use of a MemoryBudget.
+type MemoryBudgetStats = flowcontrol.MemoryBudgetStats
+
 // Stream is the interface implemented by QUIC streams
 type Stream interface {
 	// StreamID returns the stream ID.
@@ -38,12 +68,24 @@ type Stream interface {
 	// If the stream was canceled by the peer, the error implements the StreamError
 	// interface, and Canceled() == true.
 	io.Reader
+	// ReadChunk returns the next chunk of data received on the stream, together with its offset.
+	// Unlike Read, it doesn't deliver the data in order: chunks are returned as soon as they arrive,
+	// so a lost packet doesn't block the delivery of data received after it.
+	// Every byte of the stream is returned exactly once.
+	// Once the last chunk has been returned, ReadChunk returns io.EOF (possibly together with that chunk).
+	// After calling ReadChunk, Read must not be used on the stream any more.
+	ReadChunk() (offset uint64, data []byte, err error)
 	// Write writes data to the stream.
+	// It returns as soon as the data has been copied into the stream's send buffer,
+	// and only blocks while the send buffer is full (see Config.StreamSendBufferSize).
 	// Write can be made to time out and return a net.Error with Timeout() == true
 	// after a fixed time limit; see SetDeadline and SetWriteDeadline.
 	// If the stream was canceled by the peer, the error implements the StreamError
 	// interface, and Canceled() == true.
 	io.Writer
+	// TryWrite writes as much data to the stream's send buffer as currently fits, without blocking.
+	// It returns the number of bytes written, which might be smaller than len(p).
+	TryWrite(p []byte) (int, error)
 	// Close closes the write-direction of the stream.
 	// Future calls to Write are not permitted after calling Close.
 	// It must not be called concurrently with Write.
@@ -54,6 +96,12 @@ type Stream interface {
 	// Data already written, but not yet delivered to the peer is not guaranteed to be delivered reliably.
 	// Write will unblock immediately, and future calls to Write will fail.
 	CancelWrite(ErrorCode) error
+	// CancelWriteAt aborts sending on this stream, but guarantees that the first reliableSize bytes
+	// are delivered to the peer (the reliable stream reset extension).
+	// reliableSize must not be larger than the amount of data written to the stream.
+	// It requires the peer to support the extension, see Config.EnableReliableStreamReset.
+	// Write will unblock immediately, and future calls to Write will fail.
+	CancelWriteAt(code ErrorCode, reliableSize uint64) error
 	// CancelRead aborts receiving on this stream.
 	// It will ask the peer to stop transmitting stream data.
 	// Read will unblock immediately, and future Read calls will fail.
@@ -62,6 +110,11 @@ type Stream interface {
 	// This happens when Close() is called, or when the stream is reset (either locally or remotely).
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
+	// The read context is canceled as soon as the read-side of the stream is aborted.
+	// This happens when CancelRead() is called, when the peer resets the stream, or when the session is closed.
+	// It is not canceled when the stream was read until the end.
+	// Warning: This API should not be considered stable and might change soon.
+	ReadContext() context.Context
 	// SetReadDeadline sets the deadline for future Read calls and
 	// any currently-blocked Read call.
 	// A zero value for t means Read will not time out.
@@ -84,8 +137,12 @@ type ReceiveStream interface {
 	StreamID() StreamID
 	// see Stream.Read
 	io.Reader
+	// see Stream.ReadChunk
+	ReadChunk() (offset uint64, data []byte, err error)
 	// see Stream.CancelRead
 	CancelRead(ErrorCode) error
+	// see Stream.ReadContext
+	ReadContext() context.Context
 	// see Stream.SetReadDealine
 	SetReadDeadline(t time.Time) error
 }
@@ -96,10 +153,14 @@ type SendStream interface {
 	StreamID() StreamID
 	// see Stream.Write
 	io.Writer
+	// see Stream.TryWrite
+	TryWrite(p []byte) (int, error)
 	// see Stream.Close
 	io.Closer
 	// see Stream.CancelWrite
 	CancelWrite(ErrorCode) error
+	// see Stream.CancelWriteAt
+	CancelWriteAt(code ErrorCode, reliableSize uint64) error
 	// see Stream.Context
 	Context() context.Context
 	// see Stream.SetWriteDeadline
@@ -113,12 +174,48 @@ type StreamError interface {
 	ErrorCode() ErrorCode
 }
 
+// StreamCredit describes the stream credit granted to the peer for one stream type.
+type StreamCredit struct {
+	// MaxStreams is the total number of streams the peer is allowed to open (the value of the last MAX_STREAMS frame).
+	MaxStreams uint64
+	// Remaining is the number of streams the peer can still open without receiving new credit.
+	Remaining uint64
+}
+
+// A BlockedEventType is the type of a BlockedEvent.
+type BlockedEventType uint8
+
+const (
+	// BlockedData means that connection-level flow control is blocking (DATA_BLOCKED).
+	BlockedData BlockedEventType = 1 + iota
+	// BlockedStreamData means that stream-level flow control is blocking (STREAM_DATA_BLOCKED).
+	BlockedStreamData
+	// BlockedBidiStreams means that the limit of bidirectional streams is blocking (STREAMS_BLOCKED).
+	BlockedBidiStreams
+	// BlockedUniStreams means that the limit of unidirectional streams is blocking (STREAMS_BLOCKED).
+	BlockedUniStreams
+)
+
+// A BlockedEvent is reported when one of the endpoints is blocked by a flow control or stream limit of its peer.
+type BlockedEvent struct {
+	Type BlockedEventType
+	// Local is true if we are blocked by the peer's limit, and false if the peer told us that it is blocked by our limit.
+	Local bool
+	// StreamID is the ID of the blocked stream. It is only set for BlockedStreamData.
+	StreamID StreamID
+	// Limit is the limit that is blocking.
+	// For flow control, it is a byte offset. For stream limits, it is the number of streams.
+	Limit uint64
+}
+
 // A Session is a QUIC connection between two peers.
 type Session interface {
 	// AcceptStream returns the next stream opened by the peer, blocking until one is available.
-	AcceptStream() (Stream, error)
+	// If the context is cancelled, it returns ctx.Err().
+	AcceptStream(context.Context) (Stream, error)
 	// AcceptUniStream returns the next unidirectional stream opened by the peer, blocking until one is available.
-	AcceptUniStream() (ReceiveStream, error)
+	// If the context is cancelled, it returns ctx.Err().
+	AcceptUniStream(context.Context) (ReceiveStream, error)
 	// OpenStream opens a new bidirectional QUIC stream.
 	// It returns a special error when the peer's concurrent stream limit is reached.
 	// There is no signaling to the peer about new streams:
@@ -127,29 +224,58 @@ type Session interface {
 	OpenStream() (Stream, error)
 	// OpenStreamSync opens a new bidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
-	OpenStreamSync() (Stream, error)
+	// If the context is cancelled, it returns ctx.Err().
+	OpenStreamSync(context.Context) (Stream, error)
 	// OpenUniStream opens a new outgoing unidirectional QUIC stream.
 	// It returns a special error when the peer's concurrent stream limit is reached.
 	// TODO(#1152): Enable testing for the special error
 	OpenUniStream() (SendStream, error)
 	// OpenUniStreamSync opens a new outgoing unidirectional QUIC stream.
 	// It blocks until the peer's concurrent stream limit allows a new stream to be opened.
-	OpenUniStreamSync() (SendStream, error)
+	// If the context is cancelled, it returns ctx.Err().
+	OpenUniStreamSync(context.Context) (SendStream, error)
 	// LocalAddr returns the local address.
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
 	RemoteAddr() net.Addr
+	// SetMaxIncomingStreams sets the maximum number of concurrent bidirectional streams that the peer is allowed to open.
+	// If set to a negative value, the peer won't be granted any more bidirectional streams.
+	// Raising the limit grants the peer additional stream credit right away.
+	// Credit that was already granted can't be revoked,
+	// so lowering the limit only takes effect once the peer has used up its remaining credit.
+	SetMaxIncomingStreams(int)
+	// SetMaxIncomingUniStreams is like SetMaxIncomingStreams, but for unidirectional streams.
+	SetMaxIncomingUniStreams(int)
+	// IncomingStreamCredit returns the bidirectional stream credit granted to the peer.
+	IncomingStreamCredit() StreamCredit
+	// IncomingUniStreamCredit returns the unidirectional stream credit granted to the peer.
+	IncomingUniStreamCredit() StreamCredit
 	// Close the connection.
+	// It sends a CONNECTION_CLOSE with application error code 0.
 	io.Closer
 	// Close the connection with an error.
 	// The error must not be nil.
 	CloseWithError(ErrorCode, error) error
 	// The context is cancelled when the session is closed.
+	// Its Err method then returns the reason the session was closed,
+	// for example an *ApplicationError, a *TransportError or an *IdleTimeoutError.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
+	// HandshakeComplete returns a context that is cancelled when the handshake completes.
+	// It is also cancelled when the session is closed before the handshake completed.
+	// Use Context().Err() to find out if the session is still alive.
+	HandshakeComplete() context.Context
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() ConnectionState
+	// Migrate moves the session to a new packet conn, e.g. after the network interface changed.
+	// The new path is validated before the session switches to it,
+	// and the old packet conn is released afterwards. It is closed if it was created by DialAddr.
+	// If validation fails or the context is cancelled, the session keeps using the old packet conn.
+	// It can only be used by the client, after the handshake completed.
+	// The session switches to an unused connection ID issued by the server on the new path,
+	// and fails to migrate if the server didn't issue one.
+	Migrate(context.Context, net.PacketConn) error
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
@@ -163,8 +289,13 @@ type Config struct {
 	// If not set, the interpretation depends on where the Config is used:
 	// If used for dialing an address, a 0 byte connection ID will be used.
 	// If used for a server, or dialing on a packet conn, a 4 byte connection ID will be used.
-	// When dialing on a packet conn, the ConnectionIDLength value must be the same for every Dial call.
+	// Clients and servers using different connection ID lengths can share a packet conn.
 	ConnectionIDLength int
+	// ConnectionIDGenerator generates all connection IDs issued by the server.
+	// If set, ConnectionIDLength is ignored, and the length returned by the generator is used.
+	// If not set, random connection IDs of length ConnectionIDLength are used.
+	// This option is only valid for the server.
+	ConnectionIDGenerator ConnectionIDGenerator
 	// HandshakeTimeout is the maximum duration that the cryptographic handshake may take.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 10 seconds.
@@ -185,6 +316,14 @@ type Config struct {
 	// MaxReceiveConnectionFlowControlWindow is the connection-level flow control window for receiving data.
 	// If this value is zero, it will default to 1.5 MB for the server and 15 MB for the client.
 	MaxReceiveConnectionFlowControlWindow uint64
+	// ReceiveMemoryBudget limits the flow control credit that all sessions of a server can grant in total.
+	// The initial flow control windows of a new session are reduced to the budget that's still available,
+	// and new sessions are refused once the budget can't cover a minimum window.
+	// The receive window of a session (and of its streams) is only increased while there's budget left.
+	// The budget is shared by all sessions of all servers that use this Config.
+	// If not set, the flow control windows are only limited by the values above.
+	// This option is only valid for the server.
+	ReceiveMemoryBudget *MemoryBudget
 	// MaxIncomingStreams is the maximum number of concurrent bidirectional streams that a peer is allowed to open.
 	// If not set, it will default to 100.
 	// If set to a negative value, it doesn't allow any bidirectional streams.
@@ -193,8 +332,46 @@ type Config struct {
 	// If not set, it will default to 100.
 	// If set to a negative value, it doesn't allow any unidirectional streams.
 	MaxIncomingUniStreams int
+	// StreamSendBufferSize is the size of the send buffer of every stream.
+	// Stream.Write blocks while the send buffer is full.
+	// If this value is zero, it will default to 64 kB.
+	StreamSendBufferSize uint64
 	// KeepAlive defines whether this peer will periodically send PING frames to keep the connection alive.
 	KeepAlive bool
+	// AdditionalTransportParameters are sent to the peer in addition to the standard transport parameters.
+	// They can be used to negotiate application features during the handshake.
+	// The IDs must not collide with the IDs of the transport parameters defined by the QUIC specification,
+	// and must not be reserved for greasing.
+	// If versions other than QUIC version 1 are enabled, IDs must fit into 16 bits.
+	// The transport parameters sent by the peer are available via Session.ConnectionState().PeerTransportParameters.
+	AdditionalTransportParameters []TransportParameter
+	// EnableReliableStreamReset enables the reliable stream reset extension (RESET_STREAM_AT frames).
+	// When enabled, the peer may reset streams reliably.
+	// Stream.CancelWriteAt can only be used if the peer enabled the extension as well.
+	// It is only supported in QUIC version 1.
+	EnableReliableStreamReset bool
+	// OnBlocked is called when one of the endpoints is blocked by a flow control or stream limit.
+	// This allows applications to distinguish flow control stalls from a slow network.
+	// It is called from the session's run loop, so it must not block.
+	// In particular, it must not call methods of the Session that wait for the peer, e.g. OpenStreamSync or AcceptStream.
+	OnBlocked func(Session, BlockedEvent)
+	// AcceptEarlySessions makes Listener.Accept return sessions as soon as the client's Initial packet was processed,
+	// instead of waiting for the handshake to complete.
+	// This allows the server to send 0.5-RTT data, before the client's identity and address are verified.
+	// Use Session.HandshakeComplete to wait for the handshake to complete.
+	// This option is only valid for the server.
+	AcceptEarlySessions bool
+	// PreferredAddressIPv4 and PreferredAddressIPv6 are advertised to the client in the preferred_address transport parameter.
+	// After the handshake, the client validates the address of the same family as the address it dialed, and migrates to it.
+	// The server must receive packets sent to these addresses on the same net.PacketConn.
+	// This option is only valid for the server.
+	PreferredAddressIPv4 *net.UDPAddr
+	PreferredAddressIPv6 *net.UDPAddr
+	// ExternalPSK configures an external pre-shared key.
+	// The handshake is then authenticated by the PSK instead of a certificate chain.
+	// For the client, Identity and Key must be set. For the server, GetKey must be set.
+	// The PSK identity is available via Session.ConnectionState().
+	ExternalPSK *PSKConfig
 }
 
 // A Listener for incoming QUIC connections
@@ -204,5 +381,20 @@ type Listener interface {
 	// Addr returns the local network addr that the server is listening on.
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
-	Accept() (Session, error)
+	// If the context is cancelled, it returns ctx.Err().
+	Accept(context.Context) (Session, error)
+}
+
+// A ListenerMux accepts QUIC connections and dispatches them based on the negotiated application protocol (ALPN).
+type ListenerMux interface {
+	// Close the server, sending CONNECTION_CLOSE frames to each peer.
+	Close() error
+	// Addr returns the local network addr that the server is listening on.
+	Addr() net.Addr
+	// Listener returns the Listener for sessions that negotiated the given application protocol.
+	// The application protocol must be contained in tls.Config.NextProtos.
+	// Sessions that negotiated an application protocol which is not contained in tls.Config.NextProtos
+	// are closed with a CRYPTO_ERROR (no_application_protocol).
+	// If the Listener doesn't accept sessions fast enough, new sessions are closed with a CONNECTION_REFUSED error.
+	Listener(proto string) (Listener, error)
 }
@@ -28,6 +28,9 @@ type SentPacketHandler interface {
 	ShouldSendNumPackets() int
 
 	GetLowestPacketNotConfirmedAcked() protocol.PacketNumber
+	// GetLowestRetransmittable returns the lowest packet number of all packets that might still be retransmitted.
+	// These are the packets that were neither acknowledged nor declared lost, and the packets queued for retransmission.
+	GetLowestRetransmittable() protocol.PacketNumber
 	DequeuePacketForRetransmission() *Packet
 	DequeueProbePacket() (*Packet, error)
 
@@ -18,6 +18,10 @@ func IsFrameRetransmittable(f wire.Frame) bool {
 	switch f.(type) {
 	case *wire.AckFrame:
 		return false
+	case *wire.PathChallengeFrame, *wire.PathResponseFrame:
+		// PATH_CHALLENGE and PATH_RESPONSE frames are only valid on the path they were sent on,
+		// so they must not be retransmitted, see section 13.3 of RFC 9000.
+		return false
 	default:
 		return true
 	}
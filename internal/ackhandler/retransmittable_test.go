@@ -18,6 +18,8 @@ var _ = Describe("retransmittable frames", func() {
 		&wire.StreamFrame{}:          true,
 		&wire.MaxDataFrame{}:         true,
 		&wire.MaxStreamDataFrame{}:   true,
+		&wire.PathChallengeFrame{}:   false,
+		&wire.PathResponseFrame{}:    false,
 	} {
 		f := fl
 		e := el
@@ -184,7 +184,7 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumber protocol.PacketNumber, encLevel protocol.EncryptionLevel, rcvTime time.Time) error {
 	largestAcked := ackFrame.LargestAcked()
 	if largestAcked > h.lastSentPacketNumber {
-		return qerr.Error(qerr.InvalidAckData, "Received ACK for an unsent package")
+		return qerr.Error(qerr.ProtocolViolation, "Received ACK for an unsent package")
 	}
 
 	// duplicate or out of order ACK
@@ -196,7 +196,7 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 	h.largestAcked = utils.MaxPacketNumber(h.largestAcked, largestAcked)
 
 	if !h.packetNumberGenerator.Validate(ackFrame) {
-		return qerr.Error(qerr.InvalidAckData, "Received an ACK for a skipped packet number")
+		return qerr.Error(qerr.ProtocolViolation, "Received an ACK for a skipped packet number")
 	}
 
 	if rttUpdated := h.maybeUpdateRTT(largestAcked, ackFrame.DelayTime, rcvTime); rttUpdated {
@@ -240,6 +240,16 @@ func (h *sentPacketHandler) GetLowestPacketNotConfirmedAcked() protocol.PacketNu
 	return h.lowestPacketNotConfirmedAcked
 }
 
+func (h *sentPacketHandler) GetLowestRetransmittable() protocol.PacketNumber {
+	lowest := h.lowestUnacked()
+	for _, p := range h.retransmissionQueue {
+		if p.PacketNumber < lowest {
+			lowest = p.PacketNumber
+		}
+	}
+	return lowest
+}
+
 func (h *sentPacketHandler) determineNewlyAckedPackets(ackFrame *wire.AckFrame) ([]*Packet, error) {
 	var ackedPackets []*Packet
 	ackRangeIndex := 0
@@ -175,7 +175,7 @@ var _ = Describe("SentPacketHandler", func() {
 			It("rejects ACKs with a too high LargestAcked packet number", func() {
 				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 9999}}}
 				err := handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())
-				Expect(err).To(MatchError("InvalidAckData: Received ACK for an unsent package"))
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received ACK for an unsent package"))
 				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(10)))
 			})
 
@@ -421,6 +421,29 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("determining the lowest packet that might be retransmitted", func() {
+		It("returns the lowest outstanding packet", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 4}))
+			Expect(handler.GetLowestRetransmittable()).To(Equal(protocol.PacketNumber(3)))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 3, Largest: 3}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.GetLowestRetransmittable()).To(Equal(protocol.PacketNumber(4)))
+		})
+
+		It("considers packets queued for retransmission", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 3, SendTime: time.Now().Add(-time.Hour)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 4}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 4, Largest: 4}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			// packet 3 was declared lost
+			Expect(handler.packetHistory.Len()).To(BeZero())
+			Expect(handler.GetLowestRetransmittable()).To(Equal(protocol.PacketNumber(3)))
+			Expect(handler.DequeuePacketForRetransmission().PacketNumber).To(Equal(protocol.PacketNumber(3)))
+			Expect(handler.GetLowestRetransmittable()).To(Equal(protocol.PacketNumber(5)))
+		})
+	})
+
 	It("does not dequeue a packet if no ack has been received", func() {
 		handler.SentPacket(&Packet{PacketNumber: 1})
 		Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
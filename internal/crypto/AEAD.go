@@ -7,4 +7,8 @@ type AEAD interface {
 	Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
 	Seal(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte
 	Overhead() int
+	// EncryptHeader and DecryptHeader apply and remove header protection.
+	// They are no-ops for versions that don't use header protection.
+	EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+	DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
 }
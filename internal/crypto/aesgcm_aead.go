@@ -14,6 +14,10 @@ type aeadAESGCM struct {
 	myIV      []byte
 	encrypter cipher.AEAD
 	decrypter cipher.AEAD
+
+	// only set for versions that use header protection
+	myHeaderProtector    HeaderProtector
+	otherHeaderProtector HeaderProtector
 }
 
 var _ AEAD = &aeadAESGCM{}
@@ -72,3 +76,15 @@ func (aead *aeadAESGCM) makeNonce(iv []byte, packetNumber protocol.PacketNumber)
 func (aead *aeadAESGCM) Overhead() int {
 	return aead.encrypter.Overhead()
 }
+
+func (aead *aeadAESGCM) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	if aead.myHeaderProtector != nil {
+		aead.myHeaderProtector.EncryptHeader(sample, firstByte, pnBytes)
+	}
+}
+
+func (aead *aeadAESGCM) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	if aead.otherHeaderProtector != nil {
+		aead.otherHeaderProtector.DecryptHeader(sample, firstByte, pnBytes)
+	}
+}
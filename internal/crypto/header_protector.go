@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// A HeaderProtector applies and removes header protection, as defined in section 5.4 of RFC 9001.
+type HeaderProtector interface {
+	EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+	DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+}
+
+// HeaderProtectionSampleLen is the length of the ciphertext sample used for header protection
+const HeaderProtectionSampleLen = 16
+
+type aesHeaderProtector struct {
+	block cipher.Block
+	mask  []byte
+}
+
+var _ HeaderProtector = &aesHeaderProtector{}
+
+// NewAESHeaderProtector creates a header protector using AES-ECB
+func NewAESHeaderProtector(key []byte) (HeaderProtector, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating header protection cipher: %s", err)
+	}
+	return &aesHeaderProtector{
+		block: block,
+		mask:  make([]byte, block.BlockSize()),
+	}, nil
+}
+
+func (p *aesHeaderProtector) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	p.apply(sample, firstByte, pnBytes, false)
+}
+
+func (p *aesHeaderProtector) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	p.apply(sample, firstByte, pnBytes, true)
+}
+
+func (p *aesHeaderProtector) apply(sample []byte, firstByte *byte, pnBytes []byte, decrypt bool) {
+	if len(sample) != len(p.mask) {
+		panic("invalid sample size")
+	}
+	p.block.Encrypt(p.mask, sample)
+	applyHeaderProtectionMask(p.mask, firstByte, pnBytes, decrypt)
+}
+
+type chachaHeaderProtector struct {
+	key   [8]uint32
+	block [64]byte
+}
+
+var _ HeaderProtector = &chachaHeaderProtector{}
+
+// NewChaChaHeaderProtector creates a header protector using ChaCha20
+func NewChaChaHeaderProtector(key []byte) (HeaderProtector, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("error creating header protection cipher: invalid ChaCha20 key length %d", len(key))
+	}
+	p := &chachaHeaderProtector{}
+	for i := range p.key {
+		p.key[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	return p, nil
+}
+
+func (p *chachaHeaderProtector) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	p.apply(sample, firstByte, pnBytes, false)
+}
+
+func (p *chachaHeaderProtector) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	p.apply(sample, firstByte, pnBytes, true)
+}
+
+// apply encrypts 5 zero bytes with ChaCha20.
+// The first 4 bytes of the sample are the block counter, the remaining 12 bytes are the nonce.
+func (p *chachaHeaderProtector) apply(sample []byte, firstByte *byte, pnBytes []byte, decrypt bool) {
+	if len(sample) != HeaderProtectionSampleLen {
+		panic("invalid sample size")
+	}
+	counter := binary.LittleEndian.Uint32(sample[:4])
+	var nonce [3]uint32
+	for i := range nonce {
+		nonce[i] = binary.LittleEndian.Uint32(sample[4+4*i:])
+	}
+	chacha20Block(&p.block, &p.key, counter, &nonce)
+	applyHeaderProtectionMask(p.block[:5], firstByte, pnBytes, decrypt)
+}
+
+// applyHeaderProtectionMask applies the mask to the first byte and the packet number.
+// When decrypting, the packet number length can only be read after the first byte was unmasked.
+func applyHeaderProtectionMask(mask []byte, firstByte *byte, pnBytes []byte, decrypt bool) {
+	var pnLen int
+	if !decrypt {
+		pnLen = int(*firstByte&0x3) + 1
+	}
+	if *firstByte&0x80 > 0 { // Long Header
+		*firstByte ^= mask[0] & 0xf
+	} else {
+		*firstByte ^= mask[0] & 0x1f
+	}
+	if decrypt {
+		pnLen = int(*firstByte&0x3) + 1
+	}
+	for i := 0; i < pnLen && i < len(pnBytes); i++ {
+		pnBytes[i] ^= mask[i+1]
+	}
+}
@@ -0,0 +1,82 @@
+package crypto
+
+import (
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Header Protection", func() {
+	// values taken from Appendix A.2 of RFC 9001
+	It("computes the mask for the client Initial from RFC 9001", func() {
+		key, err := hex.DecodeString("9f50449e04a0e810283a1e9933adedd2")
+		Expect(err).ToNot(HaveOccurred())
+		sample, err := hex.DecodeString("d1b1c98dd7689fb8ec11d242b123dc9b")
+		Expect(err).ToNot(HaveOccurred())
+		hp, err := NewAESHeaderProtector(key)
+		Expect(err).ToNot(HaveOccurred())
+		firstByte := byte(0xc3)
+		pnBytes := []byte{0x0, 0x0, 0x0, 0x2}
+		hp.EncryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0xc0)))
+		Expect(pnBytes).To(Equal([]byte{0x7b, 0x9a, 0xec, 0x34}))
+		hp.DecryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0xc3)))
+		Expect(pnBytes).To(Equal([]byte{0x0, 0x0, 0x0, 0x2}))
+	})
+
+	It("only masks the bits of the first byte used by the Short Header", func() {
+		hp, err := NewAESHeaderProtector(make([]byte, 16))
+		Expect(err).ToNot(HaveOccurred())
+		sample := make([]byte, 16)
+		firstByte := byte(0x40)
+		pnBytes := []byte{0x1, 0x2, 0x3, 0x4}
+		hp.EncryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte & 0xe0).To(Equal(byte(0x40)))
+		// only the first byte of the packet number is masked
+		Expect(pnBytes[1:]).To(Equal([]byte{0x2, 0x3, 0x4}))
+		hp.DecryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0x40)))
+		Expect(pnBytes).To(Equal([]byte{0x1, 0x2, 0x3, 0x4}))
+	})
+
+	It("rejects invalid keys", func() {
+		_, err := NewAESHeaderProtector([]byte("foobar"))
+		Expect(err).To(MatchError(ContainSubstring("error creating header protection cipher")))
+	})
+
+	Context("ChaCha20", func() {
+		// values taken from Appendix A.5 of RFC 9001
+		It("computes the mask for the short header packet from RFC 9001", func() {
+			key, err := hex.DecodeString("25a282b9e82f06f21f488917a4fc8f1b73573685608597d0efcb076b0ab7a7a4")
+			Expect(err).ToNot(HaveOccurred())
+			sample, err := hex.DecodeString("5e5cd55c41f69080575d7999c25a5bfb")
+			Expect(err).ToNot(HaveOccurred())
+			hp, err := NewChaChaHeaderProtector(key)
+			Expect(err).ToNot(HaveOccurred())
+			firstByte := byte(0x42)
+			pnBytes := []byte{0x00, 0xbf, 0xf4}
+			hp.EncryptHeader(sample, &firstByte, pnBytes)
+			Expect(firstByte).To(Equal(byte(0x4c)))
+			Expect(pnBytes).To(Equal([]byte{0xfe, 0x41, 0x89}))
+			hp.DecryptHeader(sample, &firstByte, pnBytes)
+			Expect(firstByte).To(Equal(byte(0x42)))
+			Expect(pnBytes).To(Equal([]byte{0x00, 0xbf, 0xf4}))
+		})
+
+		It("computes a ChaCha20 block", func() {
+			// test vector from section 2.3.2 of RFC 8439
+			key := [8]uint32{0x03020100, 0x07060504, 0x0b0a0908, 0x0f0e0d0c, 0x13121110, 0x17161514, 0x1b1a1918, 0x1f1e1d1c}
+			nonce := [3]uint32{0x09000000, 0x4a000000, 0x00000000}
+			var block [64]byte
+			chacha20Block(&block, &key, 1, &nonce)
+			Expect(hex.EncodeToString(block[:])).To(Equal("10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4ed2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e"))
+		})
+
+		It("rejects invalid keys", func() {
+			_, err := NewChaChaHeaderProtector(make([]byte, 16))
+			Expect(err).To(MatchError("error creating header protection cipher: invalid ChaCha20 key length 16"))
+		})
+	})
+})
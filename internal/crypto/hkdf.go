@@ -4,6 +4,8 @@ import (
 	"crypto"
 	"crypto/hmac"
 	"encoding/binary"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
 // copied from https://github.com/cloudflare/tls-tris/blob/master/hkdf.go
@@ -47,12 +49,38 @@ func hkdfExpand(hash crypto.Hash, prk, info []byte, l int) []byte {
 	return res
 }
 
-// hkdfExpandLabel HKDF expands a label
+// HkdfExpandLabel HKDF expands a label, using the "quic " prefix
 func HkdfExpandLabel(hash crypto.Hash, secret []byte, label string, length int) []byte {
-	const prefix = "quic "
-	qlabel := make([]byte, 2 /* length */ +1 /* length of label */ +len(prefix)+len(label)+1 /* length of context (empty) */)
+	return hkdfExpandLabel(hash, secret, "quic "+label, length)
+}
+
+// HkdfExpandLabelTLS13 HKDF expands a label, as defined in section 7.1 of RFC 8446
+func HkdfExpandLabelTLS13(hash crypto.Hash, secret []byte, label string, length int) []byte {
+	return hkdfExpandLabel(hash, secret, "tls13 "+label, length)
+}
+
+func hkdfExpandLabel(hash crypto.Hash, secret []byte, label string, length int) []byte {
+	qlabel := make([]byte, 2 /* length */ +1 /* length of label */ +len(label)+1 /* length of context (empty) */)
 	binary.BigEndian.PutUint16(qlabel[0:2], uint16(length))
-	qlabel[2] = uint8(len(prefix) + len(label))
-	copy(qlabel[3:], []byte(prefix+label))
+	qlabel[2] = uint8(len(label))
+	copy(qlabel[3:], []byte(label))
 	return hkdfExpand(hash, secret, qlabel, length)
 }
+
+// ComputeKeyAndIV derives the packet protection key and IV from a traffic secret
+func ComputeKeyAndIV(hash crypto.Hash, secret []byte, keyLen, ivLen int, v protocol.VersionNumber) (key, iv []byte) {
+	if v.UsesHeaderProtection() {
+		key = HkdfExpandLabelTLS13(hash, secret, "quic key", keyLen)
+		iv = HkdfExpandLabelTLS13(hash, secret, "quic iv", ivLen)
+		return
+	}
+	key = HkdfExpandLabel(hash, secret, "key", keyLen)
+	iv = HkdfExpandLabel(hash, secret, "iv", ivLen)
+	return
+}
+
+// ComputeHeaderProtectionKey derives the header protection key from a traffic secret.
+// It must only be used for versions that use header protection.
+func ComputeHeaderProtectionKey(hash crypto.Hash, secret []byte, keyLen int) []byte {
+	return HkdfExpandLabelTLS13(hash, secret, "quic hp", keyLen)
+}
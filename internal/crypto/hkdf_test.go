@@ -3,8 +3,11 @@ package crypto
 import (
 	"bytes"
 	"crypto"
+	"encoding/hex"
 	"fmt"
 
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -65,4 +68,18 @@ var _ = Describe("HKDF", func() {
 			Expect(hkdfExpand(t.hash, prk, t.info, len(t.expanded))).To(Equal(t.expanded))
 		})
 	}
+
+	// values taken from Appendix A.5 of RFC 9001
+	It("derives the ChaCha20-Poly1305 key, IV and header protection key from RFC 9001", func() {
+		split := func(s string) []byte {
+			b, err := hex.DecodeString(s)
+			Expect(err).ToNot(HaveOccurred())
+			return b
+		}
+		secret := split("9ac312a7f877468ebe69422748ad00a15443f18203a07d6060f688f30f21632b")
+		key, iv := ComputeKeyAndIV(crypto.SHA256, secret, 32, 12, protocol.Version1)
+		Expect(key).To(Equal(split("c6d98ff3441c3fe1b2182094f69caa2ed4b716b65488960a7a984979fb23e1c8")))
+		Expect(iv).To(Equal(split("e0459b3474bdd0e44a41c144")))
+		Expect(ComputeHeaderProtectionKey(crypto.SHA256, secret, 32)).To(Equal(split("25a282b9e82f06f21f488917a4fc8f1b73573685608597d0efcb076b0ab7a7a4")))
+	})
 })
@@ -6,11 +6,14 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
-var quicVersion1Salt = []byte{0x9c, 0x10, 0x8f, 0x98, 0x52, 0x0a, 0x5c, 0x5c, 0x32, 0x96, 0x8e, 0x95, 0x0e, 0x8a, 0x2c, 0x5f, 0xe0, 0x6d, 0x6c, 0x38}
+var quicVersionTLSSalt = []byte{0x9c, 0x10, 0x8f, 0x98, 0x52, 0x0a, 0x5c, 0x5c, 0x32, 0x96, 0x8e, 0x95, 0x0e, 0x8a, 0x2c, 0x5f, 0xe0, 0x6d, 0x6c, 0x38}
+
+// the salt defined in section 5.2 of RFC 9001
+var quicVersion1Salt = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
 
 // NewNullAEAD creates a NullAEAD
-func NewNullAEAD(connectionID protocol.ConnectionID, pers protocol.Perspective) (AEAD, error) {
-	clientSecret, serverSecret := computeSecrets(connectionID)
+func NewNullAEAD(connectionID protocol.ConnectionID, pers protocol.Perspective, v protocol.VersionNumber) (AEAD, error) {
+	clientSecret, serverSecret := computeSecrets(connectionID, v)
 
 	var mySecret, otherSecret []byte
 	if pers == protocol.PerspectiveClient {
@@ -21,21 +24,38 @@ func NewNullAEAD(connectionID protocol.ConnectionID, pers protocol.Perspective)
 		otherSecret = clientSecret
 	}
 
-	myKey, myIV := computeNullAEADKeyAndIV(mySecret)
-	otherKey, otherIV := computeNullAEADKeyAndIV(otherSecret)
+	myKey, myIV := computeNullAEADKeyAndIV(mySecret, v)
+	otherKey, otherIV := computeNullAEADKeyAndIV(otherSecret, v)
 
-	return NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
+	aead, err := NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
+	if err != nil || !v.UsesHeaderProtection() {
+		return aead, err
+	}
+	a := aead.(*aeadAESGCM)
+	a.myHeaderProtector, err = NewAESHeaderProtector(ComputeHeaderProtectionKey(crypto.SHA256, mySecret, 16))
+	if err != nil {
+		return nil, err
+	}
+	a.otherHeaderProtector, err = NewAESHeaderProtector(ComputeHeaderProtectionKey(crypto.SHA256, otherSecret, 16))
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
 }
 
-func computeSecrets(connID protocol.ConnectionID) (clientSecret, serverSecret []byte) {
-	initialSecret := hkdfExtract(crypto.SHA256, connID, quicVersion1Salt)
+func computeSecrets(connID protocol.ConnectionID, v protocol.VersionNumber) (clientSecret, serverSecret []byte) {
+	if v.UsesHeaderProtection() {
+		initialSecret := hkdfExtract(crypto.SHA256, connID, quicVersion1Salt)
+		clientSecret = HkdfExpandLabelTLS13(crypto.SHA256, initialSecret, "client in", crypto.SHA256.Size())
+		serverSecret = HkdfExpandLabelTLS13(crypto.SHA256, initialSecret, "server in", crypto.SHA256.Size())
+		return
+	}
+	initialSecret := hkdfExtract(crypto.SHA256, connID, quicVersionTLSSalt)
 	clientSecret = HkdfExpandLabel(crypto.SHA256, initialSecret, "client in", crypto.SHA256.Size())
 	serverSecret = HkdfExpandLabel(crypto.SHA256, initialSecret, "server in", crypto.SHA256.Size())
 	return
 }
 
-func computeNullAEADKeyAndIV(secret []byte) (key, iv []byte) {
-	key = HkdfExpandLabel(crypto.SHA256, secret, "key", 16)
-	iv = HkdfExpandLabel(crypto.SHA256, secret, "iv", 12)
-	return
+func computeNullAEADKeyAndIV(secret []byte, v protocol.VersionNumber) (key, iv []byte) {
+	return ComputeKeyAndIV(crypto.SHA256, secret, 16, 12, v)
 }
@@ -1,6 +1,9 @@
 package crypto
 
 import (
+	"crypto"
+	"encoding/hex"
+
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -12,7 +15,7 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 		connID := protocol.ConnectionID([]byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08})
 
 		It("computes the secrets", func() {
-			clientSecret, serverSecret := computeSecrets(connID)
+			clientSecret, serverSecret := computeSecrets(connID, protocol.VersionTLS)
 			Expect(clientSecret).To(Equal([]byte{
 				0x9f, 0x53, 0x64, 0x57, 0xf3, 0x2a, 0x1e, 0x0a,
 				0xe8, 0x64, 0xbc, 0xb3, 0xca, 0xf1, 0x23, 0x51,
@@ -28,8 +31,8 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 		})
 
 		It("computes the client key and IV", func() {
-			clientSecret, _ := computeSecrets(connID)
-			key, iv := computeNullAEADKeyAndIV(clientSecret)
+			clientSecret, _ := computeSecrets(connID, protocol.VersionTLS)
+			key, iv := computeNullAEADKeyAndIV(clientSecret, protocol.VersionTLS)
 			Expect(key).To(Equal([]byte{
 				0xf2, 0x92, 0x8f, 0x26, 0x14, 0xad, 0x6c, 0x20,
 				0xb9, 0xbd, 0x00, 0x8e, 0x9c, 0x89, 0x63, 0x1c,
@@ -41,8 +44,8 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 		})
 
 		It("computes the server key and IV", func() {
-			_, serverSecret := computeSecrets(connID)
-			key, iv := computeNullAEADKeyAndIV(serverSecret)
+			_, serverSecret := computeSecrets(connID, protocol.VersionTLS)
+			key, iv := computeNullAEADKeyAndIV(serverSecret, protocol.VersionTLS)
 			Expect(key).To(Equal([]byte{
 				0xf5, 0x68, 0x17, 0xd0, 0xfc, 0x59, 0x5c, 0xfc,
 				0x0a, 0x2b, 0x0b, 0xcf, 0xb1, 0x87, 0x35, 0xec,
@@ -54,11 +57,44 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 		})
 	})
 
+	// values taken from Appendix A.1 of RFC 9001
+	Context("using the test vector from RFC 9001", func() {
+		connID := protocol.ConnectionID([]byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08})
+
+		split := func(s string) []byte {
+			b, err := hex.DecodeString(s)
+			Expect(err).ToNot(HaveOccurred())
+			return b
+		}
+
+		It("computes the secrets", func() {
+			clientSecret, serverSecret := computeSecrets(connID, protocol.Version1)
+			Expect(clientSecret).To(Equal(split("c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea")))
+			Expect(serverSecret).To(Equal(split("3c199828fd139efd216c155ad844cc81fb82fa8d7446fa7d78be803acdda951b")))
+		})
+
+		It("computes the client key, IV and header protection key", func() {
+			clientSecret, _ := computeSecrets(connID, protocol.Version1)
+			key, iv := computeNullAEADKeyAndIV(clientSecret, protocol.Version1)
+			Expect(key).To(Equal(split("1f369613dd76d5467730efcbe3b1a22d")))
+			Expect(iv).To(Equal(split("fa044b2f42a3fd3b46fb255c")))
+			Expect(ComputeHeaderProtectionKey(crypto.SHA256, clientSecret, 16)).To(Equal(split("9f50449e04a0e810283a1e9933adedd2")))
+		})
+
+		It("computes the server key, IV and header protection key", func() {
+			_, serverSecret := computeSecrets(connID, protocol.Version1)
+			key, iv := computeNullAEADKeyAndIV(serverSecret, protocol.Version1)
+			Expect(key).To(Equal(split("cf3a5331653c364c88f0f379b6067e37")))
+			Expect(iv).To(Equal(split("0ac1493ca1905853b0bba03e")))
+			Expect(ComputeHeaderProtectionKey(crypto.SHA256, serverSecret, 16)).To(Equal(split("c206b8d9b9f0f37644430b490eeaa314")))
+		})
+	})
+
 	It("seals and opens", func() {
 		connectionID := protocol.ConnectionID([]byte{0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef})
-		clientAEAD, err := NewNullAEAD(connectionID, protocol.PerspectiveClient)
+		clientAEAD, err := NewNullAEAD(connectionID, protocol.PerspectiveClient, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		serverAEAD, err := NewNullAEAD(connectionID, protocol.PerspectiveServer)
+		serverAEAD, err := NewNullAEAD(connectionID, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 
 		clientMessage := clientAEAD.Seal(nil, []byte("foobar"), 42, []byte("aad"))
@@ -74,9 +110,9 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 	It("doesn't work if initialized with different connection IDs", func() {
 		c1 := protocol.ConnectionID([]byte{0, 0, 0, 0, 0, 0, 0, 1})
 		c2 := protocol.ConnectionID([]byte{0, 0, 0, 0, 0, 0, 0, 2})
-		clientAEAD, err := NewNullAEAD(c1, protocol.PerspectiveClient)
+		clientAEAD, err := NewNullAEAD(c1, protocol.PerspectiveClient, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		serverAEAD, err := NewNullAEAD(c2, protocol.PerspectiveServer)
+		serverAEAD, err := NewNullAEAD(c2, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 
 		clientMessage := clientAEAD.Seal(nil, []byte("foobar"), 42, []byte("aad"))
@@ -84,3 +120,32 @@ var _ = Describe("NullAEAD using AES-GCM", func() {
 		Expect(err).To(MatchError("cipher: message authentication failed"))
 	})
 })
+
+var _ = Describe("NullAEAD header protection", func() {
+	connID := protocol.ConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37})
+
+	It("encrypts and decrypts the header", func() {
+		clientAEAD, err := NewNullAEAD(connID, protocol.PerspectiveClient, protocol.Version1)
+		Expect(err).ToNot(HaveOccurred())
+		serverAEAD, err := NewNullAEAD(connID, protocol.PerspectiveServer, protocol.Version1)
+		Expect(err).ToNot(HaveOccurred())
+		sample := make([]byte, HeaderProtectionSampleLen)
+		firstByte := byte(0xc1) // Long Header, 2 byte packet number
+		pnBytes := []byte{0xde, 0xca}
+		clientAEAD.EncryptHeader(sample, &firstByte, pnBytes)
+		Expect(pnBytes).ToNot(Equal([]byte{0xde, 0xca}))
+		serverAEAD.DecryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0xc1)))
+		Expect(pnBytes).To(Equal([]byte{0xde, 0xca}))
+	})
+
+	It("doesn't protect headers for versions that don't use header protection", func() {
+		aead, err := NewNullAEAD(connID, protocol.PerspectiveClient, protocol.VersionTLS)
+		Expect(err).ToNot(HaveOccurred())
+		firstByte := byte(0xc1)
+		pnBytes := []byte{0xde, 0xca}
+		aead.EncryptHeader(make([]byte, HeaderProtectionSampleLen), &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0xc1)))
+		Expect(pnBytes).To(Equal([]byte{0xde, 0xca}))
+	})
+})
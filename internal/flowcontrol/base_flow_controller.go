@@ -22,6 +22,10 @@ type baseFlowController struct {
 	receiveWindow        protocol.ByteCount
 	receiveWindowSize    protocol.ByteCount
 	maxReceiveWindowSize protocol.ByteCount
+	// limitWindowIncrease is called before the receive window size is increased.
+	// It returns the increase that is actually allowed.
+	// If nil, the window size can be increased up to maxReceiveWindowSize.
+	limitWindowIncrease func(protocol.ByteCount) protocol.ByteCount
 
 	epochStartTime   time.Time
 	epochStartOffset protocol.ByteCount
@@ -107,11 +111,39 @@ func (c *baseFlowController) maybeAdjustWindowSize() {
 	fraction := float64(bytesReadInEpoch) / float64(c.receiveWindowSize)
 	if time.Since(c.epochStartTime) < time.Duration(4*fraction*float64(rtt)) {
 		// window is consumed too fast, try to increase the window size
-		c.receiveWindowSize = utils.MinByteCount(2*c.receiveWindowSize, c.maxReceiveWindowSize)
+		c.increaseWindowSize(2 * c.receiveWindowSize)
 	}
 	c.startNewAutoTuningEpoch()
 }
 
+// increaseWindowSize increases the receiveWindowSize to the target size,
+// as far as maxReceiveWindowSize and limitWindowIncrease allow.
+func (c *baseFlowController) increaseWindowSize(target protocol.ByteCount) {
+	target = utils.MinByteCount(target, c.maxReceiveWindowSize)
+	if target <= c.receiveWindowSize {
+		return
+	}
+	inc := target - c.receiveWindowSize
+	if c.limitWindowIncrease != nil {
+		inc = c.limitWindowIncrease(inc)
+	}
+	c.receiveWindowSize += inc
+}
+
+// handlePeerBlocked is called when the peer is blocked by our flow control limit.
+// It returns true if a window update should be sent.
+func (c *baseFlowController) handlePeerBlocked(limit protocol.ByteCount) bool {
+	// The peer was blocked by an old limit. We already sent a window update that unblocks it.
+	if limit < c.receiveWindow {
+		return false
+	}
+	// The peer can't send any more data, so the receive window is the bottleneck.
+	// Don't wait for the next auto-tuning epoch, and increase the window size right away.
+	c.increaseWindowSize(2 * c.receiveWindowSize)
+	c.startNewAutoTuningEpoch()
+	return c.hasWindowUpdate()
+}
+
 func (c *baseFlowController) startNewAutoTuningEpoch() {
 	c.epochStartTime = time.Now()
 	c.epochStartOffset = c.bytesRead
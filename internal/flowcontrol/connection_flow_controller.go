@@ -13,20 +13,25 @@ type connectionFlowController struct {
 	baseFlowController
 
 	queueWindowUpdate func()
+
+	budget *MemoryBudget // may be nil
 }
 
 var _ ConnectionFlowController = &connectionFlowController{}
 
 // NewConnectionFlowController gets a new flow controller for the connection
 // It is created before we receive the peer's transport paramenters, thus it starts with a sendWindow of 0.
+// If a memory budget is given, the receive window must have been reserved from that budget using ReserveInitialWindow.
+// It is only increased as far as the budget allows.
 func NewConnectionFlowController(
 	receiveWindow protocol.ByteCount,
 	maxReceiveWindow protocol.ByteCount,
+	budget *MemoryBudget,
 	queueWindowUpdate func(),
 	rttStats *congestion.RTTStats,
 	logger utils.Logger,
 ) ConnectionFlowController {
-	return &connectionFlowController{
+	c := &connectionFlowController{
 		baseFlowController: baseFlowController{
 			rttStats:             rttStats,
 			receiveWindow:        receiveWindow,
@@ -36,6 +41,11 @@ func NewConnectionFlowController(
 		},
 		queueWindowUpdate: queueWindowUpdate,
 	}
+	if budget != nil {
+		c.budget = budget
+		c.limitWindowIncrease = c.budget.reserve
+	}
+	return c
 }
 
 func (c *connectionFlowController) SendWindowSize() protocol.ByteCount {
@@ -49,7 +59,7 @@ func (c *connectionFlowController) IncrementHighestReceived(increment protocol.B
 
 	c.highestReceived += increment
 	if c.checkFlowControlViolation() {
-		return qerr.Error(qerr.FlowControlReceivedTooMuchData, fmt.Sprintf("Received %d bytes for the connection, allowed %d bytes", c.highestReceived, c.receiveWindow))
+		return qerr.Error(qerr.FlowControlError, fmt.Sprintf("Received %d bytes for the connection, allowed %d bytes", c.highestReceived, c.receiveWindow))
 	}
 	return nil
 }
@@ -74,14 +84,45 @@ func (c *connectionFlowController) GetWindowUpdate() protocol.ByteCount {
 	return offset
 }
 
+func (c *connectionFlowController) HandlePeerBlocked(limit protocol.ByteCount) {
+	c.mutex.Lock()
+	oldWindowSize := c.receiveWindowSize
+	hasWindowUpdate := c.handlePeerBlocked(limit)
+	if oldWindowSize < c.receiveWindowSize {
+		c.logger.Debugf("Increasing receive flow control window for the connection to %d kB, since the peer is blocked", c.receiveWindowSize/(1<<10))
+	}
+	c.mutex.Unlock()
+	if hasWindowUpdate {
+		c.queueWindowUpdate()
+	}
+}
+
 // EnsureMinimumWindowSize sets a minimum window size
 // it should make sure that the connection-level window is increased when a stream-level window grows
 func (c *connectionFlowController) EnsureMinimumWindowSize(inc protocol.ByteCount) {
 	c.mutex.Lock()
 	if inc > c.receiveWindowSize {
 		c.logger.Debugf("Increasing receive flow control window for the connection to %d kB, in response to stream flow control window increase", c.receiveWindowSize/(1<<10))
-		c.receiveWindowSize = utils.MinByteCount(inc, c.maxReceiveWindowSize)
+		c.increaseWindowSize(inc)
 		c.startNewAutoTuningEpoch()
 	}
 	c.mutex.Unlock()
 }
+
+// RemainingBudget returns how much the receive window can be increased, according to the memory budget
+func (c *connectionFlowController) RemainingBudget() protocol.ByteCount {
+	if c.budget == nil {
+		return protocol.MaxByteCount
+	}
+	return c.budget.available()
+}
+
+func (c *connectionFlowController) Close() {
+	c.mutex.Lock()
+	if c.budget != nil {
+		c.budget.removeConnection(c.receiveWindowSize)
+		c.budget = nil
+		c.limitWindowIncrease = func(protocol.ByteCount) protocol.ByteCount { return 0 }
+	}
+	c.mutex.Unlock()
+}
@@ -36,7 +36,7 @@ var _ = Describe("Connection Flow controller", func() {
 			receiveWindow := protocol.ByteCount(2000)
 			maxReceiveWindow := protocol.ByteCount(3000)
 
-			fc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, nil, rttStats, utils.DefaultLogger).(*connectionFlowController)
+			fc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, nil, nil, rttStats, utils.DefaultLogger).(*connectionFlowController)
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
 			Expect(fc.maxReceiveWindowSize).To(Equal(maxReceiveWindow))
 		})
@@ -95,6 +95,36 @@ var _ = Describe("Connection Flow controller", func() {
 		})
 	})
 
+	Context("handling blocked frames", func() {
+		BeforeEach(func() {
+			queuedWindowUpdate = false
+			controller.receiveWindow = 100
+			controller.receiveWindowSize = 60
+			controller.maxReceiveWindowSize = 1000
+			controller.bytesRead = 100 - 60
+		})
+
+		It("increases the window size and queues a window update when the peer is blocked", func() {
+			controller.HandlePeerBlocked(100)
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(120)))
+			Expect(queuedWindowUpdate).To(BeTrue())
+			Expect(controller.GetWindowUpdate()).To(Equal(protocol.ByteCount(40 + 120)))
+		})
+
+		It("doesn't increase the window size beyond the maxReceiveWindowSize", func() {
+			controller.maxReceiveWindowSize = 70
+			controller.HandlePeerBlocked(100)
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(70)))
+			Expect(queuedWindowUpdate).To(BeFalse())
+		})
+
+		It("ignores blocked frames for old limits", func() {
+			controller.HandlePeerBlocked(99)
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(60)))
+			Expect(queuedWindowUpdate).To(BeFalse())
+		})
+	})
+
 	Context("setting the minimum window size", func() {
 		var (
 			oldWindowSize     protocol.ByteCount
@@ -130,4 +160,62 @@ var _ = Describe("Connection Flow controller", func() {
 			Expect(controller.epochStartTime).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
 		})
 	})
+
+	Context("using a memory budget", func() {
+		var budget *MemoryBudget
+
+		BeforeEach(func() {
+			budget = NewMemoryBudget(5000)
+			Expect(ReserveInitialWindow(budget, 1000, 1000)).To(Equal(protocol.ByteCount(1000)))
+			controller = NewConnectionFlowController(1000, 10000, budget, func() {}, &congestion.RTTStats{}, utils.DefaultLogger).(*connectionFlowController)
+		})
+
+		It("reserves the initial window", func() {
+			Expect(budget.Stats().Reserved).To(Equal(protocol.ByteCount(1000)))
+			Expect(budget.Stats().Connections).To(Equal(1))
+		})
+
+		It("only increases the window as far as the budget allows", func() {
+			controller.EnsureMinimumWindowSize(4000)
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(4000)))
+			controller.EnsureMinimumWindowSize(8000)
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(5000)))
+			Expect(controller.RemainingBudget()).To(BeZero())
+			Expect(budget.Stats().LimitedIncreases).To(Equal(uint64(1)))
+		})
+
+		It("autotunes the window as far as the budget allows", func() {
+			Expect(ReserveInitialWindow(budget, 3500, 3500)).To(Equal(protocol.ByteCount(3500)))
+			other := NewConnectionFlowController(3500, 10000, budget, func() {}, &congestion.RTTStats{}, utils.DefaultLogger)
+			defer other.Close()
+			setRtt(scaleDuration(20 * time.Millisecond))
+			controller.epochStartTime = time.Now().Add(-time.Millisecond)
+			controller.AddBytesRead(600)
+			offset := controller.GetWindowUpdate()
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(1500)))
+			Expect(offset).To(Equal(protocol.ByteCount(600 + 1500)))
+		})
+
+		It("releases the reserved memory when closed", func() {
+			controller.EnsureMinimumWindowSize(4000)
+			controller.Close()
+			Expect(budget.Stats().Reserved).To(BeZero())
+			Expect(budget.Stats().PeakReserved).To(Equal(protocol.ByteCount(4000)))
+			Expect(budget.Stats().Connections).To(BeZero())
+			// closing a second time is a no-op
+			controller.Close()
+			Expect(budget.Stats().Connections).To(BeZero())
+			// the window can't be increased any more
+			controller.EnsureMinimumWindowSize(5000)
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(4000)))
+		})
+
+		It("reports the remaining budget", func() {
+			Expect(controller.RemainingBudget()).To(Equal(protocol.ByteCount(4000)))
+		})
+	})
+
+	It("reports an unlimited budget, if no budget is used", func() {
+		Expect(controller.RemainingBudget()).To(Equal(protocol.MaxByteCount))
+	})
 })
@@ -11,6 +11,9 @@ type flowController interface {
 	AddBytesRead(protocol.ByteCount)
 	GetWindowUpdate() protocol.ByteCount // returns 0 if no update is necessary
 	MaybeQueueWindowUpdate()             //  queues a window update, if necessary
+	// HandlePeerBlocked should be called when the peer sends a (STREAM_)DATA_BLOCKED frame.
+	// It increases the window size, and queues a window update, if necessary.
+	HandlePeerBlocked(protocol.ByteCount)
 	IsNewlyBlocked() (bool, protocol.ByteCount)
 }
 
@@ -26,13 +29,17 @@ type StreamFlowController interface {
 // The ConnectionFlowController is the flow controller for the connection.
 type ConnectionFlowController interface {
 	flowController
+	// Close releases the memory reserved from the memory budget.
+	// It must be called when the connection is closed.
+	Close()
 }
 
 type connectionFlowControllerI interface {
 	ConnectionFlowController
-	// The following two methods are not supposed to be called from outside this packet, but are needed internally
+	// The following methods are not supposed to be called from outside this packet, but are needed internally
 	// for sending
 	EnsureMinimumWindowSize(protocol.ByteCount)
 	// for receiving
 	IncrementHighestReceived(protocol.ByteCount) error
+	RemainingBudget() protocol.ByteCount
 }
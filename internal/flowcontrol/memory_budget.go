@@ -0,0 +1,128 @@
+package flowcontrol
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// MemoryBudgetStats are statistics about the use of a MemoryBudget.
+type MemoryBudgetStats struct {
+	// Limit is the size of the budget.
+	Limit protocol.ByteCount
+	// Reserved is the flow control credit that is currently reserved by connections.
+	Reserved protocol.ByteCount
+	// PeakReserved is the highest value Reserved ever had.
+	PeakReserved protocol.ByteCount
+	// Connections is the number of connections currently using the budget.
+	Connections int
+	// LimitedIncreases counts how often a flow control window couldn't be increased as much as requested,
+	// because the budget was exhausted.
+	LimitedIncreases uint64
+	// RefusedConnections counts the connections that were refused,
+	// because the budget couldn't cover their minimum initial window.
+	RefusedConnections uint64
+}
+
+// A MemoryBudget limits the flow control credit that connections sharing it can grant to their peers.
+// Since a peer can never send more data than it was granted, this limits the memory used for receive buffers.
+type MemoryBudget struct {
+	mutex sync.Mutex
+
+	limit              protocol.ByteCount
+	reserved           protocol.ByteCount
+	peakReserved       protocol.ByteCount
+	connections        int
+	limitedIncreases   uint64
+	refusedConnections uint64
+}
+
+// NewMemoryBudget creates a new MemoryBudget.
+func NewMemoryBudget(limit protocol.ByteCount) *MemoryBudget {
+	return &MemoryBudget{limit: limit}
+}
+
+// ErrMemoryBudgetExhausted is returned when the memory budget can't cover the initial window of a new connection.
+var ErrMemoryBudgetExhausted = errors.New("memory budget exhausted")
+
+// ReserveInitialWindow reserves the initial receive window of a new connection.
+// The window is announced to the peer in the transport parameters, so it has to be reserved before they are sent.
+// If the budget doesn't cover the whole window, the window is reduced to the credit that is still available.
+// If less than minWindow is available, nothing is reserved, and ErrMemoryBudgetExhausted is returned.
+func ReserveInitialWindow(b *MemoryBudget, window, minWindow protocol.ByteCount) (protocol.ByteCount, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	avail := b.availableLocked()
+	if avail < minWindow {
+		b.refusedConnections++
+		return 0, ErrMemoryBudgetExhausted
+	}
+	if window > avail {
+		b.limitedIncreases++
+		window = avail
+	}
+	b.connections++
+	b.reserveLocked(window)
+	return window, nil
+}
+
+// removeConnection releases all memory reserved by a connection.
+func (b *MemoryBudget) removeConnection(reserved protocol.ByteCount) {
+	b.mutex.Lock()
+	b.connections--
+	b.reserved -= reserved
+	b.mutex.Unlock()
+}
+
+// reserve reserves up to n bytes.
+// It returns the number of bytes that were actually reserved.
+func (b *MemoryBudget) reserve(n protocol.ByteCount) protocol.ByteCount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if avail := b.availableLocked(); n > avail {
+		b.limitedIncreases++
+		n = avail
+	}
+	b.reserveLocked(n)
+	return n
+}
+
+// available returns the number of bytes that can still be reserved.
+func (b *MemoryBudget) available() protocol.ByteCount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.availableLocked()
+}
+
+func (b *MemoryBudget) availableLocked() protocol.ByteCount {
+	if b.reserved >= b.limit {
+		return 0
+	}
+	return b.limit - b.reserved
+}
+
+func (b *MemoryBudget) reserveLocked(n protocol.ByteCount) {
+	b.reserved += n
+	if b.reserved > b.peakReserved {
+		b.peakReserved = b.reserved
+	}
+}
+
+// Stats returns statistics about the use of the budget.
+func (b *MemoryBudget) Stats() MemoryBudgetStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return MemoryBudgetStats{
+		Limit:              b.limit,
+		Reserved:           b.reserved,
+		PeakReserved:       b.peakReserved,
+		Connections:        b.connections,
+		LimitedIncreases:   b.limitedIncreases,
+		RefusedConnections: b.refusedConnections,
+	}
+}
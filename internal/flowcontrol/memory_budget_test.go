@@ -0,0 +1,72 @@
+package flowcontrol
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory Budget", func() {
+	var budget *MemoryBudget
+
+	BeforeEach(func() {
+		budget = NewMemoryBudget(1000)
+	})
+
+	It("reserves memory", func() {
+		Expect(budget.reserve(300)).To(Equal(protocol.ByteCount(300)))
+		Expect(budget.reserve(400)).To(Equal(protocol.ByteCount(400)))
+		Expect(budget.available()).To(Equal(protocol.ByteCount(300)))
+		Expect(budget.Stats()).To(Equal(MemoryBudgetStats{
+			Limit:        1000,
+			Reserved:     700,
+			PeakReserved: 700,
+		}))
+	})
+
+	It("only reserves as much memory as is available", func() {
+		Expect(budget.reserve(800)).To(Equal(protocol.ByteCount(800)))
+		Expect(budget.reserve(300)).To(Equal(protocol.ByteCount(200)))
+		Expect(budget.reserve(300)).To(BeZero())
+		Expect(budget.available()).To(BeZero())
+		Expect(budget.Stats().LimitedIncreases).To(Equal(uint64(2)))
+	})
+
+	It("reserves the initial window of a connection", func() {
+		Expect(ReserveInitialWindow(budget, 400, 100)).To(Equal(protocol.ByteCount(400)))
+		Expect(ReserveInitialWindow(budget, 400, 100)).To(Equal(protocol.ByteCount(400)))
+		stats := budget.Stats()
+		Expect(stats.Reserved).To(Equal(protocol.ByteCount(800)))
+		Expect(stats.Connections).To(Equal(2))
+		Expect(stats.LimitedIncreases).To(BeZero())
+	})
+
+	It("reduces the initial window of a connection to the available budget", func() {
+		Expect(ReserveInitialWindow(budget, 800, 100)).To(Equal(protocol.ByteCount(800)))
+		Expect(ReserveInitialWindow(budget, 800, 100)).To(Equal(protocol.ByteCount(200)))
+		stats := budget.Stats()
+		Expect(stats.Reserved).To(Equal(protocol.ByteCount(1000)))
+		Expect(stats.Connections).To(Equal(2))
+		Expect(stats.LimitedIncreases).To(Equal(uint64(1)))
+	})
+
+	It("refuses connections if less than the minimum window is available", func() {
+		Expect(ReserveInitialWindow(budget, 950, 100)).To(Equal(protocol.ByteCount(950)))
+		_, err := ReserveInitialWindow(budget, 800, 100)
+		Expect(err).To(MatchError(ErrMemoryBudgetExhausted))
+		stats := budget.Stats()
+		Expect(stats.Reserved).To(Equal(protocol.ByteCount(950)))
+		Expect(stats.Connections).To(Equal(1))
+		Expect(stats.RefusedConnections).To(Equal(uint64(1)))
+	})
+
+	It("releases the memory of a connection", func() {
+		Expect(ReserveInitialWindow(budget, 100, 100)).To(Equal(protocol.ByteCount(100)))
+		Expect(budget.reserve(400)).To(Equal(protocol.ByteCount(400)))
+		budget.removeConnection(500)
+		stats := budget.Stats()
+		Expect(stats.Reserved).To(BeZero())
+		Expect(stats.PeakReserved).To(Equal(protocol.ByteCount(500)))
+		Expect(stats.Connections).To(BeZero())
+	})
+})
@@ -34,7 +34,7 @@ func NewStreamFlowController(
 	rttStats *congestion.RTTStats,
 	logger utils.Logger,
 ) StreamFlowController {
-	return &streamFlowController{
+	c := &streamFlowController{
 		streamID:          streamID,
 		connection:        cfc.(connectionFlowControllerI),
 		queueWindowUpdate: func() { queueWindowUpdate(streamID) },
@@ -47,6 +47,12 @@ func NewStreamFlowController(
 			logger:               logger,
 		},
 	}
+	// The stream's data is accounted for by the connection's window.
+	// Don't increase the stream window if the connection window can't grow any more.
+	c.limitWindowIncrease = func(inc protocol.ByteCount) protocol.ByteCount {
+		return utils.MinByteCount(inc, c.connection.RemainingBudget())
+	}
+	return c
 }
 
 // UpdateHighestReceived updates the highestReceived value, if the byteOffset is higher
@@ -57,11 +63,11 @@ func (c *streamFlowController) UpdateHighestReceived(byteOffset protocol.ByteCou
 
 	// when receiving a final offset, check that this final offset is consistent with a final offset we might have received earlier
 	if final && c.receivedFinalOffset && byteOffset != c.highestReceived {
-		return qerr.Error(qerr.StreamDataAfterTermination, fmt.Sprintf("Received inconsistent final offset for stream %d (old: %d, new: %d bytes)", c.streamID, c.highestReceived, byteOffset))
+		return qerr.Error(qerr.FinalSizeError, fmt.Sprintf("Received inconsistent final offset for stream %d (old: %d, new: %d bytes)", c.streamID, c.highestReceived, byteOffset))
 	}
 	// if we already received a final offset, check that the offset in the STREAM frames is below the final offset
 	if c.receivedFinalOffset && byteOffset > c.highestReceived {
-		return qerr.StreamDataAfterTermination
+		return qerr.FinalSizeError
 	}
 	if final {
 		c.receivedFinalOffset = true
@@ -73,7 +79,7 @@ func (c *streamFlowController) UpdateHighestReceived(byteOffset protocol.ByteCou
 		// a STREAM_FRAME with a higher offset was received before.
 		if final {
 			// If the current byteOffset is smaller than the offset in that STREAM_FRAME, this STREAM_FRAME contained data after the end of the stream
-			return qerr.StreamDataAfterTermination
+			return qerr.FinalSizeError
 		}
 		// this is a reordered STREAM_FRAME
 		return nil
@@ -82,7 +88,7 @@ func (c *streamFlowController) UpdateHighestReceived(byteOffset protocol.ByteCou
 	increment := byteOffset - c.highestReceived
 	c.highestReceived = byteOffset
 	if c.checkFlowControlViolation() {
-		return qerr.Error(qerr.FlowControlReceivedTooMuchData, fmt.Sprintf("Received %d bytes on stream %d, allowed %d bytes", byteOffset, c.streamID, c.receiveWindow))
+		return qerr.Error(qerr.FlowControlError, fmt.Sprintf("Received %d bytes on stream %d, allowed %d bytes", byteOffset, c.streamID, c.receiveWindow))
 	}
 	return c.connection.IncrementHighestReceived(increment)
 }
@@ -111,6 +117,25 @@ func (c *streamFlowController) MaybeQueueWindowUpdate() {
 	c.connection.MaybeQueueWindowUpdate()
 }
 
+func (c *streamFlowController) HandlePeerBlocked(limit protocol.ByteCount) {
+	c.mutex.Lock()
+	// if we already received the final offset for this stream, the peer won't need any additional flow control credit
+	if c.receivedFinalOffset {
+		c.mutex.Unlock()
+		return
+	}
+	oldWindowSize := c.receiveWindowSize
+	hasWindowUpdate := c.handlePeerBlocked(limit)
+	if c.receiveWindowSize > oldWindowSize {
+		c.logger.Debugf("Increasing receive flow control window for stream %d to %d kB, since the peer is blocked", c.streamID, c.receiveWindowSize/(1<<10))
+		c.connection.EnsureMinimumWindowSize(protocol.ByteCount(float64(c.receiveWindowSize) * protocol.ConnectionFlowControlMultiplier))
+	}
+	c.mutex.Unlock()
+	if hasWindowUpdate {
+		c.queueWindowUpdate()
+	}
+}
+
 func (c *streamFlowController) GetWindowUpdate() protocol.ByteCount {
 	// don't use defer for unlocking the mutex here, GetWindowUpdate() is called frequently and defer shows up in the profiler
 	c.mutex.Lock()
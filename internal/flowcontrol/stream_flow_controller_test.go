@@ -24,7 +24,7 @@ var _ = Describe("Stream Flow controller", func() {
 		rttStats := &congestion.RTTStats{}
 		controller = &streamFlowController{
 			streamID:   10,
-			connection: NewConnectionFlowController(1000, 1000, func() { queuedConnWindowUpdate = true }, rttStats, utils.DefaultLogger).(*connectionFlowController),
+			connection: NewConnectionFlowController(1000, 1000, nil, func() { queuedConnWindowUpdate = true }, rttStats, utils.DefaultLogger).(*connectionFlowController),
 		}
 		controller.maxReceiveWindowSize = 10000
 		controller.rttStats = rttStats
@@ -39,7 +39,7 @@ var _ = Describe("Stream Flow controller", func() {
 		sendWindow := protocol.ByteCount(4000)
 
 		It("sets the send and receive windows", func() {
-			cc := NewConnectionFlowController(0, 0, nil, nil, utils.DefaultLogger)
+			cc := NewConnectionFlowController(0, 0, nil, nil, nil, utils.DefaultLogger)
 			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
 			Expect(fc.streamID).To(Equal(protocol.StreamID(5)))
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
@@ -54,7 +54,7 @@ var _ = Describe("Stream Flow controller", func() {
 				queued = true
 			}
 
-			cc := NewConnectionFlowController(0, 0, nil, nil, utils.DefaultLogger)
+			cc := NewConnectionFlowController(0, 0, nil, nil, nil, utils.DefaultLogger)
 			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, queueWindowUpdate, rttStats, utils.DefaultLogger).(*streamFlowController)
 			fc.AddBytesRead(receiveWindow)
 			fc.MaybeQueueWindowUpdate()
@@ -108,7 +108,7 @@ var _ = Describe("Stream Flow controller", func() {
 
 			It("detects a flow control violation", func() {
 				err := controller.UpdateHighestReceived(receiveWindow+1, false)
-				Expect(err).To(MatchError("FlowControlReceivedTooMuchData: Received 10001 bytes on stream 10, allowed 10000 bytes"))
+				Expect(err).To(MatchError("FLOW_CONTROL_ERROR: Received 10001 bytes on stream 10, allowed 10000 bytes"))
 			})
 
 			It("accepts a final offset higher than the highest received", func() {
@@ -121,7 +121,7 @@ var _ = Describe("Stream Flow controller", func() {
 			It("errors when receiving a final offset smaller than the highest offset received so far", func() {
 				controller.highestReceived = 100
 				err := controller.UpdateHighestReceived(99, true)
-				Expect(err).To(MatchError(qerr.StreamDataAfterTermination))
+				Expect(err).To(MatchError(qerr.FinalSizeError))
 			})
 
 			It("accepts delayed data after receiving a final offset", func() {
@@ -135,7 +135,7 @@ var _ = Describe("Stream Flow controller", func() {
 				err := controller.UpdateHighestReceived(200, true)
 				Expect(err).ToNot(HaveOccurred())
 				err = controller.UpdateHighestReceived(250, false)
-				Expect(err).To(MatchError(qerr.StreamDataAfterTermination))
+				Expect(err).To(MatchError(qerr.FinalSizeError))
 			})
 
 			It("accepts duplicate final offsets", func() {
@@ -150,7 +150,7 @@ var _ = Describe("Stream Flow controller", func() {
 				err := controller.UpdateHighestReceived(200, true)
 				Expect(err).ToNot(HaveOccurred())
 				err = controller.UpdateHighestReceived(201, true)
-				Expect(err).To(MatchError("StreamDataAfterTermination: Received inconsistent final offset for stream 10 (old: 200, new: 201 bytes)"))
+				Expect(err).To(MatchError("FINAL_SIZE_ERROR: Received inconsistent final offset for stream 10 (old: 200, new: 201 bytes)"))
 			})
 		})
 
@@ -219,6 +219,43 @@ var _ = Describe("Stream Flow controller", func() {
 				offset := controller.GetWindowUpdate()
 				Expect(offset).To(BeZero())
 			})
+
+			It("increases the window size and queues a window update when the peer is blocked", func() {
+				controller.HandlePeerBlocked(100)
+				Expect(controller.receiveWindowSize).To(Equal(2 * oldWindowSize))
+				Expect(queuedWindowUpdate).To(BeTrue())
+				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(Equal(protocol.ByteCount(float64(controller.receiveWindowSize) * protocol.ConnectionFlowControlMultiplier)))
+				Expect(controller.GetWindowUpdate()).To(Equal(protocol.ByteCount(40 + 2*oldWindowSize)))
+			})
+
+			It("ignores blocked frames for old limits", func() {
+				controller.HandlePeerBlocked(50)
+				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+				Expect(queuedWindowUpdate).To(BeFalse())
+			})
+
+			It("ignores blocked frames after a final offset was received", func() {
+				Expect(controller.UpdateHighestReceived(100, true)).To(Succeed())
+				controller.HandlePeerBlocked(100)
+				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+				Expect(queuedWindowUpdate).To(BeFalse())
+			})
+
+			It("doesn't autotune the window beyond the connection's memory budget", func() {
+				budget := NewMemoryBudget(150)
+				Expect(ReserveInitialWindow(budget, 120, 120)).To(Equal(protocol.ByteCount(120)))
+				cc := NewConnectionFlowController(120, 1000, budget, func() {}, controller.rttStats, utils.DefaultLogger)
+				fc := NewStreamFlowController(10, cc, 60, 10000, 0, func(protocol.StreamID) {}, controller.rttStats, utils.DefaultLogger).(*streamFlowController)
+				setRtt(scaleDuration(20 * time.Millisecond))
+				fc.epochStartTime = time.Now().Add(-time.Millisecond)
+				fc.AddBytesRead(35)
+				fc.epochStartTime = time.Now().Add(-time.Millisecond)
+				offset := fc.GetWindowUpdate()
+				// only 30 bytes are left in the budget
+				Expect(fc.receiveWindowSize).To(Equal(protocol.ByteCount(90)))
+				Expect(offset).To(Equal(protocol.ByteCount(35 + 90)))
+				Expect(budget.Stats().LimitedIncreases).To(BeZero())
+			})
 		})
 	})
 
@@ -4,12 +4,15 @@ import (
 	"crypto/cipher"
 	"encoding/binary"
 
+	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
 type sealer struct {
 	iv   []byte
 	aead cipher.AEAD
+	// only set for versions that use header protection
+	hp crypto.HeaderProtector
 
 	// use a single slice to avoid allocations
 	nonceBuf []byte
@@ -17,10 +20,11 @@ type sealer struct {
 
 var _ Sealer = &sealer{}
 
-func newSealer(aead cipher.AEAD, iv []byte) Sealer {
+func newSealer(aead cipher.AEAD, iv []byte, hp crypto.HeaderProtector) Sealer {
 	return &sealer{
 		iv:       iv,
 		aead:     aead,
+		hp:       hp,
 		nonceBuf: make([]byte, aead.NonceSize()),
 	}
 }
@@ -34,9 +38,18 @@ func (s *sealer) Overhead() int {
 	return s.aead.Overhead()
 }
 
+func (s *sealer) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	if s.hp == nil {
+		return
+	}
+	s.hp.EncryptHeader(sample, firstByte, pnBytes)
+}
+
 type opener struct {
 	iv   []byte
 	aead cipher.AEAD
+	// only set for versions that use header protection
+	hp crypto.HeaderProtector
 
 	// use a single slice to avoid allocations
 	nonceBuf []byte
@@ -44,10 +57,11 @@ type opener struct {
 
 var _ Opener = &opener{}
 
-func newOpener(aead cipher.AEAD, iv []byte) Opener {
+func newOpener(aead cipher.AEAD, iv []byte, hp crypto.HeaderProtector) Opener {
 	return &opener{
 		iv:       iv,
 		aead:     aead,
+		hp:       hp,
 		nonceBuf: make([]byte, aead.NonceSize()),
 	}
 }
@@ -56,3 +70,10 @@ func (o *opener) Open(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]b
 	binary.BigEndian.PutUint64(o.nonceBuf[len(o.nonceBuf)-8:], uint64(pn))
 	return o.aead.Open(dst, o.nonceBuf, src, ad)
 }
+
+func (o *opener) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	if o.hp == nil {
+		return
+	}
+	o.hp.DecryptHeader(sample, firstByte, pnBytes)
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -26,8 +28,8 @@ var _ = Describe("AEAD", func() {
 
 		iv := make([]byte, 12)
 		rand.Read(iv)
-		sealer = newSealer(aead, iv)
-		opener = newOpener(aead, iv)
+		sealer = newSealer(aead, iv, nil)
+		opener = newOpener(aead, iv, nil)
 	})
 
 	It("encrypts and decrypts a message", func() {
@@ -48,4 +50,36 @@ var _ = Describe("AEAD", func() {
 		_, err := opener.Open(nil, encrypted, 0x42, ad)
 		Expect(err).To(MatchError("cipher: message authentication failed"))
 	})
+
+	It("doesn't modify the header if header protection is not used", func() {
+		sample := make([]byte, 16)
+		firstByte := byte(0xc3)
+		pnBytes := []byte{1, 2, 3, 4}
+		sealer.EncryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0xc3)))
+		Expect(pnBytes).To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	It("applies and removes header protection", func() {
+		key := make([]byte, 16)
+		rand.Read(key)
+		hp, err := crypto.NewAESHeaderProtector(key)
+		Expect(err).ToNot(HaveOccurred())
+		block, err := aes.NewCipher(key)
+		Expect(err).ToNot(HaveOccurred())
+		aead, err := cipher.NewGCM(block)
+		Expect(err).ToNot(HaveOccurred())
+		s := newSealer(aead, make([]byte, 12), hp)
+		o := newOpener(aead, make([]byte, 12), hp)
+		sample := make([]byte, 16)
+		rand.Read(sample)
+		firstByte := byte(0xc3)
+		pnBytes := []byte{1, 2, 3, 4}
+		s.EncryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte & 0xf0).To(Equal(byte(0xc0)))
+		Expect([]byte{firstByte, pnBytes[0], pnBytes[1], pnBytes[2], pnBytes[3]}).ToNot(Equal([]byte{0xc3, 1, 2, 3, 4}))
+		o.DecryptHeader(sample, &firstByte, pnBytes)
+		Expect(firstByte).To(Equal(byte(0xc3)))
+		Expect(pnBytes).To(Equal([]byte{1, 2, 3, 4}))
+	})
 })
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -56,6 +57,11 @@ type cryptoSetup struct {
 
 	handleParamsCallback func(*TransportParameters)
 
+	mutex      sync.Mutex // guards peerParams and tlsState
+	peerParams *TransportParameters
+	// the qtls connection state, set as soon as the handshake completes
+	tlsState *qtls.ConnectionState
+
 	// There are two ways that an error can occur during the handshake:
 	// 1. as a return value from qtls.Handshake()
 	// 2. when new data is passed to the crypto setup via HandleData()
@@ -90,6 +96,7 @@ type cryptoSetup struct {
 	logger utils.Logger
 
 	perspective protocol.Perspective
+	version     protocol.VersionNumber
 }
 
 var _ qtls.RecordLayer = &cryptoSetup{}
@@ -104,6 +111,7 @@ func NewCryptoSetupClient(
 	params *TransportParameters,
 	handleParams func(*TransportParameters),
 	tlsConf *tls.Config,
+	psk *PSKConfig,
 	initialVersion protocol.VersionNumber,
 	supportedVersions []protocol.VersionNumber,
 	currentVersion protocol.VersionNumber,
@@ -126,6 +134,8 @@ func NewCryptoSetupClient(
 		receivedTransportParams,
 		handleParams,
 		tlsConf,
+		psk,
+		currentVersion,
 		logger,
 		perspective,
 	)
@@ -139,6 +149,7 @@ func NewCryptoSetupServer(
 	params *TransportParameters,
 	handleParams func(*TransportParameters),
 	tlsConf *tls.Config,
+	psk *PSKConfig,
 	supportedVersions []protocol.VersionNumber,
 	currentVersion protocol.VersionNumber,
 	logger utils.Logger,
@@ -158,6 +169,8 @@ func NewCryptoSetupServer(
 		receivedTransportParams,
 		handleParams,
 		tlsConf,
+		psk,
+		currentVersion,
 		logger,
 		perspective,
 	)
@@ -172,10 +185,12 @@ func newCryptoSetup(
 	transportParamChan <-chan TransportParameters,
 	handleParams func(*TransportParameters),
 	tlsConf *tls.Config,
+	psk *PSKConfig,
+	version protocol.VersionNumber,
 	logger utils.Logger,
 	perspective protocol.Perspective,
 ) (CryptoSetup, <-chan struct{} /* ClientHello written */, error) {
-	initialAEAD, err := crypto.NewNullAEAD(connID, perspective)
+	initialAEAD, err := crypto.NewNullAEAD(connID, perspective, version)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -189,6 +204,7 @@ func newCryptoSetup(
 		receivedTransportParams: transportParamChan,
 		logger:                  logger,
 		perspective:             perspective,
+		version:                 version,
 		handshakeDone:           make(chan struct{}),
 		handshakeErrChan:        make(chan struct{}),
 		messageErrChan:          make(chan error, 1),
@@ -198,10 +214,11 @@ func newCryptoSetup(
 		receivedWriteKey:        make(chan struct{}),
 		closeChan:               make(chan struct{}),
 	}
-	qtlsConf := tlsConfigToQtlsConfig(tlsConf)
+	qtlsConf := tlsConfigToQtlsConfig(tlsConf, psk)
 	qtlsConf.AlternativeRecordLayer = cs
 	qtlsConf.GetExtensions = extHandler.GetExtensions
 	qtlsConf.ReceivedExtensions = extHandler.ReceivedExtensions
+	qtlsConf.CipherSuites = cipherSuitesForConfig(qtlsConf.CipherSuites, psk != nil)
 	cs.tlsConf = qtlsConf
 	return cs, cs.clientHelloWrittenChan, nil
 }
@@ -223,6 +240,10 @@ func (h *cryptoSetup) RunHandshake() error {
 			handshakeErrChan <- err
 			return
 		}
+		state := conn.ConnectionState()
+		h.mutex.Lock()
+		h.tlsState = &state
+		h.mutex.Unlock()
 		close(handshakeComplete)
 	}()
 
@@ -298,12 +319,19 @@ func (h *cryptoSetup) checkEncryptionLevel(msgType messageType, encLevel protoco
 	return nil
 }
 
+func (h *cryptoSetup) handleTransportParameters(params *TransportParameters) {
+	h.mutex.Lock()
+	h.peerParams = params
+	h.mutex.Unlock()
+	h.handleParamsCallback(params)
+}
+
 func (h *cryptoSetup) handleMessageForServer(msgType messageType) bool {
 	switch msgType {
 	case typeClientHello:
 		select {
 		case params := <-h.receivedTransportParams:
-			h.handleParamsCallback(&params)
+			h.handleTransportParameters(&params)
 		case <-h.handshakeErrChan:
 			return false
 		}
@@ -356,7 +384,7 @@ func (h *cryptoSetup) handleMessageForClient(msgType messageType) bool {
 	case typeEncryptedExtensions:
 		select {
 		case params := <-h.receivedTransportParams:
-			h.handleParamsCallback(&params)
+			h.handleTransportParameters(&params)
 		case <-h.handshakeErrChan:
 			return false
 		}
@@ -403,9 +431,8 @@ func (h *cryptoSetup) ReadHandshakeMessage() ([]byte, error) {
 }
 
 func (h *cryptoSetup) SetReadKey(suite *qtls.CipherSuite, trafficSecret []byte) {
-	key := crypto.HkdfExpandLabel(suite.Hash(), trafficSecret, "key", suite.KeyLen())
-	iv := crypto.HkdfExpandLabel(suite.Hash(), trafficSecret, "iv", suite.IVLen())
-	opener := newOpener(suite.AEAD(key, iv), iv)
+	key, iv := crypto.ComputeKeyAndIV(suite.Hash(), trafficSecret, suite.KeyLen(), suite.IVLen(), h.version)
+	opener := newOpener(suite.AEAD(key, iv), iv, h.newHeaderProtector(suite, trafficSecret))
 
 	switch h.readEncLevel {
 	case protocol.EncryptionInitial:
@@ -423,9 +450,8 @@ func (h *cryptoSetup) SetReadKey(suite *qtls.CipherSuite, trafficSecret []byte)
 }
 
 func (h *cryptoSetup) SetWriteKey(suite *qtls.CipherSuite, trafficSecret []byte) {
-	key := crypto.HkdfExpandLabel(suite.Hash(), trafficSecret, "key", suite.KeyLen())
-	iv := crypto.HkdfExpandLabel(suite.Hash(), trafficSecret, "iv", suite.IVLen())
-	sealer := newSealer(suite.AEAD(key, iv), iv)
+	key, iv := crypto.ComputeKeyAndIV(suite.Hash(), trafficSecret, suite.KeyLen(), suite.IVLen(), h.version)
+	sealer := newSealer(suite.AEAD(key, iv), iv, h.newHeaderProtector(suite, trafficSecret))
 
 	switch h.writeEncLevel {
 	case protocol.EncryptionInitial:
@@ -442,6 +468,31 @@ func (h *cryptoSetup) SetWriteKey(suite *qtls.CipherSuite, trafficSecret []byte)
 	h.receivedWriteKey <- struct{}{}
 }
 
+// newHeaderProtector derives the header protection key.
+// It returns nil for versions that don't use header protection.
+func (h *cryptoSetup) newHeaderProtector(suite *qtls.CipherSuite, trafficSecret []byte) crypto.HeaderProtector {
+	if !h.version.UsesHeaderProtection() {
+		return nil
+	}
+	hpKey := crypto.ComputeHeaderProtectionKey(suite.Hash(), trafficSecret, suite.KeyLen())
+	var hp crypto.HeaderProtector
+	var err error
+	switch suite.ID() {
+	case qtls.TLS_AES_128_GCM_SHA256, qtls.TLS_AES_256_GCM_SHA384:
+		hp, err = crypto.NewAESHeaderProtector(hpKey)
+	case qtls.TLS_CHACHA20_POLY1305_SHA256:
+		hp, err = crypto.NewChaChaHeaderProtector(hpKey)
+	default:
+		// the cipher suites are restricted by cipherSuitesForConfig
+		panic(fmt.Sprintf("unexpected cipher suite: %#x", suite.ID()))
+	}
+	if err != nil {
+		// the key length is defined by the cipher suite, so it is always valid
+		panic(err)
+	}
+	return hp
+}
+
 // WriteRecord is called when TLS writes data
 func (h *cryptoSetup) WriteRecord(p []byte) (int, error) {
 	switch h.writeEncLevel {
@@ -491,6 +542,25 @@ func (h *cryptoSetup) GetSealerWithEncryptionLevel(level protocol.EncryptionLeve
 	}
 }
 
+func (h *cryptoSetup) GetOpener(level protocol.EncryptionLevel) (Opener, error) {
+	switch level {
+	case protocol.EncryptionInitial:
+		return h.initialAEAD, nil
+	case protocol.EncryptionHandshake:
+		if h.handshakeOpener == nil {
+			return nil, errors.New("no handshake opener")
+		}
+		return h.handshakeOpener, nil
+	case protocol.Encryption1RTT:
+		if h.opener == nil {
+			return nil, errors.New("no 1-RTT opener")
+		}
+		return h.opener, nil
+	default:
+		return nil, fmt.Errorf("CryptoSetup: no opener with encryption level %s", level)
+	}
+}
+
 func (h *cryptoSetup) OpenInitial(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]byte, error) {
 	return h.initialAEAD.Open(dst, src, pn, ad)
 }
@@ -510,6 +580,25 @@ func (h *cryptoSetup) Open1RTT(dst, src []byte, pn protocol.PacketNumber, ad []b
 }
 
 func (h *cryptoSetup) ConnectionState() ConnectionState {
-	// TODO: return the connection state
-	return ConnectionState{}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state := ConnectionState{Version: h.version}
+	if h.peerParams != nil {
+		state.PeerTransportParameters = h.peerParams.peerTransportParameters()
+	}
+	if h.tlsState != nil {
+		state.HandshakeComplete = h.tlsState.HandshakeComplete
+		state.ServerName = h.tlsState.ServerName
+		state.NegotiatedProtocol = h.tlsState.NegotiatedProtocol
+		state.CipherSuite = h.tlsState.CipherSuite
+		state.DidResume = h.tlsState.DidResume
+		state.PeerCertificates = h.tlsState.PeerCertificates
+		state.VerifiedChains = h.tlsState.VerifiedChains
+		state.SignedCertificateTimestamps = h.tlsState.SignedCertificateTimestamps
+		state.OCSPResponse = h.tlsState.OCSPResponse
+		state.PSKIdentity = h.tlsState.PSKIdentity
+		// TODO: set Used0RTT as soon as we support 0-RTT
+	}
+	return state
 }
@@ -7,6 +7,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -64,6 +65,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			func(p *TransportParameters) {},
 			testdata.GetTLSConfig(),
+			nil,
 			[]protocol.VersionNumber{protocol.VersionTLS},
 			protocol.VersionTLS,
 			utils.DefaultLogger.WithPrefix("server"),
@@ -94,6 +96,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			func(p *TransportParameters) {},
 			testdata.GetTLSConfig(),
+			nil,
 			[]protocol.VersionNumber{protocol.VersionTLS},
 			protocol.VersionTLS,
 			utils.DefaultLogger.WithPrefix("server"),
@@ -123,6 +126,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			func(p *TransportParameters) {},
 			testdata.GetTLSConfig(),
+			nil,
 			[]protocol.VersionNumber{protocol.VersionTLS},
 			protocol.VersionTLS,
 			utils.DefaultLogger.WithPrefix("server"),
@@ -141,6 +145,65 @@ var _ = Describe("Crypto Setup TLS", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("returns the connection state before the handshake completed", func() {
+		_, sInitialStream, sHandshakeStream := initStreams()
+		server, err := NewCryptoSetupServer(
+			sInitialStream,
+			sHandshakeStream,
+			protocol.ConnectionID{},
+			&TransportParameters{},
+			func(p *TransportParameters) {},
+			testdata.GetTLSConfig(),
+			nil,
+			[]protocol.VersionNumber{protocol.VersionTLS},
+			protocol.VersionTLS,
+			utils.DefaultLogger.WithPrefix("server"),
+			protocol.PerspectiveServer,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		state := server.ConnectionState()
+		Expect(state.HandshakeComplete).To(BeFalse())
+		Expect(state.Version).To(Equal(protocol.VersionTLS))
+		Expect(state.NegotiatedProtocol).To(BeEmpty())
+		Expect(state.PeerTransportParameters).To(BeNil())
+	})
+
+	It("exposes a copy of the peer's transport parameters", func() {
+		_, initialStream, handshakeStream := initStreams()
+		cs, err := NewCryptoSetupServer(
+			initialStream,
+			handshakeStream,
+			protocol.ConnectionID{},
+			&TransportParameters{},
+			func(p *TransportParameters) {},
+			testdata.GetTLSConfig(),
+			nil,
+			[]protocol.VersionNumber{protocol.VersionTLS},
+			protocol.VersionTLS,
+			utils.DefaultLogger.WithPrefix("server"),
+			protocol.PerspectiveServer,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		params := &TransportParameters{
+			InitialMaxData:       0x1337,
+			MaxBidiStreams:       42,
+			IdleTimeout:          time.Minute,
+			AdditionalParameters: []TransportParameter{{ID: 0x1337, Value: []byte("foobar")}},
+		}
+		cs.(*cryptoSetup).handleTransportParameters(params)
+		state := cs.ConnectionState()
+		Expect(state.PeerTransportParameters).To(Equal(&PeerTransportParameters{
+			InitialMaxData: 0x1337,
+			MaxBidiStreams: 42,
+			IdleTimeout:    time.Minute,
+			Additional:     []TransportParameter{{ID: 0x1337, Value: []byte("foobar")}},
+		}))
+		state.PeerTransportParameters.MaxBidiStreams = 1
+		state.PeerTransportParameters.Additional[0].Value[0] = 'g'
+		Expect(params.MaxBidiStreams).To(BeEquivalentTo(42))
+		Expect(params.AdditionalParameters[0].Value).To(Equal([]byte("foobar")))
+	})
+
 	Context("doing the handshake", func() {
 		generateCert := func() tls.Certificate {
 			priv, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -194,7 +257,12 @@ var _ = Describe("Crypto Setup TLS", func() {
 			return clientErr, serverErr
 		}
 
-		handshakeWithTLSConf := func(clientConf, serverConf *tls.Config) (error /* client error */, error /* server error */) {
+		handshakeWithPSK := func(
+			clientConf *tls.Config,
+			clientPSK *PSKConfig,
+			serverConf *tls.Config,
+			serverPSK *PSKConfig,
+		) (CryptoSetup /* client */, CryptoSetup /* server */, error /* client error */, error /* server error */) {
 			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
 			client, _, err := NewCryptoSetupClient(
 				cInitialStream,
@@ -204,6 +272,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				func(p *TransportParameters) {},
 				clientConf,
+				clientPSK,
 				protocol.VersionTLS,
 				[]protocol.VersionNumber{protocol.VersionTLS},
 				protocol.VersionTLS,
@@ -220,6 +289,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{StatelessResetToken: bytes.Repeat([]byte{42}, 16)},
 				func(p *TransportParameters) {},
 				serverConf,
+				serverPSK,
 				[]protocol.VersionNumber{protocol.VersionTLS},
 				protocol.VersionTLS,
 				utils.DefaultLogger.WithPrefix("server"),
@@ -227,7 +297,13 @@ var _ = Describe("Crypto Setup TLS", func() {
 			)
 			Expect(err).ToNot(HaveOccurred())
 
-			return handshake(client, cChunkChan, server, sChunkChan)
+			clientErr, serverErr := handshake(client, cChunkChan, server, sChunkChan)
+			return client, server, clientErr, serverErr
+		}
+
+		handshakeWithTLSConf := func(clientConf, serverConf *tls.Config) (error /* client error */, error /* server error */) {
+			_, _, clientErr, serverErr := handshakeWithPSK(clientConf, nil, serverConf, nil)
+			return clientErr, serverErr
 		}
 
 		It("handshakes", func() {
@@ -250,6 +326,92 @@ var _ = Describe("Crypto Setup TLS", func() {
 			Expect(serverErr).ToNot(HaveOccurred())
 		})
 
+		for _, s := range []uint16{qtls.TLS_AES_128_GCM_SHA256, qtls.TLS_AES_256_GCM_SHA384, qtls.TLS_CHACHA20_POLY1305_SHA256} {
+			suite := s
+
+			It(fmt.Sprintf("handshakes and protects packets using cipher suite %#x", suite), func() {
+				client, server, clientErr, serverErr := handshakeWithPSK(
+					&tls.Config{ServerName: "quic.clemente.io", InsecureSkipVerify: true, CipherSuites: []uint16{suite}},
+					nil,
+					&tls.Config{Certificates: []tls.Certificate{generateCert()}},
+					nil,
+				)
+				Expect(clientErr).ToNot(HaveOccurred())
+				Expect(serverErr).ToNot(HaveOccurred())
+				Expect(client.ConnectionState().CipherSuite).To(Equal(suite))
+				Expect(server.ConnectionState().CipherSuite).To(Equal(suite))
+
+				encLevel, sealer := client.GetSealer()
+				Expect(encLevel).To(Equal(protocol.Encryption1RTT))
+				opener, err := server.GetOpener(protocol.Encryption1RTT)
+				Expect(err).ToNot(HaveOccurred())
+				sealed := sealer.Seal(nil, []byte("foobar"), 42, []byte("header"))
+				firstByte := byte(0x41)
+				pnBytes := []byte{0x0, 0x2a}
+				sample := sealed[len(sealed)-16:]
+				sealer.EncryptHeader(sample, &firstByte, pnBytes)
+				opener.DecryptHeader(sample, &firstByte, pnBytes)
+				Expect(firstByte).To(Equal(byte(0x41)))
+				Expect(pnBytes).To(Equal([]byte{0x0, 0x2a}))
+				opened, err := opener.Open(nil, sealed, 42, []byte("header"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(opened).To(Equal([]byte("foobar")))
+			})
+		}
+
+		Context("using an external PSK", func() {
+			getKey := func(identity []byte) ([]byte, error) {
+				if string(identity) == "device" {
+					return []byte("secret key"), nil
+				}
+				return nil, nil
+			}
+
+			It("handshakes using psk_dhe_ke", func() {
+				client, server, clientErr, serverErr := handshakeWithPSK(
+					&tls.Config{ServerName: "quic.clemente.io"},
+					&PSKConfig{Identity: []byte("device"), Key: []byte("secret key")},
+					&tls.Config{}, // no certificates
+					&PSKConfig{GetKey: getKey},
+				)
+				Expect(clientErr).ToNot(HaveOccurred())
+				Expect(serverErr).ToNot(HaveOccurred())
+				for _, state := range []ConnectionState{client.ConnectionState(), server.ConnectionState()} {
+					Expect(state.HandshakeComplete).To(BeTrue())
+					Expect(state.PSKIdentity).To(Equal([]byte("device")))
+					Expect(state.CipherSuite).To(Equal(qtls.TLS_AES_128_GCM_SHA256))
+				}
+				Expect(client.ConnectionState().PeerCertificates).To(BeEmpty())
+			})
+
+			It("handshakes using psk_ke", func() {
+				client, server, clientErr, serverErr := handshakeWithPSK(
+					&tls.Config{ServerName: "quic.clemente.io"},
+					&PSKConfig{Identity: []byte("device"), Key: []byte("secret key"), DisableDHE: true},
+					&tls.Config{}, // no certificates
+					&PSKConfig{GetKey: getKey, DisableDHE: true},
+				)
+				Expect(clientErr).ToNot(HaveOccurred())
+				Expect(serverErr).ToNot(HaveOccurred())
+				Expect(client.ConnectionState().PSKIdentity).To(Equal([]byte("device")))
+				Expect(server.ConnectionState().PSKIdentity).To(Equal([]byte("device")))
+			})
+
+			It("falls back to certificates if the server doesn't know the identity", func() {
+				client, server, clientErr, serverErr := handshakeWithPSK(
+					&tls.Config{ServerName: "quic.clemente.io"},
+					&PSKConfig{Identity: []byte("unknown device"), Key: []byte("secret key")},
+					testdata.GetTLSConfig(),
+					&PSKConfig{GetKey: getKey},
+				)
+				Expect(clientErr).ToNot(HaveOccurred())
+				Expect(serverErr).ToNot(HaveOccurred())
+				Expect(client.ConnectionState().PSKIdentity).To(BeEmpty())
+				Expect(server.ConnectionState().PSKIdentity).To(BeEmpty())
+				Expect(client.ConnectionState().PeerCertificates).ToNot(BeEmpty())
+			})
+		})
+
 		It("signals when it has written the ClientHello", func() {
 			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
 			client, chChan, err := NewCryptoSetupClient(
@@ -260,6 +422,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				func(p *TransportParameters) {},
 				&tls.Config{InsecureSkipVerify: true},
+				nil,
 				protocol.VersionTLS,
 				[]protocol.VersionNumber{protocol.VersionTLS},
 				protocol.VersionTLS,
@@ -291,7 +454,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 		It("receives transport parameters", func() {
 			var cTransportParametersRcvd, sTransportParametersRcvd *TransportParameters
 			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
-			cTransportParameters := &TransportParameters{IdleTimeout: 0x42 * time.Second}
+			cTransportParameters := &TransportParameters{
+				IdleTimeout:          0x42 * time.Second,
+				AdditionalParameters: []TransportParameter{{ID: 0x1337, Value: []byte("foobar")}},
+			}
 			client, _, err := NewCryptoSetupClient(
 				cInitialStream,
 				cHandshakeStream,
@@ -300,6 +466,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				cTransportParameters,
 				func(p *TransportParameters) { sTransportParametersRcvd = p },
 				&tls.Config{ServerName: "quic.clemente.io"},
+				nil,
 				protocol.VersionTLS,
 				[]protocol.VersionNumber{protocol.VersionTLS},
 				protocol.VersionTLS,
@@ -320,6 +487,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				sTransportParameters,
 				func(p *TransportParameters) { cTransportParametersRcvd = p },
 				testdata.GetTLSConfig(),
+				nil,
 				[]protocol.VersionNumber{protocol.VersionTLS},
 				protocol.VersionTLS,
 				utils.DefaultLogger.WithPrefix("server"),
@@ -340,6 +508,64 @@ var _ = Describe("Crypto Setup TLS", func() {
 			Expect(cTransportParametersRcvd.IdleTimeout).To(Equal(cTransportParameters.IdleTimeout))
 			Expect(sTransportParametersRcvd).ToNot(BeNil())
 			Expect(sTransportParametersRcvd.IdleTimeout).To(Equal(sTransportParameters.IdleTimeout))
+			Expect(server.ConnectionState().PeerTransportParameters.Additional).To(Equal(cTransportParameters.AdditionalParameters))
+			Expect(client.ConnectionState().PeerTransportParameters.Additional).To(BeEmpty())
+			Expect(server.ConnectionState().PeerTransportParameters.IdleTimeout).To(Equal(cTransportParameters.IdleTimeout))
+			Expect(client.ConnectionState().PeerTransportParameters.IdleTimeout).To(Equal(sTransportParameters.IdleTimeout))
+		})
+
+		It("exposes the connection state", func() {
+			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
+			client, _, err := NewCryptoSetupClient(
+				cInitialStream,
+				cHandshakeStream,
+				nil,
+				protocol.ConnectionID{},
+				&TransportParameters{},
+				func(p *TransportParameters) {},
+				&tls.Config{ServerName: "quic.clemente.io", NextProtos: []string{"proto"}},
+				nil,
+				protocol.VersionTLS,
+				[]protocol.VersionNumber{protocol.VersionTLS},
+				protocol.VersionTLS,
+				utils.DefaultLogger.WithPrefix("client"),
+				protocol.PerspectiveClient,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			sChunkChan, sInitialStream, sHandshakeStream := initStreams()
+			serverConf := testdata.GetTLSConfig()
+			serverConf.NextProtos = []string{"proto"}
+			server, err := NewCryptoSetupServer(
+				sInitialStream,
+				sHandshakeStream,
+				protocol.ConnectionID{},
+				&TransportParameters{StatelessResetToken: bytes.Repeat([]byte{42}, 16)},
+				func(p *TransportParameters) {},
+				serverConf,
+				nil,
+				[]protocol.VersionNumber{protocol.VersionTLS},
+				protocol.VersionTLS,
+				utils.DefaultLogger.WithPrefix("server"),
+				protocol.PerspectiveServer,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			clientErr, serverErr := handshake(client, cChunkChan, server, sChunkChan)
+			Expect(clientErr).ToNot(HaveOccurred())
+			Expect(serverErr).ToNot(HaveOccurred())
+			for _, state := range []ConnectionState{client.ConnectionState(), server.ConnectionState()} {
+				Expect(state.HandshakeComplete).To(BeTrue())
+				Expect(state.Version).To(Equal(protocol.VersionTLS))
+				Expect(state.NegotiatedProtocol).To(Equal("proto"))
+				Expect(state.CipherSuite).ToNot(BeZero())
+				Expect(state.DidResume).To(BeFalse())
+				Expect(state.Used0RTT).To(BeFalse())
+				Expect(state.PeerTransportParameters).ToNot(BeNil())
+			}
+			Expect(client.ConnectionState().PeerCertificates).ToNot(BeEmpty())
+			Expect(client.ConnectionState().VerifiedChains).ToNot(BeEmpty())
+			Expect(server.ConnectionState().ServerName).To(Equal("quic.clemente.io"))
 		})
 	})
 })
@@ -11,12 +11,18 @@ import (
 // Opener opens a packet
 type Opener interface {
 	Open(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
+	// DecryptHeader removes header protection.
+	// It is a no-op for versions that don't use header protection.
+	DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
 }
 
 // Sealer seals a packet
 type Sealer interface {
 	Seal(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) []byte
 	Overhead() int
+	// EncryptHeader applies header protection.
+	// It is a no-op for versions that don't use header protection.
+	EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
 }
 
 // A tlsExtensionHandler sends and received the QUIC TLS extension.
@@ -35,6 +41,7 @@ type CryptoSetup interface {
 
 	GetSealer() (protocol.EncryptionLevel, Sealer)
 	GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (Sealer, error)
+	GetOpener(protocol.EncryptionLevel) (Opener, error)
 
 	OpenInitial(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]byte, error)
 	OpenHandshake(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]byte, error)
@@ -44,7 +51,17 @@ type CryptoSetup interface {
 // ConnectionState records basic details about the QUIC connection.
 // Warning: This API should not be considered stable and might change soon.
 type ConnectionState struct {
-	HandshakeComplete bool                // handshake is complete
-	ServerName        string              // server name requested by client, if any (server side only)
-	PeerCertificates  []*x509.Certificate // certificate chain presented by remote peer
+	HandshakeComplete           bool                     // handshake is complete
+	Version                     protocol.VersionNumber   // QUIC version used by the connection
+	ServerName                  string                   // server name requested by client, if any (server side only)
+	NegotiatedProtocol          string                   // negotiated application protocol (ALPN)
+	CipherSuite                 uint16                   // cipher suite in use (TLS_AES_128_GCM_SHA256, ...)
+	DidResume                   bool                     // connection resumes a previous TLS session
+	Used0RTT                    bool                     // 0-RTT was used. Always false, since 0-RTT is not supported yet.
+	PeerCertificates            []*x509.Certificate      // certificate chain presented by remote peer
+	VerifiedChains              [][]*x509.Certificate    // verified chains built from PeerCertificates
+	SignedCertificateTimestamps [][]byte                 // SCTs from the server, if any
+	OCSPResponse                []byte                   // stapled OCSP response from the server, if any
+	PSKIdentity                 []byte                   // identity of the external PSK used to authenticate the handshake, if any
+	PeerTransportParameters     *PeerTransportParameters // transport parameters sent by the peer, nil if not received yet
 }
@@ -0,0 +1,21 @@
+package handshake
+
+// PSKConfig configures an external pre-shared key (PSK) for the TLS 1.3 handshake.
+// When the handshake is authenticated with a PSK, no certificates are sent.
+// External PSKs can only be used with the SHA-256 cipher suites (TLS_AES_128_GCM_SHA256 and TLS_CHACHA20_POLY1305_SHA256).
+// Warning: This API should not be considered stable and might change soon.
+type PSKConfig struct {
+	// Identity and Key are the PSK that the client offers to the server.
+	// They are only valid for the client.
+	Identity []byte
+	Key      []byte
+	// GetKey is called by the server with every PSK identity offered by the client.
+	// It returns the key for that identity, or nil if the identity is unknown.
+	// If no key is found, the handshake falls back to certificate authentication.
+	// It is only valid for the server.
+	GetKey func(identity []byte) ([]byte, error)
+	// DisableDHE selects the psk_ke key exchange mode: the handshake is keyed by the PSK only,
+	// without an ECDHE key exchange. Connections then don't provide forward secrecy.
+	// A client only offers psk_ke. A server accepts psk_ke if the client doesn't offer psk_dhe_ke.
+	DisableDHE bool
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/marten-seemann/qtls"
 )
 
-func tlsConfigToQtlsConfig(c *tls.Config) *qtls.Config {
+func tlsConfigToQtlsConfig(c *tls.Config, psk *PSKConfig) *qtls.Config {
 	if c == nil {
 		c = &tls.Config{}
 	}
@@ -17,7 +17,7 @@ func tlsConfigToQtlsConfig(c *tls.Config) *qtls.Config {
 	if c.MaxVersion < qtls.VersionTLS13 {
 		c.MaxVersion = qtls.VersionTLS13
 	}
-	return &qtls.Config{
+	conf := &qtls.Config{
 		Rand:              c.Rand,
 		Time:              c.Time,
 		Certificates:      c.Certificates,
@@ -45,4 +45,56 @@ func tlsConfigToQtlsConfig(c *tls.Config) *qtls.Config {
 		Renegotiation:               c.Renegotiation,
 		KeyLogWriter:                c.KeyLogWriter,
 	}
+	if psk != nil {
+		conf.ExternalPSKIdentity = psk.Identity
+		conf.ExternalPSK = psk.Key
+		conf.GetExternalPSK = psk.GetKey
+		conf.ExternalPSKWithoutDHE = psk.DisableDHE
+		// A client offering psk_dhe_ke would make the server send session tickets.
+		// Session tickets are not supported yet.
+		conf.SessionTicketsDisabled = true
+	}
+	return conf
+}
+
+// supportedCipherSuites are the TLS 1.3 cipher suites that can be used for QUIC packet protection,
+// in the order of preference used if tls.Config.CipherSuites doesn't configure any of them.
+var supportedCipherSuites = []uint16{
+	qtls.TLS_AES_128_GCM_SHA256,
+	qtls.TLS_CHACHA20_POLY1305_SHA256,
+	qtls.TLS_AES_256_GCM_SHA384,
+}
+
+// cipherSuitesForConfig returns the cipher suites that may be negotiated.
+// The TLS 1.3 cipher suites in configured restrict the choice (and define the order of preference).
+// Cipher suites for older TLS versions are ignored.
+// External PSKs can only be used with SHA-256 cipher suites.
+func cipherSuitesForConfig(configured []uint16, usePSK bool) []uint16 {
+	var suites []uint16
+	for _, id := range configured {
+		for _, s := range supportedCipherSuites {
+			if id == s {
+				suites = append(suites, id)
+				break
+			}
+		}
+	}
+	if len(suites) == 0 {
+		suites = supportedCipherSuites
+	}
+	if !usePSK {
+		return suites
+	}
+	pskSuites := make([]uint16, 0, len(suites))
+	for _, id := range suites {
+		if id != qtls.TLS_AES_256_GCM_SHA384 {
+			pskSuites = append(pskSuites, id)
+		}
+	}
+	if len(pskSuites) == 0 {
+		// Only TLS_AES_256_GCM_SHA384 was configured.
+		// The external PSK can't be used, and the handshake is authenticated using certificates.
+		return suites
+	}
+	return pskSuites
 }
@@ -0,0 +1,35 @@
+package handshake
+
+import (
+	"github.com/marten-seemann/qtls"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("qtls Config", func() {
+	Context("cipher suites", func() {
+		It("uses all supported cipher suites by default", func() {
+			Expect(cipherSuitesForConfig(nil, false)).To(Equal(supportedCipherSuites))
+		})
+
+		It("restricts the cipher suites to the configured TLS 1.3 cipher suites", func() {
+			configured := []uint16{qtls.TLS_CHACHA20_POLY1305_SHA256, qtls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, qtls.TLS_AES_256_GCM_SHA384}
+			Expect(cipherSuitesForConfig(configured, false)).To(Equal([]uint16{qtls.TLS_CHACHA20_POLY1305_SHA256, qtls.TLS_AES_256_GCM_SHA384}))
+		})
+
+		It("uses all supported cipher suites if no TLS 1.3 cipher suite is configured", func() {
+			configured := []uint16{qtls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+			Expect(cipherSuitesForConfig(configured, false)).To(Equal(supportedCipherSuites))
+		})
+
+		It("only uses SHA-256 cipher suites with an external PSK", func() {
+			Expect(cipherSuitesForConfig(nil, true)).To(Equal([]uint16{qtls.TLS_AES_128_GCM_SHA256, qtls.TLS_CHACHA20_POLY1305_SHA256}))
+		})
+
+		It("doesn't use the external PSK if only TLS_AES_256_GCM_SHA384 is configured", func() {
+			configured := []uint16{qtls.TLS_AES_256_GCM_SHA384}
+			Expect(cipherSuitesForConfig(configured, true)).To(Equal(configured))
+		})
+	})
+})
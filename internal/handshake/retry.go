@@ -0,0 +1,44 @@
+package handshake
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+var retryAEAD cipher.AEAD
+
+func init() {
+	block, err := aes.NewCipher([]byte{0xbe, 0x0c, 0x69, 0x0b, 0x9f, 0x66, 0x57, 0x5a, 0x1d, 0x76, 0x6b, 0x54, 0xe3, 0x68, 0xc8, 0x4e})
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	retryAEAD = aead
+}
+
+var retryNonce = []byte{0x46, 0x15, 0x99, 0xd3, 0x5d, 0x63, 0x2b, 0xf2, 0x23, 0x98, 0x25, 0xbb}
+
+var (
+	retryBuf   bytes.Buffer
+	retryMutex sync.Mutex
+)
+
+// GetRetryIntegrityTag calculates the integrity tag on a Retry packet, as defined in section 5.8 of RFC 9001.
+// The retry parameter is the Retry packet, excluding the integrity tag.
+func GetRetryIntegrityTag(retry []byte, origDestConnID protocol.ConnectionID) []byte {
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+
+	retryBuf.Reset()
+	retryBuf.WriteByte(uint8(origDestConnID.Len()))
+	retryBuf.Write(origDestConnID.Bytes())
+	retryBuf.Write(retry)
+	return retryAEAD.Seal(nil, retryNonce, nil, retryBuf.Bytes())
+}
@@ -0,0 +1,34 @@
+package handshake
+
+import (
+	"encoding/hex"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry Integrity Check", func() {
+	It("calculates the integrity tag", func() {
+		fooTag := GetRetryIntegrityTag([]byte("foo"), protocol.ConnectionID{1, 2, 3, 4})
+		barTag := GetRetryIntegrityTag([]byte("bar"), protocol.ConnectionID{1, 2, 3, 4})
+		Expect(fooTag).To(HaveLen(16))
+		Expect(barTag).To(HaveLen(16))
+		Expect(fooTag).ToNot(Equal(barTag))
+		Expect(GetRetryIntegrityTag([]byte("foo"), protocol.ConnectionID{4, 3, 2, 1})).ToNot(Equal(fooTag))
+	})
+
+	It("includes the original connection ID in the tag calculation", func() {
+		t1 := GetRetryIntegrityTag([]byte("foobar"), protocol.ConnectionID{1, 2, 3, 4})
+		t2 := GetRetryIntegrityTag([]byte("foobar"), protocol.ConnectionID{1, 2, 3, 5})
+		Expect(t1).ToNot(Equal(t2))
+	})
+
+	It("uses the test vector from RFC 9001, appendix A.4", func() {
+		data, err := hex.DecodeString("ff000000010008f067a5502a4262b5746f6b656e04a265ba2eff4d829058fb3f0f2496ba")
+		Expect(err).ToNot(HaveOccurred())
+		connID := protocol.ConnectionID{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+		Expect(GetRetryIntegrityTag(data[:len(data)-16], connID)).To(Equal(data[len(data)-16:]))
+	})
+})
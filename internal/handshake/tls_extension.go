@@ -10,7 +10,14 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
-const quicTLSExtensionType = 0xff5
+const (
+	quicTLSExtensionType = 0xff5
+	// the TLS extension used by QUIC version 1, see section 8.2 of RFC 9001
+	quicTLSExtensionTypeV1 = 0x39
+)
+
+// the missing_extension TLS alert, see section 8.2 of RFC 9001
+const alertMissingExtension = 109
 
 type clientHelloTransportParameters struct {
 	InitialVersion protocol.VersionNumber
@@ -22,7 +29,7 @@ func (p *clientHelloTransportParameters) Marshal() []byte {
 	b := &bytes.Buffer{}
 	utils.BigEndian.WriteUint32(b, uint32(p.InitialVersion))
 	b.Write([]byte{0, 0}) // length. Will be replaced later
-	p.Parameters.marshal(b)
+	p.Parameters.marshal(b, protocol.VersionTLS)
 	data := b.Bytes()
 	binary.BigEndian.PutUint16(data[lenOffset:lenOffset+2], uint16(len(data)-lenOffset-2))
 	return data
@@ -38,7 +45,7 @@ func (p *clientHelloTransportParameters) Unmarshal(data []byte) error {
 	if len(data) != paramsLen {
 		return fmt.Errorf("expected transport parameters to be %d bytes long, have %d", paramsLen, len(data))
 	}
-	return p.Parameters.unmarshal(data, protocol.PerspectiveClient)
+	return p.Parameters.unmarshal(data, protocol.PerspectiveClient, protocol.VersionTLS)
 }
 
 type encryptedExtensionsTransportParameters struct {
@@ -56,7 +63,7 @@ func (p *encryptedExtensionsTransportParameters) Marshal() []byte {
 	}
 	lenOffset := b.Len()
 	b.Write([]byte{0, 0}) // length. Will be replaced later
-	p.Parameters.marshal(b)
+	p.Parameters.marshal(b, protocol.VersionTLS)
 	data := b.Bytes()
 	binary.BigEndian.PutUint16(data[lenOffset:lenOffset+2], uint16(len(data)-lenOffset-2))
 	return data
@@ -86,5 +93,5 @@ func (p *encryptedExtensionsTransportParameters) Unmarshal(data []byte) error {
 	if len(data) != paramsLen {
 		return fmt.Errorf("expected transport parameters to be %d bytes long, have %d", paramsLen, len(data))
 	}
-	return p.Parameters.unmarshal(data, protocol.PerspectiveServer)
+	return p.Parameters.unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)
 }
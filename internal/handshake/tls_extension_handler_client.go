@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -53,6 +54,11 @@ func (h *extensionHandlerClient) GetExtensions(msgType uint8) []qtls.Extension {
 		return nil
 	}
 	h.logger.Debugf("Sending Transport Parameters: %s", h.ourParams)
+	if h.version == protocol.Version1 {
+		b := &bytes.Buffer{}
+		h.ourParams.marshal(b, h.version)
+		return []qtls.Extension{{Type: quicTLSExtensionTypeV1, Data: b.Bytes()}}
+	}
 	return []qtls.Extension{{
 		Type: quicTLSExtensionType,
 		Data: (&clientHelloTransportParameters{
@@ -66,6 +72,9 @@ func (h *extensionHandlerClient) ReceivedExtensions(msgType uint8, exts []qtls.E
 	if messageType(msgType) != typeEncryptedExtensions {
 		return nil
 	}
+	if h.version == protocol.Version1 {
+		return h.receivedExtensionsV1(exts)
+	}
 
 	var found bool
 	eetp := &encryptedExtensionsTransportParameters{}
@@ -84,17 +93,17 @@ func (h *extensionHandlerClient) ReceivedExtensions(msgType uint8, exts []qtls.E
 
 	// check that the negotiated_version is the current version
 	if eetp.NegotiatedVersion != h.version {
-		return qerr.Error(qerr.VersionNegotiationMismatch, "current version doesn't match negotiated_version")
+		return qerr.Error(qerr.TransportParameterError, "current version doesn't match negotiated_version")
 	}
 	// check that the current version is included in the supported versions
 	if !protocol.IsSupportedVersion(eetp.SupportedVersions, h.version) {
-		return qerr.Error(qerr.VersionNegotiationMismatch, "current version not included in the supported versions")
+		return qerr.Error(qerr.TransportParameterError, "current version not included in the supported versions")
 	}
 	// if version negotiation was performed, check that we would have selected the current version based on the supported versions sent by the server
 	if h.version != h.initialVersion {
 		negotiatedVersion, ok := protocol.ChooseSupportedVersion(h.supportedVersions, eetp.SupportedVersions)
 		if !ok || h.version != negotiatedVersion {
-			return qerr.Error(qerr.VersionNegotiationMismatch, "would have picked a different version")
+			return qerr.Error(qerr.TransportParameterError, "would have picked a different version")
 		}
 	}
 
@@ -111,3 +120,29 @@ func (h *extensionHandlerClient) ReceivedExtensions(msgType uint8, exts []qtls.E
 	h.paramsChan <- params
 	return nil
 }
+
+// receivedExtensionsV1 handles the transport parameters extension of QUIC version 1.
+// Version negotiation is not authenticated by the transport parameters any more.
+func (h *extensionHandlerClient) receivedExtensionsV1(exts []qtls.Extension) error {
+	var found bool
+	params := TransportParameters{}
+	for _, ext := range exts {
+		if ext.Type != quicTLSExtensionTypeV1 {
+			continue
+		}
+		if err := params.unmarshal(ext.Data, protocol.PerspectiveServer, h.version); err != nil {
+			return qerr.Error(qerr.TransportParameterError, err.Error())
+		}
+		found = true
+	}
+	if !found {
+		return qerr.Error(qerr.CryptoErrorCode(alertMissingExtension), "EncryptedExtensions message didn't contain a QUIC extension")
+	}
+	// In QUIC version 1, the server always sends the original_destination_connection_id.
+	if !h.origConnID.Equal(params.OriginalConnectionID) {
+		return qerr.Error(qerr.TransportParameterError, fmt.Sprintf("expected original_destination_connection_id to equal %s, is %s", h.origConnID, params.OriginalConnectionID))
+	}
+	h.logger.Debugf("Received Transport Parameters: %s", &params)
+	h.paramsChan <- params
+	return nil
+}
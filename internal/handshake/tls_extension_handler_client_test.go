@@ -166,7 +166,7 @@ var _ = Describe("TLS Extension Handler, for the client", func() {
 					}).Marshal(),
 				}
 				err := handler.ReceivedExtensions(uint8(typeEncryptedExtensions), []qtls.Extension{ext})
-				Expect(err).To(MatchError("VersionNegotiationMismatch: current version doesn't match negotiated_version"))
+				Expect(err).To(MatchError("TRANSPORT_PARAMETER_ERROR: current version doesn't match negotiated_version"))
 			})
 
 			It("errors if the current version is not contained in the server's supported versions", func() {
@@ -179,7 +179,7 @@ var _ = Describe("TLS Extension Handler, for the client", func() {
 					}).Marshal(),
 				}
 				err := handler.ReceivedExtensions(uint8(typeEncryptedExtensions), []qtls.Extension{ext})
-				Expect(err).To(MatchError("VersionNegotiationMismatch: current version not included in the supported versions"))
+				Expect(err).To(MatchError("TRANSPORT_PARAMETER_ERROR: current version not included in the supported versions"))
 			})
 
 			It("errors if version negotiation was performed, but would have picked a different version based on the supported version list", func() {
@@ -199,7 +199,7 @@ var _ = Describe("TLS Extension Handler, for the client", func() {
 					}).Marshal(),
 				}
 				err := handler.ReceivedExtensions(uint8(typeEncryptedExtensions), []qtls.Extension{ext})
-				Expect(err).To(MatchError("VersionNegotiationMismatch: would have picked a different version"))
+				Expect(err).To(MatchError("TRANSPORT_PARAMETER_ERROR: would have picked a different version"))
 			})
 
 			It("doesn't error if it would have picked a different version based on the supported version list, if no version negotiation was performed", func() {
@@ -232,4 +232,53 @@ var _ = Describe("TLS Extension Handler, for the client", func() {
 			})
 		})
 	})
+
+	Context("in QUIC version 1", func() {
+		BeforeEach(func() {
+			handler.version = protocol.Version1
+			handler.origConnID = protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		})
+
+		It("sends the transport parameters in the QUIC v1 extension", func() {
+			handler.ourParams = &TransportParameters{MaxUniStreams: 1337}
+			exts := handler.GetExtensions(uint8(typeClientHello))
+			Expect(exts).To(HaveLen(1))
+			Expect(exts[0].Type).To(BeEquivalentTo(0x39))
+			params := &TransportParameters{}
+			Expect(params.unmarshal(exts[0].Data, protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			Expect(params.MaxUniStreams).To(BeEquivalentTo(1337))
+		})
+
+		It("receives the transport parameters", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{
+				MaxBidiStreams:       42,
+				OriginalConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+			}).marshal(b, protocol.Version1)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := handler.ReceivedExtensions(uint8(typeEncryptedExtensions), []qtls.Extension{{Type: 0x39, Data: b.Bytes()}})
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			var params TransportParameters
+			Eventually(paramsChan).Should(Receive(&params))
+			Expect(params.MaxBidiStreams).To(BeEquivalentTo(42))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("errors if the original_destination_connection_id doesn't match", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{OriginalConnectionID: protocol.ConnectionID{1, 2, 3, 4}}).marshal(b, protocol.Version1)
+			err := handler.ReceivedExtensions(uint8(typeEncryptedExtensions), []qtls.Extension{{Type: 0x39, Data: b.Bytes()}})
+			Expect(err).To(MatchError("TRANSPORT_PARAMETER_ERROR: expected original_destination_connection_id to equal 0xdeadbeef, is 0x01020304"))
+		})
+
+		It("errors if the EncryptedExtensions don't contain the QUIC v1 extension", func() {
+			ext := qtls.Extension{Type: quicTLSExtensionType}
+			err := handler.ReceivedExtensions(uint8(typeEncryptedExtensions), []qtls.Extension{ext})
+			Expect(err).To(MatchError("CRYPTO_ERROR (0x16d): EncryptedExtensions message didn't contain a QUIC extension"))
+		})
+	})
 })
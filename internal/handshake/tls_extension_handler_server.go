@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -45,6 +46,11 @@ func (h *extensionHandlerServer) GetExtensions(msgType uint8) []qtls.Extension {
 		return nil
 	}
 	h.logger.Debugf("Sending Transport Parameters: %s", h.ourParams)
+	if h.version == protocol.Version1 {
+		b := &bytes.Buffer{}
+		h.ourParams.marshal(b, h.version)
+		return []qtls.Extension{{Type: quicTLSExtensionTypeV1, Data: b.Bytes()}}
+	}
 	return []qtls.Extension{{
 		Type: quicTLSExtensionType,
 		Data: (&encryptedExtensionsTransportParameters{
@@ -59,6 +65,9 @@ func (h *extensionHandlerServer) ReceivedExtensions(msgType uint8, exts []qtls.E
 	if messageType(msgType) != typeClientHello {
 		return nil
 	}
+	if h.version == protocol.Version1 {
+		return h.receivedExtensionsV1(exts)
+	}
 	var found bool
 	chtp := &clientHelloTransportParameters{}
 	for _, ext := range exts {
@@ -78,9 +87,30 @@ func (h *extensionHandlerServer) ReceivedExtensions(msgType uint8, exts []qtls.E
 	// make sure that we would have sent a Version Negotiation Packet if the client offered the initial version
 	// this is the case if and only if the initial version is not contained in the supported versions
 	if chtp.InitialVersion != h.version && protocol.IsSupportedVersion(h.supportedVersions, chtp.InitialVersion) {
-		return qerr.Error(qerr.VersionNegotiationMismatch, "Client should have used the initial version")
+		return qerr.Error(qerr.TransportParameterError, "Client should have used the initial version")
 	}
 	h.logger.Debugf("Received Transport Parameters: %s", &chtp.Parameters)
 	h.paramsChan <- chtp.Parameters
 	return nil
 }
+
+// receivedExtensionsV1 handles the transport parameters extension of QUIC version 1.
+func (h *extensionHandlerServer) receivedExtensionsV1(exts []qtls.Extension) error {
+	var found bool
+	params := TransportParameters{}
+	for _, ext := range exts {
+		if ext.Type != quicTLSExtensionTypeV1 {
+			continue
+		}
+		if err := params.unmarshal(ext.Data, protocol.PerspectiveClient, h.version); err != nil {
+			return qerr.Error(qerr.TransportParameterError, err.Error())
+		}
+		found = true
+	}
+	if !found {
+		return qerr.Error(qerr.CryptoErrorCode(alertMissingExtension), "ClientHello didn't contain a QUIC extension")
+	}
+	h.logger.Debugf("Received Transport Parameters: %s", &params)
+	h.paramsChan <- params
+	return nil
+}
@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"bytes"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -150,8 +151,54 @@ var _ = Describe("TLS Extension Handler, for the server", func() {
 					}).Marshal(),
 				}
 				err := handler.ReceivedExtensions(uint8(typeClientHello), []qtls.Extension{ext})
-				Expect(err).To(MatchError("VersionNegotiationMismatch: Client should have used the initial version"))
+				Expect(err).To(MatchError("TRANSPORT_PARAMETER_ERROR: Client should have used the initial version"))
 			})
 		})
 	})
+
+	Context("in QUIC version 1", func() {
+		BeforeEach(func() {
+			handler.version = protocol.Version1
+		})
+
+		It("sends the transport parameters in the QUIC v1 extension", func() {
+			handler.ourParams = &TransportParameters{
+				OriginalConnectionID:      protocol.ConnectionID{1, 2, 3, 4},
+				InitialSourceConnectionID: protocol.ConnectionID{5, 6, 7, 8},
+			}
+			exts := handler.GetExtensions(uint8(typeEncryptedExtensions))
+			Expect(exts).To(HaveLen(1))
+			Expect(exts[0].Type).To(BeEquivalentTo(0x39))
+			params := &TransportParameters{}
+			Expect(params.unmarshal(exts[0].Data, protocol.PerspectiveServer, protocol.Version1)).To(Succeed())
+			Expect(params.OriginalConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4}))
+			Expect(params.InitialSourceConnectionID).To(Equal(protocol.ConnectionID{5, 6, 7, 8}))
+		})
+
+		It("receives the transport parameters", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{MaxBidiStreams: 42}).marshal(b, protocol.Version1)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := handler.ReceivedExtensions(uint8(typeClientHello), []qtls.Extension{{Type: 0x39, Data: b.Bytes()}})
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			var params TransportParameters
+			Eventually(paramsChan).Should(Receive(&params))
+			Expect(params.MaxBidiStreams).To(BeEquivalentTo(42))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("errors if the ClientHello doesn't contain the QUIC v1 extension", func() {
+			err := handler.ReceivedExtensions(uint8(typeClientHello), nil)
+			Expect(err).To(MatchError("CRYPTO_ERROR (0x16d): ClientHello didn't contain a QUIC extension"))
+		})
+
+		It("errors if the transport parameters can't be parsed", func() {
+			err := handler.ReceivedExtensions(uint8(typeClientHello), []qtls.Extension{{Type: 0x39, Data: []byte{0x1}}})
+			Expect(err).To(MatchError(ContainSubstring("TRANSPORT_PARAMETER_ERROR")))
+		})
+	})
 })
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"math"
 	"math/rand"
+	"net"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -47,10 +48,10 @@ var _ = Describe("Transport Parameters", func() {
 			OriginalConnectionID:           protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
 		}
 		b := &bytes.Buffer{}
-		params.marshal(b)
+		params.marshal(b, protocol.VersionTLS)
 
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(Succeed())
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 		Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(params.InitialMaxStreamDataBidiLocal))
 		Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(params.InitialMaxStreamDataBidiRemote))
 		Expect(p.InitialMaxStreamDataUni).To(Equal(params.InitialMaxStreamDataUni))
@@ -66,9 +67,83 @@ var _ = Describe("Transport Parameters", func() {
 	It("errors when the stateless_reset_token has the wrong length", func() {
 		params := &TransportParameters{StatelessResetToken: bytes.Repeat([]byte{100}, 15)}
 		b := &bytes.Buffer{}
-		params.marshal(b)
+		params.marshal(b, protocol.VersionTLS)
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(MatchError("wrong length for stateless_reset_token: 15 (expected 16)"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("wrong length for stateless_reset_token: 15 (expected 16)"))
+	})
+
+	Context("preferred_address", func() {
+		var pa *PreferredAddress
+
+		BeforeEach(func() {
+			pa = &PreferredAddress{
+				IPv4:                net.IPv4(127, 0, 0, 1),
+				IPv4Port:            42,
+				IPv6:                net.IP{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				IPv6Port:            13,
+				ConnectionID:        protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				StatelessResetToken: [16]byte{16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+			}
+		})
+
+		It("marshals and unmarshals", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{PreferredAddress: pa}).marshal(b, protocol.VersionTLS)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+			Expect(p.PreferredAddress.IPv4.Equal(pa.IPv4)).To(BeTrue())
+			Expect(p.PreferredAddress.IPv4Port).To(Equal(pa.IPv4Port))
+			Expect(p.PreferredAddress.IPv6).To(Equal(pa.IPv6))
+			Expect(p.PreferredAddress.IPv6Port).To(Equal(pa.IPv6Port))
+			Expect(p.PreferredAddress.ConnectionID).To(Equal(pa.ConnectionID))
+			Expect(p.PreferredAddress.StatelessResetToken).To(Equal(pa.StatelessResetToken))
+		})
+
+		It("marshals and unmarshals, in QUIC version 1", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{PreferredAddress: pa}).marshal(b, protocol.Version1)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.Version1)).To(Succeed())
+			Expect(p.PreferredAddress.ConnectionID).To(Equal(pa.ConnectionID))
+			Expect(p.PreferredAddress.IPv6Port).To(Equal(pa.IPv6Port))
+		})
+
+		It("uses the unspecified address if only an IPv6 address is set", func() {
+			pa.IPv4 = nil
+			pa.IPv4Port = 0
+			b := &bytes.Buffer{}
+			(&TransportParameters{PreferredAddress: pa}).marshal(b, protocol.VersionTLS)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+			Expect(p.PreferredAddress.IPv4.IsUnspecified()).To(BeTrue())
+			Expect(p.PreferredAddress.IPv4Port).To(BeZero())
+			Expect(p.PreferredAddress.IPv6).To(Equal(pa.IPv6))
+		})
+
+		It("errors if the client sent a preferred_address", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{PreferredAddress: pa}).marshal(b, protocol.VersionTLS)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("client sent a preferred_address"))
+		})
+
+		It("errors on zero-length connection IDs", func() {
+			pa.ConnectionID = nil
+			b := &bytes.Buffer{}
+			(&TransportParameters{PreferredAddress: pa}).marshal(b, protocol.VersionTLS)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("invalid connection ID length in preferred_address: 0"))
+		})
+
+		It("errors when the length is wrong", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{PreferredAddress: pa}).marshal(b, protocol.VersionTLS)
+			data := b.Bytes()
+			// the preferred_address is the last parameter, cut off the last 2 bytes of the stateless reset token
+			data = data[:len(data)-2]
+			p := &TransportParameters{}
+			Expect(p.unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).ToNot(Succeed())
+		})
 	})
 
 	It("errors when the max_packet_size is too small", func() {
@@ -77,7 +152,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(1199)))
 		utils.WriteVarInt(b, 1199)
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(MatchError("invalid value for max_packet_size: 1199 (minimum 1200)"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("invalid value for max_packet_size: 1199 (minimum 1200)"))
 	})
 
 	It("errors when disable_migration has content", func() {
@@ -86,7 +161,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, 6)
 		b.Write([]byte("foobar"))
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(MatchError("wrong length for disable_migration: 6 (expected empty)"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("wrong length for disable_migration: 6 (expected empty)"))
 	})
 
 	It("errors when the varint value has the wrong length", func() {
@@ -97,7 +172,7 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(utils.VarIntLen(val)).ToNot(BeEquivalentTo(2))
 		utils.WriteVarInt(b, val)
 		p := &TransportParameters{}
-		err := p.unmarshal(b.Bytes(), protocol.PerspectiveServer)
+		err := p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("inconsistent transport parameter length"))
 	})
@@ -117,9 +192,65 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(0x42)))
 		utils.WriteVarInt(b, 0x42)
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(Succeed())
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 		Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(protocol.ByteCount(0x1337)))
 		Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(0x42)))
+		Expect(p.AdditionalParameters).To(Equal([]TransportParameter{{ID: 0x42, Value: []byte("foobar")}}))
+	})
+
+	It("marshals and unmarshals additional parameters", func() {
+		params := &TransportParameters{
+			AdditionalParameters: []TransportParameter{
+				{ID: 0x1337, Value: []byte("foobar")},
+				{ID: 0x42, Value: []byte{}},
+			},
+		}
+		b := &bytes.Buffer{}
+		params.marshal(b, protocol.VersionTLS)
+		p := &TransportParameters{}
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+		Expect(p.AdditionalParameters).To(Equal(params.AdditionalParameters))
+	})
+
+	Context("validating additional parameters", func() {
+		versions := []protocol.VersionNumber{protocol.Version1}
+
+		It("accepts valid parameters", func() {
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 0x42}, {ID: 0x1337}}, versions)).To(Succeed())
+		})
+
+		It("rejects parameters that collide with standard parameters", func() {
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 0x42}, {ID: 0x3}}, versions)).To(MatchError("transport parameter 0x3 collides with a standard transport parameter"))
+		})
+
+		It("rejects parameters that collide with the reset_stream_at parameter", func() {
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 0x17f7586d2cb571}}, versions)).To(MatchError("transport parameter 0x17f7586d2cb571 collides with the reset_stream_at transport parameter"))
+		})
+
+		It("rejects duplicate parameters", func() {
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 0x42}, {ID: 0x42}}, versions)).To(MatchError("duplicate transport parameter 0x42"))
+		})
+
+		It("rejects parameters reserved for greasing", func() {
+			Expect(isReservedTransportParameterID(27 + 31*42)).To(BeTrue())
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 27 + 31*42}}, versions)).To(MatchError("transport parameter 0x531 is reserved for greasing"))
+		})
+
+		It("rejects IDs that can't be encoded as a variable-length integer", func() {
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 1<<62 - 2}}, versions)).To(Succeed())
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 1 << 62}}, versions)).To(MatchError("transport parameter 0x4000000000000000 exceeds the maximum transport parameter ID (0x3fffffffffffffff)"))
+		})
+
+		It("rejects IDs larger than 16 bits, if versions other than QUIC version 1 are used", func() {
+			params := []TransportParameter{{ID: 0x10000}}
+			Expect(ValidateAdditionalTransportParameters(params, versions)).To(Succeed())
+			Expect(ValidateAdditionalTransportParameters(params, []protocol.VersionNumber{protocol.Version1, protocol.VersionTLS})).To(MatchError("transport parameter 0x10000 exceeds the maximum transport parameter ID (0xffff)"))
+		})
+
+		It("rejects values that are too long", func() {
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 0x42, Value: make([]byte, 0xffff)}}, versions)).To(Succeed())
+			Expect(ValidateAdditionalTransportParameters([]TransportParameter{{ID: 0x42, Value: make([]byte, 0x10000)}}, versions)).To(MatchError("value of transport parameter 0x42 too long: 65536 bytes"))
+		})
 	})
 
 	It("rejects duplicate parameters", func() {
@@ -137,7 +268,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(0x1337)))
 		utils.WriteVarInt(b, 0x1337)
 		p := &TransportParameters{}
-		err := p.unmarshal(b.Bytes(), protocol.PerspectiveServer)
+		err := p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("received duplicate transport parameter"))
 	})
@@ -148,7 +279,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, 7)
 		b.Write([]byte("foobar"))
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(MatchError("remaining length (6) smaller than parameter length (7)"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("remaining length (6) smaller than parameter length (7)"))
 	})
 
 	It("errors if there's unprocessed data after reading", func() {
@@ -158,7 +289,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.WriteVarInt(b, 0x1337)
 		b.Write([]byte("foo"))
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer)).To(MatchError("should have read all data. Still have 3 bytes"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("should have read all data. Still have 3 bytes"))
 	})
 
 	It("errors if the client sent a stateless_reset_token", func() {
@@ -166,9 +297,9 @@ var _ = Describe("Transport Parameters", func() {
 			StatelessResetToken: make([]byte, 16),
 		}
 		b := &bytes.Buffer{}
-		params.marshal(b)
+		params.marshal(b, protocol.VersionTLS)
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient)).To(MatchError("client sent a stateless_reset_token"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("client sent a stateless_reset_token"))
 	})
 
 	It("errors if the client sent a stateless_reset_token", func() {
@@ -176,8 +307,127 @@ var _ = Describe("Transport Parameters", func() {
 			OriginalConnectionID: protocol.ConnectionID{0xca, 0xfe},
 		}
 		b := &bytes.Buffer{}
-		params.marshal(b)
+		params.marshal(b, protocol.VersionTLS)
 		p := &TransportParameters{}
-		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient)).To(MatchError("client sent an original_connection_id"))
+		Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("client sent an original_connection_id"))
+	})
+
+	Context("in QUIC version 1", func() {
+		It("marshals und unmarshals", func() {
+			params := &TransportParameters{
+				InitialMaxStreamDataBidiLocal:  protocol.ByteCount(getRandomValue()),
+				InitialMaxStreamDataBidiRemote: protocol.ByteCount(getRandomValue()),
+				InitialMaxStreamDataUni:        protocol.ByteCount(getRandomValue()),
+				InitialMaxData:                 protocol.ByteCount(getRandomValue()),
+				IdleTimeout:                    0xcafe * time.Millisecond,
+				MaxBidiStreams:                 getRandomValue(),
+				MaxUniStreams:                  getRandomValue(),
+				DisableMigration:               true,
+				StatelessResetToken:            bytes.Repeat([]byte{100}, 16),
+				OriginalConnectionID:           protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+				InitialSourceConnectionID:      protocol.ConnectionID{0xca, 0xfe},
+				RetrySourceConnectionID:        protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+				ResetStreamAt:                  true,
+			}
+			b := &bytes.Buffer{}
+			params.marshal(b, protocol.Version1)
+
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.Version1)).To(Succeed())
+			Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(params.InitialMaxStreamDataBidiLocal))
+			Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(params.InitialMaxStreamDataBidiRemote))
+			Expect(p.InitialMaxStreamDataUni).To(Equal(params.InitialMaxStreamDataUni))
+			Expect(p.InitialMaxData).To(Equal(params.InitialMaxData))
+			Expect(p.MaxUniStreams).To(Equal(params.MaxUniStreams))
+			Expect(p.MaxBidiStreams).To(Equal(params.MaxBidiStreams))
+			Expect(p.IdleTimeout).To(Equal(params.IdleTimeout))
+			Expect(p.DisableMigration).To(Equal(params.DisableMigration))
+			Expect(p.StatelessResetToken).To(Equal(params.StatelessResetToken))
+			Expect(p.OriginalConnectionID).To(Equal(params.OriginalConnectionID))
+			Expect(p.InitialSourceConnectionID).To(Equal(params.InitialSourceConnectionID))
+			Expect(p.RetrySourceConnectionID).To(Equal(params.RetrySourceConnectionID))
+			Expect(p.ResetStreamAt).To(BeTrue())
+		})
+
+		It("errors when reset_stream_at has content", func() {
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, uint64(resetStreamAtParameterID))
+			utils.WriteVarInt(b, 6)
+			b.Write([]byte("foobar"))
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(MatchError("wrong length for reset_stream_at: 6 (expected empty)"))
+		})
+
+		It("doesn't send reset_stream_at unless enabled", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{}).marshal(b, protocol.Version1)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			Expect(p.ResetStreamAt).To(BeFalse())
+		})
+
+		It("uses variable-length integers for the parameter ID and length", func() {
+			params := &TransportParameters{OriginalConnectionID: protocol.ConnectionID{1, 2, 3, 4}}
+			b := &bytes.Buffer{}
+			params.marshal(b, protocol.Version1)
+			Expect(b.Bytes()).To(ContainSubstring(string([]byte{0x0, 0x4, 1, 2, 3, 4})))
+		})
+
+		It("sends an empty initial_source_connection_id", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{}).marshal(b, protocol.Version1)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			Expect(p.InitialSourceConnectionID).ToNot(BeNil())
+			Expect(p.InitialSourceConnectionID).To(BeEmpty())
+		})
+
+		It("skips unknown parameters", func() {
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, 31*1337+27) // a reserved transport parameter
+			utils.WriteVarInt(b, 6)
+			b.Write([]byte("foobar"))
+			(&TransportParameters{MaxUniStreams: 1337}).marshal(b, protocol.Version1)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			Expect(p.MaxUniStreams).To(BeEquivalentTo(1337))
+			Expect(p.AdditionalParameters).To(BeEmpty())
+		})
+
+		It("doesn't treat standard parameters that are not implemented as additional parameters", func() {
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, 0xa) // ack_delay_exponent
+			utils.WriteVarInt(b, 1)
+			b.WriteByte(3)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			Expect(p.AdditionalParameters).To(BeEmpty())
+		})
+
+		It("marshals and unmarshals additional parameters", func() {
+			params := &TransportParameters{
+				AdditionalParameters: []TransportParameter{{ID: 0x4242, Value: []byte("foobar")}},
+			}
+			b := &bytes.Buffer{}
+			params.marshal(b, protocol.Version1)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			Expect(p.AdditionalParameters).To(Equal(params.AdditionalParameters))
+		})
+
+		It("errors if the client sent a retry_source_connection_id", func() {
+			b := &bytes.Buffer{}
+			(&TransportParameters{RetrySourceConnectionID: protocol.ConnectionID{1, 2, 3, 4}}).marshal(b, protocol.Version1)
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(MatchError("client sent a retry_source_connection_id"))
+		})
+
+		It("errors on EOF while reading the parameter header", func() {
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, 0x1337)
+			b.WriteByte(0x40) // the first byte of a 2 byte varint
+			p := &TransportParameters{}
+			Expect(p.unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.Version1)).To(MatchError(ContainSubstring("error while reading transport parameter header")))
+		})
 	})
 })
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sort"
 	"time"
 
@@ -12,7 +13,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
-type transportParameterID uint16
+type transportParameterID uint64
 
 const (
 	originalConnectionIDParameterID           transportParameterID = 0x0
@@ -26,8 +27,85 @@ const (
 	initialMaxStreamsBidiParameterID          transportParameterID = 0x8
 	initialMaxStreamsUniParameterID           transportParameterID = 0x9
 	disableMigrationParameterID               transportParameterID = 0xc
+	preferredAddressParameterID               transportParameterID = 0xd
+	// only used by QUIC version 1
+	initialSourceConnectionIDParameterID transportParameterID = 0xf
+	retrySourceConnectionIDParameterID   transportParameterID = 0x10
+	// the reliable stream reset extension, only used by QUIC version 1
+	resetStreamAtParameterID transportParameterID = 0x17f7586d2cb571
 )
 
+// isStandardTransportParameterID says if a transport parameter ID is defined by the QUIC specification.
+// This includes parameters that we don't implement.
+func isStandardTransportParameterID(id uint64) bool {
+	return id <= 0x11
+}
+
+// isReservedTransportParameterID says if a transport parameter ID is reserved for greasing,
+// see section 18.1 of RFC 9000.
+func isReservedTransportParameterID(id uint64) bool {
+	return id >= 27 && (id-27)%31 == 0
+}
+
+// A TransportParameter is a transport parameter that is not defined by the QUIC specification.
+type TransportParameter struct {
+	ID    uint64
+	Value []byte
+}
+
+// maxTransportParameterID is the largest transport parameter ID that can be encoded in QUIC version 1.
+const maxTransportParameterID = 1<<62 - 1
+
+// ValidateAdditionalTransportParameters checks that additional transport parameters can be sent
+// in all of the given versions.
+// IDs must not collide with the standard transport parameters, must not be reserved for greasing,
+// and must not be used more than once.
+// Versions other than QUIC version 1 encode the ID as a 16 bit integer.
+func ValidateAdditionalTransportParameters(params []TransportParameter, versions []protocol.VersionNumber) error {
+	maxID := uint64(maxTransportParameterID)
+	for _, v := range versions {
+		if v != protocol.Version1 {
+			maxID = 0xffff
+		}
+	}
+	ids := make(map[uint64]struct{}, len(params))
+	for _, p := range params {
+		if p.ID > maxID {
+			return fmt.Errorf("transport parameter %#x exceeds the maximum transport parameter ID (%#x)", p.ID, maxID)
+		}
+		// The value is sent in a TLS extension, which is limited to 2^16-1 bytes.
+		if len(p.Value) > 0xffff {
+			return fmt.Errorf("value of transport parameter %#x too long: %d bytes", p.ID, len(p.Value))
+		}
+		if isStandardTransportParameterID(p.ID) {
+			return fmt.Errorf("transport parameter %#x collides with a standard transport parameter", p.ID)
+		}
+		if p.ID == uint64(resetStreamAtParameterID) {
+			return fmt.Errorf("transport parameter %#x collides with the reset_stream_at transport parameter", p.ID)
+		}
+		// The peer ignores reserved transport parameters.
+		if isReservedTransportParameterID(p.ID) {
+			return fmt.Errorf("transport parameter %#x is reserved for greasing", p.ID)
+		}
+		if _, ok := ids[p.ID]; ok {
+			return fmt.Errorf("duplicate transport parameter %#x", p.ID)
+		}
+		ids[p.ID] = struct{}{}
+	}
+	return nil
+}
+
+// A PreferredAddress is an address that the server wants the client to migrate to after the handshake.
+// It is sent in the preferred_address transport parameter.
+type PreferredAddress struct {
+	IPv4                net.IP
+	IPv4Port            uint16
+	IPv6                net.IP
+	IPv6Port            uint16
+	ConnectionID        protocol.ConnectionID
+	StatelessResetToken [16]byte
+}
+
 // TransportParameters are parameters sent to the peer during the handshake
 type TransportParameters struct {
 	InitialMaxStreamDataBidiLocal  protocol.ByteCount
@@ -43,19 +121,103 @@ type TransportParameters struct {
 	IdleTimeout      time.Duration
 	DisableMigration bool
 
+	// only used by QUIC version 1
+	ResetStreamAt bool // the reliable stream reset extension
+
 	StatelessResetToken  []byte
 	OriginalConnectionID protocol.ConnectionID
+
+	PreferredAddress *PreferredAddress
+
+	// only used by QUIC version 1
+	InitialSourceConnectionID protocol.ConnectionID
+	RetrySourceConnectionID   protocol.ConnectionID
+
+	// transport parameters that are not defined by the QUIC specification
+	AdditionalParameters []TransportParameter
+}
+
+// PeerTransportParameters are the transport parameters sent by the peer.
+// They are a copy: modifying them doesn't have any effect on the connection.
+type PeerTransportParameters struct {
+	InitialMaxData                 uint64
+	InitialMaxStreamDataBidiLocal  uint64
+	InitialMaxStreamDataBidiRemote uint64
+	InitialMaxStreamDataUni        uint64
+	MaxBidiStreams                 uint64
+	MaxUniStreams                  uint64
+	IdleTimeout                    time.Duration
+	DisableMigration               bool
+	ReliableStreamReset            bool
+	// Additional are the transport parameters that are not defined by the QUIC specification.
+	Additional []TransportParameter
+}
+
+func (p *TransportParameters) peerTransportParameters() *PeerTransportParameters {
+	var additional []TransportParameter
+	if len(p.AdditionalParameters) > 0 {
+		additional = make([]TransportParameter, len(p.AdditionalParameters))
+		for i, param := range p.AdditionalParameters {
+			additional[i] = TransportParameter{ID: param.ID, Value: append([]byte{}, param.Value...)}
+		}
+	}
+	return &PeerTransportParameters{
+		InitialMaxData:                 uint64(p.InitialMaxData),
+		InitialMaxStreamDataBidiLocal:  uint64(p.InitialMaxStreamDataBidiLocal),
+		InitialMaxStreamDataBidiRemote: uint64(p.InitialMaxStreamDataBidiRemote),
+		InitialMaxStreamDataUni:        uint64(p.InitialMaxStreamDataUni),
+		MaxBidiStreams:                 p.MaxBidiStreams,
+		MaxUniStreams:                  p.MaxUniStreams,
+		IdleTimeout:                    p.IdleTimeout,
+		DisableMigration:               p.DisableMigration,
+		ReliableStreamReset:            p.ResetStreamAt,
+		Additional:                     additional,
+	}
 }
 
-func (p *TransportParameters) unmarshal(data []byte, sentBy protocol.Perspective) error {
+// QUIC version 1 encodes the transport parameter ID and length as variable-length integers.
+// Earlier versions used 2 bytes each.
+func readTransportParameterHeader(r *bytes.Reader, v protocol.VersionNumber) (transportParameterID, uint64, error) {
+	if v == protocol.Version1 {
+		id, err := utils.ReadVarInt(r)
+		if err != nil {
+			return 0, 0, err
+		}
+		l, err := utils.ReadVarInt(r)
+		return transportParameterID(id), l, err
+	}
+	id, err := utils.BigEndian.ReadUint16(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := utils.BigEndian.ReadUint16(r)
+	return transportParameterID(id), uint64(l), err
+}
+
+func writeTransportParameterHeader(b *bytes.Buffer, id transportParameterID, l int, v protocol.VersionNumber) {
+	if v == protocol.Version1 {
+		utils.WriteVarInt(b, uint64(id))
+		utils.WriteVarInt(b, uint64(l))
+		return
+	}
+	utils.BigEndian.WriteUint16(b, uint16(id))
+	utils.BigEndian.WriteUint16(b, uint16(l))
+}
+
+func (p *TransportParameters) unmarshal(data []byte, sentBy protocol.Perspective, v protocol.VersionNumber) error {
 	// needed to check that every parameter is only sent at most once
 	var parameterIDs []transportParameterID
 
+	minHeaderLen := 4
+	if v == protocol.Version1 {
+		minHeaderLen = 2
+	}
 	r := bytes.NewReader(data)
-	for r.Len() >= 4 {
-		paramIDInt, _ := utils.BigEndian.ReadUint16(r)
-		paramID := transportParameterID(paramIDInt)
-		paramLen, _ := utils.BigEndian.ReadUint16(r)
+	for r.Len() >= minHeaderLen {
+		paramID, paramLen, err := readTransportParameterHeader(r, v)
+		if err != nil {
+			return fmt.Errorf("error while reading transport parameter header: %s", err)
+		}
 		parameterIDs = append(parameterIDs, paramID)
 		switch paramID {
 		case initialMaxStreamDataBidiLocalParameterID,
@@ -66,11 +228,11 @@ func (p *TransportParameters) unmarshal(data []byte, sentBy protocol.Perspective
 			initialMaxStreamsUniParameterID,
 			idleTimeoutParameterID,
 			maxPacketSizeParameterID:
-			if err := p.readNumericTransportParameter(r, paramID, int(paramLen)); err != nil {
+			if err := p.readNumericTransportParameter(r, paramID, int(paramLen), v); err != nil {
 				return err
 			}
 		default:
-			if r.Len() < int(paramLen) {
+			if uint64(r.Len()) < paramLen {
 				return fmt.Errorf("remaining length (%d) smaller than parameter length (%d)", r.Len(), paramLen)
 			}
 			switch paramID {
@@ -94,8 +256,38 @@ func (p *TransportParameters) unmarshal(data []byte, sentBy protocol.Perspective
 					return errors.New("client sent an original_connection_id")
 				}
 				p.OriginalConnectionID, _ = protocol.ReadConnectionID(r, int(paramLen))
+			case preferredAddressParameterID:
+				if sentBy == protocol.PerspectiveClient {
+					return errors.New("client sent a preferred_address")
+				}
+				if err := p.readPreferredAddress(r, int(paramLen)); err != nil {
+					return err
+				}
+			case initialSourceConnectionIDParameterID:
+				if v != protocol.Version1 {
+					p.readUnknownTransportParameter(r, paramID, int(paramLen))
+					break
+				}
+				p.InitialSourceConnectionID, _ = protocol.ReadConnectionID(r, int(paramLen))
+				if p.InitialSourceConnectionID == nil {
+					p.InitialSourceConnectionID = protocol.ConnectionID{}
+				}
+			case retrySourceConnectionIDParameterID:
+				if v != protocol.Version1 {
+					p.readUnknownTransportParameter(r, paramID, int(paramLen))
+					break
+				}
+				if sentBy == protocol.PerspectiveClient {
+					return errors.New("client sent a retry_source_connection_id")
+				}
+				p.RetrySourceConnectionID, _ = protocol.ReadConnectionID(r, int(paramLen))
+			case resetStreamAtParameterID:
+				if paramLen != 0 {
+					return fmt.Errorf("wrong length for reset_stream_at: %d (expected empty)", paramLen)
+				}
+				p.ResetStreamAt = true
 			default:
-				r.Seek(int64(paramLen), io.SeekCurrent)
+				p.readUnknownTransportParameter(r, paramID, int(paramLen))
 			}
 		}
 	}
@@ -114,10 +306,69 @@ func (p *TransportParameters) unmarshal(data []byte, sentBy protocol.Perspective
 	return nil
 }
 
+func (p *TransportParameters) readPreferredAddress(r *bytes.Reader, paramLen int) error {
+	remainingLen := r.Len()
+	pa := &PreferredAddress{}
+	ipv4 := make([]byte, 4)
+	if _, err := io.ReadFull(r, ipv4); err != nil {
+		return err
+	}
+	pa.IPv4 = net.IP(ipv4)
+	port, err := utils.BigEndian.ReadUint16(r)
+	if err != nil {
+		return err
+	}
+	pa.IPv4Port = port
+	ipv6 := make([]byte, 16)
+	if _, err := io.ReadFull(r, ipv6); err != nil {
+		return err
+	}
+	pa.IPv6 = net.IP(ipv6)
+	port, err = utils.BigEndian.ReadUint16(r)
+	if err != nil {
+		return err
+	}
+	pa.IPv6Port = port
+	connIDLen, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if connIDLen == 0 || connIDLen > protocol.MaxConnIDLen {
+		return fmt.Errorf("invalid connection ID length in preferred_address: %d", connIDLen)
+	}
+	connID, err := protocol.ReadConnectionID(r, int(connIDLen))
+	if err != nil {
+		return err
+	}
+	pa.ConnectionID = connID
+	if _, err := io.ReadFull(r, pa.StatelessResetToken[:]); err != nil {
+		return err
+	}
+	if bytesRead := remainingLen - r.Len(); bytesRead != paramLen {
+		return fmt.Errorf("wrong length for preferred_address: %d (expected %d)", paramLen, bytesRead)
+	}
+	p.PreferredAddress = pa
+	return nil
+}
+
+// readUnknownTransportParameter reads a transport parameter that we don't implement.
+// Standard and reserved transport parameters are skipped.
+func (p *TransportParameters) readUnknownTransportParameter(r *bytes.Reader, paramID transportParameterID, paramLen int) {
+	id := uint64(paramID)
+	if isStandardTransportParameterID(id) || isReservedTransportParameterID(id) {
+		r.Seek(int64(paramLen), io.SeekCurrent)
+		return
+	}
+	val := make([]byte, paramLen)
+	r.Read(val)
+	p.AdditionalParameters = append(p.AdditionalParameters, TransportParameter{ID: id, Value: val})
+}
+
 func (p *TransportParameters) readNumericTransportParameter(
 	r *bytes.Reader,
 	paramID transportParameterID,
 	expectedLen int,
+	v protocol.VersionNumber,
 ) error {
 	remainingLen := r.Len()
 	val, err := utils.ReadVarInt(r)
@@ -141,7 +392,12 @@ func (p *TransportParameters) readNumericTransportParameter(
 	case initialMaxStreamsUniParameterID:
 		p.MaxUniStreams = val
 	case idleTimeoutParameterID:
-		p.IdleTimeout = utils.MaxDuration(protocol.MinRemoteIdleTimeout, time.Duration(val)*time.Second)
+		// QUIC version 1 uses milliseconds for the max_idle_timeout
+		unit := time.Second
+		if v == protocol.Version1 {
+			unit = time.Millisecond
+		}
+		p.IdleTimeout = utils.MaxDuration(protocol.MinRemoteIdleTimeout, time.Duration(val)*unit)
 	case maxPacketSizeParameterID:
 		if val < 1200 {
 			return fmt.Errorf("invalid value for max_packet_size: %d (minimum 1200)", val)
@@ -153,55 +409,82 @@ func (p *TransportParameters) readNumericTransportParameter(
 	return nil
 }
 
-func (p *TransportParameters) marshal(b *bytes.Buffer) {
+func (p *TransportParameters) marshal(b *bytes.Buffer, v protocol.VersionNumber) {
 	// initial_max_stream_data_bidi_local
-	utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamDataBidiLocalParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.InitialMaxStreamDataBidiLocal))))
-	utils.WriteVarInt(b, uint64(p.InitialMaxStreamDataBidiLocal))
+	p.marshalVarintParam(b, initialMaxStreamDataBidiLocalParameterID, uint64(p.InitialMaxStreamDataBidiLocal), v)
 	// initial_max_stream_data_bidi_remote
-	utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamDataBidiRemoteParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.InitialMaxStreamDataBidiRemote))))
-	utils.WriteVarInt(b, uint64(p.InitialMaxStreamDataBidiRemote))
+	p.marshalVarintParam(b, initialMaxStreamDataBidiRemoteParameterID, uint64(p.InitialMaxStreamDataBidiRemote), v)
 	// initial_max_stream_data_uni
-	utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamDataUniParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.InitialMaxStreamDataUni))))
-	utils.WriteVarInt(b, uint64(p.InitialMaxStreamDataUni))
+	p.marshalVarintParam(b, initialMaxStreamDataUniParameterID, uint64(p.InitialMaxStreamDataUni), v)
 	// initial_max_data
-	utils.BigEndian.WriteUint16(b, uint16(initialMaxDataParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.InitialMaxData))))
-	utils.WriteVarInt(b, uint64(p.InitialMaxData))
+	p.marshalVarintParam(b, initialMaxDataParameterID, uint64(p.InitialMaxData), v)
 	// initial_max_bidi_streams
-	utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamsBidiParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(p.MaxBidiStreams)))
-	utils.WriteVarInt(b, p.MaxBidiStreams)
+	p.marshalVarintParam(b, initialMaxStreamsBidiParameterID, p.MaxBidiStreams, v)
 	// initial_max_uni_streams
-	utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamsUniParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(p.MaxUniStreams)))
-	utils.WriteVarInt(b, p.MaxUniStreams)
+	p.marshalVarintParam(b, initialMaxStreamsUniParameterID, p.MaxUniStreams, v)
 	// idle_timeout
-	utils.BigEndian.WriteUint16(b, uint16(idleTimeoutParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.IdleTimeout/time.Second))))
-	utils.WriteVarInt(b, uint64(p.IdleTimeout/time.Second))
+	if v == protocol.Version1 {
+		p.marshalVarintParam(b, idleTimeoutParameterID, uint64(p.IdleTimeout/time.Millisecond), v)
+	} else {
+		p.marshalVarintParam(b, idleTimeoutParameterID, uint64(p.IdleTimeout/time.Second), v)
+	}
 	// max_packet_size
-	utils.BigEndian.WriteUint16(b, uint16(maxPacketSizeParameterID))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(protocol.MaxReceivePacketSize))))
-	utils.WriteVarInt(b, uint64(protocol.MaxReceivePacketSize))
+	p.marshalVarintParam(b, maxPacketSizeParameterID, uint64(protocol.MaxReceivePacketSize), v)
 	// disable_migration
 	if p.DisableMigration {
-		utils.BigEndian.WriteUint16(b, uint16(disableMigrationParameterID))
-		utils.BigEndian.WriteUint16(b, 0)
+		writeTransportParameterHeader(b, disableMigrationParameterID, 0, v)
 	}
 	if len(p.StatelessResetToken) > 0 {
-		utils.BigEndian.WriteUint16(b, uint16(statelessResetTokenParameterID))
-		utils.BigEndian.WriteUint16(b, uint16(len(p.StatelessResetToken))) // should always be 16 bytes
+		writeTransportParameterHeader(b, statelessResetTokenParameterID, len(p.StatelessResetToken), v) // should always be 16 bytes
 		b.Write(p.StatelessResetToken)
 	}
 	// original_connection_id
 	if p.OriginalConnectionID.Len() > 0 {
-		utils.BigEndian.WriteUint16(b, uint16(originalConnectionIDParameterID))
-		utils.BigEndian.WriteUint16(b, uint16(p.OriginalConnectionID.Len()))
+		writeTransportParameterHeader(b, originalConnectionIDParameterID, p.OriginalConnectionID.Len(), v)
 		b.Write(p.OriginalConnectionID.Bytes())
 	}
+	// preferred_address
+	if pa := p.PreferredAddress; pa != nil {
+		writeTransportParameterHeader(b, preferredAddressParameterID, 4+2+16+2+1+pa.ConnectionID.Len()+16, v)
+		ipv4 := pa.IPv4.To4()
+		if ipv4 == nil {
+			ipv4 = net.IPv4zero.To4()
+		}
+		b.Write(ipv4)
+		utils.BigEndian.WriteUint16(b, pa.IPv4Port)
+		ipv6 := pa.IPv6.To16()
+		if ipv6 == nil {
+			ipv6 = net.IPv6zero
+		}
+		b.Write(ipv6)
+		utils.BigEndian.WriteUint16(b, pa.IPv6Port)
+		b.WriteByte(uint8(pa.ConnectionID.Len()))
+		b.Write(pa.ConnectionID.Bytes())
+		b.Write(pa.StatelessResetToken[:])
+	}
+	if v == protocol.Version1 {
+		// initial_source_connection_id, this parameter is always sent, even if the connection ID is empty
+		writeTransportParameterHeader(b, initialSourceConnectionIDParameterID, p.InitialSourceConnectionID.Len(), v)
+		b.Write(p.InitialSourceConnectionID.Bytes())
+		// retry_source_connection_id
+		if p.RetrySourceConnectionID.Len() > 0 {
+			writeTransportParameterHeader(b, retrySourceConnectionIDParameterID, p.RetrySourceConnectionID.Len(), v)
+			b.Write(p.RetrySourceConnectionID.Bytes())
+		}
+		// reset_stream_at
+		if p.ResetStreamAt {
+			writeTransportParameterHeader(b, resetStreamAtParameterID, 0, v)
+		}
+	}
+	for _, param := range p.AdditionalParameters {
+		writeTransportParameterHeader(b, transportParameterID(param.ID), len(param.Value), v)
+		b.Write(param.Value)
+	}
+}
+
+func (p *TransportParameters) marshalVarintParam(b *bytes.Buffer, id transportParameterID, val uint64, v protocol.VersionNumber) {
+	writeTransportParameterHeader(b, id, int(utils.VarIntLen(val)), v)
+	utils.WriteVarInt(b, val)
 }
 
 // String returns a string representation, intended for logging.
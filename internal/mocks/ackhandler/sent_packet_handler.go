@@ -86,6 +86,18 @@ func (mr *MockSentPacketHandlerMockRecorder) GetLowestPacketNotConfirmedAcked()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLowestPacketNotConfirmedAcked", reflect.TypeOf((*MockSentPacketHandler)(nil).GetLowestPacketNotConfirmedAcked))
 }
 
+// GetLowestRetransmittable mocks base method
+func (m *MockSentPacketHandler) GetLowestRetransmittable() protocol.PacketNumber {
+	ret := m.ctrl.Call(m, "GetLowestRetransmittable")
+	ret0, _ := ret[0].(protocol.PacketNumber)
+	return ret0
+}
+
+// GetLowestRetransmittable indicates an expected call of GetLowestRetransmittable
+func (mr *MockSentPacketHandlerMockRecorder) GetLowestRetransmittable() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLowestRetransmittable", reflect.TypeOf((*MockSentPacketHandler)(nil).GetLowestRetransmittable))
+}
+
 // OnAlarm mocks base method
 func (m *MockSentPacketHandler) OnAlarm() error {
 	ret := m.ctrl.Call(m, "OnAlarm")
@@ -54,6 +54,16 @@ func (mr *MockConnectionFlowControllerMockRecorder) AddBytesSent(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBytesSent", reflect.TypeOf((*MockConnectionFlowController)(nil).AddBytesSent), arg0)
 }
 
+// Close mocks base method
+func (m *MockConnectionFlowController) Close() {
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close
+func (mr *MockConnectionFlowControllerMockRecorder) Close() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConnectionFlowController)(nil).Close))
+}
+
 // GetWindowUpdate mocks base method
 func (m *MockConnectionFlowController) GetWindowUpdate() protocol.ByteCount {
 	ret := m.ctrl.Call(m, "GetWindowUpdate")
@@ -66,6 +76,16 @@ func (mr *MockConnectionFlowControllerMockRecorder) GetWindowUpdate() *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWindowUpdate", reflect.TypeOf((*MockConnectionFlowController)(nil).GetWindowUpdate))
 }
 
+// HandlePeerBlocked mocks base method
+func (m *MockConnectionFlowController) HandlePeerBlocked(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "HandlePeerBlocked", arg0)
+}
+
+// HandlePeerBlocked indicates an expected call of HandlePeerBlocked
+func (mr *MockConnectionFlowControllerMockRecorder) HandlePeerBlocked(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandlePeerBlocked", reflect.TypeOf((*MockConnectionFlowController)(nil).HandlePeerBlocked), arg0)
+}
+
 // IsNewlyBlocked mocks base method
 func (m *MockConnectionFlowController) IsNewlyBlocked() (bool, protocol.ByteCount) {
 	ret := m.ctrl.Call(m, "IsNewlyBlocked")
@@ -34,6 +34,26 @@ func (m *MockAEAD) EXPECT() *MockAEADMockRecorder {
 	return m.recorder
 }
 
+// DecryptHeader mocks base method
+func (m *MockAEAD) DecryptHeader(arg0 []byte, arg1 *byte, arg2 []byte) {
+	m.ctrl.Call(m, "DecryptHeader", arg0, arg1, arg2)
+}
+
+// DecryptHeader indicates an expected call of DecryptHeader
+func (mr *MockAEADMockRecorder) DecryptHeader(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecryptHeader", reflect.TypeOf((*MockAEAD)(nil).DecryptHeader), arg0, arg1, arg2)
+}
+
+// EncryptHeader mocks base method
+func (m *MockAEAD) EncryptHeader(arg0 []byte, arg1 *byte, arg2 []byte) {
+	m.ctrl.Call(m, "EncryptHeader", arg0, arg1, arg2)
+}
+
+// EncryptHeader indicates an expected call of EncryptHeader
+func (mr *MockAEADMockRecorder) EncryptHeader(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EncryptHeader", reflect.TypeOf((*MockAEAD)(nil).EncryptHeader), arg0, arg1, arg2)
+}
+
 // Open mocks base method
 func (m *MockAEAD) Open(arg0, arg1 []byte, arg2 protocol.PacketNumber, arg3 []byte) ([]byte, error) {
 	ret := m.ctrl.Call(m, "Open", arg0, arg1, arg2, arg3)
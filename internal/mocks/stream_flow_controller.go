@@ -66,6 +66,16 @@ func (mr *MockStreamFlowControllerMockRecorder) GetWindowUpdate() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWindowUpdate", reflect.TypeOf((*MockStreamFlowController)(nil).GetWindowUpdate))
 }
 
+// HandlePeerBlocked mocks base method
+func (m *MockStreamFlowController) HandlePeerBlocked(arg0 protocol.ByteCount) {
+	m.ctrl.Call(m, "HandlePeerBlocked", arg0)
+}
+
+// HandlePeerBlocked indicates an expected call of HandlePeerBlocked
+func (mr *MockStreamFlowControllerMockRecorder) HandlePeerBlocked(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandlePeerBlocked", reflect.TypeOf((*MockStreamFlowController)(nil).HandlePeerBlocked), arg0)
+}
+
 // IsNewlyBlocked mocks base method
 func (m *MockStreamFlowController) IsNewlyBlocked() (bool, protocol.ByteCount) {
 	ret := m.ctrl.Call(m, "IsNewlyBlocked")
@@ -8,13 +8,17 @@ func InferPacketNumber(
 	version VersionNumber,
 ) PacketNumber {
 	var epochDelta PacketNumber
-	switch packetNumberLength {
-	case PacketNumberLen1:
-		epochDelta = PacketNumber(1) << 7
-	case PacketNumberLen2:
-		epochDelta = PacketNumber(1) << 14
-	case PacketNumberLen4:
-		epochDelta = PacketNumber(1) << 30
+	if version.UsesHeaderProtection() {
+		epochDelta = PacketNumber(1) << (uint8(packetNumberLength) * 8)
+	} else {
+		switch packetNumberLength {
+		case PacketNumberLen1:
+			epochDelta = PacketNumber(1) << 7
+		case PacketNumberLen2:
+			epochDelta = PacketNumber(1) << 14
+		case PacketNumberLen4:
+			epochDelta = PacketNumber(1) << 30
+		}
 	}
 	epoch := lastPacketNumber & ^(epochDelta - 1)
 	prevEpochBegin := epoch - epochDelta
@@ -44,6 +48,15 @@ func delta(a, b PacketNumber) PacketNumber {
 // it never chooses a PacketNumberLen of 1 byte, since this is too short under certain circumstances
 func GetPacketNumberLengthForHeader(packetNumber, leastUnacked PacketNumber, version VersionNumber) PacketNumberLen {
 	diff := uint64(packetNumber - leastUnacked)
+	if version.UsesHeaderProtection() {
+		if diff < (1 << (16 - 1)) {
+			return PacketNumberLen2
+		}
+		if diff < (1 << (24 - 1)) {
+			return PacketNumberLen3
+		}
+		return PacketNumberLen4
+	}
 	if diff < (1 << (14 - 1)) {
 		return PacketNumberLen2
 	}
@@ -12,6 +12,9 @@ import (
 var _ = Describe("packet number calculation", func() {
 	Context("infering a packet number", func() {
 		getEpoch := func(len PacketNumberLen, v VersionNumber) uint64 {
+			if v.UsesHeaderProtection() {
+				return uint64(1) << (len * 8)
+			}
 			switch len {
 			case PacketNumberLen1:
 				return uint64(1) << 7
@@ -216,6 +219,31 @@ var _ = Describe("packet number calculation", func() {
 		}
 	})
 
+	Context("in QUIC version 1", func() {
+		It("infers packet numbers", func() {
+			Expect(InferPacketNumber(PacketNumberLen1, 0xaa82f30e, 0x3f, Version1)).To(Equal(PacketNumber(0xaa82f33f)))
+			Expect(InferPacketNumber(PacketNumberLen2, 0xa82f30ea, 0x9b32, Version1)).To(Equal(PacketNumber(0xa82f9b32)))
+			Expect(InferPacketNumber(PacketNumberLen3, 0xabcdef, 0xabcdf0, Version1)).To(Equal(PacketNumber(0xabcdf0)))
+			Expect(InferPacketNumber(PacketNumberLen4, 0x100000000, 0x2, Version1)).To(Equal(PacketNumber(0x100000002)))
+		})
+
+		It("chooses the packet number length", func() {
+			Expect(GetPacketNumberLengthForHeader(4, 2, Version1)).To(Equal(PacketNumberLen2))
+			Expect(GetPacketNumberLengthForHeader(0x10000, 2, Version1)).To(Equal(PacketNumberLen3))
+			Expect(GetPacketNumberLengthForHeader(0x1000000, 2, Version1)).To(Equal(PacketNumberLen4))
+		})
+
+		It("is self-consistent", func() {
+			for i := uint64(1); i < 1<<26; i += 997 {
+				packetNumber := PacketNumber(i)
+				leastUnacked := PacketNumber(i / 2)
+				length := GetPacketNumberLengthForHeader(packetNumber, leastUnacked, Version1)
+				wirePacketNumber := uint64(packetNumber) & ((uint64(1) << (length * 8)) - 1)
+				Expect(InferPacketNumber(length, leastUnacked, PacketNumber(wirePacketNumber), Version1)).To(Equal(packetNumber))
+			}
+		})
+	})
+
 	Context("determining the minimum length of a packet number", func() {
 		It("1 byte", func() {
 			Expect(GetPacketNumberLength(0xFF)).To(Equal(PacketNumberLen1))
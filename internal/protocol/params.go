@@ -37,12 +37,19 @@ const InitialMaxStreamData = (1 << 10) * 512 // 512 kb
 // InitialMaxData is the connection-level flow control window for receiving data
 const InitialMaxData = ConnectionFlowControlMultiplier * InitialMaxStreamData
 
+// MinInitialMaxData is the smallest connection-level flow control window granted to a new connection.
+// If the memory budget doesn't cover this window, the connection is refused.
+const MinInitialMaxData = 16 * (1 << 10) // 16 kB
+
 // DefaultMaxReceiveStreamFlowControlWindow is the default maximum stream-level flow control window for receiving data, for the server
 const DefaultMaxReceiveStreamFlowControlWindow = 6 * (1 << 20) // 6 MB
 
 // DefaultMaxReceiveConnectionFlowControlWindow is the default connection-level flow control window for receiving data, for the server
 const DefaultMaxReceiveConnectionFlowControlWindow = 15 * (1 << 20) // 12 MB
 
+// DefaultStreamSendBufferSize is the default size of the send buffer of a stream
+const DefaultStreamSendBufferSize = 64 * (1 << 10) // 64 kB
+
 // WindowUpdateThreshold is the fraction of the receive window that has to be consumed before an higher offset is advertised to the client
 const WindowUpdateThreshold = 0.25
 
@@ -121,3 +128,14 @@ const MinPacingDelay time.Duration = 100 * time.Microsecond
 // DefaultConnectionIDLength is the connection ID length that is used for multiplexed connections
 // if no other value is configured.
 const DefaultConnectionIDLength = 4
+
+// MaxPathChallenges is the maximum number of PATH_CHALLENGE frames sent when validating a new path.
+// If none of them is answered, path validation fails.
+const MaxPathChallenges = 3
+
+// MaxActiveConnectionIDs is the number of connection IDs that an endpoint makes available to its peer.
+// This is the default value of the active_connection_id_limit transport parameter, which is not sent.
+const MaxActiveConnectionIDs = 2
+
+// MaxAmplificationFactor is the maximum ratio between the data sent to and received from an address that was not validated.
+const MaxAmplificationFactor = 3
@@ -17,6 +17,8 @@ const (
 	PacketNumberLen1 PacketNumberLen = 1
 	// PacketNumberLen2 is a packet number length of 2 bytes
 	PacketNumberLen2 PacketNumberLen = 2
+	// PacketNumberLen3 is a packet number length of 3 bytes
+	PacketNumberLen3 PacketNumberLen = 3
 	// PacketNumberLen4 is a packet number length of 4 bytes
 	PacketNumberLen4 PacketNumberLen = 4
 )
@@ -57,7 +59,7 @@ type ByteCount uint64
 const MaxByteCount = ByteCount(1<<62 - 1)
 
 // An ApplicationErrorCode is an application-defined error code.
-type ApplicationErrorCode uint16
+type ApplicationErrorCode uint64
 
 // MaxReceivePacketSize maximum packet size of any QUIC packet, based on
 // ethernet's max size, minus the IP and UDP headers. IPv6 has a 40 byte header,
@@ -80,3 +82,6 @@ const MaxClientHellos = 3
 
 // MinConnectionIDLenInitial is the minimum length of the destination connection ID on an Initial packet.
 const MinConnectionIDLenInitial = 8
+
+// MaxConnIDLen is the maximum length of a connection ID in QUIC version 1.
+const MaxConnIDLen = 20
@@ -19,17 +19,24 @@ const (
 // The version numbers, making grepping easier
 const (
 	VersionTLS      VersionNumber = 101
-	VersionWhatever VersionNumber = 1 // for when the version doesn't matter
+	Version1        VersionNumber = 0x1
+	VersionWhatever VersionNumber = math.MaxUint32 - 1 // for when the version doesn't matter
 	VersionUnknown  VersionNumber = math.MaxUint32
 )
 
 // SupportedVersions lists the versions that the server supports
-// must be in sorted descending order
-var SupportedVersions = []VersionNumber{VersionTLS}
+// must be in sorted in descending order of preference
+var SupportedVersions = []VersionNumber{Version1, VersionTLS}
 
 // IsValidVersion says if the version is known to quic-go
 func IsValidVersion(v VersionNumber) bool {
-	return v == VersionTLS || IsSupportedVersion(SupportedVersions, v)
+	return v == VersionTLS || v == Version1 || IsSupportedVersion(SupportedVersions, v)
+}
+
+// UsesHeaderProtection says if the version uses the packet header format and
+// header protection defined in RFC 9000 and RFC 9001.
+func (vn VersionNumber) UsesHeaderProtection() bool {
+	return vn == Version1
 }
 
 func (vn VersionNumber) String() string {
@@ -40,6 +47,8 @@ func (vn VersionNumber) String() string {
 		return "unknown"
 	case VersionTLS:
 		return "TLS dev version (WIP)"
+	case Version1:
+		return "v1"
 	default:
 		if vn.isGQUIC() {
 			return fmt.Sprintf("gQUIC %d", vn.toGQUICVersion())
@@ -12,6 +12,7 @@ var _ = Describe("Version", func() {
 
 	It("says if a version is valid", func() {
 		Expect(IsValidVersion(VersionTLS)).To(BeTrue())
+		Expect(IsValidVersion(Version1)).To(BeTrue())
 		Expect(IsValidVersion(VersionWhatever)).To(BeFalse())
 		Expect(IsValidVersion(VersionUnknown)).To(BeFalse())
 		Expect(IsValidVersion(1234)).To(BeFalse())
@@ -19,10 +20,12 @@ var _ = Describe("Version", func() {
 
 	It("versions don't have reserved version numbers", func() {
 		Expect(isReservedVersion(VersionTLS)).To(BeFalse())
+		Expect(isReservedVersion(Version1)).To(BeFalse())
 	})
 
 	It("has the right string representation", func() {
 		Expect(VersionTLS.String()).To(ContainSubstring("TLS"))
+		Expect(Version1.String()).To(Equal("v1"))
 		Expect(VersionWhatever.String()).To(Equal("whatever"))
 		Expect(VersionUnknown.String()).To(Equal("unknown"))
 		// check with unsupported version numbers from the wiki
@@ -43,12 +46,21 @@ var _ = Describe("Version", func() {
 		Expect(IsSupportedVersion(SupportedVersions, SupportedVersions[len(SupportedVersions)-1])).To(BeTrue())
 	})
 
-	It("has supported versions in sorted order", func() {
+	It("prefers QUIC version 1", func() {
+		Expect(SupportedVersions[0]).To(Equal(Version1))
+	})
+
+	It("doesn't list a supported version twice", func() {
 		for i := 0; i < len(SupportedVersions)-1; i++ {
-			Expect(SupportedVersions[i]).To(BeNumerically(">", SupportedVersions[i+1]))
+			Expect(SupportedVersions[i+1:]).ToNot(ContainElement(SupportedVersions[i]))
 		}
 	})
 
+	It("says which versions use header protection", func() {
+		Expect(Version1.UsesHeaderProtection()).To(BeTrue())
+		Expect(VersionTLS.UsesHeaderProtection()).To(BeFalse())
+	})
+
 	Context("highest supported version", func() {
 		It("finds the supported version", func() {
 			supportedVersions := []VersionNumber{1, 2, 3}
@@ -7,13 +7,14 @@ import (
 	"path"
 	"runtime"
 	"strconv"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("error codes", func() {
-	// If this test breaks, you should run `go generate ./...`
+	// If this test breaks, you should update the String() method of the ErrorCode.
 	It("has a string representation for every error code", func() {
 		// We parse the error code file, extract all constants, and verify that
 		// each of them has a string version. Go FTW!
@@ -24,15 +25,21 @@ var _ = Describe("error codes", func() {
 		filename := path.Join(path.Dir(thisfile), "error_codes.go")
 		fileAst, err := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
 		Expect(err).NotTo(HaveOccurred())
-		constSpecs := fileAst.Decls[0].(*ast.GenDecl).Specs
+		constSpecs := fileAst.Decls[1].(*ast.GenDecl).Specs
 		Expect(len(constSpecs)).To(BeNumerically(">", 4)) // at time of writing
 		for _, c := range constSpecs {
-			name := c.(*ast.ValueSpec).Names[0].Name
 			valString := c.(*ast.ValueSpec).Values[0].(*ast.BasicLit).Value
-			val, err := strconv.Atoi(valString)
+			val, err := strconv.ParseInt(valString, 0, 64)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(ErrorCode(val).String()).To(Equal(name))
+			Expect(ErrorCode(val).String()).ToNot(HavePrefix("unknown error code"))
+			Expect(ErrorCode(val).String()).To(Equal(strings.ToUpper(ErrorCode(val).String())))
 		}
-		Expect(ErrorCode(0).String()).To(Equal("ErrorCode(0)"))
+		Expect(ErrorCode(0x1337).String()).To(Equal("unknown error code: 0x1337"))
+	})
+
+	It("has a string representation for crypto errors", func() {
+		Expect(CryptoErrorCode(42).IsCryptoError()).To(BeTrue())
+		Expect(CryptoErrorCode(42).String()).To(Equal("CRYPTO_ERROR (0x12a)"))
+		Expect(ProtocolViolation.IsCryptoError()).To(BeFalse())
 	})
 })
@@ -5,7 +5,7 @@ import (
 )
 
 // ErrorCode can be used as a normal error without reason.
-type ErrorCode uint16
+type ErrorCode uint64
 
 func (e ErrorCode) Error() string {
 	return e.String()
@@ -15,6 +15,7 @@ func (e ErrorCode) Error() string {
 type QuicError struct {
 	ErrorCode    ErrorCode
 	ErrorMessage string
+	isTimeout    bool
 }
 
 // Error creates a new QuicError instance
@@ -25,19 +26,26 @@ func Error(errorCode ErrorCode, errorMessage string) *QuicError {
 	}
 }
 
+// TimeoutError creates a new QuicError instance for a timeout error.
+// QUIC doesn't define an error code for timeouts, so NO_ERROR is used.
+func TimeoutError(errorMessage string) *QuicError {
+	return &QuicError{
+		ErrorCode:    NoError,
+		ErrorMessage: errorMessage,
+		isTimeout:    true,
+	}
+}
+
 func (e *QuicError) Error() string {
+	if len(e.ErrorMessage) == 0 {
+		return e.ErrorCode.String()
+	}
 	return fmt.Sprintf("%s: %s", e.ErrorCode.String(), e.ErrorMessage)
 }
 
 // Timeout says if this error is a timeout.
 func (e *QuicError) Timeout() bool {
-	switch e.ErrorCode {
-	case NetworkIdleTimeout,
-		HandshakeTimeout,
-		TimeoutsWithOpenStreams:
-		return true
-	}
-	return false
+	return e.isTimeout
 }
 
 // ToQuicError converts an arbitrary error to a QuicError. It leaves QuicErrors
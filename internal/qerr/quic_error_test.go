@@ -10,34 +10,44 @@ import (
 var _ = Describe("Quic error", func() {
 	Context("QuicError", func() {
 		It("has a string representation", func() {
-			err := Error(DecryptionFailure, "foobar")
-			Expect(err.Error()).To(Equal("DecryptionFailure: foobar"))
+			err := Error(FlowControlError, "foobar")
+			Expect(err.Error()).To(Equal("FLOW_CONTROL_ERROR: foobar"))
+		})
+
+		It("has a string representation for empty error phrases", func() {
+			err := Error(FlowControlError, "")
+			Expect(err.Error()).To(Equal("FLOW_CONTROL_ERROR"))
 		})
 	})
 
 	Context("ErrorCode", func() {
 		It("works as error", func() {
-			var err error = DecryptionFailure
-			Expect(err).To(MatchError("DecryptionFailure"))
+			var err error = StreamStateError
+			Expect(err).To(MatchError("STREAM_STATE_ERROR"))
 		})
 	})
 
 	Context("TimeoutError", func() {
 		It("works as timeout error", func() {
-			err := Error(HandshakeTimeout, "handshake timeout")
-			Expect(err.Timeout()).Should(BeTrue())
+			err := TimeoutError("handshake timeout")
+			Expect(err.ErrorCode).To(Equal(NoError))
+			Expect(err.Timeout()).To(BeTrue())
+		})
+
+		It("doesn't treat other errors as timeouts", func() {
+			Expect(Error(InternalError, "foobar").Timeout()).To(BeFalse())
 		})
 	})
 
 	Context("ToQuicError", func() {
 		It("leaves QuicError unchanged", func() {
-			err := Error(DecryptionFailure, "foo")
+			err := Error(TransportParameterError, "foo")
 			Expect(ToQuicError(err)).To(Equal(err))
 		})
 
 		It("wraps ErrorCode properly", func() {
-			var err error = DecryptionFailure
-			Expect(ToQuicError(err)).To(Equal(Error(DecryptionFailure, "")))
+			var err error = FinalSizeError
+			Expect(ToQuicError(err)).To(Equal(Error(FinalSizeError, "")))
 		})
 
 		It("changes default errors to InternalError", func() {
@@ -133,4 +133,32 @@ var _ = Describe("Big Endian encoding / decoding", func() {
 			Expect(err).To(HaveOccurred())
 		})
 	})
+
+	Context("WriteUintN", func() {
+		It("writes n bytes", func() {
+			expected := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8}
+			m := map[uint8]uint64{
+				0: 0x0,
+				1: 0x01,
+				2: 0x0102,
+				3: 0x010203,
+				4: 0x01020304,
+				5: 0x0102030405,
+				6: 0x010203040506,
+				7: 0x01020304050607,
+				8: 0x0102030405060708,
+			}
+			for n, val := range m {
+				b := &bytes.Buffer{}
+				BigEndian.WriteUintN(b, n, val)
+				Expect(b.Bytes()).To(Equal(expected[:n]))
+			}
+		})
+
+		It("cuts off the higher order bytes", func() {
+			b := &bytes.Buffer{}
+			BigEndian.WriteUintN(b, 2, 0xdeadbeef)
+			Expect(b.Bytes()).To(Equal([]byte{0xbe, 0xef}))
+		})
+	})
 })
@@ -12,6 +12,7 @@ type ByteOrder interface {
 	ReadUint32(io.ByteReader) (uint32, error)
 	ReadUint16(io.ByteReader) (uint16, error)
 
+	WriteUintN(b *bytes.Buffer, length uint8, i uint64)
 	WriteUint64(*bytes.Buffer, uint64)
 	WriteUint32(*bytes.Buffer, uint32)
 	WriteUint16(*bytes.Buffer, uint16)
@@ -88,6 +88,13 @@ func (bigEndian) ReadUint16(b io.ByteReader) (uint16, error) {
 	return uint16(b1) + uint16(b2)<<8, nil
 }
 
+// WriteUintN writes N bytes
+func (bigEndian) WriteUintN(b *bytes.Buffer, length uint8, i uint64) {
+	for j := length; j > 0; j-- {
+		b.WriteByte(uint8(i >> (8 * (j - 1))))
+	}
+}
+
 // WriteUint64 writes a uint64
 func (bigEndian) WriteUint64(b *bytes.Buffer, i uint64) {
 	b.Write([]byte{
@@ -13,6 +13,7 @@ import (
 type ConnectionCloseFrame struct {
 	IsApplicationError bool
 	ErrorCode          qerr.ErrorCode
+	FrameType          uint64 // the type of the frame that triggered the error, only set for transport errors
 	ReasonPhrase       string
 }
 
@@ -23,16 +24,18 @@ func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber)
 	}
 
 	f := &ConnectionCloseFrame{IsApplicationError: typeByte == 0x1d}
-	ec, err := utils.BigEndian.ReadUint16(r)
+	ec, err := readErrorCode(r, version)
 	if err != nil {
 		return nil, err
 	}
 	f.ErrorCode = qerr.ErrorCode(ec)
 	// read the Frame Type, if this is not an application error
 	if !f.IsApplicationError {
-		if _, err := utils.ReadVarInt(r); err != nil {
+		ft, err := utils.ReadVarInt(r)
+		if err != nil {
 			return nil, err
 		}
+		f.FrameType = ft
 	}
 	var reasonPhraseLen uint64
 	reasonPhraseLen, err = utils.ReadVarInt(r)
@@ -57,9 +60,9 @@ func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber)
 
 // Length of a written frame
 func (f *ConnectionCloseFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
-	length := 1 + 2 + utils.VarIntLen(uint64(len(f.ReasonPhrase))) + protocol.ByteCount(len(f.ReasonPhrase))
+	length := 1 + errorCodeLen(uint64(f.ErrorCode), version) + utils.VarIntLen(uint64(len(f.ReasonPhrase))) + protocol.ByteCount(len(f.ReasonPhrase))
 	if !f.IsApplicationError {
-		length++ // for the frame type
+		length += utils.VarIntLen(f.FrameType)
 	}
 	return length
 }
@@ -71,9 +74,9 @@ func (f *ConnectionCloseFrame) Write(b *bytes.Buffer, version protocol.VersionNu
 		b.WriteByte(0x1c)
 	}
 
-	utils.BigEndian.WriteUint16(b, uint16(f.ErrorCode))
+	writeErrorCode(b, uint64(f.ErrorCode), version)
 	if !f.IsApplicationError {
-		utils.WriteVarInt(b, 0)
+		utils.WriteVarInt(b, f.FrameType)
 	}
 	utils.WriteVarInt(b, uint64(len(f.ReasonPhrase)))
 	b.WriteString(f.ReasonPhrase)
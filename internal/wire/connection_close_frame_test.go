@@ -144,4 +144,40 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 			Expect(f.Length(versionIETFFrames)).To(Equal(protocol.ByteCount(b.Len())))
 		})
 	})
+
+	Context("in QUIC version 1", func() {
+		It("parses and writes a frame containing a transport error", func() {
+			f := &ConnectionCloseFrame{
+				ErrorCode:    qerr.CryptoErrorCode(42),
+				FrameType:    0x1337,
+				ReasonPhrase: "foobar",
+			}
+			b := &bytes.Buffer{}
+			Expect(f.Write(b, protocol.Version1)).To(Succeed())
+			expected := []byte{0x1c}
+			expected = append(expected, encodeVarInt(0x100+42)...)
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(6)...)
+			expected = append(expected, []byte("foobar")...)
+			Expect(b.Bytes()).To(Equal(expected))
+			Expect(f.Length(protocol.Version1)).To(BeEquivalentTo(b.Len()))
+			frame, err := parseConnectionCloseFrame(bytes.NewReader(b.Bytes()), protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("parses and writes a frame containing a large application error code", func() {
+			f := &ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          0xdeadbeef,
+				ReasonPhrase:       "foobar",
+			}
+			b := &bytes.Buffer{}
+			Expect(f.Write(b, protocol.Version1)).To(Succeed())
+			Expect(f.Length(protocol.Version1)).To(BeEquivalentTo(b.Len()))
+			frame, err := parseConnectionCloseFrame(bytes.NewReader(b.Bytes()), protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+	})
 })
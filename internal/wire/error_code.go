@@ -0,0 +1,34 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// QUIC version 1 encodes error codes as variable-length integers.
+// Earlier versions used a 2 byte error code.
+
+func readErrorCode(r *bytes.Reader, v protocol.VersionNumber) (uint64, error) {
+	if v == protocol.Version1 {
+		return utils.ReadVarInt(r)
+	}
+	ec, err := utils.BigEndian.ReadUint16(r)
+	return uint64(ec), err
+}
+
+func writeErrorCode(b *bytes.Buffer, ec uint64, v protocol.VersionNumber) {
+	if v == protocol.Version1 {
+		utils.WriteVarInt(b, ec)
+		return
+	}
+	utils.BigEndian.WriteUint16(b, uint16(ec))
+}
+
+func errorCodeLen(ec uint64, v protocol.VersionNumber) protocol.ByteCount {
+	if v == protocol.Version1 {
+		return utils.VarIntLen(ec)
+	}
+	return 2
+}
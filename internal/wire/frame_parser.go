@@ -29,7 +29,7 @@ func parseFrame(r *bytes.Reader, typeByte byte, v protocol.VersionNumber) (Frame
 	if typeByte&0xf8 == 0x8 {
 		frame, err = parseStreamFrame(r, v)
 		if err != nil {
-			return nil, qerr.Error(qerr.InvalidFrameData, err.Error())
+			return nil, qerr.Error(qerr.FrameEncodingError, err.Error())
 		}
 		return frame, nil
 	}
@@ -68,11 +68,23 @@ func parseFrame(r *bytes.Reader, typeByte byte, v protocol.VersionNumber) (Frame
 		frame, err = parsePathResponseFrame(r, v)
 	case 0x1c, 0x1d:
 		frame, err = parseConnectionCloseFrame(r, v)
+	case 0x1e:
+		if v != protocol.Version1 {
+			err = fmt.Errorf("unknown type byte 0x%x", typeByte)
+			break
+		}
+		frame, err = parseHandshakeDoneFrame(r, v)
+	case 0x24:
+		if v != protocol.Version1 {
+			err = fmt.Errorf("unknown type byte 0x%x", typeByte)
+			break
+		}
+		frame, err = parseResetStreamAtFrame(r, v)
 	default:
 		err = fmt.Errorf("unknown type byte 0x%x", typeByte)
 	}
 	if err != nil {
-		return nil, qerr.Error(qerr.InvalidFrameData, err.Error())
+		return nil, qerr.Error(qerr.FrameEncodingError, err.Error())
 	}
 	return frame, nil
 }
@@ -240,9 +240,42 @@ var _ = Describe("Frame parsing", func() {
 		Expect(frame).To(Equal(f))
 	})
 
+	It("unpacks HANDSHAKE_DONE frames", func() {
+		f := &HandshakeDoneFrame{}
+		buf := &bytes.Buffer{}
+		Expect(f.Write(buf, protocol.Version1)).To(Succeed())
+		frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), protocol.Version1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(f))
+	})
+
+	It("rejects HANDSHAKE_DONE frames in versions that don't define them", func() {
+		_, err := ParseNextFrame(bytes.NewReader([]byte{0x1e}), versionIETFFrames)
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x1e"))
+	})
+
+	It("unpacks RESET_STREAM_AT frames", func() {
+		f := &ResetStreamAtFrame{
+			StreamID:     0xdeadbeef,
+			ErrorCode:    0x1337,
+			ByteOffset:   0xdecafbad1234,
+			ReliableSize: 0x42,
+		}
+		buf := &bytes.Buffer{}
+		Expect(f.Write(buf, protocol.Version1)).To(Succeed())
+		frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), protocol.Version1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(f))
+	})
+
+	It("rejects RESET_STREAM_AT frames in versions that don't define them", func() {
+		_, err := ParseNextFrame(bytes.NewReader([]byte{0x24}), versionIETFFrames)
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x24"))
+	})
+
 	It("errors on invalid type", func() {
 		_, err := ParseNextFrame(bytes.NewReader([]byte{0x42}), versionIETFFrames)
-		Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0x42"))
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x42"))
 	})
 
 	It("errors on invalid frames", func() {
@@ -254,6 +287,6 @@ var _ = Describe("Frame parsing", func() {
 		f.Write(b, versionIETFFrames)
 		_, err := ParseNextFrame(bytes.NewReader(b.Bytes()[:b.Len()-2]), versionIETFFrames)
 		Expect(err).To(HaveOccurred())
-		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidFrameData))
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FrameEncodingError))
 	})
 })
@@ -32,8 +32,19 @@ type Header struct {
 	Token        []byte
 }
 
+// RetryIntegrityTagLen is the length of the Retry Integrity Tag, see section 5.8 of RFC 9001.
+const RetryIntegrityTagLen = 16
+
 // Write writes the Header.
+// For versions that use header protection, the packet number is not protected yet.
+// For Retry packets, the Retry Integrity Tag needs to be appended by the caller.
 func (h *Header) Write(b *bytes.Buffer, pers protocol.Perspective, ver protocol.VersionNumber) error {
+	if ver.UsesHeaderProtection() {
+		if h.IsLongHeader {
+			return h.writeLongHeaderV1(b)
+		}
+		return h.writeShortHeaderV1(b)
+	}
 	if h.IsLongHeader {
 		return h.writeLongHeader(b, ver)
 	}
@@ -85,8 +96,72 @@ func (h *Header) writeShortHeader(b *bytes.Buffer, v protocol.VersionNumber) err
 	return utils.WriteVarIntPacketNumber(b, h.PacketNumber, h.PacketNumberLen)
 }
 
+func (h *Header) writeLongHeaderV1(b *bytes.Buffer) error {
+	var packetType uint8
+	switch h.Type {
+	case protocol.PacketTypeInitial:
+		packetType = 0x0
+	case protocol.PacketType0RTT:
+		packetType = 0x1
+	case protocol.PacketTypeHandshake:
+		packetType = 0x2
+	case protocol.PacketTypeRetry:
+		packetType = 0x3
+	default:
+		return fmt.Errorf("invalid packet type: %s", h.Type)
+	}
+	if h.DestConnectionID.Len() > protocol.MaxConnIDLen || h.SrcConnectionID.Len() > protocol.MaxConnIDLen {
+		return fmt.Errorf("invalid connection ID length: %d / %d bytes", h.DestConnectionID.Len(), h.SrcConnectionID.Len())
+	}
+	firstByte := 0xc0 | packetType<<4
+	if h.Type != protocol.PacketTypeRetry {
+		if err := checkPacketNumberLenV1(h.PacketNumberLen); err != nil {
+			return err
+		}
+		firstByte |= uint8(h.PacketNumberLen - 1)
+	}
+	b.WriteByte(firstByte)
+	utils.BigEndian.WriteUint32(b, uint32(h.Version))
+	b.WriteByte(uint8(h.DestConnectionID.Len()))
+	b.Write(h.DestConnectionID.Bytes())
+	b.WriteByte(uint8(h.SrcConnectionID.Len()))
+	b.Write(h.SrcConnectionID.Bytes())
+
+	switch h.Type {
+	case protocol.PacketTypeRetry:
+		b.Write(h.Token)
+		return nil
+	case protocol.PacketTypeInitial:
+		utils.WriteVarInt(b, uint64(len(h.Token)))
+		b.Write(h.Token)
+	}
+	utils.WriteVarInt(b, uint64(h.Length))
+	utils.BigEndian.WriteUintN(b, uint8(h.PacketNumberLen), uint64(h.PacketNumber))
+	return nil
+}
+
+func (h *Header) writeShortHeaderV1(b *bytes.Buffer) error {
+	if err := checkPacketNumberLenV1(h.PacketNumberLen); err != nil {
+		return err
+	}
+	b.WriteByte(0x40 | uint8(h.KeyPhase<<2) | uint8(h.PacketNumberLen-1))
+	b.Write(h.DestConnectionID.Bytes())
+	utils.BigEndian.WriteUintN(b, uint8(h.PacketNumberLen), uint64(h.PacketNumber))
+	return nil
+}
+
+func checkPacketNumberLenV1(pnLen protocol.PacketNumberLen) error {
+	if pnLen < protocol.PacketNumberLen1 || pnLen > protocol.PacketNumberLen4 {
+		return fmt.Errorf("invalid packet number length: %d", pnLen)
+	}
+	return nil
+}
+
 // GetLength determines the length of the Header.
 func (h *Header) GetLength(v protocol.VersionNumber) protocol.ByteCount {
+	if v.UsesHeaderProtection() {
+		return h.getLengthV1()
+	}
 	if h.IsLongHeader {
 		length := 1 /* type byte */ + 4 /* version */ + 1 /* conn id len byte */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len()) + protocol.ByteCount(h.PacketNumberLen) + utils.VarIntLen(uint64(h.Length))
 		if h.Type == protocol.PacketTypeInitial {
@@ -100,6 +175,21 @@ func (h *Header) GetLength(v protocol.VersionNumber) protocol.ByteCount {
 	return length
 }
 
+func (h *Header) getLengthV1() protocol.ByteCount {
+	if h.IsLongHeader {
+		length := 1 /* type byte */ + 4 /* version */ + 1 /* dest conn id len */ + 1 /* src conn id len */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len())
+		if h.Type == protocol.PacketTypeRetry {
+			return length + protocol.ByteCount(len(h.Token))
+		}
+		length += protocol.ByteCount(h.PacketNumberLen) + utils.VarIntLen(uint64(h.Length))
+		if h.Type == protocol.PacketTypeInitial {
+			length += utils.VarIntLen(uint64(len(h.Token))) + protocol.ByteCount(len(h.Token))
+		}
+		return length
+	}
+	return protocol.ByteCount(1 /* type byte */ + h.DestConnectionID.Len() + int(h.PacketNumberLen))
+}
+
 // Log logs the Header
 func (h *Header) Log(logger utils.Logger) {
 	if h.IsLongHeader {
@@ -45,16 +45,37 @@ func ParseInvariantHeader(b *bytes.Reader, shortHeaderConnIDLen int) (*Invariant
 		return nil, err
 	}
 	h.Version = protocol.VersionNumber(v)
-	connIDLenByte, err := b.ReadByte()
+	// The IETF draft version used a single byte to encode both connection ID lengths.
+	// All other versions use the invariant header format of RFC 8999.
+	if h.Version == protocol.VersionTLS {
+		connIDLenByte, err := b.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		dcil, scil := decodeConnIDLen(connIDLenByte)
+		h.DestConnectionID, err = protocol.ReadConnectionID(b, dcil)
+		if err != nil {
+			return nil, err
+		}
+		h.SrcConnectionID, err = protocol.ReadConnectionID(b, scil)
+		if err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+	dcil, err := b.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	h.DestConnectionID, err = protocol.ReadConnectionID(b, int(dcil))
 	if err != nil {
 		return nil, err
 	}
-	dcil, scil := decodeConnIDLen(connIDLenByte)
-	h.DestConnectionID, err = protocol.ReadConnectionID(b, dcil)
+	scil, err := b.ReadByte()
 	if err != nil {
 		return nil, err
 	}
-	h.SrcConnectionID, err = protocol.ReadConnectionID(b, scil)
+	h.SrcConnectionID, err = protocol.ReadConnectionID(b, int(scil))
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +88,19 @@ func (iv *InvariantHeader) Parse(b *bytes.Reader, sentBy protocol.Perspective, v
 		if iv.Version == 0 { // Version Negotiation Packet
 			return iv.parseVersionNegotiationPacket(b)
 		}
-		return iv.parseLongHeader(b, sentBy, ver)
+		switch ver {
+		case protocol.Version1:
+			return iv.parseLongHeaderV1(b)
+		case protocol.VersionTLS:
+			return iv.parseLongHeader(b, sentBy, ver)
+		default:
+			// We don't know how to parse the rest of the header.
+			// Only the version independent fields are set.
+			return iv.toHeader(), nil
+		}
+	}
+	if ver.UsesHeaderProtection() {
+		return iv.parseShortHeaderV1(b)
 	}
 	return iv.parseShortHeader(b, ver)
 }
@@ -84,14 +117,14 @@ func (iv *InvariantHeader) toHeader() *Header {
 func (iv *InvariantHeader) parseVersionNegotiationPacket(b *bytes.Reader) (*Header, error) {
 	h := iv.toHeader()
 	if b.Len() == 0 {
-		return nil, qerr.Error(qerr.InvalidVersionNegotiationPacket, "empty version list")
+		return nil, qerr.Error(qerr.ProtocolViolation, "empty version list")
 	}
 	h.IsVersionNegotiation = true
 	h.SupportedVersions = make([]protocol.VersionNumber, b.Len()/4)
 	for i := 0; b.Len() > 0; i++ {
 		v, err := utils.BigEndian.ReadUint32(b)
 		if err != nil {
-			return nil, qerr.InvalidVersionNegotiationPacket
+			return nil, qerr.ProtocolViolation
 		}
 		h.SupportedVersions[i] = protocol.VersionNumber(v)
 	}
@@ -103,7 +136,7 @@ func (iv *InvariantHeader) parseLongHeader(b *bytes.Reader, sentBy protocol.Pers
 	h.Type = protocol.PacketType(iv.typeByte & 0x7f)
 
 	if h.Type != protocol.PacketTypeInitial && h.Type != protocol.PacketTypeRetry && h.Type != protocol.PacketType0RTT && h.Type != protocol.PacketTypeHandshake {
-		return nil, qerr.Error(qerr.InvalidPacketHeader, fmt.Sprintf("Received packet with invalid packet type: %d", h.Type))
+		return nil, qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("Received packet with invalid packet type: %d", h.Type))
 	}
 
 	if h.Type == protocol.PacketTypeRetry {
@@ -165,3 +198,70 @@ func (iv *InvariantHeader) parseShortHeader(b *bytes.Reader, v protocol.VersionN
 
 	return h, nil
 }
+
+// parseLongHeaderV1 parses a Long Header, as defined in RFC 9000.
+// Since the packet number is protected by header protection, parsing stops before
+// the packet number. PacketNumber and PacketNumberLen are set after removing header protection.
+func (iv *InvariantHeader) parseLongHeaderV1(b *bytes.Reader) (*Header, error) {
+	h := iv.toHeader()
+	if iv.typeByte&0x40 == 0 {
+		return nil, qerr.Error(qerr.ProtocolViolation, "not a QUIC packet")
+	}
+	if iv.DestConnectionID.Len() > protocol.MaxConnIDLen || iv.SrcConnectionID.Len() > protocol.MaxConnIDLen {
+		return nil, qerr.Error(qerr.ProtocolViolation, "connection ID too long")
+	}
+	switch (iv.typeByte & 0x30) >> 4 {
+	case 0x0:
+		h.Type = protocol.PacketTypeInitial
+	case 0x1:
+		h.Type = protocol.PacketType0RTT
+	case 0x2:
+		h.Type = protocol.PacketTypeHandshake
+	case 0x3:
+		h.Type = protocol.PacketTypeRetry
+	}
+
+	if h.Type == protocol.PacketTypeRetry {
+		tokenLen := b.Len() - RetryIntegrityTagLen
+		if tokenLen <= 0 {
+			return nil, io.EOF
+		}
+		h.Token = make([]byte, tokenLen)
+		if _, err := io.ReadFull(b, h.Token); err != nil {
+			return nil, err
+		}
+		// The Retry Integrity Tag is verified by the client, using the raw packet.
+		_, err := b.Seek(RetryIntegrityTagLen, io.SeekCurrent)
+		return h, err
+	}
+
+	if h.Type == protocol.PacketTypeInitial {
+		tokenLen, err := utils.ReadVarInt(b)
+		if err != nil {
+			return nil, err
+		}
+		if tokenLen > uint64(b.Len()) {
+			return nil, io.EOF
+		}
+		h.Token = make([]byte, tokenLen)
+		if _, err := io.ReadFull(b, h.Token); err != nil {
+			return nil, err
+		}
+	}
+
+	pl, err := utils.ReadVarInt(b)
+	if err != nil {
+		return nil, err
+	}
+	h.Length = protocol.ByteCount(pl)
+	return h, nil
+}
+
+// parseShortHeaderV1 parses a Short Header, as defined in RFC 9000.
+// Everything after the connection ID is protected by header protection.
+func (iv *InvariantHeader) parseShortHeaderV1(b *bytes.Reader) (*Header, error) {
+	if iv.typeByte&0x40 == 0 {
+		return nil, qerr.Error(qerr.ProtocolViolation, "not a QUIC packet")
+	}
+	return iv.toHeader(), nil
+}
@@ -51,7 +51,7 @@ var _ = Describe("Header Parsing", func() {
 			iHdr, err := ParseInvariantHeader(b, 0)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = iHdr.Parse(b, protocol.PerspectiveServer, versionIETFFrames)
-			Expect(err).To(MatchError(qerr.InvalidVersionNegotiationPacket))
+			Expect(err).To(MatchError(qerr.ProtocolViolation))
 		})
 
 		It("errors if the version list is empty", func() {
@@ -64,7 +64,7 @@ var _ = Describe("Header Parsing", func() {
 			iHdr, err := ParseInvariantHeader(b, 0)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = iHdr.Parse(b, protocol.PerspectiveServer, versionIETFFrames)
-			Expect(err).To(MatchError("InvalidVersionNegotiationPacket: empty version list"))
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: empty version list"))
 		})
 	})
 
@@ -74,7 +74,7 @@ var _ = Describe("Header Parsing", func() {
 			srcConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x61, // connection ID lengths
 			}
 			data = append(data, destConnID...)
@@ -101,7 +101,7 @@ var _ = Describe("Header Parsing", func() {
 			Expect(hdr.Length).To(Equal(protocol.ByteCount(0x1337)))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0xbeef)))
 			Expect(hdr.PacketNumberLen).To(Equal(protocol.PacketNumberLen4))
-			Expect(hdr.Version).To(Equal(protocol.VersionNumber(0x1020304)))
+			Expect(hdr.Version).To(Equal(protocol.VersionTLS))
 			Expect(hdr.IsVersionNegotiation).To(BeFalse())
 			Expect(b.Len()).To(BeZero())
 		})
@@ -109,7 +109,7 @@ var _ = Describe("Header Parsing", func() {
 		It("parses a Long Header without a destination connection ID", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x01,                   // connection ID lengths
 				0xde, 0xad, 0xbe, 0xef, // source connection ID
 			}
@@ -125,7 +125,7 @@ var _ = Describe("Header Parsing", func() {
 		It("parses a Long Header without a source connection ID", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x70,                          // connection ID lengths
 				1, 2, 3, 4, 5, 6, 7, 8, 9, 10, // source connection ID
 			}
@@ -141,7 +141,7 @@ var _ = Describe("Header Parsing", func() {
 		It("parses a Long Header with a 2 byte packet number", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x0, // connection ID lengths
 			}
 			data = append(data, encodeVarInt(0)...)    // token length
@@ -160,7 +160,7 @@ var _ = Describe("Header Parsing", func() {
 		It("parses a Retry packet", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeRetry),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x0,                           // connection ID lengths
 				0x97,                          // Orig Destination Connection ID length
 				1, 2, 3, 4, 5, 6, 7, 8, 9, 10, // source connection ID
@@ -183,7 +183,7 @@ var _ = Describe("Header Parsing", func() {
 				IsLongHeader:    true,
 				Type:            42,
 				SrcConnectionID: srcConnID,
-				Version:         0x10203040,
+				Version:         protocol.VersionTLS,
 				PacketNumber:    1,
 				PacketNumberLen: protocol.PacketNumberLen1,
 			}).Write(buf, protocol.PerspectiveClient, protocol.VersionTLS)
@@ -192,13 +192,13 @@ var _ = Describe("Header Parsing", func() {
 			iHdr, err := ParseInvariantHeader(b, 0)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = iHdr.Parse(b, protocol.PerspectiveClient, versionIETFFrames)
-			Expect(err).To(MatchError("InvalidPacketHeader: Received packet with invalid packet type: 42"))
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received packet with invalid packet type: 42"))
 		})
 
 		It("errors if the token length is too large", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x0, // connection ID lengths
 			}
 			data = append(data, encodeVarInt(4)...)                           // token length: 4 bytes (1 byte too long)
@@ -215,7 +215,7 @@ var _ = Describe("Header Parsing", func() {
 		It("errors on EOF, when parsing the invariant header", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x55,                                           // connection ID lengths
 				0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // destination connection ID
 				0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // source connection ID
@@ -229,7 +229,7 @@ var _ = Describe("Header Parsing", func() {
 		It("errors on EOF, when parsing the header", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeInitial),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x0, // connection ID lengths
 			}
 			iHdrLen := len(data)
@@ -247,7 +247,7 @@ var _ = Describe("Header Parsing", func() {
 		It("errors on EOF, for a Retry packet", func() {
 			data := []byte{
 				0x80 ^ uint8(protocol.PacketTypeRetry),
-				0x1, 0x2, 0x3, 0x4, // version number
+				0x0, 0x0, 0x0, 0x65, // version number
 				0x0, // connection ID lengths
 			}
 			iHdrLen := len(data)
@@ -379,4 +379,154 @@ var _ = Describe("Header Parsing", func() {
 			}
 		})
 	})
+
+	Context("QUIC version 1", func() {
+		It("parses the invariant header of an unknown version", func() {
+			data := []byte{
+				0xc0,
+				0x1, 0x2, 0x3, 0x4, // version number
+				4, 0xde, 0xad, 0xbe, 0xef, // destination connection ID
+				2, 0xca, 0xfe, // source connection ID
+			}
+			b := bytes.NewReader(data)
+			iHdr, err := ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(iHdr.Version).To(Equal(protocol.VersionNumber(0x1020304)))
+			Expect(iHdr.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+			Expect(iHdr.SrcConnectionID).To(Equal(protocol.ConnectionID{0xca, 0xfe}))
+			hdr, err := iHdr.Parse(b, protocol.PerspectiveClient, iHdr.Version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.IsLongHeader).To(BeTrue())
+			Expect(hdr.Version).To(Equal(protocol.VersionNumber(0x1020304)))
+			Expect(hdr.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+		})
+
+		It("parses an Initial, stopping before the packet number", func() {
+			destConnID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+			srcConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+			buf := &bytes.Buffer{}
+			Expect((&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				Version:          protocol.Version1,
+				DestConnectionID: destConnID,
+				SrcConnectionID:  srcConnID,
+				Token:            []byte("foobar"),
+				Length:           0x1337,
+				PacketNumber:     0xbeef,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+			}).Write(buf, protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			b := bytes.NewReader(buf.Bytes())
+			iHdr, err := ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(iHdr.DestConnectionID).To(Equal(destConnID))
+			Expect(iHdr.SrcConnectionID).To(Equal(srcConnID))
+			hdr, err := iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.Type).To(Equal(protocol.PacketTypeInitial))
+			Expect(hdr.Token).To(Equal([]byte("foobar")))
+			Expect(hdr.Length).To(Equal(protocol.ByteCount(0x1337)))
+			Expect(hdr.PacketNumberLen).To(BeZero())
+			// only the packet number is left
+			Expect(b.Len()).To(Equal(2))
+		})
+
+		It("parses the packet types", func() {
+			for _, t := range []protocol.PacketType{protocol.PacketTypeInitial, protocol.PacketType0RTT, protocol.PacketTypeHandshake} {
+				buf := &bytes.Buffer{}
+				Expect((&Header{
+					IsLongHeader:    true,
+					Type:            t,
+					Version:         protocol.Version1,
+					PacketNumberLen: protocol.PacketNumberLen4,
+				}).Write(buf, protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+				b := bytes.NewReader(buf.Bytes())
+				iHdr, err := ParseInvariantHeader(b, 0)
+				Expect(err).ToNot(HaveOccurred())
+				hdr, err := iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.Type).To(Equal(t))
+			}
+		})
+
+		It("parses a Retry packet", func() {
+			buf := &bytes.Buffer{}
+			Expect((&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeRetry,
+				Version:          protocol.Version1,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+				SrcConnectionID:  protocol.ConnectionID{5, 6, 7, 8},
+				Token:            []byte("foobar"),
+			}).Write(buf, protocol.PerspectiveServer, protocol.Version1)).To(Succeed())
+			buf.Write(bytes.Repeat([]byte{0x42}, RetryIntegrityTagLen))
+			b := bytes.NewReader(buf.Bytes())
+			iHdr, err := ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, err := iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(hdr.Token).To(Equal([]byte("foobar")))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors if a Retry packet is too short to contain the integrity tag", func() {
+			data := []byte{
+				0xf0,
+				0x0, 0x0, 0x0, 0x1, // version number
+				0, 0, // connection IDs
+			}
+			data = append(data, make([]byte, RetryIntegrityTagLen)...)
+			b := bytes.NewReader(data)
+			iHdr, err := ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).To(MatchError(io.EOF))
+		})
+
+		It("rejects packets that don't have the fixed bit set", func() {
+			data := []byte{
+				0x80,
+				0x0, 0x0, 0x0, 0x1, // version number
+				0, 0, // connection IDs
+			}
+			data = append(data, encodeVarInt(0)...) // token length
+			data = append(data, encodeVarInt(0x42)...)
+			b := bytes.NewReader(data)
+			iHdr, err := ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: not a QUIC packet"))
+		})
+
+		It("rejects connection IDs longer than 20 bytes", func() {
+			data := []byte{
+				0xc0,
+				0x0, 0x0, 0x0, 0x1, // version number
+				21,
+			}
+			data = append(data, make([]byte, 21)...)
+			data = append(data, 0)
+			data = append(data, encodeVarInt(0)...) // token length
+			data = append(data, encodeVarInt(0x42)...)
+			b := bytes.NewReader(data)
+			iHdr, err := ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: connection ID too long"))
+		})
+
+		It("parses a Short Header, stopping before the packet number", func() {
+			data := []byte{0x41, 0xde, 0xad, 0xbe, 0xef, 0x13, 0x37}
+			b := bytes.NewReader(data)
+			iHdr, err := ParseInvariantHeader(b, 4)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, err := iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.IsLongHeader).To(BeFalse())
+			Expect(hdr.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+			Expect(hdr.PacketNumberLen).To(BeZero())
+			Expect(b.Len()).To(Equal(2))
+		})
+	})
 })
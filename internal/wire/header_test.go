@@ -213,6 +213,124 @@ var _ = Describe("Header", func() {
 		})
 	})
 
+	Context("Writing QUIC version 1 headers", func() {
+		var buf *bytes.Buffer
+
+		BeforeEach(func() {
+			buf = &bytes.Buffer{}
+		})
+
+		It("writes a Long Header", func() {
+			err := (&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe},
+				SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+				Length:           0xcafe,
+				PacketNumber:     0xdecaf,
+				PacketNumberLen:  protocol.PacketNumberLen3,
+				Version:          protocol.Version1,
+			}).Write(buf, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			expected := []byte{
+				0xc0 | 0x2<<4 | 0x2,
+				0x0, 0x0, 0x0, 0x1, // version number
+				6, 0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, // dest connection ID
+				4, 0xde, 0xca, 0xfb, 0xad, // source connection ID
+			}
+			expected = append(expected, encodeVarInt(0xcafe)...) // length
+			expected = append(expected, []byte{0x0d, 0xec, 0xaf}...)
+			Expect(buf.Bytes()).To(Equal(expected))
+		})
+
+		It("writes an Initial containing a token", func() {
+			err := (&Header{
+				IsLongHeader:    true,
+				Type:            protocol.PacketTypeInitial,
+				Token:           []byte("foobar"),
+				PacketNumber:    0x42,
+				PacketNumberLen: protocol.PacketNumberLen1,
+				Version:         protocol.Version1,
+			}).Write(buf, protocol.PerspectiveClient, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			expected := []byte{
+				0xc0,
+				0x0, 0x0, 0x0, 0x1, // version number
+				0, 0, // connection IDs
+			}
+			expected = append(expected, encodeVarInt(6)...)
+			expected = append(expected, []byte("foobar")...)
+			expected = append(expected, encodeVarInt(0)...) // length
+			expected = append(expected, 0x42)
+			Expect(buf.Bytes()).To(Equal(expected))
+		})
+
+		It("writes a Retry packet", func() {
+			err := (&Header{
+				IsLongHeader:    true,
+				Type:            protocol.PacketTypeRetry,
+				Token:           []byte("foobar"),
+				SrcConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+				Version:         protocol.Version1,
+			}).Write(buf, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			expected := []byte{
+				0xc0 | 0x3<<4,
+				0x0, 0x0, 0x0, 0x1, // version number
+				0,             // dest connection ID
+				4, 1, 2, 3, 4, // source connection ID
+			}
+			expected = append(expected, []byte("foobar")...)
+			Expect(buf.Bytes()).To(Equal(expected))
+		})
+
+		It("refuses to write connection IDs longer than 20 bytes", func() {
+			err := (&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: make([]byte, 21),
+				PacketNumberLen:  protocol.PacketNumberLen1,
+				Version:          protocol.Version1,
+			}).Write(buf, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).To(MatchError("invalid connection ID length: 21 / 0 bytes"))
+		})
+
+		It("writes a Short Header", func() {
+			err := (&Header{
+				DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+				KeyPhase:         1,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+				PacketNumber:     0x1337,
+			}).Write(buf, protocol.PerspectiveClient, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Bytes()).To(Equal([]byte{
+				0x40 | 0x4 | 0x1,
+				0xde, 0xad, 0xbe, 0xef, // connection ID
+				0x13, 0x37, // packet number
+			}))
+		})
+
+		It("errors when given an invalid packet number length", func() {
+			err := (&Header{
+				PacketNumberLen: 5,
+			}).Write(buf, protocol.PerspectiveClient, protocol.Version1)
+			Expect(err).To(MatchError("invalid packet number length: 5"))
+		})
+
+		It("has the right length", func() {
+			for _, h := range []*Header{
+				{IsLongHeader: true, Type: protocol.PacketTypeInitial, Token: []byte("foo"), DestConnectionID: make([]byte, 20), Length: 1000, PacketNumberLen: protocol.PacketNumberLen3},
+				{IsLongHeader: true, Type: protocol.PacketTypeHandshake, SrcConnectionID: make([]byte, 8), Length: 10, PacketNumberLen: protocol.PacketNumberLen4},
+				{IsLongHeader: true, Type: protocol.PacketTypeRetry, Token: []byte("foobar")},
+				{DestConnectionID: make([]byte, 8), PacketNumberLen: protocol.PacketNumberLen1},
+			} {
+				buf := &bytes.Buffer{}
+				Expect(h.Write(buf, protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+				Expect(h.GetLength(protocol.Version1)).To(BeEquivalentTo(buf.Len()))
+			}
+		})
+	})
+
 	Context("getting the length", func() {
 		var buf *bytes.Buffer
 
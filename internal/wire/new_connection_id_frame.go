@@ -13,11 +13,12 @@ import (
 // A NewConnectionIDFrame is a NEW_CONNECTION_ID frame
 type NewConnectionIDFrame struct {
 	SequenceNumber      uint64
+	RetirePriorTo       uint64 // only used in QUIC version 1
 	ConnectionID        protocol.ConnectionID
 	StatelessResetToken [16]byte
 }
 
-func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewConnectionIDFrame, error) {
+func parseNewConnectionIDFrame(r *bytes.Reader, version protocol.VersionNumber) (*NewConnectionIDFrame, error) {
 	if _, err := r.ReadByte(); err != nil {
 		return nil, err
 	}
@@ -26,12 +27,22 @@ func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewC
 	if err != nil {
 		return nil, err
 	}
+	var retirePriorTo uint64
+	if version == protocol.Version1 {
+		retirePriorTo, err = utils.ReadVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		if retirePriorTo > seq {
+			return nil, fmt.Errorf("Retire Prior To value (%d) larger than Sequence Number (%d)", retirePriorTo, seq)
+		}
+	}
 	connIDLen, err := r.ReadByte()
 	if err != nil {
 		return nil, err
 	}
-	if connIDLen < 4 || connIDLen > 18 {
-		return nil, fmt.Errorf("invalid connection ID length: %d", connIDLen)
+	if err := checkNewConnectionIDLen(int(connIDLen), version); err != nil {
+		return nil, err
 	}
 	connID, err := protocol.ReadConnectionID(r, int(connIDLen))
 	if err != nil {
@@ -39,6 +50,7 @@ func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewC
 	}
 	frame := &NewConnectionIDFrame{
 		SequenceNumber: seq,
+		RetirePriorTo:  retirePriorTo,
 		ConnectionID:   connID,
 	}
 	if _, err := io.ReadFull(r, frame.StatelessResetToken[:]); err != nil {
@@ -51,12 +63,15 @@ func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewC
 	return frame, nil
 }
 
-func (f *NewConnectionIDFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+func (f *NewConnectionIDFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
 	b.WriteByte(0x18)
 	utils.WriteVarInt(b, f.SequenceNumber)
+	if version == protocol.Version1 {
+		utils.WriteVarInt(b, f.RetirePriorTo)
+	}
 	connIDLen := f.ConnectionID.Len()
-	if connIDLen < 4 || connIDLen > 18 {
-		return fmt.Errorf("invalid connection ID length: %d", connIDLen)
+	if err := checkNewConnectionIDLen(connIDLen, version); err != nil {
+		return err
 	}
 	b.WriteByte(uint8(connIDLen))
 	b.Write(f.ConnectionID.Bytes())
@@ -65,6 +80,23 @@ func (f *NewConnectionIDFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber)
 }
 
 // Length of a written frame
-func (f *NewConnectionIDFrame) Length(protocol.VersionNumber) protocol.ByteCount {
-	return 1 + utils.VarIntLen(f.SequenceNumber) + 1 /* connection ID length */ + protocol.ByteCount(f.ConnectionID.Len()) + 16
+func (f *NewConnectionIDFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
+	length := 1 + utils.VarIntLen(f.SequenceNumber) + 1 /* connection ID length */ + protocol.ByteCount(f.ConnectionID.Len()) + 16
+	if version == protocol.Version1 {
+		length += utils.VarIntLen(f.RetirePriorTo)
+	}
+	return length
+}
+
+func checkNewConnectionIDLen(l int, version protocol.VersionNumber) error {
+	if version == protocol.Version1 {
+		if l < 1 || l > protocol.MaxConnIDLen {
+			return fmt.Errorf("invalid connection ID length: %d", l)
+		}
+		return nil
+	}
+	if l < 4 || l > 18 {
+		return fmt.Errorf("invalid connection ID length: %d", l)
+	}
+	return nil
 }
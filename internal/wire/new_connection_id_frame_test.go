@@ -82,4 +82,41 @@ var _ = Describe("NEW_CONNECTION_ID frame", func() {
 			Expect(frame.Length(versionIETFFrames)).To(BeEquivalentTo(b.Len()))
 		})
 	})
+
+	Context("in QUIC version 1", func() {
+		It("writes and parses the Retire Prior To field", func() {
+			f := &NewConnectionIDFrame{
+				SequenceNumber:      0x1337,
+				RetirePriorTo:       0x42,
+				ConnectionID:        protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+				StatelessResetToken: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			}
+			b := &bytes.Buffer{}
+			Expect(f.Write(b, protocol.Version1)).To(Succeed())
+			expected := []byte{0x18}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(0x42)...)
+			expected = append(expected, 20)
+			Expect(b.Bytes()).To(HavePrefix(string(expected)))
+			Expect(f.Length(protocol.Version1)).To(BeEquivalentTo(b.Len()))
+			frame, err := parseNewConnectionIDFrame(bytes.NewReader(b.Bytes()), protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("errors when Retire Prior To is larger than the Sequence Number", func() {
+			data := []byte{0x18}
+			data = append(data, encodeVarInt(10)...)
+			data = append(data, encodeVarInt(11)...)
+			data = append(data, 4, 1, 2, 3, 4)
+			data = append(data, make([]byte, 16)...)
+			_, err := parseNewConnectionIDFrame(bytes.NewReader(data), protocol.Version1)
+			Expect(err).To(MatchError("Retire Prior To value (11) larger than Sequence Number (10)"))
+		})
+
+		It("rejects connection IDs longer than 20 bytes", func() {
+			f := &NewConnectionIDFrame{ConnectionID: make([]byte, 21)}
+			Expect(f.Write(&bytes.Buffer{}, protocol.Version1)).To(MatchError("invalid connection ID length: 21"))
+		})
+	})
 })
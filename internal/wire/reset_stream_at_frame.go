@@ -0,0 +1,65 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A ResetStreamAtFrame is a RESET_STREAM_AT frame, as defined by the reliable stream reset extension.
+// It resets a stream, but requires the data up to ReliableSize to be delivered.
+type ResetStreamAtFrame struct {
+	StreamID     protocol.StreamID
+	ErrorCode    protocol.ApplicationErrorCode
+	ByteOffset   protocol.ByteCount // the final size of the stream
+	ReliableSize protocol.ByteCount
+}
+
+func parseResetStreamAtFrame(r *bytes.Reader, version protocol.VersionNumber) (*ResetStreamAtFrame, error) {
+	if _, err := r.ReadByte(); err != nil { // read the TypeByte
+		return nil, err
+	}
+
+	sid, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	errorCode, err := readErrorCode(r, version)
+	if err != nil {
+		return nil, err
+	}
+	byteOffset, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	reliableSize, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if reliableSize > byteOffset {
+		return nil, errors.New("RESET_STREAM_AT: reliable size larger than final size")
+	}
+
+	return &ResetStreamAtFrame{
+		StreamID:     protocol.StreamID(sid),
+		ErrorCode:    protocol.ApplicationErrorCode(errorCode),
+		ByteOffset:   protocol.ByteCount(byteOffset),
+		ReliableSize: protocol.ByteCount(reliableSize),
+	}, nil
+}
+
+func (f *ResetStreamAtFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
+	b.WriteByte(0x24)
+	utils.WriteVarInt(b, uint64(f.StreamID))
+	writeErrorCode(b, uint64(f.ErrorCode), version)
+	utils.WriteVarInt(b, uint64(f.ByteOffset))
+	utils.WriteVarInt(b, uint64(f.ReliableSize))
+	return nil
+}
+
+// Length of a written frame
+func (f *ResetStreamAtFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
+	return 1 + utils.VarIntLen(uint64(f.StreamID)) + errorCodeLen(uint64(f.ErrorCode), version) + utils.VarIntLen(uint64(f.ByteOffset)) + utils.VarIntLen(uint64(f.ReliableSize))
+}
@@ -0,0 +1,84 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RESET_STREAM_AT frame", func() {
+	Context("when parsing", func() {
+		It("accepts sample frame", func() {
+			data := []byte{0x24}
+			data = append(data, encodeVarInt(0xdeadbeef)...)  // stream ID
+			data = append(data, encodeVarInt(0x1337)...)      // error code
+			data = append(data, encodeVarInt(0x987654321)...) // byte offset
+			data = append(data, encodeVarInt(0x42)...)        // reliable size
+			b := bytes.NewReader(data)
+			frame, err := parseResetStreamAtFrame(b, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.StreamID).To(Equal(protocol.StreamID(0xdeadbeef)))
+			Expect(frame.ErrorCode).To(Equal(protocol.ApplicationErrorCode(0x1337)))
+			Expect(frame.ByteOffset).To(Equal(protocol.ByteCount(0x987654321)))
+			Expect(frame.ReliableSize).To(Equal(protocol.ByteCount(0x42)))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors when the reliable size is larger than the final size", func() {
+			data := []byte{0x24}
+			data = append(data, encodeVarInt(0xdeadbeef)...) // stream ID
+			data = append(data, encodeVarInt(0x1337)...)     // error code
+			data = append(data, encodeVarInt(0x42)...)       // byte offset
+			data = append(data, encodeVarInt(0x43)...)       // reliable size
+			_, err := parseResetStreamAtFrame(bytes.NewReader(data), protocol.Version1)
+			Expect(err).To(MatchError("RESET_STREAM_AT: reliable size larger than final size"))
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x24}
+			data = append(data, encodeVarInt(0xdeadbeef)...)  // stream ID
+			data = append(data, encodeVarInt(0x1337)...)      // error code
+			data = append(data, encodeVarInt(0x987654321)...) // byte offset
+			data = append(data, encodeVarInt(0x42)...)        // reliable size
+			_, err := parseResetStreamAtFrame(bytes.NewReader(data), protocol.Version1)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseResetStreamAtFrame(bytes.NewReader(data[0:i]), protocol.Version1)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			frame := ResetStreamAtFrame{
+				StreamID:     0x1337,
+				ErrorCode:    0xcafe,
+				ByteOffset:   0x11223344decafbad,
+				ReliableSize: 0x1234,
+			}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, protocol.Version1)).To(Succeed())
+			expected := []byte{0x24}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(0xcafe)...)
+			expected = append(expected, encodeVarInt(0x11223344decafbad)...)
+			expected = append(expected, encodeVarInt(0x1234)...)
+			Expect(b.Bytes()).To(Equal(expected))
+		})
+
+		It("has the correct length", func() {
+			frame := ResetStreamAtFrame{
+				StreamID:     0x1337,
+				ErrorCode:    0xde,
+				ByteOffset:   0x1234567,
+				ReliableSize: 0x123,
+			}
+			expectedLen := 1 + utils.VarIntLen(0x1337) + utils.VarIntLen(0xde) + utils.VarIntLen(0x1234567) + utils.VarIntLen(0x123)
+			Expect(frame.Length(protocol.Version1)).To(Equal(expectedLen))
+		})
+	})
+})
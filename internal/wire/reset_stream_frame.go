@@ -20,14 +20,14 @@ func parseResetStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*Re
 	}
 
 	var streamID protocol.StreamID
-	var errorCode uint16
+	var errorCode uint64
 	var byteOffset protocol.ByteCount
 	sid, err := utils.ReadVarInt(r)
 	if err != nil {
 		return nil, err
 	}
 	streamID = protocol.StreamID(sid)
-	errorCode, err = utils.BigEndian.ReadUint16(r)
+	errorCode, err = readErrorCode(r, version)
 	if err != nil {
 		return nil, err
 	}
@@ -47,12 +47,12 @@ func parseResetStreamFrame(r *bytes.Reader, version protocol.VersionNumber) (*Re
 func (f *ResetStreamFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
 	b.WriteByte(0x4)
 	utils.WriteVarInt(b, uint64(f.StreamID))
-	utils.BigEndian.WriteUint16(b, uint16(f.ErrorCode))
+	writeErrorCode(b, uint64(f.ErrorCode), version)
 	utils.WriteVarInt(b, uint64(f.ByteOffset))
 	return nil
 }
 
 // Length of a written frame
 func (f *ResetStreamFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
-	return 1 + utils.VarIntLen(uint64(f.StreamID)) + 2 + utils.VarIntLen(uint64(f.ByteOffset))
+	return 1 + utils.VarIntLen(uint64(f.StreamID)) + errorCodeLen(uint64(f.ErrorCode), version) + utils.VarIntLen(uint64(f.ByteOffset))
 }
@@ -65,4 +65,25 @@ var _ = Describe("RESET_STREAM frame", func() {
 			Expect(rst.Length(versionIETFFrames)).To(Equal(expectedLen))
 		})
 	})
+
+	Context("in QUIC version 1", func() {
+		It("uses a variable-length integer for the error code", func() {
+			f := &ResetStreamFrame{
+				StreamID:   0x1337,
+				ErrorCode:  0xdeadbeef,
+				ByteOffset: 0x42,
+			}
+			b := &bytes.Buffer{}
+			Expect(f.Write(b, protocol.Version1)).To(Succeed())
+			expected := []byte{0x4}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(0xdeadbeef)...)
+			expected = append(expected, encodeVarInt(0x42)...)
+			Expect(b.Bytes()).To(Equal(expected))
+			Expect(f.Length(protocol.Version1)).To(BeEquivalentTo(b.Len()))
+			frame, err := parseResetStreamFrame(bytes.NewReader(b.Bytes()), protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+	})
 })
@@ -14,7 +14,7 @@ type StopSendingFrame struct {
 }
 
 // parseStopSendingFrame parses a STOP_SENDING frame
-func parseStopSendingFrame(r *bytes.Reader, _ protocol.VersionNumber) (*StopSendingFrame, error) {
+func parseStopSendingFrame(r *bytes.Reader, version protocol.VersionNumber) (*StopSendingFrame, error) {
 	if _, err := r.ReadByte(); err != nil {
 		return nil, err
 	}
@@ -23,7 +23,7 @@ func parseStopSendingFrame(r *bytes.Reader, _ protocol.VersionNumber) (*StopSend
 	if err != nil {
 		return nil, err
 	}
-	errorCode, err := utils.BigEndian.ReadUint16(r)
+	errorCode, err := readErrorCode(r, version)
 	if err != nil {
 		return nil, err
 	}
@@ -35,13 +35,13 @@ func parseStopSendingFrame(r *bytes.Reader, _ protocol.VersionNumber) (*StopSend
 }
 
 // Length of a written frame
-func (f *StopSendingFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
-	return 1 + utils.VarIntLen(uint64(f.StreamID)) + 2
+func (f *StopSendingFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
+	return 1 + utils.VarIntLen(uint64(f.StreamID)) + errorCodeLen(uint64(f.ErrorCode), version)
 }
 
-func (f *StopSendingFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+func (f *StopSendingFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
 	b.WriteByte(0x5)
 	utils.WriteVarInt(b, uint64(f.StreamID))
-	utils.BigEndian.WriteUint16(b, uint16(f.ErrorCode))
+	writeErrorCode(b, uint64(f.ErrorCode), version)
 	return nil
 }
@@ -60,4 +60,23 @@ var _ = Describe("STOP_SENDING frame", func() {
 			Expect(frame.Length(versionIETFFrames)).To(Equal(1 + 2 + utils.VarIntLen(0xdeadbeef)))
 		})
 	})
+
+	Context("in QUIC version 1", func() {
+		It("uses a variable-length integer for the error code", func() {
+			f := &StopSendingFrame{
+				StreamID:  0x1337,
+				ErrorCode: 0xdeadbeef,
+			}
+			b := &bytes.Buffer{}
+			Expect(f.Write(b, protocol.Version1)).To(Succeed())
+			expected := []byte{0x5}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			expected = append(expected, encodeVarInt(0xdeadbeef)...)
+			Expect(b.Bytes()).To(Equal(expected))
+			Expect(f.Length(protocol.Version1)).To(BeEquivalentTo(b.Len()))
+			frame, err := parseStopSendingFrame(bytes.NewReader(b.Bytes()), protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+	})
 })
@@ -76,7 +76,7 @@ var _ = Describe("STREAM frame", func() {
 			data = append(data, []byte("foobar")...)
 			r := bytes.NewReader(data)
 			_, err := parseStreamFrame(r, versionIETFFrames)
-			Expect(err).To(MatchError(qerr.Error(qerr.InvalidStreamData, "data overflows maximum offset")))
+			Expect(err).To(MatchError(qerr.Error(qerr.FrameEncodingError, "data overflows maximum offset")))
 		})
 
 		It("errors on EOFs", func() {
@@ -16,6 +16,10 @@ var _ = Describe("Version Negotiation Packets", func() {
 		data, err := ComposeVersionNegotiation(destConnID, srcConnID, versions)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(data[0] & 0x80).ToNot(BeZero())
+		// connection ID lengths are encoded in separate bytes
+		Expect(data[5]).To(BeEquivalentTo(8))
+		Expect(data[6:14]).To(Equal([]byte(destConnID)))
+		Expect(data[14]).To(BeEquivalentTo(8))
 		b := bytes.NewReader(data)
 		iHdr, err := ParseInvariantHeader(b, 4)
 		Expect(err).ToNot(HaveOccurred())
@@ -31,4 +35,15 @@ var _ = Describe("Version Negotiation Packets", func() {
 			Expect(hdr.SupportedVersions).To(ContainElement(version))
 		}
 	})
+
+	It("writes with connection IDs longer than 20 bytes", func() {
+		connID := protocol.ConnectionID(bytes.Repeat([]byte{0x42}, 25))
+		data, err := ComposeVersionNegotiation(connID, connID, []protocol.VersionNumber{1001})
+		Expect(err).ToNot(HaveOccurred())
+		b := bytes.NewReader(data)
+		iHdr, err := ParseInvariantHeader(b, 4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(iHdr.DestConnectionID).To(Equal(connID))
+		Expect(iHdr.SrcConnectionID).To(Equal(connID))
+	})
 })
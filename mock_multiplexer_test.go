@@ -35,14 +35,23 @@ func (m *MockMultiplexer) EXPECT() *MockMultiplexerMockRecorder {
 }
 
 // AddConn mocks base method
-func (m *MockMultiplexer) AddConn(arg0 net.PacketConn, arg1 int) (packetHandlerManager, error) {
-	ret := m.ctrl.Call(m, "AddConn", arg0, arg1)
+func (m *MockMultiplexer) AddConn(arg0 net.PacketConn) packetHandlerManager {
+	ret := m.ctrl.Call(m, "AddConn", arg0)
 	ret0, _ := ret[0].(packetHandlerManager)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	return ret0
 }
 
 // AddConn indicates an expected call of AddConn
-func (mr *MockMultiplexerMockRecorder) AddConn(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddConn", reflect.TypeOf((*MockMultiplexer)(nil).AddConn), arg0, arg1)
+func (mr *MockMultiplexerMockRecorder) AddConn(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddConn", reflect.TypeOf((*MockMultiplexer)(nil).AddConn), arg0)
+}
+
+// RemoveConn mocks base method
+func (m *MockMultiplexer) RemoveConn(arg0 net.PacketConn) {
+	m.ctrl.Call(m, "RemoveConn", arg0)
+}
+
+// RemoveConn indicates an expected call of RemoveConn
+func (mr *MockMultiplexerMockRecorder) RemoveConn(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveConn", reflect.TypeOf((*MockMultiplexer)(nil).RemoveConn), arg0)
 }
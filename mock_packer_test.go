@@ -96,6 +96,32 @@ func (mr *MockPackerMockRecorder) PackPacket() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PackPacket", reflect.TypeOf((*MockPacker)(nil).PackPacket))
 }
 
+// PackPathChallenge mocks base method
+func (m *MockPacker) PackPathChallenge(arg0 *wire.PathChallengeFrame, arg1 protocol.ConnectionID) (*packedPacket, error) {
+	ret := m.ctrl.Call(m, "PackPathChallenge", arg0, arg1)
+	ret0, _ := ret[0].(*packedPacket)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PackPathChallenge indicates an expected call of PackPathChallenge
+func (mr *MockPackerMockRecorder) PackPathChallenge(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PackPathChallenge", reflect.TypeOf((*MockPacker)(nil).PackPathChallenge), arg0, arg1)
+}
+
+// PackPathResponse mocks base method
+func (m *MockPacker) PackPathResponse(arg0 *wire.PathResponseFrame, arg1 protocol.ConnectionID) (*packedPacket, error) {
+	ret := m.ctrl.Call(m, "PackPathResponse", arg0, arg1)
+	ret0, _ := ret[0].(*packedPacket)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PackPathResponse indicates an expected call of PackPathResponse
+func (mr *MockPackerMockRecorder) PackPathResponse(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PackPathResponse", reflect.TypeOf((*MockPacker)(nil).PackPathResponse), arg0, arg1)
+}
+
 // PackRetransmission mocks base method
 func (m *MockPacker) PackRetransmission(arg0 *ackhandler.Packet) ([]*packedPacket, error) {
 	ret := m.ctrl.Call(m, "PackRetransmission", arg0)
@@ -64,6 +64,18 @@ func (mr *MockPacketHandlerManagerMockRecorder) Remove(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockPacketHandlerManager)(nil).Remove), arg0)
 }
 
+// Resume mocks base method
+func (m *MockPacketHandlerManager) Resume() bool {
+	ret := m.ctrl.Call(m, "Resume")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Resume indicates an expected call of Resume
+func (mr *MockPacketHandlerManagerMockRecorder) Resume() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockPacketHandlerManager)(nil).Resume))
+}
+
 // Retire mocks base method
 func (m *MockPacketHandlerManager) Retire(arg0 protocol.ConnectionID) {
 	m.ctrl.Call(m, "Retire", arg0)
@@ -83,3 +95,25 @@ func (m *MockPacketHandlerManager) SetServer(arg0 unknownPacketHandler) {
 func (mr *MockPacketHandlerManagerMockRecorder) SetServer(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetServer", reflect.TypeOf((*MockPacketHandlerManager)(nil).SetServer), arg0)
 }
+
+// Stop mocks base method
+func (m *MockPacketHandlerManager) Stop() {
+	m.ctrl.Call(m, "Stop")
+}
+
+// Stop indicates an expected call of Stop
+func (mr *MockPacketHandlerManagerMockRecorder) Stop() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockPacketHandlerManager)(nil).Stop))
+}
+
+// Stopped mocks base method
+func (m *MockPacketHandlerManager) Stopped() <-chan struct{} {
+	ret := m.ctrl.Call(m, "Stopped")
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Stopped indicates an expected call of Stopped
+func (mr *MockPacketHandlerManagerMockRecorder) Stopped() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stopped", reflect.TypeOf((*MockPacketHandlerManager)(nil).Stopped))
+}
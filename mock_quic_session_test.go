@@ -38,29 +38,29 @@ func (m *MockQuicSession) EXPECT() *MockQuicSessionMockRecorder {
 }
 
 // AcceptStream mocks base method
-func (m *MockQuicSession) AcceptStream() (Stream, error) {
-	ret := m.ctrl.Call(m, "AcceptStream")
+func (m *MockQuicSession) AcceptStream(arg0 context.Context) (Stream, error) {
+	ret := m.ctrl.Call(m, "AcceptStream", arg0)
 	ret0, _ := ret[0].(Stream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AcceptStream indicates an expected call of AcceptStream
-func (mr *MockQuicSessionMockRecorder) AcceptStream() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptStream", reflect.TypeOf((*MockQuicSession)(nil).AcceptStream))
+func (mr *MockQuicSessionMockRecorder) AcceptStream(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptStream", reflect.TypeOf((*MockQuicSession)(nil).AcceptStream), arg0)
 }
 
 // AcceptUniStream mocks base method
-func (m *MockQuicSession) AcceptUniStream() (ReceiveStream, error) {
-	ret := m.ctrl.Call(m, "AcceptUniStream")
+func (m *MockQuicSession) AcceptUniStream(arg0 context.Context) (ReceiveStream, error) {
+	ret := m.ctrl.Call(m, "AcceptUniStream", arg0)
 	ret0, _ := ret[0].(ReceiveStream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AcceptUniStream indicates an expected call of AcceptUniStream
-func (mr *MockQuicSessionMockRecorder) AcceptUniStream() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptUniStream", reflect.TypeOf((*MockQuicSession)(nil).AcceptUniStream))
+func (mr *MockQuicSessionMockRecorder) AcceptUniStream(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptUniStream", reflect.TypeOf((*MockQuicSession)(nil).AcceptUniStream), arg0)
 }
 
 // Close mocks base method
@@ -123,6 +123,42 @@ func (mr *MockQuicSessionMockRecorder) GetVersion() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersion", reflect.TypeOf((*MockQuicSession)(nil).GetVersion))
 }
 
+// HandshakeComplete mocks base method
+func (m *MockQuicSession) HandshakeComplete() context.Context {
+	ret := m.ctrl.Call(m, "HandshakeComplete")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// HandshakeComplete indicates an expected call of HandshakeComplete
+func (mr *MockQuicSessionMockRecorder) HandshakeComplete() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandshakeComplete", reflect.TypeOf((*MockQuicSession)(nil).HandshakeComplete))
+}
+
+// IncomingStreamCredit mocks base method
+func (m *MockQuicSession) IncomingStreamCredit() StreamCredit {
+	ret := m.ctrl.Call(m, "IncomingStreamCredit")
+	ret0, _ := ret[0].(StreamCredit)
+	return ret0
+}
+
+// IncomingStreamCredit indicates an expected call of IncomingStreamCredit
+func (mr *MockQuicSessionMockRecorder) IncomingStreamCredit() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncomingStreamCredit", reflect.TypeOf((*MockQuicSession)(nil).IncomingStreamCredit))
+}
+
+// IncomingUniStreamCredit mocks base method
+func (m *MockQuicSession) IncomingUniStreamCredit() StreamCredit {
+	ret := m.ctrl.Call(m, "IncomingUniStreamCredit")
+	ret0, _ := ret[0].(StreamCredit)
+	return ret0
+}
+
+// IncomingUniStreamCredit indicates an expected call of IncomingUniStreamCredit
+func (mr *MockQuicSessionMockRecorder) IncomingUniStreamCredit() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncomingUniStreamCredit", reflect.TypeOf((*MockQuicSession)(nil).IncomingUniStreamCredit))
+}
+
 // LocalAddr mocks base method
 func (m *MockQuicSession) LocalAddr() net.Addr {
 	ret := m.ctrl.Call(m, "LocalAddr")
@@ -135,6 +171,18 @@ func (mr *MockQuicSessionMockRecorder) LocalAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalAddr", reflect.TypeOf((*MockQuicSession)(nil).LocalAddr))
 }
 
+// Migrate mocks base method
+func (m *MockQuicSession) Migrate(arg0 context.Context, arg1 net.PacketConn) error {
+	ret := m.ctrl.Call(m, "Migrate", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Migrate indicates an expected call of Migrate
+func (mr *MockQuicSessionMockRecorder) Migrate(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Migrate", reflect.TypeOf((*MockQuicSession)(nil).Migrate), arg0, arg1)
+}
+
 // OpenStream mocks base method
 func (m *MockQuicSession) OpenStream() (Stream, error) {
 	ret := m.ctrl.Call(m, "OpenStream")
@@ -149,16 +197,16 @@ func (mr *MockQuicSessionMockRecorder) OpenStream() *gomock.Call {
 }
 
 // OpenStreamSync mocks base method
-func (m *MockQuicSession) OpenStreamSync() (Stream, error) {
-	ret := m.ctrl.Call(m, "OpenStreamSync")
+func (m *MockQuicSession) OpenStreamSync(arg0 context.Context) (Stream, error) {
+	ret := m.ctrl.Call(m, "OpenStreamSync", arg0)
 	ret0, _ := ret[0].(Stream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // OpenStreamSync indicates an expected call of OpenStreamSync
-func (mr *MockQuicSessionMockRecorder) OpenStreamSync() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenStreamSync", reflect.TypeOf((*MockQuicSession)(nil).OpenStreamSync))
+func (mr *MockQuicSessionMockRecorder) OpenStreamSync(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenStreamSync", reflect.TypeOf((*MockQuicSession)(nil).OpenStreamSync), arg0)
 }
 
 // OpenUniStream mocks base method
@@ -175,16 +223,16 @@ func (mr *MockQuicSessionMockRecorder) OpenUniStream() *gomock.Call {
 }
 
 // OpenUniStreamSync mocks base method
-func (m *MockQuicSession) OpenUniStreamSync() (SendStream, error) {
-	ret := m.ctrl.Call(m, "OpenUniStreamSync")
+func (m *MockQuicSession) OpenUniStreamSync(arg0 context.Context) (SendStream, error) {
+	ret := m.ctrl.Call(m, "OpenUniStreamSync", arg0)
 	ret0, _ := ret[0].(SendStream)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // OpenUniStreamSync indicates an expected call of OpenUniStreamSync
-func (mr *MockQuicSessionMockRecorder) OpenUniStreamSync() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockQuicSession)(nil).OpenUniStreamSync))
+func (mr *MockQuicSessionMockRecorder) OpenUniStreamSync(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockQuicSession)(nil).OpenUniStreamSync), arg0)
 }
 
 // RemoteAddr mocks base method
@@ -199,6 +247,36 @@ func (mr *MockQuicSessionMockRecorder) RemoteAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockQuicSession)(nil).RemoteAddr))
 }
 
+// SetMaxIncomingStreams mocks base method
+func (m *MockQuicSession) SetMaxIncomingStreams(arg0 int) {
+	m.ctrl.Call(m, "SetMaxIncomingStreams", arg0)
+}
+
+// SetMaxIncomingStreams indicates an expected call of SetMaxIncomingStreams
+func (mr *MockQuicSessionMockRecorder) SetMaxIncomingStreams(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingStreams", reflect.TypeOf((*MockQuicSession)(nil).SetMaxIncomingStreams), arg0)
+}
+
+// SetMaxIncomingUniStreams mocks base method
+func (m *MockQuicSession) SetMaxIncomingUniStreams(arg0 int) {
+	m.ctrl.Call(m, "SetMaxIncomingUniStreams", arg0)
+}
+
+// SetMaxIncomingUniStreams indicates an expected call of SetMaxIncomingUniStreams
+func (mr *MockQuicSessionMockRecorder) SetMaxIncomingUniStreams(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingUniStreams", reflect.TypeOf((*MockQuicSession)(nil).SetMaxIncomingUniStreams), arg0)
+}
+
+// closeLocal mocks base method
+func (m *MockQuicSession) closeLocal(arg0 error) {
+	m.ctrl.Call(m, "closeLocal", arg0)
+}
+
+// closeLocal indicates an expected call of closeLocal
+func (mr *MockQuicSessionMockRecorder) closeLocal(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeLocal", reflect.TypeOf((*MockQuicSession)(nil).closeLocal), arg0)
+}
+
 // closeRemote mocks base method
 func (m *MockQuicSession) closeRemote(arg0 error) {
 	m.ctrl.Call(m, "closeRemote", arg0)
@@ -5,6 +5,7 @@
 package quic
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
@@ -61,6 +62,32 @@ func (mr *MockReceiveStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockReceiveStreamI)(nil).Read), arg0)
 }
 
+// ReadChunk mocks base method
+func (m *MockReceiveStreamI) ReadChunk() (uint64, []byte, error) {
+	ret := m.ctrl.Call(m, "ReadChunk")
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadChunk indicates an expected call of ReadChunk
+func (mr *MockReceiveStreamIMockRecorder) ReadChunk() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChunk", reflect.TypeOf((*MockReceiveStreamI)(nil).ReadChunk))
+}
+
+// ReadContext mocks base method
+func (m *MockReceiveStreamI) ReadContext() context.Context {
+	ret := m.ctrl.Call(m, "ReadContext")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// ReadContext indicates an expected call of ReadContext
+func (mr *MockReceiveStreamIMockRecorder) ReadContext() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadContext", reflect.TypeOf((*MockReceiveStreamI)(nil).ReadContext))
+}
+
 // SetReadDeadline mocks base method
 func (m *MockReceiveStreamI) SetReadDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetReadDeadline", arg0)
@@ -107,6 +134,18 @@ func (mr *MockReceiveStreamIMockRecorder) getWindowUpdate() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getWindowUpdate", reflect.TypeOf((*MockReceiveStreamI)(nil).getWindowUpdate))
 }
 
+// handleResetStreamAtFrame mocks base method
+func (m *MockReceiveStreamI) handleResetStreamAtFrame(arg0 *wire.ResetStreamAtFrame) error {
+	ret := m.ctrl.Call(m, "handleResetStreamAtFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleResetStreamAtFrame indicates an expected call of handleResetStreamAtFrame
+func (mr *MockReceiveStreamIMockRecorder) handleResetStreamAtFrame(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleResetStreamAtFrame", reflect.TypeOf((*MockReceiveStreamI)(nil).handleResetStreamAtFrame), arg0)
+}
+
 // handleResetStreamFrame mocks base method
 func (m *MockReceiveStreamI) handleResetStreamFrame(arg0 *wire.ResetStreamFrame) error {
 	ret := m.ctrl.Call(m, "handleResetStreamFrame", arg0)
@@ -119,6 +158,16 @@ func (mr *MockReceiveStreamIMockRecorder) handleResetStreamFrame(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleResetStreamFrame", reflect.TypeOf((*MockReceiveStreamI)(nil).handleResetStreamFrame), arg0)
 }
 
+// handleStreamDataBlockedFrame mocks base method
+func (m *MockReceiveStreamI) handleStreamDataBlockedFrame(arg0 *wire.StreamDataBlockedFrame) {
+	m.ctrl.Call(m, "handleStreamDataBlockedFrame", arg0)
+}
+
+// handleStreamDataBlockedFrame indicates an expected call of handleStreamDataBlockedFrame
+func (mr *MockReceiveStreamIMockRecorder) handleStreamDataBlockedFrame(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamDataBlockedFrame", reflect.TypeOf((*MockReceiveStreamI)(nil).handleStreamDataBlockedFrame), arg0)
+}
+
 // handleStreamFrame mocks base method
 func (m *MockReceiveStreamI) handleStreamFrame(arg0 *wire.StreamFrame) error {
 	ret := m.ctrl.Call(m, "handleStreamFrame", arg0)
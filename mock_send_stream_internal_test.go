@@ -49,6 +49,18 @@ func (mr *MockSendStreamIMockRecorder) CancelWrite(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelWrite", reflect.TypeOf((*MockSendStreamI)(nil).CancelWrite), arg0)
 }
 
+// CancelWriteAt mocks base method
+func (m *MockSendStreamI) CancelWriteAt(arg0 protocol.ApplicationErrorCode, arg1 uint64) error {
+	ret := m.ctrl.Call(m, "CancelWriteAt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelWriteAt indicates an expected call of CancelWriteAt
+func (mr *MockSendStreamIMockRecorder) CancelWriteAt(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelWriteAt", reflect.TypeOf((*MockSendStreamI)(nil).CancelWriteAt), arg0, arg1)
+}
+
 // Close mocks base method
 func (m *MockSendStreamI) Close() error {
 	ret := m.ctrl.Call(m, "Close")
@@ -97,6 +109,19 @@ func (mr *MockSendStreamIMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockSendStreamI)(nil).StreamID))
 }
 
+// TryWrite mocks base method
+func (m *MockSendStreamI) TryWrite(arg0 []byte) (int, error) {
+	ret := m.ctrl.Call(m, "TryWrite", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TryWrite indicates an expected call of TryWrite
+func (mr *MockSendStreamIMockRecorder) TryWrite(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryWrite", reflect.TypeOf((*MockSendStreamI)(nil).TryWrite), arg0)
+}
+
 // Write mocks base method
 func (m *MockSendStreamI) Write(arg0 []byte) (int, error) {
 	ret := m.ctrl.Call(m, "Write", arg0)
@@ -5,6 +5,7 @@
 package quic
 
 import (
+	net "net"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,6 +35,28 @@ func (m *MockSessionRunner) EXPECT() *MockSessionRunnerMockRecorder {
 	return m.recorder
 }
 
+// addConnectionID mocks base method
+func (m *MockSessionRunner) addConnectionID(arg0 protocol.ConnectionID, arg1 quicSession) {
+	m.ctrl.Call(m, "addConnectionID", arg0, arg1)
+}
+
+// addConnectionID indicates an expected call of addConnectionID
+func (mr *MockSessionRunnerMockRecorder) addConnectionID(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addConnectionID", reflect.TypeOf((*MockSessionRunner)(nil).addConnectionID), arg0, arg1)
+}
+
+// addPacketConn mocks base method
+func (m *MockSessionRunner) addPacketConn(arg0 net.PacketConn) error {
+	ret := m.ctrl.Call(m, "addPacketConn", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// addPacketConn indicates an expected call of addPacketConn
+func (mr *MockSessionRunnerMockRecorder) addPacketConn(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addPacketConn", reflect.TypeOf((*MockSessionRunner)(nil).addPacketConn), arg0)
+}
+
 // onHandshakeComplete mocks base method
 func (m *MockSessionRunner) onHandshakeComplete(arg0 Session) {
 	m.ctrl.Call(m, "onHandshakeComplete", arg0)
@@ -54,6 +77,16 @@ func (mr *MockSessionRunnerMockRecorder) removeConnectionID(arg0 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "removeConnectionID", reflect.TypeOf((*MockSessionRunner)(nil).removeConnectionID), arg0)
 }
 
+// removePacketConn mocks base method
+func (m *MockSessionRunner) removePacketConn(arg0 net.PacketConn) {
+	m.ctrl.Call(m, "removePacketConn", arg0)
+}
+
+// removePacketConn indicates an expected call of removePacketConn
+func (mr *MockSessionRunnerMockRecorder) removePacketConn(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "removePacketConn", reflect.TypeOf((*MockSessionRunner)(nil).removePacketConn), arg0)
+}
+
 // retireConnectionID mocks base method
 func (m *MockSessionRunner) retireConnectionID(arg0 protocol.ConnectionID) {
 	m.ctrl.Call(m, "retireConnectionID", arg0)
@@ -61,6 +61,18 @@ func (mr *MockStreamIMockRecorder) CancelWrite(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelWrite", reflect.TypeOf((*MockStreamI)(nil).CancelWrite), arg0)
 }
 
+// CancelWriteAt mocks base method
+func (m *MockStreamI) CancelWriteAt(arg0 protocol.ApplicationErrorCode, arg1 uint64) error {
+	ret := m.ctrl.Call(m, "CancelWriteAt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelWriteAt indicates an expected call of CancelWriteAt
+func (mr *MockStreamIMockRecorder) CancelWriteAt(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelWriteAt", reflect.TypeOf((*MockStreamI)(nil).CancelWriteAt), arg0, arg1)
+}
+
 // Close mocks base method
 func (m *MockStreamI) Close() error {
 	ret := m.ctrl.Call(m, "Close")
@@ -98,6 +110,32 @@ func (mr *MockStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockStreamI)(nil).Read), arg0)
 }
 
+// ReadChunk mocks base method
+func (m *MockStreamI) ReadChunk() (uint64, []byte, error) {
+	ret := m.ctrl.Call(m, "ReadChunk")
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadChunk indicates an expected call of ReadChunk
+func (mr *MockStreamIMockRecorder) ReadChunk() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChunk", reflect.TypeOf((*MockStreamI)(nil).ReadChunk))
+}
+
+// ReadContext mocks base method
+func (m *MockStreamI) ReadContext() context.Context {
+	ret := m.ctrl.Call(m, "ReadContext")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// ReadContext indicates an expected call of ReadContext
+func (mr *MockStreamIMockRecorder) ReadContext() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadContext", reflect.TypeOf((*MockStreamI)(nil).ReadContext))
+}
+
 // SetDeadline mocks base method
 func (m *MockStreamI) SetDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetDeadline", arg0)
@@ -146,6 +184,19 @@ func (mr *MockStreamIMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockStreamI)(nil).StreamID))
 }
 
+// TryWrite mocks base method
+func (m *MockStreamI) TryWrite(arg0 []byte) (int, error) {
+	ret := m.ctrl.Call(m, "TryWrite", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TryWrite indicates an expected call of TryWrite
+func (mr *MockStreamIMockRecorder) TryWrite(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryWrite", reflect.TypeOf((*MockStreamI)(nil).TryWrite), arg0)
+}
+
 // Write mocks base method
 func (m *MockStreamI) Write(arg0 []byte) (int, error) {
 	ret := m.ctrl.Call(m, "Write", arg0)
@@ -191,6 +242,18 @@ func (mr *MockStreamIMockRecorder) handleMaxStreamDataFrame(arg0 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleMaxStreamDataFrame", reflect.TypeOf((*MockStreamI)(nil).handleMaxStreamDataFrame), arg0)
 }
 
+// handleResetStreamAtFrame mocks base method
+func (m *MockStreamI) handleResetStreamAtFrame(arg0 *wire.ResetStreamAtFrame) error {
+	ret := m.ctrl.Call(m, "handleResetStreamAtFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// handleResetStreamAtFrame indicates an expected call of handleResetStreamAtFrame
+func (mr *MockStreamIMockRecorder) handleResetStreamAtFrame(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleResetStreamAtFrame", reflect.TypeOf((*MockStreamI)(nil).handleResetStreamAtFrame), arg0)
+}
+
 // handleResetStreamFrame mocks base method
 func (m *MockStreamI) handleResetStreamFrame(arg0 *wire.ResetStreamFrame) error {
 	ret := m.ctrl.Call(m, "handleResetStreamFrame", arg0)
@@ -213,6 +276,16 @@ func (mr *MockStreamIMockRecorder) handleStopSendingFrame(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStopSendingFrame", reflect.TypeOf((*MockStreamI)(nil).handleStopSendingFrame), arg0)
 }
 
+// handleStreamDataBlockedFrame mocks base method
+func (m *MockStreamI) handleStreamDataBlockedFrame(arg0 *wire.StreamDataBlockedFrame) {
+	m.ctrl.Call(m, "handleStreamDataBlockedFrame", arg0)
+}
+
+// handleStreamDataBlockedFrame indicates an expected call of handleStreamDataBlockedFrame
+func (mr *MockStreamIMockRecorder) handleStreamDataBlockedFrame(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamDataBlockedFrame", reflect.TypeOf((*MockStreamI)(nil).handleStreamDataBlockedFrame), arg0)
+}
+
 // handleStreamFrame mocks base method
 func (m *MockStreamI) handleStreamFrame(arg0 *wire.StreamFrame) error {
 	ret := m.ctrl.Call(m, "handleStreamFrame", arg0)
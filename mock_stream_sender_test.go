@@ -55,6 +55,16 @@ func (mr *MockStreamSenderMockRecorder) onStreamCompleted(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onStreamCompleted", reflect.TypeOf((*MockStreamSender)(nil).onStreamCompleted), arg0)
 }
 
+// onStreamReset mocks base method
+func (m *MockStreamSender) onStreamReset(arg0 protocol.StreamID, arg1 protocol.ByteCount) {
+	m.ctrl.Call(m, "onStreamReset", arg0, arg1)
+}
+
+// onStreamReset indicates an expected call of onStreamReset
+func (mr *MockStreamSenderMockRecorder) onStreamReset(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onStreamReset", reflect.TypeOf((*MockStreamSender)(nil).onStreamReset), arg0, arg1)
+}
+
 // queueControlFrame mocks base method
 func (m *MockStreamSender) queueControlFrame(arg0 wire.Frame) {
 	m.ctrl.Call(m, "queueControlFrame", arg0)
@@ -1,7 +1,6 @@
 package quic
 
 import (
-	"fmt"
 	"net"
 	"sync"
 
@@ -14,21 +13,27 @@ var (
 )
 
 type multiplexer interface {
-	AddConn(net.PacketConn, int) (packetHandlerManager, error)
+	AddConn(net.PacketConn) packetHandlerManager
+	RemoveConn(net.PacketConn)
 }
 
 type connManager struct {
-	connIDLen int
-	manager   packetHandlerManager
+	manager packetHandlerManager
+	// the number of clients and servers using this conn
+	refCount int
 }
 
 // The connMultiplexer listens on multiple net.PacketConns and dispatches
 // incoming packets to the session handler.
+// Clients and servers using different connection ID lengths can share a net.PacketConn.
 type connMultiplexer struct {
 	mutex sync.Mutex
 
-	conns                   map[net.PacketConn]connManager
-	newPacketHandlerManager func(net.PacketConn, int, utils.Logger) packetHandlerManager // so it can be replaced in the tests
+	conns map[net.PacketConn]*connManager
+	// conns that were removed, but whose packet handler manager didn't stop reading yet
+	stopping map[net.PacketConn]*connManager
+
+	newPacketHandlerManager func(net.PacketConn, utils.Logger) packetHandlerManager // so it can be replaced in the tests
 
 	logger utils.Logger
 }
@@ -38,7 +43,8 @@ var _ multiplexer = &connMultiplexer{}
 func getMultiplexer() multiplexer {
 	connMuxerOnce.Do(func() {
 		connMuxer = &connMultiplexer{
-			conns:                   make(map[net.PacketConn]connManager),
+			conns:                   make(map[net.PacketConn]*connManager),
+			stopping:                make(map[net.PacketConn]*connManager),
 			logger:                  utils.DefaultLogger.WithPrefix("muxer"),
 			newPacketHandlerManager: newPacketHandlerMap,
 		}
@@ -46,18 +52,69 @@ func getMultiplexer() multiplexer {
 	return connMuxer
 }
 
-func (m *connMultiplexer) AddConn(c net.PacketConn, connIDLen int) (packetHandlerManager, error) {
+// AddConn returns the packet handler manager for a packet conn.
+// Every call to AddConn must be followed by a call to RemoveConn,
+// once the packet conn is not used any more.
+func (m *connMultiplexer) AddConn(c net.PacketConn) packetHandlerManager {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for {
+		if p, ok := m.conns[c]; ok {
+			p.refCount++
+			return p.manager
+		}
+		p, ok := m.stopping[c]
+		if !ok {
+			break
+		}
+		// Only one packet handler manager can read from a conn at a time.
+		// If the old one is still reading, continue using it.
+		if p.manager.Resume() {
+			delete(m.stopping, c)
+			p.refCount = 1
+			m.conns[c] = p
+			return p.manager
+		}
+		// The old packet handler manager is about to stop reading.
+		m.mutex.Unlock()
+		<-p.manager.Stopped()
+		m.mutex.Lock()
+		if m.stopping[c] == p {
+			delete(m.stopping, c)
+		}
+	}
+
+	p := &connManager{manager: m.newPacketHandlerManager(c, m.logger), refCount: 1}
+	m.conns[c] = p
+	return p.manager
+}
+
+// RemoveConn releases a packet conn.
+// When it was released by all clients and servers that added it,
+// the packet handler manager stops reading from the conn.
+// It doesn't block: the packet handler manager stops reading once the pending read on the conn returns.
+func (m *connMultiplexer) RemoveConn(c net.PacketConn) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	p, ok := m.conns[c]
 	if !ok {
-		manager := m.newPacketHandlerManager(c, connIDLen, m.logger)
-		p = connManager{connIDLen: connIDLen, manager: manager}
-		m.conns[c] = p
+		return
 	}
-	if p.connIDLen != connIDLen {
-		return nil, fmt.Errorf("cannot use %d byte connection IDs on a connection that is already using %d byte connction IDs", connIDLen, p.connIDLen)
+	p.refCount--
+	if p.refCount > 0 {
+		return
 	}
-	return p.manager, nil
+	delete(m.conns, c)
+	m.stopping[c] = p
+	p.manager.Stop()
+	go func() {
+		<-p.manager.Stopped()
+		m.mutex.Lock()
+		if m.stopping[c] == p {
+			delete(m.stopping, c)
+		}
+		m.mutex.Unlock()
+	}()
 }
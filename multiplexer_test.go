@@ -1,6 +1,9 @@
 package quic
 
 import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -8,16 +11,117 @@ import (
 var _ = Describe("Client Multiplexer", func() {
 	It("adds a new packet conn ", func() {
 		conn := newMockPacketConn()
-		_, err := getMultiplexer().AddConn(conn, 8)
-		Expect(err).ToNot(HaveOccurred())
+		Expect(getMultiplexer().AddConn(conn)).ToNot(BeNil())
+		getMultiplexer().RemoveConn(conn)
 	})
 
-	It("errors when adding an existing conn with a different connection ID length", func() {
+	It("returns the same packet handler manager when adding an existing conn", func() {
 		conn := newMockPacketConn()
-		_, err := getMultiplexer().AddConn(conn, 5)
-		Expect(err).ToNot(HaveOccurred())
-		_, err = getMultiplexer().AddConn(conn, 6)
-		Expect(err).To(MatchError("cannot use 6 byte connection IDs on a connection that is already using 5 byte connction IDs"))
+		manager := getMultiplexer().AddConn(conn)
+		Expect(getMultiplexer().AddConn(conn)).To(Equal(manager))
+		getMultiplexer().RemoveConn(conn)
+		getMultiplexer().RemoveConn(conn)
 	})
 
+	Context("removing conns", func() {
+		var (
+			muxer       *connMultiplexer
+			manager     *MockPacketHandlerManager
+			numManagers int
+			stopped     chan struct{}
+		)
+
+		BeforeEach(func() {
+			numManagers = 0
+			stopped = make(chan struct{})
+			manager = NewMockPacketHandlerManager(mockCtrl)
+			manager.EXPECT().Stopped().Return((<-chan struct{})(stopped)).AnyTimes()
+			muxer = &connMultiplexer{
+				conns:    make(map[net.PacketConn]*connManager),
+				stopping: make(map[net.PacketConn]*connManager),
+				logger:   utils.DefaultLogger,
+				newPacketHandlerManager: func(net.PacketConn, utils.Logger) packetHandlerManager {
+					numManagers++
+					return manager
+				},
+			}
+		})
+
+		getNumStopping := func() int {
+			muxer.mutex.Lock()
+			defer muxer.mutex.Unlock()
+			return len(muxer.stopping)
+		}
+
+		It("stops the packet handler manager when the last user removes the conn", func() {
+			conn := newMockPacketConn()
+			muxer.AddConn(conn)
+			muxer.AddConn(conn)
+			muxer.RemoveConn(conn)
+			Expect(muxer.conns).To(HaveKey(conn))
+			manager.EXPECT().Stop()
+			muxer.RemoveConn(conn)
+			Expect(muxer.conns).To(BeEmpty())
+			// the conn is only released once the packet handler manager stopped reading
+			Consistently(getNumStopping).Should(Equal(1))
+			close(stopped)
+			Eventually(getNumStopping).Should(BeZero())
+		})
+
+		It("creates a new packet handler manager when a removed conn is added again", func() {
+			conn := newMockPacketConn()
+			muxer.AddConn(conn)
+			manager.EXPECT().Stop()
+			muxer.RemoveConn(conn)
+			close(stopped)
+			Eventually(getNumStopping).Should(BeZero())
+			muxer.AddConn(conn)
+			Expect(muxer.conns).To(HaveKey(conn))
+			Expect(numManagers).To(Equal(2))
+		})
+
+		It("continues using the packet handler manager if it didn't stop reading yet", func() {
+			conn := newMockPacketConn()
+			muxer.AddConn(conn)
+			manager.EXPECT().Stop()
+			muxer.RemoveConn(conn)
+			manager.EXPECT().Resume().Return(true)
+			Expect(muxer.AddConn(conn)).To(Equal(manager))
+			Expect(muxer.conns).To(HaveKey(conn))
+			Expect(muxer.stopping).To(BeEmpty())
+			Expect(numManagers).To(Equal(1))
+			// the go routine waiting for the old manager doesn't remove the conn
+			close(stopped)
+			Consistently(func() int {
+				muxer.mutex.Lock()
+				defer muxer.mutex.Unlock()
+				return len(muxer.conns)
+			}).Should(Equal(1))
+		})
+
+		It("waits for the packet handler manager to stop reading before creating a new one", func() {
+			conn := newMockPacketConn()
+			muxer.AddConn(conn)
+			manager.EXPECT().Stop()
+			muxer.RemoveConn(conn)
+			manager.EXPECT().Resume().Return(false)
+			added := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				muxer.AddConn(conn)
+				close(added)
+			}()
+			Consistently(added).ShouldNot(BeClosed())
+			// other conns are not blocked in the meantime
+			muxer.AddConn(newMockPacketConn())
+			close(stopped)
+			Eventually(added).Should(BeClosed())
+			Expect(numManagers).To(Equal(3))
+			Expect(getNumStopping()).To(BeZero())
+		})
+
+		It("ignores conns that were never added", func() {
+			muxer.RemoveConn(newMockPacketConn())
+		})
+	})
 })
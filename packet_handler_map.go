@@ -2,9 +2,9 @@ package quic
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -22,17 +22,29 @@ type packetHandlerEntry struct {
 // It is used:
 // * by the server to store sessions
 // * when multiplexing outgoing connections to store clients
+// The packet handlers may use connection IDs of different lengths.
 type packetHandlerMap struct {
 	mutex sync.RWMutex
 
-	conn      net.PacketConn
-	connIDLen int
+	conn net.PacketConn
 
 	handlers    map[string] /* string(ConnectionID)*/ packetHandlerEntry
 	resetTokens map[[16]byte] /* stateless reset token */ packetHandler
 	server      unknownPacketHandler
 	closed      bool
 
+	// the lengths of the connection IDs in use, sorted in descending order
+	connIDLens []int
+	// the number of connection IDs in use, per length
+	numConnIDs map[int]int
+
+	// stopped is set when the packet handler map stops listening, without closing the packet handlers
+	stopped bool
+	// exiting is set when the listen go routine is about to return, after it was stopped
+	exiting bool
+	// listening is closed when the listen go routine returns
+	listening chan struct{}
+
 	deleteRetiredSessionsAfter time.Duration
 
 	logger utils.Logger
@@ -40,12 +52,13 @@ type packetHandlerMap struct {
 
 var _ packetHandlerManager = &packetHandlerMap{}
 
-func newPacketHandlerMap(conn net.PacketConn, connIDLen int, logger utils.Logger) packetHandlerManager {
+func newPacketHandlerMap(conn net.PacketConn, logger utils.Logger) packetHandlerManager {
 	m := &packetHandlerMap{
 		conn:                       conn,
-		connIDLen:                  connIDLen,
 		handlers:                   make(map[string]packetHandlerEntry),
 		resetTokens:                make(map[[16]byte]packetHandler),
+		numConnIDs:                 make(map[int]int),
+		listening:                  make(chan struct{}),
 		deleteRetiredSessionsAfter: protocol.RetiredConnectionIDDeleteTimeout,
 		logger:                     logger,
 	}
@@ -55,17 +68,29 @@ func newPacketHandlerMap(conn net.PacketConn, connIDLen int, logger utils.Logger
 
 func (h *packetHandlerMap) Add(id protocol.ConnectionID, handler packetHandler) {
 	h.mutex.Lock()
-	h.handlers[string(id)] = packetHandlerEntry{handler: handler}
+	h.addHandler(id, packetHandlerEntry{handler: handler})
 	h.mutex.Unlock()
 }
 
 func (h *packetHandlerMap) AddWithResetToken(id protocol.ConnectionID, handler packetHandler, token [16]byte) {
 	h.mutex.Lock()
-	h.handlers[string(id)] = packetHandlerEntry{handler: handler, resetToken: &token}
+	h.addHandler(id, packetHandlerEntry{handler: handler, resetToken: &token})
 	h.resetTokens[token] = handler
 	h.mutex.Unlock()
 }
 
+// addHandler adds a packet handler. It must be called with the mutex held.
+func (h *packetHandlerMap) addHandler(id protocol.ConnectionID, entry packetHandlerEntry) {
+	if _, ok := h.handlers[string(id)]; !ok {
+		if h.numConnIDs[id.Len()] == 0 {
+			h.connIDLens = append(h.connIDLens, id.Len())
+			sort.Sort(sort.Reverse(sort.IntSlice(h.connIDLens)))
+		}
+		h.numConnIDs[id.Len()]++
+	}
+	h.handlers[string(id)] = entry
+}
+
 func (h *packetHandlerMap) Remove(id protocol.ConnectionID) {
 	h.removeByConnectionIDAsString(string(id))
 }
@@ -77,6 +102,16 @@ func (h *packetHandlerMap) removeByConnectionIDAsString(id string) {
 			delete(h.resetTokens, *token)
 		}
 		delete(h.handlers, id)
+		h.numConnIDs[len(id)]--
+		if h.numConnIDs[len(id)] == 0 {
+			delete(h.numConnIDs, len(id))
+			for i, l := range h.connIDLens {
+				if l == len(id) {
+					h.connIDLens = append(h.connIDLens[:i], h.connIDLens[i+1:]...)
+					break
+				}
+			}
+		}
 	}
 	h.mutex.Unlock()
 }
@@ -142,13 +177,55 @@ func (h *packetHandlerMap) close(e error) error {
 	return nil
 }
 
+// Stop stops reading from the conn, without closing it, and without closing the packet handlers.
+// It is used when the conn is not used by any client or server any more.
+// It doesn't block. The conn might be owned by the application, so its read deadline is not modified:
+// The listen go routine returns once the pending ReadFrom call returns, dropping the packet that it read.
+// Stopped returns a channel that is closed when the listen go routine has returned.
+func (h *packetHandlerMap) Stop() {
+	h.mutex.Lock()
+	h.stopped = true
+	h.mutex.Unlock()
+}
+
+// Resume undoes a Stop, if the listen go routine didn't return yet.
+// It returns false if the listen go routine returned (or is about to return).
+func (h *packetHandlerMap) Resume() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.exiting {
+		return false
+	}
+	h.stopped = false
+	return true
+}
+
+func (h *packetHandlerMap) Stopped() <-chan struct{} {
+	return h.listening
+}
+
+// shouldStop is called by the listen go routine after every ReadFrom call.
+// Once it returns true, the packet handler map can't be resumed any more.
+func (h *packetHandlerMap) shouldStop() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.stopped {
+		h.exiting = true
+	}
+	return h.exiting
+}
+
 func (h *packetHandlerMap) listen() {
+	defer close(h.listening)
 	for {
 		data := *getPacketBuffer()
 		data = data[:protocol.MaxReceivePacketSize]
 		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
 		// If it does, we only read a truncated packet, which will then end up undecryptable
 		n, addr, err := h.conn.ReadFrom(data)
+		if h.shouldStop() {
+			return
+		}
 		if err != nil {
 			h.close(err)
 			return
@@ -161,11 +238,31 @@ func (h *packetHandlerMap) listen() {
 	}
 }
 
+// shortHeaderConnIDLen determines the length of the connection ID of a short header packet.
+// Since the packet handlers might use connection IDs of different lengths,
+// it tries the lengths of all connection IDs in use, starting with the longest one.
+func (h *packetHandlerMap) shortHeaderConnIDLen(data []byte) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if len(data) == 0 || data[0]&0x80 > 0 || len(h.connIDLens) == 0 {
+		return 0
+	}
+	for _, l := range h.connIDLens {
+		if len(data) <= l {
+			continue
+		}
+		if _, ok := h.handlers[string(data[1:1+l])]; ok {
+			return l
+		}
+	}
+	return h.connIDLens[0]
+}
+
 func (h *packetHandlerMap) handlePacket(addr net.Addr, data []byte) error {
 	rcvTime := time.Now()
 
 	r := bytes.NewReader(data)
-	iHdr, err := wire.ParseInvariantHeader(r, h.connIDLen)
+	iHdr, err := wire.ParseInvariantHeader(r, h.shortHeaderConnIDLen(data))
 	// drop the packet if we can't parse the header
 	if err != nil {
 		return fmt.Errorf("error parsing invariant header: %s", err)
@@ -191,7 +288,7 @@ func (h *packetHandlerMap) handlePacket(addr net.Addr, data []byte) error {
 				copy(token[:], data[len(data)-16:])
 				if sess, ok := h.resetTokens[token]; ok {
 					h.mutex.RUnlock()
-					sess.destroy(errors.New("received a stateless reset"))
+					sess.destroy(&StatelessResetError{Token: token})
 					return nil
 				}
 			}
@@ -227,6 +324,7 @@ func (h *packetHandlerMap) handlePacket(addr net.Addr, data []byte) error {
 	}
 
 	handlePacket(&receivedPacket{
+		conn:       h.conn,
 		remoteAddr: addr,
 		header:     hdr,
 		data:       packetData,
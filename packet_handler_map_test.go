@@ -27,15 +27,15 @@ var _ = Describe("Packet Handler Map", func() {
 			DestConnectionID: connID,
 			PacketNumberLen:  protocol.PacketNumberLen1,
 			Length:           1,
-			Version:          protocol.VersionWhatever,
-		}).Write(buf, protocol.PerspectiveServer, protocol.VersionWhatever)
+			Version:          protocol.VersionTLS,
+		}).Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 		return buf.Bytes()
 	}
 
 	BeforeEach(func() {
 		conn = newMockPacketConn()
-		handler = newPacketHandlerMap(conn, 5, utils.DefaultLogger).(*packetHandlerMap)
+		handler = newPacketHandlerMap(conn, utils.DefaultLogger).(*packetHandlerMap)
 	})
 
 	It("closes", func() {
@@ -83,7 +83,55 @@ var _ = Describe("Packet Handler Map", func() {
 			close(conn.dataToRead)
 		})
 
+		It("handles short header packets for packet handlers using different connection ID lengths", func() {
+			getShortHeaderPacket := func(connID protocol.ConnectionID) []byte {
+				buf := &bytes.Buffer{}
+				Expect((&wire.Header{
+					DestConnectionID: connID,
+					PacketNumberLen:  protocol.PacketNumberLen1,
+				}).Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+				buf.Write(bytes.Repeat([]byte{0}, 50))
+				return buf.Bytes()
+			}
+
+			connID1 := protocol.ConnectionID{1, 2, 3, 4}
+			connID2 := protocol.ConnectionID{5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+			// starts with connID1, but is longer
+			connID3 := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			packetHandler1 := NewMockPacketHandler(mockCtrl)
+			packetHandler2 := NewMockPacketHandler(mockCtrl)
+			packetHandler3 := NewMockPacketHandler(mockCtrl)
+			for i, ph := range []*MockPacketHandler{packetHandler1, packetHandler2, packetHandler3} {
+				connID := []protocol.ConnectionID{connID1, connID2, connID3}[i]
+				ph.EXPECT().GetVersion().Return(protocol.VersionTLS)
+				ph.EXPECT().GetPerspective().Return(protocol.PerspectiveClient)
+				ph.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+					Expect(p.header.DestConnectionID).To(Equal(connID))
+				})
+			}
+			handler.Add(connID1, packetHandler1)
+			handler.Add(connID2, packetHandler2)
+			handler.Add(connID3, packetHandler3)
+			Expect(handler.handlePacket(nil, getShortHeaderPacket(connID1))).To(Succeed())
+			Expect(handler.handlePacket(nil, getShortHeaderPacket(connID2))).To(Succeed())
+			Expect(handler.handlePacket(nil, getShortHeaderPacket(connID3))).To(Succeed())
+		})
+
+		It("forgets connection ID lengths that are not used any more", func() {
+			handler.Add(protocol.ConnectionID{1, 2, 3, 4}, NewMockPacketHandler(mockCtrl))
+			handler.Add(protocol.ConnectionID{4, 3, 2, 1}, NewMockPacketHandler(mockCtrl))
+			handler.Add(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}, NewMockPacketHandler(mockCtrl))
+			Expect(handler.connIDLens).To(Equal([]int{8, 4}))
+			handler.Remove(protocol.ConnectionID{1, 2, 3, 4})
+			Expect(handler.connIDLens).To(Equal([]int{8, 4}))
+			handler.Remove(protocol.ConnectionID{4, 3, 2, 1})
+			Expect(handler.connIDLens).To(Equal([]int{8}))
+			handler.Remove(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8})
+			Expect(handler.connIDLens).To(BeEmpty())
+		})
+
 		It("drops unparseable packets", func() {
+			handler.Add(protocol.ConnectionID{1, 2, 3, 4, 5}, NewMockPacketHandler(mockCtrl))
 			err := handler.handlePacket(nil, []byte{0, 1, 2, 3})
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error parsing invariant header:"))
@@ -110,7 +158,7 @@ var _ = Describe("Packet Handler Map", func() {
 			handler.deleteRetiredSessionsAfter = time.Hour
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			packetHandler := NewMockPacketHandler(mockCtrl)
-			packetHandler.EXPECT().GetVersion().Return(protocol.VersionWhatever)
+			packetHandler.EXPECT().GetVersion().Return(protocol.VersionTLS)
 			packetHandler.EXPECT().GetPerspective().Return(protocol.PerspectiveClient)
 			packetHandler.EXPECT().handlePacket(gomock.Any())
 			handler.Add(connID, packetHandler)
@@ -128,7 +176,7 @@ var _ = Describe("Packet Handler Map", func() {
 		It("errors on packets that are smaller than the length in the packet header", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			packetHandler := NewMockPacketHandler(mockCtrl)
-			packetHandler.EXPECT().GetVersion().Return(protocol.VersionWhatever)
+			packetHandler.EXPECT().GetVersion().Return(protocol.VersionTLS)
 			packetHandler.EXPECT().GetPerspective().Return(protocol.PerspectiveClient)
 			handler.Add(connID, packetHandler)
 			hdr := &wire.Header{
@@ -137,10 +185,10 @@ var _ = Describe("Packet Handler Map", func() {
 				Length:           1000,
 				DestConnectionID: connID,
 				PacketNumberLen:  protocol.PacketNumberLen2,
-				Version:          protocol.VersionWhatever,
+				Version:          protocol.VersionTLS,
 			}
 			buf := &bytes.Buffer{}
-			Expect(hdr.Write(buf, protocol.PerspectiveServer, protocol.VersionWhatever)).To(Succeed())
+			Expect(hdr.Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 			buf.Write(bytes.Repeat([]byte{0}, 500-2 /* for packet number length */))
 
 			err := handler.handlePacket(nil, buf.Bytes())
@@ -150,7 +198,7 @@ var _ = Describe("Packet Handler Map", func() {
 		It("errors when receiving a packet that has a length smaller than the packet number length", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			packetHandler := NewMockPacketHandler(mockCtrl)
-			packetHandler.EXPECT().GetVersion().Return(protocol.VersionWhatever)
+			packetHandler.EXPECT().GetVersion().Return(protocol.VersionTLS)
 			packetHandler.EXPECT().GetPerspective().Return(protocol.PerspectiveClient)
 			handler.Add(connID, packetHandler)
 			hdr := &wire.Header{
@@ -159,17 +207,17 @@ var _ = Describe("Packet Handler Map", func() {
 				Length:           3,
 				DestConnectionID: connID,
 				PacketNumberLen:  protocol.PacketNumberLen4,
-				Version:          protocol.VersionWhatever,
+				Version:          protocol.VersionTLS,
 			}
 			buf := &bytes.Buffer{}
-			Expect(hdr.Write(buf, protocol.PerspectiveServer, protocol.VersionWhatever)).To(Succeed())
+			Expect(hdr.Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 			Expect(handler.handlePacket(nil, buf.Bytes())).To(MatchError("packet length (3 bytes) shorter than packet number (4 bytes)"))
 		})
 
 		It("cuts packets to the right length", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			packetHandler := NewMockPacketHandler(mockCtrl)
-			packetHandler.EXPECT().GetVersion().Return(protocol.VersionWhatever)
+			packetHandler.EXPECT().GetVersion().Return(protocol.VersionTLS)
 			packetHandler.EXPECT().GetPerspective().Return(protocol.PerspectiveClient)
 			handler.Add(connID, packetHandler)
 			packetHandler.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
@@ -182,10 +230,10 @@ var _ = Describe("Packet Handler Map", func() {
 				Length:           456,
 				DestConnectionID: connID,
 				PacketNumberLen:  protocol.PacketNumberLen1,
-				Version:          protocol.VersionWhatever,
+				Version:          protocol.VersionTLS,
 			}
 			buf := &bytes.Buffer{}
-			Expect(hdr.Write(buf, protocol.PerspectiveServer, protocol.VersionWhatever)).To(Succeed())
+			Expect(hdr.Write(buf, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 			buf.Write(bytes.Repeat([]byte{0}, 500))
 			Expect(handler.handlePacket(nil, buf.Bytes())).To(Succeed())
 		})
@@ -203,6 +251,34 @@ var _ = Describe("Packet Handler Map", func() {
 		})
 	})
 
+	It("stops listening without closing the packet handlers", func() {
+		packetHandler := NewMockPacketHandler(mockCtrl)
+		handler.Add(protocol.ConnectionID{1, 2, 3, 4}, packetHandler)
+		handler.Stop()
+		// the read deadline of the conn is not modified
+		Consistently(handler.Stopped()).ShouldNot(BeClosed())
+		// the listen go routine returns when the next ReadFrom call returns
+		conn.dataToRead <- []byte("foobar")
+		Eventually(handler.Stopped()).Should(BeClosed())
+		Expect(conn.closed).To(BeFalse())
+		Expect(handler.Resume()).To(BeFalse())
+	})
+
+	It("continues listening when resumed before the listen go routine returned", func() {
+		handler.Stop()
+		Expect(handler.Resume()).To(BeTrue())
+		packetHandler := NewMockPacketHandler(mockCtrl)
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		handler.Add(connID, packetHandler)
+		handled := make(chan struct{})
+		packetHandler.EXPECT().GetPerspective().AnyTimes()
+		packetHandler.EXPECT().GetVersion().AnyTimes()
+		packetHandler.EXPECT().handlePacket(gomock.Any()).Do(func(*receivedPacket) { close(handled) })
+		conn.dataToRead <- getPacket(connID)
+		Eventually(handled).Should(BeClosed())
+		Expect(handler.Stopped()).ToNot(BeClosed())
+	})
+
 	Context("stateless reset handling", func() {
 		It("handles packets for connections added with a reset token", func() {
 			packetHandler := NewMockPacketHandler(mockCtrl)
@@ -229,7 +305,7 @@ var _ = Describe("Packet Handler Map", func() {
 			packet := append([]byte{0x40} /* short header packet */, make([]byte, 50)...)
 			packet = append(packet, token[:]...)
 			destroyed := make(chan struct{})
-			packetHandler.EXPECT().destroy(errors.New("received a stateless reset")).Do(func(error) {
+			packetHandler.EXPECT().destroy(&StatelessResetError{Token: token}).Do(func(error) {
 				close(destroyed)
 			})
 			conn.dataToRead <- packet
@@ -246,7 +322,8 @@ var _ = Describe("Packet Handler Map", func() {
 			Expect(handler.handlePacket(nil, getPacket(connID))).To(MatchError("received a packet with an unexpected connection ID 0xdeadbeef42"))
 			packet := append([]byte{0x40, 0xde, 0xca, 0xfb, 0xad, 0x99} /* short header packet */, make([]byte, 50)...)
 			packet = append(packet, token[:]...)
-			Expect(handler.handlePacket(nil, packet)).To(MatchError("received a short header packet with an unexpected connection ID 0xdecafbad99"))
+			// no connection IDs are in use any more, so the connection ID length is unknown
+			Expect(handler.handlePacket(nil, packet)).To(MatchError("received a short header packet with an unexpected connection ID (empty)"))
 			Expect(handler.resetTokens).To(BeEmpty())
 		})
 	})
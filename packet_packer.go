@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -19,6 +20,8 @@ type packer interface {
 	MaybePackAckPacket() (*packedPacket, error)
 	PackRetransmission(packet *ackhandler.Packet) ([]*packedPacket, error)
 	PackConnectionClose(*wire.ConnectionCloseFrame) (*packedPacket, error)
+	PackPathChallenge(*wire.PathChallengeFrame, protocol.ConnectionID) (*packedPacket, error)
+	PackPathResponse(*wire.PathResponseFrame, protocol.ConnectionID) (*packedPacket, error)
 
 	HandleTransportParameters(*handshake.TransportParameters)
 	ChangeDestConnectionID(protocol.ConnectionID)
@@ -146,6 +149,36 @@ func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*pac
 	}, err
 }
 
+// PackPathChallenge packs a packet that ONLY contains a PathChallengeFrame.
+// It is used to probe a new path, so it must not contain any other frames.
+// The packet is sent with the destination connection ID used on that path.
+func (p *packetPacker) PackPathChallenge(pcf *wire.PathChallengeFrame, destConnID protocol.ConnectionID) (*packedPacket, error) {
+	return p.packPathProbe(pcf, destConnID)
+}
+
+// PackPathResponse packs a packet that ONLY contains a PathResponseFrame.
+// It is used to answer a PATH_CHALLENGE that was received on a path other than the current one.
+func (p *packetPacker) PackPathResponse(prf *wire.PathResponseFrame, destConnID protocol.ConnectionID) (*packedPacket, error) {
+	return p.packPathProbe(prf, destConnID)
+}
+
+func (p *packetPacker) packPathProbe(f wire.Frame, destConnID protocol.ConnectionID) (*packedPacket, error) {
+	frames := []wire.Frame{f}
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	if encLevel != protocol.Encryption1RTT {
+		return nil, errors.New("PacketPacker BUG: path probes can only be sent after the handshake")
+	}
+	header := p.getHeader(encLevel)
+	header.DestConnectionID = destConnID
+	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, err
+}
+
 func (p *packetPacker) MaybePackAckPacket() (*packedPacket, error) {
 	ack := p.acks.GetAckFrame()
 	if ack == nil {
@@ -433,6 +466,19 @@ func (p *packetPacker) writeAndSealPacket(
 
 	addPadding := p.perspective == protocol.PerspectiveClient && header.Type == protocol.PacketTypeInitial && !p.hasSentPacket
 
+	// For header protection, the sample is taken 4 bytes after the start of the packet number.
+	// Make sure that the packet is long enough.
+	var hpPaddingLen int
+	if p.version.UsesHeaderProtection() && !addPadding {
+		var payloadLen protocol.ByteCount
+		for _, frame := range frames {
+			payloadLen += frame.Length(p.version)
+		}
+		if minLen := protocol.ByteCount(4 - header.PacketNumberLen); payloadLen < minLen {
+			hpPaddingLen = int(minLen - payloadLen)
+		}
+	}
+
 	// the length is only needed for Long Headers
 	if header.IsLongHeader {
 		if p.perspective == protocol.PerspectiveClient && header.Type == protocol.PacketTypeInitial {
@@ -442,7 +488,7 @@ func (p *packetPacker) writeAndSealPacket(
 			headerLen := header.GetLength(p.version)
 			header.Length = protocol.ByteCount(header.PacketNumberLen) + protocol.MinInitialPacketSize - headerLen
 		} else {
-			length := protocol.ByteCount(sealer.Overhead()) + protocol.ByteCount(header.PacketNumberLen)
+			length := protocol.ByteCount(sealer.Overhead()) + protocol.ByteCount(header.PacketNumberLen) + protocol.ByteCount(hpPaddingLen)
 			for _, frame := range frames {
 				length += frame.Length(p.version)
 			}
@@ -473,6 +519,9 @@ func (p *packetPacker) writeAndSealPacket(
 			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
 		}
 	}
+	if hpPaddingLen > 0 {
+		buffer.Write(bytes.Repeat([]byte{0}, hpPaddingLen))
+	}
 
 	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > p.maxPacketSize {
 		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, p.maxPacketSize)
@@ -482,6 +531,15 @@ func (p *packetPacker) writeAndSealPacket(
 	_ = sealer.Seal(raw[payloadStartIndex:payloadStartIndex], raw[payloadStartIndex:], header.PacketNumber, raw[:payloadStartIndex])
 	raw = raw[0 : buffer.Len()+sealer.Overhead()]
 
+	if p.version.UsesHeaderProtection() {
+		pnOffset := payloadStartIndex - int(header.PacketNumberLen)
+		sealer.EncryptHeader(
+			raw[pnOffset+4:pnOffset+4+crypto.HeaderProtectionSampleLen],
+			&raw[0],
+			raw[pnOffset:payloadStartIndex],
+		)
+	}
+
 	num := p.pnManager.PopPacketNumber()
 	if num != header.PacketNumber {
 		return nil, errors.New("packetPacker BUG: Peeked and Popped packet numbers do not match")
@@ -34,7 +34,7 @@ var _ = Describe("Packet packer", func() {
 		r := bytes.NewReader(data)
 		iHdr, err := wire.ParseInvariantHeader(r, 0)
 		Expect(err).ToNot(HaveOccurred())
-		hdr, err := iHdr.Parse(r, protocol.PerspectiveServer, protocol.VersionWhatever)
+		hdr, err := iHdr.Parse(r, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 		ExpectWithOffset(0, hdr.Length).To(BeEquivalentTo(r.Len() + int(hdr.PacketNumberLen)))
 	}
@@ -57,7 +57,7 @@ var _ = Describe("Packet packer", func() {
 
 	BeforeEach(func() {
 		rand.Seed(GinkgoRandomSeed())
-		version := protocol.VersionWhatever
+		version := protocol.VersionTLS
 		mockSender := NewMockStreamSender(mockCtrl)
 		mockSender.EXPECT().onHasStreamData(gomock.Any()).AnyTimes()
 		initialStream = NewMockCryptoStream(mockCtrl)
@@ -156,6 +156,69 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
+	Context("in QUIC version 1", func() {
+		BeforeEach(func() {
+			packer.version = protocol.Version1
+			initialStream.EXPECT().HasData().AnyTimes()
+			handshakeStream.EXPECT().HasData().AnyTimes()
+		})
+
+		It("applies header protection", func() {
+			pnManager.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+			pnManager.EXPECT().PopPacketNumber().Return(protocol.PacketNumber(0x42))
+			sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+			ackFramer.EXPECT().GetAckFrame()
+			expectAppendControlFrames()
+			f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			expectAppendStreamFrames(f)
+			sealer.EXPECT().EncryptHeader(gomock.Any(), gomock.Any(), gomock.Any()).Do(func(sample []byte, firstByte *byte, pnBytes []byte) {
+				Expect(sample).To(HaveLen(16))
+				Expect(*firstByte).To(Equal(byte(0x41))) // short header with a 2 byte packet number
+				Expect(pnBytes).To(Equal([]byte{0x0, 0x42}))
+			})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{f}))
+		})
+
+		It("pads packets that are too short for the header protection sample", func() {
+			pnManager.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+			pnManager.EXPECT().PopPacketNumber().Return(protocol.PacketNumber(0x42))
+			sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+			ackFramer.EXPECT().GetAckFrame()
+			expectAppendControlFrames(&wire.PingFrame{})
+			expectAppendStreamFrames()
+			sealer.EXPECT().EncryptHeader(gomock.Any(), gomock.Any(), gomock.Any())
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			hdrLen := 1 + packer.destConnID.Len()
+			// the payload (including the packet number) needs to be at least 4 bytes long
+			Expect(p.raw).To(HaveLen(hdrLen + 4 + 7))
+		})
+
+		It("sets the length of long header packets including the padding", func() {
+			pnManager.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen1)
+			pnManager.EXPECT().PopPacketNumber().Return(protocol.PacketNumber(0x42))
+			sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.EncryptionHandshake).Return(sealer, nil)
+			packet := &ackhandler.Packet{
+				PacketType:      protocol.PacketTypeHandshake,
+				EncryptionLevel: protocol.EncryptionHandshake,
+				Frames:          []wire.Frame{&wire.PingFrame{}},
+			}
+			sealer.EXPECT().EncryptHeader(gomock.Any(), gomock.Any(), gomock.Any())
+			p, err := packer.PackRetransmission(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(HaveLen(1))
+			r := bytes.NewReader(p[0].raw)
+			iHdr, err := wire.ParseInvariantHeader(r, 0)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, err := iHdr.Parse(r, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.Length).To(BeEquivalentTo(r.Len()))
+			Expect(hdr.Length).To(BeEquivalentTo(4 + 7))
+		})
+	})
+
 	Context("packing normal packets", func() {
 		BeforeEach(func() {
 			initialStream.EXPECT().HasData().AnyTimes()
@@ -238,6 +301,39 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.frames[0]).To(Equal(&ccf))
 		})
 
+		It("packs a PATH_CHALLENGE", func() {
+			pnManager.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+			pnManager.EXPECT().PopPacketNumber().Return(protocol.PacketNumber(0x42))
+			// expect no framer.PopStreamFrames and no ACK
+			pcf := &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+			sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+			destConnID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+			p, err := packer.PackPathChallenge(pcf, destConnID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{pcf}))
+			Expect(p.header.IsLongHeader).To(BeFalse())
+			Expect(p.header.DestConnectionID).To(Equal(destConnID))
+		})
+
+		It("packs a PATH_RESPONSE", func() {
+			pnManager.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+			pnManager.EXPECT().PopPacketNumber().Return(protocol.PacketNumber(0x42))
+			prf := &wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+			sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+			destConnID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+			p, err := packer.PackPathResponse(prf, destConnID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{prf}))
+			Expect(p.header.IsLongHeader).To(BeFalse())
+			Expect(p.header.DestConnectionID).To(Equal(destConnID))
+		})
+
+		It("doesn't pack a PATH_CHALLENGE before the handshake completed", func() {
+			sealingManager.EXPECT().GetSealer().Return(protocol.EncryptionHandshake, sealer)
+			_, err := packer.PackPathChallenge(&wire.PathChallengeFrame{}, protocol.ConnectionID{1, 2, 3, 4})
+			Expect(err).To(MatchError("PacketPacker BUG: path probes can only be sent after the handshake"))
+		})
+
 		It("packs control frames", func() {
 			pnManager.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
 			pnManager.EXPECT().PopPacketNumber().Return(protocol.PacketNumber(0x42))
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"fmt"
 
+	"github.com/lucas-clemente/quic-go/internal/crypto"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
@@ -14,7 +17,18 @@ type unpackedPacket struct {
 	frames          []wire.Frame
 }
 
+// A decryptionError is returned if a packet can't be decrypted.
+// This might be a packet sent by an attacker, or a packet for which we don't have the keys yet.
+type decryptionError struct {
+	err error
+}
+
+func (e *decryptionError) Error() string {
+	return fmt.Sprintf("decryption failed: %s", e.err)
+}
+
 type quicAEAD interface {
+	GetOpener(protocol.EncryptionLevel) (handshake.Opener, error)
 	OpenInitial(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]byte, error)
 	OpenHandshake(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]byte, error)
 	Open1RTT(dst, src []byte, pn protocol.PacketNumber, ad []byte) ([]byte, error)
@@ -24,6 +38,9 @@ type quicAEAD interface {
 type packetUnpacker struct {
 	aead    quicAEAD
 	version protocol.VersionNumber
+
+	// only used for versions that use header protection
+	largestRcvdPacketNumber protocol.PacketNumber
 }
 
 var _ unpacker = &packetUnpacker{}
@@ -40,6 +57,14 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 	buf = buf[:0]
 	defer putPacketBuffer(&buf)
 
+	if u.version.UsesHeaderProtection() {
+		var err error
+		headerBinary, data, err = u.removeHeaderProtection(headerBinary, hdr, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var decrypted []byte
 	var encryptionLevel protocol.EncryptionLevel
 	var err error
@@ -58,8 +83,10 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 		encryptionLevel = protocol.Encryption1RTT
 	}
 	if err != nil {
-		// Wrap err in quicError so that public reset is sent by session
-		return nil, qerr.Error(qerr.DecryptionFailure, err.Error())
+		return nil, &decryptionError{err: err}
+	}
+	if u.version.UsesHeaderProtection() {
+		u.largestRcvdPacketNumber = utils.MaxPacketNumber(u.largestRcvdPacketNumber, hdr.PacketNumber)
 	}
 
 	fs, err := u.parseFrames(decrypted)
@@ -73,10 +100,57 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 	}, nil
 }
 
+// removeHeaderProtection removes header protection, as defined in section 5.4 of RFC 9001.
+// It returns the unprotected header (including the packet number) and the payload.
+// The packet number is set on the header.
+func (u *packetUnpacker) removeHeaderProtection(headerBinary []byte, hdr *wire.Header, data []byte) ([]byte, []byte, error) {
+	var encLevel protocol.EncryptionLevel
+	switch hdr.Type {
+	case protocol.PacketTypeInitial:
+		encLevel = protocol.EncryptionInitial
+	case protocol.PacketTypeHandshake:
+		encLevel = protocol.EncryptionHandshake
+	default:
+		if hdr.IsLongHeader {
+			return nil, nil, fmt.Errorf("unknown packet type: %s", hdr.Type)
+		}
+		encLevel = protocol.Encryption1RTT
+	}
+	// Check that we have the keys before modifying the packet.
+	// Otherwise we wouldn't be able to process this packet once the keys become available.
+	opener, err := u.aead.GetOpener(encLevel)
+	if err != nil {
+		return nil, nil, &decryptionError{err: err}
+	}
+	// The sample is taken assuming that the packet number is 4 bytes long.
+	if len(data) < 4+crypto.HeaderProtectionSampleLen || len(headerBinary) == 0 {
+		return nil, nil, &decryptionError{err: fmt.Errorf("packet too small (%d bytes)", len(data))}
+	}
+	opener.DecryptHeader(data[4:4+crypto.HeaderProtectionSampleLen], &headerBinary[0], data[:4])
+	if hdr.IsLongHeader && headerBinary[0]&0xc != 0 || !hdr.IsLongHeader && headerBinary[0]&0x18 != 0 {
+		return nil, nil, qerr.Error(qerr.ProtocolViolation, "reserved bits set")
+	}
+	pnLen := protocol.PacketNumberLen(headerBinary[0]&0x3) + 1
+	var wirePN uint64
+	for _, b := range data[:pnLen] {
+		wirePN = wirePN<<8 | uint64(b)
+	}
+	hdr.PacketNumberLen = pnLen
+	hdr.PacketNumber = protocol.InferPacketNumber(pnLen, u.largestRcvdPacketNumber, protocol.PacketNumber(wirePN), u.version)
+	if !hdr.IsLongHeader {
+		hdr.KeyPhase = int(headerBinary[0]&0x4) >> 2
+	}
+	// The packet number is part of the associated data.
+	ad := make([]byte, 0, len(headerBinary)+int(pnLen))
+	ad = append(ad, headerBinary...)
+	ad = append(ad, data[:pnLen]...)
+	return ad, data[pnLen:], nil
+}
+
 func (u *packetUnpacker) parseFrames(decrypted []byte) ([]wire.Frame, error) {
 	r := bytes.NewReader(decrypted)
 	if r.Len() == 0 {
-		return nil, qerr.MissingPayload
+		return nil, qerr.ProtocolViolation
 	}
 
 	fs := make([]wire.Frame, 0, 2)
@@ -2,8 +2,10 @@ package quic
 
 import (
 	"bytes"
+	"errors"
 
 	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/crypto"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/wire"
@@ -33,7 +35,14 @@ var _ = Describe("Packet Unpacker", func() {
 		data := []byte("foobar")
 		aead.EXPECT().Open1RTT(gomock.Any(), []byte("foobar"), hdr.PacketNumber, hdr.Raw).Return([]byte{}, nil)
 		_, err := unpacker.Unpack(hdr.Raw, hdr, data)
-		Expect(err).To(MatchError(qerr.MissingPayload))
+		Expect(err).To(MatchError(qerr.ProtocolViolation))
+	})
+
+	It("returns a decryption error if the packet can't be decrypted", func() {
+		aead.EXPECT().Open1RTT(gomock.Any(), gomock.Any(), hdr.PacketNumber, hdr.Raw).Return(nil, errors.New("test err"))
+		_, err := unpacker.Unpack(hdr.Raw, hdr, nil)
+		Expect(err).To(BeAssignableToTypeOf(&decryptionError{}))
+		Expect(err).To(MatchError("decryption failed: test err"))
 	})
 
 	It("opens Initial packets", func() {
@@ -63,4 +72,78 @@ var _ = Describe("Packet Unpacker", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.frames).To(Equal([]wire.Frame{&wire.PingFrame{}, &wire.DataBlockedFrame{}}))
 	})
+
+	Context("in QUIC version 1", func() {
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+		var clientAEAD, serverAEAD crypto.AEAD
+
+		BeforeEach(func() {
+			unpacker = newPacketUnpacker(aead, protocol.Version1).(*packetUnpacker)
+			var err error
+			clientAEAD, err = crypto.NewNullAEAD(connID, protocol.PerspectiveClient, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			serverAEAD, err = crypto.NewNullAEAD(connID, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		// getPacket returns a protected Initial packet, and the parsed header
+		getPacket := func(pn protocol.PacketNumber) (*wire.Header, []byte) {
+			payload := &bytes.Buffer{}
+			(&wire.PingFrame{}).Write(payload, protocol.Version1)
+			payload.Write(make([]byte, 20)) // PADDING frames
+			buf := &bytes.Buffer{}
+			Expect((&wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				DestConnectionID: connID,
+				Version:          protocol.Version1,
+				PacketNumber:     pn,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+				Length:           protocol.ByteCount(2 + payload.Len() + clientAEAD.Overhead()),
+			}).Write(buf, protocol.PerspectiveClient, protocol.Version1)).To(Succeed())
+			hdrLen := buf.Len()
+			raw := clientAEAD.Seal(buf.Bytes(), payload.Bytes(), pn, buf.Bytes())
+			pnOffset := hdrLen - 2
+			clientAEAD.EncryptHeader(raw[pnOffset+4:pnOffset+4+16], &raw[0], raw[pnOffset:hdrLen])
+
+			r := bytes.NewReader(raw)
+			iHdr, err := wire.ParseInvariantHeader(r, 0)
+			Expect(err).ToNot(HaveOccurred())
+			hdr, err := iHdr.Parse(r, protocol.PerspectiveClient, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			hdr.Raw = raw[:len(raw)-r.Len()]
+			return hdr, raw[len(hdr.Raw):]
+		}
+
+		It("removes header protection and decrypts the packet", func() {
+			hdr, data := getPacket(0x1337)
+			aead.EXPECT().GetOpener(protocol.EncryptionInitial).Return(serverAEAD, nil)
+			aead.EXPECT().OpenInitial(gomock.Any(), gomock.Any(), protocol.PacketNumber(0x1337), gomock.Any()).DoAndReturn(serverAEAD.Open)
+			packet, err := unpacker.Unpack(hdr.Raw, hdr, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
+			Expect(hdr.PacketNumberLen).To(Equal(protocol.PacketNumberLen2))
+			Expect(packet.encryptionLevel).To(Equal(protocol.EncryptionInitial))
+			Expect(packet.frames[0]).To(Equal(&wire.PingFrame{}))
+		})
+
+		It("infers the packet number from the largest packet number received", func() {
+			unpacker.largestRcvdPacketNumber = 0x11337
+			hdr, data := getPacket(0x11338)
+			aead.EXPECT().GetOpener(protocol.EncryptionInitial).Return(serverAEAD, nil)
+			aead.EXPECT().OpenInitial(gomock.Any(), gomock.Any(), protocol.PacketNumber(0x11338), gomock.Any()).DoAndReturn(serverAEAD.Open)
+			_, err := unpacker.Unpack(hdr.Raw, hdr, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(unpacker.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(0x11338)))
+		})
+
+		It("doesn't modify the packet if the keys are not available yet", func() {
+			hdr, data := getPacket(0x1337)
+			raw := append(append([]byte{}, hdr.Raw...), data...)
+			aead.EXPECT().GetOpener(protocol.EncryptionInitial).Return(nil, errors.New("no keys"))
+			_, err := unpacker.Unpack(hdr.Raw, hdr, data)
+			Expect(err).To(BeAssignableToTypeOf(&decryptionError{}))
+			Expect(append(append([]byte{}, hdr.Raw...), data...)).To(Equal(raw))
+		})
+	})
 })
@@ -0,0 +1,428 @@
+package qpack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A Decoder decodes field sections.
+// It processes the instructions received on the peer's encoder stream,
+// and writes acknowledgements to the decoder stream.
+// It is safe for concurrent use.
+type Decoder struct {
+	mutex sync.Mutex
+
+	maxTableCapacity  uint64
+	maxBlockedStreams int
+	w                 io.Writer // the decoder stream
+
+	table dynamicTable
+	// the Known Received Count, as communicated to the encoder
+	knownReceivedCount uint64
+	// data received on the encoder stream that doesn't contain a full instruction yet
+	encoderStreamBuf []byte
+
+	blockedStreams map[uint64]*blockedStream
+	closeErr       error
+}
+
+type blockedStream struct {
+	requiredInsertCount uint64
+	canceled            bool
+	unblock             chan struct{}
+}
+
+var errDecoderClosed = errors.New("qpack: decoder closed")
+
+// The length of string literals in field sections is only limited by the length of the field section.
+const noLimit = ^uint64(0)
+
+// NewDecoder creates a new Decoder.
+// The maximum table capacity and the maximum number of blocked streams are the values sent in the
+// SETTINGS_QPACK_MAX_TABLE_CAPACITY and SETTINGS_QPACK_BLOCKED_STREAMS settings.
+// Decoder stream instructions are written to w. If maxTableCapacity is 0, nothing is ever written, and w may be nil.
+func NewDecoder(maxTableCapacity uint64, maxBlockedStreams int, w io.Writer) *Decoder {
+	return &Decoder{
+		maxTableCapacity:  maxTableCapacity,
+		maxBlockedStreams: maxBlockedStreams,
+		w:                 w,
+		blockedStreams:    make(map[uint64]*blockedStream),
+	}
+}
+
+// HandleEncoderStream processes data received on the encoder stream.
+// Instructions may be split across multiple calls.
+// An error is a connection error of type QPACK_ENCODER_STREAM_ERROR.
+func (d *Decoder) HandleEncoderStream(p []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closeErr != nil {
+		return d.closeErr
+	}
+	d.encoderStreamBuf = append(d.encoderStreamBuf, p...)
+	buf := d.encoderStreamBuf
+	for len(buf) > 0 {
+		rest, err := d.parseEncoderInstruction(buf)
+		if err == errNeedMore {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		buf = rest
+	}
+	d.encoderStreamBuf = append(d.encoderStreamBuf[:0], buf...)
+
+	insertCount := d.table.insertCount()
+	if insertCount > d.knownReceivedCount {
+		if err := d.writeInstruction(appendInt(nil, 0x0, 6, insertCount-d.knownReceivedCount)); err != nil {
+			return err
+		}
+		d.knownReceivedCount = insertCount
+	}
+	for id, s := range d.blockedStreams {
+		if s.requiredInsertCount <= insertCount {
+			close(s.unblock)
+			delete(d.blockedStreams, id)
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) parseEncoderInstruction(p []byte) ([]byte, error) {
+	switch {
+	case p[0]&0x80 > 0: // Insert with Name Reference
+		isStatic := p[0]&0x40 > 0
+		index, p, err := readInt(p, 6)
+		if err != nil {
+			return nil, err
+		}
+		value, p, err := readString(p, 7, d.maxTableCapacity)
+		if err != nil {
+			return nil, err
+		}
+		var name string
+		if isStatic {
+			if index >= uint64(len(staticTable)) {
+				return nil, fmt.Errorf("invalid static table index %d", index)
+			}
+			name = staticTable[index].Name
+		} else {
+			hf, ok := d.getRelative(index)
+			if !ok {
+				return nil, fmt.Errorf("invalid relative index %d", index)
+			}
+			name = hf.Name
+		}
+		return p, d.insert(HeaderField{Name: name, Value: value})
+	case p[0]&0xc0 == 0x40: // Insert with Literal Name
+		name, p, err := readString(p, 5, d.maxTableCapacity)
+		if err != nil {
+			return nil, err
+		}
+		value, p, err := readString(p, 7, d.maxTableCapacity)
+		if err != nil {
+			return nil, err
+		}
+		return p, d.insert(HeaderField{Name: name, Value: value})
+	case p[0]&0xe0 == 0x20: // Set Dynamic Table Capacity
+		capacity, p, err := readInt(p, 5)
+		if err != nil {
+			return nil, err
+		}
+		if capacity > d.maxTableCapacity {
+			return nil, fmt.Errorf("dynamic table capacity %d exceeds the maximum (%d)", capacity, d.maxTableCapacity)
+		}
+		d.table.setCapacity(capacity)
+		return p, nil
+	default: // Duplicate
+		index, p, err := readInt(p, 5)
+		if err != nil {
+			return nil, err
+		}
+		hf, ok := d.getRelative(index)
+		if !ok {
+			return nil, fmt.Errorf("invalid relative index %d", index)
+		}
+		return p, d.insert(hf)
+	}
+}
+
+// getRelative returns an entry, using the relative indexing of the encoder stream
+func (d *Decoder) getRelative(index uint64) (HeaderField, bool) {
+	insertCount := d.table.insertCount()
+	if index >= insertCount {
+		return HeaderField{}, false
+	}
+	return d.table.get(insertCount - 1 - index)
+}
+
+func (d *Decoder) insert(hf HeaderField) error {
+	if hf.size() > d.table.capacity {
+		return fmt.Errorf("entry of size %d doesn't fit into the dynamic table (capacity %d)", hf.size(), d.table.capacity)
+	}
+	d.table.insert(hf)
+	return nil
+}
+
+// DecodeFieldSection decodes a field section received on a stream.
+// If the field section references dynamic table entries that haven't been received on the encoder stream yet,
+// the stream is blocked: DecodeFieldSection waits until the entries have been received, or the context is canceled.
+// If the context is canceled, a Stream Cancellation instruction is sent.
+// Any other error is a connection error of type QPACK_DECOMPRESSION_FAILED.
+func (d *Decoder) DecodeFieldSection(ctx context.Context, streamID uint64, p []byte) ([]HeaderField, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closeErr != nil {
+		return nil, d.closeErr
+	}
+	requiredInsertCount, base, p, err := d.parsePrefix(p)
+	if err != nil {
+		return nil, err
+	}
+	if requiredInsertCount > d.table.insertCount() {
+		if err := d.waitForInsertCount(ctx, streamID, requiredInsertCount); err != nil {
+			return nil, err
+		}
+	}
+	fields, err := d.decodeFieldLines(requiredInsertCount, base, p)
+	if err != nil {
+		return nil, err
+	}
+	if requiredInsertCount > 0 {
+		// Section Acknowledgment
+		if err := d.writeInstruction(appendInt(nil, 0x80, 7, streamID)); err != nil {
+			return nil, err
+		}
+		if requiredInsertCount > d.knownReceivedCount {
+			d.knownReceivedCount = requiredInsertCount
+		}
+	}
+	return fields, nil
+}
+
+// waitForInsertCount blocks the stream until the insert count is reached.
+// It must be called with the mutex held.
+func (d *Decoder) waitForInsertCount(ctx context.Context, streamID, insertCount uint64) error {
+	if _, ok := d.blockedStreams[streamID]; ok {
+		return fmt.Errorf("stream %d is already blocked", streamID)
+	}
+	if len(d.blockedStreams) >= d.maxBlockedStreams {
+		return fmt.Errorf("too many blocked streams (maximum: %d)", d.maxBlockedStreams)
+	}
+	s := &blockedStream{requiredInsertCount: insertCount, unblock: make(chan struct{})}
+	d.blockedStreams[streamID] = s
+	d.mutex.Unlock()
+	var canceled bool
+	select {
+	case <-s.unblock:
+	case <-ctx.Done():
+		canceled = true
+	}
+	d.mutex.Lock()
+	if canceled {
+		if d.blockedStreams[streamID] == s {
+			delete(d.blockedStreams, streamID)
+		}
+		d.cancelStream(streamID)
+		return ctx.Err()
+	}
+	if s.canceled {
+		return fmt.Errorf("stream %d was canceled", streamID)
+	}
+	return d.closeErr
+}
+
+// parsePrefix parses the field section prefix, see RFC 9204, section 4.5.1.
+func (d *Decoder) parsePrefix(p []byte) (uint64 /* Required Insert Count */, uint64 /* Base */, []byte, error) {
+	encodedInsertCount, p, err := readInt(p, 8)
+	if err != nil {
+		return 0, 0, nil, errorTruncated(err)
+	}
+	if len(p) == 0 {
+		return 0, 0, nil, errors.New("truncated field section")
+	}
+	negative := p[0]&0x80 > 0
+	deltaBase, p, err := readInt(p, 7)
+	if err != nil {
+		return 0, 0, nil, errorTruncated(err)
+	}
+	if encodedInsertCount == 0 {
+		if negative || deltaBase != 0 {
+			return 0, 0, nil, errors.New("invalid Delta Base for a field section without dynamic table references")
+		}
+		return 0, 0, p, nil
+	}
+
+	maxEntries := d.maxTableCapacity / 32
+	fullRange := 2 * maxEntries
+	if encodedInsertCount > fullRange {
+		return 0, 0, nil, errors.New("invalid Required Insert Count")
+	}
+	maxValue := d.table.insertCount() + maxEntries
+	maxWrapped := maxValue / fullRange * fullRange
+	requiredInsertCount := maxWrapped + encodedInsertCount - 1
+	if requiredInsertCount > maxValue {
+		if requiredInsertCount <= fullRange {
+			return 0, 0, nil, errors.New("invalid Required Insert Count")
+		}
+		requiredInsertCount -= fullRange
+	}
+	if requiredInsertCount == 0 {
+		return 0, 0, nil, errors.New("invalid Required Insert Count")
+	}
+
+	var base uint64
+	if negative {
+		if deltaBase >= requiredInsertCount {
+			return 0, 0, nil, errors.New("invalid Delta Base")
+		}
+		base = requiredInsertCount - deltaBase - 1
+	} else {
+		base = requiredInsertCount + deltaBase
+	}
+	return requiredInsertCount, base, p, nil
+}
+
+func (d *Decoder) decodeFieldLines(requiredInsertCount, base uint64, p []byte) ([]HeaderField, error) {
+	// the largest absolute index referenced, plus 1
+	var largestReference uint64
+	getDynamic := func(abs uint64) (HeaderField, error) {
+		if abs >= requiredInsertCount {
+			return HeaderField{}, fmt.Errorf("reference to entry %d exceeds the Required Insert Count (%d)", abs, requiredInsertCount)
+		}
+		hf, ok := d.table.get(abs)
+		if !ok {
+			return HeaderField{}, fmt.Errorf("reference to evicted entry %d", abs)
+		}
+		if abs+1 > largestReference {
+			largestReference = abs + 1
+		}
+		return hf, nil
+	}
+	getRelative := func(index uint64) (HeaderField, error) {
+		if index >= base {
+			return HeaderField{}, fmt.Errorf("invalid relative index %d (base: %d)", index, base)
+		}
+		return getDynamic(base - 1 - index)
+	}
+	getStatic := func(index uint64) (HeaderField, error) {
+		if index >= uint64(len(staticTable)) {
+			return HeaderField{}, fmt.Errorf("invalid static table index %d", index)
+		}
+		return staticTable[index], nil
+	}
+
+	var fields []HeaderField
+	for len(p) > 0 {
+		var hf HeaderField
+		var index uint64
+		var err error
+		switch {
+		case p[0]&0x80 > 0: // Indexed Field Line
+			isStatic := p[0]&0x40 > 0
+			if index, p, err = readInt(p, 6); err != nil {
+				return nil, errorTruncated(err)
+			}
+			if isStatic {
+				hf, err = getStatic(index)
+			} else {
+				hf, err = getRelative(index)
+			}
+		case p[0]&0xc0 == 0x40: // Literal Field Line with Name Reference
+			isStatic := p[0]&0x10 > 0
+			if index, p, err = readInt(p, 4); err != nil {
+				return nil, errorTruncated(err)
+			}
+			if isStatic {
+				hf, err = getStatic(index)
+			} else {
+				hf, err = getRelative(index)
+			}
+			if err != nil {
+				return nil, err
+			}
+			hf.Value, p, err = readString(p, 7, noLimit)
+		case p[0]&0xe0 == 0x20: // Literal Field Line with Literal Name
+			hf.Name, p, err = readString(p, 3, noLimit)
+			if err != nil {
+				return nil, errorTruncated(err)
+			}
+			hf.Value, p, err = readString(p, 7, noLimit)
+		case p[0]&0xf0 == 0x10: // Indexed Field Line with Post-Base Index
+			if index, p, err = readInt(p, 4); err != nil {
+				return nil, errorTruncated(err)
+			}
+			hf, err = getDynamic(base + index)
+		default: // Literal Field Line with Post-Base Name Reference
+			if index, p, err = readInt(p, 3); err != nil {
+				return nil, errorTruncated(err)
+			}
+			if hf, err = getDynamic(base + index); err != nil {
+				return nil, err
+			}
+			hf.Value, p, err = readString(p, 7, noLimit)
+		}
+		if err != nil {
+			return nil, errorTruncated(err)
+		}
+		fields = append(fields, hf)
+	}
+	if largestReference != requiredInsertCount {
+		return nil, fmt.Errorf("the Required Insert Count (%d) is larger than required (%d)", requiredInsertCount, largestReference)
+	}
+	return fields, nil
+}
+
+// CancelStream is called when a stream is reset, or when reading from it is aborted.
+// It sends a Stream Cancellation instruction.
+func (d *Decoder) CancelStream(streamID uint64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.cancelStream(streamID)
+}
+
+func (d *Decoder) cancelStream(streamID uint64) error {
+	// If the dynamic table is not used, there's no need to send Stream Cancellations.
+	if d.maxTableCapacity == 0 {
+		return nil
+	}
+	if s, ok := d.blockedStreams[streamID]; ok {
+		s.canceled = true
+		close(s.unblock)
+		delete(d.blockedStreams, streamID)
+	}
+	return d.writeInstruction(appendInt(nil, 0x40, 6, streamID))
+}
+
+// Close closes the decoder. Blocked streams are unblocked, and return an error.
+func (d *Decoder) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closeErr != nil {
+		return nil
+	}
+	d.closeErr = errDecoderClosed
+	for id, s := range d.blockedStreams {
+		close(s.unblock)
+		delete(d.blockedStreams, id)
+	}
+	return nil
+}
+
+func (d *Decoder) writeInstruction(b []byte) error {
+	_, err := d.w.Write(b)
+	return err
+}
+
+func errorTruncated(err error) error {
+	if err == errNeedMore {
+		return errors.New("truncated field section")
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package qpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Decoder", func() {
+	var (
+		decoder       *Decoder
+		decoderStream *bytes.Buffer
+	)
+
+	decodeHex := func(s string) []byte {
+		b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return b
+	}
+
+	BeforeEach(func() {
+		decoderStream = &bytes.Buffer{}
+		decoder = NewDecoder(220, 10, decoderStream)
+	})
+
+	It("decodes field sections that only use the static table", func() {
+		// RFC 9204, appendix B.1
+		fields, err := decoder.DecodeFieldSection(context.Background(), 0, decodeHex("0000 510b 2f69 6e64 6578 2e68 746d 6c"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: ":path", Value: "/index.html"}}))
+		Expect(decoderStream.Len()).To(BeZero())
+	})
+
+	It("decodes literal field lines with a literal name", func() {
+		fields, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x0, 0x0, 0x20 | 3, 'f', 'o', 'o', 3, 'b', 'a', 'r'})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+	})
+
+	It("uses the dynamic table, following the examples from RFC 9204", func() {
+		// appendix B.2
+		Expect(decoder.HandleEncoderStream(decodeHex(
+			"3fbd01" + // Set Dynamic Table Capacity=220
+				"c00f7777772e6578616d706c652e636f6d" + // Insert With Name Reference, Static Table, Index=0 (:authority=www.example.com)
+				"c10c2f73616d706c652f70617468", // Insert With Name Reference, Static Table, Index=1 (:path=/sample/path)
+		))).To(Succeed())
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x2})) // Insert Count Increment 2
+		decoderStream.Reset()
+		fields, err := decoder.DecodeFieldSection(context.Background(), 4, decodeHex("0381 10 11"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{
+			{Name: ":authority", Value: "www.example.com"},
+			{Name: ":path", Value: "/sample/path"},
+		}))
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x84})) // Section Acknowledgment, stream 4
+		decoderStream.Reset()
+
+		// appendix B.3
+		Expect(decoder.HandleEncoderStream(decodeHex("4a637573746f6d2d6b65790c637573746f6d2d76616c7565"))).To(Succeed())
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x1})) // Insert Count Increment 1
+		decoderStream.Reset()
+
+		// appendix B.4
+		Expect(decoder.HandleEncoderStream([]byte{0x2})).To(Succeed()) // Duplicate, Relative Index=2
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x1}))
+		decoderStream.Reset()
+		fields, err = decoder.DecodeFieldSection(context.Background(), 8, decodeHex("0500 80 c1 81"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{
+			{Name: ":authority", Value: "www.example.com"},
+			{Name: ":path", Value: "/"},
+			{Name: "custom-key", Value: "custom-value"},
+		}))
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x88}))
+		decoderStream.Reset()
+
+		// appendix B.5
+		Expect(decoder.HandleEncoderStream(decodeHex("810d637573746f6d2d76616c756532"))).To(Succeed())
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x1}))
+		Expect(decoder.table.dropped).To(BeEquivalentTo(1))
+		Expect(decoder.table.size).To(BeEquivalentTo(215))
+		hf, ok := decoder.table.get(4)
+		Expect(ok).To(BeTrue())
+		Expect(hf).To(Equal(HeaderField{Name: "custom-key", Value: "custom-value2"}))
+	})
+
+	It("processes encoder stream instructions split across multiple calls", func() {
+		data := decodeHex("3fbd01 c00f7777772e6578616d706c652e636f6d")
+		for _, b := range data {
+			Expect(decoder.HandleEncoderStream([]byte{b})).To(Succeed())
+		}
+		Expect(decoder.table.insertCount()).To(BeEquivalentTo(1))
+		Expect(decoderStream.Bytes()).To(Equal([]byte{0x1}))
+	})
+
+	It("decodes field lines with post-base name references", func() {
+		Expect(decoder.HandleEncoderStream(decodeHex("3fbd01 c00f7777772e6578616d706c652e636f6d"))).To(Succeed())
+		// Required Insert Count = 1, Base = 0, Literal Field Line with Post-Base Name Reference, Index 0
+		fields, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x2, 0x80, 0x0, 3, 'f', 'o', 'o'})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fields).To(Equal([]HeaderField{{Name: ":authority", Value: "foo"}}))
+	})
+
+	Context("blocked streams", func() {
+		const section = "0381 10 11" // from RFC 9204, appendix B.2
+		const encoderStream = "3fbd01 c00f7777772e6578616d706c652e636f6d c10c2f73616d706c652f70617468"
+
+		It("blocks until the entries are received on the encoder stream", func() {
+			fieldsChan := make(chan []HeaderField)
+			go func() {
+				defer GinkgoRecover()
+				fields, err := decoder.DecodeFieldSection(context.Background(), 4, decodeHex(section))
+				Expect(err).ToNot(HaveOccurred())
+				fieldsChan <- fields
+			}()
+			Consistently(fieldsChan).ShouldNot(Receive())
+			Expect(decoder.HandleEncoderStream(decodeHex(encoderStream))).To(Succeed())
+			Eventually(fieldsChan).Should(Receive(HaveLen(2)))
+		})
+
+		It("errors when too many streams are blocked", func() {
+			decoder = NewDecoder(220, 1, decoderStream)
+			defer decoder.Close()
+			go decoder.DecodeFieldSection(context.Background(), 4, decodeHex(section))
+			Eventually(func() int {
+				decoder.mutex.Lock()
+				defer decoder.mutex.Unlock()
+				return len(decoder.blockedStreams)
+			}).Should(Equal(1))
+			_, err := decoder.DecodeFieldSection(context.Background(), 8, decodeHex(section))
+			Expect(err).To(MatchError("too many blocked streams (maximum: 1)"))
+		})
+
+		It("errors if blocking is not allowed", func() {
+			decoder = NewDecoder(220, 0, decoderStream)
+			_, err := decoder.DecodeFieldSection(context.Background(), 4, decodeHex(section))
+			Expect(err).To(MatchError("too many blocked streams (maximum: 0)"))
+		})
+
+		It("sends a Stream Cancellation when the context is canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := decoder.DecodeFieldSection(ctx, 4, decodeHex(section))
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(decoderStream.Bytes()).To(Equal([]byte{0x44}))
+			Expect(decoder.blockedStreams).To(BeEmpty())
+		})
+
+		It("unblocks streams when they are canceled", func() {
+			errChan := make(chan error)
+			go func() {
+				_, err := decoder.DecodeFieldSection(context.Background(), 4, decodeHex(section))
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(decoder.CancelStream(4)).To(Succeed())
+			Eventually(errChan).Should(Receive(MatchError("stream 4 was canceled")))
+			Expect(decoderStream.Bytes()).To(Equal([]byte{0x44}))
+		})
+
+		It("unblocks streams when it is closed", func() {
+			errChan := make(chan error)
+			go func() {
+				_, err := decoder.DecodeFieldSection(context.Background(), 4, decodeHex(section))
+				errChan <- err
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			Expect(decoder.Close()).To(Succeed())
+			Eventually(errChan).Should(Receive(MatchError(errDecoderClosed)))
+		})
+	})
+
+	It("doesn't send Stream Cancellations if the dynamic table is not used", func() {
+		decoder = NewDecoder(0, 0, nil)
+		Expect(decoder.CancelStream(4)).To(Succeed())
+	})
+
+	Context("errors", func() {
+		It("rejects references to the dynamic table if the dynamic table is not used", func() {
+			decoder = NewDecoder(0, 0, nil)
+			_, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x2, 0x0, 0x80})
+			Expect(err).To(MatchError("invalid Required Insert Count"))
+		})
+
+		It("rejects references to entries beyond the Required Insert Count", func() {
+			Expect(decoder.HandleEncoderStream(decodeHex(section2EncoderStream))).To(Succeed())
+			// Required Insert Count = 1, Base = 2, Indexed Field Line, Relative Index 0
+			_, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x2, 0x1, 0x80})
+			Expect(err).To(MatchError("reference to entry 1 exceeds the Required Insert Count (1)"))
+		})
+
+		It("rejects field sections with a Required Insert Count that is too large", func() {
+			Expect(decoder.HandleEncoderStream(decodeHex(section2EncoderStream))).To(Succeed())
+			// Required Insert Count = 2, Base = 2, Indexed Field Line, Relative Index 1
+			_, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x3, 0x0, 0x81})
+			Expect(err).To(MatchError("the Required Insert Count (2) is larger than required (1)"))
+		})
+
+		It("rejects references to evicted entries", func() {
+			Expect(decoder.HandleEncoderStream(decodeHex(section2EncoderStream))).To(Succeed())
+			Expect(decoder.HandleEncoderStream([]byte{0x20})).To(Succeed()) // Set Dynamic Table Capacity=0
+			_, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x3, 0x0, 0x80})
+			Expect(err).To(MatchError("reference to evicted entry 1"))
+		})
+
+		It("rejects invalid static table indices", func() {
+			_, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x0, 0x0, 0xff, 99 - 63})
+			Expect(err).To(MatchError("invalid static table index 99"))
+		})
+
+		It("rejects a non-zero Delta Base if the Required Insert Count is 0", func() {
+			_, err := decoder.DecodeFieldSection(context.Background(), 0, []byte{0x0, 0x1, 0xd1})
+			Expect(err).To(MatchError("invalid Delta Base for a field section without dynamic table references"))
+		})
+
+		It("errors on truncated field sections", func() {
+			data := []byte{0x0, 0x0, 0x20 | 3, 'f', 'o', 'o', 3, 'b', 'a', 'r'}
+			for i := 0; i < len(data); i++ {
+				if i == 2 { // this is a valid empty field section
+					continue
+				}
+				_, err := decoder.DecodeFieldSection(context.Background(), 0, data[:i])
+				Expect(err).To(MatchError("truncated field section"))
+			}
+		})
+
+		It("rejects a dynamic table capacity exceeding the maximum", func() {
+			Expect(decoder.HandleEncoderStream(appendInt(nil, 0x20, 5, 221))).To(MatchError("dynamic table capacity 221 exceeds the maximum (220)"))
+		})
+
+		It("rejects entries that don't fit into the dynamic table", func() {
+			Expect(decoder.HandleEncoderStream([]byte{0x20 | 20})).To(Succeed()) // Set Dynamic Table Capacity=20
+			Expect(decoder.HandleEncoderStream([]byte{0x40 | 1, 'a', 1, 'b'})).To(MatchError("entry of size 34 doesn't fit into the dynamic table (capacity 20)"))
+		})
+
+		It("rejects duplicates of non-existing entries", func() {
+			Expect(decoder.HandleEncoderStream([]byte{0x0})).To(MatchError("invalid relative index 0"))
+		})
+
+		It("rejects string literals that are longer than the maximum table capacity", func() {
+			// Insert With Name Reference, with a value of length 221
+			Expect(decoder.HandleEncoderStream(appendInt([]byte{0xc0}, 0x0, 7, 221))).To(MatchError("string literal too long"))
+		})
+	})
+})
+
+// the encoder stream used in RFC 9204, appendix B.2
+const section2EncoderStream = "3fbd01 c00f7777772e6578616d706c652e636f6d c10c2f73616d706c652f70617468"
@@ -0,0 +1,57 @@
+package qpack
+
+// The dynamicTable is the dynamic table, see RFC 9204, section 3.2.
+// Entries are identified by their absolute index: the first entry inserted has absolute index 0.
+// The table is used by both the encoder and the decoder.
+// It doesn't enforce any eviction rules, that's the responsibility of the encoder.
+type dynamicTable struct {
+	entries  []HeaderField // entries[0] is the oldest entry, it has the absolute index dropped
+	dropped  uint64        // the number of entries that were evicted
+	size     uint64
+	capacity uint64
+}
+
+// insertCount is the total number of insertions into the table.
+func (t *dynamicTable) insertCount() uint64 {
+	return t.dropped + uint64(len(t.entries))
+}
+
+// get returns the entry with the given absolute index.
+// It returns false if the entry was already evicted, or if it hasn't been inserted yet.
+func (t *dynamicTable) get(abs uint64) (HeaderField, bool) {
+	if abs < t.dropped || abs >= t.insertCount() {
+		return HeaderField{}, false
+	}
+	return t.entries[abs-t.dropped], true
+}
+
+// oldest returns the oldest entry in the table.
+// It must only be called if the table is not empty.
+func (t *dynamicTable) oldest() HeaderField {
+	return t.entries[0]
+}
+
+func (t *dynamicTable) evictOldest() {
+	t.size -= t.entries[0].size()
+	t.entries[0] = HeaderField{}
+	t.entries = t.entries[1:]
+	t.dropped++
+}
+
+// insert inserts a new entry, evicting as many entries as necessary to make room for it.
+// The caller has to make sure that the entry fits into the table.
+func (t *dynamicTable) insert(hf HeaderField) {
+	for t.size+hf.size() > t.capacity {
+		t.evictOldest()
+	}
+	t.entries = append(t.entries, hf)
+	t.size += hf.size()
+}
+
+// setCapacity sets the capacity, evicting as many entries as necessary.
+func (t *dynamicTable) setCapacity(c uint64) {
+	t.capacity = c
+	for t.size > t.capacity {
+		t.evictOldest()
+	}
+}
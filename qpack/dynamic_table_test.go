@@ -0,0 +1,56 @@
+package qpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dynamic Table", func() {
+	var table *dynamicTable
+
+	BeforeEach(func() {
+		table = &dynamicTable{}
+		table.setCapacity(100)
+	})
+
+	It("inserts entries", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})
+		Expect(table.insertCount()).To(BeEquivalentTo(2))
+		Expect(table.size).To(BeEquivalentTo(6 + 32 + 10 + 32))
+		hf, ok := table.get(0)
+		Expect(ok).To(BeTrue())
+		Expect(hf).To(Equal(HeaderField{Name: "foo", Value: "bar"}))
+		hf, ok = table.get(1)
+		Expect(ok).To(BeTrue())
+		Expect(hf).To(Equal(HeaderField{Name: "lorem", Value: "ipsum"}))
+		_, ok = table.get(2)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("evicts the oldest entries when inserting", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})        // 38 bytes
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})    // 42 bytes
+		table.insert(HeaderField{Name: "dolor", Value: "sit amet"}) // 45 bytes
+		Expect(table.insertCount()).To(BeEquivalentTo(3))
+		Expect(table.dropped).To(BeEquivalentTo(1))
+		Expect(table.size).To(BeEquivalentTo(42 + 45))
+		_, ok := table.get(0)
+		Expect(ok).To(BeFalse())
+		hf, ok := table.get(2)
+		Expect(ok).To(BeTrue())
+		Expect(hf.Name).To(Equal("dolor"))
+	})
+
+	It("evicts entries when the capacity is reduced", func() {
+		table.insert(HeaderField{Name: "foo", Value: "bar"})
+		table.insert(HeaderField{Name: "lorem", Value: "ipsum"})
+		table.setCapacity(50)
+		Expect(table.dropped).To(BeEquivalentTo(1))
+		Expect(table.oldest()).To(Equal(HeaderField{Name: "lorem", Value: "ipsum"}))
+		table.setCapacity(0)
+		Expect(table.entries).To(BeEmpty())
+		Expect(table.size).To(BeZero())
+		Expect(table.insertCount()).To(BeEquivalentTo(2))
+	})
+})
@@ -0,0 +1,351 @@
+package qpack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// An Encoder encodes field sections.
+// It inserts header fields into the dynamic table by writing instructions to the encoder stream,
+// and processes the acknowledgements received on the peer's decoder stream.
+// It is safe for concurrent use.
+type Encoder struct {
+	mutex sync.Mutex
+
+	w io.Writer // the encoder stream
+
+	maxCapacity       uint64 // the maximum capacity of the dynamic table we're willing to use
+	peerSettingsSet   bool
+	maxTableCapacity  uint64 // the peer's SETTINGS_QPACK_MAX_TABLE_CAPACITY
+	maxBlockedStreams int    // the peer's SETTINGS_QPACK_BLOCKED_STREAMS
+
+	table              dynamicTable
+	knownReceivedCount uint64
+	fieldIndex         map[HeaderField]uint64 // the absolute index of the latest entry for a header field
+	nameIndex          map[string]uint64      // the absolute index of the latest entry with a name
+	references         map[uint64]int         // number of references from unacknowledged field sections, by absolute index
+	// unacknowledged field sections that reference the dynamic table, by stream ID
+	sections map[uint64][]*fieldSection
+	// data received on the decoder stream that doesn't contain a full instruction yet
+	decoderStreamBuf []byte
+}
+
+type fieldSection struct {
+	requiredInsertCount uint64
+	references          []uint64 // the absolute indices of the referenced entries
+}
+
+// NewEncoder creates a new Encoder.
+// The capacity of the dynamic table is limited to maxCapacity.
+// Until SetPeerSettings is called, only the static table is used.
+// Encoder stream instructions are written to w. If maxCapacity is 0, nothing is ever written, and w may be nil.
+func NewEncoder(w io.Writer, maxCapacity uint64) *Encoder {
+	return &Encoder{
+		w:           w,
+		maxCapacity: maxCapacity,
+		fieldIndex:  make(map[HeaderField]uint64),
+		nameIndex:   make(map[string]uint64),
+		references:  make(map[uint64]int),
+		sections:    make(map[uint64][]*fieldSection),
+	}
+}
+
+// SetPeerSettings sets the values of the peer's SETTINGS_QPACK_MAX_TABLE_CAPACITY and SETTINGS_QPACK_BLOCKED_STREAMS settings.
+// It enables the use of the dynamic table, and must only be called once.
+func (e *Encoder) SetPeerSettings(maxTableCapacity uint64, maxBlockedStreams int) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.peerSettingsSet {
+		return errors.New("qpack: peer settings already set")
+	}
+	e.peerSettingsSet = true
+	e.maxTableCapacity = maxTableCapacity
+	e.maxBlockedStreams = maxBlockedStreams
+	capacity := e.maxCapacity
+	if maxTableCapacity < capacity {
+		capacity = maxTableCapacity
+	}
+	if capacity == 0 {
+		return nil
+	}
+	e.table.setCapacity(capacity)
+	// Set Dynamic Table Capacity
+	return e.writeInstruction(appendInt(nil, 0x20, 5, capacity))
+}
+
+// EncodeFieldSection encodes the header fields sent on a stream.
+// Instructions for the encoder stream are written before EncodeFieldSection returns.
+func (e *Encoder) EncodeFieldSection(streamID uint64, fields []HeaderField) ([]byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Entries that have not been acknowledged yet may only be referenced if that doesn't block
+	// more streams than allowed by the peer.
+	canBlock := e.isBlocking(streamID) || e.numBlockingStreams() < e.maxBlockedStreams
+
+	type fieldLine struct {
+		hf          HeaderField
+		isStatic    bool
+		isReference bool // if false, this is a literal
+		index       uint64
+		hasName     bool // for literals: if true, this is a literal with name reference
+	}
+	var instructions []byte
+	section := &fieldSection{}
+	reference := func(abs uint64) {
+		section.references = append(section.references, abs)
+		e.references[abs]++
+		if abs+1 > section.requiredInsertCount {
+			section.requiredInsertCount = abs + 1
+		}
+	}
+
+	lines := make([]fieldLine, 0, len(fields))
+	for _, hf := range fields {
+		if i, ok := staticTableFieldIndex[hf]; ok {
+			lines = append(lines, fieldLine{hf: hf, isStatic: true, isReference: true, index: i})
+			continue
+		}
+		if abs, ok := e.fieldIndex[hf]; ok && (abs < e.knownReceivedCount || canBlock) {
+			reference(abs)
+			lines = append(lines, fieldLine{hf: hf, isReference: true, index: abs})
+			continue
+		}
+		if e.shouldIndex(hf) && e.makeRoom(hf.size()) {
+			instructions = e.appendInsert(instructions, hf)
+			if canBlock {
+				abs := e.table.insertCount() - 1
+				reference(abs)
+				lines = append(lines, fieldLine{hf: hf, isReference: true, index: abs})
+				continue
+			}
+		}
+		line := fieldLine{hf: hf}
+		if i, ok := staticTableNameIndex[hf.Name]; ok {
+			line.hasName = true
+			line.isStatic = true
+			line.index = i
+		} else if abs, ok := e.nameIndex[hf.Name]; ok && (abs < e.knownReceivedCount || canBlock) {
+			reference(abs)
+			line.hasName = true
+			line.index = abs
+		}
+		lines = append(lines, line)
+	}
+
+	if len(instructions) > 0 {
+		if err := e.writeInstruction(instructions); err != nil {
+			return nil, err
+		}
+	}
+
+	// All entries were inserted before encoding the field lines, so we don't need post-base indices.
+	base := e.table.insertCount()
+	b := e.appendPrefix(nil, section.requiredInsertCount, base)
+	for _, l := range lines {
+		switch {
+		case l.isReference && l.isStatic: // Indexed Field Line, static table
+			b = appendInt(b, 0xc0, 6, l.index)
+		case l.isReference: // Indexed Field Line, dynamic table
+			b = appendInt(b, 0x80, 6, base-1-l.index)
+		case l.hasName && l.isStatic: // Literal Field Line with Name Reference, static table
+			b = appendInt(b, 0x50, 4, l.index)
+			b = appendString(b, 0x0, 7, l.hf.Value)
+		case l.hasName: // Literal Field Line with Name Reference, dynamic table
+			b = appendInt(b, 0x40, 4, base-1-l.index)
+			b = appendString(b, 0x0, 7, l.hf.Value)
+		default: // Literal Field Line with Literal Name
+			b = appendString(b, 0x20, 3, l.hf.Name)
+			b = appendString(b, 0x0, 7, l.hf.Value)
+		}
+	}
+	if section.requiredInsertCount > 0 {
+		e.sections[streamID] = append(e.sections[streamID], section)
+	}
+	return b, nil
+}
+
+// appendPrefix appends the field section prefix, see RFC 9204, section 4.5.1.
+func (e *Encoder) appendPrefix(b []byte, requiredInsertCount, base uint64) []byte {
+	if requiredInsertCount == 0 {
+		return append(b, 0x0, 0x0)
+	}
+	maxEntries := e.maxTableCapacity / 32
+	b = appendInt(b, 0x0, 8, requiredInsertCount%(2*maxEntries)+1)
+	// The base is never smaller than the Required Insert Count, so the sign bit is always 0.
+	return appendInt(b, 0x0, 7, base-requiredInsertCount)
+}
+
+// shouldIndex decides if a header field is inserted into the dynamic table.
+func (e *Encoder) shouldIndex(hf HeaderField) bool {
+	// Large entries would evict too many other entries.
+	return hf.size() <= e.table.capacity/2
+}
+
+// makeRoom evicts entries to make room for a new entry of the given size.
+// It returns false if that's not possible without evicting entries that are still in use.
+func (e *Encoder) makeRoom(size uint64) bool {
+	if size > e.table.capacity {
+		return false
+	}
+	// check that we can evict enough entries
+	available := e.table.capacity - e.table.size
+	for abs := e.table.dropped; available < size; abs++ {
+		if !e.isEvictable(abs) {
+			return false
+		}
+		hf, _ := e.table.get(abs)
+		available += hf.size()
+	}
+	for e.table.capacity-e.table.size < size {
+		e.evictOldest()
+	}
+	return true
+}
+
+// An entry can be evicted once its insertion has been acknowledged,
+// and it is not referenced by any unacknowledged field sections.
+func (e *Encoder) isEvictable(abs uint64) bool {
+	return abs < e.knownReceivedCount && e.references[abs] == 0
+}
+
+func (e *Encoder) evictOldest() {
+	abs := e.table.dropped
+	hf := e.table.oldest()
+	if i, ok := e.fieldIndex[hf]; ok && i == abs {
+		delete(e.fieldIndex, hf)
+	}
+	if i, ok := e.nameIndex[hf.Name]; ok && i == abs {
+		delete(e.nameIndex, hf.Name)
+	}
+	e.table.evictOldest()
+}
+
+// appendInsert inserts a header field into the dynamic table, and appends the encoder stream instruction.
+// The caller has to make sure that there's room for the entry.
+func (e *Encoder) appendInsert(b []byte, hf HeaderField) []byte {
+	if i, ok := staticTableNameIndex[hf.Name]; ok {
+		// Insert with Name Reference, static table
+		b = appendInt(b, 0xc0, 6, i)
+		b = appendString(b, 0x0, 7, hf.Value)
+	} else if abs, ok := e.nameIndex[hf.Name]; ok {
+		// Insert with Name Reference, dynamic table.
+		// The entry can be referenced even if this insertion evicts it.
+		b = appendInt(b, 0x80, 6, e.table.insertCount()-1-abs)
+		b = appendString(b, 0x0, 7, hf.Value)
+	} else {
+		// Insert with Literal Name
+		b = appendString(b, 0x40, 5, hf.Name)
+		b = appendString(b, 0x0, 7, hf.Value)
+	}
+	abs := e.table.insertCount()
+	e.table.insert(hf)
+	e.fieldIndex[hf] = abs
+	e.nameIndex[hf.Name] = abs
+	return b
+}
+
+// isBlocking says if the stream has unacknowledged field sections that reference entries
+// whose insertion hasn't been acknowledged yet.
+func (e *Encoder) isBlocking(streamID uint64) bool {
+	for _, s := range e.sections[streamID] {
+		if s.requiredInsertCount > e.knownReceivedCount {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Encoder) numBlockingStreams() int {
+	var n int
+	for id := range e.sections {
+		if e.isBlocking(id) {
+			n++
+		}
+	}
+	return n
+}
+
+// HandleDecoderStream processes data received on the decoder stream.
+// Instructions may be split across multiple calls.
+// An error is a connection error of type QPACK_DECODER_STREAM_ERROR.
+func (e *Encoder) HandleDecoderStream(p []byte) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.decoderStreamBuf = append(e.decoderStreamBuf, p...)
+	buf := e.decoderStreamBuf
+	for len(buf) > 0 {
+		rest, err := e.parseDecoderInstruction(buf)
+		if err == errNeedMore {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		buf = rest
+	}
+	e.decoderStreamBuf = append(e.decoderStreamBuf[:0], buf...)
+	return nil
+}
+
+func (e *Encoder) parseDecoderInstruction(p []byte) ([]byte, error) {
+	switch {
+	case p[0]&0x80 > 0: // Section Acknowledgment
+		streamID, p, err := readInt(p, 7)
+		if err != nil {
+			return nil, err
+		}
+		sections := e.sections[streamID]
+		if len(sections) == 0 {
+			return nil, fmt.Errorf("received Section Acknowledgment for stream %d without outstanding field sections", streamID)
+		}
+		e.releaseReferences(sections[0])
+		if sections[0].requiredInsertCount > e.knownReceivedCount {
+			e.knownReceivedCount = sections[0].requiredInsertCount
+		}
+		if len(sections) == 1 {
+			delete(e.sections, streamID)
+		} else {
+			e.sections[streamID] = sections[1:]
+		}
+		return p, nil
+	case p[0]&0xc0 == 0x40: // Stream Cancellation
+		streamID, p, err := readInt(p, 6)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range e.sections[streamID] {
+			e.releaseReferences(s)
+		}
+		delete(e.sections, streamID)
+		return p, nil
+	default: // Insert Count Increment
+		increment, p, err := readInt(p, 6)
+		if err != nil {
+			return nil, err
+		}
+		if increment == 0 || e.knownReceivedCount+increment > e.table.insertCount() {
+			return nil, fmt.Errorf("invalid Insert Count Increment %d", increment)
+		}
+		e.knownReceivedCount += increment
+		return p, nil
+	}
+}
+
+func (e *Encoder) releaseReferences(s *fieldSection) {
+	for _, abs := range s.references {
+		e.references[abs]--
+		if e.references[abs] == 0 {
+			delete(e.references, abs)
+		}
+	}
+}
+
+func (e *Encoder) writeInstruction(b []byte) error {
+	_, err := e.w.Write(b)
+	return err
+}
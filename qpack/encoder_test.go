@@ -0,0 +1,229 @@
+package qpack
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encoder", func() {
+	var (
+		encoder                      *Encoder
+		decoder                      *Decoder
+		encoderStream, decoderStream *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		encoderStream = &bytes.Buffer{}
+		decoderStream = &bytes.Buffer{}
+		encoder = NewEncoder(encoderStream, 4096)
+		decoder = NewDecoder(4096, 10, decoderStream)
+	})
+
+	// transferEncoderStream passes the encoder stream data to the decoder
+	transferEncoderStream := func() {
+		ExpectWithOffset(1, decoder.HandleEncoderStream(encoderStream.Bytes())).To(Succeed())
+		encoderStream.Reset()
+	}
+
+	// transferDecoderStream passes the decoder stream data to the encoder
+	transferDecoderStream := func() {
+		ExpectWithOffset(1, encoder.HandleDecoderStream(decoderStream.Bytes())).To(Succeed())
+		decoderStream.Reset()
+	}
+
+	decode := func(streamID uint64, data []byte) []HeaderField {
+		fields, err := decoder.DecodeFieldSection(context.Background(), streamID, data)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return fields
+	}
+
+	fields := []HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":path", Value: "/index.html"},
+		{Name: "foo", Value: "bar"},
+		{Name: "user-agent", Value: "quic-go"},
+	}
+
+	It("only uses the static table before the peer's settings are received", func() {
+		data, err := encoder.EncodeFieldSection(0, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoderStream.Len()).To(BeZero())
+		Expect(data[:2]).To(Equal([]byte{0x0, 0x0}))
+		Expect(data[2]).To(Equal(byte(0xc0 | 17))) // :method GET
+		Expect(NewDecoder(0, 0, nil).DecodeFieldSection(context.Background(), 0, data)).To(Equal(fields))
+	})
+
+	It("sets the dynamic table capacity", func() {
+		Expect(encoder.SetPeerSettings(1000, 0)).To(Succeed())
+		Expect(encoderStream.Bytes()).To(Equal(appendInt(nil, 0x20, 5, 1000)))
+		Expect(encoder.table.capacity).To(BeEquivalentTo(1000))
+	})
+
+	It("doesn't use a larger dynamic table than configured", func() {
+		Expect(encoder.SetPeerSettings(1<<20, 0)).To(Succeed())
+		Expect(encoder.table.capacity).To(BeEquivalentTo(4096))
+	})
+
+	It("doesn't use the dynamic table if the peer doesn't allow it", func() {
+		Expect(encoder.SetPeerSettings(0, 100)).To(Succeed())
+		Expect(encoderStream.Len()).To(BeZero())
+		data, err := encoder.EncodeFieldSection(0, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoderStream.Len()).To(BeZero())
+		Expect(data[:2]).To(Equal([]byte{0x0, 0x0}))
+	})
+
+	It("errors when the peer settings are set twice", func() {
+		Expect(encoder.SetPeerSettings(100, 0)).To(Succeed())
+		Expect(encoder.SetPeerSettings(100, 0)).To(MatchError("qpack: peer settings already set"))
+	})
+
+	It("references inserted entries if it is allowed to block the stream", func() {
+		Expect(encoder.SetPeerSettings(4096, 10)).To(Succeed())
+		data, err := encoder.EncodeFieldSection(4, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(3)) // :method GET is in the static table
+		Expect(encoder.numBlockingStreams()).To(Equal(1))
+		Expect(data[0]).ToNot(BeZero())
+		// the field section can't be decoded before the encoder stream is received
+		fieldsChan := make(chan []HeaderField)
+		go func() {
+			defer GinkgoRecover()
+			fieldsChan <- decode(4, data)
+		}()
+		Consistently(fieldsChan).ShouldNot(Receive())
+		transferEncoderStream()
+		Eventually(fieldsChan).Should(Receive(Equal(fields)))
+		transferDecoderStream()
+		Expect(encoder.knownReceivedCount).To(BeEquivalentTo(3))
+		Expect(encoder.numBlockingStreams()).To(BeZero())
+		Expect(encoder.references).To(BeEmpty())
+	})
+
+	It("only references acknowledged entries if it is not allowed to block the stream", func() {
+		Expect(encoder.SetPeerSettings(4096, 0)).To(Succeed())
+		data1, err := encoder.EncodeFieldSection(4, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data1[:2]).To(Equal([]byte{0x0, 0x0}))
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(3))
+		Expect(decode(4, data1)).To(Equal(fields))
+		transferEncoderStream()
+		transferDecoderStream()
+		// now the entries have been acknowledged, and can be used
+		data2, err := encoder.EncodeFieldSection(8, fields)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(data2)).To(BeNumerically("<", len(data1)))
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(3))
+		Expect(decode(8, data2)).To(Equal(fields))
+		transferDecoderStream()
+		Expect(encoder.sections).To(BeEmpty())
+	})
+
+	It("respects the limit on the number of blocked streams", func() {
+		Expect(encoder.SetPeerSettings(4096, 1)).To(Succeed())
+		_, err := encoder.EncodeFieldSection(4, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder.numBlockingStreams()).To(Equal(1))
+		// stream 8 is not allowed to block
+		data, err := encoder.EncodeFieldSection(8, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data[:2]).To(Equal([]byte{0x0, 0x0}))
+		// stream 4 is already blocking
+		data, err = encoder.EncodeFieldSection(4, []HeaderField{{Name: "foo", Value: "baz"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data[0]).ToNot(BeZero())
+		Expect(encoder.numBlockingStreams()).To(Equal(1))
+		Expect(encoder.sections[4]).To(HaveLen(2))
+	})
+
+	It("uses dynamic table entries for name references", func() {
+		Expect(encoder.SetPeerSettings(4096, 10)).To(Succeed())
+		data, err := encoder.EncodeFieldSection(4, []HeaderField{{Name: "foo", Value: "bar"}})
+		Expect(err).ToNot(HaveOccurred())
+		transferEncoderStream()
+		Expect(decode(4, data)).To(Equal([]HeaderField{{Name: "foo", Value: "bar"}}))
+		transferDecoderStream()
+		// a value that is too large to be indexed
+		large := HeaderField{Name: "foo", Value: string(bytes.Repeat([]byte{'a'}, 2048))}
+		data, err = encoder.EncodeFieldSection(8, []HeaderField{large})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoderStream.Len()).To(BeZero())
+		Expect(data[2] & 0xf0).To(Equal(byte(0x40))) // Literal Field Line with Name Reference, dynamic table
+		Expect(decode(8, data)).To(Equal([]HeaderField{large}))
+	})
+
+	It("doesn't evict entries that are still referenced", func() {
+		// room for 2 entries of size 35
+		encoder = NewEncoder(encoderStream, 70)
+		decoder = NewDecoder(70, 10, decoderStream)
+		Expect(encoder.SetPeerSettings(70, 10)).To(Succeed())
+		_, err := encoder.EncodeFieldSection(4, []HeaderField{{Name: "a", Value: "b"}})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = encoder.EncodeFieldSection(8, []HeaderField{{Name: "c", Value: "d"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(2))
+		// The table is full, and both entries are referenced by unacknowledged field sections.
+		data, err := encoder.EncodeFieldSection(12, []HeaderField{{Name: "e", Value: "f"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(2))
+		Expect(data).To(Equal([]byte{0x0, 0x0, 0x20 | 1, 'e', 1, 'f'}))
+		// Once the stream is canceled, the first entry can be evicted.
+		Expect(encoder.HandleDecoderStream([]byte{0x40 | 4, 0x2})).To(Succeed()) // Stream Cancellation, Insert Count Increment
+		_, err = encoder.EncodeFieldSection(12, []HeaderField{{Name: "e", Value: "f"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(3))
+		Expect(encoder.table.dropped).To(BeEquivalentTo(1))
+		Expect(encoder.fieldIndex).ToNot(HaveKey(HeaderField{Name: "a", Value: "b"}))
+	})
+
+	It("handles Required Insert Counts that wrap around", func() {
+		// the table holds 3 entries of size 33, so the Required Insert Count is encoded modulo 6
+		encoder = NewEncoder(encoderStream, 100)
+		decoder = NewDecoder(100, 10, decoderStream)
+		Expect(encoder.SetPeerSettings(100, 10)).To(Succeed())
+		for i := 0; i < 20; i++ {
+			hf := []HeaderField{{Name: string('a' + byte(i)), Value: ""}}
+			data, err := encoder.EncodeFieldSection(uint64(4*i), hf)
+			Expect(err).ToNot(HaveOccurred())
+			transferEncoderStream()
+			Expect(decode(uint64(4*i), data)).To(Equal(hf))
+			transferDecoderStream()
+		}
+		Expect(encoder.table.insertCount()).To(BeEquivalentTo(20))
+	})
+
+	Context("handling the decoder stream", func() {
+		BeforeEach(func() {
+			Expect(encoder.SetPeerSettings(4096, 10)).To(Succeed())
+		})
+
+		It("processes instructions split across multiple calls", func() {
+			_, err := encoder.EncodeFieldSection(1000, fields)
+			Expect(err).ToNot(HaveOccurred())
+			b := appendInt(nil, 0x80, 7, 1000)
+			Expect(b).To(HaveLen(3))
+			for _, c := range b {
+				Expect(encoder.HandleDecoderStream([]byte{c})).To(Succeed())
+			}
+			Expect(encoder.sections).To(BeEmpty())
+			Expect(encoder.knownReceivedCount).To(BeEquivalentTo(3))
+		})
+
+		It("errors on Section Acknowledgments for streams without outstanding field sections", func() {
+			Expect(encoder.HandleDecoderStream([]byte{0x80 | 4})).To(MatchError("received Section Acknowledgment for stream 4 without outstanding field sections"))
+		})
+
+		It("errors on Insert Count Increments of 0", func() {
+			Expect(encoder.HandleDecoderStream([]byte{0x0})).To(MatchError("invalid Insert Count Increment 0"))
+		})
+
+		It("errors on Insert Count Increments beyond the insert count", func() {
+			_, err := encoder.EncodeFieldSection(4, fields)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.HandleDecoderStream([]byte{0x4})).To(MatchError("invalid Insert Count Increment 4"))
+		})
+	})
+})
@@ -0,0 +1,226 @@
+package qpack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The interop files use the format defined by the QPACK Offline Interop project (https://github.com/qpackers/qifs).
+// A QIF file contains the header fields of a sequence of requests (or responses).
+// The encoded files contain the output of an encoder, using the table size, the number of blocked streams,
+// and the acknowledgement mode encoded in the file name: <qif name>.out.<table size>.<blocked streams>.<ack mode>
+
+func readQIF(name string) [][]HeaderField {
+	f, err := os.Open(filepath.Join("testdata", "qifs", name+".qif"))
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	defer f.Close()
+	var requests [][]HeaderField
+	var fields []HeaderField
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) == 0 {
+			if len(fields) > 0 {
+				requests = append(requests, fields)
+			}
+			fields = nil
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 2)
+		ExpectWithOffset(1, parts).To(HaveLen(2))
+		fields = append(fields, HeaderField{Name: parts[0], Value: parts[1]})
+	}
+	ExpectWithOffset(1, scanner.Err()).ToNot(HaveOccurred())
+	if len(fields) > 0 {
+		requests = append(requests, fields)
+	}
+	return requests
+}
+
+type encodedBlock struct {
+	streamID uint64 // stream 0 is the encoder stream
+	data     []byte
+}
+
+func readEncodedFile(path string) []encodedBlock {
+	data, err := ioutil.ReadFile(path)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	r := bytes.NewReader(data)
+	var blocks []encodedBlock
+	for r.Len() > 0 {
+		var hdr struct {
+			StreamID uint64
+			Length   uint32
+		}
+		ExpectWithOffset(1, binary.Read(r, binary.BigEndian, &hdr)).To(Succeed())
+		b := make([]byte, hdr.Length)
+		_, err := io.ReadFull(r, b)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		blocks = append(blocks, encodedBlock{streamID: hdr.StreamID, data: b})
+	}
+	return blocks
+}
+
+// decodeAsync decodes a field section in a new go routine.
+// It returns once the stream is either blocked or decoded.
+func decodeAsync(decoder *Decoder, streamID uint64, data []byte) <-chan []HeaderField {
+	c := make(chan []HeaderField, 1)
+	go func() {
+		defer GinkgoRecover()
+		fields, err := decoder.DecodeFieldSection(context.Background(), streamID, data)
+		Expect(err).ToNot(HaveOccurred())
+		c <- fields
+	}()
+	Eventually(func() bool {
+		if len(c) > 0 {
+			return true
+		}
+		decoder.mutex.Lock()
+		defer decoder.mutex.Unlock()
+		_, ok := decoder.blockedStreams[streamID]
+		return ok
+	}, time.Second, 100*time.Microsecond).Should(BeTrue())
+	return c
+}
+
+var _ = Describe("Interop", func() {
+	Context("decoding the published encoded files", func() {
+		// The qifs repository groups the encoded files by encoder: testdata/encoded/<encoder>/<file>.
+		// TODO: add the files of at least one independent encoder using the dynamic table and blocked streams,
+		// e.g. fb-req-hq.out.4096.100.0 and fb-req-hq.out.4096.100.1.
+		// Until then, only the static table is covered by files that were not produced by this package.
+		files, err := filepath.Glob(filepath.Join("testdata", "encoded", "*"))
+		if err != nil {
+			panic(err)
+		}
+		encoderFiles, err := filepath.Glob(filepath.Join("testdata", "encoded", "*", "*"))
+		if err != nil {
+			panic(err)
+		}
+		files = append(files, encoderFiles...)
+
+		var numFiles int
+		for _, file := range files {
+			path := file
+			if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+				continue
+			}
+			numFiles++
+			parts := strings.Split(filepath.Base(path), ".")
+			if len(parts) != 5 || parts[1] != "out" {
+				panic(fmt.Sprintf("unexpected file name: %s", path))
+			}
+			qifName := parts[0]
+			tableSize, err := strconv.ParseUint(parts[2], 10, 64)
+			if err != nil {
+				panic(err)
+			}
+			maxBlocked, err := strconv.Atoi(parts[3])
+			if err != nil {
+				panic(err)
+			}
+
+			name, err := filepath.Rel(filepath.Join("testdata", "encoded"), path)
+			if err != nil {
+				panic(err)
+			}
+
+			It(fmt.Sprintf("decodes %s", name), func() {
+				requests := readQIF(qifName)
+				decoder := NewDecoder(tableSize, maxBlocked, ioutil.Discard)
+				results := make(map[uint64]<-chan []HeaderField)
+				for _, b := range readEncodedFile(path) {
+					if b.streamID == 0 {
+						Expect(decoder.HandleEncoderStream(b.data)).To(Succeed())
+						continue
+					}
+					results[b.streamID] = decodeAsync(decoder, b.streamID, b.data)
+				}
+				Expect(results).To(HaveLen(len(requests)))
+				streamIDs := make([]uint64, 0, len(results))
+				for id := range results {
+					streamIDs = append(streamIDs, id)
+				}
+				sort.Slice(streamIDs, func(i, j int) bool { return streamIDs[i] < streamIDs[j] })
+				for i, id := range streamIDs {
+					var fields []HeaderField
+					Eventually(results[id], time.Second, 100*time.Microsecond).Should(Receive(&fields))
+					Expect(fields).To(Equal(requests[i]))
+				}
+			})
+		}
+
+		// Make sure that the test doesn't silently pass when the files are missing, e.g. due to a moved directory.
+		It("finds the encoded files", func() {
+			Expect(numFiles).ToNot(BeZero())
+		})
+	})
+
+	Context("encoding and decoding", func() {
+		for _, s := range []struct {
+			tableSize  uint64
+			maxBlocked int
+			ackEvery   int // the number of requests after which the decoder stream is passed to the encoder
+		}{
+			{tableSize: 0, maxBlocked: 0, ackEvery: 1},
+			{tableSize: 256, maxBlocked: 0, ackEvery: 1},
+			{tableSize: 256, maxBlocked: 100, ackEvery: 1},
+			{tableSize: 4096, maxBlocked: 0, ackEvery: 1},
+			{tableSize: 4096, maxBlocked: 0, ackEvery: 10},
+			{tableSize: 4096, maxBlocked: 100, ackEvery: 1},
+			{tableSize: 4096, maxBlocked: 3, ackEvery: 10},
+		} {
+			settings := s
+
+			It(fmt.Sprintf("encodes fb-req-hq, table size %d, %d blocked streams, acknowledging every %d requests", settings.tableSize, settings.maxBlocked, settings.ackEvery), func() {
+				requests := readQIF("fb-req-hq")
+				encoderStream := &bytes.Buffer{}
+				decoderStream := &bytes.Buffer{}
+				encoder := NewEncoder(encoderStream, settings.tableSize)
+				Expect(encoder.SetPeerSettings(settings.tableSize, settings.maxBlocked)).To(Succeed())
+				decoder := NewDecoder(settings.tableSize, settings.maxBlocked, decoderStream)
+				Expect(decoder.HandleEncoderStream(encoderStream.Bytes())).To(Succeed())
+				encoderStream.Reset()
+
+				var compressed, uncompressed int
+				for i, fields := range requests {
+					streamID := uint64(4 * i)
+					data, err := encoder.EncodeFieldSection(streamID, fields)
+					Expect(err).ToNot(HaveOccurred())
+					compressed += len(data) + encoderStream.Len()
+					for _, hf := range fields {
+						uncompressed += len(hf.Name) + len(hf.Value)
+					}
+					// Deliver the field section before the encoder stream, so that streams are blocked.
+					c := decodeAsync(decoder, streamID, data)
+					Expect(decoder.HandleEncoderStream(encoderStream.Bytes())).To(Succeed())
+					encoderStream.Reset()
+					Eventually(c, time.Second, 100*time.Microsecond).Should(Receive(Equal(fields)))
+					if (i+1)%settings.ackEvery == 0 {
+						Expect(encoder.HandleDecoderStream(decoderStream.Bytes())).To(Succeed())
+						decoderStream.Reset()
+					}
+				}
+				Expect(compressed).To(BeNumerically("<", uncompressed))
+			})
+		}
+	})
+})
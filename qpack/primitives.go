@@ -0,0 +1,92 @@
+package qpack
+
+import (
+	"errors"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// appendInt appends an integer with an n-bit prefix, see RFC 7541, section 5.1.
+// The flags are stored in the bits of the first byte that are not used by the prefix.
+func appendInt(b []byte, flags byte, n uint8, i uint64) []byte {
+	k := uint64(1)<<n - 1
+	if i < k {
+		return append(b, flags|byte(i))
+	}
+	b = append(b, flags|byte(k))
+	i -= k
+	for ; i >= 0x80; i >>= 7 {
+		b = append(b, byte(0x80|i&0x7f))
+	}
+	return append(b, byte(i))
+}
+
+// readInt reads an integer with an n-bit prefix.
+// It returns errNeedMore if p is truncated.
+func readInt(p []byte, n uint8) (uint64, []byte, error) {
+	if len(p) == 0 {
+		return 0, nil, errNeedMore
+	}
+	k := uint64(1)<<n - 1
+	i := uint64(p[0]) & k
+	p = p[1:]
+	if i < k {
+		return i, p, nil
+	}
+	var m uint
+	for len(p) > 0 {
+		b := p[0]
+		p = p[1:]
+		i += uint64(b&0x7f) << m
+		if b&0x80 == 0 {
+			return i, p, nil
+		}
+		m += 7
+		if m >= 63 {
+			return 0, nil, errors.New("integer overflow")
+		}
+	}
+	return 0, nil, errNeedMore
+}
+
+// appendString appends a string literal, with the length encoded using an n-bit prefix.
+// The bit preceding the prefix is the Huffman flag.
+// The string is Huffman encoded if that makes it shorter.
+func appendString(b []byte, flags byte, n uint8, s string) []byte {
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendInt(b, flags|1<<n, n, l)
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendInt(b, flags, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a string literal, with the length encoded using an n-bit prefix.
+// If the (encoded) length of the string exceeds maxLen, an error is returned.
+// It returns errNeedMore if p is truncated.
+func readString(p []byte, n uint8, maxLen uint64) (string, []byte, error) {
+	if len(p) == 0 {
+		return "", nil, errNeedMore
+	}
+	huffman := p[0]&(1<<n) > 0
+	l, p, err := readInt(p, n)
+	if err != nil {
+		return "", nil, err
+	}
+	if l > maxLen {
+		return "", nil, errors.New("string literal too long")
+	}
+	if uint64(len(p)) < l {
+		return "", nil, errNeedMore
+	}
+	data := p[:l]
+	p = p[l:]
+	if !huffman {
+		return string(data), p, nil
+	}
+	s, err := hpack.HuffmanDecodeToString(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return s, p, nil
+}
@@ -0,0 +1,101 @@
+package qpack
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Primitives", func() {
+	Context("integers", func() {
+		// examples from RFC 7541, appendix C.1
+		It("encodes and decodes 10 with a 5-bit prefix", func() {
+			b := appendInt(nil, 0xe0, 5, 10)
+			Expect(b).To(Equal([]byte{0xea}))
+			i, rest, err := readInt(b, 5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i).To(BeEquivalentTo(10))
+			Expect(rest).To(BeEmpty())
+		})
+
+		It("encodes and decodes 1337 with a 5-bit prefix", func() {
+			b := appendInt(nil, 0x0, 5, 1337)
+			Expect(b).To(Equal([]byte{0x1f, 0x9a, 0x0a}))
+			i, rest, err := readInt(append(b, 0x42), 5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i).To(BeEquivalentTo(1337))
+			Expect(rest).To(Equal([]byte{0x42}))
+		})
+
+		It("encodes and decodes 42 with an 8-bit prefix", func() {
+			b := appendInt(nil, 0x0, 8, 42)
+			Expect(b).To(Equal([]byte{42}))
+			i, _, err := readInt(b, 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i).To(BeEquivalentTo(42))
+		})
+
+		It("returns errNeedMore on truncated integers", func() {
+			b := appendInt(nil, 0x0, 5, 1337)
+			for i := range b {
+				_, _, err := readInt(b[:i], 5)
+				Expect(err).To(MatchError(errNeedMore))
+			}
+		})
+
+		It("errors on integer overflows", func() {
+			_, _, err := readInt([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x1}, 8)
+			Expect(err).To(MatchError("integer overflow"))
+		})
+	})
+
+	Context("strings", func() {
+		It("encodes and decodes strings", func() {
+			// Huffman encoding doesn't make this string shorter
+			b := appendString(nil, 0x20, 3, "QUIC")
+			Expect(b).To(Equal([]byte{0x20 | 4, 'Q', 'U', 'I', 'C'}))
+			s, rest, err := readString(b, 3, noLimit)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal("QUIC"))
+			Expect(rest).To(BeEmpty())
+		})
+
+		It("uses Huffman encoding, if that makes the string shorter", func() {
+			b := appendString(nil, 0x0, 7, "www.example.com")
+			// example from RFC 7541, appendix C.4.1
+			Expect(b).To(Equal([]byte{0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff}))
+			s, _, err := readString(b, 7, noLimit)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal("www.example.com"))
+		})
+
+		It("doesn't use Huffman encoding, if that makes the string longer", func() {
+			s := strings.Repeat("\x00", 100)
+			b := appendString(nil, 0x0, 7, s)
+			Expect(b[0] & 0x80).To(BeZero())
+			decoded, _, err := readString(b, 7, noLimit)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(s))
+		})
+
+		It("returns errNeedMore on truncated strings", func() {
+			b := appendString(nil, 0x0, 7, "foobar")
+			for i := range b {
+				_, _, err := readString(b[:i], 7, noLimit)
+				Expect(err).To(MatchError(errNeedMore))
+			}
+		})
+
+		It("rejects strings that are too long", func() {
+			b := appendString(nil, 0x0, 7, "QUIC")
+			_, _, err := readString(b, 7, 3)
+			Expect(err).To(MatchError("string literal too long"))
+		})
+
+		It("errors on invalid Huffman encodings", func() {
+			_, _, err := readString([]byte{0x80 | 2, 0xff, 0xff}, 7, noLimit)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,32 @@
+// Package qpack implements QPACK, the field compression format for HTTP/3 (RFC 9204).
+//
+// An Encoder compresses the header fields sent by an endpoint, and a Decoder decompresses the header fields received from the peer.
+// Both the static and the dynamic table are supported.
+// The dynamic table is updated using instructions sent on the encoder stream,
+// and the decoder acknowledges field sections and table updates on the decoder stream.
+// The package doesn't open or read any streams itself:
+// Instructions for the peer are written to the io.Writer passed to NewEncoder and NewDecoder,
+// and instructions received from the peer are passed to Encoder.HandleDecoderStream and Decoder.HandleEncoderStream.
+package qpack
+
+import "errors"
+
+// A HeaderField is a name-value pair.
+// Names are expected to be lower case.
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// IsPseudo reports whether the header field is a pseudo header field.
+func (hf HeaderField) IsPseudo() bool {
+	return len(hf.Name) > 0 && hf.Name[0] == ':'
+}
+
+// size is the size of a dynamic table entry, see RFC 9204, section 3.2.1.
+func (hf HeaderField) size() uint64 {
+	return uint64(len(hf.Name)+len(hf.Value)) + 32
+}
+
+// errNeedMore is returned by the parsing functions if the input was truncated.
+var errNeedMore = errors.New("qpack: need more data")
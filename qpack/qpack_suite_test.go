@@ -0,0 +1,13 @@
+package qpack
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestQPACK(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "QPACK Suite")
+}
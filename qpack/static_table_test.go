@@ -0,0 +1,21 @@
+package qpack
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Static Table", func() {
+	It("has the right entries", func() {
+		Expect(staticTable).To(HaveLen(99))
+		Expect(staticTable[0]).To(Equal(HeaderField{Name: ":authority"}))
+		Expect(staticTable[17]).To(Equal(HeaderField{Name: ":method", Value: "GET"}))
+		Expect(staticTable[25]).To(Equal(HeaderField{Name: ":status", Value: "200"}))
+		Expect(staticTable[98]).To(Equal(HeaderField{Name: "x-frame-options", Value: "sameorigin"}))
+	})
+
+	It("finds the first entry with a name", func() {
+		Expect(staticTableNameIndex[":method"]).To(BeEquivalentTo(15))
+		Expect(staticTableFieldIndex[HeaderField{Name: ":method", Value: "POST"}]).To(BeEquivalentTo(20))
+	})
+})
@@ -0,0 +1,59 @@
+package quiclb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Decoder extracts the server ID from connection IDs.
+// It is used by the load balancer, and is safe for concurrent use.
+type Decoder struct {
+	config Config
+	cipher *blockCipher
+}
+
+// NewDecoder creates a new Decoder.
+func NewDecoder(config *Config) (*Decoder, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	d := &Decoder{config: *config}
+	if config.Key != nil {
+		c, err := newBlockCipher(config.Key, config.ServerIDLen+config.NonceLen)
+		if err != nil {
+			return nil, err
+		}
+		d.cipher = c
+	}
+	return d, nil
+}
+
+// ConfigID returns the config ID encoded in a connection ID.
+// It can be used to select the Decoder if multiple configurations are in use.
+func ConfigID(connID []byte) (uint8, error) {
+	if len(connID) == 0 {
+		return 0, errors.New("quiclb: empty connection ID")
+	}
+	return connID[0] >> configIDShift, nil
+}
+
+// ServerID returns the server ID encoded in the connection ID.
+func (d *Decoder) ServerID(connID []byte) ([]byte, error) {
+	if len(connID) < d.config.ConnectionIDLen() {
+		return nil, fmt.Errorf("quiclb: connection ID too short: %d bytes", len(connID))
+	}
+	connID = connID[:d.config.ConnectionIDLen()]
+	if configID := connID[0] >> configIDShift; configID != d.config.ConfigID {
+		return nil, fmt.Errorf("quiclb: unexpected config ID: %d", configID)
+	}
+	if d.config.EncodeLength && int(connID[0]&lengthMask)+1 != len(connID) {
+		return nil, fmt.Errorf("quiclb: invalid connection ID length: %d", connID[0]&lengthMask+1)
+	}
+	plaintext := make([]byte, len(connID)-1)
+	if d.cipher != nil {
+		d.cipher.decrypt(plaintext, connID[1:])
+	} else {
+		copy(plaintext, connID[1:])
+	}
+	return plaintext[:d.config.ServerIDLen], nil
+}
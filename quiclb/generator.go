@@ -0,0 +1,64 @@
+package quiclb
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A Generator generates connection IDs that encode the server ID.
+// It is safe for concurrent use.
+type Generator struct {
+	config   Config
+	serverID []byte
+	cipher   *blockCipher
+}
+
+var _ quic.ConnectionIDGenerator = &Generator{}
+
+// NewGenerator creates a new Generator for the server with the given server ID.
+func NewGenerator(config *Config, serverID []byte) (*Generator, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if len(serverID) != config.ServerIDLen {
+		return nil, fmt.Errorf("quiclb: expected a %d byte server ID, got %d bytes", config.ServerIDLen, len(serverID))
+	}
+	g := &Generator{
+		config:   *config,
+		serverID: append([]byte(nil), serverID...),
+	}
+	if config.Key != nil {
+		c, err := newBlockCipher(config.Key, config.ServerIDLen+config.NonceLen)
+		if err != nil {
+			return nil, err
+		}
+		g.cipher = c
+	}
+	return g, nil
+}
+
+// GenerateConnectionID generates a new connection ID, using a random nonce.
+func (g *Generator) GenerateConnectionID() (quic.ConnectionID, error) {
+	connID := make([]byte, g.config.ConnectionIDLen())
+	if _, err := rand.Read(connID); err != nil {
+		return nil, err
+	}
+	// Unless the length is encoded, the lower bits of the first octet are random.
+	if g.config.EncodeLength {
+		connID[0] = uint8(len(connID) - 1)
+	}
+	connID[0] = g.config.ConfigID<<configIDShift | connID[0]&lengthMask
+	// the nonce is already filled with random bytes
+	copy(connID[1:], g.serverID)
+	if g.cipher != nil {
+		g.cipher.encrypt(connID[1:], connID[1:])
+	}
+	return quic.ConnectionID(connID), nil
+}
+
+// ConnectionIDLen returns the length of the connection IDs.
+func (g *Generator) ConnectionIDLen() int {
+	return g.config.ConnectionIDLen()
+}
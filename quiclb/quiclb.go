@@ -0,0 +1,175 @@
+// Package quiclb implements connection IDs that encode a server ID, as described in the QUIC-LB draft
+// (https://datatracker.ietf.org/doc/draft-ietf-quic-load-balancers/).
+// Servers use a Generator as the quic.Config.ConnectionIDGenerator,
+// and a load balancer uses a Decoder to extract the server ID from the connection ID of incoming packets.
+//
+// A connection ID consists of a first octet, followed by the server ID and a nonce.
+// The first 3 bits of the first octet contain the config ID, the remaining 5 bits are either random,
+// or encode the length of the connection ID.
+// If a key is configured, the server ID and the nonce are encrypted.
+package quiclb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MaxConfigID is the largest config ID. The config ID 0x7 is reserved for unroutable connection IDs.
+	MaxConfigID = 6
+	// MinNonceLen is the minimum length of the nonce.
+	MinNonceLen = 4
+	// MaxConnectionIDLen is the maximum length of a connection ID.
+	MaxConnectionIDLen = 20
+
+	configIDShift = 5
+	lengthMask    = 0x1f
+)
+
+// A Config is a QUIC-LB configuration.
+// Servers and the load balancer must use the same Config.
+type Config struct {
+	// ConfigID identifies the configuration.
+	// It allows rotating configurations without interrupting existing connections.
+	// It must not be larger than MaxConfigID.
+	ConfigID uint8
+	// ServerIDLen is the length of the server ID, between 1 and 15 bytes.
+	ServerIDLen int
+	// NonceLen is the length of the nonce, at least MinNonceLen bytes.
+	// Together, the server ID and the nonce must not be longer than 19 bytes.
+	NonceLen int
+	// Key is the 16 byte AES-128 key used to encrypt the server ID and the nonce.
+	// If nil, the server ID is encoded in plaintext.
+	Key []byte
+	// EncodeLength encodes the length of the connection ID in the first octet.
+	EncodeLength bool
+}
+
+// ConnectionIDLen returns the length of the connection IDs.
+func (c *Config) ConnectionIDLen() int {
+	return 1 + c.ServerIDLen + c.NonceLen
+}
+
+func (c *Config) validate() error {
+	if c.ConfigID > MaxConfigID {
+		return fmt.Errorf("quiclb: invalid config ID: %d", c.ConfigID)
+	}
+	if c.ServerIDLen < 1 || c.ServerIDLen > 15 {
+		return fmt.Errorf("quiclb: invalid server ID length: %d", c.ServerIDLen)
+	}
+	if c.NonceLen < MinNonceLen {
+		return fmt.Errorf("quiclb: nonce too short: %d", c.NonceLen)
+	}
+	if l := c.ConnectionIDLen(); l > MaxConnectionIDLen {
+		return fmt.Errorf("quiclb: connection ID too long: %d", l)
+	}
+	if c.Key != nil && len(c.Key) != 16 {
+		return errors.New("quiclb: the key must be 16 bytes long")
+	}
+	return nil
+}
+
+// A blockCipher encrypts and decrypts the server ID and nonce of a connection ID.
+// If the plaintext is 16 bytes long, it is encrypted using a single AES-128-ECB pass.
+// Otherwise, it is encrypted using the four-pass Feistel construction.
+type blockCipher struct {
+	block cipher.Block
+	// the length of server ID and nonce
+	plaintextLen int
+	halfLen      int
+}
+
+func newBlockCipher(key []byte, plaintextLen int) (*blockCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &blockCipher{
+		block:        block,
+		plaintextLen: plaintextLen,
+		halfLen:      (plaintextLen + 1) / 2,
+	}, nil
+}
+
+func (c *blockCipher) odd() bool { return c.plaintextLen%2 == 1 }
+
+func (c *blockCipher) encrypt(dst, src []byte) {
+	if c.plaintextLen == aes.BlockSize {
+		c.block.Encrypt(dst, src)
+		return
+	}
+	left, right := c.split(src)
+	c.xorRight(right, c.round(left, 1))
+	c.xorLeft(left, c.round(right, 2))
+	c.xorRight(right, c.round(left, 3))
+	c.xorLeft(left, c.round(right, 4))
+	c.join(dst, left, right)
+}
+
+func (c *blockCipher) decrypt(dst, src []byte) {
+	if c.plaintextLen == aes.BlockSize {
+		c.block.Decrypt(dst, src)
+		return
+	}
+	left, right := c.split(src)
+	c.xorLeft(left, c.round(right, 4))
+	c.xorRight(right, c.round(left, 3))
+	c.xorLeft(left, c.round(right, 2))
+	c.xorRight(right, c.round(left, 1))
+	c.join(dst, left, right)
+}
+
+// split splits the input into two halves.
+// For an odd length, the middle byte is split: the left half gets the high 4 bits, the right half the low 4 bits.
+func (c *blockCipher) split(b []byte) ([]byte, []byte) {
+	left := make([]byte, c.halfLen)
+	right := make([]byte, c.halfLen)
+	copy(left, b[:c.halfLen])
+	copy(right, b[c.plaintextLen-c.halfLen:c.plaintextLen])
+	if c.odd() {
+		left[c.halfLen-1] &= 0xf0
+		right[0] &= 0x0f
+	}
+	return left, right
+}
+
+func (c *blockCipher) join(dst, left, right []byte) {
+	copy(dst[c.plaintextLen-c.halfLen:], right)
+	if c.odd() {
+		dst[c.halfLen-1] = left[c.halfLen-1] | right[0]
+		copy(dst, left[:c.halfLen-1])
+		return
+	}
+	copy(dst, left)
+}
+
+// round encrypts one half, expanded to a full AES block.
+// The expanded block contains the half, followed by zeros, the plaintext length and the pass index.
+func (c *blockCipher) round(half []byte, pass uint8) []byte {
+	var b [aes.BlockSize]byte
+	copy(b[:], half)
+	b[aes.BlockSize-2] = uint8(c.plaintextLen)
+	b[aes.BlockSize-1] = pass
+	c.block.Encrypt(b[:], b[:])
+	return b[:c.halfLen]
+}
+
+func (c *blockCipher) xorLeft(left, mask []byte) {
+	for i := range left {
+		left[i] ^= mask[i]
+	}
+	if c.odd() {
+		left[c.halfLen-1] &= 0xf0
+	}
+}
+
+func (c *blockCipher) xorRight(right, mask []byte) {
+	for i := range right {
+		right[i] ^= mask[i]
+	}
+	if c.odd() {
+		right[0] &= 0x0f
+	}
+}
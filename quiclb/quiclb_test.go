@@ -0,0 +1,135 @@
+package quiclb
+
+import (
+	"bytes"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QUIC-LB", func() {
+	key := []byte("0123456789abcdef")
+
+	Context("validating the config", func() {
+		It("rejects the reserved config ID", func() {
+			_, err := NewDecoder(&Config{ConfigID: 7, ServerIDLen: 2, NonceLen: 4})
+			Expect(err).To(MatchError("quiclb: invalid config ID: 7"))
+		})
+
+		It("rejects invalid server ID lengths", func() {
+			_, err := NewDecoder(&Config{ServerIDLen: 0, NonceLen: 4})
+			Expect(err).To(MatchError("quiclb: invalid server ID length: 0"))
+			_, err = NewDecoder(&Config{ServerIDLen: 16, NonceLen: 4})
+			Expect(err).To(MatchError("quiclb: invalid server ID length: 16"))
+		})
+
+		It("rejects too short nonces", func() {
+			_, err := NewDecoder(&Config{ServerIDLen: 2, NonceLen: 3})
+			Expect(err).To(MatchError("quiclb: nonce too short: 3"))
+		})
+
+		It("rejects too long connection IDs", func() {
+			_, err := NewDecoder(&Config{ServerIDLen: 10, NonceLen: 10})
+			Expect(err).To(MatchError("quiclb: connection ID too long: 21"))
+		})
+
+		It("rejects keys of the wrong length", func() {
+			_, err := NewDecoder(&Config{ServerIDLen: 2, NonceLen: 4, Key: []byte("foobar")})
+			Expect(err).To(MatchError("quiclb: the key must be 16 bytes long"))
+		})
+
+		It("rejects server IDs of the wrong length", func() {
+			_, err := NewGenerator(&Config{ServerIDLen: 2, NonceLen: 4}, []byte{1, 2, 3})
+			Expect(err).To(MatchError("quiclb: expected a 2 byte server ID, got 3 bytes"))
+		})
+	})
+
+	It("encodes the server ID in plaintext", func() {
+		conf := &Config{ConfigID: 2, ServerIDLen: 3, NonceLen: 5}
+		g, err := NewGenerator(conf, []byte{0xde, 0xca, 0xfb})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g.ConnectionIDLen()).To(Equal(9))
+		connID, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID).To(HaveLen(9))
+		Expect(connID.Bytes()[1:4]).To(Equal([]byte{0xde, 0xca, 0xfb}))
+		configID, err := ConfigID(connID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configID).To(BeEquivalentTo(2))
+	})
+
+	It("encodes the length of the connection ID", func() {
+		conf := &Config{ServerIDLen: 3, NonceLen: 5, EncodeLength: true}
+		g, err := NewGenerator(conf, []byte{0xde, 0xca, 0xfb})
+		Expect(err).ToNot(HaveOccurred())
+		connID, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID[0]).To(BeEquivalentTo(8))
+	})
+
+	It("uses a different nonce for every connection ID", func() {
+		g, err := NewGenerator(&Config{ServerIDLen: 2, NonceLen: 8}, []byte{1, 2})
+		Expect(err).ToNot(HaveOccurred())
+		c1, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		c2, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1[3:]).ToNot(Equal(c2[3:]))
+	})
+
+	for _, l := range [][2]int{{2, 4}, {3, 4}, {4, 8}, {3, 10}, {8, 8}, {4, 15}} {
+		serverIDLen, nonceLen := l[0], l[1]
+
+		It(fmt.Sprintf("encrypts and decrypts a %d byte server ID with a %d byte nonce", serverIDLen, nonceLen), func() {
+			conf := &Config{ConfigID: 1, ServerIDLen: serverIDLen, NonceLen: nonceLen, Key: key}
+			serverID := bytes.Repeat([]byte{0xab}, serverIDLen)
+			g, err := NewGenerator(conf, serverID)
+			Expect(err).ToNot(HaveOccurred())
+			d, err := NewDecoder(conf)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 100; i++ {
+				connID, err := g.GenerateConnectionID()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(connID).To(HaveLen(1 + serverIDLen + nonceLen))
+				sid, err := d.ServerID(connID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sid).To(Equal(serverID))
+			}
+		})
+	}
+
+	It("decodes plaintext server IDs", func() {
+		conf := &Config{ServerIDLen: 2, NonceLen: 4}
+		g, err := NewGenerator(conf, []byte{0x13, 0x37})
+		Expect(err).ToNot(HaveOccurred())
+		d, err := NewDecoder(conf)
+		Expect(err).ToNot(HaveOccurred())
+		connID, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		// the load balancer might pass in more bytes than the connection ID, for short header packets
+		sid, err := d.ServerID(append(connID, []byte("packet payload")...))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sid).To(Equal([]byte{0x13, 0x37}))
+	})
+
+	It("doesn't decode connection IDs with a different config ID", func() {
+		g, err := NewGenerator(&Config{ConfigID: 1, ServerIDLen: 2, NonceLen: 4}, []byte{0x13, 0x37})
+		Expect(err).ToNot(HaveOccurred())
+		d, err := NewDecoder(&Config{ConfigID: 2, ServerIDLen: 2, NonceLen: 4})
+		Expect(err).ToNot(HaveOccurred())
+		connID, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = d.ServerID(connID)
+		Expect(err).To(MatchError("quiclb: unexpected config ID: 1"))
+	})
+
+	It("doesn't decode too short connection IDs", func() {
+		d, err := NewDecoder(&Config{ServerIDLen: 2, NonceLen: 4})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = d.ServerID([]byte{0, 1, 2, 3, 4, 5})
+		Expect(err).To(MatchError("quiclb: connection ID too short: 6 bytes"))
+		_, err = ConfigID(nil)
+		Expect(err).To(MatchError("quiclb: empty connection ID"))
+	})
+})
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sync"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
@@ -16,6 +18,8 @@ type receiveStreamI interface {
 
 	handleStreamFrame(*wire.StreamFrame) error
 	handleResetStreamFrame(*wire.ResetStreamFrame) error
+	handleResetStreamAtFrame(*wire.ResetStreamAtFrame) error
+	handleStreamDataBlockedFrame(*wire.StreamDataBlockedFrame)
 	closeForShutdown(error)
 	getWindowUpdate() protocol.ByteCount
 }
@@ -37,11 +41,16 @@ type receiveStream struct {
 	closeForShutdownErr error
 	cancelReadErr       error
 	resetRemotelyErr    StreamError
+	reliableSize        protocol.ByteCount // set when a RESET_STREAM_AT frame is received
 
 	closedForShutdown bool // set when CloseForShutdown() is called
 	finRead           bool // set once we read a frame with a FinBit
 	canceledRead      bool // set when CancelRead() is called
 	resetRemotely     bool // set when HandleResetStreamFrame() is called
+	resetRemotelyAt   bool // set when a RESET_STREAM_AT frame is received. Data up to the reliable size is still delivered.
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
 
 	readChan      chan struct{}
 	deadline      time.Time
@@ -60,7 +69,7 @@ func newReceiveStream(
 	flowController flowcontrol.StreamFlowController,
 	version protocol.VersionNumber,
 ) *receiveStream {
-	return &receiveStream{
+	s := &receiveStream{
 		streamID:       streamID,
 		sender:         sender,
 		flowController: flowController,
@@ -68,6 +77,8 @@ func newReceiveStream(
 		readChan:       make(chan struct{}, 1),
 		version:        version,
 	}
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	return s
 }
 
 func (s *receiveStream) StreamID() protocol.StreamID {
@@ -88,7 +99,7 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 	defer s.mutex.Unlock()
 
 	if s.finRead {
-		return false, 0, io.EOF
+		return false, 0, s.endOfStreamError()
 	}
 	if s.canceledRead {
 		return false, 0, s.cancelReadErr
@@ -144,6 +155,8 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 			}
 		}
 
+		s.truncateCurrentFrame()
+
 		if bytesRead > len(p) {
 			return false, bytesRead, fmt.Errorf("BUG: bytesRead (%d) > len(p) (%d) in stream.Read", bytesRead, len(p))
 		}
@@ -168,12 +181,115 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 
 		if s.readPosInFrame >= len(s.currentFrame) && s.currentFrameIsLast {
 			s.finRead = true
-			return true, bytesRead, io.EOF
+			return true, bytesRead, s.endOfStreamError()
 		}
 	}
 	return false, bytesRead, nil
 }
 
+// ReadChunk returns the next chunk of stream data, together with its offset.
+// In contrast to Read, it doesn't wait for missing data, but returns data as soon as it was received.
+func (s *receiveStream) ReadChunk() (uint64, []byte, error) {
+	completed, offset, data, err := s.readChunkImpl()
+	if completed {
+		s.sender.onStreamCompleted(s.streamID)
+	}
+	return uint64(offset), data, err
+}
+
+func (s *receiveStream) readChunkImpl() (bool /* stream completed */, protocol.ByteCount, []byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.finRead {
+		return false, 0, nil, s.endOfStreamError()
+	}
+
+	var offset protocol.ByteCount
+	var data []byte
+	var fin bool
+	// return the rest of the frame that was partially consumed by Read first
+	s.truncateCurrentFrame()
+	if s.currentFrame != nil && s.readPosInFrame < len(s.currentFrame) {
+		offset = s.readOffset
+		data = s.currentFrame[s.readPosInFrame:]
+		fin = s.currentFrameIsLast
+		s.currentFrame = nil
+		s.readPosInFrame = 0
+		s.readOffset += protocol.ByteCount(len(data))
+	} else {
+		for {
+			// Stop waiting on errors
+			if s.closedForShutdown {
+				return false, 0, nil, s.closeForShutdownErr
+			}
+			if s.canceledRead {
+				return false, 0, nil, s.cancelReadErr
+			}
+			if s.resetRemotely {
+				return false, 0, nil, s.resetRemotelyErr
+			}
+			if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
+				return false, 0, nil, errDeadline
+			}
+
+			offset, data, fin = s.frameQueue.PopAny()
+			if data != nil || fin {
+				break
+			}
+
+			s.mutex.Unlock()
+			if s.deadline.IsZero() {
+				<-s.readChan
+			} else {
+				select {
+				case <-s.readChan:
+				case <-s.deadlineTimer.C:
+				}
+			}
+			s.mutex.Lock()
+		}
+	}
+
+	// when a RESET_STREAM was received, the flow controller was already informed about the final byteOffset for this stream
+	if !s.resetRemotely {
+		s.flowController.AddBytesRead(protocol.ByteCount(len(data)))
+	}
+	// increase the flow control window, if necessary
+	s.flowController.MaybeQueueWindowUpdate()
+
+	if fin {
+		s.finRead = true
+		return true, offset, data, s.endOfStreamError()
+	}
+	return false, offset, data, nil
+}
+
+// endOfStreamError is the error returned once all data has been read.
+// After a reliable reset, that's the reset error, since the data after the reliable size is never delivered.
+func (s *receiveStream) endOfStreamError() error {
+	if s.resetRemotelyAt {
+		return s.resetRemotelyErr
+	}
+	return io.EOF
+}
+
+// truncateCurrentFrame makes sure that no data beyond the reliable size is returned after a RESET_STREAM_AT.
+// The frameSorter already discarded the queued data, but the current frame might extend beyond the reliable size.
+// must be called after locking the mutex
+func (s *receiveStream) truncateCurrentFrame() {
+	if !s.resetRemotelyAt || s.currentFrame == nil {
+		return
+	}
+	frameOffset := s.readOffset - protocol.ByteCount(s.readPosInFrame)
+	if frameOffset+protocol.ByteCount(len(s.currentFrame)) <= s.reliableSize {
+		return
+	}
+	end := utils.MaxByteCount(s.reliableSize, s.readOffset)
+	s.currentFrame = s.currentFrame[:end-frameOffset]
+	s.currentFrameIsLast = true
+}
+
 func (s *receiveStream) dequeueNextFrame() {
 	s.currentFrame, s.currentFrameIsLast = s.frameQueue.Pop()
 	s.readPosInFrame = 0
@@ -191,6 +307,7 @@ func (s *receiveStream) CancelRead(errorCode protocol.ApplicationErrorCode) erro
 	}
 	s.canceledRead = true
 	s.cancelReadErr = fmt.Errorf("Read on stream %d canceled with error code %d", s.streamID, errorCode)
+	s.ctxCancel()
 	s.signalRead()
 	s.sender.queueControlFrame(&wire.StopSendingFrame{
 		StreamID:  s.streamID,
@@ -242,14 +359,60 @@ func (s *receiveStream) handleResetStreamFrameImpl(frame *wire.ResetStreamFrame)
 		errorCode: frame.ErrorCode,
 		error:     fmt.Errorf("Stream %d was reset with error code %d", s.streamID, frame.ErrorCode),
 	}
+	s.ctxCancel()
 	s.signalRead()
 	return true, nil
 }
 
+func (s *receiveStream) handleResetStreamAtFrame(frame *wire.ResetStreamAtFrame) error {
+	if frame.ReliableSize == 0 {
+		return s.handleResetStreamFrame(&wire.ResetStreamFrame{
+			StreamID:   frame.StreamID,
+			ErrorCode:  frame.ErrorCode,
+			ByteOffset: frame.ByteOffset,
+		})
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closedForShutdown {
+		return nil
+	}
+	if err := s.flowController.UpdateHighestReceived(frame.ByteOffset, true); err != nil {
+		return err
+	}
+	if s.resetRemotely {
+		return nil
+	}
+	// The reliable size can only be reduced by subsequent RESET_STREAM_AT frames.
+	if s.resetRemotelyAt {
+		if frame.ReliableSize < s.reliableSize {
+			s.reliableSize = frame.ReliableSize
+			s.frameQueue.Truncate(frame.ReliableSize)
+		}
+		return nil
+	}
+	s.frameQueue.Truncate(frame.ReliableSize)
+	s.reliableSize = frame.ReliableSize
+	s.resetRemotelyAt = true
+	s.resetRemotelyErr = streamCanceledError{
+		errorCode: frame.ErrorCode,
+		error:     fmt.Errorf("Stream %d was reset with error code %d", s.streamID, frame.ErrorCode),
+	}
+	s.ctxCancel()
+	s.signalRead()
+	return nil
+}
+
 func (s *receiveStream) CloseRemote(offset protocol.ByteCount) {
 	s.handleStreamFrame(&wire.StreamFrame{FinBit: true, Offset: offset})
 }
 
+func (s *receiveStream) ReadContext() context.Context {
+	return s.ctx
+}
+
 func (s *receiveStream) SetReadDeadline(t time.Time) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -279,9 +442,14 @@ func (s *receiveStream) closeForShutdown(err error) {
 	s.closedForShutdown = true
 	s.closeForShutdownErr = err
 	s.mutex.Unlock()
+	s.ctxCancel()
 	s.signalRead()
 }
 
+func (s *receiveStream) handleStreamDataBlockedFrame(frame *wire.StreamDataBlockedFrame) {
+	s.flowController.HandlePeerBlocked(frame.DataLimit)
+}
+
 func (s *receiveStream) getWindowUpdate() protocol.ByteCount {
 	return s.flowController.GetWindowUpdate()
 }
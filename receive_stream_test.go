@@ -325,6 +325,7 @@ var _ = Describe("Receive Stream", func() {
 					n, err = strWithTimeout.Read(b)
 					Expect(n).To(BeZero())
 					Expect(err).To(MatchError(io.EOF))
+					Expect(str.ReadContext().Done()).ToNot(BeClosed())
 				})
 
 				It("handles out-of-order frames", func() {
@@ -422,6 +423,12 @@ var _ = Describe("Receive Stream", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("cancels the read context", func() {
+				Expect(str.ReadContext().Done()).ToNot(BeClosed())
+				str.closeForShutdown(testErr)
+				Expect(str.ReadContext().Done()).To(BeClosed())
+			})
+
 			It("errors for all following reads", func() {
 				str.closeForShutdown(testErr)
 				b := make([]byte, 1)
@@ -432,6 +439,123 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 
+	Context("reading chunks", func() {
+		It("returns chunks in the order they arrive", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar")})).To(Succeed())
+			offset, data, err := str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeEquivalentTo(3))
+			Expect(data).To(Equal([]byte("bar")))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+			offset, data, err = str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeZero())
+			Expect(data).To(Equal([]byte("foo")))
+		})
+
+		It("blocks until data arrives", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(13), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3))
+			mockFC.EXPECT().MaybeQueueWindowUpdate()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				offset, data, err := str.ReadChunk()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(offset).To(BeEquivalentTo(10))
+				Expect(data).To(Equal([]byte("foo")))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 10, Data: []byte("foo")})).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't return data twice", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false).Times(2)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2)).Times(3)
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(3)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 2, Data: []byte("cd")})).To(Succeed())
+			offset, data, err := str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeEquivalentTo(2))
+			Expect(data).To(Equal([]byte("cd")))
+			// this frame overlaps with the data that was already returned
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("abcdef")})).To(Succeed())
+			offset, data, err = str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeZero())
+			Expect(data).To(Equal([]byte("ab")))
+			offset, data, err = str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeEquivalentTo(4))
+			Expect(data).To(Equal([]byte("ef")))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 2, Data: []byte("cdef")})).To(Succeed())
+			Expect(str.frameQueue.HasMoreData()).To(BeFalse())
+		})
+
+		It("returns io.EOF once all data up to the final offset was returned", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar"), FinBit: true})).To(Succeed())
+			offset, data, err := str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeEquivalentTo(3))
+			Expect(data).To(Equal([]byte("bar")))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			offset, data, err = str.ReadChunk()
+			Expect(err).To(MatchError(io.EOF))
+			Expect(offset).To(BeZero())
+			Expect(data).To(Equal([]byte("foo")))
+			_, data, err = str.ReadChunk()
+			Expect(err).To(MatchError(io.EOF))
+			Expect(data).To(BeEmpty())
+		})
+
+		It("returns the rest of a frame that was partially read", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2))
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(4))
+			mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+			b := make([]byte, 2)
+			_, err := strWithTimeout.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(Equal([]byte("fo")))
+			offset, data, err := str.ReadChunk()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(offset).To(BeEquivalentTo(2))
+			Expect(data).To(Equal([]byte("obar")))
+		})
+
+		It("returns errors when the stream is reset", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			Expect(str.handleResetStreamFrame(&wire.ResetStreamFrame{
+				StreamID:   streamID,
+				ByteOffset: 42,
+				ErrorCode:  1234,
+			})).To(Succeed())
+			_, _, err := str.ReadChunk()
+			Expect(err).To(HaveOccurred())
+			Expect(err.(StreamError).ErrorCode()).To(BeEquivalentTo(1234))
+		})
+
+		It("times out", func() {
+			Expect(str.SetReadDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))).To(Succeed())
+			_, _, err := str.ReadChunk()
+			Expect(err).To(MatchError(errDeadline))
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling read", func() {
 			It("unblocks Read", func() {
@@ -485,6 +609,13 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("cancels the read context", func() {
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				Expect(str.ReadContext().Done()).ToNot(BeClosed())
+				Expect(str.CancelRead(1234)).To(Succeed())
+				Expect(str.ReadContext().Done()).To(BeClosed())
+			})
+
 			It("queues a STOP_SENDING frame", func() {
 				mockSender.EXPECT().queueControlFrame(&wire.StopSendingFrame{
 					StreamID:  streamID,
@@ -532,6 +663,14 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err.(streamCanceledError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(1234)))
 			})
 
+			It("cancels the read context", func() {
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+				Expect(str.ReadContext().Done()).ToNot(BeClosed())
+				Expect(str.handleResetStreamFrame(rst)).To(Succeed())
+				Expect(str.ReadContext().Done()).To(BeClosed())
+			})
+
 			It("errors when receiving a RESET_STREAM with an inconsistent offset", func() {
 				testErr := errors.New("already received a different final offset before")
 				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true).Return(testErr)
@@ -554,6 +693,111 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 		})
+
+		Context("receiving RESET_STREAM_AT frames", func() {
+			rst := &wire.ResetStreamAtFrame{
+				StreamID:     streamID,
+				ErrorCode:    1234,
+				ByteOffset:   10,
+				ReliableSize: 4,
+			}
+
+			It("delivers data up to the reliable size", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(4))
+				mockFC.EXPECT().MaybeQueueWindowUpdate()
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+				Expect(str.handleResetStreamAtFrame(rst)).To(Succeed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				b := make([]byte, 10)
+				n, err := strWithTimeout.Read(b)
+				Expect(n).To(Equal(4))
+				Expect(b[:n]).To(Equal([]byte("foob")))
+				Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+				Expect(err.(StreamError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(1234)))
+				_, err = strWithTimeout.Read(b)
+				Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+			})
+
+			It("cancels the read context", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true)
+				Expect(str.ReadContext().Done()).ToNot(BeClosed())
+				Expect(str.handleResetStreamAtFrame(rst)).To(Succeed())
+				Expect(str.ReadContext().Done()).To(BeClosed())
+			})
+
+			It("waits for the data up to the reliable size", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(4))
+				mockFC.EXPECT().MaybeQueueWindowUpdate()
+				Expect(str.handleResetStreamAtFrame(rst)).To(Succeed())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					b := make([]byte, 10)
+					n, err := str.Read(b)
+					Expect(n).To(Equal(4))
+					Expect(b[:n]).To(Equal([]byte("foob")))
+					Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+					close(done)
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("truncates a frame that is partially read", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2)).Times(2)
+				mockFC.EXPECT().MaybeQueueWindowUpdate().Times(2)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+				b := make([]byte, 2)
+				n, err := strWithTimeout.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(2))
+				Expect(str.handleResetStreamAtFrame(rst)).To(Succeed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				b = make([]byte, 10)
+				n, err = strWithTimeout.Read(b)
+				Expect(n).To(Equal(2))
+				Expect(b[:n]).To(Equal([]byte("ob")))
+				Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+			})
+
+			It("only allows reducing the reliable size", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true).Times(3)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2))
+				mockFC.EXPECT().MaybeQueueWindowUpdate()
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+				Expect(str.handleResetStreamAtFrame(rst)).To(Succeed())
+				Expect(str.handleResetStreamAtFrame(&wire.ResetStreamAtFrame{StreamID: streamID, ErrorCode: 1234, ByteOffset: 10, ReliableSize: 2})).To(Succeed())
+				Expect(str.handleResetStreamAtFrame(&wire.ResetStreamAtFrame{StreamID: streamID, ErrorCode: 1234, ByteOffset: 10, ReliableSize: 6})).To(Succeed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				b := make([]byte, 10)
+				n, err := strWithTimeout.Read(b)
+				Expect(b[:n]).To(Equal([]byte("fo")))
+				Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+			})
+
+			It("handles a reliable size of 0 like a RESET_STREAM frame", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.handleResetStreamAtFrame(&wire.ResetStreamAtFrame{StreamID: streamID, ErrorCode: 1234, ByteOffset: 10})).To(Succeed())
+				_, err := strWithTimeout.Read([]byte{0})
+				Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+			})
+
+			It("errors when receiving a RESET_STREAM_AT with an inconsistent offset", func() {
+				testErr := errors.New("already received a different final offset before")
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), true).Return(testErr)
+				Expect(str.handleResetStreamAtFrame(rst)).To(MatchError(testErr))
+			})
+		})
 	})
 
 	Context("flow control", func() {
@@ -572,5 +816,13 @@ var _ = Describe("Receive Stream", func() {
 			mockFC.EXPECT().GetWindowUpdate().Return(protocol.ByteCount(0x100))
 			Expect(str.getWindowUpdate()).To(Equal(protocol.ByteCount(0x100)))
 		})
+
+		It("tells the flow controller when the peer is blocked", func() {
+			mockFC.EXPECT().HandlePeerBlocked(protocol.ByteCount(0x1337))
+			str.handleStreamDataBlockedFrame(&wire.StreamDataBlockedFrame{
+				StreamID:  streamID,
+				DataLimit: 0x1337,
+			})
+		})
 	})
 })
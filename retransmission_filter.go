@@ -0,0 +1,107 @@
+package quic
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// the part of the ackhandler.SentPacketHandler used by the retransmissionFilter
+type packetNumberTracker interface {
+	PeekPacketNumber() (protocol.PacketNumber, protocol.PacketNumberLen)
+	GetLowestRetransmittable() protocol.PacketNumber
+}
+
+type resetSendStream struct {
+	reliableSize protocol.ByteCount
+	// all STREAM frames containing data beyond the reliable size were sent in packets with lower packet numbers
+	sentBefore protocol.PacketNumber
+}
+
+// The retransmissionFilter removes STREAM data that doesn't need to be retransmitted,
+// because the stream was reset.
+// Streams are deleted from the streams map as soon as they are canceled,
+// so the reliable size is tracked here until none of the packets sent before the reset can be retransmitted any more.
+type retransmissionFilter struct {
+	mutex sync.Mutex
+	// streams that were reset since the last call to Filter or GarbageCollect
+	newStreams map[protocol.StreamID]protocol.ByteCount
+
+	// only accessed from the session's run loop
+	streams map[protocol.StreamID]resetSendStream
+}
+
+func newRetransmissionFilter() *retransmissionFilter {
+	return &retransmissionFilter{
+		newStreams: make(map[protocol.StreamID]protocol.ByteCount),
+		streams:    make(map[protocol.StreamID]resetSendStream),
+	}
+}
+
+// AddStream is called when a stream is reset after data beyond the reliable size was sent.
+// It may be called from any goroutine.
+func (f *retransmissionFilter) AddStream(id protocol.StreamID, reliableSize protocol.ByteCount) {
+	f.mutex.Lock()
+	f.newStreams[id] = reliableSize
+	f.mutex.Unlock()
+}
+
+func (f *retransmissionFilter) addNewStreams(pnt packetNumberTracker) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.newStreams) == 0 {
+		return
+	}
+	// Packets are only sent from the run loop.
+	// All STREAM frames of the new streams were sent before the packet number that will be used next.
+	nextPN, _ := pnt.PeekPacketNumber()
+	for id, reliableSize := range f.newStreams {
+		f.streams[id] = resetSendStream{reliableSize: reliableSize, sentBefore: nextPN}
+		delete(f.newStreams, id)
+	}
+}
+
+// Filter removes the STREAM data beyond the reliable size of reset streams.
+// It must be called from the run loop.
+func (f *retransmissionFilter) Filter(frames []wire.Frame, pnt packetNumberTracker) []wire.Frame {
+	f.addNewStreams(pnt)
+	if len(f.streams) == 0 {
+		return frames
+	}
+
+	filtered := frames[:0]
+	for _, frame := range frames {
+		if sf, ok := frame.(*wire.StreamFrame); ok {
+			if str, ok := f.streams[sf.StreamID]; ok {
+				if sf.Offset >= str.reliableSize {
+					continue
+				}
+				if sf.Offset+sf.DataLen() > str.reliableSize {
+					sf.Data = sf.Data[:str.reliableSize-sf.Offset]
+					sf.FinBit = false
+				}
+			}
+		}
+		filtered = append(filtered, frame)
+	}
+	return filtered
+}
+
+// GarbageCollect forgets about reset streams once all packets sent before the reset
+// were either acknowledged or retransmitted.
+// It must be called from the run loop.
+func (f *retransmissionFilter) GarbageCollect(pnt packetNumberTracker) {
+	f.addNewStreams(pnt)
+	if len(f.streams) == 0 {
+		return
+	}
+
+	lowest := pnt.GetLowestRetransmittable()
+	for id, str := range f.streams {
+		if str.sentBefore <= lowest {
+			delete(f.streams, id)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/mocks/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retransmission filter", func() {
+	var (
+		filter *retransmissionFilter
+		sph    *mockackhandler.MockSentPacketHandler
+	)
+
+	BeforeEach(func() {
+		filter = newRetransmissionFilter()
+		sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+	})
+
+	It("retransmits everything if no stream was reset", func() {
+		frames := []wire.Frame{
+			&wire.StreamFrame{StreamID: 5, Offset: 10, Data: []byte("foobar"), FinBit: true},
+			&wire.PingFrame{},
+		}
+		Expect(filter.Filter(frames, sph)).To(Equal(frames))
+	})
+
+	It("doesn't retransmit anything of streams reset without a reliable size", func() {
+		filter.AddStream(5, 0)
+		sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(100), protocol.PacketNumberLen2)
+		other := &wire.StreamFrame{StreamID: 9, Data: []byte("foobar")}
+		frames := []wire.Frame{
+			&wire.StreamFrame{StreamID: 5, Data: []byte("foobar")},
+			other,
+		}
+		Expect(filter.Filter(frames, sph)).To(Equal([]wire.Frame{other}))
+	})
+
+	It("only retransmits data below the reliable size", func() {
+		filter.AddStream(5, 13)
+		sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(100), protocol.PacketNumberLen2)
+		f1 := &wire.StreamFrame{StreamID: 5, Offset: 4, Data: []byte("foobar")}
+		f2 := &wire.StreamFrame{StreamID: 5, Offset: 10, Data: []byte("foobar"), FinBit: true}
+		f3 := &wire.StreamFrame{StreamID: 5, Offset: 13, Data: []byte("foobar")}
+		filtered := filter.Filter([]wire.Frame{f1, f2, f3}, sph)
+		Expect(filtered).To(HaveLen(2))
+		Expect(filtered[0]).To(Equal(f1))
+		Expect(filtered[1].(*wire.StreamFrame).Offset).To(Equal(protocol.ByteCount(10)))
+		Expect(filtered[1].(*wire.StreamFrame).Data).To(Equal([]byte("foo")))
+		Expect(filtered[1].(*wire.StreamFrame).FinBit).To(BeFalse())
+	})
+
+	It("forgets about streams once all packets sent before the reset can't be retransmitted any more", func() {
+		filter.AddStream(5, 0)
+		sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(100), protocol.PacketNumberLen2)
+		sph.EXPECT().GetLowestRetransmittable().Return(protocol.PacketNumber(99))
+		filter.GarbageCollect(sph)
+		Expect(filter.streams).To(HaveKey(protocol.StreamID(5)))
+		sph.EXPECT().GetLowestRetransmittable().Return(protocol.PacketNumber(100))
+		filter.GarbageCollect(sph)
+		Expect(filter.streams).To(BeEmpty())
+		f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+		Expect(filter.Filter([]wire.Frame{f}, sph)).To(Equal([]wire.Frame{f}))
+	})
+
+	It("doesn't query the packet numbers if no stream was reset", func() {
+		// the mock would fail the test if any method was called
+		filter.GarbageCollect(sph)
+		Expect(filter.Filter([]wire.Frame{&wire.PingFrame{}}, sph)).To(HaveLen(1))
+	})
+})
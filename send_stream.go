@@ -40,7 +40,12 @@ type sendStream struct {
 	canceledWrite     bool // set when CancelWrite() is called, or a STOP_SENDING frame is received
 	finSent           bool // set when a STREAM_FRAME with FIN bit has b
 
+	// peerSupportsResetStreamAt is set if the peer supports the reliable stream reset extension.
+	peerSupportsResetStreamAt bool
+
+	// dataForWriting is the send buffer. Its size is limited by sendBufferSize.
 	dataForWriting []byte
+	sendBufferSize protocol.ByteCount
 
 	writeChan     chan struct{}
 	deadline      time.Time
@@ -58,12 +63,14 @@ func newSendStream(
 	streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	sendBufferSize protocol.ByteCount,
 	version protocol.VersionNumber,
 ) *sendStream {
 	s := &sendStream{
 		streamID:       streamID,
 		sender:         sender,
 		flowController: flowController,
+		sendBufferSize: sendBufferSize,
 		writeChan:      make(chan struct{}, 1),
 		version:        version,
 	}
@@ -79,39 +86,18 @@ func (s *sendStream) Write(p []byte) (int, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.finishedWriting {
-		return 0, fmt.Errorf("write on closed stream %d", s.streamID)
-	}
-	if s.canceledWrite {
-		return 0, s.cancelWriteErr
-	}
-	if s.closeForShutdownErr != nil {
-		return 0, s.closeForShutdownErr
-	}
-	if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
-		return 0, errDeadline
-	}
-	if len(p) == 0 {
-		return 0, nil
+	if err := s.checkWritable(); err != nil {
+		return 0, err
 	}
 
-	s.dataForWriting = make([]byte, len(p))
-	copy(s.dataForWriting, p)
-	s.sender.onHasStreamData(s.streamID)
-
 	var bytesWritten int
-	var err error
 	for {
-		bytesWritten = len(p) - len(s.dataForWriting)
-		if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
-			s.dataForWriting = nil
-			err = errDeadline
-			break
-		}
-		if s.dataForWriting == nil || s.canceledWrite || s.closedForShutdown {
-			break
+		bytesWritten += s.bufferData(p[bytesWritten:])
+		if bytesWritten == len(p) {
+			return bytesWritten, nil
 		}
 
+		// wait until there's space in the send buffer
 		s.mutex.Unlock()
 		if s.deadline.IsZero() {
 			<-s.writeChan
@@ -122,14 +108,61 @@ func (s *sendStream) Write(p []byte) (int, error) {
 			}
 		}
 		s.mutex.Lock()
+
+		if s.closeForShutdownErr != nil {
+			return bytesWritten, s.closeForShutdownErr
+		}
+		if s.canceledWrite {
+			return bytesWritten, s.cancelWriteErr
+		}
+		if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
+			return bytesWritten, errDeadline
+		}
 	}
+}
 
+func (s *sendStream) TryWrite(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+	return s.bufferData(p), nil
+}
+
+// must be called after locking the mutex
+func (s *sendStream) checkWritable() error {
+	if s.finishedWriting {
+		return fmt.Errorf("write on closed stream %d", s.streamID)
+	}
+	if s.canceledWrite {
+		return s.cancelWriteErr
+	}
 	if s.closeForShutdownErr != nil {
-		err = s.closeForShutdownErr
-	} else if s.cancelWriteErr != nil {
-		err = s.cancelWriteErr
+		return s.closeForShutdownErr
+	}
+	if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
+		return errDeadline
 	}
-	return bytesWritten, err
+	return nil
+}
+
+// bufferData copies as much of p into the send buffer as fits.
+// It returns the number of bytes copied.
+// must be called after locking the mutex
+func (s *sendStream) bufferData(p []byte) int {
+	free := s.sendBufferSize - protocol.ByteCount(len(s.dataForWriting))
+	if len(p) == 0 || free <= 0 {
+		return 0
+	}
+	n := len(p)
+	if protocol.ByteCount(n) > free {
+		n = int(free)
+	}
+	s.dataForWriting = append(s.dataForWriting, p[:n]...)
+	s.sender.onHasStreamData(s.streamID)
+	return n
 }
 
 // popStreamFrame returns the next STREAM frame that is supposed to be sent on this stream
@@ -180,7 +213,9 @@ func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (bool /* co
 	if frame.FinBit {
 		s.finSent = true
 	}
-	return frame.FinBit, frame, s.dataForWriting != nil
+	// after a reliable reset, the stream is completed as soon as all reliable data has been sent
+	completed := frame.FinBit || (s.canceledWrite && s.dataForWriting == nil)
+	return completed, frame, s.dataForWriting != nil
 }
 
 func (s *sendStream) hasData() bool {
@@ -202,13 +237,14 @@ func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, boo
 
 	var ret []byte
 	if protocol.ByteCount(len(s.dataForWriting)) > maxBytes {
-		ret = s.dataForWriting[:maxBytes]
+		ret = s.dataForWriting[:maxBytes:maxBytes]
 		s.dataForWriting = s.dataForWriting[maxBytes:]
 	} else {
 		ret = s.dataForWriting
 		s.dataForWriting = nil
-		s.signalWrite()
 	}
+	// space in the send buffer was freed
+	s.signalWrite()
 	s.writeOffset += protocol.ByteCount(len(ret))
 	s.flowController.AddBytesSent(protocol.ByteCount(len(ret)))
 	return ret, s.finishedWriting && s.dataForWriting == nil && !s.finSent
@@ -238,6 +274,60 @@ func (s *sendStream) CancelWrite(errorCode protocol.ApplicationErrorCode) error
 	return err
 }
 
+func (s *sendStream) CancelWriteAt(errorCode protocol.ApplicationErrorCode, reliableSize uint64) error {
+	if reliableSize == 0 {
+		return s.CancelWrite(errorCode)
+	}
+
+	s.mutex.Lock()
+	completed, err := s.cancelWriteAtImpl(errorCode, protocol.ByteCount(reliableSize))
+	s.mutex.Unlock()
+
+	if completed {
+		s.sender.onStreamCompleted(s.streamID)
+	}
+	return err
+}
+
+// must be called after locking the mutex
+func (s *sendStream) cancelWriteAtImpl(errorCode protocol.ApplicationErrorCode, reliableSize protocol.ByteCount) (bool /*completed */, error) {
+	if !s.peerSupportsResetStreamAt {
+		return false, fmt.Errorf("CancelWriteAt for stream %d: peer doesn't support reliable stream resets", s.streamID)
+	}
+	if s.canceledWrite {
+		return false, nil
+	}
+	if s.finishedWriting {
+		return false, fmt.Errorf("CancelWriteAt for closed stream %d", s.streamID)
+	}
+	if written := s.writeOffset + protocol.ByteCount(len(s.dataForWriting)); reliableSize > written {
+		return false, fmt.Errorf("CancelWriteAt for stream %d: reliable size (%d) larger than the amount of data written (%d)", s.streamID, reliableSize, written)
+	}
+	s.canceledWrite = true
+	s.cancelWriteErr = fmt.Errorf("Write on stream %d canceled with error code %d", s.streamID, errorCode)
+	// STREAM frames that were already sent might need to be retransmitted, but only up to the reliable size
+	if s.writeOffset > reliableSize {
+		s.sender.onStreamReset(s.streamID, reliableSize)
+	}
+	// only the data in the send buffer up to the reliable size will be sent
+	finalSize := s.writeOffset
+	if reliableSize > s.writeOffset {
+		s.dataForWriting = s.dataForWriting[:reliableSize-s.writeOffset]
+		finalSize = reliableSize
+	} else {
+		s.dataForWriting = nil
+	}
+	s.signalWrite()
+	s.sender.queueControlFrame(&wire.ResetStreamAtFrame{
+		StreamID:     s.streamID,
+		ErrorCode:    errorCode,
+		ByteOffset:   finalSize,
+		ReliableSize: reliableSize,
+	})
+	s.ctxCancel()
+	return s.dataForWriting == nil, nil
+}
+
 // must be called after locking the mutex
 func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, writeErr error) (bool /*completed */, error) {
 	if s.canceledWrite {
@@ -248,13 +338,17 @@ func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, wr
 	}
 	s.canceledWrite = true
 	s.cancelWriteErr = writeErr
+	// the data in the send buffer won't be sent any more, and STREAM frames that were already sent won't be retransmitted
+	s.dataForWriting = nil
+	if s.writeOffset > 0 {
+		s.sender.onStreamReset(s.streamID, 0)
+	}
 	s.signalWrite()
 	s.sender.queueControlFrame(&wire.ResetStreamFrame{
 		StreamID:   s.streamID,
 		ByteOffset: s.writeOffset,
 		ErrorCode:  errorCode,
 	})
-	// TODO(#991): cancel retransmissions for this stream
 	s.ctxCancel()
 	return true, nil
 }
@@ -18,7 +18,10 @@ import (
 )
 
 var _ = Describe("Send Stream", func() {
-	const streamID protocol.StreamID = 1337
+	const (
+		streamID       protocol.StreamID  = 1337
+		sendBufferSize protocol.ByteCount = 100
+	)
 
 	var (
 		str            *sendStream
@@ -30,7 +33,7 @@ var _ = Describe("Send Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newSendStream(streamID, mockSender, mockFC, protocol.VersionWhatever)
+		str = newSendStream(streamID, mockSender, mockFC, sendBufferSize, protocol.VersionWhatever)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = gbytes.TimeoutWriter(str, timeout)
@@ -168,6 +171,67 @@ var _ = Describe("Send Stream", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("returns as soon as the data is copied into the send buffer", func() {
+			mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+			n, err := strWithTimeout.Write([]byte("foo"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(3))
+			n, err = strWithTimeout.Write([]byte("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(3))
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			Expect(hasMoreData).To(BeFalse())
+		})
+
+		It("blocks Write while the send buffer is full", func() {
+			mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).AnyTimes()
+			mockFC.EXPECT().AddBytesSent(gomock.Any()).AnyTimes()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := str.Write(bytes.Repeat([]byte{'a'}, int(sendBufferSize)+10))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(sendBufferSize + 10))
+				close(done)
+			}()
+			waitForWrite()
+			Consistently(done).ShouldNot(BeClosed())
+			str.mutex.Lock()
+			Expect(str.dataForWriting).To(HaveLen(int(sendBufferSize)))
+			str.mutex.Unlock()
+			f, _ := str.popStreamFrame(50)
+			Expect(f).ToNot(BeNil())
+			Eventually(done).Should(BeClosed())
+			str.mutex.Lock()
+			Expect(str.dataForWriting).To(HaveLen(int(sendBufferSize) - int(f.DataLen()) + 10))
+			str.mutex.Unlock()
+		})
+
+		It("writes partially with TryWrite", func() {
+			mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+			n, err := str.TryWrite(bytes.Repeat([]byte{'a'}, int(sendBufferSize)-10))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(sendBufferSize - 10))
+			n, err = str.TryWrite(bytes.Repeat([]byte{'b'}, 20))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(10))
+			// the send buffer is full now
+			n, err = str.TryWrite([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeZero())
+		})
+
+		It("returns errors from TryWrite", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			str.Close()
+			_, err := str.TryWrite([]byte("foobar"))
+			Expect(err).To(MatchError("write on closed stream 1337"))
+		})
+
 		It("cancels the context when Close is called", func() {
 			mockSender.EXPECT().onHasStreamData(streamID)
 			Expect(str.Context().Done()).ToNot(BeClosed())
@@ -249,9 +313,9 @@ var _ = Describe("Send Stream", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
 				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
 				str.SetWriteDeadline(deadline)
-				n, err := strWithTimeout.Write([]byte("foobar"))
+				n, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, int(sendBufferSize)+6))
 				Expect(err).To(MatchError(errDeadline))
-				Expect(n).To(BeZero())
+				Expect(n).To(BeEquivalentTo(sendBufferSize))
 				Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
 			})
 
@@ -261,7 +325,7 @@ var _ = Describe("Send Stream", func() {
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := str.Write([]byte("foobar"))
+					_, err := str.Write(bytes.Repeat([]byte{0}, int(sendBufferSize)+6))
 					Expect(err).To(MatchError(errDeadline))
 					close(done)
 				}()
@@ -271,7 +335,7 @@ var _ = Describe("Send Stream", func() {
 			})
 
 			It("returns the number of bytes written, when the deadline expires", func() {
-				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onHasStreamData(streamID).Times(2)
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(10000)).AnyTimes()
 				mockFC.EXPECT().AddBytesSent(gomock.Any())
 				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
@@ -281,7 +345,7 @@ var _ = Describe("Send Stream", func() {
 				go func() {
 					defer GinkgoRecover()
 					var err error
-					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, 2*int(sendBufferSize)))
 					Expect(err).To(MatchError(errDeadline))
 					Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
 					close(writeReturned)
@@ -291,29 +355,29 @@ var _ = Describe("Send Stream", func() {
 				Expect(frame).ToNot(BeNil())
 				Expect(hasMoreData).To(BeTrue())
 				Eventually(writeReturned, scaleDuration(80*time.Millisecond)).Should(BeClosed())
-				Expect(n).To(BeEquivalentTo(frame.DataLen()))
+				Expect(n).To(BeEquivalentTo(sendBufferSize + frame.DataLen()))
 			})
 
-			It("doesn't pop any data after the deadline expired", func() {
+			It("sends the data that was buffered before the deadline expired", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(10000)).AnyTimes()
 				mockFC.EXPECT().AddBytesSent(gomock.Any())
 				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
 				str.SetWriteDeadline(deadline)
+				var n int
 				writeReturned := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					var err error
+					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, int(sendBufferSize)+10))
 					Expect(err).To(MatchError(errDeadline))
 					close(writeReturned)
 				}()
-				waitForWrite()
-				frame, hasMoreData := str.popStreamFrame(50)
-				Expect(frame).ToNot(BeNil())
-				Expect(hasMoreData).To(BeTrue())
 				Eventually(writeReturned, scaleDuration(80*time.Millisecond)).Should(BeClosed())
-				frame, hasMoreData = str.popStreamFrame(50)
-				Expect(frame).To(BeNil())
+				Expect(n).To(BeEquivalentTo(sendBufferSize))
+				frame, hasMoreData := str.popStreamFrame(1000)
+				Expect(frame).ToNot(BeNil())
+				Expect(frame.DataLen()).To(Equal(sendBufferSize))
 				Expect(hasMoreData).To(BeFalse())
 			})
 
@@ -332,9 +396,9 @@ var _ = Describe("Send Stream", func() {
 					close(done)
 				}()
 				runtime.Gosched()
-				n, err := strWithTimeout.Write([]byte("foobar"))
+				n, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, int(sendBufferSize)+6))
 				Expect(err).To(MatchError(errDeadline))
-				Expect(n).To(BeZero())
+				Expect(n).To(BeEquivalentTo(sendBufferSize))
 				Expect(time.Now()).To(BeTemporally("~", deadline2, scaleDuration(20*time.Millisecond)))
 				Eventually(done).Should(BeClosed())
 			})
@@ -354,7 +418,7 @@ var _ = Describe("Send Stream", func() {
 				}()
 				str.SetWriteDeadline(deadline1)
 				runtime.Gosched()
-				_, err := strWithTimeout.Write([]byte("foobar"))
+				_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, int(sendBufferSize)+6))
 				Expect(err).To(MatchError(errDeadline))
 				Expect(time.Now()).To(BeTemporally("~", deadline2, scaleDuration(20*time.Millisecond)))
 				Eventually(done).Should(BeClosed())
@@ -429,7 +493,7 @@ var _ = Describe("Send Stream", func() {
 			})
 
 			It("doesn't get data for writing if an error occurred", func() {
-				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onHasStreamData(streamID).MinTimes(1)
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
 				mockFC.EXPECT().AddBytesSent(gomock.Any())
 				done := make(chan struct{})
@@ -496,6 +560,7 @@ var _ = Describe("Send Stream", func() {
 					ByteOffset: 1234,
 					ErrorCode:  9876,
 				})
+				mockSender.EXPECT().onStreamReset(streamID, protocol.ByteCount(0))
 				mockSender.EXPECT().onStreamCompleted(streamID)
 				str.writeOffset = 1234
 				err := str.CancelWrite(9876)
@@ -506,24 +571,33 @@ var _ = Describe("Send Stream", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
 				mockSender.EXPECT().onStreamCompleted(streamID)
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
-				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
-				mockFC.EXPECT().AddBytesSent(gomock.Any())
 				writeReturned := make(chan struct{})
 				var n int
 				go func() {
 					defer GinkgoRecover()
 					var err error
-					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, 2*int(sendBufferSize)))
 					Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
 					close(writeReturned)
 				}()
 				waitForWrite()
-				frame, _ := str.popStreamFrame(50)
-				Expect(frame).ToNot(BeNil())
 				err := str.CancelWrite(1234)
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(writeReturned).Should(BeClosed())
-				Expect(n).To(BeEquivalentTo(frame.DataLen()))
+				Expect(n).To(BeEquivalentTo(sendBufferSize))
+			})
+
+			It("discards the data in the send buffer", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				_, err := str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.CancelWrite(1234)).To(Succeed())
+				Expect(str.hasData()).To(BeFalse())
+				frame, hasMoreData := str.popStreamFrame(1000)
+				Expect(frame).To(BeNil())
+				Expect(hasMoreData).To(BeFalse())
 			})
 
 			It("cancels the context", func() {
@@ -561,6 +635,89 @@ var _ = Describe("Send Stream", func() {
 			})
 		})
 
+		Context("canceling writing with a reliable size", func() {
+			BeforeEach(func() {
+				str.peerSupportsResetStreamAt = true
+			})
+
+			It("errors if the peer doesn't support reliable resets", func() {
+				str.peerSupportsResetStreamAt = false
+				Expect(str.CancelWriteAt(1234, 10)).To(MatchError("CancelWriteAt for stream 1337: peer doesn't support reliable stream resets"))
+			})
+
+			It("sends a RESET_STREAM frame if the reliable size is 0", func() {
+				mockSender.EXPECT().queueControlFrame(&wire.ResetStreamFrame{
+					StreamID:   streamID,
+					ByteOffset: 1234,
+					ErrorCode:  9876,
+				})
+				mockSender.EXPECT().onStreamReset(streamID, protocol.ByteCount(0))
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				str.writeOffset = 1234
+				Expect(str.CancelWriteAt(9876, 0)).To(Succeed())
+			})
+
+			It("queues a RESET_STREAM_AT frame", func() {
+				mockSender.EXPECT().queueControlFrame(&wire.ResetStreamAtFrame{
+					StreamID:     streamID,
+					ErrorCode:    9876,
+					ByteOffset:   1234,
+					ReliableSize: 1000,
+				})
+				mockSender.EXPECT().onStreamReset(streamID, protocol.ByteCount(1000))
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				str.writeOffset = 1234
+				Expect(str.CancelWriteAt(9876, 1000)).To(Succeed())
+			})
+
+			It("doesn't report the reset if no data beyond the reliable size was sent", func() {
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				str.writeOffset = 1000
+				Expect(str.CancelWriteAt(9876, 1000)).To(Succeed())
+			})
+
+			It("errors if the reliable size is larger than the amount of data written", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				str.writeOffset = 1000
+				_, err := str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.CancelWriteAt(1234, 1007)).To(MatchError("CancelWriteAt for stream 1337: reliable size (1007) larger than the amount of data written (1006)"))
+			})
+
+			It("sends the buffered data up to the reliable size", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				_, err := str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				mockSender.EXPECT().queueControlFrame(&wire.ResetStreamAtFrame{
+					StreamID:     streamID,
+					ErrorCode:    1234,
+					ByteOffset:   3,
+					ReliableSize: 3,
+				})
+				Expect(str.CancelWriteAt(1234, 3)).To(Succeed())
+				_, err = strWithTimeout.Write([]byte("foobar"))
+				Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
+				Expect(str.Context().Done()).To(BeClosed())
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(3))
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				frame, hasMoreData := str.popStreamFrame(1000)
+				Expect(frame).ToNot(BeNil())
+				Expect(frame.Data).To(Equal([]byte("foo")))
+				Expect(frame.FinBit).To(BeFalse())
+				Expect(hasMoreData).To(BeFalse())
+				frame, _ = str.popStreamFrame(1000)
+				Expect(frame).To(BeNil())
+			})
+
+			It("doesn't cancel when the stream was already closed", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				Expect(str.Close()).To(Succeed())
+				Expect(str.CancelWriteAt(123, 1)).To(MatchError("CancelWriteAt for closed stream 1337"))
+			})
+		})
+
 		Context("receiving STOP_SENDING frames", func() {
 			It("queues a RESET_STREAM frames with error code Stopping", func() {
 				mockSender.EXPECT().queueControlFrame(&wire.ResetStreamFrame{
@@ -580,7 +737,7 @@ var _ = Describe("Send Stream", func() {
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := str.Write([]byte("foobar"))
+					_, err := str.Write(bytes.Repeat([]byte{0}, int(sendBufferSize)+6))
 					Expect(err).To(MatchError("Stream 1337 was reset with error code 123"))
 					Expect(err).To(BeAssignableToTypeOf(streamCanceledError{}))
 					Expect(err.(streamCanceledError).Canceled()).To(BeTrue())
@@ -2,6 +2,8 @@ package quic
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -10,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -36,6 +39,13 @@ type packetHandlerManager interface {
 	Remove(protocol.ConnectionID)
 	SetServer(unknownPacketHandler)
 	CloseServer()
+	// Stop stops reading from the packet conn.
+	// It doesn't close the packet conn, and it doesn't close any packet handlers.
+	Stop()
+	// Resume undoes a Stop. It returns false if the manager already stopped reading.
+	Resume() bool
+	// Stopped returns a channel that is closed once the manager stopped reading from the packet conn.
+	Stopped() <-chan struct{}
 }
 
 type quicSession interface {
@@ -44,24 +54,38 @@ type quicSession interface {
 	GetVersion() protocol.VersionNumber
 	run() error
 	destroy(error)
+	closeLocal(error)
 	closeRemote(error)
 }
 
 type sessionRunner interface {
 	onHandshakeComplete(Session)
+	// addConnectionID starts routing packets for a connection ID issued in a NEW_CONNECTION_ID frame to the session.
+	addConnectionID(protocol.ConnectionID, quicSession)
 	retireConnectionID(protocol.ConnectionID)
 	removeConnectionID(protocol.ConnectionID)
+	// addPacketConn starts receiving packets for the session on a packet conn.
+	// It is used by the client when migrating to a new packet conn.
+	addPacketConn(net.PacketConn) error
+	// removePacketConn stops receiving packets for the session on a packet conn.
+	removePacketConn(net.PacketConn)
 }
 
 type runner struct {
 	onHandshakeCompleteImpl func(Session)
+	addConnectionIDImpl     func(protocol.ConnectionID, quicSession)
 	retireConnectionIDImpl  func(protocol.ConnectionID)
 	removeConnectionIDImpl  func(protocol.ConnectionID)
+	addPacketConnImpl       func(net.PacketConn) error
+	removePacketConnImpl    func(net.PacketConn)
 }
 
-func (r *runner) onHandshakeComplete(s Session)              { r.onHandshakeCompleteImpl(s) }
-func (r *runner) retireConnectionID(c protocol.ConnectionID) { r.retireConnectionIDImpl(c) }
-func (r *runner) removeConnectionID(c protocol.ConnectionID) { r.removeConnectionIDImpl(c) }
+func (r *runner) onHandshakeComplete(s Session)                          { r.onHandshakeCompleteImpl(s) }
+func (r *runner) addConnectionID(c protocol.ConnectionID, s quicSession) { r.addConnectionIDImpl(c, s) }
+func (r *runner) retireConnectionID(c protocol.ConnectionID)             { r.retireConnectionIDImpl(c) }
+func (r *runner) removeConnectionID(c protocol.ConnectionID)             { r.removeConnectionIDImpl(c) }
+func (r *runner) addPacketConn(c net.PacketConn) error                   { return r.addPacketConnImpl(c) }
+func (r *runner) removePacketConn(c net.PacketConn)                      { r.removePacketConnImpl(c) }
 
 var _ sessionRunner = &runner{}
 
@@ -98,6 +122,12 @@ type server struct {
 var _ Listener = &server{}
 var _ unknownPacketHandler = &server{}
 
+// NewMemoryBudget creates a new MemoryBudget of limit bytes.
+// It can be shared by multiple servers by setting it in their quic.Config.
+func NewMemoryBudget(limit uint64) *MemoryBudget {
+	return flowcontrol.NewMemoryBudget(protocol.ByteCount(limit))
+}
+
 // ListenAddr creates a QUIC server listening on a given address.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, error) {
@@ -130,11 +160,14 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 			return nil, fmt.Errorf("%s is not a valid QUIC version", v)
 		}
 	}
-
-	sessionHandler, err := getMultiplexer().AddConn(conn, config.ConnectionIDLength)
-	if err != nil {
+	if err := handshake.ValidateAdditionalTransportParameters(config.AdditionalTransportParameters, config.Versions); err != nil {
 		return nil, err
 	}
+	if config.ExternalPSK != nil && config.ExternalPSK.GetKey == nil {
+		return nil, errors.New("the external PSK config requires a GetKey callback")
+	}
+
+	sessionHandler := getMultiplexer().AddConn(conn)
 	s := &server{
 		conn:           conn,
 		tlsConf:        tlsConf,
@@ -146,6 +179,7 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 		logger:         utils.DefaultLogger.WithPrefix("server"),
 	}
 	if err := s.setup(); err != nil {
+		getMultiplexer().RemoveConn(conn)
 		return nil, err
 	}
 	sessionHandler.SetServer(s)
@@ -155,9 +189,20 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 
 func (s *server) setup() error {
 	s.sessionRunner = &runner{
-		onHandshakeCompleteImpl: func(sess Session) { s.sessionQueue <- sess },
-		retireConnectionIDImpl:  s.sessionHandler.Retire,
-		removeConnectionIDImpl:  s.sessionHandler.Remove,
+		onHandshakeCompleteImpl: func(sess Session) {
+			if !s.config.AcceptEarlySessions {
+				s.sessionQueue <- sess
+			}
+		},
+		addConnectionIDImpl: func(connID protocol.ConnectionID, sess quicSession) {
+			s.sessionHandler.Add(connID, newServerSession(sess, s.config, s.logger))
+		},
+		retireConnectionIDImpl: s.sessionHandler.Retire,
+		removeConnectionIDImpl: s.sessionHandler.Remove,
+		addPacketConnImpl: func(net.PacketConn) error {
+			return errors.New("server sessions can't migrate")
+		},
+		removePacketConnImpl: func(net.PacketConn) {},
 	}
 	cookieGenerator, err := handshake.NewCookieGenerator()
 	if err != nil {
@@ -216,6 +261,10 @@ func populateServerConfig(config *Config) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindow
 	}
+	streamSendBufferSize := config.StreamSendBufferSize
+	if streamSendBufferSize == 0 {
+		streamSendBufferSize = protocol.DefaultStreamSendBufferSize
+	}
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -232,6 +281,12 @@ func populateServerConfig(config *Config) *Config {
 	if connIDLen == 0 {
 		connIDLen = protocol.DefaultConnectionIDLength
 	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator == nil {
+		connIDGenerator = &randomConnectionIDGenerator{connIDLen: connIDLen}
+	} else {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	}
 
 	return &Config{
 		Versions:                              versions,
@@ -239,18 +294,30 @@ func populateServerConfig(config *Config) *Config {
 		IdleTimeout:                           idleTimeout,
 		AcceptCookie:                          vsa,
 		KeepAlive:                             config.KeepAlive,
+		AdditionalTransportParameters:         config.AdditionalTransportParameters,
+		EnableReliableStreamReset:             config.EnableReliableStreamReset,
+		OnBlocked:                             config.OnBlocked,
+		AcceptEarlySessions:                   config.AcceptEarlySessions,
+		PreferredAddressIPv4:                  config.PreferredAddressIPv4,
+		PreferredAddressIPv6:                  config.PreferredAddressIPv6,
+		ExternalPSK:                           config.ExternalPSK,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		ReceiveMemoryBudget:                   config.ReceiveMemoryBudget,
+		StreamSendBufferSize:                  streamSendBufferSize,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
 		ConnectionIDLength:                    connIDLen,
+		ConnectionIDGenerator:                 connIDGenerator,
 	}
 }
 
 // Accept returns newly openend sessions
-func (s *server) Accept() (Session, error) {
+func (s *server) Accept(ctx context.Context) (Session, error) {
 	var sess Session
 	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case sess = <-s.sessionQueue:
 		return sess, nil
 	case <-s.errorChan:
@@ -261,11 +328,14 @@ func (s *server) Accept() (Session, error) {
 // Close the server
 func (s *server) Close() error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	if s.closed {
+		s.mutex.Unlock()
 		return nil
 	}
-	return s.closeWithMutex()
+	err := s.closeWithMutex()
+	s.mutex.Unlock()
+	getMultiplexer().RemoveConn(s.conn)
+	return err
 }
 
 func (s *server) closeWithMutex() error {
@@ -286,12 +356,17 @@ func (s *server) closeWithMutex() error {
 
 func (s *server) closeWithError(e error) error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	if s.closed {
+		s.mutex.Unlock()
 		return nil
 	}
 	s.serverError = e
-	return s.closeWithMutex()
+	err := s.closeWithMutex()
+	s.mutex.Unlock()
+	// closeWithError is called from the go routine reading from the conn,
+	// while it holds the mutex of the packet handler manager, which is needed for stopping it.
+	go getMultiplexer().RemoveConn(s.conn)
+	return err
 }
 
 // Addr returns the server's network address
@@ -322,7 +397,7 @@ func (s *server) handlePacketImpl(p *receivedPacket) error {
 func (s *server) handleInitial(p *receivedPacket) {
 	// TODO: add a check that DestConnID == SrcConnID
 	s.logger.Debugf("<- Received Initial packet.")
-	sess, connID, err := s.handleInitialImpl(p)
+	sess, connIDs, err := s.handleInitialImpl(p)
 	if err != nil {
 		s.logger.Errorf("Error occurred handling initial packet: %s", err)
 		return
@@ -331,10 +406,14 @@ func (s *server) handleInitial(p *receivedPacket) {
 		return
 	}
 	serverSession := newServerSession(sess, s.config, s.logger)
-	s.sessionHandler.Add(connID, serverSession)
+	for _, connID := range connIDs {
+		s.sessionHandler.Add(connID, serverSession)
+	}
 }
 
-func (s *server) handleInitialImpl(p *receivedPacket) (quicSession, protocol.ConnectionID, error) {
+// handleInitialImpl creates a new session.
+// It returns the connection IDs that the client can use to address this session.
+func (s *server) handleInitialImpl(p *receivedPacket) (quicSession, []protocol.ConnectionID, error) {
 	hdr := p.header
 	if len(hdr.Token) == 0 && hdr.DestConnectionID.Len() < protocol.MinConnectionIDLenInitial {
 		return nil, nil, errors.New("dropping Initial packet with too short connection ID")
@@ -362,24 +441,45 @@ func (s *server) handleInitialImpl(p *receivedPacket) (quicSession, protocol.Con
 		return nil, nil, s.sendRetry(p.remoteAddr, hdr)
 	}
 
-	connID, err := protocol.GenerateConnectionID(s.config.ConnectionIDLength)
+	connID, err := s.config.ConnectionIDGenerator.GenerateConnectionID()
 	if err != nil {
 		return nil, nil, err
 	}
 	s.logger.Debugf("Changing connection ID to %s.", connID)
+	connIDs := []protocol.ConnectionID{connID}
+	var preferredAddrConnID protocol.ConnectionID
+	if s.config.PreferredAddressIPv4 != nil || s.config.PreferredAddressIPv6 != nil {
+		preferredAddrConnID, err = s.config.ConnectionIDGenerator.GenerateConnectionID()
+		if err != nil {
+			return nil, nil, err
+		}
+		connIDs = append(connIDs, preferredAddrConnID)
+	}
 	sess, err := s.createNewSession(
 		p.remoteAddr,
 		origDestConnectionID,
 		hdr.DestConnectionID,
 		hdr.SrcConnectionID,
 		connID,
+		preferredAddrConnID,
 		hdr.Version,
 	)
 	if err != nil {
 		return nil, nil, err
 	}
 	sess.handlePacket(p)
-	return sess, connID, nil
+	if s.config.AcceptEarlySessions {
+		go s.acceptEarly(sess)
+	}
+	return sess, connIDs, nil
+}
+
+// acceptEarly queues a session for Accept before its handshake completed.
+func (s *server) acceptEarly(sess quicSession) {
+	select {
+	case s.sessionQueue <- sess:
+	case <-sess.Context().Done():
+	}
 }
 
 func (s *server) createNewSession(
@@ -388,6 +488,7 @@ func (s *server) createNewSession(
 	clientDestConnID protocol.ConnectionID,
 	destConnID protocol.ConnectionID,
 	srcConnID protocol.ConnectionID,
+	preferredAddrConnID protocol.ConnectionID,
 	version protocol.VersionNumber,
 ) (quicSession, error) {
 	params := &handshake.TransportParameters{
@@ -398,10 +499,36 @@ func (s *server) createNewSession(
 		IdleTimeout:                    s.config.IdleTimeout,
 		MaxBidiStreams:                 uint64(s.config.MaxIncomingStreams),
 		MaxUniStreams:                  uint64(s.config.MaxIncomingUniStreams),
-		DisableMigration:               true,
 		// TODO(#855): generate a real token
 		StatelessResetToken:  bytes.Repeat([]byte{42}, 16),
 		OriginalConnectionID: origDestConnID,
+		AdditionalParameters: s.config.AdditionalTransportParameters,
+		ResetStreamAt:        s.config.EnableReliableStreamReset,
+	}
+	if version == protocol.Version1 {
+		// In QUIC version 1, the server always sends the original_destination_connection_id.
+		// If a Retry was performed, the client used the connection ID from the Retry as the destination connection ID.
+		if origDestConnID != nil {
+			params.RetrySourceConnectionID = clientDestConnID
+		} else {
+			params.OriginalConnectionID = clientDestConnID
+		}
+		params.InitialSourceConnectionID = srcConnID
+	}
+	if preferredAddrConnID != nil {
+		pa := &handshake.PreferredAddress{ConnectionID: preferredAddrConnID}
+		if addr := s.config.PreferredAddressIPv4; addr != nil {
+			pa.IPv4 = addr.IP
+			pa.IPv4Port = uint16(addr.Port)
+		}
+		if addr := s.config.PreferredAddressIPv6; addr != nil {
+			pa.IPv6 = addr.IP
+			pa.IPv6Port = uint16(addr.Port)
+		}
+		if _, err := rand.Read(pa.StatelessResetToken[:]); err != nil {
+			return nil, err
+		}
+		params.PreferredAddress = pa
 	}
 	sess, err := s.newSession(
 		&conn{pconn: s.conn, currentAddr: remoteAddr},
@@ -427,7 +554,7 @@ func (s *server) sendRetry(remoteAddr net.Addr, hdr *wire.Header) error {
 	if err != nil {
 		return err
 	}
-	connID, err := protocol.GenerateConnectionID(s.config.ConnectionIDLength)
+	connID, err := s.config.ConnectionIDGenerator.GenerateConnectionID()
 	if err != nil {
 		return err
 	}
@@ -446,6 +573,9 @@ func (s *server) sendRetry(remoteAddr net.Addr, hdr *wire.Header) error {
 	if err := replyHdr.Write(buf, protocol.PerspectiveServer, hdr.Version); err != nil {
 		return err
 	}
+	if hdr.Version == protocol.Version1 {
+		buf.Write(handshake.GetRetryIntegrityTag(buf.Bytes(), hdr.DestConnectionID))
+	}
 	if _, err := s.conn.WriteTo(buf.Bytes(), remoteAddr); err != nil {
 		s.logger.Debugf("Error sending Retry: %s", err)
 	}
@@ -2,12 +2,14 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"net"
 	"reflect"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
@@ -17,6 +19,18 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// A counterConnIDGenerator generates connection IDs that encode a counter in the last byte.
+type counterConnIDGenerator struct {
+	counter uint8
+}
+
+func (g *counterConnIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	g.counter++
+	return protocol.ConnectionID{0xc0, 0xff, 0xee, g.counter}, nil
+}
+
+func (g *counterConnIDGenerator) ConnectionIDLen() int { return 4 }
+
 var _ = Describe("Server", func() {
 	var conn *mockPacketConn
 
@@ -31,6 +45,27 @@ var _ = Describe("Server", func() {
 		Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 	})
 
+	It("errors when the Config contains additional transport parameters that collide with standard parameters", func() {
+		config := &Config{AdditionalTransportParameters: []TransportParameter{{ID: 0x42}, {ID: 0x3}}}
+		_, err := Listen(nil, &tls.Config{}, config)
+		Expect(err).To(MatchError("transport parameter 0x3 collides with a standard transport parameter"))
+	})
+
+	It("errors when the Config contains additional transport parameters that can't be sent in all versions", func() {
+		config := &Config{
+			Versions:                      []protocol.VersionNumber{protocol.Version1, protocol.VersionTLS},
+			AdditionalTransportParameters: []TransportParameter{{ID: 0x10000}},
+		}
+		_, err := Listen(nil, &tls.Config{}, config)
+		Expect(err).To(MatchError("transport parameter 0x10000 exceeds the maximum transport parameter ID (0xffff)"))
+	})
+
+	It("errors when the external PSK config doesn't contain a GetKey callback", func() {
+		config := &Config{ExternalPSK: &PSKConfig{Identity: []byte("device"), Key: []byte("key")}}
+		_, err := Listen(nil, &tls.Config{}, config)
+		Expect(err).To(MatchError("the external PSK config requires a GetKey callback"))
+	})
+
 	It("fills in default values if options are not set in the Config", func() {
 		ln, err := Listen(conn, &tls.Config{}, &Config{})
 		Expect(err).ToNot(HaveOccurred())
@@ -40,19 +75,44 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(defaultAcceptCookie)))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.StreamSendBufferSize).To(BeEquivalentTo(protocol.DefaultStreamSendBufferSize))
+		Expect(server.config.ConnectionIDLength).To(Equal(protocol.DefaultConnectionIDLength))
+		Expect(server.config.ConnectionIDGenerator).To(Equal(&randomConnectionIDGenerator{connIDLen: protocol.DefaultConnectionIDLength}))
 		// stop the listener
 		Expect(ln.Close()).To(Succeed())
 	})
 
+	It("removes the packet conn from the multiplexer when closed", func() {
+		ln, err := Listen(conn, &tls.Config{}, &Config{})
+		Expect(err).ToNot(HaveOccurred())
+		muxer := getMultiplexer().(*connMultiplexer)
+		muxer.mutex.Lock()
+		Expect(muxer.conns).To(HaveKey(conn))
+		muxer.mutex.Unlock()
+		Expect(ln.Close()).To(Succeed())
+		muxer.mutex.Lock()
+		Expect(muxer.conns).ToNot(HaveKey(conn))
+		muxer.mutex.Unlock()
+		Expect(conn.closed).To(BeFalse())
+	})
+
 	It("setups with the right values", func() {
 		supportedVersions := []protocol.VersionNumber{protocol.VersionTLS}
 		acceptCookie := func(_ net.Addr, _ *Cookie) bool { return true }
+		budget := NewMemoryBudget(1 << 20)
 		config := Config{
-			Versions:         supportedVersions,
-			AcceptCookie:     acceptCookie,
-			HandshakeTimeout: 1337 * time.Hour,
-			IdleTimeout:      42 * time.Minute,
-			KeepAlive:        true,
+			Versions:                      supportedVersions,
+			AcceptCookie:                  acceptCookie,
+			HandshakeTimeout:              1337 * time.Hour,
+			IdleTimeout:                   42 * time.Minute,
+			KeepAlive:                     true,
+			StreamSendBufferSize:          1 << 10,
+			AdditionalTransportParameters: []TransportParameter{{ID: 0x1337, Value: []byte("foobar")}},
+			EnableReliableStreamReset:     true,
+			ReceiveMemoryBudget:           budget,
+			OnBlocked:                     func(Session, BlockedEvent) {},
+			PreferredAddressIPv4:          &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4433},
+			ExternalPSK:                   &PSKConfig{GetKey: func([]byte) ([]byte, error) { return nil, nil }},
 		}
 		ln, err := Listen(conn, &tls.Config{}, &config)
 		Expect(err).ToNot(HaveOccurred())
@@ -63,6 +123,25 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(42 * time.Minute))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookie)))
 		Expect(server.config.KeepAlive).To(BeTrue())
+		Expect(server.config.StreamSendBufferSize).To(BeEquivalentTo(1 << 10))
+		Expect(server.config.AdditionalTransportParameters).To(Equal([]TransportParameter{{ID: 0x1337, Value: []byte("foobar")}}))
+		Expect(server.config.EnableReliableStreamReset).To(BeTrue())
+		Expect(server.config.ReceiveMemoryBudget).To(BeIdenticalTo(budget))
+		Expect(server.config.OnBlocked).ToNot(BeNil())
+		Expect(server.config.PreferredAddressIPv4).To(Equal(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4433}))
+		Expect(server.config.PreferredAddressIPv6).To(BeNil())
+		Expect(server.config.ExternalPSK).ToNot(BeNil())
+		// stop the listener
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("uses the length of the connection IDs of the ConnectionIDGenerator", func() {
+		gen := &counterConnIDGenerator{}
+		ln, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 8, ConnectionIDGenerator: gen})
+		Expect(err).ToNot(HaveOccurred())
+		server := ln.(*server)
+		Expect(server.config.ConnectionIDGenerator).To(BeIdenticalTo(gen))
+		Expect(server.config.ConnectionIDLength).To(Equal(4))
 		// stop the listener
 		Expect(ln.Close()).To(Succeed())
 	})
@@ -251,6 +330,140 @@ var _ = Describe("Server", func() {
 			Expect(replyHdr.Token).ToNot(BeEmpty())
 		})
 
+		It("uses the ConnectionIDGenerator for the Retry packet", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return false }
+			serv.config.ConnectionIDGenerator = &counterConnIDGenerator{}
+			serv.handleInitial(&receivedPacket{
+				remoteAddr: &net.UDPAddr{},
+				header: &wire.Header{
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Version:          protocol.VersionTLS,
+				},
+				data: bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize),
+			})
+			replyHdr := parseHeader(conn.dataWritten.Bytes())
+			Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(replyHdr.SrcConnectionID).To(Equal(protocol.ConnectionID{0xc0, 0xff, 0xee, 1}))
+		})
+
+		It("adds the integrity tag to Retry packets, in QUIC version 1", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return false }
+			hdr := &wire.Header{
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.Version1,
+			}
+			serv.handleInitial(&receivedPacket{
+				remoteAddr: &net.UDPAddr{},
+				header:     hdr,
+				data:       bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize),
+			})
+			data := conn.dataWritten.Bytes()
+			Expect(len(data)).To(BeNumerically(">", wire.RetryIntegrityTagLen))
+			b := bytes.NewReader(data)
+			iHdr, err := wire.ParseInvariantHeader(b, 0)
+			Expect(err).ToNot(HaveOccurred())
+			replyHdr, err := iHdr.Parse(b, protocol.PerspectiveServer, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(replyHdr.DestConnectionID).To(Equal(hdr.SrcConnectionID))
+			Expect(replyHdr.Token).ToNot(BeEmpty())
+			tagOffset := len(data) - wire.RetryIntegrityTagLen
+			Expect(data[tagOffset:]).To(Equal(handshake.GetRetryIntegrityTag(data[:tagOffset], hdr.DestConnectionID)))
+		})
+
+		It("sends the connection IDs in the transport parameters, in QUIC version 1", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
+			hdr := &wire.Header{
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.Version1,
+			}
+			p := &receivedPacket{
+				header: hdr,
+				data:   bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize),
+			}
+			run := make(chan struct{})
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				srcConnID protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				params *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				Expect(params.OriginalConnectionID).To(Equal(hdr.DestConnectionID))
+				Expect(params.InitialSourceConnectionID).To(Equal(srcConnID))
+				Expect(params.RetrySourceConnectionID).To(BeNil())
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(p)
+				sess.EXPECT().run().Do(func() { close(run) })
+				return sess, nil
+			}
+			serv.handleInitial(p)
+			Eventually(run).Should(BeClosed())
+		})
+
+		It("advertises the preferred address, and registers its generated connection ID", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
+			serv.config.PreferredAddressIPv6 = &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4433}
+			serv.config.ConnectionIDGenerator = &counterConnIDGenerator{}
+			phm := NewMockPacketHandlerManager(mockCtrl)
+			serv.sessionHandler = phm
+			p := &receivedPacket{
+				header: &wire.Header{
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Version:          protocol.VersionTLS,
+				},
+				data: bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize),
+			}
+			var connID, preferredAddrConnID protocol.ConnectionID
+			run := make(chan struct{})
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				srcConnID protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				params *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				Expect(params.PreferredAddress).ToNot(BeNil())
+				Expect(params.PreferredAddress.IPv4).To(BeNil())
+				Expect(params.PreferredAddress.IPv6).To(Equal(net.ParseIP("2001:db8::1")))
+				Expect(params.PreferredAddress.IPv6Port).To(BeEquivalentTo(4433))
+				connID = srcConnID
+				preferredAddrConnID = params.PreferredAddress.ConnectionID
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(p)
+				sess.EXPECT().run().Do(func() { close(run) })
+				return sess, nil
+			}
+			var registered []protocol.ConnectionID
+			phm.EXPECT().Add(gomock.Any(), gomock.Any()).Do(func(c protocol.ConnectionID, _ packetHandler) {
+				registered = append(registered, c)
+			}).Times(2)
+			serv.handleInitial(p)
+			Eventually(run).Should(BeClosed())
+			Expect(registered).To(Equal([]protocol.ConnectionID{connID, preferredAddrConnID}))
+			// both connection IDs were generated by the ConnectionIDGenerator
+			Expect(connID).To(Equal(protocol.ConnectionID{0xc0, 0xff, 0xee, 1}))
+			Expect(preferredAddrConnID).To(Equal(protocol.ConnectionID{0xc0, 0xff, 0xee, 2}))
+		})
+
 		It("creates a session, if no Cookie is required", func() {
 			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
 			hdr := &wire.Header{
@@ -316,7 +529,7 @@ var _ = Describe("Server", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				_, err := serv.Accept()
+				_, err := serv.Accept(context.Background())
 				Expect(err).To(MatchError(testErr))
 				close(done)
 			}()
@@ -325,11 +538,26 @@ var _ = Describe("Server", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("returns when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := serv.Accept(ctx)
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("returns immediately, if an error occurred before", func() {
 			testErr := errors.New("test err")
 			Expect(serv.closeWithError(testErr)).To(Succeed())
 			for i := 0; i < 3; i++ {
-				_, err := serv.Accept()
+				_, err := serv.Accept(context.Background())
 				Expect(err).To(MatchError(testErr))
 			}
 		})
@@ -340,7 +568,7 @@ var _ = Describe("Server", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				s, err := serv.Accept()
+				s, err := serv.Accept(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(s).To(Equal(sess))
 				close(done)
@@ -366,12 +594,71 @@ var _ = Describe("Server", func() {
 				sess.EXPECT().run().Do(func() {})
 				return sess, nil
 			}
-			_, err := serv.createNewSession(&net.UDPAddr{}, nil, nil, nil, nil, protocol.VersionWhatever)
+			_, err := serv.createNewSession(&net.UDPAddr{}, nil, nil, nil, nil, nil, protocol.VersionWhatever)
 			Expect(err).ToNot(HaveOccurred())
 			Consistently(done).ShouldNot(BeClosed())
 			close(completeHandshake)
 			Eventually(done).Should(BeClosed())
 		})
+
+		It("accepts sessions before the handshake completes, if early sessions are enabled", func() {
+			serv.config.AcceptEarlySessions = true
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
+			sess := NewMockQuicSession(mockCtrl)
+			run := make(chan struct{})
+			serv.newSession = func(
+				_ connection,
+				runner sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sess.EXPECT().handlePacket(gomock.Any())
+				sess.EXPECT().run().Do(func() { close(run) })
+				sess.EXPECT().Context().Return(context.Background())
+				return sess, nil
+			}
+			serv.handlePacket(&receivedPacket{
+				header: &wire.Header{
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Version:          protocol.VersionTLS,
+				},
+				data: bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize),
+			})
+			s, err := serv.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(sess))
+			// the session is not accepted a second time when the handshake completes
+			serv.sessionRunner.onHandshakeComplete(sess)
+			Expect(serv.sessionQueue).To(BeEmpty())
+			Eventually(run).Should(BeClosed())
+		})
+
+		It("doesn't queue early sessions that are closed before being accepted", func() {
+			serv.config.AcceptEarlySessions = true
+			ctx, cancel := context.WithCancel(context.Background())
+			sess := NewMockQuicSession(mockCtrl)
+			sess.EXPECT().Context().Return(ctx)
+			for i := 0; i < cap(serv.sessionQueue); i++ {
+				serv.sessionQueue <- NewMockQuicSession(mockCtrl)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				serv.acceptEarly(sess)
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
 	})
 })
 
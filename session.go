@@ -2,11 +2,13 @@ package quic
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -34,12 +36,16 @@ type streamManager interface {
 	GetOrOpenReceiveStream(protocol.StreamID) (receiveStreamI, error)
 	OpenStream() (Stream, error)
 	OpenUniStream() (SendStream, error)
-	OpenStreamSync() (Stream, error)
-	OpenUniStreamSync() (SendStream, error)
-	AcceptStream() (Stream, error)
-	AcceptUniStream() (ReceiveStream, error)
+	OpenStreamSync(context.Context) (Stream, error)
+	OpenUniStreamSync(context.Context) (SendStream, error)
+	AcceptStream(context.Context) (Stream, error)
+	AcceptUniStream(context.Context) (ReceiveStream, error)
 	DeleteStream(protocol.StreamID) error
 	UpdateLimits(*handshake.TransportParameters)
+	SetMaxIncomingStreams(uint64)
+	SetMaxIncomingUniStreams(uint64)
+	IncomingStreamCredit() StreamCredit
+	IncomingUniStreamCredit() StreamCredit
 	HandleMaxStreamsFrame(*wire.MaxStreamsFrame) error
 	CloseWithError(error)
 }
@@ -51,6 +57,8 @@ type cryptoStreamHandler interface {
 }
 
 type receivedPacket struct {
+	// the packet conn that the packet was received on
+	conn       net.PacketConn
 	remoteAddr net.Addr
 	header     *wire.Header
 	data       []byte
@@ -63,12 +71,53 @@ type closeError struct {
 	sendClose bool
 }
 
+// A migration to a new path.
+// The client migrates to a new packet conn when Session.Migrate is called,
+// and to the server's preferred address after the handshake, if the server advertised one.
+// The server migrates when the client sends non-probing packets from a new address.
+type migration struct {
+	ctx context.Context
+	// the packet conn used on the new path, nil if the current packet conn is kept
+	pconn net.PacketConn
+	// the remote address and the connection ID used on the new path
+	remoteAddr    net.Addr
+	destConnID    protocol.ConnectionID
+	destConnIDSeq uint64
+	done          chan error
+
+	// the data of the PATH_CHALLENGE frames sent on the new path
+	challenges [][8]byte
+	// nextProbe is the time when the next PATH_CHALLENGE is sent (or validation fails)
+	nextProbe time.Time
+
+	// Used by the server to limit the amount of data sent to an address that was not validated yet.
+	bytesReceived protocol.ByteCount
+	bytesSent     protocol.ByteCount
+}
+
 // A Session is a QUIC session
 type session struct {
 	sessionRunner sessionRunner
 
 	destConnID protocol.ConnectionID
 	srcConnID  protocol.ConnectionID
+	// the sequence number of destConnID
+	destConnIDSeq uint64
+	// connection IDs issued by the peer that were not used yet, sorted by sequence number
+	unusedPeerConnIDs []*wire.NewConnectionIDFrame
+	// the sequence numbers of all connection IDs issued by the peer, used to ignore retransmissions
+	peerConnIDSeqs map[uint64]struct{}
+	// connection IDs issued by the peer with a lower sequence number must be retired
+	peerRetirePriorTo uint64
+
+	// the connection IDs that the peer can use to send packets to us, by sequence number
+	// This includes the srcConnID, and the connection ID advertised in the server's preferred_address.
+	activeConnIDsMutex sync.Mutex
+	activeConnIDs      map[uint64]protocol.ConnectionID
+	// the sequence number of the next connection ID issued in a NEW_CONNECTION_ID frame
+	nextConnIDSeq uint64
+	// the Source Connection ID of the Retry packet, nil if no Retry was performed (client only)
+	retrySrcConnID protocol.ConnectionID
 
 	perspective protocol.Perspective
 	version     protocol.VersionNumber
@@ -85,6 +134,7 @@ type session struct {
 	receivedPacketHandler ackhandler.ReceivedPacketHandler
 	framer                framer
 	windowUpdateQueue     *windowUpdateQueue
+	retransmissionFilter  *retransmissionFilter
 	connFlowController    flowcontrol.ConnectionFlowController
 
 	unpacker unpacker
@@ -95,6 +145,10 @@ type session struct {
 	receivedPackets  chan *receivedPacket
 	sendingScheduled chan struct{}
 
+	migrations chan *migration
+	// the migration that is currently in progress, nil if there is none
+	migration *migration
+
 	closeOnce sync.Once
 	closed    utils.AtomicBool
 	// closeChan is used to notify the run loop that it should terminate
@@ -102,9 +156,12 @@ type session struct {
 	connectionClosePacket     *packedPacket
 	packetsReceivedAfterClose int
 
-	ctx       context.Context
+	ctx       *closeContext
 	ctxCancel context.CancelFunc
 
+	handshakeCtx       context.Context
+	handshakeCtxCancel context.CancelFunc
+
 	undecryptablePackets []*receivedPacket
 
 	clientHelloWritten    <-chan struct{}
@@ -114,6 +171,9 @@ type session struct {
 	receivedFirstPacket              bool // since packet numbers start at 0, we can't use largestRcvdPacketNumber != 0 for this
 	receivedFirstForwardSecurePacket bool
 	lastRcvdPacketNumber             protocol.PacketNumber
+	// the path that the last packet was received on
+	lastRcvdPacketConn net.PacketConn
+	lastRcvdPacketAddr net.Addr
 	// Used to calculate the next packet number from the truncated wire
 	// representation, and sent back in public reset packets
 	largestRcvdPacketNumber protocol.PacketNumber
@@ -125,17 +185,31 @@ type session struct {
 
 	peerParams *handshake.TransportParameters
 
+	// the flow control windows granted to the peer in the transport parameters
+	initialConnectionWindow protocol.ByteCount
+	initialStreamWindow     protocol.ByteCount
+
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
 	keepAlivePingSent bool
 
+	// events for the OnBlocked callback, delivered from the run loop
+	blockedEventsMutex sync.Mutex
+	blockedEvents      []BlockedEvent
+
 	logger utils.Logger
 }
 
 var _ Session = &session{}
 var _ streamSender = &session{}
 
+// declare these as variables, such that we can mock them in the tests
+var (
+	newCryptoSetupServer = handshake.NewCryptoSetupServer
+	newCryptoSetupClient = handshake.NewCryptoSetupClient
+)
+
 var newSession = func(
 	conn connection,
 	runner sessionRunner,
@@ -159,7 +233,15 @@ var newSession = func(
 		logger:                logger,
 		version:               v,
 	}
-	s.preSetup()
+	s.activeConnIDs = map[uint64]protocol.ConnectionID{0: srcConnID}
+	if params != nil && params.PreferredAddress != nil {
+		s.activeConnIDs[1] = params.PreferredAddress.ConnectionID
+	}
+	s.nextConnIDSeq = uint64(len(s.activeConnIDs))
+	if err := s.preSetup(); err != nil {
+		return nil, err
+	}
+	s.setInitialWindows(params)
 	initialStream := newCryptoStream()
 	handshakeStream := newCryptoStream()
 	s.streamsMap = newStreamsMap(
@@ -167,23 +249,27 @@ var newSession = func(
 		s.newFlowController,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
+		protocol.ByteCount(s.config.StreamSendBufferSize),
 		s.perspective,
 		s.version,
 	)
 	s.framer = newFramer(s.streamsMap, s.version)
-	cs, err := handshake.NewCryptoSetupServer(
+	cs, err := newCryptoSetupServer(
 		initialStream,
 		handshakeStream,
 		clientDestConnID,
 		params,
 		s.processTransportParameters,
 		tlsConf,
+		conf.ExternalPSK,
 		conf.Versions,
 		v,
 		logger,
 		protocol.PerspectiveServer,
 	)
 	if err != nil {
+		// release the memory reserved by the connection flow controller
+		s.connFlowController.Close()
 		return nil, err
 	}
 	s.cryptoStreamHandler = cs
@@ -205,6 +291,7 @@ var newSession = func(
 	s.cryptoStreamManager = newCryptoStreamManager(cs, initialStream, handshakeStream)
 
 	if err := s.postSetup(); err != nil {
+		s.connFlowController.Close()
 		return nil, err
 	}
 	s.unpacker = newPacketUnpacker(cs, s.version)
@@ -237,10 +324,20 @@ var newClientSession = func(
 		logger:                logger,
 		version:               v,
 	}
-	s.preSetup()
+	// In QUIC version 1, the original destination connection ID is always set.
+	// It only differs from the destination connection ID if a Retry was performed.
+	if v == protocol.Version1 && !origDestConnID.Equal(destConnID) {
+		s.retrySrcConnID = destConnID
+	}
+	s.activeConnIDs = map[uint64]protocol.ConnectionID{0: srcConnID}
+	s.nextConnIDSeq = 1
+	if err := s.preSetup(); err != nil {
+		return nil, err
+	}
+	s.setInitialWindows(params)
 	initialStream := newCryptoStream()
 	handshakeStream := newCryptoStream()
-	cs, clientHelloWritten, err := handshake.NewCryptoSetupClient(
+	cs, clientHelloWritten, err := newCryptoSetupClient(
 		initialStream,
 		handshakeStream,
 		origDestConnID,
@@ -248,6 +345,7 @@ var newClientSession = func(
 		params,
 		s.processTransportParameters,
 		tlsConf,
+		conf.ExternalPSK,
 		initialVersion,
 		conf.Versions,
 		v,
@@ -255,6 +353,8 @@ var newClientSession = func(
 		protocol.PerspectiveClient,
 	)
 	if err != nil {
+		// release the memory reserved by the connection flow controller
+		s.connFlowController.Close()
 		return nil, err
 	}
 	s.clientHelloWritten = clientHelloWritten
@@ -266,6 +366,7 @@ var newClientSession = func(
 		s.newFlowController,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
+		protocol.ByteCount(s.config.StreamSendBufferSize),
 		s.perspective,
 		s.version,
 	)
@@ -284,28 +385,62 @@ var newClientSession = func(
 		s.perspective,
 		s.version,
 	)
-	return s, s.postSetup()
+	if err := s.postSetup(); err != nil {
+		s.connFlowController.Close()
+		return nil, err
+	}
+	return s, nil
 }
 
-func (s *session) preSetup() {
+func (s *session) preSetup() error {
+	s.initialConnectionWindow = protocol.InitialMaxData
+	if s.config.ReceiveMemoryBudget != nil {
+		// Only grant as much credit as the budget has left.
+		// If it can't even cover the minimum window, refuse the connection.
+		window, err := flowcontrol.ReserveInitialWindow(s.config.ReceiveMemoryBudget, protocol.InitialMaxData, protocol.MinInitialMaxData)
+		if err != nil {
+			return err
+		}
+		s.initialConnectionWindow = window
+	}
+	s.initialStreamWindow = utils.MinByteCount(protocol.InitialMaxStreamData, s.initialConnectionWindow)
+
 	s.rttStats = &congestion.RTTStats{}
+	s.retransmissionFilter = newRetransmissionFilter()
 	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, s.logger, s.version)
 	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.logger, s.version)
 	s.connFlowController = flowcontrol.NewConnectionFlowController(
-		protocol.InitialMaxData,
+		s.initialConnectionWindow,
 		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
+		s.config.ReceiveMemoryBudget,
 		s.onHasConnectionWindowUpdate,
 		s.rttStats,
 		s.logger,
 	)
+	return nil
+}
+
+// setInitialWindows sets the flow control windows that are announced in the transport parameters
+// to the windows that were granted by the memory budget.
+func (s *session) setInitialWindows(params *handshake.TransportParameters) {
+	if params == nil {
+		return
+	}
+	params.InitialMaxData = s.initialConnectionWindow
+	params.InitialMaxStreamDataBidiLocal = s.initialStreamWindow
+	params.InitialMaxStreamDataBidiRemote = s.initialStreamWindow
+	params.InitialMaxStreamDataUni = s.initialStreamWindow
 }
 
 func (s *session) postSetup() error {
 	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
 	s.closeChan = make(chan closeError, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
+	s.migrations = make(chan *migration)
+	s.peerConnIDSeqs = map[uint64]struct{}{0: {}}
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
-	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.ctx, s.ctxCancel = newCloseContext()
+	s.handshakeCtx, s.handshakeCtxCancel = context.WithCancel(context.Background())
 
 	s.timer = utils.NewTimer()
 	now := time.Now()
@@ -318,6 +453,9 @@ func (s *session) postSetup() error {
 
 // run the session main loop
 func (s *session) run() error {
+	// If the session is closed before the handshake completes, the handshake context is cancelled
+	// after the session context, such that Context().Err() can be used to check if the handshake failed.
+	defer s.handshakeCtxCancel()
 	defer s.ctxCancel()
 
 	go func() {
@@ -352,6 +490,11 @@ runLoop:
 
 		s.maybeResetTimer()
 
+		var migrationCancelled <-chan struct{}
+		if s.migration != nil {
+			migrationCancelled = s.migration.ctx.Done()
+		}
+
 		select {
 		case closeErr = <-s.closeChan:
 			break runLoop
@@ -365,7 +508,7 @@ runLoop:
 		case p := <-s.receivedPackets:
 			err := s.handlePacketImpl(p)
 			if err != nil {
-				if qErr, ok := err.(*qerr.QuicError); ok && qErr.ErrorCode == qerr.DecryptionFailure {
+				if _, ok := err.(*decryptionError); ok {
 					s.tryQueueingUndecryptablePacket(p)
 					continue
 				}
@@ -377,9 +520,17 @@ runLoop:
 			putPacketBuffer(&p.header.Raw)
 		case <-s.handshakeCompleteChan:
 			s.handleHandshakeComplete()
+		case m := <-s.migrations:
+			s.startMigration(m)
+		case <-migrationCancelled:
+			s.abortMigration(s.migration.ctx.Err())
 		}
+		s.deliverBlockedEvents()
 
 		now := time.Now()
+		if s.migration != nil && !now.Before(s.migration.nextProbe) {
+			s.onPathProbeTimeout(now)
+		}
 		if timeout := s.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && timeout.Before(now) {
 			// This could cause packets to be retransmitted.
 			// Check it before trying to send packets.
@@ -406,11 +557,12 @@ runLoop:
 		}
 
 		if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
-			s.closeLocal(qerr.Error(qerr.HandshakeTimeout, "Crypto handshake did not complete in time."))
+			s.closeLocal(&HandshakeTimeoutError{})
 			continue
 		}
 		if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.config.IdleTimeout {
-			s.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
+			// An idle timeout closes the connection silently, see section 10.1 of RFC 9000.
+			s.destroy(&IdleTimeoutError{})
 			continue
 		}
 
@@ -419,23 +571,341 @@ runLoop:
 		}
 	}
 
-	if err := s.handleCloseError(closeErr); err != nil {
-		s.logger.Infof("Handling close error failed: %s", err)
+	err := s.handleCloseError(closeErr)
+	if s.migration != nil {
+		s.abortMigration(err)
 	}
 	s.closed.Set(true)
 	s.logger.Infof("Connection %s closed.", s.srcConnID)
 	s.cryptoStreamHandler.Close()
-	return closeErr.err
+	s.connFlowController.Close()
+	s.ctx.setErr(err)
+	if closeErr.err == nil { // closed using Session.Close
+		return nil
+	}
+	return err
 }
 
+// The context is cancelled when the session is closed.
+// Its Err method returns the error that caused the session to close.
 func (s *session) Context() context.Context {
 	return s.ctx
 }
 
+func (s *session) HandshakeComplete() context.Context {
+	return s.handshakeCtx
+}
+
+// A closeContext is the context of a session.
+// Once the session is closed, Err returns the error that caused the session to close.
+type closeContext struct {
+	context.Context
+
+	mutex sync.Mutex
+	err   error
+}
+
+func newCloseContext() (*closeContext, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &closeContext{Context: ctx}, cancel
+}
+
+func (c *closeContext) setErr(err error) {
+	c.mutex.Lock()
+	c.err = err
+	c.mutex.Unlock()
+}
+
+func (c *closeContext) Err() error {
+	if err := c.Context.Err(); err == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.Context.Err()
+}
+
 func (s *session) ConnectionState() ConnectionState {
 	return s.cryptoStreamHandler.ConnectionState()
 }
 
+func (s *session) Migrate(ctx context.Context, pconn net.PacketConn) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return errors.New("only the client can migrate a session")
+	}
+	select {
+	case <-s.handshakeCtx.Done():
+	default:
+		return errors.New("can't migrate before the handshake completed")
+	}
+	m := &migration{
+		ctx:   ctx,
+		pconn: pconn,
+		done:  make(chan error, 1),
+	}
+	select {
+	case s.migrations <- m:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	select {
+	case err := <-m.done:
+		return err
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// startMigration registers the session with the new packet conn and starts validating the new path.
+func (s *session) startMigration(m *migration) {
+	if s.migration != nil {
+		m.done <- errors.New("a migration is already in progress")
+		return
+	}
+	if !s.handshakeComplete {
+		m.done <- errors.New("can't migrate before the handshake completed")
+		return
+	}
+	if s.peerParams.DisableMigration {
+		m.done <- errors.New("the peer disabled connection migration")
+		return
+	}
+	if s.destConnID.Len() > 0 && len(s.unusedPeerConnIDs) == 0 {
+		m.done <- errors.New("the peer didn't issue an unused connection ID")
+		return
+	}
+	if err := s.sessionRunner.addPacketConn(m.pconn); err != nil {
+		m.done <- err
+		return
+	}
+	m.remoteAddr = s.conn.RemoteAddr()
+	m.destConnID = s.destConnID
+	m.destConnIDSeq = s.destConnIDSeq
+	// Use a new connection ID on the new path, such that it can't be linked to the old path.
+	if s.destConnID.Len() > 0 {
+		f := s.popPeerConnectionID()
+		m.destConnID = f.ConnectionID
+		m.destConnIDSeq = f.SequenceNumber
+	}
+	s.validatePath(m)
+}
+
+// migrateToPreferredAddress starts validating the preferred address advertised by the server.
+// If validation fails, the session continues using the original address.
+func (s *session) migrateToPreferredAddress(pa *handshake.PreferredAddress) {
+	// The connection ID from the preferred_address has the sequence number 1.
+	// If the preferred address is not used, it can be used when migrating to a new packet conn.
+	if err := s.handleNewConnectionIDFrame(&wire.NewConnectionIDFrame{
+		SequenceNumber:      1,
+		ConnectionID:        pa.ConnectionID,
+		StatelessResetToken: pa.StatelessResetToken,
+	}); err != nil {
+		s.closeLocal(err)
+		return
+	}
+	remoteAddr, ok := s.conn.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	var addr *net.UDPAddr
+	if remoteAddr.IP.To4() != nil {
+		if pa.IPv4 != nil && !pa.IPv4.IsUnspecified() {
+			addr = &net.UDPAddr{IP: pa.IPv4, Port: int(pa.IPv4Port)}
+		}
+	} else if pa.IPv6 != nil && !pa.IPv6.IsUnspecified() {
+		addr = &net.UDPAddr{IP: pa.IPv6, Port: int(pa.IPv6Port)}
+	}
+	if addr == nil {
+		s.logger.Debugf("Ignoring preferred_address, since it doesn't contain an address of the same family as %s.", remoteAddr)
+		return
+	}
+	f := s.popPeerConnectionID()
+	s.validatePath(&migration{
+		ctx:           context.Background(),
+		remoteAddr:    addr,
+		destConnID:    f.ConnectionID,
+		destConnIDSeq: f.SequenceNumber,
+		done:          make(chan error, 1),
+	})
+}
+
+// validatePath starts validating the new path of a migration.
+func (s *session) validatePath(m *migration) {
+	s.logger.Infof("Migrating to %s. Validating the new path.", m)
+	s.migration = m
+	if err := s.sendPathChallenge(time.Now()); err != nil {
+		s.abortMigration(err)
+	}
+}
+
+// sendPathChallenge sends a PATH_CHALLENGE on the path that is being validated.
+func (s *session) sendPathChallenge(now time.Time) error {
+	frame := &wire.PathChallengeFrame{}
+	if _, err := rand.Read(frame.Data[:]); err != nil {
+		return err
+	}
+	packet, err := s.packer.PackPathChallenge(frame, s.migration.destConnID)
+	if err != nil {
+		return err
+	}
+	s.migration.challenges = append(s.migration.challenges, frame.Data)
+	// PATH_CHALLENGEs are not retransmitted. Instead, a new one is sent after 3 RTTs.
+	s.migration.nextProbe = now.Add(3 * s.rttStats.SmoothedOrInitialRTT())
+	return s.sendOnMigrationPath(packet)
+}
+
+// sendOnMigrationPath sends a packet on the path that is being validated.
+func (s *session) sendOnMigrationPath(packet *packedPacket) error {
+	defer putPacketBuffer(&packet.raw)
+	if s.perspective == protocol.PerspectiveServer {
+		// Until the client's new address is validated, the server may only send 3 times the amount of data it received from that address.
+		size := protocol.ByteCount(len(packet.raw))
+		if s.migration.bytesSent+size > protocol.MaxAmplificationFactor*s.migration.bytesReceived {
+			s.logger.Debugf("Not sending packet to %s. Anti-amplification limit reached.", s.migration.remoteAddr)
+			return nil
+		}
+		s.migration.bytesSent += size
+	}
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.logPacket(packet)
+	if s.migration.pconn == nil {
+		return s.conn.WriteTo(packet.raw, s.migration.remoteAddr)
+	}
+	_, err := s.migration.pconn.WriteTo(packet.raw, s.migration.remoteAddr)
+	return err
+}
+
+// receivedOnMigrationPath says if the last packet was received on the path that is being validated.
+func (s *session) receivedOnMigrationPath() bool {
+	if s.migration == nil || s.lastRcvdPacketAddr == nil {
+		return false
+	}
+	if s.migration.pconn != nil {
+		return s.lastRcvdPacketConn == s.migration.pconn
+	}
+	return s.lastRcvdPacketAddr.String() == s.migration.remoteAddr.String()
+}
+
+func (s *session) onPathProbeTimeout(now time.Time) {
+	if len(s.migration.challenges) >= protocol.MaxPathChallenges {
+		s.abortMigration(errors.New("path validation timed out"))
+		return
+	}
+	if err := s.sendPathChallenge(now); err != nil {
+		s.abortMigration(err)
+	}
+}
+
+// maybeValidatePeerAddress is called by the server for every packet received after the handshake completed.
+// The client might have migrated to a new address.
+// The server only switches to the new address after validating it,
+// and only if the client sent a non-probing packet from that address.
+// Only the most recent packet is considered, in order to not switch back on reordered packets.
+// It must be called before largestRcvdPacketNumber is updated.
+func (s *session) maybeValidatePeerAddress(p *receivedPacket, frames []wire.Frame) {
+	size := protocol.ByteCount(len(p.header.Raw) + len(p.data))
+	if s.migration != nil && p.remoteAddr.String() == s.migration.remoteAddr.String() {
+		s.migration.bytesReceived += size
+	}
+	if p.header.PacketNumber <= s.largestRcvdPacketNumber || isProbingPacket(frames) {
+		return
+	}
+	if p.remoteAddr.String() == s.conn.RemoteAddr().String() {
+		// The client switched back to the current address.
+		if s.migration != nil {
+			s.abortMigration(errors.New("the peer returned to the current address"))
+		}
+		return
+	}
+	if s.migration != nil {
+		if p.remoteAddr.String() == s.migration.remoteAddr.String() {
+			return
+		}
+		s.abortMigration(fmt.Errorf("the peer moved to %s", p.remoteAddr))
+	}
+	s.validatePath(&migration{
+		ctx:           context.Background(),
+		remoteAddr:    p.remoteAddr,
+		destConnID:    s.destConnID,
+		destConnIDSeq: s.destConnIDSeq,
+		done:          make(chan error, 1),
+		bytesReceived: size,
+	})
+}
+
+// isProbingPacket says if a packet only contains probing frames.
+// A client might send probing packets on a new path without migrating to it.
+func isProbingPacket(frames []wire.Frame) bool {
+	for _, f := range frames {
+		switch f.(type) {
+		case *wire.PathChallengeFrame, *wire.PathResponseFrame, *wire.NewConnectionIDFrame:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// completeMigration switches to the new path, after it was validated.
+func (s *session) completeMigration() {
+	m := s.migration
+	s.migration = nil
+	if m.pconn != nil {
+		oldPacketConn := s.conn.SetPacketConn(m.pconn)
+		s.sessionRunner.removePacketConn(oldPacketConn)
+	}
+	s.conn.SetCurrentRemoteAddr(m.remoteAddr)
+	if !m.destConnID.Equal(s.destConnID) {
+		s.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: s.destConnIDSeq})
+		s.destConnID = m.destConnID
+		s.destConnIDSeq = m.destConnIDSeq
+		s.packer.ChangeDestConnectionID(m.destConnID)
+	}
+	// The RTT of the new path might be very different.
+	s.rttStats.OnConnectionMigration()
+	s.logger.Infof("Migrated to %s.", m)
+	m.done <- nil
+}
+
+// abortMigration stops the migration in progress. The session continues using the old path.
+func (s *session) abortMigration(e error) {
+	m := s.migration
+	s.migration = nil
+	if m.pconn != nil {
+		s.sessionRunner.removePacketConn(m.pconn)
+	}
+	// The connection ID was used on the new path.
+	// Using it on the old path would allow linking the two paths.
+	if !m.destConnID.Equal(s.destConnID) {
+		s.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: m.destConnIDSeq})
+	}
+	s.logger.Infof("Migration to %s failed: %s", m, e)
+	m.done <- e
+}
+
+// popPeerConnectionID removes the unused connection ID with the lowest sequence number and returns it.
+// It returns nil if there are no unused connection IDs.
+func (s *session) popPeerConnectionID() *wire.NewConnectionIDFrame {
+	if len(s.unusedPeerConnIDs) == 0 {
+		return nil
+	}
+	f := s.unusedPeerConnIDs[0]
+	s.unusedPeerConnIDs = s.unusedPeerConnIDs[1:]
+	return f
+}
+
+func (m *migration) String() string {
+	if m.pconn == nil {
+		return fmt.Sprintf("remote address %s", m.remoteAddr)
+	}
+	return fmt.Sprintf("local address %s", m.pconn.LocalAddr())
+}
+
 func (s *session) maybeResetTimer() {
 	var deadline time.Time
 	if s.config.KeepAlive && s.handshakeComplete && !s.keepAlivePingSent {
@@ -457,6 +927,9 @@ func (s *session) maybeResetTimer() {
 	if !s.pacingDeadline.IsZero() {
 		deadline = utils.MinTime(deadline, s.pacingDeadline)
 	}
+	if s.migration != nil {
+		deadline = utils.MinTime(deadline, s.migration.nextProbe)
+	}
 
 	s.timer.Reset(deadline)
 }
@@ -464,6 +937,7 @@ func (s *session) maybeResetTimer() {
 func (s *session) handleHandshakeComplete() {
 	s.handshakeComplete = true
 	s.handshakeCompleteChan = nil // prevent this case from ever being selected again
+	s.handshakeCtxCancel()
 	s.sessionRunner.onHandshakeComplete(s)
 
 	// The client completes the handshake first (after sending the CFIN).
@@ -473,8 +947,19 @@ func (s *session) handleHandshakeComplete() {
 	// We need to make sure that a retransmittable forward-secure packet is sent,
 	// independent from the application protocol.
 	if s.perspective == protocol.PerspectiveServer {
-		s.queueControlFrame(&wire.PingFrame{})
+		// In QUIC version 1, the server signals handshake completion explicitly.
+		if s.version == protocol.Version1 {
+			s.queueControlFrame(&wire.HandshakeDoneFrame{})
+		} else {
+			s.queueControlFrame(&wire.PingFrame{})
+		}
 		s.sentPacketHandler.SetHandshakeComplete()
+		if err := s.issueConnectionIDs(); err != nil {
+			s.closeLocal(err)
+		}
+	}
+	if s.perspective == protocol.PerspectiveClient && s.peerParams != nil && s.peerParams.PreferredAddress != nil {
+		s.migrateToPreferredAddress(s.peerParams.PreferredAddress)
 	}
 }
 
@@ -488,13 +973,16 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	}
 
 	p.rcvTime = time.Now()
-	// Calculate packet number
-	hdr.PacketNumber = protocol.InferPacketNumber(
-		hdr.PacketNumberLen,
-		s.largestRcvdPacketNumber,
-		hdr.PacketNumber,
-		s.version,
-	)
+	// Calculate packet number.
+	// If header protection is used, the packet number is only available after unpacking.
+	if !s.version.UsesHeaderProtection() {
+		hdr.PacketNumber = protocol.InferPacketNumber(
+			hdr.PacketNumberLen,
+			s.largestRcvdPacketNumber,
+			hdr.PacketNumber,
+			s.version,
+		)
+	}
 
 	packet, err := s.unpacker.Unpack(hdr.Raw, hdr, p.data)
 	if s.logger.Debug() {
@@ -517,6 +1005,10 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 		s.packer.ChangeDestConnectionID(s.destConnID)
 	}
 
+	if s.perspective == protocol.PerspectiveServer && s.handshakeComplete && p.remoteAddr != nil {
+		s.maybeValidatePeerAddress(p, packet.frames)
+	}
+
 	s.receivedFirstPacket = true
 	s.lastNetworkActivityTime = p.rcvTime
 	s.keepAlivePingSent = false
@@ -531,6 +1023,8 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	}
 
 	s.lastRcvdPacketNumber = hdr.PacketNumber
+	s.lastRcvdPacketConn = p.conn
+	s.lastRcvdPacketAddr = p.remoteAddr
 	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
 	s.largestRcvdPacketNumber = utils.MaxPacketNumber(s.largestRcvdPacketNumber, hdr.PacketNumber)
 
@@ -558,9 +1052,11 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.AckFrame:
 			err = s.handleAckFrame(frame, encLevel)
 		case *wire.ConnectionCloseFrame:
-			s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
+			s.handleConnectionCloseFrame(frame)
 		case *wire.ResetStreamFrame:
 			err = s.handleResetStreamFrame(frame)
+		case *wire.ResetStreamAtFrame:
+			err = s.handleResetStreamAtFrame(frame)
 		case *wire.MaxDataFrame:
 			s.handleMaxDataFrame(frame)
 		case *wire.MaxStreamDataFrame:
@@ -568,21 +1064,25 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.MaxStreamsFrame:
 			err = s.handleMaxStreamsFrame(frame)
 		case *wire.DataBlockedFrame:
+			s.handleDataBlockedFrame(frame)
 		case *wire.StreamDataBlockedFrame:
+			err = s.handleStreamDataBlockedFrame(frame)
 		case *wire.StreamsBlockedFrame:
+			s.handleStreamsBlockedFrame(frame)
 		case *wire.StopSendingFrame:
 			err = s.handleStopSendingFrame(frame)
 		case *wire.PingFrame:
 		case *wire.PathChallengeFrame:
-			s.handlePathChallengeFrame(frame)
+			err = s.handlePathChallengeFrame(frame)
 		case *wire.PathResponseFrame:
-			// since we don't send PATH_CHALLENGEs, we don't expect PATH_RESPONSEs
-			err = errors.New("unexpected PATH_RESPONSE frame")
+			s.handlePathResponseFrame(frame)
 		case *wire.NewTokenFrame:
 		case *wire.NewConnectionIDFrame:
+			err = s.handleNewConnectionIDFrame(frame)
 		case *wire.RetireConnectionIDFrame:
-			// since we don't send new connection IDs, we don't expect retirements
-			err = errors.New("unexpected RETIRE_CONNECTION_ID frame")
+			err = s.handleRetireConnectionIDFrame(frame)
+		case *wire.HandshakeDoneFrame:
+			err = s.handleHandshakeDoneFrame()
 		default:
 			return errors.New("Session BUG: unexpected frame type")
 		}
@@ -638,7 +1138,7 @@ func (s *session) handleCryptoFrame(frame *wire.CryptoFrame, encLevel protocol.E
 
 func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.EncryptionLevel) error {
 	if encLevel < protocol.Encryption1RTT {
-		return qerr.Error(qerr.UnencryptedStreamData, fmt.Sprintf("received unencrypted stream data on stream %d", frame.StreamID))
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("received unencrypted stream data on stream %d", frame.StreamID))
 	}
 	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
 	if err != nil {
@@ -673,6 +1173,71 @@ func (s *session) handleMaxStreamsFrame(frame *wire.MaxStreamsFrame) error {
 	return s.streamsMap.HandleMaxStreamsFrame(frame)
 }
 
+func (s *session) handleDataBlockedFrame(frame *wire.DataBlockedFrame) {
+	s.connFlowController.HandlePeerBlocked(frame.DataLimit)
+	s.reportBlocked(frame, false)
+}
+
+func (s *session) handleStreamDataBlockedFrame(frame *wire.StreamDataBlockedFrame) error {
+	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
+	if err != nil {
+		return err
+	}
+	if str == nil {
+		// stream is closed and already garbage collected
+		return nil
+	}
+	str.handleStreamDataBlockedFrame(frame)
+	s.reportBlocked(frame, false)
+	return nil
+}
+
+func (s *session) handleStreamsBlockedFrame(frame *wire.StreamsBlockedFrame) {
+	s.reportBlocked(frame, false)
+}
+
+// reportBlocked reports a DATA_BLOCKED, STREAM_DATA_BLOCKED or STREAMS_BLOCKED frame to the application.
+// local says if we sent the frame, or if we received it.
+// Since it might be called while holding the mutex of a stream or of the streams map,
+// the event is only queued here, and delivered from the run loop.
+func (s *session) reportBlocked(f wire.Frame, local bool) {
+	if s.config.OnBlocked == nil {
+		return
+	}
+	var event BlockedEvent
+	switch frame := f.(type) {
+	case *wire.DataBlockedFrame:
+		event = BlockedEvent{Type: BlockedData, Limit: uint64(frame.DataLimit)}
+	case *wire.StreamDataBlockedFrame:
+		event = BlockedEvent{Type: BlockedStreamData, StreamID: frame.StreamID, Limit: uint64(frame.DataLimit)}
+	case *wire.StreamsBlockedFrame:
+		event = BlockedEvent{Type: BlockedBidiStreams, Limit: frame.StreamLimit}
+		if frame.Type == protocol.StreamTypeUni {
+			event.Type = BlockedUniStreams
+		}
+	default:
+		return
+	}
+	event.Local = local
+	s.blockedEventsMutex.Lock()
+	s.blockedEvents = append(s.blockedEvents, event)
+	s.blockedEventsMutex.Unlock()
+	s.scheduleSending()
+}
+
+// deliverBlockedEvents calls the OnBlocked callback for all queued events.
+// It must be called from the run loop, without holding any locks.
+func (s *session) deliverBlockedEvents() {
+	s.blockedEventsMutex.Lock()
+	events := s.blockedEvents
+	s.blockedEvents = nil
+	s.blockedEventsMutex.Unlock()
+
+	for _, e := range events {
+		s.config.OnBlocked(s, e)
+	}
+}
+
 func (s *session) handleResetStreamFrame(frame *wire.ResetStreamFrame) error {
 	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
 	if err != nil {
@@ -685,6 +1250,21 @@ func (s *session) handleResetStreamFrame(frame *wire.ResetStreamFrame) error {
 	return str.handleResetStreamFrame(frame)
 }
 
+func (s *session) handleResetStreamAtFrame(frame *wire.ResetStreamAtFrame) error {
+	if !s.config.EnableReliableStreamReset {
+		return qerr.Error(qerr.FrameEncodingError, "received a RESET_STREAM_AT frame, but the reliable stream reset extension was not negotiated")
+	}
+	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
+	if err != nil {
+		return err
+	}
+	if str == nil {
+		// stream is closed and already garbage collected
+		return nil
+	}
+	return str.handleResetStreamAtFrame(frame)
+}
+
 func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	str, err := s.streamsMap.GetOrOpenSendStream(frame.StreamID)
 	if err != nil {
@@ -698,22 +1278,182 @@ func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	return nil
 }
 
-func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
-	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
+// handlePathChallengeFrame answers a PATH_CHALLENGE.
+// The PATH_RESPONSE is sent on the path that the PATH_CHALLENGE was received on,
+// otherwise the peer would validate a path that might not work in both directions.
+func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) error {
+	response := &wire.PathResponseFrame{Data: frame.Data}
+	if s.receivedOnMigrationPath() {
+		packet, err := s.packer.PackPathResponse(response, s.migration.destConnID)
+		if err != nil {
+			return err
+		}
+		return s.sendOnMigrationPath(packet)
+	}
+	if s.lastRcvdPacketAddr == nil || s.lastRcvdPacketAddr.String() == s.conn.RemoteAddr().String() {
+		s.queueControlFrame(response)
+		return nil
+	}
+	// The peer is probing a path without migrating to it.
+	packet, err := s.packer.PackPathResponse(response, s.destConnID)
+	if err != nil {
+		return err
+	}
+	defer putPacketBuffer(&packet.raw)
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.logPacket(packet)
+	if s.lastRcvdPacketConn == nil {
+		return s.conn.WriteTo(packet.raw, s.lastRcvdPacketAddr)
+	}
+	_, err = s.lastRcvdPacketConn.WriteTo(packet.raw, s.lastRcvdPacketAddr)
+	return err
+}
+
+func (s *session) handlePathResponseFrame(frame *wire.PathResponseFrame) {
+	if s.migration == nil {
+		// This might be a late response to a PATH_CHALLENGE sent for a previous migration.
+		s.logger.Debugf("Ignoring PATH_RESPONSE, since no migration is in progress.")
+		return
+	}
+	// A PATH_RESPONSE received on a different path doesn't prove that the peer can reach us on the new path.
+	if !s.receivedOnMigrationPath() {
+		s.logger.Debugf("Ignoring PATH_RESPONSE that was not received on the path that is being validated.")
+		return
+	}
+	for _, data := range s.migration.challenges {
+		if data == frame.Data {
+			s.completeMigration()
+			return
+		}
+	}
+	s.logger.Debugf("Ignoring PATH_RESPONSE that doesn't match any PATH_CHALLENGE.")
+}
+
+// handleNewConnectionIDFrame stores a connection ID issued by the peer.
+// It is used when migrating to a new path.
+func (s *session) handleNewConnectionIDFrame(frame *wire.NewConnectionIDFrame) error {
+	if s.destConnID.Len() == 0 {
+		return qerr.Error(qerr.ProtocolViolation, "received a NEW_CONNECTION_ID frame, but the peer uses a zero-length connection ID")
+	}
+	if _, ok := s.peerConnIDSeqs[frame.SequenceNumber]; ok {
+		// a retransmission
+		return nil
+	}
+	s.peerConnIDSeqs[frame.SequenceNumber] = struct{}{}
+	i := sort.Search(len(s.unusedPeerConnIDs), func(i int) bool {
+		return s.unusedPeerConnIDs[i].SequenceNumber > frame.SequenceNumber
+	})
+	s.unusedPeerConnIDs = append(s.unusedPeerConnIDs, nil)
+	copy(s.unusedPeerConnIDs[i+1:], s.unusedPeerConnIDs[i:])
+	s.unusedPeerConnIDs[i] = frame
+
+	if frame.RetirePriorTo > s.peerRetirePriorTo {
+		s.peerRetirePriorTo = frame.RetirePriorTo
+	}
+	for len(s.unusedPeerConnIDs) > 0 && s.unusedPeerConnIDs[0].SequenceNumber < s.peerRetirePriorTo {
+		s.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: s.unusedPeerConnIDs[0].SequenceNumber})
+		s.unusedPeerConnIDs = s.unusedPeerConnIDs[1:]
+	}
+	if s.destConnIDSeq < s.peerRetirePriorTo && s.migration == nil {
+		if f := s.popPeerConnectionID(); f != nil {
+			s.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: s.destConnIDSeq})
+			s.destConnID = f.ConnectionID
+			s.destConnIDSeq = f.SequenceNumber
+			s.packer.ChangeDestConnectionID(f.ConnectionID)
+		}
+	}
+	if len(s.unusedPeerConnIDs)+1 > protocol.MaxActiveConnectionIDs {
+		return qerr.Error(qerr.ConnectionIDLimitError, "too many connection IDs")
+	}
+	return nil
+}
+
+// handleRetireConnectionIDFrame stops routing packets for a connection ID to this session,
+// and issues a new connection ID to the client.
+func (s *session) handleRetireConnectionIDFrame(frame *wire.RetireConnectionIDFrame) error {
+	if s.perspective == protocol.PerspectiveClient {
+		// the client doesn't issue new connection IDs, so the server can't retire any
+		return errors.New("unexpected RETIRE_CONNECTION_ID frame")
+	}
+	if frame.SequenceNumber >= s.nextConnIDSeq {
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("retired connection ID %d, which was not issued yet", frame.SequenceNumber))
+	}
+	s.activeConnIDsMutex.Lock()
+	connID, ok := s.activeConnIDs[frame.SequenceNumber]
+	delete(s.activeConnIDs, frame.SequenceNumber)
+	s.activeConnIDsMutex.Unlock()
+	if !ok {
+		// already retired
+		return nil
+	}
+	s.sessionRunner.retireConnectionID(connID)
+	return s.issueConnectionIDs()
+}
+
+// issueConnectionIDs issues new connection IDs in NEW_CONNECTION_ID frames (server only),
+// such that the client has an unused connection ID available when it migrates.
+func (s *session) issueConnectionIDs() error {
+	for {
+		s.activeConnIDsMutex.Lock()
+		numActive := len(s.activeConnIDs)
+		s.activeConnIDsMutex.Unlock()
+		if numActive >= protocol.MaxActiveConnectionIDs {
+			return nil
+		}
+		connID, err := s.config.ConnectionIDGenerator.GenerateConnectionID()
+		if err != nil {
+			return err
+		}
+		frame := &wire.NewConnectionIDFrame{SequenceNumber: s.nextConnIDSeq, ConnectionID: connID}
+		if _, err := rand.Read(frame.StatelessResetToken[:]); err != nil {
+			return err
+		}
+		s.nextConnIDSeq++
+		s.activeConnIDsMutex.Lock()
+		s.activeConnIDs[frame.SequenceNumber] = connID
+		s.activeConnIDsMutex.Unlock()
+		// The session runner must not be called while holding the mutex,
+		// since it might close the session, which retires all active connection IDs.
+		s.sessionRunner.addConnectionID(connID, s)
+		s.queueControlFrame(frame)
+	}
+}
+
+func (s *session) handleHandshakeDoneFrame() error {
+	if s.perspective == protocol.PerspectiveServer {
+		return qerr.Error(qerr.ProtocolViolation, "received a HANDSHAKE_DONE frame")
+	}
+	// HANDSHAKE_DONE is sent in a 1-RTT packet.
+	// The client already stopped retransmitting handshake packets when it received that packet.
+	return nil
 }
 
 func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.EncryptionLevel) error {
 	if err := s.sentPacketHandler.ReceivedAck(frame, s.lastRcvdPacketNumber, encLevel, s.lastNetworkActivityTime); err != nil {
 		return err
 	}
+	s.retransmissionFilter.GarbageCollect(s.sentPacketHandler)
 	s.receivedPacketHandler.IgnoreBelow(s.sentPacketHandler.GetLowestPacketNotConfirmedAcked())
 	return nil
 }
 
+// localConnIDs returns the connection IDs that the peer uses to send packets to us
+func (s *session) localConnIDs() []protocol.ConnectionID {
+	s.activeConnIDsMutex.Lock()
+	defer s.activeConnIDsMutex.Unlock()
+	connIDs := make([]protocol.ConnectionID, 0, len(s.activeConnIDs))
+	for _, connID := range s.activeConnIDs {
+		connIDs = append(connIDs, connID)
+	}
+	return connIDs
+}
+
 // closeLocal closes the session and send a CONNECTION_CLOSE containing the error
 func (s *session) closeLocal(e error) {
 	s.closeOnce.Do(func() {
-		s.sessionRunner.retireConnectionID(s.srcConnID)
+		for _, connID := range s.localConnIDs() {
+			s.sessionRunner.retireConnectionID(connID)
+		}
 		s.closeChan <- closeError{err: e, sendClose: true, remote: false}
 	})
 }
@@ -721,19 +1461,23 @@ func (s *session) closeLocal(e error) {
 // destroy closes the session without sending the error on the wire
 func (s *session) destroy(e error) {
 	s.closeOnce.Do(func() {
-		s.sessionRunner.removeConnectionID(s.srcConnID)
+		for _, connID := range s.localConnIDs() {
+			s.sessionRunner.removeConnectionID(connID)
+		}
 		s.closeChan <- closeError{err: e, sendClose: false, remote: false}
 	})
 }
 
 func (s *session) closeRemote(e error) {
 	s.closeOnce.Do(func() {
-		s.sessionRunner.removeConnectionID(s.srcConnID)
+		for _, connID := range s.localConnIDs() {
+			s.sessionRunner.removeConnectionID(connID)
+		}
 		s.closeChan <- closeError{err: e, remote: true}
 	})
 }
 
-// Close the connection. It sends a qerr.PeerGoingAway.
+// Close the connection. It sends an application error code 0.
 // It waits until the run loop has stopped before returning
 func (s *session) Close() error {
 	s.closeLocal(nil)
@@ -742,47 +1486,60 @@ func (s *session) Close() error {
 }
 
 func (s *session) CloseWithError(code protocol.ApplicationErrorCode, e error) error {
-	s.closeLocal(qerr.Error(qerr.ErrorCode(code), e.Error()))
+	s.closeLocal(&ApplicationError{ErrorCode: code, ErrorMessage: e.Error()})
 	<-s.ctx.Done()
 	return nil
 }
 
-func (s *session) handleCloseError(closeErr closeError) error {
-	if closeErr.err == nil {
-		closeErr.err = qerr.PeerGoingAway
+func (s *session) handleConnectionCloseFrame(frame *wire.ConnectionCloseFrame) {
+	if frame.IsApplicationError {
+		s.closeRemote(&ApplicationError{
+			Remote:       true,
+			ErrorCode:    protocol.ApplicationErrorCode(frame.ErrorCode),
+			ErrorMessage: frame.ReasonPhrase,
+		})
+		return
 	}
+	s.closeRemote(&TransportError{
+		Remote:       true,
+		FrameType:    frame.FrameType,
+		ErrorCode:    frame.ErrorCode,
+		ErrorMessage: frame.ReasonPhrase,
+	})
+}
 
-	var quicErr *qerr.QuicError
-	var ok bool
-	if quicErr, ok = closeErr.err.(*qerr.QuicError); !ok {
-		quicErr = qerr.ToQuicError(closeErr.err)
+// handleCloseError closes all streams and sends the CONNECTION_CLOSE, if necessary.
+// It returns the error that is reported to the application.
+func (s *session) handleCloseError(closeErr closeError) error {
+	err := closeErr.err
+	// When the session is destroyed, the caller already chose the error that is reported.
+	if closeErr.sendClose || closeErr.remote {
+		err = toPublicError(err)
 	}
 	// Don't log 'normal' reasons
-	if quicErr.ErrorCode == qerr.PeerGoingAway || quicErr.ErrorCode == qerr.NetworkIdleTimeout {
+	if isNormalClose(err) {
 		s.logger.Infof("Closing connection %s.", s.srcConnID)
 	} else {
-		s.logger.Errorf("Closing session with error: %s", closeErr.err.Error())
+		s.logger.Errorf("Closing session with error: %s", err)
 	}
 
-	s.streamsMap.CloseWithError(quicErr)
+	s.streamsMap.CloseWithError(err)
 
-	if !closeErr.sendClose {
-		return nil
-	}
-
-	// If this is a remote close we're done here
-	if closeErr.remote {
-		return nil
-	}
-
-	if quicErr.ErrorCode == qerr.DecryptionFailure {
-		// TODO(#943): send a stateless reset
-		return nil
+	if closeErr.sendClose && !closeErr.remote {
+		if err := s.sendConnectionClose(err); err != nil {
+			s.logger.Infof("Sending the CONNECTION_CLOSE failed: %s", err)
+		}
 	}
-	return s.sendConnectionClose(quicErr)
+	return err
 }
 
 func (s *session) processTransportParameters(params *handshake.TransportParameters) {
+	if s.version == protocol.Version1 {
+		if err := s.checkConnectionIDParameters(params); err != nil {
+			s.closeLocal(qerr.Error(qerr.TransportParameterError, err.Error()))
+			return
+		}
+	}
 	s.peerParams = params
 	s.streamsMap.UpdateLimits(params)
 	s.packer.HandleTransportParameters(params)
@@ -791,6 +1548,36 @@ func (s *session) processTransportParameters(params *handshake.TransportParamete
 	// so we don't need to update stream flow control windows
 }
 
+// checkConnectionIDParameters checks that the connection IDs sent in the transport parameters
+// match the connection IDs used during the handshake (see section 7.3 of RFC 9000).
+// The original_destination_connection_id is checked by the crypto setup.
+func (s *session) checkConnectionIDParameters(params *handshake.TransportParameters) error {
+	// During the handshake, the destination connection ID is the source connection ID
+	// that the peer used on its first Initial packet.
+	if params.InitialSourceConnectionID == nil {
+		return errors.New("missing initial_source_connection_id")
+	}
+	if !params.InitialSourceConnectionID.Equal(s.destConnID) {
+		return fmt.Errorf("expected initial_source_connection_id to equal %s, is %s", s.destConnID, params.InitialSourceConnectionID)
+	}
+	if s.perspective == protocol.PerspectiveServer {
+		return nil
+	}
+	if s.retrySrcConnID == nil {
+		if params.RetrySourceConnectionID != nil {
+			return errors.New("received retry_source_connection_id, although no Retry was performed")
+		}
+		return nil
+	}
+	if params.RetrySourceConnectionID == nil {
+		return errors.New("missing retry_source_connection_id")
+	}
+	if !params.RetrySourceConnectionID.Equal(s.retrySrcConnID) {
+		return fmt.Errorf("expected retry_source_connection_id to equal %s, is %s", s.retrySrcConnID, params.RetrySourceConnectionID)
+	}
+	return nil
+}
+
 func (s *session) sendPackets() error {
 	s.pacingDeadline = time.Time{}
 
@@ -893,6 +1680,11 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 		s.logger.Debugf("Dequeueing handshake retransmission for packet 0x%x", retransmitPacket.PacketNumber)
 	} else {
 		s.logger.Debugf("Dequeueing retransmission for packet 0x%x", retransmitPacket.PacketNumber)
+		retransmitPacket.Frames = s.retransmissionFilter.Filter(retransmitPacket.Frames, s.sentPacketHandler)
+		if len(retransmitPacket.Frames) == 0 {
+			s.logger.Debugf("Skipping retransmission of packet 0x%x. All streams were reset.", retransmitPacket.PacketNumber)
+			return false, nil
+		}
 	}
 
 	packets, err := s.packer.PackRetransmission(retransmitPacket)
@@ -918,6 +1710,13 @@ func (s *session) sendProbePacket() error {
 		return err
 	}
 	s.logger.Debugf("Sending a retransmission for %#x as a probe packet.", p.PacketNumber)
+	if p.EncryptionLevel == protocol.Encryption1RTT {
+		p.Frames = s.retransmissionFilter.Filter(p.Frames, s.sentPacketHandler)
+		if len(p.Frames) == 0 {
+			// a probe packet needs to be retransmittable
+			p.Frames = []wire.Frame{&wire.PingFrame{}}
+		}
+	}
 
 	packets, err := s.packer.PackRetransmission(p)
 	if err != nil {
@@ -938,7 +1737,9 @@ func (s *session) sendProbePacket() error {
 
 func (s *session) sendPacket() (bool, error) {
 	if isBlocked, offset := s.connFlowController.IsNewlyBlocked(); isBlocked {
-		s.framer.QueueControlFrame(&wire.DataBlockedFrame{DataLimit: offset})
+		frame := &wire.DataBlockedFrame{DataLimit: offset}
+		s.framer.QueueControlFrame(frame)
+		s.reportBlocked(frame, true)
 	}
 	s.windowUpdateQueue.QueueAll()
 
@@ -959,11 +1760,41 @@ func (s *session) sendPackedPacket(packet *packedPacket) error {
 	return s.conn.Write(packet.raw)
 }
 
-func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
-	packet, err := s.packer.PackConnectionClose(&wire.ConnectionCloseFrame{
-		ErrorCode:    quicErr.ErrorCode,
-		ReasonPhrase: quicErr.ErrorMessage,
-	})
+func (s *session) sendConnectionClose(e error) error {
+	var frame *wire.ConnectionCloseFrame
+	switch err := e.(type) {
+	case *ApplicationError:
+		if s.handshakeComplete {
+			frame = &wire.ConnectionCloseFrame{
+				IsApplicationError: true,
+				ErrorCode:          qerr.ErrorCode(err.ErrorCode),
+				ReasonPhrase:       err.ErrorMessage,
+			}
+		} else {
+			// Before the handshake completes, packets might not be 1-RTT protected.
+			// Application errors must not be revealed in those packets, see section 10.2.3 of RFC 9000.
+			frame = &wire.ConnectionCloseFrame{ErrorCode: qerr.ApplicationError}
+		}
+	case *TransportError:
+		frame = &wire.ConnectionCloseFrame{
+			ErrorCode:    err.ErrorCode,
+			FrameType:    err.FrameType,
+			ReasonPhrase: err.ErrorMessage,
+		}
+	case *HandshakeTimeoutError:
+		// There's no error code for a handshake timeout.
+		// Don't use NO_ERROR, the peer must not mistake this for a graceful close.
+		frame = &wire.ConnectionCloseFrame{
+			ErrorCode:    qerr.ConnectionRefused,
+			ReasonPhrase: err.Error(),
+		}
+	default:
+		frame = &wire.ConnectionCloseFrame{
+			ErrorCode:    qerr.InternalError,
+			ReasonPhrase: err.Error(),
+		}
+	}
+	packet, err := s.packer.PackConnectionClose(frame)
 	if err != nil {
 		return err
 	}
@@ -1000,12 +1831,12 @@ func (s *session) GetOrOpenStream(id protocol.StreamID) (Stream, error) {
 }
 
 // AcceptStream returns the next stream openend by the peer
-func (s *session) AcceptStream() (Stream, error) {
-	return s.streamsMap.AcceptStream()
+func (s *session) AcceptStream(ctx context.Context) (Stream, error) {
+	return s.streamsMap.AcceptStream(ctx)
 }
 
-func (s *session) AcceptUniStream() (ReceiveStream, error) {
-	return s.streamsMap.AcceptUniStream()
+func (s *session) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
+	return s.streamsMap.AcceptUniStream(ctx)
 }
 
 // OpenStream opens a stream
@@ -1013,21 +1844,43 @@ func (s *session) OpenStream() (Stream, error) {
 	return s.streamsMap.OpenStream()
 }
 
-func (s *session) OpenStreamSync() (Stream, error) {
-	return s.streamsMap.OpenStreamSync()
+func (s *session) OpenStreamSync(ctx context.Context) (Stream, error) {
+	return s.streamsMap.OpenStreamSync(ctx)
 }
 
 func (s *session) OpenUniStream() (SendStream, error) {
 	return s.streamsMap.OpenUniStream()
 }
 
-func (s *session) OpenUniStreamSync() (SendStream, error) {
-	return s.streamsMap.OpenUniStreamSync()
+func (s *session) OpenUniStreamSync(ctx context.Context) (SendStream, error) {
+	return s.streamsMap.OpenUniStreamSync(ctx)
+}
+
+func (s *session) SetMaxIncomingStreams(num int) {
+	if num < 0 {
+		num = 0
+	}
+	s.streamsMap.SetMaxIncomingStreams(uint64(num))
+}
+
+func (s *session) SetMaxIncomingUniStreams(num int) {
+	if num < 0 {
+		num = 0
+	}
+	s.streamsMap.SetMaxIncomingUniStreams(uint64(num))
+}
+
+func (s *session) IncomingStreamCredit() StreamCredit {
+	return s.streamsMap.IncomingStreamCredit()
+}
+
+func (s *session) IncomingUniStreamCredit() StreamCredit {
+	return s.streamsMap.IncomingUniStreamCredit()
 }
 
 func (s *session) newStream(id protocol.StreamID) streamI {
 	flowController := s.newFlowController(id)
-	return newStream(id, s, flowController, s.version)
+	return newStream(id, s, flowController, protocol.ByteCount(s.config.StreamSendBufferSize), s.version)
 }
 
 func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlowController {
@@ -1046,7 +1899,7 @@ func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlow
 	return flowcontrol.NewStreamFlowController(
 		id,
 		s.connFlowController,
-		protocol.InitialMaxStreamData,
+		s.initialStreamWindow,
 		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
 		initialSendWindow,
 		s.onHasStreamWindowUpdate,
@@ -1085,6 +1938,7 @@ func (s *session) tryDecryptingQueuedPackets() {
 
 func (s *session) queueControlFrame(f wire.Frame) {
 	s.framer.QueueControlFrame(f)
+	s.reportBlocked(f, true)
 	s.scheduleSending()
 }
 
@@ -1103,6 +1957,10 @@ func (s *session) onHasStreamData(id protocol.StreamID) {
 	s.scheduleSending()
 }
 
+func (s *session) onStreamReset(id protocol.StreamID, reliableSize protocol.ByteCount) {
+	s.retransmissionFilter.AddStream(id, reliableSize)
+}
+
 func (s *session) onStreamCompleted(id protocol.StreamID) {
 	if err := s.streamsMap.DeleteStream(id); err != nil {
 		s.closeLocal(err)
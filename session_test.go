@@ -3,7 +3,9 @@ package quic
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
+	"io"
 	"net"
 	"runtime/pprof"
 	"strings"
@@ -14,6 +16,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	"github.com/lucas-clemente/quic-go/internal/mocks/ackhandler"
@@ -26,13 +29,21 @@ import (
 type mockConnection struct {
 	remoteAddr net.Addr
 	localAddr  net.Addr
+	pconn      net.PacketConn
 	written    chan []byte
+	writtenTo  chan writtenPacket
+}
+
+type writtenPacket struct {
+	data []byte
+	addr net.Addr
 }
 
 func newMockConnection() *mockConnection {
 	return &mockConnection{
 		remoteAddr: &net.UDPAddr{},
 		written:    make(chan []byte, 100),
+		writtenTo:  make(chan writtenPacket, 100),
 	}
 }
 
@@ -46,11 +57,26 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
+func (m *mockConnection) WriteTo(p []byte, addr net.Addr) error {
+	b := make([]byte, len(p))
+	copy(b, p)
+	select {
+	case m.writtenTo <- writtenPacket{data: b, addr: addr}:
+	default:
+		panic("mockConnection channel full")
+	}
+	return nil
+}
 func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
 	m.remoteAddr = addr
 }
+func (m *mockConnection) SetPacketConn(pconn net.PacketConn) net.PacketConn {
+	old := m.pconn
+	m.pconn = pconn
+	return old
+}
 func (m *mockConnection) LocalAddr() net.Addr  { return m.localAddr }
 func (m *mockConnection) RemoteAddr() net.Addr { return m.remoteAddr }
 func (*mockConnection) Close() error           { panic("not implemented") }
@@ -145,7 +171,7 @@ var _ = Describe("Session", func() {
 					StreamID: 3,
 					Data:     []byte("foobar"),
 				}, protocol.EncryptionHandshake)
-				Expect(err).To(MatchError(qerr.Error(qerr.UnencryptedStreamData, "received unencrypted stream data on stream 3")))
+				Expect(err).To(MatchError(qerr.Error(qerr.ProtocolViolation, "received unencrypted stream data on stream 3")))
 			})
 		})
 
@@ -211,6 +237,33 @@ var _ = Describe("Session", func() {
 			})
 		})
 
+		Context("handling RESET_STREAM_AT frames", func() {
+			It("passes the frame to the stream", func() {
+				sess.config.EnableReliableStreamReset = true
+				f := &wire.ResetStreamAtFrame{
+					StreamID:     555,
+					ErrorCode:    42,
+					ByteOffset:   0x1337,
+					ReliableSize: 0x42,
+				}
+				str := NewMockReceiveStreamI(mockCtrl)
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(555)).Return(str, nil)
+				str.EXPECT().handleResetStreamAtFrame(f)
+				Expect(sess.handleFrames([]wire.Frame{f}, protocol.Encryption1RTT)).To(Succeed())
+			})
+
+			It("ignores RESET_STREAM_AT frames for closed streams", func() {
+				sess.config.EnableReliableStreamReset = true
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(3)).Return(nil, nil)
+				Expect(sess.handleFrames([]wire.Frame{&wire.ResetStreamAtFrame{StreamID: 3}}, protocol.Encryption1RTT)).To(Succeed())
+			})
+
+			It("errors if the extension wasn't negotiated", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.ResetStreamAtFrame{StreamID: 3}}, protocol.Encryption1RTT)
+				Expect(err).To(MatchError("FRAME_ENCODING_ERROR: received a RESET_STREAM_AT frame, but the reliable stream reset extension was not negotiated"))
+			})
+		})
+
 		Context("handling MAX_DATA and MAX_STREAM_DATA frames", func() {
 			var connFC *mocks.MockConnectionFlowController
 
@@ -295,9 +348,83 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("rejects PATH_RESPONSE frames", func() {
+		It("rejects HANDSHAKE_DONE frames sent by the client", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.HandshakeDoneFrame{}}, protocol.Encryption1RTT)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: received a HANDSHAKE_DONE frame"))
+		})
+
+		It("queues a HANDSHAKE_DONE frame when the handshake completes, in QUIC version 1", func() {
+			sess.version = protocol.Version1
+			sessionRunner.EXPECT().onHandshakeComplete(sess)
+			sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess)
+			sess.handleHandshakeComplete()
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(HaveLen(2))
+			Expect(frames).To(ContainElement(&wire.HandshakeDoneFrame{}))
+		})
+
+		Context("issuing connection IDs", func() {
+			It("issues a new connection ID when the handshake completes", func() {
+				var connID protocol.ConnectionID
+				sessionRunner.EXPECT().onHandshakeComplete(sess)
+				sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess).Do(func(c protocol.ConnectionID, _ quicSession) { connID = c })
+				sess.handleHandshakeComplete()
+				Expect(connID.Len()).To(Equal(protocol.DefaultConnectionIDLength))
+				Expect(connID).ToNot(Equal(sess.srcConnID))
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(HaveLen(2))
+				Expect(frames).To(ContainElement(&wire.PingFrame{}))
+				var f *wire.NewConnectionIDFrame
+				for _, frame := range frames {
+					if ncid, ok := frame.(*wire.NewConnectionIDFrame); ok {
+						f = ncid
+					}
+				}
+				Expect(f).ToNot(BeNil())
+				Expect(f.SequenceNumber).To(Equal(uint64(1)))
+				Expect(f.ConnectionID).To(Equal(connID))
+				Expect(sess.localConnIDs()).To(ConsistOf(sess.srcConnID, connID))
+			})
+
+			It("doesn't issue connection IDs if the preferred_address already provides one", func() {
+				sess.activeConnIDs[1] = protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+				sess.nextConnIDSeq = 2
+				sessionRunner.EXPECT().onHandshakeComplete(sess)
+				sess.handleHandshakeComplete()
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				for _, f := range frames {
+					Expect(f).ToNot(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+				}
+			})
+
+			It("issues a new connection ID when the client retires one", func() {
+				sess.activeConnIDs[1] = protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+				sess.nextConnIDSeq = 2
+				var connID protocol.ConnectionID
+				gomock.InOrder(
+					sessionRunner.EXPECT().retireConnectionID(sess.srcConnID),
+					sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess).Do(func(c protocol.ConnectionID, _ quicSession) { connID = c }),
+				)
+				Expect(sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}, protocol.Encryption1RTT)).To(Succeed())
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(HaveLen(1))
+				Expect(frames[0]).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+				Expect(frames[0].(*wire.NewConnectionIDFrame).SequenceNumber).To(Equal(uint64(2)))
+				Expect(frames[0].(*wire.NewConnectionIDFrame).ConnectionID).To(Equal(connID))
+				Expect(sess.localConnIDs()).To(ConsistOf(protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}, connID))
+				// retiring the same connection ID again has no effect
+				Expect(sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}, protocol.Encryption1RTT)).To(Succeed())
+			})
+
+			It("errors when the client retires a connection ID that wasn't issued", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}, protocol.Encryption1RTT)
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: retired connection ID 1, which was not issued yet"))
+			})
+		})
+
+		It("ignores PATH_RESPONSE frames when not migrating", func() {
 			err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}}, protocol.EncryptionUnspecified)
-			Expect(err).To(MatchError("unexpected PATH_RESPONSE frame"))
+			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("handles PATH_CHALLENGE frames", func() {
@@ -308,23 +435,124 @@ var _ = Describe("Session", func() {
 			Expect(frames).To(Equal([]wire.Frame{&wire.PathResponseFrame{Data: data}}))
 		})
 
-		It("handles BLOCKED frames", func() {
-			err := sess.handleFrames([]wire.Frame{&wire.DataBlockedFrame{}}, protocol.EncryptionUnspecified)
-			Expect(err).NotTo(HaveOccurred())
-		})
+		Context("handling blocked frames", func() {
+			var events []BlockedEvent
 
-		It("handles STREAM_BLOCKED frames", func() {
-			err := sess.handleFrames([]wire.Frame{&wire.StreamDataBlockedFrame{}}, protocol.EncryptionUnspecified)
-			Expect(err).NotTo(HaveOccurred())
-		})
+			BeforeEach(func() {
+				events = nil
+				sess.config.OnBlocked = func(s Session, e BlockedEvent) {
+					defer GinkgoRecover()
+					Expect(s).To(Equal(sess))
+					events = append(events, e)
+				}
+			})
 
-		It("handles STREAM_ID_BLOCKED frames", func() {
-			err := sess.handleFrames([]wire.Frame{&wire.StreamsBlockedFrame{}}, protocol.EncryptionUnspecified)
-			Expect(err).NotTo(HaveOccurred())
+			It("handles DATA_BLOCKED frames", func() {
+				connFC := mocks.NewMockConnectionFlowController(mockCtrl)
+				sess.connFlowController = connFC
+				connFC.EXPECT().HandlePeerBlocked(protocol.ByteCount(1337))
+				err := sess.handleFrames([]wire.Frame{&wire.DataBlockedFrame{DataLimit: 1337}}, protocol.EncryptionUnspecified)
+				Expect(err).NotTo(HaveOccurred())
+				sess.deliverBlockedEvents()
+				Expect(events).To(Equal([]BlockedEvent{{Type: BlockedData, Limit: 1337}}))
+			})
+
+			It("handles STREAM_DATA_BLOCKED frames", func() {
+				f := &wire.StreamDataBlockedFrame{StreamID: 5, DataLimit: 1337}
+				str := NewMockReceiveStreamI(mockCtrl)
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(str, nil)
+				str.EXPECT().handleStreamDataBlockedFrame(f)
+				err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionUnspecified)
+				Expect(err).NotTo(HaveOccurred())
+				sess.deliverBlockedEvents()
+				Expect(events).To(Equal([]BlockedEvent{{Type: BlockedStreamData, StreamID: 5, Limit: 1337}}))
+			})
+
+			It("ignores STREAM_DATA_BLOCKED frames for closed streams", func() {
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(nil, nil)
+				err := sess.handleFrames([]wire.Frame{&wire.StreamDataBlockedFrame{StreamID: 5}}, protocol.EncryptionUnspecified)
+				Expect(err).NotTo(HaveOccurred())
+				sess.deliverBlockedEvents()
+				Expect(events).To(BeEmpty())
+			})
+
+			It("returns errors when handling STREAM_DATA_BLOCKED frames", func() {
+				testErr := errors.New("test err")
+				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(nil, testErr)
+				err := sess.handleFrames([]wire.Frame{&wire.StreamDataBlockedFrame{StreamID: 5}}, protocol.EncryptionUnspecified)
+				Expect(err).To(MatchError(testErr))
+			})
+
+			It("handles STREAMS_BLOCKED frames", func() {
+				err := sess.handleFrames([]wire.Frame{
+					&wire.StreamsBlockedFrame{Type: protocol.StreamTypeBidi, StreamLimit: 10},
+					&wire.StreamsBlockedFrame{Type: protocol.StreamTypeUni, StreamLimit: 20},
+				}, protocol.EncryptionUnspecified)
+				Expect(err).NotTo(HaveOccurred())
+				sess.deliverBlockedEvents()
+				Expect(events).To(Equal([]BlockedEvent{
+					{Type: BlockedBidiStreams, Limit: 10},
+					{Type: BlockedUniStreams, Limit: 20},
+				}))
+			})
+
+			It("reports blocked frames that it sends", func() {
+				sess.queueControlFrame(&wire.StreamsBlockedFrame{Type: protocol.StreamTypeUni, StreamLimit: 3})
+				sess.queueControlFrame(&wire.StreamDataBlockedFrame{StreamID: 7, DataLimit: 100})
+				sess.queueControlFrame(&wire.MaxDataFrame{ByteOffset: 1000})
+				Expect(events).To(BeEmpty())
+				sess.deliverBlockedEvents()
+				Expect(events).To(Equal([]BlockedEvent{
+					{Type: BlockedUniStreams, Local: true, Limit: 3},
+					{Type: BlockedStreamData, Local: true, StreamID: 7, Limit: 100},
+				}))
+			})
+
+			It("doesn't report anything if no callback is set", func() {
+				sess.config.OnBlocked = nil
+				err := sess.handleFrames([]wire.Frame{&wire.StreamsBlockedFrame{}}, protocol.EncryptionUnspecified)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sess.blockedEvents).To(BeEmpty())
+			})
+
+			It("allows the callback to call into the session", func() {
+				sess.streamsMap = newStreamsMap(
+					sess,
+					sess.newFlowController,
+					100,
+					100,
+					protocol.ByteCount(sess.config.StreamSendBufferSize),
+					sess.perspective,
+					sess.version,
+				)
+				var openErr error
+				sess.config.OnBlocked = func(s Session, e BlockedEvent) {
+					events = append(events, e)
+					// opening the stream fails again, since the peer didn't allow us to open any streams yet
+					_, openErr = s.OpenStream()
+				}
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					// The STREAMS_BLOCKED frame is queued while holding the streams map mutex.
+					_, err := sess.OpenStream()
+					Expect(err).To(HaveOccurred())
+					sess.deliverBlockedEvents()
+				}()
+				Eventually(done).Should(BeClosed())
+				Expect(events).To(Equal([]BlockedEvent{{Type: BlockedBidiStreams, Local: true}}))
+				Expect(openErr).To(HaveOccurred())
+			})
 		})
 
 		It("handles CONNECTION_CLOSE frames", func() {
-			testErr := qerr.Error(qerr.ProofInvalid, "foobar")
+			testErr := &TransportError{
+				Remote:       true,
+				FrameType:    0x1e,
+				ErrorCode:    qerr.CryptoErrorCode(42),
+				ErrorMessage: "foobar",
+			}
 			streamManager.EXPECT().CloseWithError(testErr)
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 			cryptoSetup.EXPECT().Close()
@@ -335,10 +563,32 @@ var _ = Describe("Session", func() {
 				err := sess.run()
 				Expect(err).To(MatchError(testErr))
 			}()
-			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{ErrorCode: qerr.ProofInvalid, ReasonPhrase: "foobar"}}, protocol.EncryptionUnspecified)
+			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{ErrorCode: qerr.CryptoErrorCode(42), FrameType: 0x1e, ReasonPhrase: "foobar"}}, protocol.EncryptionUnspecified)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
+
+		It("handles application CONNECTION_CLOSE frames", func() {
+			testErr := &ApplicationError{
+				Remote:       true,
+				ErrorCode:    0x1337,
+				ErrorMessage: "foobar",
+			}
+			streamManager.EXPECT().CloseWithError(testErr)
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				err := sess.run()
+				Expect(err).To(Equal(testErr))
+			}()
+			err := sess.handleFrames([]wire.Frame{&wire.ConnectionCloseFrame{IsApplicationError: true, ErrorCode: 0x1337, ReasonPhrase: "foobar"}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+			Expect(sess.Context().Err()).To(Equal(testErr))
+		})
 	})
 
 	It("tells its versions", func() {
@@ -348,8 +598,8 @@ var _ = Describe("Session", func() {
 
 	It("accepts new streams", func() {
 		mstr := NewMockStreamI(mockCtrl)
-		streamManager.EXPECT().AcceptStream().Return(mstr, nil)
-		str, err := sess.AcceptStream()
+		streamManager.EXPECT().AcceptStream(gomock.Any()).Return(mstr, nil)
+		str, err := sess.AcceptStream(context.Background())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str).To(Equal(mstr))
 	})
@@ -366,7 +616,7 @@ var _ = Describe("Session", func() {
 		})
 
 		It("shuts down without error", func() {
-			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.PeerGoingAway, ""))
+			streamManager.EXPECT().CloseWithError(&ApplicationError{})
 			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
 			cryptoSetup.EXPECT().Close()
 			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{raw: []byte("connection close")}, nil)
@@ -377,8 +627,19 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("retires the connection ID advertised in the preferred_address", func() {
+			sess.activeConnIDs[1] = protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().retireConnectionID(sess.srcConnID)
+			sessionRunner.EXPECT().retireConnectionID(protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad})
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			Expect(sess.Close()).To(Succeed())
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
 		It("only closes once", func() {
-			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.PeerGoingAway, ""))
+			streamManager.EXPECT().CloseWithError(&ApplicationError{})
 			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
 			cryptoSetup.EXPECT().Close()
 			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
@@ -391,7 +652,7 @@ var _ = Describe("Session", func() {
 
 		It("closes streams with proper error", func() {
 			testErr := errors.New("test error")
-			streamManager.EXPECT().CloseWithError(qerr.Error(0x1337, testErr.Error()))
+			streamManager.EXPECT().CloseWithError(&ApplicationError{ErrorCode: 0x1337, ErrorMessage: testErr.Error()})
 			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
 			cryptoSetup.EXPECT().Close()
 			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
@@ -400,6 +661,35 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("sends an application CONNECTION_CLOSE after the handshake completed", func() {
+			sess.handshakeComplete = true
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+				Expect(f.IsApplicationError).To(BeTrue())
+				Expect(f.ErrorCode).To(BeEquivalentTo(0x1337))
+				Expect(f.ReasonPhrase).To(Equal("test error"))
+				return &packedPacket{}, nil
+			})
+			sess.CloseWithError(0x1337, errors.New("test error"))
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
+		It("doesn't reveal the application error before the handshake completed", func() {
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+				Expect(f.IsApplicationError).To(BeFalse())
+				Expect(f.ErrorCode).To(Equal(qerr.ApplicationError))
+				Expect(f.ReasonPhrase).To(BeEmpty())
+				return &packedPacket{}, nil
+			})
+			sess.CloseWithError(0x1337, errors.New("test error"))
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
 		It("closes the session in order to replace it with another QUIC version", func() {
 			streamManager.EXPECT().CloseWithError(gomock.Any())
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
@@ -419,7 +709,7 @@ var _ = Describe("Session", func() {
 				defer GinkgoRecover()
 				ctx := sess.Context()
 				<-ctx.Done()
-				Expect(ctx.Err()).To(MatchError(context.Canceled))
+				Expect(ctx.Err()).To(Equal(&ApplicationError{}))
 				close(returned)
 			}()
 			Consistently(returned).ShouldNot(BeClosed())
@@ -446,6 +736,29 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	It("releases the flow control memory when it is closed", func() {
+		budget := NewMemoryBudget(1 << 20)
+		Expect(flowcontrol.ReserveInitialWindow(budget, protocol.InitialMaxData, protocol.MinInitialMaxData)).To(Equal(protocol.ByteCount(protocol.InitialMaxData)))
+		sess.connFlowController = flowcontrol.NewConnectionFlowController(protocol.InitialMaxData, protocol.MaxByteCount, budget, func() {}, sess.rttStats, utils.DefaultLogger)
+		Expect(budget.Stats().Connections).To(Equal(1))
+		Eventually(areSessionsRunning).Should(BeFalse())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+			sess.run()
+			close(done)
+		}()
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+		cryptoSetup.EXPECT().Close()
+		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+		Expect(sess.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+		Expect(budget.Stats().Connections).To(BeZero())
+		Expect(budget.Stats().Reserved).To(BeZero())
+	})
+
 	Context("receiving packets", func() {
 		var hdr *wire.Header
 		var unpacker *MockUnpacker
@@ -501,7 +814,7 @@ var _ = Describe("Session", func() {
 				defer GinkgoRecover()
 				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
 				err := sess.run()
-				Expect(err).To(MatchError(testErr))
+				Expect(err).To(MatchError(&TransportError{ErrorCode: qerr.InternalError, ErrorMessage: testErr.Error()}))
 				close(done)
 			}()
 			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
@@ -556,7 +869,7 @@ var _ = Describe("Session", func() {
 		})
 
 		Context("updating the remote address", func() {
-			It("doesn't support connection migration", func() {
+			It("doesn't update the remote address before the handshake completed", func() {
 				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
 				origAddr := sess.conn.(*mockConnection).remoteAddr
 				remoteIP := &net.IPAddr{IP: net.IPv4(192, 168, 0, 100)}
@@ -569,6 +882,161 @@ var _ = Describe("Session", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(origAddr))
 			})
+
+			Context("when the client migrates", func() {
+				var newAddr *net.UDPAddr
+
+				pingPacket := &unpackedPacket{frames: []wire.Frame{&wire.PingFrame{}}}
+
+				expectPathChallenge := func() *[8]byte {
+					var challenge [8]byte
+					packer.EXPECT().PackPathChallenge(gomock.Any(), sess.destConnID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+						challenge = f.Data
+						return &packedPacket{
+							header:          &wire.Header{PacketNumber: 10},
+							raw:             append((*getPacketBuffer())[:0], []byte("probe")...),
+							frames:          []wire.Frame{f},
+							encryptionLevel: protocol.Encryption1RTT,
+						}, nil
+					})
+					return &challenge
+				}
+
+				BeforeEach(func() {
+					sess.handshakeComplete = true
+					newAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 100), Port: 1234}
+				})
+
+				It("validates the new address before switching to it", func() {
+					origAddr := mconn.remoteAddr
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(pingPacket, nil)
+					challenge := expectPathChallenge()
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1337},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					var p writtenPacket
+					Expect(mconn.writtenTo).To(Receive(&p))
+					Expect(p.data).To(Equal([]byte("probe")))
+					Expect(p.addr).To(Equal(newAddr))
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+						frames: []wire.Frame{&wire.PathResponseFrame{Data: *challenge}},
+					}, nil)
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1338},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(mconn.remoteAddr).To(Equal(newAddr))
+					Expect(sess.migration).To(BeNil())
+				})
+
+				It("only accepts a PATH_RESPONSE received from the new address", func() {
+					origAddr := mconn.remoteAddr
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(pingPacket, nil)
+					challenge := expectPathChallenge()
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1337},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(mconn.writtenTo).To(HaveLen(1))
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+						frames: []wire.Frame{&wire.PathResponseFrame{Data: *challenge}},
+					}, nil)
+					// a probing packet from the old address
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: origAddr,
+						header:     &wire.Header{PacketNumber: 1338},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(sess.migration).ToNot(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+				})
+
+				It("doesn't switch to a new address for probing packets, but answers PATH_CHALLENGEs on that path", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+						frames: []wire.Frame{&wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+					}, nil)
+					packer.EXPECT().PackPathResponse(&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}, sess.destConnID).Return(&packedPacket{
+						header:          &wire.Header{PacketNumber: 10},
+						raw:             append((*getPacketBuffer())[:0], []byte("response")...),
+						encryptionLevel: protocol.Encryption1RTT,
+					}, nil)
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1337},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(sess.migration).To(BeNil())
+					var p writtenPacket
+					Expect(mconn.writtenTo).To(Receive(&p))
+					Expect(p.data).To(Equal([]byte("response")))
+					Expect(p.addr).To(Equal(newAddr))
+					frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+					Expect(frames).To(BeEmpty())
+				})
+
+				It("doesn't switch to a different address for reordered packets", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(pingPacket, nil).Times(2)
+					expectPathChallenge()
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1337},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4321},
+						header:     &wire.Header{PacketNumber: 1336},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(sess.migration).ToNot(BeNil())
+					Expect(sess.migration.remoteAddr).To(Equal(newAddr))
+				})
+
+				It("stops validating when the client returns to the current address", func() {
+					origAddr := mconn.remoteAddr
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(pingPacket, nil).Times(2)
+					expectPathChallenge()
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1337},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(sess.migration).ToNot(BeNil())
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: origAddr,
+						header:     &wire.Header{PacketNumber: 1338},
+						data:       []byte("foobar"),
+					})).To(Succeed())
+					Expect(sess.migration).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+				})
+
+				It("respects the anti-amplification limit", func() {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(pingPacket, nil).Times(2)
+					expectPathChallenge()
+					// The PATH_CHALLENGE packet is 5 bytes, which is more than 3 times the 1 byte received.
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1337},
+						data:       []byte("f"),
+					})).To(Succeed())
+					Expect(mconn.writtenTo).To(BeEmpty())
+					Expect(sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: newAddr,
+						header:     &wire.Header{PacketNumber: 1338},
+						data:       []byte("f"),
+					})).To(Succeed())
+					expectPathChallenge()
+					sess.onPathProbeTimeout(sess.migration.nextProbe)
+					var p writtenPacket
+					Expect(mconn.writtenTo).To(Receive(&p))
+					Expect(p.addr).To(Equal(newAddr))
+				})
+			})
 		})
 	})
 
@@ -622,6 +1090,19 @@ var _ = Describe("Session", func() {
 			Expect(frames).To(Equal([]wire.Frame{&wire.DataBlockedFrame{DataLimit: 1337}}))
 		})
 
+		It("reports when it is connection-level flow control blocked", func() {
+			var events []BlockedEvent
+			sess.config.OnBlocked = func(_ Session, e BlockedEvent) { events = append(events, e) }
+			fc := mocks.NewMockConnectionFlowController(mockCtrl)
+			fc.EXPECT().IsNewlyBlocked().Return(true, protocol.ByteCount(1337))
+			packer.EXPECT().PackPacket().Return(getPacket(1), nil)
+			sess.connFlowController = fc
+			_, err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			sess.deliverBlockedEvents()
+			Expect(events).To(Equal([]BlockedEvent{{Type: BlockedData, Local: true, Limit: 1337}}))
+		})
+
 		It("sends a retransmission and a regular packet in the same run", func() {
 			packetToRetransmit := &ackhandler.Packet{
 				PacketNumber: 10,
@@ -676,6 +1157,116 @@ var _ = Describe("Session", func() {
 			Expect(mconn.written).To(HaveLen(2))
 		})
 
+		It("doesn't retransmit STREAM frames of streams that were reset", func() {
+			pingFrame := &wire.PingFrame{}
+			packet := &ackhandler.Packet{
+				PacketNumber: 42,
+				Frames: []wire.Frame{
+					&wire.StreamFrame{StreamID: 0x5, Data: []byte("foobar")},
+					pingFrame,
+				},
+				EncryptionLevel: protocol.Encryption1RTT,
+			}
+			sess.onStreamReset(5, 0)
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(100), protocol.PacketNumberLen2)
+			sph.EXPECT().DequeuePacketForRetransmission().Return(packet)
+			packer.EXPECT().PackRetransmission(packet).DoAndReturn(func(p *ackhandler.Packet) ([]*packedPacket, error) {
+				Expect(p.Frames).To(Equal([]wire.Frame{pingFrame}))
+				return []*packedPacket{getPacket(1337)}, nil
+			})
+			sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42))
+			sess.sentPacketHandler = sph
+			sent, err := sess.maybeSendRetransmission()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+		})
+
+		It("skips the retransmission if all STREAM frames were dropped", func() {
+			packet := &ackhandler.Packet{
+				PacketNumber:    42,
+				Frames:          []wire.Frame{&wire.StreamFrame{StreamID: 0x5, Data: []byte("foobar")}},
+				EncryptionLevel: protocol.Encryption1RTT,
+			}
+			sess.onStreamReset(5, 0)
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(100), protocol.PacketNumberLen2)
+			sph.EXPECT().DequeuePacketForRetransmission().Return(packet)
+			sess.sentPacketHandler = sph
+			sent, err := sess.maybeSendRetransmission()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeFalse())
+		})
+
+		It("doesn't retransmit data beyond the reliable size after the stream was deleted", func() {
+			const streamID protocol.StreamID = 5
+			fc := mocks.NewMockStreamFlowController(mockCtrl)
+			fc.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).AnyTimes()
+			fc.EXPECT().AddBytesSent(gomock.Any()).AnyTimes()
+			fc.EXPECT().IsNewlyBlocked().AnyTimes()
+			str := newSendStream(streamID, sess, fc, protocol.MaxByteCount, sess.version)
+			str.peerSupportsResetStreamAt = true
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+			var frame *wire.StreamFrame
+			Eventually(func() *wire.StreamFrame {
+				frame, _ = str.popStreamFrame(1000)
+				return frame
+			}).ShouldNot(BeNil())
+			Eventually(done).Should(BeClosed())
+			Expect(frame.Data).To(Equal([]byte("foobar")))
+			// The stream is deleted from the streams map as soon as it is canceled,
+			// since all data up to the reliable size was already sent.
+			streamManager.EXPECT().DeleteStream(streamID)
+			Expect(str.CancelWriteAt(1234, 3)).To(Succeed())
+
+			packet := &ackhandler.Packet{
+				PacketNumber:    10,
+				Frames:          []wire.Frame{frame},
+				EncryptionLevel: protocol.Encryption1RTT,
+			}
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(11), protocol.PacketNumberLen2)
+			sph.EXPECT().DequeuePacketForRetransmission().Return(packet)
+			packer.EXPECT().PackRetransmission(packet).DoAndReturn(func(p *ackhandler.Packet) ([]*packedPacket, error) {
+				Expect(p.Frames).To(HaveLen(1))
+				f := p.Frames[0].(*wire.StreamFrame)
+				Expect(f.StreamID).To(Equal(streamID))
+				Expect(f.Data).To(Equal([]byte("foo")))
+				Expect(f.FinBit).To(BeFalse())
+				return []*packedPacket{getPacket(11)}, nil
+			})
+			sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(10))
+			sess.sentPacketHandler = sph
+			sent, err := sess.maybeSendRetransmission()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+		})
+
+		It("doesn't retransmit STREAM frames of reset streams in probe packets", func() {
+			packet := &ackhandler.Packet{
+				PacketNumber:    0x42,
+				Frames:          []wire.Frame{&wire.StreamFrame{StreamID: 0x5, Data: []byte("foobar")}},
+				EncryptionLevel: protocol.Encryption1RTT,
+			}
+			sess.onStreamReset(5, 0)
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().PeekPacketNumber().Return(protocol.PacketNumber(100), protocol.PacketNumberLen2)
+			sph.EXPECT().DequeueProbePacket().Return(packet, nil)
+			packer.EXPECT().PackRetransmission(packet).DoAndReturn(func(p *ackhandler.Packet) ([]*packedPacket, error) {
+				Expect(p.Frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+				return []*packedPacket{getPacket(123)}, nil
+			})
+			sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(0x42))
+			sess.sentPacketHandler = sph
+			Expect(sess.sendProbePacket()).To(Succeed())
+		})
+
 		It("sends a probe packet", func() {
 			packetToRetransmit := &ackhandler.Packet{
 				PacketNumber: 0x42,
@@ -911,7 +1502,8 @@ var _ = Describe("Session", func() {
 
 	It("closes when RunHandshake() errors", func() {
 		testErr := errors.New("crypto setup error")
-		streamManager.EXPECT().CloseWithError(qerr.Error(qerr.InternalError, testErr.Error()))
+		expectedErr := &TransportError{ErrorCode: qerr.InternalError, ErrorMessage: testErr.Error()}
+		streamManager.EXPECT().CloseWithError(expectedErr)
 		sessionRunner.EXPECT().retireConnectionID(gomock.Any())
 		cryptoSetup.EXPECT().Close()
 		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
@@ -919,7 +1511,7 @@ var _ = Describe("Session", func() {
 			defer GinkgoRecover()
 			cryptoSetup.EXPECT().RunHandshake().Return(testErr)
 			err := sess.run()
-			Expect(err).To(MatchError(testErr))
+			Expect(err).To(Equal(expectedErr))
 		}()
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
@@ -929,12 +1521,14 @@ var _ = Describe("Session", func() {
 		go func() {
 			defer GinkgoRecover()
 			sessionRunner.EXPECT().onHandshakeComplete(gomock.Any())
+			sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess)
 			cryptoSetup.EXPECT().RunHandshake()
 			sess.run()
 		}()
+		Eventually(sess.HandshakeComplete().Done()).Should(BeClosed())
 		Consistently(sess.Context().Done()).ShouldNot(BeClosed())
 		// make sure the go routine returns
-		sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+		sessionRunner.EXPECT().retireConnectionID(gomock.Any()).Times(2)
 		streamManager.EXPECT().CloseWithError(gomock.Any())
 		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
 		cryptoSetup.EXPECT().Close()
@@ -942,8 +1536,25 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("cancels the handshake context when it is closed before the handshake completes", func() {
+		go func() {
+			defer GinkgoRecover()
+			cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+			sess.run()
+		}()
+		Consistently(sess.HandshakeComplete().Done()).ShouldNot(BeClosed())
+		sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+		cryptoSetup.EXPECT().Close()
+		Expect(sess.Close()).To(Succeed())
+		Eventually(sess.HandshakeComplete().Done()).Should(BeClosed())
+		Expect(sess.Context().Err()).To(HaveOccurred())
+	})
+
 	It("sends a forward-secure packet when the handshake completes", func() {
 		done := make(chan struct{})
+		sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess)
 		gomock.InOrder(
 			sessionRunner.EXPECT().onHandshakeComplete(gomock.Any()),
 			packer.EXPECT().PackPacket().DoAndReturn(func() (*packedPacket, error) {
@@ -963,7 +1574,7 @@ var _ = Describe("Session", func() {
 		Eventually(done).Should(BeClosed())
 		//make sure the go routine returns
 		streamManager.EXPECT().CloseWithError(gomock.Any())
-		sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+		sessionRunner.EXPECT().retireConnectionID(gomock.Any()).Times(2)
 		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
 		cryptoSetup.EXPECT().Close()
 		Expect(sess.Close()).To(Succeed())
@@ -993,7 +1604,7 @@ var _ = Describe("Session", func() {
 			defer GinkgoRecover()
 			cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
 			err := sess.run()
-			Expect(err).To(MatchError(qerr.Error(0x1337, testErr.Error())))
+			Expect(err).To(Equal(&ApplicationError{ErrorCode: 0x1337, ErrorMessage: testErr.Error()}))
 			close(done)
 		}()
 		streamManager.EXPECT().CloseWithError(gomock.Any())
@@ -1028,6 +1639,62 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	Context("checking connection IDs in the transport parameters, for QUIC version 1", func() {
+		BeforeEach(func() {
+			sess.version = protocol.Version1
+		})
+
+		runAndProcessTransportParameters := func(params *handshake.TransportParameters) <-chan error {
+			errChan := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() }).AnyTimes()
+				errChan <- sess.run()
+			}()
+			sess.processTransportParameters(params)
+			return errChan
+		}
+
+		expectTransportParameterError := func(params *handshake.TransportParameters, msg string) {
+			expectedErr := &TransportError{ErrorCode: qerr.TransportParameterError, ErrorMessage: msg}
+			streamManager.EXPECT().CloseWithError(expectedErr)
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			cryptoSetup.EXPECT().Close()
+			Eventually(runAndProcessTransportParameters(params)).Should(Receive(Equal(expectedErr)))
+			Expect(sess.peerParams).To(BeNil())
+		}
+
+		It("accepts a matching initial_source_connection_id", func() {
+			params := &handshake.TransportParameters{InitialSourceConnectionID: protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}}
+			streamManager.EXPECT().UpdateLimits(params)
+			packer.EXPECT().HandleTransportParameters(params)
+			errChan := runAndProcessTransportParameters(params)
+			Expect(sess.peerParams).To(Equal(params))
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			cryptoSetup.EXPECT().Close()
+			sess.Close()
+			Eventually(errChan).Should(Receive())
+		})
+
+		It("errors if the initial_source_connection_id is missing", func() {
+			expectTransportParameterError(
+				&handshake.TransportParameters{},
+				"missing initial_source_connection_id",
+			)
+		})
+
+		It("errors if the initial_source_connection_id doesn't match", func() {
+			expectTransportParameterError(
+				&handshake.TransportParameters{InitialSourceConnectionID: protocol.ConnectionID{1, 2, 3, 4}},
+				"expected initial_source_connection_id to equal 0x0807060504030201, is 0x01020304",
+			)
+		})
+	})
+
 	Context("keep-alives", func() {
 		// should be shorter than the local timeout for these tests
 		// otherwise we'd send a CONNECTION_CLOSE in the tests where we're testing that no PING is sent
@@ -1112,23 +1779,22 @@ var _ = Describe("Session", func() {
 		})
 
 		It("times out due to no network activity", func() {
-			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 			sess.handshakeComplete = true
 			sess.lastNetworkActivityTime = time.Now().Add(-time.Hour)
 			done := make(chan struct{})
 			cryptoSetup.EXPECT().Close()
-			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
-				Expect(f.ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
-				return &packedPacket{}, nil
-			})
+			// no call to PackConnectionClose, the session is closed silently
 			go func() {
 				defer GinkgoRecover()
 				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
 				err := sess.run()
-				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+				Expect(err).To(BeAssignableToTypeOf(&IdleTimeoutError{}))
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
 				close(done)
 			}()
 			Eventually(done).Should(BeClosed())
+			Expect(mconn.written).To(BeEmpty())
 		})
 
 		It("times out due to non-completed handshake", func() {
@@ -1136,7 +1802,8 @@ var _ = Describe("Session", func() {
 			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
 			cryptoSetup.EXPECT().Close()
 			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
-				Expect(f.ErrorCode).To(Equal(qerr.HandshakeTimeout))
+				Expect(f.ErrorCode).To(Equal(qerr.ConnectionRefused))
+				Expect(f.IsApplicationError).To(BeFalse())
 				return &packedPacket{}, nil
 			})
 			done := make(chan struct{})
@@ -1144,7 +1811,8 @@ var _ = Describe("Session", func() {
 				defer GinkgoRecover()
 				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
 				err := sess.run()
-				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.HandshakeTimeout))
+				Expect(err).To(BeAssignableToTypeOf(&HandshakeTimeoutError{}))
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
 				close(done)
 			}()
 			Eventually(done).Should(BeClosed())
@@ -1154,7 +1822,7 @@ var _ = Describe("Session", func() {
 			sess.config.IdleTimeout = 9999 * time.Second
 			sess.lastNetworkActivityTime = time.Now().Add(-time.Minute)
 			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
-				Expect(f.ErrorCode).To(Equal(qerr.PeerGoingAway))
+				Expect(f.ErrorCode).To(Equal(qerr.ApplicationError))
 				return &packedPacket{}, nil
 			})
 			// the handshake timeout is irrelevant here, since it depends on the time the session was created,
@@ -1174,12 +1842,9 @@ var _ = Describe("Session", func() {
 
 		It("closes the session due to the idle timeout after handshake", func() {
 			packer.EXPECT().PackPacket().AnyTimes()
-			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess)
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any()).Times(2)
 			cryptoSetup.EXPECT().Close()
-			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
-				Expect(f.ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
-				return &packedPacket{}, nil
-			})
 			sess.config.IdleTimeout = 0
 			done := make(chan struct{})
 			go func() {
@@ -1187,7 +1852,8 @@ var _ = Describe("Session", func() {
 				sessionRunner.EXPECT().onHandshakeComplete(sess)
 				cryptoSetup.EXPECT().RunHandshake()
 				err := sess.run()
-				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NetworkIdleTimeout))
+				Expect(err).To(BeAssignableToTypeOf(&IdleTimeoutError{}))
+				Expect(err.(net.Error).Timeout()).To(BeTrue())
 				close(done)
 			}()
 			Eventually(done).Should(BeClosed())
@@ -1202,6 +1868,11 @@ var _ = Describe("Session", func() {
 		close(done)
 	}, 0.5)
 
+	It("doesn't allow the server to migrate", func() {
+		err := sess.Migrate(context.Background(), newMockPacketConn())
+		Expect(err).To(MatchError("only the client can migrate a session"))
+	})
+
 	Context("getting streams", func() {
 		It("returns a new stream", func() {
 			mstr := NewMockStreamI(mockCtrl)
@@ -1237,8 +1908,8 @@ var _ = Describe("Session", func() {
 
 		It("opens streams synchronously", func() {
 			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().OpenStreamSync().Return(mstr, nil)
-			str, err := sess.OpenStreamSync()
+			streamManager.EXPECT().OpenStreamSync(gomock.Any()).Return(mstr, nil)
+			str, err := sess.OpenStreamSync(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
@@ -1253,27 +1924,48 @@ var _ = Describe("Session", func() {
 
 		It("opens unidirectional streams synchronously", func() {
 			mstr := NewMockSendStreamI(mockCtrl)
-			streamManager.EXPECT().OpenUniStreamSync().Return(mstr, nil)
-			str, err := sess.OpenUniStreamSync()
+			streamManager.EXPECT().OpenUniStreamSync(gomock.Any()).Return(mstr, nil)
+			str, err := sess.OpenUniStreamSync(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
 
 		It("accepts streams", func() {
 			mstr := NewMockStreamI(mockCtrl)
-			streamManager.EXPECT().AcceptStream().Return(mstr, nil)
-			str, err := sess.AcceptStream()
+			streamManager.EXPECT().AcceptStream(gomock.Any()).Return(mstr, nil)
+			str, err := sess.AcceptStream(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
 
 		It("accepts unidirectional streams", func() {
 			mstr := NewMockReceiveStreamI(mockCtrl)
-			streamManager.EXPECT().AcceptUniStream().Return(mstr, nil)
-			str, err := sess.AcceptUniStream()
+			streamManager.EXPECT().AcceptUniStream(gomock.Any()).Return(mstr, nil)
+			str, err := sess.AcceptUniStream(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
+
+		It("changes the stream limits", func() {
+			streamManager.EXPECT().SetMaxIncomingStreams(uint64(42))
+			sess.SetMaxIncomingStreams(42)
+			streamManager.EXPECT().SetMaxIncomingUniStreams(uint64(1337))
+			sess.SetMaxIncomingUniStreams(1337)
+		})
+
+		It("treats negative stream limits as 0", func() {
+			streamManager.EXPECT().SetMaxIncomingStreams(uint64(0))
+			sess.SetMaxIncomingStreams(-1)
+			streamManager.EXPECT().SetMaxIncomingUniStreams(uint64(0))
+			sess.SetMaxIncomingUniStreams(-1)
+		})
+
+		It("returns the stream credit", func() {
+			streamManager.EXPECT().IncomingStreamCredit().Return(StreamCredit{MaxStreams: 10, Remaining: 3})
+			Expect(sess.IncomingStreamCredit()).To(Equal(StreamCredit{MaxStreams: 10, Remaining: 3}))
+			streamManager.EXPECT().IncomingUniStreamCredit().Return(StreamCredit{MaxStreams: 20, Remaining: 5})
+			Expect(sess.IncomingUniStreamCredit()).To(Equal(StreamCredit{MaxStreams: 20, Remaining: 5}))
+		})
 	})
 
 	It("returns the local address", func() {
@@ -1287,6 +1979,107 @@ var _ = Describe("Session", func() {
 		mconn.remoteAddr = addr
 		Expect(sess.RemoteAddr()).To(Equal(addr))
 	})
+
+	It("releases the memory budget if creating the session fails", func() {
+		orig := newCryptoSetupServer
+		defer func() { newCryptoSetupServer = orig }()
+		newCryptoSetupServer = func(
+			io.Writer,
+			io.Writer,
+			protocol.ConnectionID,
+			*handshake.TransportParameters,
+			func(*handshake.TransportParameters),
+			*tls.Config,
+			*handshake.PSKConfig,
+			[]protocol.VersionNumber,
+			protocol.VersionNumber,
+			utils.Logger,
+			protocol.Perspective,
+		) (handshake.CryptoSetup, error) {
+			return nil, errors.New("crypto setup failed")
+		}
+		budget := NewMemoryBudget(1 << 20)
+		_, err := newSession(
+			mconn,
+			sessionRunner,
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			populateServerConfig(&Config{ReceiveMemoryBudget: budget}),
+			nil, // tls.Config
+			nil, // handshake.TransportParameters,
+			utils.DefaultLogger,
+			protocol.VersionTLS,
+		)
+		Expect(err).To(MatchError("crypto setup failed"))
+		Expect(budget.Stats().Connections).To(BeZero())
+		Expect(budget.Stats().Reserved).To(BeZero())
+	})
+
+	It("only grants as much flow control credit as the memory budget has left", func() {
+		orig := newCryptoSetupServer
+		defer func() { newCryptoSetupServer = orig }()
+		var granted []*handshake.TransportParameters
+		newCryptoSetupServer = func(
+			_ io.Writer,
+			_ io.Writer,
+			_ protocol.ConnectionID,
+			params *handshake.TransportParameters,
+			_ func(*handshake.TransportParameters),
+			_ *tls.Config,
+			_ *handshake.PSKConfig,
+			_ []protocol.VersionNumber,
+			_ protocol.VersionNumber,
+			_ utils.Logger,
+			_ protocol.Perspective,
+		) (handshake.CryptoSetup, error) {
+			granted = append(granted, params)
+			return mocks.NewMockCryptoSetup(mockCtrl), nil
+		}
+		const limit = 5*protocol.InitialMaxData + protocol.InitialMaxData/2
+		budget := NewMemoryBudget(limit)
+		conf := populateServerConfig(&Config{ReceiveMemoryBudget: budget})
+		var refused int
+		for i := 0; i < 10; i++ {
+			_, err := newSession(
+				mconn,
+				sessionRunner,
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				conf,
+				nil, // tls.Config
+				&handshake.TransportParameters{
+					InitialMaxStreamDataBidiLocal:  protocol.InitialMaxStreamData,
+					InitialMaxStreamDataBidiRemote: protocol.InitialMaxStreamData,
+					InitialMaxStreamDataUni:        protocol.InitialMaxStreamData,
+					InitialMaxData:                 protocol.InitialMaxData,
+				},
+				utils.DefaultLogger,
+				protocol.VersionTLS,
+			)
+			if err != nil {
+				Expect(err).To(MatchError(flowcontrol.ErrMemoryBudgetExhausted))
+				refused++
+			}
+		}
+		Expect(granted).To(HaveLen(6))
+		Expect(refused).To(Equal(4))
+		var total protocol.ByteCount
+		for i, params := range granted {
+			total += params.InitialMaxData
+			Expect(params.InitialMaxStreamDataBidiLocal).To(BeNumerically("<=", params.InitialMaxData))
+			Expect(params.InitialMaxStreamDataBidiRemote).To(BeNumerically("<=", params.InitialMaxData))
+			Expect(params.InitialMaxStreamDataUni).To(BeNumerically("<=", params.InitialMaxData))
+			if i < 5 {
+				Expect(params.InitialMaxData).To(Equal(protocol.ByteCount(protocol.InitialMaxData)))
+			}
+		}
+		Expect(granted[5].InitialMaxData).To(Equal(protocol.ByteCount(protocol.InitialMaxData / 2)))
+		Expect(total).To(BeNumerically("<=", limit))
+		Expect(budget.Stats().Reserved).To(Equal(total))
+		Expect(budget.Stats().RefusedConnections).To(Equal(uint64(4)))
+	})
 })
 
 var _ = Describe("Client Session", func() {
@@ -1325,6 +2118,47 @@ var _ = Describe("Client Session", func() {
 		sess.cryptoStreamHandler = cryptoSetup
 	})
 
+	It("releases the memory budget if creating the session fails", func() {
+		orig := newCryptoSetupClient
+		defer func() { newCryptoSetupClient = orig }()
+		newCryptoSetupClient = func(
+			io.Writer,
+			io.Writer,
+			protocol.ConnectionID,
+			protocol.ConnectionID,
+			*handshake.TransportParameters,
+			func(*handshake.TransportParameters),
+			*tls.Config,
+			*handshake.PSKConfig,
+			protocol.VersionNumber,
+			[]protocol.VersionNumber,
+			protocol.VersionNumber,
+			utils.Logger,
+			protocol.Perspective,
+		) (handshake.CryptoSetup, <-chan struct{}, error) {
+			return nil, nil, errors.New("crypto setup failed")
+		}
+		conf := populateClientConfig(&Config{}, true)
+		conf.ReceiveMemoryBudget = NewMemoryBudget(1 << 20)
+		_, err := newClientSession(
+			mconn,
+			sessionRunner,
+			nil, // token
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			conf,
+			nil, // tls.Config
+			nil, // transport parameters
+			protocol.VersionWhatever,
+			utils.DefaultLogger,
+			protocol.VersionWhatever,
+		)
+		Expect(err).To(MatchError("crypto setup failed"))
+		Expect(conf.ReceiveMemoryBudget.Stats().Connections).To(BeZero())
+		Expect(conf.ReceiveMemoryBudget.Stats().Reserved).To(BeZero())
+	})
+
 	It("changes the connection ID when receiving the first packet from the server", func() {
 		unpacker := NewMockUnpacker(mockCtrl)
 		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
@@ -1353,4 +2187,460 @@ var _ = Describe("Client Session", func() {
 		Expect(sess.Close()).To(Succeed())
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
+
+	Context("checking connection IDs in the transport parameters, for QUIC version 1", func() {
+		serverConnID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		retryConnID := protocol.ConnectionID{1, 3, 3, 7}
+
+		BeforeEach(func() {
+			sess.version = protocol.Version1
+		})
+
+		runAndProcessTransportParameters := func(params *handshake.TransportParameters) <-chan error {
+			errChan := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() }).AnyTimes()
+				errChan <- sess.run()
+			}()
+			sess.processTransportParameters(params)
+			return errChan
+		}
+
+		expectTransportParameterError := func(params *handshake.TransportParameters, msg string) {
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			Eventually(runAndProcessTransportParameters(params)).Should(Receive(Equal(&TransportError{
+				ErrorCode:    qerr.TransportParameterError,
+				ErrorMessage: msg,
+			})))
+			Expect(sess.peerParams).To(BeNil())
+		}
+
+		expectSuccess := func(params *handshake.TransportParameters) {
+			packer.EXPECT().HandleTransportParameters(params)
+			errChan := runAndProcessTransportParameters(params)
+			Expect(sess.peerParams).To(Equal(params))
+			// make sure the go routine returns
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			Expect(sess.Close()).To(Succeed())
+			Eventually(errChan).Should(Receive())
+		}
+
+		It("remembers the connection ID from the Retry", func() {
+			s, err := newClientSession(
+				mconn,
+				sessionRunner,
+				[]byte("token"),
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				retryConnID,
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				populateClientConfig(&Config{}, true),
+				nil, // tls.Config
+				nil, // transport parameters
+				protocol.Version1,
+				utils.DefaultLogger,
+				protocol.Version1,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.(*session).retrySrcConnID).To(Equal(retryConnID))
+		})
+
+		It("accepts matching connection IDs, if no Retry was performed", func() {
+			expectSuccess(&handshake.TransportParameters{InitialSourceConnectionID: serverConnID})
+		})
+
+		It("errors if the initial_source_connection_id doesn't match", func() {
+			expectTransportParameterError(
+				&handshake.TransportParameters{InitialSourceConnectionID: protocol.ConnectionID{1, 2, 3, 4}},
+				"expected initial_source_connection_id to equal 0x0807060504030201, is 0x01020304",
+			)
+		})
+
+		It("errors if the server sends a retry_source_connection_id, although no Retry was performed", func() {
+			expectTransportParameterError(
+				&handshake.TransportParameters{
+					InitialSourceConnectionID: serverConnID,
+					RetrySourceConnectionID:   retryConnID,
+				},
+				"received retry_source_connection_id, although no Retry was performed",
+			)
+		})
+
+		Context("after a Retry", func() {
+			BeforeEach(func() {
+				sess.retrySrcConnID = retryConnID
+			})
+
+			It("accepts matching connection IDs", func() {
+				expectSuccess(&handshake.TransportParameters{
+					InitialSourceConnectionID: serverConnID,
+					RetrySourceConnectionID:   retryConnID,
+				})
+			})
+
+			It("errors if the retry_source_connection_id is missing", func() {
+				expectTransportParameterError(
+					&handshake.TransportParameters{InitialSourceConnectionID: serverConnID},
+					"missing retry_source_connection_id",
+				)
+			})
+
+			It("errors if the retry_source_connection_id doesn't match", func() {
+				expectTransportParameterError(
+					&handshake.TransportParameters{
+						InitialSourceConnectionID: serverConnID,
+						RetrySourceConnectionID:   protocol.ConnectionID{4, 3, 2, 1},
+					},
+					"expected retry_source_connection_id to equal 0x01030307, is 0x04030201",
+				)
+			})
+		})
+	})
+
+	Context("migrating", func() {
+		var newPacketConn *mockPacketConn
+
+		getPathChallengePacket := func(pn protocol.PacketNumber, f *wire.PathChallengeFrame) *packedPacket {
+			data := (*getPacketBuffer())[:0]
+			data = append(data, []byte("probe")...)
+			return &packedPacket{
+				header:          &wire.Header{PacketNumber: pn},
+				raw:             data,
+				frames:          []wire.Frame{f},
+				encryptionLevel: protocol.Encryption1RTT,
+			}
+		}
+
+		newMigration := func() *migration {
+			return &migration{
+				ctx:   context.Background(),
+				pconn: newPacketConn,
+				done:  make(chan error, 1),
+			}
+		}
+
+		newConnID := protocol.ConnectionID{0xc0, 0xff, 0xee, 0x42}
+
+		issueConnectionID := func() {
+			Expect(sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+				SequenceNumber: 1,
+				ConnectionID:   newConnID,
+			}}, protocol.Encryption1RTT)).To(Succeed())
+		}
+
+		var rcvdPacketNumber protocol.PacketNumber
+		// receivePacket receives a packet on the given packet conn, from the given address
+		receivePacket := func(pconn net.PacketConn, addr net.Addr, frames ...wire.Frame) {
+			unpacker := NewMockUnpacker(mockCtrl)
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				frames:          frames,
+				encryptionLevel: protocol.Encryption1RTT,
+			}, nil)
+			sess.unpacker = unpacker
+			rcvdPacketNumber++
+			Expect(sess.handlePacketImpl(&receivedPacket{
+				conn:       pconn,
+				remoteAddr: addr,
+				header: &wire.Header{
+					DestConnectionID: sess.srcConnID,
+					PacketNumber:     rcvdPacketNumber,
+					PacketNumberLen:  protocol.PacketNumberLen2,
+				},
+				data: []byte("foobar"),
+			})).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			newPacketConn = newMockPacketConn()
+			mconn.pconn = newMockPacketConn()
+			sess.handshakeComplete = true
+			sess.peerParams = &handshake.TransportParameters{}
+		})
+
+		Context("handling NEW_CONNECTION_ID frames", func() {
+			It("stores connection IDs, and ignores retransmissions", func() {
+				issueConnectionID()
+				issueConnectionID()
+				Expect(sess.unusedPeerConnIDs).To(HaveLen(1))
+				Expect(sess.unusedPeerConnIDs[0].ConnectionID).To(Equal(newConnID))
+			})
+
+			It("errors when the server issues too many connection IDs", func() {
+				issueConnectionID()
+				err := sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+					SequenceNumber: 2,
+					ConnectionID:   protocol.ConnectionID{1, 2, 3, 4},
+				}}, protocol.Encryption1RTT)
+				Expect(err).To(MatchError("CONNECTION_ID_LIMIT_ERROR: too many connection IDs"))
+			})
+
+			It("retires connection IDs when requested", func() {
+				packer.EXPECT().ChangeDestConnectionID(newConnID)
+				Expect(sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{
+					SequenceNumber: 1,
+					RetirePriorTo:  1,
+					ConnectionID:   newConnID,
+				}}, protocol.Encryption1RTT)).To(Succeed())
+				Expect(sess.destConnID).To(Equal(newConnID))
+				Expect(sess.unusedPeerConnIDs).To(BeEmpty())
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}))
+			})
+
+			It("doesn't expect RETIRE_CONNECTION_ID frames", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{}}, protocol.Encryption1RTT)
+				Expect(err).To(MatchError("unexpected RETIRE_CONNECTION_ID frame"))
+			})
+		})
+
+		It("doesn't migrate before the handshake completed", func() {
+			err := sess.Migrate(context.Background(), newPacketConn)
+			Expect(err).To(MatchError("can't migrate before the handshake completed"))
+		})
+
+		It("validates the new path and switches to the new packet conn and connection ID", func() {
+			issueConnectionID()
+			oldPacketConn := mconn.pconn
+			var challenge [8]byte
+			sessionRunner.EXPECT().addPacketConn(newPacketConn)
+			packer.EXPECT().PackPathChallenge(gomock.Any(), newConnID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+				challenge = f.Data
+				return getPathChallengePacket(1, f), nil
+			})
+			m := newMigration()
+			sess.startMigration(m)
+			Expect(newPacketConn.dataWritten.Bytes()).To(Equal([]byte("probe")))
+			Expect(newPacketConn.dataWrittenTo).To(Equal(mconn.remoteAddr))
+			Expect(mconn.written).To(BeEmpty())
+			Expect(m.done).ToNot(Receive())
+			// a PATH_RESPONSE that doesn't match is ignored
+			receivePacket(newPacketConn, mconn.remoteAddr, &wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})
+			Expect(m.done).ToNot(Receive())
+			sessionRunner.EXPECT().removePacketConn(oldPacketConn)
+			packer.EXPECT().ChangeDestConnectionID(newConnID)
+			receivePacket(newPacketConn, mconn.remoteAddr, &wire.PathResponseFrame{Data: challenge})
+			var err error
+			Expect(m.done).To(Receive(&err))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mconn.pconn).To(Equal(newPacketConn))
+			Expect(sess.migration).To(BeNil())
+			Expect(sess.destConnID).To(Equal(newConnID))
+			// the old connection ID is retired
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}))
+		})
+
+		It("doesn't migrate if the new packet conn can send, but doesn't receive packets", func() {
+			issueConnectionID()
+			oldPacketConn := mconn.pconn
+			var challenges [][8]byte
+			sessionRunner.EXPECT().addPacketConn(newPacketConn)
+			packer.EXPECT().PackPathChallenge(gomock.Any(), newConnID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+				challenges = append(challenges, f.Data)
+				return getPathChallengePacket(protocol.PacketNumber(len(challenges)), f), nil
+			}).Times(protocol.MaxPathChallenges)
+			m := newMigration()
+			sess.startMigration(m)
+			Expect(newPacketConn.dataWritten.Len()).ToNot(BeZero())
+			for i := 0; i < protocol.MaxPathChallenges; i++ {
+				// The server's PATH_RESPONSE only arrives on the old packet conn.
+				receivePacket(oldPacketConn, mconn.remoteAddr, &wire.PathResponseFrame{Data: challenges[i]})
+				Expect(m.done).ToNot(Receive())
+				if i < protocol.MaxPathChallenges-1 {
+					sess.onPathProbeTimeout(sess.migration.nextProbe)
+				}
+			}
+			sessionRunner.EXPECT().removePacketConn(newPacketConn)
+			sess.onPathProbeTimeout(sess.migration.nextProbe)
+			Expect(m.done).To(Receive(MatchError("path validation timed out")))
+			Expect(mconn.pconn).To(Equal(oldPacketConn))
+			Expect(sess.destConnID).ToNot(Equal(newConnID))
+		})
+
+		It("answers PATH_CHALLENGEs on the path they were received on", func() {
+			issueConnectionID()
+			sessionRunner.EXPECT().addPacketConn(newPacketConn)
+			packer.EXPECT().PackPathChallenge(gomock.Any(), newConnID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+				return getPathChallengePacket(1, f), nil
+			})
+			sess.startMigration(newMigration())
+			newPacketConn.dataWritten.Reset()
+			packer.EXPECT().PackPathResponse(&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}, newConnID).Return(&packedPacket{
+				header:          &wire.Header{PacketNumber: 2},
+				raw:             append((*getPacketBuffer())[:0], []byte("response")...),
+				encryptionLevel: protocol.Encryption1RTT,
+			}, nil)
+			receivePacket(newPacketConn, mconn.remoteAddr, &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})
+			Expect(newPacketConn.dataWritten.Bytes()).To(Equal([]byte("response")))
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(BeEmpty())
+		})
+
+		It("sends new PATH_CHALLENGEs, and fails if none of them is answered", func() {
+			issueConnectionID()
+			var pn protocol.PacketNumber
+			sessionRunner.EXPECT().addPacketConn(newPacketConn)
+			packer.EXPECT().PackPathChallenge(gomock.Any(), newConnID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+				pn++
+				return getPathChallengePacket(pn, f), nil
+			}).Times(protocol.MaxPathChallenges)
+			m := newMigration()
+			sess.startMigration(m)
+			for i := 1; i < protocol.MaxPathChallenges; i++ {
+				Expect(sess.migration.nextProbe).To(BeTemporally(">", time.Now()))
+				sess.onPathProbeTimeout(sess.migration.nextProbe)
+			}
+			Expect(sess.migration.challenges).To(HaveLen(protocol.MaxPathChallenges))
+			Expect(m.done).ToNot(Receive())
+			sessionRunner.EXPECT().removePacketConn(newPacketConn)
+			sess.onPathProbeTimeout(sess.migration.nextProbe)
+			Expect(m.done).To(Receive(MatchError("path validation timed out")))
+			Expect(mconn.pconn).ToNot(Equal(newPacketConn))
+			// the connection ID used on the new path is retired
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}))
+		})
+
+		It("doesn't migrate if the server didn't issue an unused connection ID", func() {
+			m := newMigration()
+			sess.startMigration(m)
+			Expect(m.done).To(Receive(MatchError("the peer didn't issue an unused connection ID")))
+			Expect(sess.migration).To(BeNil())
+		})
+
+		It("doesn't migrate if the peer disabled migration", func() {
+			sess.peerParams.DisableMigration = true
+			m := newMigration()
+			sess.startMigration(m)
+			Expect(m.done).To(Receive(MatchError("the peer disabled connection migration")))
+			Expect(sess.migration).To(BeNil())
+		})
+
+		It("returns errors when registering the new packet conn fails", func() {
+			issueConnectionID()
+			testErr := errors.New("test error")
+			sessionRunner.EXPECT().addPacketConn(newPacketConn).Return(testErr)
+			m := newMigration()
+			sess.startMigration(m)
+			Expect(m.done).To(Receive(Equal(testErr)))
+			Expect(sess.migration).To(BeNil())
+		})
+
+		It("stops the migration when the context is cancelled", func() {
+			sess.handshakeCtxCancel()
+			clientHelloWritten := make(chan struct{})
+			close(clientHelloWritten)
+			sess.clientHelloWritten = clientHelloWritten
+			packer.EXPECT().PackPacket().AnyTimes()
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+			}()
+			issueConnectionID()
+			added := make(chan struct{})
+			sessionRunner.EXPECT().addPacketConn(newPacketConn).Do(func(net.PacketConn) { close(added) })
+			packer.EXPECT().PackPathChallenge(gomock.Any(), newConnID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+				return getPathChallengePacket(1, f), nil
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			errChan := make(chan error, 1)
+			go func() { errChan <- sess.Migrate(ctx, newPacketConn) }()
+			Eventually(added).Should(BeClosed())
+			sessionRunner.EXPECT().removePacketConn(newPacketConn)
+			cancel()
+			Eventually(errChan).Should(Receive(Equal(context.Canceled)))
+			// make sure the go routine returns
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			sessionRunner.EXPECT().retireConnectionID(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			Expect(sess.Close()).To(Succeed())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+
+		Context("to the preferred address", func() {
+			var preferredAddr *handshake.PreferredAddress
+
+			BeforeEach(func() {
+				mconn.remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 443}
+				preferredAddr = &handshake.PreferredAddress{
+					IPv4:         net.IPv4(192, 168, 0, 2).To4(),
+					IPv4Port:     4433,
+					IPv6:         net.IPv6zero,
+					ConnectionID: protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+				}
+			})
+
+			It("starts validating the preferred address when the handshake completes", func() {
+				sess.handshakeComplete = false
+				sess.peerParams.PreferredAddress = preferredAddr
+				sessionRunner.EXPECT().onHandshakeComplete(sess)
+				packer.EXPECT().PackPathChallenge(gomock.Any(), preferredAddr.ConnectionID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+					return getPathChallengePacket(1, f), nil
+				})
+				sess.handleHandshakeComplete()
+				Expect(sess.migration).ToNot(BeNil())
+				var p writtenPacket
+				Expect(mconn.writtenTo).To(Receive(&p))
+				Expect(p.data).To(Equal([]byte("probe")))
+				Expect(p.addr).To(Equal(&net.UDPAddr{IP: preferredAddr.IPv4, Port: 4433}))
+			})
+
+			It("switches to the preferred address after validating it", func() {
+				var challenge [8]byte
+				packer.EXPECT().PackPathChallenge(gomock.Any(), preferredAddr.ConnectionID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+					challenge = f.Data
+					return getPathChallengePacket(1, f), nil
+				})
+				oldPacketConn := mconn.pconn
+				sess.migrateToPreferredAddress(preferredAddr)
+				Expect(mconn.writtenTo).To(HaveLen(1))
+				Expect(mconn.remoteAddr).To(Equal(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 443}))
+				// a PATH_RESPONSE from the original address doesn't validate the preferred address
+				receivePacket(oldPacketConn, mconn.remoteAddr, &wire.PathResponseFrame{Data: challenge})
+				Expect(sess.migration).ToNot(BeNil())
+				packer.EXPECT().ChangeDestConnectionID(preferredAddr.ConnectionID)
+				receivePacket(oldPacketConn, &net.UDPAddr{IP: preferredAddr.IPv4, Port: 4433}, &wire.PathResponseFrame{Data: challenge})
+				Expect(sess.migration).To(BeNil())
+				Expect(mconn.remoteAddr).To(Equal(&net.UDPAddr{IP: preferredAddr.IPv4, Port: 4433}))
+				Expect(mconn.pconn).To(Equal(oldPacketConn))
+				Expect(sess.destConnID).To(Equal(preferredAddr.ConnectionID))
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}))
+			})
+
+			It("keeps using the original address if validation fails", func() {
+				var pn protocol.PacketNumber
+				packer.EXPECT().PackPathChallenge(gomock.Any(), preferredAddr.ConnectionID).DoAndReturn(func(f *wire.PathChallengeFrame, _ protocol.ConnectionID) (*packedPacket, error) {
+					pn++
+					return getPathChallengePacket(pn, f), nil
+				}).Times(protocol.MaxPathChallenges)
+				origDestConnID := sess.destConnID
+				sess.migrateToPreferredAddress(preferredAddr)
+				for i := 0; i < protocol.MaxPathChallenges; i++ {
+					sess.onPathProbeTimeout(sess.migration.nextProbe)
+				}
+				Expect(sess.migration).To(BeNil())
+				Expect(mconn.writtenTo).To(HaveLen(protocol.MaxPathChallenges))
+				Expect(mconn.remoteAddr).To(Equal(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 443}))
+				Expect(sess.destConnID).To(Equal(origDestConnID))
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}))
+			})
+
+			It("ignores a preferred address that doesn't have an address of the right family", func() {
+				mconn.remoteAddr = &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+				sess.migrateToPreferredAddress(preferredAddr)
+				Expect(sess.migration).To(BeNil())
+				Expect(mconn.writtenTo).To(BeEmpty())
+				// the connection ID can be used when migrating to a new packet conn
+				Expect(sess.unusedPeerConnIDs).To(HaveLen(1))
+				Expect(sess.unusedPeerConnIDs[0].ConnectionID).To(Equal(preferredAddr.ConnectionID))
+			})
+		})
+	})
 })
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
@@ -15,6 +16,9 @@ type streamsMap struct {
 	sender            streamSender
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController
 
+	// set from the peer's transport parameters, before any stream is opened
+	peerSupportsResetStreamAt bool
+
 	outgoingBidiStreams *outgoingBidiStreamsMap
 	outgoingUniStreams  *outgoingUniStreamsMap
 	incomingBidiStreams *incomingBidiStreamsMap
@@ -28,6 +32,7 @@ func newStreamsMap(
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController,
 	maxIncomingStreams uint64,
 	maxIncomingUniStreams uint64,
+	streamSendBufferSize protocol.ByteCount,
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) streamManager {
@@ -37,10 +42,14 @@ func newStreamsMap(
 		sender:            sender,
 	}
 	newBidiStream := func(id protocol.StreamID) streamI {
-		return newStream(id, m.sender, m.newFlowController(id), version)
+		str := newStream(id, m.sender, m.newFlowController(id), streamSendBufferSize, version)
+		str.peerSupportsResetStreamAt = m.peerSupportsResetStreamAt
+		return str
 	}
 	newUniSendStream := func(id protocol.StreamID) sendStreamI {
-		return newSendStream(id, m.sender, m.newFlowController(id), version)
+		str := newSendStream(id, m.sender, m.newFlowController(id), streamSendBufferSize, version)
+		str.peerSupportsResetStreamAt = m.peerSupportsResetStreamAt
+		return str
 	}
 	newUniReceiveStream := func(id protocol.StreamID) receiveStreamI {
 		return newReceiveStream(id, m.sender, m.newFlowController(id), version)
@@ -52,7 +61,6 @@ func newStreamsMap(
 	)
 	m.incomingBidiStreams = newIncomingBidiStreamsMap(
 		protocol.FirstStream(protocol.StreamTypeBidi, perspective.Opposite()),
-		protocol.MaxStreamID(protocol.StreamTypeBidi, maxIncomingStreams, perspective.Opposite()),
 		maxIncomingStreams,
 		sender.queueControlFrame,
 		newBidiStream,
@@ -64,7 +72,6 @@ func newStreamsMap(
 	)
 	m.incomingUniStreams = newIncomingUniStreamsMap(
 		protocol.FirstStream(protocol.StreamTypeUni, perspective.Opposite()),
-		protocol.MaxStreamID(protocol.StreamTypeUni, maxIncomingUniStreams, perspective.Opposite()),
 		maxIncomingUniStreams,
 		sender.queueControlFrame,
 		newUniReceiveStream,
@@ -76,24 +83,24 @@ func (m *streamsMap) OpenStream() (Stream, error) {
 	return m.outgoingBidiStreams.OpenStream()
 }
 
-func (m *streamsMap) OpenStreamSync() (Stream, error) {
-	return m.outgoingBidiStreams.OpenStreamSync()
+func (m *streamsMap) OpenStreamSync(ctx context.Context) (Stream, error) {
+	return m.outgoingBidiStreams.OpenStreamSync(ctx)
 }
 
 func (m *streamsMap) OpenUniStream() (SendStream, error) {
 	return m.outgoingUniStreams.OpenStream()
 }
 
-func (m *streamsMap) OpenUniStreamSync() (SendStream, error) {
-	return m.outgoingUniStreams.OpenStreamSync()
+func (m *streamsMap) OpenUniStreamSync(ctx context.Context) (SendStream, error) {
+	return m.outgoingUniStreams.OpenStreamSync(ctx)
 }
 
-func (m *streamsMap) AcceptStream() (Stream, error) {
-	return m.incomingBidiStreams.AcceptStream()
+func (m *streamsMap) AcceptStream(ctx context.Context) (Stream, error) {
+	return m.incomingBidiStreams.AcceptStream(ctx)
 }
 
-func (m *streamsMap) AcceptUniStream() (ReceiveStream, error) {
-	return m.incomingUniStreams.AcceptStream()
+func (m *streamsMap) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
+	return m.incomingUniStreams.AcceptStream(ctx)
 }
 
 func (m *streamsMap) DeleteStream(id protocol.StreamID) error {
@@ -147,21 +154,35 @@ func (m *streamsMap) GetOrOpenSendStream(id protocol.StreamID) (sendStreamI, err
 }
 
 func (m *streamsMap) HandleMaxStreamsFrame(f *wire.MaxStreamsFrame) error {
-	id := protocol.MaxStreamID(f.Type, f.MaxStreams, m.perspective)
-	switch id.Type() {
+	switch f.Type {
 	case protocol.StreamTypeUni:
-		m.outgoingUniStreams.SetMaxStream(id)
+		m.outgoingUniStreams.SetMaxStreams(f.MaxStreams)
 	case protocol.StreamTypeBidi:
-		fmt.Printf("")
-		m.outgoingBidiStreams.SetMaxStream(id)
+		m.outgoingBidiStreams.SetMaxStreams(f.MaxStreams)
 	}
 	return nil
 }
 
 func (m *streamsMap) UpdateLimits(p *handshake.TransportParameters) {
-	// Max{Uni,Bidi}StreamID returns the highest stream ID that the peer is allowed to open.
-	m.outgoingBidiStreams.SetMaxStream(protocol.MaxStreamID(protocol.StreamTypeBidi, p.MaxBidiStreams, m.perspective))
-	m.outgoingUniStreams.SetMaxStream(protocol.MaxStreamID(protocol.StreamTypeUni, p.MaxUniStreams, m.perspective))
+	m.peerSupportsResetStreamAt = p.ResetStreamAt
+	m.outgoingBidiStreams.SetMaxStreams(p.MaxBidiStreams)
+	m.outgoingUniStreams.SetMaxStreams(p.MaxUniStreams)
+}
+
+func (m *streamsMap) SetMaxIncomingStreams(num uint64) {
+	m.incomingBidiStreams.SetMaxNumStreams(num)
+}
+
+func (m *streamsMap) SetMaxIncomingUniStreams(num uint64) {
+	m.incomingUniStreams.SetMaxNumStreams(num)
+}
+
+func (m *streamsMap) IncomingStreamCredit() StreamCredit {
+	return m.incomingBidiStreams.Credit()
+}
+
+func (m *streamsMap) IncomingUniStreamCredit() StreamCredit {
+	return m.incomingUniStreams.Credit()
 }
 
 func (m *streamsMap) CloseWithError(err error) {
@@ -5,6 +5,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -14,14 +15,15 @@ import (
 
 type incomingBidiStreamsMap struct {
 	mutex sync.RWMutex
-	cond  sync.Cond
+	// newStreamChan is closed (and replaced) when a new stream is opened, or when the map is closed
+	newStreamChan chan struct{}
 
 	streams map[protocol.StreamID]streamI
 
 	nextStreamToAccept protocol.StreamID // the next stream that will be returned by AcceptStream()
 	nextStreamToOpen   protocol.StreamID // the highest stream that the peer openend
-	maxStream          protocol.StreamID // the highest stream that the peer is allowed to open
-	maxNumStreams      uint64            // maximum number of streams
+	maxNumStreams      uint64            // maximum number of concurrent streams
+	grantedStreams     uint64            // the total number of streams that the peer is allowed to open
 
 	newStream        func(protocol.StreamID) streamI
 	queueMaxStreamID func(*wire.MaxStreamsFrame)
@@ -31,7 +33,6 @@ type incomingBidiStreamsMap struct {
 
 func newIncomingBidiStreamsMap(
 	nextStreamToAccept protocol.StreamID,
-	initialMaxStreamID protocol.StreamID,
 	maxNumStreams uint64,
 	queueControlFrame func(wire.Frame),
 	newStream func(protocol.StreamID) streamI,
@@ -40,16 +41,16 @@ func newIncomingBidiStreamsMap(
 		streams:            make(map[protocol.StreamID]streamI),
 		nextStreamToAccept: nextStreamToAccept,
 		nextStreamToOpen:   nextStreamToAccept,
-		maxStream:          initialMaxStreamID,
 		maxNumStreams:      maxNumStreams,
+		grantedStreams:     maxNumStreams,
 		newStream:          newStream,
 		queueMaxStreamID:   func(f *wire.MaxStreamsFrame) { queueControlFrame(f) },
+		newStreamChan:      make(chan struct{}),
 	}
-	m.cond.L = &m.mutex
 	return m
 }
 
-func (m *incomingBidiStreamsMap) AcceptStream() (streamI, error) {
+func (m *incomingBidiStreamsMap) AcceptStream(ctx context.Context) (streamI, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -63,17 +64,31 @@ func (m *incomingBidiStreamsMap) AcceptStream() (streamI, error) {
 		if ok {
 			break
 		}
-		m.cond.Wait()
+		newStreamChan := m.newStreamChan
+		m.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			m.mutex.Lock()
+			return nil, ctx.Err()
+		case <-newStreamChan:
+		}
+		m.mutex.Lock()
 	}
 	m.nextStreamToAccept += 4
 	return str, nil
 }
 
+// signalNewStream must be called with the mutex held
+func (m *incomingBidiStreamsMap) signalNewStream() {
+	close(m.newStreamChan)
+	m.newStreamChan = make(chan struct{})
+}
+
 func (m *incomingBidiStreamsMap) GetOrOpenStream(id protocol.StreamID) (streamI, error) {
 	m.mutex.RLock()
-	if id > m.maxStream {
+	if id.StreamNum() > m.grantedStreams {
 		m.mutex.RUnlock()
-		return nil, fmt.Errorf("peer tried to open stream %d (current limit: %d)", id, m.maxStream)
+		return nil, fmt.Errorf("peer tried to open stream %d (current limit: %d streams)", id, m.grantedStreams)
 	}
 	// if the id is smaller than the highest we accepted
 	// * this stream exists in the map, and we can return it, or
@@ -87,12 +102,12 @@ func (m *incomingBidiStreamsMap) GetOrOpenStream(id protocol.StreamID) (streamI,
 
 	m.mutex.Lock()
 	// no need to check the two error conditions from above again
-	// * maxStream can only increase, so if the id was valid before, it definitely is valid now
+	// * grantedStreams can only increase, so if the id was valid before, it definitely is valid now
 	// * highestStream is only modified by this function
 	for newID := m.nextStreamToOpen; newID <= id; newID += 4 {
 		m.streams[newID] = m.newStream(newID)
-		m.cond.Signal()
 	}
+	m.signalNewStream()
 	m.nextStreamToOpen = id + 4
 	s := m.streams[id]
 	m.mutex.Unlock()
@@ -107,24 +122,61 @@ func (m *incomingBidiStreamsMap) DeleteStream(id protocol.StreamID) error {
 		return fmt.Errorf("Tried to delete unknown stream %d", id)
 	}
 	delete(m.streams, id)
-	// queue a MAX_STREAM_ID frame, giving the peer the option to open a new stream
-	if m.maxNumStreams > uint64(len(m.streams)) {
-		numNewStreams := m.maxNumStreams - uint64(len(m.streams))
-		m.maxStream = m.nextStreamToOpen + protocol.StreamID((numNewStreams-1)*4)
-		m.queueMaxStreamID(&wire.MaxStreamsFrame{
-			Type:       protocol.StreamTypeBidi,
-			MaxStreams: m.maxStream.StreamNum(),
-		})
-	}
+	// queue a MAX_STREAMS frame, giving the peer the option to open a new stream
+	m.maybeQueueMaxStreams()
 	return nil
 }
 
+// SetMaxNumStreams sets the maximum number of concurrent streams.
+// Raising the limit immediately grants the peer the additional credit.
+// Credit that was already granted can't be taken back,
+// so a lower limit only takes effect once the peer has used up that credit.
+func (m *incomingBidiStreamsMap) SetMaxNumStreams(num uint64) {
+	m.mutex.Lock()
+	m.maxNumStreams = num
+	m.maybeQueueMaxStreams()
+	m.mutex.Unlock()
+}
+
+// maybeQueueMaxStreams must be called with the mutex held
+func (m *incomingBidiStreamsMap) maybeQueueMaxStreams() {
+	if m.maxNumStreams <= uint64(len(m.streams)) {
+		return
+	}
+	numNewStreams := m.maxNumStreams - uint64(len(m.streams))
+	granted := m.numOpenedStreams() + numNewStreams
+	if granted <= m.grantedStreams {
+		return
+	}
+	m.grantedStreams = granted
+	m.queueMaxStreamID(&wire.MaxStreamsFrame{
+		Type:       protocol.StreamTypeBidi,
+		MaxStreams: m.grantedStreams,
+	})
+}
+
+// numOpenedStreams must be called with the mutex held
+func (m *incomingBidiStreamsMap) numOpenedStreams() uint64 {
+	return m.nextStreamToOpen.StreamNum() - 1
+}
+
+// Credit returns the stream credit granted to the peer
+func (m *incomingBidiStreamsMap) Credit() StreamCredit {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return StreamCredit{
+		MaxStreams: m.grantedStreams,
+		Remaining:  m.grantedStreams - m.numOpenedStreams(),
+	}
+}
+
 func (m *incomingBidiStreamsMap) CloseWithError(err error) {
 	m.mutex.Lock()
 	m.closeErr = err
 	for _, str := range m.streams {
 		str.closeForShutdown(err)
 	}
+	m.signalNewStream()
 	m.mutex.Unlock()
-	m.cond.Broadcast()
 }
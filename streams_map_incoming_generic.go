@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -12,14 +13,15 @@ import (
 //go:generate genny -in $GOFILE -out streams_map_incoming_uni.go gen "item=receiveStreamI Item=UniStream streamTypeGeneric=protocol.StreamTypeUni"
 type incomingItemsMap struct {
 	mutex sync.RWMutex
-	cond  sync.Cond
+	// newStreamChan is closed (and replaced) when a new stream is opened, or when the map is closed
+	newStreamChan chan struct{}
 
 	streams map[protocol.StreamID]item
 
 	nextStreamToAccept protocol.StreamID // the next stream that will be returned by AcceptStream()
 	nextStreamToOpen   protocol.StreamID // the highest stream that the peer openend
-	maxStream          protocol.StreamID // the highest stream that the peer is allowed to open
-	maxNumStreams      uint64            // maximum number of streams
+	maxNumStreams      uint64            // maximum number of concurrent streams
+	grantedStreams     uint64            // the total number of streams that the peer is allowed to open
 
 	newStream        func(protocol.StreamID) item
 	queueMaxStreamID func(*wire.MaxStreamsFrame)
@@ -29,7 +31,6 @@ type incomingItemsMap struct {
 
 func newIncomingItemsMap(
 	nextStreamToAccept protocol.StreamID,
-	initialMaxStreamID protocol.StreamID,
 	maxNumStreams uint64,
 	queueControlFrame func(wire.Frame),
 	newStream func(protocol.StreamID) item,
@@ -38,16 +39,16 @@ func newIncomingItemsMap(
 		streams:            make(map[protocol.StreamID]item),
 		nextStreamToAccept: nextStreamToAccept,
 		nextStreamToOpen:   nextStreamToAccept,
-		maxStream:          initialMaxStreamID,
 		maxNumStreams:      maxNumStreams,
+		grantedStreams:     maxNumStreams,
 		newStream:          newStream,
 		queueMaxStreamID:   func(f *wire.MaxStreamsFrame) { queueControlFrame(f) },
+		newStreamChan:      make(chan struct{}),
 	}
-	m.cond.L = &m.mutex
 	return m
 }
 
-func (m *incomingItemsMap) AcceptStream() (item, error) {
+func (m *incomingItemsMap) AcceptStream(ctx context.Context) (item, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -61,17 +62,31 @@ func (m *incomingItemsMap) AcceptStream() (item, error) {
 		if ok {
 			break
 		}
-		m.cond.Wait()
+		newStreamChan := m.newStreamChan
+		m.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			m.mutex.Lock()
+			return nil, ctx.Err()
+		case <-newStreamChan:
+		}
+		m.mutex.Lock()
 	}
 	m.nextStreamToAccept += 4
 	return str, nil
 }
 
+// signalNewStream must be called with the mutex held
+func (m *incomingItemsMap) signalNewStream() {
+	close(m.newStreamChan)
+	m.newStreamChan = make(chan struct{})
+}
+
 func (m *incomingItemsMap) GetOrOpenStream(id protocol.StreamID) (item, error) {
 	m.mutex.RLock()
-	if id > m.maxStream {
+	if id.StreamNum() > m.grantedStreams {
 		m.mutex.RUnlock()
-		return nil, fmt.Errorf("peer tried to open stream %d (current limit: %d)", id, m.maxStream)
+		return nil, fmt.Errorf("peer tried to open stream %d (current limit: %d streams)", id, m.grantedStreams)
 	}
 	// if the id is smaller than the highest we accepted
 	// * this stream exists in the map, and we can return it, or
@@ -85,12 +100,12 @@ func (m *incomingItemsMap) GetOrOpenStream(id protocol.StreamID) (item, error) {
 
 	m.mutex.Lock()
 	// no need to check the two error conditions from above again
-	// * maxStream can only increase, so if the id was valid before, it definitely is valid now
+	// * grantedStreams can only increase, so if the id was valid before, it definitely is valid now
 	// * highestStream is only modified by this function
 	for newID := m.nextStreamToOpen; newID <= id; newID += 4 {
 		m.streams[newID] = m.newStream(newID)
-		m.cond.Signal()
 	}
+	m.signalNewStream()
 	m.nextStreamToOpen = id + 4
 	s := m.streams[id]
 	m.mutex.Unlock()
@@ -105,24 +120,61 @@ func (m *incomingItemsMap) DeleteStream(id protocol.StreamID) error {
 		return fmt.Errorf("Tried to delete unknown stream %d", id)
 	}
 	delete(m.streams, id)
-	// queue a MAX_STREAM_ID frame, giving the peer the option to open a new stream
-	if m.maxNumStreams > uint64(len(m.streams)) {
-		numNewStreams := m.maxNumStreams - uint64(len(m.streams))
-		m.maxStream = m.nextStreamToOpen + protocol.StreamID((numNewStreams-1)*4)
-		m.queueMaxStreamID(&wire.MaxStreamsFrame{
-			Type:       streamTypeGeneric,
-			MaxStreams: m.maxStream.StreamNum(),
-		})
-	}
+	// queue a MAX_STREAMS frame, giving the peer the option to open a new stream
+	m.maybeQueueMaxStreams()
 	return nil
 }
 
+// SetMaxNumStreams sets the maximum number of concurrent streams.
+// Raising the limit immediately grants the peer the additional credit.
+// Credit that was already granted can't be taken back,
+// so a lower limit only takes effect once the peer has used up that credit.
+func (m *incomingItemsMap) SetMaxNumStreams(num uint64) {
+	m.mutex.Lock()
+	m.maxNumStreams = num
+	m.maybeQueueMaxStreams()
+	m.mutex.Unlock()
+}
+
+// maybeQueueMaxStreams must be called with the mutex held
+func (m *incomingItemsMap) maybeQueueMaxStreams() {
+	if m.maxNumStreams <= uint64(len(m.streams)) {
+		return
+	}
+	numNewStreams := m.maxNumStreams - uint64(len(m.streams))
+	granted := m.numOpenedStreams() + numNewStreams
+	if granted <= m.grantedStreams {
+		return
+	}
+	m.grantedStreams = granted
+	m.queueMaxStreamID(&wire.MaxStreamsFrame{
+		Type:       streamTypeGeneric,
+		MaxStreams: m.grantedStreams,
+	})
+}
+
+// numOpenedStreams must be called with the mutex held
+func (m *incomingItemsMap) numOpenedStreams() uint64 {
+	return m.nextStreamToOpen.StreamNum() - 1
+}
+
+// Credit returns the stream credit granted to the peer
+func (m *incomingItemsMap) Credit() StreamCredit {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return StreamCredit{
+		MaxStreams: m.grantedStreams,
+		Remaining:  m.grantedStreams - m.numOpenedStreams(),
+	}
+}
+
 func (m *incomingItemsMap) CloseWithError(err error) {
 	m.mutex.Lock()
 	m.closeErr = err
 	for _, str := range m.streams {
 		str.closeForShutdown(err)
 	}
+	m.signalNewStream()
 	m.mutex.Unlock()
-	m.cond.Broadcast()
 }
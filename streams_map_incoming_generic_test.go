@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -45,7 +46,7 @@ var _ = Describe("Streams Map (incoming)", func() {
 			return &mockGenericStream{id: id}
 		}
 		mockSender = NewMockStreamSender(mockCtrl)
-		m = newIncomingItemsMap(firstNewStream, initialMaxStream, maxNumStreams, mockSender.queueControlFrame, newItem)
+		m = newIncomingItemsMap(firstNewStream, maxNumStreams, mockSender.queueControlFrame, newItem)
 	})
 
 	It("opens all streams up to the id on GetOrOpenStream", func() {
@@ -67,10 +68,10 @@ var _ = Describe("Streams Map (incoming)", func() {
 	It("accepts streams in the right order", func() {
 		_, err := m.GetOrOpenStream(firstNewStream + 4) // open stream 20 and 24
 		Expect(err).ToNot(HaveOccurred())
-		str, err := m.AcceptStream()
+		str, err := m.AcceptStream(context.Background())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
-		str, err = m.AcceptStream()
+		str, err = m.AcceptStream(context.Background())
 		Expect(err).ToNot(HaveOccurred())
 		Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream + 4))
 	})
@@ -83,14 +84,14 @@ var _ = Describe("Streams Map (incoming)", func() {
 
 	It("errors when trying to get a stream ID higher than the maximum", func() {
 		_, err := m.GetOrOpenStream(initialMaxStream + 4)
-		Expect(err).To(MatchError(fmt.Errorf("peer tried to open stream %d (current limit: %d)", initialMaxStream+4, initialMaxStream)))
+		Expect(err).To(MatchError(fmt.Errorf("peer tried to open stream %d (current limit: %d streams)", initialMaxStream+4, maxNumStreams)))
 	})
 
 	It("blocks AcceptStream until a new stream is available", func() {
 		strChan := make(chan item)
 		go func() {
 			defer GinkgoRecover()
-			str, err := m.AcceptStream()
+			str, err := m.AcceptStream(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			strChan <- str
 		}()
@@ -104,11 +105,11 @@ var _ = Describe("Streams Map (incoming)", func() {
 	})
 
 	It("works with stream 0", func() {
-		m = newIncomingItemsMap(0, 1000, 1000, mockSender.queueControlFrame, newItem)
+		m = newIncomingItemsMap(0, 1000, mockSender.queueControlFrame, newItem)
 		strChan := make(chan item)
 		go func() {
 			defer GinkgoRecover()
-			str, err := m.AcceptStream()
+			str, err := m.AcceptStream(context.Background())
 			Expect(err).ToNot(HaveOccurred())
 			strChan <- str
 		}()
@@ -126,7 +127,7 @@ var _ = Describe("Streams Map (incoming)", func() {
 		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
-			_, err := m.AcceptStream()
+			_, err := m.AcceptStream(context.Background())
 			Expect(err).To(MatchError(testErr))
 			close(done)
 		}()
@@ -135,10 +136,30 @@ var _ = Describe("Streams Map (incoming)", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("unblocks AcceptStream when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, err := m.AcceptStream(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+			close(done)
+		}()
+		Consistently(done).ShouldNot(BeClosed())
+		cancel()
+		Eventually(done).Should(BeClosed())
+		// the next call to AcceptStream returns the first stream
+		_, err := m.GetOrOpenStream(firstNewStream)
+		Expect(err).ToNot(HaveOccurred())
+		str, err := m.AcceptStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
+	})
+
 	It("errors AcceptStream immediately if it is closed", func() {
 		testErr := errors.New("test error")
 		m.CloseWithError(testErr)
-		_, err := m.AcceptStream()
+		_, err := m.AcceptStream(context.Background())
 		Expect(err).To(MatchError(testErr))
 	})
 
@@ -184,4 +205,63 @@ var _ = Describe("Streams Map (incoming)", func() {
 		})
 		Expect(m.DeleteStream(firstNewStream + 3*4)).To(Succeed())
 	})
+
+	Context("changing the stream limit", func() {
+		It("grants more streams when the limit is raised", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any()).Do(func(f wire.Frame) {
+				Expect(f.(*wire.MaxStreamsFrame).MaxStreams).To(Equal(maxNumStreams + 3))
+			})
+			m.SetMaxNumStreams(maxNumStreams + 3)
+			_, err := m.GetOrOpenStream(initialMaxStream + 3*4)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = m.GetOrOpenStream(initialMaxStream + 4*4)
+			Expect(err).To(MatchError(fmt.Sprintf("peer tried to open stream %d (current limit: %d streams)", initialMaxStream+4*4, maxNumStreams+3)))
+		})
+
+		It("doesn't grant more streams when the limit is lowered", func() {
+			m.SetMaxNumStreams(2)
+			_, err := m.GetOrOpenStream(firstNewStream + 2*4)
+			Expect(err).ToNot(HaveOccurred())
+			// 3 streams are open, and the limit is 2
+			Expect(m.DeleteStream(firstNewStream)).To(Succeed())
+			// 2 streams are open, and the limit is 2
+			Expect(m.DeleteStream(firstNewStream + 4)).To(Succeed())
+			// the peer can still open the streams that it was granted before
+			_, err = m.GetOrOpenStream(initialMaxStream)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("grants new streams after lowering the limit, once enough streams were closed", func() {
+			m.SetMaxNumStreams(2)
+			_, err := m.GetOrOpenStream(initialMaxStream)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				Expect(m.DeleteStream(firstNewStream + 4*protocol.StreamID(i))).To(Succeed())
+			}
+			mockSender.EXPECT().queueControlFrame(gomock.Any()).Do(func(f wire.Frame) {
+				Expect(f.(*wire.MaxStreamsFrame).MaxStreams).To(Equal(maxNumStreams + 1))
+			})
+			Expect(m.DeleteStream(firstNewStream + 3*4)).To(Succeed())
+		})
+
+		It("allows opening streams after raising the limit from 0", func() {
+			m = newIncomingItemsMap(0, 0, mockSender.queueControlFrame, newItem)
+			_, err := m.GetOrOpenStream(0)
+			Expect(err).To(MatchError("peer tried to open stream 0 (current limit: 0 streams)"))
+			mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{Type: streamTypeGeneric, MaxStreams: 1})
+			m.SetMaxNumStreams(1)
+			_, err = m.GetOrOpenStream(0)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	It("reports the stream credit", func() {
+		Expect(m.Credit()).To(Equal(StreamCredit{MaxStreams: maxNumStreams, Remaining: maxNumStreams}))
+		_, err := m.GetOrOpenStream(firstNewStream + 4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Credit()).To(Equal(StreamCredit{MaxStreams: maxNumStreams, Remaining: maxNumStreams - 2}))
+		mockSender.EXPECT().queueControlFrame(gomock.Any())
+		Expect(m.DeleteStream(firstNewStream)).To(Succeed())
+		Expect(m.Credit()).To(Equal(StreamCredit{MaxStreams: maxNumStreams + 1, Remaining: maxNumStreams - 1}))
+	})
 })
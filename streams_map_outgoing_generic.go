@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -13,14 +14,14 @@ import (
 //go:generate genny -in $GOFILE -out streams_map_outgoing_uni.go gen "item=sendStreamI Item=UniStream streamTypeGeneric=protocol.StreamTypeUni"
 type outgoingItemsMap struct {
 	mutex sync.RWMutex
-	cond  sync.Cond
+	// maxStreamChan is closed (and replaced) when the stream limit is increased, or when the map is closed
+	maxStreamChan chan struct{}
 
 	streams map[protocol.StreamID]item
 
-	nextStream   protocol.StreamID // stream ID of the stream returned by OpenStream(Sync)
-	maxStream    protocol.StreamID // the maximum stream ID we're allowed to open
-	maxStreamSet bool              // was maxStream set. If not, it's not possible to any stream (also works for stream 0)
-	blockedSent  bool              // was a STREAMS_BLOCKED sent for the current maxStream
+	nextStream  protocol.StreamID // stream ID of the stream returned by OpenStream(Sync)
+	maxStreams  uint64            // the maximum number of streams we're allowed to open
+	blockedSent bool              // was a STREAMS_BLOCKED sent for the current maxStreams
 
 	newStream            func(protocol.StreamID) item
 	queueStreamIDBlocked func(*wire.StreamsBlockedFrame)
@@ -38,8 +39,8 @@ func newOutgoingItemsMap(
 		nextStream:           nextStream,
 		newStream:            newStream,
 		queueStreamIDBlocked: func(f *wire.StreamsBlockedFrame) { queueControlFrame(f) },
+		maxStreamChan:        make(chan struct{}),
 	}
-	m.cond.L = &m.mutex
 	return m
 }
 
@@ -50,7 +51,7 @@ func (m *outgoingItemsMap) OpenStream() (item, error) {
 	return m.openStreamImpl()
 }
 
-func (m *outgoingItemsMap) OpenStreamSync() (item, error) {
+func (m *outgoingItemsMap) OpenStreamSync(ctx context.Context) (item, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -59,33 +60,41 @@ func (m *outgoingItemsMap) OpenStreamSync() (item, error) {
 		if err == nil {
 			return str, err
 		}
-		if err != nil && err != qerr.TooManyOpenStreams {
+		if err != nil && err != qerr.StreamLimitError {
 			return nil, err
 		}
-		m.cond.Wait()
+		maxStreamChan := m.maxStreamChan
+		m.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			m.mutex.Lock()
+			return nil, ctx.Err()
+		case <-maxStreamChan:
+		}
+		m.mutex.Lock()
 	}
 }
 
+// signalMaxStream must be called with the mutex held
+func (m *outgoingItemsMap) signalMaxStream() {
+	close(m.maxStreamChan)
+	m.maxStreamChan = make(chan struct{})
+}
+
 func (m *outgoingItemsMap) openStreamImpl() (item, error) {
 	if m.closeErr != nil {
 		return nil, m.closeErr
 	}
-	if !m.maxStreamSet || m.nextStream > m.maxStream {
+	if m.nextStream.StreamNum() > m.maxStreams {
+		// tell the peer that we're blocked, so it can grant us more streams
 		if !m.blockedSent {
-			if m.maxStreamSet {
-				m.queueStreamIDBlocked(&wire.StreamsBlockedFrame{
-					Type:        streamTypeGeneric,
-					StreamLimit: m.maxStream.StreamNum(),
-				})
-			} else {
-				m.queueStreamIDBlocked(&wire.StreamsBlockedFrame{
-					Type:        streamTypeGeneric,
-					StreamLimit: 0,
-				})
-			}
+			m.queueStreamIDBlocked(&wire.StreamsBlockedFrame{
+				Type:        streamTypeGeneric,
+				StreamLimit: m.maxStreams,
+			})
 			m.blockedSent = true
 		}
-		return nil, qerr.TooManyOpenStreams
+		return nil, qerr.StreamLimitError
 	}
 	s := m.newStream(m.nextStream)
 	m.streams[m.nextStream] = s
@@ -97,7 +106,7 @@ func (m *outgoingItemsMap) GetStream(id protocol.StreamID) (item, error) {
 	m.mutex.RLock()
 	if id >= m.nextStream {
 		m.mutex.RUnlock()
-		return nil, qerr.Error(qerr.InvalidStreamID, fmt.Sprintf("peer attempted to open stream %d", id))
+		return nil, qerr.Error(qerr.StreamStateError, fmt.Sprintf("peer attempted to open stream %d", id))
 	}
 	s := m.streams[id]
 	m.mutex.RUnlock()
@@ -115,13 +124,12 @@ func (m *outgoingItemsMap) DeleteStream(id protocol.StreamID) error {
 	return nil
 }
 
-func (m *outgoingItemsMap) SetMaxStream(id protocol.StreamID) {
+func (m *outgoingItemsMap) SetMaxStreams(num uint64) {
 	m.mutex.Lock()
-	if !m.maxStreamSet || id > m.maxStream {
-		m.maxStream = id
-		m.maxStreamSet = true
+	if num > m.maxStreams {
+		m.maxStreams = num
 		m.blockedSent = false
-		m.cond.Broadcast()
+		m.signalMaxStream()
 	}
 	m.mutex.Unlock()
 }
@@ -132,6 +140,6 @@ func (m *outgoingItemsMap) CloseWithError(err error) {
 	for _, str := range m.streams {
 		str.closeForShutdown(err)
 	}
-	m.cond.Broadcast()
+	m.signalMaxStream()
 	m.mutex.Unlock()
 }
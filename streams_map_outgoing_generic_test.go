@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 
 	"github.com/golang/mock/gomock"
@@ -30,7 +31,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 
 	Context("no stream ID limit", func() {
 		BeforeEach(func() {
-			m.SetMaxStream(0xffffffff)
+			m.SetMaxStreams(0xffffffff)
 		})
 
 		It("opens streams", func() {
@@ -59,7 +60,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 
 		It("errors when trying to get a stream that has not yet been opened", func() {
 			_, err := m.GetStream(firstNewStream)
-			Expect(err).To(MatchError(qerr.Error(qerr.InvalidStreamID, "peer attempted to open stream 3")))
+			Expect(err).To(MatchError(qerr.Error(qerr.StreamStateError, "peer attempted to open stream 3")))
 		})
 
 		It("deletes streams", func() {
@@ -104,7 +105,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 		It("errors when no stream can be opened immediately", func() {
 			mockSender.EXPECT().queueControlFrame(gomock.Any())
 			_, err := m.OpenStream()
-			Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+			Expect(err).To(MatchError(qerr.StreamLimitError))
 		})
 
 		It("blocks until a stream can be opened synchronously", func() {
@@ -112,14 +113,14 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				str, err := m.OpenStreamSync()
+				str, err := m.OpenStreamSync(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
 				close(done)
 			}()
 
 			Consistently(done).ShouldNot(BeClosed())
-			m.SetMaxStream(firstNewStream)
+			m.SetMaxStreams(1)
 			Eventually(done).Should(BeClosed())
 		})
 
@@ -131,14 +132,14 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				str, err := m.OpenStreamSync()
+				str, err := m.OpenStreamSync(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(str.(*mockGenericStream).id).To(BeZero())
 				close(done)
 			}()
 
 			Consistently(done).ShouldNot(BeClosed())
-			m.SetMaxStream(0)
+			m.SetMaxStreams(1)
 			Eventually(done).Should(BeClosed())
 		})
 
@@ -148,7 +149,7 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				_, err := m.OpenStreamSync()
+				_, err := m.OpenStreamSync(context.Background())
 				Expect(err).To(MatchError(testErr))
 				close(done)
 			}()
@@ -158,9 +159,30 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("stops opening synchronously when the context is canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := m.OpenStreamSync(ctx)
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+			// make sure the stream ID wasn't consumed
+			m.SetMaxStreams(1)
+			str, err := m.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream))
+		})
+
 		It("doesn't reduce the stream limit", func() {
-			m.SetMaxStream(firstNewStream + 4)
-			m.SetMaxStream(firstNewStream)
+			m.SetMaxStreams(2)
+			m.SetMaxStreams(1)
 			_, err := m.OpenStream()
 			Expect(err).ToNot(HaveOccurred())
 			str, err := m.OpenStream()
@@ -168,8 +190,38 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			Expect(str.(*mockGenericStream).id).To(Equal(firstNewStream + 4))
 		})
 
+		It("doesn't open any streams if the limit is 0", func() {
+			m = newOutgoingItemsMap(0, newItem, mockSender.queueControlFrame)
+			m.SetMaxStreams(0)
+			mockSender.EXPECT().queueControlFrame(&wire.StreamsBlockedFrame{Type: streamTypeGeneric, StreamLimit: 0})
+			_, err := m.OpenStream()
+			Expect(err).To(MatchError(qerr.StreamLimitError))
+		})
+
+		It("sends a new STREAMS_BLOCKED frame when OpenStreamSync is still blocked after the limit was increased", func() {
+			gomock.InOrder(
+				mockSender.EXPECT().queueControlFrame(&wire.StreamsBlockedFrame{Type: streamTypeGeneric, StreamLimit: 0}),
+				mockSender.EXPECT().queueControlFrame(&wire.StreamsBlockedFrame{Type: streamTypeGeneric, StreamLimit: 1}),
+			)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := m.OpenStreamSync(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenStreamSync(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				close(done)
+			}()
+
+			Consistently(done).ShouldNot(BeClosed())
+			m.SetMaxStreams(1)
+			Consistently(done).ShouldNot(BeClosed())
+			m.SetMaxStreams(2)
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("queues a STREAM_ID_BLOCKED frame if no stream can be opened", func() {
-			m.SetMaxStream(firstNewStream + 5*4)
+			m.SetMaxStreams(6)
 			// open the 6 allowed streams
 			for i := 0; i < 6; i++ {
 				_, err := m.OpenStream()
@@ -180,11 +232,11 @@ var _ = Describe("Streams Map (outgoing)", func() {
 				Expect(f.(*wire.StreamsBlockedFrame).StreamLimit).To(BeEquivalentTo(6))
 			})
 			_, err := m.OpenStream()
-			Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+			Expect(err).To(MatchError(qerr.StreamLimitError))
 		})
 
 		It("only sends one STREAM_ID_BLOCKED frame for one stream ID", func() {
-			m.SetMaxStream(firstNewStream)
+			m.SetMaxStreams(1)
 			mockSender.EXPECT().queueControlFrame(gomock.Any()).Do(func(f wire.Frame) {
 				Expect(f.(*wire.StreamsBlockedFrame).StreamLimit).To(BeEquivalentTo(1))
 			})
@@ -192,9 +244,9 @@ var _ = Describe("Streams Map (outgoing)", func() {
 			Expect(err).ToNot(HaveOccurred())
 			// try to open a stream twice, but expect only one STREAM_ID_BLOCKED to be sent
 			_, err = m.OpenStream()
-			Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+			Expect(err).To(MatchError(qerr.StreamLimitError))
 			_, err = m.OpenStream()
-			Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+			Expect(err).To(MatchError(qerr.StreamLimitError))
 		})
 	})
 })
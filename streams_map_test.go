@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -71,10 +72,24 @@ var _ = Describe("Streams Map", func() {
 
 			BeforeEach(func() {
 				mockSender = NewMockStreamSender(mockCtrl)
-				m = newStreamsMap(mockSender, newFlowController, maxBidiStreams, maxUniStreams, perspective, protocol.VersionWhatever).(*streamsMap)
+				m = newStreamsMap(mockSender, newFlowController, maxBidiStreams, maxUniStreams, protocol.DefaultStreamSendBufferSize, perspective, protocol.VersionWhatever).(*streamsMap)
 			})
 
 			Context("opening", func() {
+				It("enables reliable stream resets, if the peer supports them", func() {
+					m.UpdateLimits(&handshake.TransportParameters{
+						MaxBidiStreams: 5,
+						MaxUniStreams:  5,
+						ResetStreamAt:  true,
+					})
+					str, err := m.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.(*stream).peerSupportsResetStreamAt).To(BeTrue())
+					ustr, err := m.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ustr.(*sendStream).peerSupportsResetStreamAt).To(BeTrue())
+				})
+
 				It("opens bidirectional streams", func() {
 					allowUnlimitedStreams()
 					str, err := m.OpenStream()
@@ -104,7 +119,7 @@ var _ = Describe("Streams Map", func() {
 				It("accepts bidirectional streams", func() {
 					_, err := m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream)
 					Expect(err).ToNot(HaveOccurred())
-					str, err := m.AcceptStream()
+					str, err := m.AcceptStream(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str).To(BeAssignableToTypeOf(&stream{}))
 					Expect(str.StreamID()).To(Equal(ids.firstIncomingBidiStream))
@@ -113,7 +128,7 @@ var _ = Describe("Streams Map", func() {
 				It("accepts unidirectional streams", func() {
 					_, err := m.GetOrOpenReceiveStream(ids.firstIncomingUniStream)
 					Expect(err).ToNot(HaveOccurred())
-					str, err := m.AcceptUniStream()
+					str, err := m.AcceptUniStream(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str).To(BeAssignableToTypeOf(&receiveStream{}))
 					Expect(str.StreamID()).To(Equal(ids.firstIncomingUniStream))
@@ -190,7 +205,7 @@ var _ = Describe("Streams Map", func() {
 					It("errors when the peer tries to open a higher outgoing bidirectional stream", func() {
 						id := ids.firstOutgoingBidiStream + 5*4
 						_, err := m.GetOrOpenSendStream(id)
-						Expect(err).To(MatchError(qerr.Error(qerr.InvalidStreamID, fmt.Sprintf("peer attempted to open stream %d", id))))
+						Expect(err).To(MatchError(qerr.Error(qerr.StreamStateError, fmt.Sprintf("peer attempted to open stream %d", id))))
 					})
 
 					It("gets an outgoing unidirectional stream", func() {
@@ -206,7 +221,7 @@ var _ = Describe("Streams Map", func() {
 					It("errors when the peer tries to open a higher outgoing bidirectional stream", func() {
 						id := ids.firstOutgoingUniStream + 5*4
 						_, err := m.GetOrOpenSendStream(id)
-						Expect(err).To(MatchError(qerr.Error(qerr.InvalidStreamID, fmt.Sprintf("peer attempted to open stream %d", id))))
+						Expect(err).To(MatchError(qerr.Error(qerr.StreamStateError, fmt.Sprintf("peer attempted to open stream %d", id))))
 					})
 
 					It("gets an incoming bidirectional stream", func() {
@@ -237,7 +252,7 @@ var _ = Describe("Streams Map", func() {
 					It("errors when the peer tries to open a higher outgoing bidirectional stream", func() {
 						id := ids.firstOutgoingBidiStream + 5*4
 						_, err := m.GetOrOpenReceiveStream(id)
-						Expect(err).To(MatchError(qerr.Error(qerr.InvalidStreamID, fmt.Sprintf("peer attempted to open stream %d", id))))
+						Expect(err).To(MatchError(qerr.Error(qerr.StreamStateError, fmt.Sprintf("peer attempted to open stream %d", id))))
 					})
 
 					It("gets an incoming bidirectional stream", func() {
@@ -270,25 +285,25 @@ var _ = Describe("Streams Map", func() {
 				It("processes the parameter for outgoing streams, as a server", func() {
 					m.perspective = protocol.PerspectiveServer
 					_, err := m.OpenStream()
-					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+					Expect(err).To(MatchError(qerr.StreamLimitError))
 					m.UpdateLimits(&handshake.TransportParameters{
 						MaxBidiStreams: 5,
 						MaxUniStreams:  5,
 					})
-					Expect(m.outgoingBidiStreams.maxStream).To(Equal(protocol.StreamID(17)))
-					Expect(m.outgoingUniStreams.maxStream).To(Equal(protocol.StreamID(19)))
+					Expect(m.outgoingBidiStreams.maxStreams).To(BeEquivalentTo(5))
+					Expect(m.outgoingUniStreams.maxStreams).To(BeEquivalentTo(5))
 				})
 
 				It("processes the parameter for outgoing streams, as a client", func() {
 					m.perspective = protocol.PerspectiveClient
 					_, err := m.OpenUniStream()
-					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+					Expect(err).To(MatchError(qerr.StreamLimitError))
 					m.UpdateLimits(&handshake.TransportParameters{
 						MaxBidiStreams: 5,
 						MaxUniStreams:  5,
 					})
-					Expect(m.outgoingBidiStreams.maxStream).To(Equal(protocol.StreamID(16)))
-					Expect(m.outgoingUniStreams.maxStream).To(Equal(protocol.StreamID(18)))
+					Expect(m.outgoingBidiStreams.maxStreams).To(BeEquivalentTo(5))
+					Expect(m.outgoingUniStreams.maxStreams).To(BeEquivalentTo(5))
 				})
 			})
 
@@ -299,7 +314,7 @@ var _ = Describe("Streams Map", func() {
 
 				It("processes IDs for outgoing bidirectional streams", func() {
 					_, err := m.OpenStream()
-					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+					Expect(err).To(MatchError(qerr.StreamLimitError))
 					Expect(m.HandleMaxStreamsFrame(&wire.MaxStreamsFrame{
 						Type:       protocol.StreamTypeBidi,
 						MaxStreams: 1,
@@ -308,12 +323,12 @@ var _ = Describe("Streams Map", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str.StreamID()).To(Equal(ids.firstOutgoingBidiStream))
 					_, err = m.OpenStream()
-					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+					Expect(err).To(MatchError(qerr.StreamLimitError))
 				})
 
 				It("processes IDs for outgoing unidirectional streams", func() {
 					_, err := m.OpenUniStream()
-					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+					Expect(err).To(MatchError(qerr.StreamLimitError))
 					Expect(m.HandleMaxStreamsFrame(&wire.MaxStreamsFrame{
 						Type:       protocol.StreamTypeUni,
 						MaxStreams: 1,
@@ -322,7 +337,7 @@ var _ = Describe("Streams Map", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(str.StreamID()).To(Equal(ids.firstOutgoingUniStream))
 					_, err = m.OpenUniStream()
-					Expect(err).To(MatchError(qerr.TooManyOpenStreams))
+					Expect(err).To(MatchError(qerr.StreamLimitError))
 				})
 			})
 
@@ -346,6 +361,26 @@ var _ = Describe("Streams Map", func() {
 					})
 					Expect(m.DeleteStream(ids.firstIncomingUniStream)).To(Succeed())
 				})
+
+				It("sends a MAX_STREAMS frame when the bidirectional stream limit is raised", func() {
+					mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+						Type:       protocol.StreamTypeBidi,
+						MaxStreams: maxBidiStreams + 10,
+					})
+					m.SetMaxIncomingStreams(maxBidiStreams + 10)
+					Expect(m.IncomingStreamCredit()).To(Equal(StreamCredit{MaxStreams: maxBidiStreams + 10, Remaining: maxBidiStreams + 10}))
+					Expect(m.IncomingUniStreamCredit()).To(Equal(StreamCredit{MaxStreams: maxUniStreams, Remaining: maxUniStreams}))
+				})
+
+				It("sends a MAX_STREAMS frame when the unidirectional stream limit is raised", func() {
+					mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+						Type:       protocol.StreamTypeUni,
+						MaxStreams: maxUniStreams + 10,
+					})
+					m.SetMaxIncomingUniStreams(maxUniStreams + 10)
+					Expect(m.IncomingUniStreamCredit()).To(Equal(StreamCredit{MaxStreams: maxUniStreams + 10, Remaining: maxUniStreams + 10}))
+					Expect(m.IncomingStreamCredit()).To(Equal(StreamCredit{MaxStreams: maxBidiStreams, Remaining: maxBidiStreams}))
+				})
 			})
 
 			It("closes", func() {
@@ -355,9 +390,9 @@ var _ = Describe("Streams Map", func() {
 				Expect(err).To(MatchError(testErr))
 				_, err = m.OpenUniStream()
 				Expect(err).To(MatchError(testErr))
-				_, err = m.AcceptStream()
+				_, err = m.AcceptStream(context.Background())
 				Expect(err).To(MatchError(testErr))
-				_, err = m.AcceptUniStream()
+				_, err = m.AcceptUniStream(context.Background())
 				Expect(err).To(MatchError(testErr))
 			})
 		})